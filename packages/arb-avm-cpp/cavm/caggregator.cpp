@@ -163,3 +163,32 @@ int aggregatorUpdateLogsProcessedCount(CAggregatorStore* agg, void* count_ptr) {
         return false;
     }
 }
+
+Uint64Result aggregatorOldestAvailableBlock(const CAggregatorStore* agg) {
+    try {
+        auto height =
+            static_cast<const AggregatorStore*>(agg)->oldestAvailableBlock();
+        if (height) {
+            return {*height, true};
+        } else {
+            return {0, false};
+        }
+    } catch (const std::exception& e) {
+        std::cerr << "Failed to load oldest available block: " << e.what()
+                  << std::endl;
+        return {0, false};
+    }
+}
+
+int aggregatorUpdateOldestAvailableBlock(CAggregatorStore* agg,
+                                         uint64_t block_height) {
+    try {
+        static_cast<AggregatorStore*>(agg)->updateOldestAvailableBlock(
+            block_height);
+        return true;
+    } catch (const std::exception& e) {
+        std::cerr << "Failed to update oldest available block: " << e.what()
+                  << std::endl;
+        return false;
+    }
+}
@@ -77,6 +77,10 @@ Uint64Result aggregatorGetPossibleBlock(const CAggregatorStore* agg,
 Uint256Result aggregatorLogsProcessedCount(CAggregatorStore* agg);
 int aggregatorUpdateLogsProcessedCount(CAggregatorStore* agg, void* count_ptr);
 
+Uint64Result aggregatorOldestAvailableBlock(const CAggregatorStore* agg);
+int aggregatorUpdateOldestAvailableBlock(CAggregatorStore* agg,
+                                         uint64_t block_height);
+
 #ifdef __cplusplus
 }
 #endif
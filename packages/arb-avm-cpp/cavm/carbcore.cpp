@@ -51,6 +51,24 @@ int arbCoreMachineIdle(CArbCore* arbcore_ptr) {
     return arb_core->machineIdle();
 }
 
+int arbCoreThreadRunning(CArbCore* arbcore_ptr) {
+    auto arb_core = static_cast<ArbCore*>(arbcore_ptr);
+    return arb_core->threadRunning();
+}
+
+void arbCorePruneCheckpoints(CArbCore* arbcore_ptr,
+                             const void* delete_before_message_ptr,
+                             const void* save_message_interval_ptr) {
+    auto arb_core = static_cast<ArbCore*>(arbcore_ptr);
+    arb_core->pruneCheckpoints(receiveUint256(delete_before_message_ptr),
+                               receiveUint256(save_message_interval_ptr));
+}
+
+int arbCoreCheckpointPruningPending(CArbCore* arbcore_ptr) {
+    auto arb_core = static_cast<ArbCore*>(arbcore_ptr);
+    return arb_core->checkpointPruningPending();
+}
+
 void* arbCoreMachineMessagesRead(CArbCore* arbcore_ptr) {
     auto arb_core = static_cast<ArbCore*>(arbcore_ptr);
     return returnUint256(arb_core->machineMessagesRead());
@@ -490,6 +508,23 @@ char* arbCoreLogsCursorClearError(CArbCore* arbcore_ptr,
     }
 }
 
+int arbCoreLogsCursorRewind(CArbCore* arbcore_ptr,
+                            const void* index_ptr,
+                            const void* count_ptr) {
+    auto arbcore = static_cast<ArbCore*>(arbcore_ptr);
+    auto cursor_index = receiveUint256(index_ptr);
+    auto count = receiveUint256(count_ptr);
+
+    try {
+        return arbcore->logsCursorRewind(
+            intx::narrow_cast<size_t>(cursor_index), count);
+    } catch (const std::exception& e) {
+        std::cerr << "Exception while rewinding logscursor " << e.what()
+                  << std::endl;
+        return 0;
+    }
+}
+
 CExecutionCursor* arbCoreGetExecutionCursor(CArbCore* arbcore_ptr,
                                             const void* total_gas_used_ptr) {
     auto arbcore = static_cast<ArbCore*>(arbcore_ptr);
@@ -578,3 +613,16 @@ CMachineResult arbCoreGetMachineForSideload(CArbCore* arbcore_ptr,
         return {nullptr, 0};
     }
 }
+
+Uint256Result arbCoreGetSideloadPosition(CArbCore* arbcore_ptr,
+                                         uint64_t block_number) {
+    auto arbcore = static_cast<ArbCore*>(arbcore_ptr);
+
+    try {
+        return returnUint256Result(arbcore->getSideloadPosition(block_number));
+    } catch (const std::exception& e) {
+        std::cerr << "Exception while loading sideload position " << e.what()
+                  << std::endl;
+        return {{}, false};
+    }
+}
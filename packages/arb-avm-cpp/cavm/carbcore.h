@@ -25,6 +25,11 @@ extern "C" {
 int arbCoreStartThread(CArbCore* arbcore_ptr);
 void arbCoreAbortThread(CArbCore* arbcore_ptr);
 int arbCoreMachineIdle(CArbCore* arbcore_ptr);
+int arbCoreThreadRunning(CArbCore* arbcore_ptr);
+void arbCorePruneCheckpoints(CArbCore* arbcore_ptr,
+                             const void* delete_before_message_ptr,
+                             const void* save_message_interval_ptr);
+int arbCoreCheckpointPruningPending(CArbCore* arbcore_ptr);
 void* arbCoreMachineMessagesRead(CArbCore* arbcore_ptr);
 int arbCoreMessagesStatus(CArbCore* arbcore_ptr);
 char* arbCoreMessagesClearError(CArbCore* arbcore_ptr);
@@ -96,6 +101,9 @@ int arbCoreLogsCursorCheckError(CArbCore* arbcore_ptr,
                                 const void* cursor_index);
 char* arbCoreLogsCursorClearError(CArbCore* arbcore_ptr,
                                   const void* cursor_index);
+int arbCoreLogsCursorRewind(CArbCore* arbcore_ptr,
+                            const void* cursor_index,
+                            const void* count);
 
 CExecutionCursor* arbCoreGetExecutionCursor(CArbCore* arbcore_ptr,
                                             const void* total_gas_used_ptr);
@@ -110,6 +118,8 @@ CMachine* arbCoreTakeMachine(CArbCore* arbcore_ptr,
 CMachineResult arbCoreGetMachineForSideload(CArbCore* arbcore_ptr,
                                             uint64_t block_number,
                                             int allow_slow_lookup);
+Uint256Result arbCoreGetSideloadPosition(CArbCore* arbcore_ptr,
+                                         uint64_t block_number);
 
 #ifdef __cplusplus
 }
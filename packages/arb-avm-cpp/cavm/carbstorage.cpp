@@ -16,6 +16,8 @@
 
 #include "carbstorage.h"
 
+#include "utils.hpp"
+
 #include <data_storage/aggregator.hpp>
 #include <data_storage/arbstorage.hpp>
 #include <data_storage/storageresult.hpp>
@@ -108,3 +110,71 @@ CAggregatorStore* createAggregatorStore(CArbStorage* storage_ptr) {
     auto storage = static_cast<ArbStorage*>(storage_ptr);
     return storage->getAggregatorStore().release();
 }
+
+namespace {
+std::vector<unsigned char> receiveBytes(const void* data, int length) {
+    auto ptr = reinterpret_cast<const unsigned char*>(data);
+    return {ptr, ptr + length};
+}
+}  // namespace
+
+int arbStoragePutValidatorState(CArbStorage* storage_ptr,
+                                const void* key,
+                                int key_length,
+                                const void* data,
+                                int data_length) {
+    auto storage = static_cast<ArbStorage*>(storage_ptr);
+    try {
+        auto status =
+            storage->putValidatorState(receiveBytes(key, key_length),
+                                       receiveBytes(data, data_length));
+        if (!status.ok()) {
+            std::cerr << "Error saving validator state: " << status.ToString()
+                      << std::endl;
+            return false;
+        }
+        return true;
+    } catch (const std::exception& e) {
+        std::cerr << "Exception saving validator state: " << e.what()
+                  << std::endl;
+        return false;
+    }
+}
+
+ByteSliceResult arbStorageGetValidatorState(CArbStorage* storage_ptr,
+                                            const void* key,
+                                            int key_length) {
+    auto storage = static_cast<ArbStorage*>(storage_ptr);
+    try {
+        auto res = storage->getValidatorState(receiveBytes(key, key_length));
+        if (!res.status.ok() && !res.status.IsNotFound()) {
+            std::cerr << "Error loading validator state: "
+                      << res.status.ToString() << std::endl;
+        }
+        return returnDataResult(res);
+    } catch (const std::exception& e) {
+        std::cerr << "Exception loading validator state: " << e.what()
+                  << std::endl;
+        return {{}, false};
+    }
+}
+
+int arbStorageDeleteValidatorState(CArbStorage* storage_ptr,
+                                   const void* key,
+                                   int key_length) {
+    auto storage = static_cast<ArbStorage*>(storage_ptr);
+    try {
+        auto status =
+            storage->deleteValidatorState(receiveBytes(key, key_length));
+        if (!status.ok() && !status.IsNotFound()) {
+            std::cerr << "Error deleting validator state: "
+                      << status.ToString() << std::endl;
+            return false;
+        }
+        return true;
+    } catch (const std::exception& e) {
+        std::cerr << "Exception deleting validator state: " << e.what()
+                  << std::endl;
+        return false;
+    }
+}
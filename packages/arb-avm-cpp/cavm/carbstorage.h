@@ -52,6 +52,18 @@ int closeArbStorage(CArbStorage* storage_ptr);
 CArbCore* createArbCore(CArbStorage* storage_ptr);
 CAggregatorStore* createAggregatorStore(CArbStorage* storage_ptr);
 
+int arbStoragePutValidatorState(CArbStorage* storage_ptr,
+                                const void* key,
+                                int key_length,
+                                const void* data,
+                                int data_length);
+ByteSliceResult arbStorageGetValidatorState(CArbStorage* storage_ptr,
+                                            const void* key,
+                                            int key_length);
+int arbStorageDeleteValidatorState(CArbStorage* storage_ptr,
+                                   const void* key,
+                                   int key_length);
+
 #ifdef __cplusplus
 }
 #endif
@@ -65,6 +65,22 @@ func (ac *ArbCore) MachineIdle() bool {
 	return status == 1
 }
 
+func (ac *ArbCore) ThreadRunning() bool {
+	status := C.arbCoreThreadRunning(ac.c)
+	return status == 1
+}
+
+func (ac *ArbCore) PruneCheckpoints(deleteBeforeMessage *big.Int, saveMessageInterval *big.Int) {
+	deleteBeforeMessageData := math.U256Bytes(deleteBeforeMessage)
+	saveMessageIntervalData := math.U256Bytes(saveMessageInterval)
+	C.arbCorePruneCheckpoints(ac.c, unsafeDataPointer(deleteBeforeMessageData), unsafeDataPointer(saveMessageIntervalData))
+}
+
+func (ac *ArbCore) CheckpointPruningPending() bool {
+	status := C.arbCoreCheckpointPruningPending(ac.c)
+	return status == 1
+}
+
 func (ac *ArbCore) MachineMessagesRead() *big.Int {
 	return receiveBigInt(C.arbCoreMachineMessagesRead(ac.c))
 }
@@ -485,6 +501,16 @@ func (ac *ArbCore) LogsCursorConfirmReceived(cursorIndex *big.Int) (bool, error)
 	return true, nil
 }
 
+func (ac *ArbCore) LogsCursorRewind(cursorIndex *big.Int, count *big.Int) error {
+	cursorIndexData := math.U256Bytes(cursorIndex)
+	countData := math.U256Bytes(count)
+	status := C.arbCoreLogsCursorRewind(ac.c, unsafeDataPointer(cursorIndexData), unsafeDataPointer(countData))
+	if status == 0 {
+		return errors.New("failed to rewind logs cursor")
+	}
+	return nil
+}
+
 func (ac *ArbCore) GetMachineForSideload(blockNumber uint64, allowSlowLookup bool) (machine.Machine, error) {
 	CallowSlowLookup := 0
 	if allowSlowLookup {
@@ -503,3 +529,13 @@ func (ac *ArbCore) GetMachineForSideload(blockNumber uint64, allowSlowLookup boo
 	return WrapCMachine(cMachineResult.machine), nil
 
 }
+
+// GetSideloadPosition returns the total gas used by the machine when it
+// reached the sideload for blockNumber
+func (ac *ArbCore) GetSideloadPosition(blockNumber uint64) (*big.Int, error) {
+	result := C.arbCoreGetSideloadPosition(ac.c, C.uint64_t(blockNumber))
+	if result.found == 0 {
+		return nil, errors.Errorf("failed to get sideload position for block %v", blockNumber)
+	}
+	return receiveBigInt(result.value), nil
+}
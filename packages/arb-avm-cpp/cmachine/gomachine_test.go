@@ -0,0 +1,204 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmachine
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/gotest"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/gomachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+)
+
+// TestGoMachineMatches steps the C++ and Go machines through each test
+// program one instruction at a time, checking that their hashes and one step
+// proofs agree along the way
+func TestGoMachineMatches(t *testing.T) {
+	files, err := gotest.OpCodeTestFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			cMach, err := New(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goMach, err := gomachine.New(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMachinesMatch(t, cMach, goMach)
+		})
+	}
+}
+
+func checkMachinesMatch(t *testing.T, cMach, goMach machine.Machine) {
+	gasUsed := uint64(0)
+	for i := 0; ; i++ {
+		if cMach.Hash() != goMach.Hash() {
+			t.Fatalf("machine hashes differ at step %v\nC++: %v\nGo: %v", i, cMach, goMach)
+		}
+		if cMach.IsBlocked(false) != nil {
+			break
+		}
+
+		cProof, cBufferProof, err := cMach.MarshalForProof()
+		if err != nil {
+			t.Fatal(err)
+		}
+		goProof, goBufferProof, err := goMach.MarshalForProof()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(cProof, goProof) {
+			t.Fatalf("proofs differ at step %v\nC++: %x\nGo:  %x", i, cProof, goProof)
+		}
+		if !bytes.Equal(cBufferProof, goBufferProof) {
+			t.Fatalf("buffer proofs differ at step %v\nC++: %x\nGo:  %x", i, cBufferProof, goBufferProof)
+		}
+
+		cAssertion, _, cSteps, err := cMach.ExecuteAssertion(gasUsed+1, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goAssertion, _, goSteps, err := goMach.ExecuteAssertion(gasUsed+1, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cSteps != goSteps {
+			t.Fatalf("step %v ran %v steps in C++ but %v steps in Go", i, cSteps, goSteps)
+		}
+		checkAssertionsMatch(t, fmt.Sprintf("step %v", i), cAssertion, goAssertion)
+		gasUsed += cAssertion.NumGas
+	}
+	if cMach.CurrentStatus() != goMach.CurrentStatus() {
+		t.Fatal("final status differs", cMach.CurrentStatus(), goMach.CurrentStatus())
+	}
+}
+
+func checkAssertionsMatch(t *testing.T, at string, cAssertion, goAssertion *protocol.ExecutionAssertion) {
+	t.Helper()
+	if cAssertion.NumGas != goAssertion.NumGas {
+		t.Fatalf("%v used %v gas in C++ but %v gas in Go", at, cAssertion.NumGas, goAssertion.NumGas)
+	}
+	if cAssertion.InboxMessagesConsumed != goAssertion.InboxMessagesConsumed {
+		t.Fatalf(
+			"%v consumed %v messages in C++ but %v messages in Go",
+			at,
+			cAssertion.InboxMessagesConsumed,
+			goAssertion.InboxMessagesConsumed,
+		)
+	}
+	if len(cAssertion.Sends) != len(goAssertion.Sends) {
+		t.Fatalf("%v made %v sends in C++ but %v sends in Go", at, len(cAssertion.Sends), len(goAssertion.Sends))
+	}
+	for i := range cAssertion.Sends {
+		if !bytes.Equal(cAssertion.Sends[i], goAssertion.Sends[i]) {
+			t.Fatalf("send %v differs at %v\nC++: %x\nGo:  %x", i, at, cAssertion.Sends[i], goAssertion.Sends[i])
+		}
+	}
+	if len(cAssertion.Logs) != len(goAssertion.Logs) {
+		t.Fatalf("%v emitted %v logs in C++ but %v logs in Go", at, len(cAssertion.Logs), len(goAssertion.Logs))
+	}
+	for i := range cAssertion.Logs {
+		if cAssertion.Logs[i].Hash() != goAssertion.Logs[i].Hash() {
+			t.Fatalf("log %v differs at %v\nC++: %v\nGo:  %v", i, at, cAssertion.Logs[i], goAssertion.Logs[i])
+		}
+	}
+}
+
+// arbOSCheckGas is the amount of gas ArbOS runs for between comparisons of the
+// machines in TestGoMachineMatchesArbOS
+const arbOSCheckGas = 1_000_000
+
+// TestGoMachineMatchesArbOS runs ArbOS on the C++ and Go machines with the
+// inbox messages from the ArbOS test cases, along with a sideload, checking
+// that their hashes and assertions agree along the way
+func TestGoMachineMatchesArbOS(t *testing.T) {
+	arbosPath, err := gotest.ArbOSPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cMach, err := New(arbosPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goMach, err := gomachine.New(arbosPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cMach.Hash() != goMach.Hash() {
+		t.Fatal("initial machine hashes differ")
+	}
+
+	files := []string{
+		"evm_direct_deploy_and_call_add",
+		"evm_test_arbsys",
+		"evm_xcontract_call_with_constructors",
+	}
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			messages, err := gotest.ArbOSCaseInbox(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Replay the last transaction as a sideload at the end of each block
+			sideloads := messages[len(messages)-1:]
+			checkArbOSMatches(t, cMach.Clone(), goMach.Clone(), messages, sideloads)
+		})
+	}
+}
+
+func checkArbOSMatches(t *testing.T, cMach, goMach machine.Machine, messages, sideloads []inbox.InboxMessage) {
+	gasUsed := uint64(0)
+	logCount := 0
+	for i := 0; ; i++ {
+		cAssertion, _, _, err := cMach.ExecuteAssertionAdvanced(gasUsed+arbOSCheckGas, true, messages, sideloads, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		goAssertion, _, _, err := goMach.ExecuteAssertionAdvanced(gasUsed+arbOSCheckGas, true, messages, sideloads, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAssertionsMatch(t, fmt.Sprintf("assertion %v", i), cAssertion, goAssertion)
+		if cMach.Hash() != goMach.Hash() {
+			t.Fatalf("machine hashes differ after assertion %v\nC++: %v\nGo: %v", i, cMach, goMach)
+		}
+		if cAssertion.NumGas == 0 {
+			break
+		}
+		messages = messages[cAssertion.InboxMessagesConsumed:]
+		gasUsed += cAssertion.NumGas
+		logCount += len(cAssertion.Logs)
+	}
+	if len(messages) != 0 {
+		t.Fatal(len(messages), "inbox messages weren't consumed")
+	}
+	if logCount == 0 {
+		t.Fatal("ArbOS didn't emit any logs")
+	}
+	if cMach.CurrentStatus() != goMach.CurrentStatus() {
+		t.Fatal("final status differs", cMach.CurrentStatus(), goMach.CurrentStatus())
+	}
+}
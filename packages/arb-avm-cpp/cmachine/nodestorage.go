@@ -199,3 +199,20 @@ func (as *NodeStore) UpdateCurrentLogCount(count *big.Int) error {
 	}
 	return nil
 }
+
+func (as *NodeStore) OldestAvailableBlock() (uint64, error) {
+	result := C.aggregatorOldestAvailableBlock(as.c)
+	if result.found == 0 {
+		// Nothing has been pruned
+		return 0, nil
+	}
+	return uint64(result.value), nil
+}
+
+func (as *NodeStore) UpdateOldestAvailableBlock(height uint64) error {
+	status := C.aggregatorUpdateOldestAvailableBlock(as.c, C.uint64_t(height))
+	if status == 0 {
+		return errors.New("failed to update oldest available block")
+	}
+	return nil
+}
@@ -115,3 +115,36 @@ func (s *ArbStorage) GetNodeStore() machine.NodeStore {
 	as := C.createAggregatorStore(s.c)
 	return NewNodeStore(as)
 }
+
+func (s *ArbStorage) PutValidatorState(key []byte, data []byte) error {
+	if len(key) == 0 || len(data) == 0 {
+		return errors.New("validator state key and data must be non-empty")
+	}
+	success := C.arbStoragePutValidatorState(s.c, unsafeDataPointer(key), C.int(len(key)), unsafeDataPointer(data), C.int(len(data)))
+	if success == 0 {
+		return errors.Errorf("failed to save validator state 0x%x", key)
+	}
+	return nil
+}
+
+func (s *ArbStorage) GetValidatorState(key []byte) ([]byte, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	res := C.arbStorageGetValidatorState(s.c, unsafeDataPointer(key), C.int(len(key)))
+	if res.found == 0 {
+		return nil, false
+	}
+	return receiveByteSlice(res.slice), true
+}
+
+func (s *ArbStorage) DeleteValidatorState(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("validator state key must be non-empty")
+	}
+	success := C.arbStorageDeleteValidatorState(s.c, unsafeDataPointer(key), C.int(len(key)))
+	if success == 0 {
+		return errors.Errorf("failed to delete validator state 0x%x", key)
+	}
+	return nil
+}
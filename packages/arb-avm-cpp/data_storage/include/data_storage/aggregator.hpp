@@ -50,6 +50,8 @@ class AggregatorStore {
     void reorg(uint64_t block_height);
     [[nodiscard]] ValueResult<uint256_t> logsProcessedCount() const;
     void updateLogsProcessedCount(const uint256_t& count);
+    [[nodiscard]] std::optional<uint64_t> oldestAvailableBlock() const;
+    void updateOldestAvailableBlock(uint64_t block_height);
     void saveMessageBatch(const uint256_t& batchNum, const uint64_t& logIndex);
     std::optional<uint64_t> getMessageBatch(const uint256_t& batchNum);
 };
@@ -184,6 +184,7 @@ class ArbCore {
 
     // Core thread machine state output
     std::atomic<bool> machine_idle{false};
+    std::atomic<bool> core_thread_running{false};
     std::atomic<bool> machine_error{false};
     std::string machine_error_string;
 
@@ -226,6 +227,10 @@ class ArbCore {
     rocksdb::Status reorgToMessageCountOrBefore(const uint256_t& message_count,
                                                 bool use_latest,
                                                 ValueCache& cache);
+    rocksdb::Status deleteOldCheckpoints(
+        const uint256_t& delete_checkpoints_before_message,
+        const uint256_t& save_checkpoint_message_interval,
+        const uint256_t& ignore_checkpoints_after_message);
     template <class T>
     std::unique_ptr<T> getMachineUsingStateKeys(
         const ReadTransaction& transaction,
@@ -252,9 +257,17 @@ class ArbCore {
     bool isCheckpointsEmpty(ReadTransaction& tx) const;
     uint256_t maxCheckpointGas();
 
+   public:
+    // Pruning old checkpoints, which is handled asynchronously by the core
+    // thread. Requests made while a previous one is pending are ignored.
+    void pruneCheckpoints(const uint256_t& delete_before_message,
+                          const uint256_t& save_message_interval);
+    bool checkpointPruningPending() const;
+
    public:
     // Managing machine state
     bool machineIdle();
+    bool threadRunning();
     std::optional<std::string> machineClearError();
     std::unique_ptr<Machine> getLastMachine();
     MachineOutput getLastMachineOutput();
@@ -279,6 +292,7 @@ class ArbCore {
     std::string logsCursorClearError(size_t cursor_index);
     bool logsCursorConfirmReceived(size_t cursor_index);
     ValueResult<uint256_t> logsCursorPosition(size_t cursor_index) const;
+    bool logsCursorRewind(size_t cursor_index, const uint256_t& count);
 
    private:
     // Logs cursor internal functions
@@ -427,6 +441,7 @@ class ArbCore {
 
     ValueResult<uint256_t> getSideloadPosition(ReadTransaction& tx,
                                                const uint256_t& block_number);
+    ValueResult<uint256_t> getSideloadPosition(const uint256_t& block_number);
 
    private:
     // Private sideload interaction
@@ -57,6 +57,14 @@ class ArbStorage {
     [[nodiscard]] std::unique_ptr<ReadTransaction> makeReadTransaction();
     [[nodiscard]] std::unique_ptr<ReadWriteTransaction>
     makeReadWriteTransaction();
+
+    // Small records owned by the validator, such as in progress challenges
+    rocksdb::Status putValidatorState(const std::vector<unsigned char>& key,
+                                      const std::vector<unsigned char>& data);
+    [[nodiscard]] DataResults getValidatorState(
+        const std::vector<unsigned char>& key);
+    rocksdb::Status deleteValidatorState(
+        const std::vector<unsigned char>& key);
 };
 
 #endif /* arbstorage_hpp */
@@ -60,6 +60,7 @@ class DataStorage {
     rocksdb::Status flushNextColumn();
     rocksdb::Status closeDb();
     rocksdb::Status clearDBExceptInbox();
+    rocksdb::Status compactMachineState();
 
    private:
     [[nodiscard]] std::unique_ptr<rocksdb::Transaction> beginTransaction()
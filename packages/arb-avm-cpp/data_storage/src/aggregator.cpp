@@ -40,6 +40,8 @@ constexpr auto block_hash_key_size = block_hash_key_prefix.size() + 32;
 constexpr auto message_batch_key_prefix = std::array<char, 1>{-56};
 constexpr auto message_batch_key_size = message_batch_key_prefix.size() + 32;
 
+constexpr auto oldest_available_block_key = std::array<char, 1>{-57};
+
 namespace {
 
 void commitTx(ReadWriteTransaction& tx) {
@@ -272,3 +274,19 @@ void AggregatorStore::updateLogsProcessedCount(const uint256_t& count) {
     updateLogsProcessedCountImpl(tx, count);
     commitTx(tx);
 }
+
+std::optional<uint64_t> AggregatorStore::oldestAvailableBlock() const {
+    ReadTransaction tx(data_storage);
+    return returnIndex(tx, oldest_available_block_key);
+}
+
+void AggregatorStore::updateOldestAvailableBlock(uint64_t block_height) {
+    ReadWriteTransaction tx(data_storage);
+    auto value = uint64Value(block_height);
+    auto s = tx.aggregatorPut(vecToSlice(oldest_available_block_key),
+                              vecToSlice(value));
+    if (!s.ok()) {
+        throw std::runtime_error("failed to save oldest available block");
+    }
+    commitTx(tx);
+}
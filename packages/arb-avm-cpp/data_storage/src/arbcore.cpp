@@ -73,6 +73,10 @@ bool ArbCore::machineIdle() {
     return machine_idle;
 }
 
+bool ArbCore::threadRunning() {
+    return core_thread_running;
+}
+
 ArbCore::message_status_enum ArbCore::messagesStatus() {
     auto current_status = message_data_status.load();
     if (current_status != MESSAGES_ERROR && current_status != MESSAGES_READY) {
@@ -561,6 +565,102 @@ uint256_t ArbCore::maxCheckpointGas() {
     }
 }
 
+void ArbCore::pruneCheckpoints(const uint256_t& delete_before_message,
+                               const uint256_t& save_message_interval) {
+    if (delete_checkpoints_before_message != uint256_t(0)) {
+        // Previous request hasn't been processed yet
+        return;
+    }
+    save_checkpoint_message_interval = save_message_interval;
+    ignore_checkpoints_after_message = delete_before_message;
+    delete_checkpoints_before_message = delete_before_message;
+}
+
+bool ArbCore::checkpointPruningPending() const {
+    return delete_checkpoints_before_message != uint256_t(0);
+}
+
+// deleteOldCheckpoints removes checkpoints that have read fewer than
+// delete_checkpoints_before_message messages along with the machine state
+// they reference. The newest checkpoint before the cutoff and the initial
+// checkpoint are always kept so that the core can still reorg and execution
+// can resume from the start of the retained range. The freed space is
+// reclaimed by compacting the machine state afterwards.
+rocksdb::Status ArbCore::deleteOldCheckpoints(
+    const uint256_t& delete_checkpoints_before_message,
+    const uint256_t& save_checkpoint_message_interval,
+    const uint256_t& ignore_checkpoints_after_message) {
+    ReadWriteTransaction tx(data_storage);
+    auto checkpoint_it = tx.checkpointGetIterator();
+
+    checkpoint_it->SeekToLast();
+    bool found_cutoff = false;
+    std::optional<uint256_t> last_saved_interval;
+    uint64_t deleted_count = 0;
+    while (checkpoint_it->Valid()) {
+        std::vector<unsigned char> checkpoint_vector(
+            checkpoint_it->value().data(),
+            checkpoint_it->value().data() + checkpoint_it->value().size());
+        auto checkpoint = extractMachineStateKeys(checkpoint_vector.begin());
+        auto messages_read = checkpoint.getTotalMessagesRead();
+
+        if (messages_read == 0) {
+            // Keep initial checkpoint
+            break;
+        }
+
+        bool keep = false;
+        if (!found_cutoff) {
+            if (messages_read >= delete_checkpoints_before_message ||
+                (ignore_checkpoints_after_message != 0 &&
+                 messages_read > ignore_checkpoints_after_message)) {
+                keep = true;
+            } else {
+                // Newest checkpoint before cutoff
+                found_cutoff = true;
+                keep = true;
+            }
+        } else if (save_checkpoint_message_interval != 0) {
+            // Iterating backwards, so the first checkpoint seen in each
+            // interval is the last one saved within it
+            auto interval = messages_read / save_checkpoint_message_interval;
+            if (!last_saved_interval.has_value() ||
+                *last_saved_interval != interval) {
+                keep = true;
+            }
+        }
+
+        if (keep) {
+            if (found_cutoff && save_checkpoint_message_interval != 0) {
+                last_saved_interval =
+                    messages_read / save_checkpoint_message_interval;
+            }
+        } else {
+            deleteMachineState(tx, checkpoint);
+            tx.checkpointDelete(checkpoint_it->key());
+            deleted_count++;
+        }
+
+        checkpoint_it->Prev();
+    }
+    if (!checkpoint_it->status().ok()) {
+        return checkpoint_it->status();
+    }
+    checkpoint_it = nullptr;
+
+    auto status = tx.commit();
+    if (!status.ok()) {
+        return status;
+    }
+    if (deleted_count == 0) {
+        return rocksdb::Status::OK();
+    }
+    std::cerr << "Deleted " << deleted_count << " checkpoints before message "
+              << delete_checkpoints_before_message << std::endl;
+
+    return data_storage->compactMachineState();
+}
+
 // getCheckpointUsingGas returns the checkpoint at or before the specified gas
 // if `after_gas` is false. If `after_gas` is true, checkpoint after specified
 // gas is returned.
@@ -700,6 +800,7 @@ void ArbCore::operator()() {
 #ifdef __linux__
     prctl(PR_SET_NAME, "ArbCore", 0, 0, 0);
 #endif
+    core_thread_running = true;
     ValueCache cache{5, 0};
     MachineExecutionConfig execConfig;
     execConfig.stop_on_sideload = true;
@@ -965,16 +1066,6 @@ void ArbCore::operator()() {
                     break;
                 }
 
-                if (delete_checkpoints_before_message != uint256_t(0)) {
-                    /*
-                    deleteOldCheckpoints(delete_checkpoints_before_message,
-                                         save_checkpoint_message_interval,
-                                         ignore_checkpoints_after_message);
-                    */
-                    ignore_checkpoints_after_message = 0;
-                    save_checkpoint_message_interval = 0;
-                    delete_checkpoints_before_message = 0;
-                }
             } else {
                 // Machine all caught up, no messages to process
                 machine_idle = true;
@@ -995,6 +1086,20 @@ void ArbCore::operator()() {
             save_checkpoint = false;
         }
 
+        if (delete_checkpoints_before_message != uint256_t(0)) {
+            auto status = deleteOldCheckpoints(
+                delete_checkpoints_before_message,
+                save_checkpoint_message_interval,
+                ignore_checkpoints_after_message);
+            if (!status.ok()) {
+                std::cerr << "Error deleting old checkpoints: "
+                          << status.ToString() << std::endl;
+            }
+            ignore_checkpoints_after_message = 0;
+            save_checkpoint_message_interval = 0;
+            delete_checkpoints_before_message = 0;
+        }
+
         if (!machineIdle() || message_data_status != MESSAGES_READY) {
             // Machine is already running or no new messages, so sleep for a
             // short while
@@ -1010,6 +1115,7 @@ void ArbCore::operator()() {
         logs_cursor.error_string = "arbcore thread aborted";
         logs_cursor.status = DataCursor::ERROR;
     }
+    core_thread_running = false;
 }
 
 rocksdb::Status ArbCore::saveLogs(ReadWriteTransaction& tx,
@@ -2678,6 +2784,58 @@ ValueResult<uint256_t> ArbCore::logsCursorPosition(size_t cursor_index) const {
     return logsCursorGetCurrentTotalCount(tx, cursor_index);
 }
 
+// Move the logs cursor back so that logs from count onwards are delivered
+// again. Only allowed while no request is outstanding.
+bool ArbCore::logsCursorRewind(size_t cursor_index, const uint256_t& count) {
+    if (cursor_index >= logs_cursors.size()) {
+        std::cerr << "Invalid logsCursor index: " << cursor_index << "\n";
+        throw std::runtime_error("Invalid logsCursor index");
+    }
+
+    const std::lock_guard<std::mutex> lock(
+        logs_cursors[cursor_index].reorg_mutex);
+
+    if (logs_cursors[cursor_index].status != DataCursor::EMPTY) {
+        std::cerr << "logsCursorRewind called at wrong state: "
+                  << logs_cursors[cursor_index].status << "\n";
+        return false;
+    }
+
+    ReadWriteTransaction tx(data_storage);
+    auto current_count_result =
+        logsCursorGetCurrentTotalCount(tx, cursor_index);
+    if (!current_count_result.status.ok()) {
+        std::cerr << "Unable to get logs cursor current total count: "
+                  << cursor_index << "\n";
+        return false;
+    }
+    if (count > current_count_result.data) {
+        std::cerr << "logsCursorRewind can't move logs cursor " << cursor_index
+                  << " forward from " << current_count_result.data << " to "
+                  << count << "\n";
+        return false;
+    }
+
+    auto status = logsCursorSaveCurrentTotalCount(tx, cursor_index, count);
+    if (!status.ok()) {
+        std::cerr << "unable to save current total count during rewind: "
+                  << status.ToString() << std::endl;
+        return false;
+    }
+    status = tx.commit();
+    if (!status.ok()) {
+        std::cerr << "unable to commit logs cursor rewind: "
+                  << status.ToString() << std::endl;
+        return false;
+    }
+
+    logs_cursors[cursor_index].pending_total_count = count;
+    logs_cursors[cursor_index].data.clear();
+    logs_cursors[cursor_index].deleted_data.clear();
+
+    return true;
+}
+
 std::string ArbCore::logsCursorClearError(size_t cursor_index) {
     if (cursor_index >= logs_cursors.size()) {
         std::cerr << "Invalid logsCursor index: " << cursor_index << "\n";
@@ -2791,6 +2949,12 @@ rocksdb::Status ArbCore::deleteSideloadsStartingAt(
     return s;
 }
 
+ValueResult<uint256_t> ArbCore::getSideloadPosition(
+    const uint256_t& block_number) {
+    ReadSnapshotTransaction tx(data_storage);
+    return getSideloadPosition(tx, block_number);
+}
+
 ValueResult<std::unique_ptr<Machine>> ArbCore::getMachineForSideload(
     const uint256_t& block_number,
     bool allow_slow_lookup) {
@@ -17,8 +17,10 @@
 #include <data_storage/arbstorage.hpp>
 
 #include <data_storage/aggregator.hpp>
+#include <data_storage/readwritetransaction.hpp>
 #include <data_storage/storageresult.hpp>
 #include <data_storage/value/code.hpp>
+#include <data_storage/value/utils.hpp>
 
 #include <avm/machine.hpp>
 
@@ -26,6 +28,19 @@
 #include <avm_values/vmValueParser.hpp>
 #include <utility>
 
+namespace {
+constexpr auto validator_state_prefix = std::array<char, 1>{-70};
+
+std::vector<unsigned char> validatorStateKey(
+    const std::vector<unsigned char>& key) {
+    std::vector<unsigned char> full_key;
+    full_key.insert(full_key.end(), validator_state_prefix.begin(),
+                    validator_state_prefix.end());
+    full_key.insert(full_key.end(), key.begin(), key.end());
+    return full_key;
+}
+}  // namespace
+
 ArbStorage::ArbStorage(const std::string& db_path,
                        const ArbCoreConfig& coreConfig)
     : datastorage(std::make_shared<DataStorage>(db_path)),
@@ -90,3 +105,38 @@ std::unique_ptr<ReadTransaction> ArbStorage::makeReadTransaction() {
 std::unique_ptr<ReadWriteTransaction> ArbStorage::makeReadWriteTransaction() {
     return std::make_unique<ReadWriteTransaction>(datastorage);
 }
+
+rocksdb::Status ArbStorage::putValidatorState(
+    const std::vector<unsigned char>& key,
+    const std::vector<unsigned char>& data) {
+    auto full_key = validatorStateKey(key);
+    ReadWriteTransaction tx(datastorage);
+    auto status = tx.defaultPut(vecToSlice(full_key), vecToSlice(data));
+    if (!status.ok()) {
+        return status;
+    }
+    return tx.commit();
+}
+
+DataResults ArbStorage::getValidatorState(
+    const std::vector<unsigned char>& key) {
+    auto full_key = validatorStateKey(key);
+    ReadTransaction tx(datastorage);
+    std::string value;
+    auto status = tx.defaultGet(vecToSlice(full_key), &value);
+    if (!status.ok()) {
+        return {status, {}};
+    }
+    return {status, std::vector<unsigned char>(value.begin(), value.end())};
+}
+
+rocksdb::Status ArbStorage::deleteValidatorState(
+    const std::vector<unsigned char>& key) {
+    auto full_key = validatorStateKey(key);
+    ReadWriteTransaction tx(datastorage);
+    auto status = tx.defaultDelete(vecToSlice(full_key));
+    if (!status.ok()) {
+        return status;
+    }
+    return tx.commit();
+}
@@ -130,6 +130,21 @@ std::unique_ptr<Transaction> Transaction::makeTransaction(
     return std::make_unique<Transaction>(std::move(store), std::move(tx));
 }
 
+// compactMachineState reclaims the space used by deleted checkpoints and
+// machine state. Automatic compactions are allowed to continue in parallel.
+rocksdb::Status DataStorage::compactMachineState() {
+    auto cr_options = rocksdb::CompactRangeOptions();
+    cr_options.exclusive_manual_compaction = false;
+    for (auto column : {STATE_COLUMN, CHECKPOINT_COLUMN, REFCOUNTED_COLUMN}) {
+        auto s = txn_db->CompactRange(cr_options, column_handles[column],
+                                      nullptr, nullptr);
+        if (!s.ok()) {
+            return s;
+        }
+    }
+    return rocksdb::Status::OK();
+}
+
 rocksdb::Status DataStorage::clearDBExceptInbox() {
     for (int i = 0; i < FAMILY_COLUMN_COUNT; i++) {
         if (i == DEFAULT_COLUMN || i == DELAYEDMESSAGE_COLUMN ||
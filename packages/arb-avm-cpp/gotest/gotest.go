@@ -17,11 +17,17 @@
 package gotest
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
+	"math/big"
 	"path/filepath"
 	"runtime"
 
 	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 )
 
 func OpCodeTestDir() (string, error) {
@@ -72,3 +78,82 @@ func ArbOSTestFiles() ([]string, error) {
 
 	return filenames, nil
 }
+
+func ArbOSPath() (string, error) {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		return "", errors.New("failed to get filename")
+	}
+	return filepath.Join(filepath.Dir(filename), "../../arb-os/arb_os/arbos.mexe"), nil
+}
+
+type jsonValue struct {
+	Int    *string           `json:"Int"`
+	Tuple  []json.RawMessage `json:"Tuple"`
+	Buffer *string           `json:"Buffer"`
+}
+
+func parseValue(data json.RawMessage) (value.Value, error) {
+	var val jsonValue
+	if err := json.Unmarshal(data, &val); err != nil {
+		return nil, err
+	}
+	switch {
+	case val.Int != nil:
+		i, ok := new(big.Int).SetString(*val.Int, 16)
+		if !ok {
+			return nil, errors.Errorf("invalid int %v", *val.Int)
+		}
+		return value.NewIntValue(i), nil
+	case val.Tuple != nil:
+		vals := make([]value.Value, 0, len(val.Tuple))
+		for _, item := range val.Tuple {
+			v, err := parseValue(item)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return value.NewTupleFromSlice(vals)
+	case val.Buffer != nil:
+		contents, err := hex.DecodeString(*val.Buffer)
+		if err != nil {
+			return nil, errors.Wrap(err, "buffer must be hex")
+		}
+		return value.NewBuffer(contents), nil
+	default:
+		return nil, errors.New("unsupported value type")
+	}
+}
+
+// ArbOSCaseInbox loads the inbox messages from the named ArbOS test case in
+// tests/arbos-cases
+func ArbOSCaseInbox(name string) ([]inbox.InboxMessage, error) {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		return nil, errors.New("failed to get filename")
+	}
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "../tests/arbos-cases", name+".aoslog"))
+	if err != nil {
+		return nil, err
+	}
+	var testCase struct {
+		Inbox []json.RawMessage `json:"inbox"`
+	}
+	if err := json.Unmarshal(data, &testCase); err != nil {
+		return nil, errors.Wrap(err, "error parsing test case")
+	}
+	messages := make([]inbox.InboxMessage, 0, len(testCase.Inbox))
+	for i, rawMessage := range testCase.Inbox {
+		val, err := parseValue(rawMessage)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing inbox message %v", i)
+		}
+		msg, err := inbox.NewInboxMessageFromValue(val)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid inbox message %v", i)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
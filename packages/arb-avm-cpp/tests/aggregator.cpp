@@ -27,6 +27,16 @@ TEST_CASE("Aggregator tests") {
     auto storage = std::make_shared<DataStorage>(dbpath);
     auto store = std::make_unique<AggregatorStore>(storage);
 
+    SECTION("oldest available block") {
+        REQUIRE(!store->oldestAvailableBlock().has_value());
+        store->updateOldestAvailableBlock(42);
+        REQUIRE(store->oldestAvailableBlock() == 42);
+
+        // Persisted across reopening the store
+        store = std::make_unique<AggregatorStore>(storage);
+        REQUIRE(store->oldestAvailableBlock() == 42);
+    }
+
     /* TODO
 
         SECTION("requests") {
@@ -19,6 +19,7 @@
 
 #include <data_storage/arbstorage.hpp>
 #include <data_storage/storageresult.hpp>
+#include <data_storage/value/machine.hpp>
 
 #include <avm/inboxmessage.hpp>
 
@@ -220,6 +221,34 @@ TEST_CASE("ArbCore tests") {
         }
         REQUIRE(logs_count == logs.size());
 
+        // Rewinding the cursor delivers the logs again
+        REQUIRE(!arbCore->logsCursorRewind(0, logs.size() + 1));
+        REQUIRE(arbCore->logsCursorRewind(0, 0));
+        auto position = arbCore->logsCursorPosition(0);
+        REQUIRE(position.status.ok());
+        REQUIRE(position.data == 0);
+        if (!logs.empty()) {
+            REQUIRE(arbCore->logsCursorRequest(0, logs.size()));
+            tries = 0;
+            while (true) {
+                auto result = arbCore->logsCursorGetLogs(0);
+                REQUIRE((result.status.ok() || result.status.IsTryAgain()));
+                if (result.status.ok()) {
+                    REQUIRE(result.data.deleted_logs.empty());
+                    REQUIRE(result.data.first_log_index == 0);
+                    REQUIRE(!result.data.logs.empty());
+                    for (uint64_t k = 0; k < result.data.logs.size(); ++k) {
+                        REQUIRE(result.data.logs[k] == logs[k]);
+                    }
+                    REQUIRE(arbCore->logsCursorConfirmReceived(0));
+                    break;
+                }
+                REQUIRE(tries < 20);
+                tries++;
+                std::this_thread::sleep_for(std::chrono::milliseconds(100));
+            }
+        }
+
         auto cursor = arbCore->getExecutionCursor(0);
         REQUIRE(cursor.status.ok());
         REQUIRE(cursor.data->getOutput().arb_gas_used == 0);
@@ -360,3 +389,82 @@ TEST_CASE("ArbCore backwards reorg") {
     REQUIRE(arbCore->getLastMachine()
                 ->machine_state.output.fully_processed_inbox.count == 0);
 }
+
+std::vector<uint256_t> checkpointMessageCounts(ArbStorage& storage) {
+    std::vector<uint256_t> counts;
+    auto tx = storage.makeReadTransaction();
+    auto it = tx->checkpointGetIterator();
+    for (it->SeekToFirst(); it->Valid(); it->Next()) {
+        std::vector<unsigned char> checkpoint_vector(
+            it->value().data(), it->value().data() + it->value().size());
+        auto checkpoint = extractMachineStateKeys(checkpoint_vector.begin());
+        counts.push_back(checkpoint.getTotalMessagesRead());
+    }
+    REQUIRE(it->status().ok());
+    return counts;
+}
+
+TEST_CASE("ArbCore prune checkpoints") {
+    DBDeleter deleter;
+
+    ArbCoreConfig coreConfig{};
+    ArbStorage storage(dbpath, coreConfig);
+    REQUIRE(
+        storage.initialize(std::string{machine_test_cases_path} + "/inbox.mexe")
+            .ok());
+    auto arbCore = storage.getArbCore();
+    REQUIRE(arbCore->startThread());
+
+    std::vector<InboxMessage> inbox_messages;
+    for (int i = 0; i < 6; i++) {
+        auto message = InboxMessage(0, {}, i, 0, i, 0, {});
+        inbox_messages.push_back(message);
+    }
+    auto items = buildBatch(inbox_messages);
+
+    // Save a checkpoint after each message
+    uint256_t inbox_acc = 0;
+    for (int i = 0; i < 6; i++) {
+        auto batch_item = items[i];
+        INFO("RUN " << i);
+        runCheckArbCore(arbCore, {batch_item}, i, inbox_acc, i + 1, 0, i + 1);
+        REQUIRE(arbCore->triggerSaveCheckpoint().ok());
+        inbox_acc = batch_item.accumulator;
+    }
+    REQUIRE(checkpointMessageCounts(storage) ==
+            std::vector<uint256_t>{0, 1, 2, 3, 4, 5, 6});
+
+    auto waitForPruning = [&]() {
+        int tries = 0;
+        while (arbCore->checkpointPruningPending()) {
+            std::this_thread::sleep_for(std::chrono::milliseconds(100));
+            tries++;
+            REQUIRE(tries < 50);
+        }
+    };
+
+    SECTION("without interval") {
+        arbCore->pruneCheckpoints(5, 0);
+        REQUIRE(arbCore->checkpointPruningPending());
+        waitForPruning();
+
+        // Initial checkpoint and the newest one before the cutoff are kept
+        REQUIRE(checkpointMessageCounts(storage) ==
+                std::vector<uint256_t>{0, 4, 5, 6});
+    }
+
+    SECTION("with interval") {
+        arbCore->pruneCheckpoints(6, 2);
+        waitForPruning();
+
+        // Last checkpoint in each interval of 2 messages is kept
+        REQUIRE(checkpointMessageCounts(storage) ==
+                std::vector<uint256_t>{0, 1, 3, 5, 6});
+    }
+
+    // Execution still works from the remaining checkpoints
+    auto cursor =
+        arbCore->getExecutionCursor(std::numeric_limits<uint256_t>::max());
+    REQUIRE(cursor.status.ok());
+    REQUIRE(cursor.data->getTotalMessagesRead() == 6);
+}
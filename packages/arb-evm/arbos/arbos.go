@@ -13,6 +13,7 @@ var ARB_INFO_ADDRESS = ethcommon.HexToAddress("0x0000000000000000000000000000000
 var ARB_ADDRESS_TABLE_ADDRESS = ethcommon.HexToAddress("0x0000000000000000000000000000000000000066")
 var ARB_BLS_ADDRESS = ethcommon.HexToAddress("0x0000000000000000000000000000000000000067")
 var ARB_FUNCTION_TABLE_ADDRESS = ethcommon.HexToAddress("0x0000000000000000000000000000000000000068")
+var ARB_TEST_ADDRESS = ethcommon.HexToAddress("0x0000000000000000000000000000000000000069")
 var ARB_OWNER_ADDRESS = ethcommon.HexToAddress("0x000000000000000000000000000000000000006B")
 var ARB_GAS_INFO_ADDRESS = ethcommon.HexToAddress("0x000000000000000000000000000000000000006C")
 var ARB_AGGREGATOR_ADDRESS = ethcommon.HexToAddress("0x000000000000000000000000000000000000006D")
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package arbos
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// ArbosTest isn't included in the generated arboscontracts bindings since it
+// is only callable by the zero address, so its ABI is embedded directly
+const arbosTestABI = `[
+	{"inputs":[{"internalType":"address","name":"addr","type":"address"},{"internalType":"bool","name":"isEOA","type":"bool"},{"internalType":"uint256","name":"balance","type":"uint256"},{"internalType":"uint256","name":"nonce","type":"uint256"},{"internalType":"bytes","name":"code","type":"bytes"},{"internalType":"bytes","name":"initStorage","type":"bytes"}],"name":"installAccount","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"address","name":"addr","type":"address"}],"name":"getMarshalledStorage","outputs":[],"stateMutability":"view","type":"function"}
+]`
+
+var (
+	installAccountABI       abi.Method
+	getMarshalledStorageABI abi.Method
+)
+
+func init() {
+	arbostest, err := abi.JSON(strings.NewReader(arbosTestABI))
+	if err != nil {
+		panic(err)
+	}
+
+	installAccountABI = arbostest.Methods["installAccount"]
+	getMarshalledStorageABI = arbostest.Methods["getMarshalledStorage"]
+}
+
+// InstallAccountData replaces the entire state of the given account,
+// including all of its storage
+func InstallAccountData(address common.Address, balance *big.Int, nonce *big.Int, code []byte, storage map[common.Hash]common.Hash) []byte {
+	return makeFuncData(installAccountABI, address, len(code) == 0, balance, nonce, code, MarshalStorage(storage))
+}
+
+func GetMarshalledStorageData(address common.Address) []byte {
+	return makeFuncData(getMarshalledStorageABI, address)
+}
+
+// MarshalStorage encodes storage as the concatenation of 32 byte key and
+// value pairs, which is the format used by installAccount and returned raw
+// by getMarshalledStorage
+func MarshalStorage(storage map[common.Hash]common.Hash) []byte {
+	data := make([]byte, 0, len(storage)*64)
+	for key, val := range storage {
+		data = append(data, key.Bytes()...)
+		data = append(data, val.Bytes()...)
+	}
+	return data
+}
+
+func UnmarshalStorage(data []byte) (map[common.Hash]common.Hash, error) {
+	if len(data)%64 != 0 {
+		return nil, errors.Errorf("marshalled storage has unexpected length %v", len(data))
+	}
+	storage := make(map[common.Hash]common.Hash, len(data)/64)
+	for i := 0; i < len(data); i += 64 {
+		var key, val common.Hash
+		copy(key[:], data[i:i+32])
+		copy(val[:], data[i+32:i+64])
+		storage[key] = val
+	}
+	return storage, nil
+}
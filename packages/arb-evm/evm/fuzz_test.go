@@ -0,0 +1,184 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package evm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/math"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// marshalFuzzValue serializes val in the format read by value.UnmarshalValue,
+// returning false for values that can't be serialized
+func marshalFuzzValue(buf *bytes.Buffer, val value.Value) bool {
+	switch val := val.(type) {
+	case value.IntValue:
+		buf.WriteByte(value.TypeCodeInt)
+		_ = val.Marshal(buf)
+	case value.HashPreImage:
+		buf.WriteByte(value.TypeCodeHashPreImage)
+		_ = val.Marshal(buf)
+	case value.CodePointStub:
+		buf.WriteByte(value.TypeCodeCodePointStub)
+		_ = val.Marshal(buf)
+	case *value.Buffer:
+		buf.WriteByte(value.TypeCodeBuffer)
+		_ = binary.Write(buf, binary.BigEndian, uint64(len(val.Data())))
+		buf.Write(val.Data())
+	case *value.TupleValue:
+		buf.WriteByte(val.TypeCode())
+		for _, item := range val.Contents() {
+			if !marshalFuzzValue(buf, item) {
+				return false
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func addValueSeeds(f *testing.F, vals ...value.Value) {
+	for _, val := range vals {
+		var buf bytes.Buffer
+		if !marshalFuzzValue(&buf, val) {
+			f.Fatalf("couldn't marshal seed %v", val)
+		}
+		f.Add(buf.Bytes())
+	}
+}
+
+// unmarshalFuzzValue decodes data as a value and checks that serializing and
+// decoding it again gives the same value
+func unmarshalFuzzValue(t *testing.T, data []byte) (value.Value, value.Value, bool) {
+	val, err := value.UnmarshalValue(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, false
+	}
+	var buf bytes.Buffer
+	if !marshalFuzzValue(&buf, val) {
+		return nil, nil, false
+	}
+	decoded, err := value.UnmarshalValue(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("couldn't decode marshalled value %v: %v", val, err)
+	}
+	if !value.Eq(val, decoded) {
+		t.Fatalf("value %v was decoded as %v", val, decoded)
+	}
+	return val, decoded, true
+}
+
+func FuzzNewResultFromValue(f *testing.F) {
+	sendResult := func(size value.IntValue) value.Value {
+		return fuzzTuple(f, value.NewInt64Value(2), value.NewInt64Value(4), value.NewInt64Value(1), size, value.NewBuffer(fuzzBytes(40, 0)))
+	}
+	addValueSeeds(
+		f,
+		fuzzTxResultValue(f),
+		fuzzBlockResultValue(f, fuzzGasSummaryValue(f)),
+		fuzzBlockResultValue(f, value.NewInt64Value(0)),
+		sendResult(value.NewInt64Value(50)),
+		sendResult(value.NewIntValue(math.MaxBig256)),
+		fuzzMerkleRootResultValue(f),
+	)
+	// Buffer claiming to be much larger than the data
+	f.Add([]byte{value.TypeCodeBuffer, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		val, decoded, ok := unmarshalFuzzValue(t, data)
+		if !ok {
+			return
+		}
+		res, err := NewResultFromValue(val)
+		if err != nil {
+			return
+		}
+		res2, err := NewResultFromValue(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, res2) {
+			t.Fatalf("result %v was decoded as %v", res, res2)
+		}
+		checkResultReencodes(t, res)
+		if txRes, ok := res.(*TxResult); ok {
+			_ = txRes.String()
+			_ = txRes.ToEthReceipt(common.Hash{})
+		}
+	})
+}
+
+func FuzzNewMerkleRootLogResultFromValue(f *testing.F) {
+	addValueSeeds(f, fuzzMerkleRootResultValue(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		val, decoded, ok := unmarshalFuzzValue(t, data)
+		if !ok {
+			return
+		}
+		tup, ok := val.(*value.TupleValue)
+		if !ok {
+			return
+		}
+		res, err := NewMerkleRootLogResultFromValue(tup)
+		if err != nil {
+			return
+		}
+		res2, err := NewMerkleRootLogResultFromValue(decoded.(*value.TupleValue))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, res2) {
+			t.Fatal("result decoded differently")
+		}
+
+		// Every entry has a proof leading back to the root
+		root := res.Tree.Hash()
+		entries := res.Tree.Entries()
+		for i, entry := range entries {
+			proof, err := res.GenerateProof(res.Tree.Lowest() + uint64(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(proof.Data, entry) {
+				t.Fatalf("proof for entry %v has wrong data", i)
+			}
+			hash := (&MerkleLeaf{Data: proof.Data}).Hash()
+			for j, node := range proof.Nodes {
+				if proof.Path[len(proof.Path)-1-j] {
+					hash = hashing.SoliditySHA3(hashing.Bytes32(hash), hashing.Bytes32(node))
+				} else {
+					hash = hashing.SoliditySHA3(hashing.Bytes32(node), hashing.Bytes32(hash))
+				}
+			}
+			if hash != root {
+				t.Fatalf("proof for entry %v doesn't lead to root", i)
+			}
+		}
+	})
+}
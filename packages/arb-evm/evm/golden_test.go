@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package evm
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/math"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with the current results")
+
+const resultsGoldenFile = "results.golden.json"
+
+// replaceAt returns val with the value at the given tuple path replaced by
+// the result of f
+func replaceAt(t testing.TB, val value.Value, path []int, f func(value.Value) value.Value) value.Value {
+	if len(path) == 0 {
+		return f(val)
+	}
+	tup := val.(*value.TupleValue)
+	contents := append([]value.Value{}, tup.Contents()...)
+	contents[path[0]] = replaceAt(t, contents[path[0]], path[1:], f)
+	return fuzzTuple(t, contents...)
+}
+
+func setAt(t testing.TB, val value.Value, path []int, newVal value.Value) value.Value {
+	return replaceAt(t, val, path, func(value.Value) value.Value { return newVal })
+}
+
+func appendAt(t testing.TB, val value.Value, path []int, extra value.Value) value.Value {
+	return replaceAt(t, val, path, func(val value.Value) value.Value {
+		return fuzzTuple(t, append(val.(*value.TupleValue).Contents(), extra)...)
+	})
+}
+
+// Positions of the parts of a tx result
+var (
+	txRequestPath        = []int{1}
+	txRequestRemPath     = []int{1, 7}
+	txProvenancePath     = []int{1, 7, 0}
+	txAggregatorPath     = []int{1, 7, 1}
+	txGasEstimationPath  = []int{1, 7, 3}
+	txResultCodePath     = []int{2, 0}
+	txLogsPath           = []int{2, 2}
+	txFeeStatsPath       = []int{5}
+	blockGasSummaryPath  = []int{5}
+	merkleTreePath       = []int{3}
+	sendResultSizePath   = []int{3}
+	sendResultBufferPath = []int{4}
+)
+
+type goldenCase struct {
+	name string
+	val  value.Value
+}
+
+func goldenResultValues(t testing.TB) []goldenCase {
+	tx := fuzzTxResultValue(t)
+	block := fuzzBlockResultValue(t, fuzzGasSummaryValue(t))
+	merkle := fuzzMerkleRootResultValue(t)
+	send := fuzzTuple(t, value.NewInt64Value(2), value.NewInt64Value(4), value.NewInt64Value(1), value.NewInt64Value(50), value.NewBuffer(fuzzBytes(40, 0)))
+	maxInt := value.NewIntValue(math.MaxBig256)
+	overflowInt := value.NewIntValue(new(big.Int).Lsh(big.NewInt(1), 64))
+	aggregator := inbox.NewIntFromAddress(fuzzAddress(0x20))
+	gasEstimation := newOptional(fuzzTuple(t, value.NewInt64Value(100), value.NewInt64Value(1), value.NewInt64Value(0)))
+
+	cases := []goldenCase{
+		{"tx", tx},
+		{"tx/len7", appendAt(t, tx, nil, value.NewInt64Value(0))},
+		{"tx/kindOverflow", setAt(t, tx, []int{0}, overflowInt)},
+		{"tx/feeStats5", appendAt(t, tx, txFeeStatsPath, value.NewInt64Value(1))},
+		{"tx/feeStatsZeroAggregator", setAt(t, tx, []int{5, 3}, value.NewInt64Value(0))},
+		{"tx/gasEstimation2", setAt(t, tx, txGasEstimationPath, newOptional(fuzzTuple(t, value.NewInt64Value(100), value.NewInt64Value(1))))},
+		{"tx/gasEstimation3", setAt(t, tx, txGasEstimationPath, gasEstimation)},
+		{"tx/noGasEstimation", replaceAt(t, tx, txRequestRemPath, func(val value.Value) value.Value {
+			return fuzzTuple(t, val.(*value.TupleValue).Contents()[:3]...)
+		})},
+		{"tx/aggregatorInt", setAt(t, tx, txAggregatorPath, newOptional(value.NewTuple2(aggregator, value.NewInt64Value(7))))},
+		{"tx/aggregatorEmpty", setAt(t, tx, txAggregatorPath, newOptional(value.NewTuple2(newEmptyOptional(), value.NewInt64Value(7))))},
+		{"tx/aggregatorZero", setAt(t, tx, txAggregatorPath, newOptional(value.NewTuple2(value.NewInt64Value(0), value.NewInt64Value(7))))},
+		{"tx/aggregatorOptionOverflow", setAt(t, tx, txAggregatorPath, newOptional(value.NewTuple2(value.NewTuple2(overflowInt, aggregator), value.NewInt64Value(7))))},
+		{"tx/noAggregator", setAt(t, tx, txAggregatorPath, newEmptyOptional())},
+		{"tx/rootProvenance", setAt(t, tx, append(txProvenancePath, 2), maxInt)},
+		{"tx/adminMode", setAt(t, tx, []int{1, 7, 2}, value.NewInt64Value(1))},
+		{"tx/requestKindOverflow", setAt(t, tx, append(txRequestPath, 0), value.NewInt64Value(0x1_0000_0103))},
+		{"tx/resultCodeOverflow", setAt(t, tx, txResultCodePath, overflowInt)},
+		{"tx/resultCodeMax", setAt(t, tx, txResultCodePath, maxInt)},
+		{"tx/noLogs", setAt(t, tx, txLogsPath, value.NewEmptyTuple())},
+		{"tx/logNoTopics", setAt(t, tx, txLogsPath, inbox.ListToStackValue([]value.Value{value.NewTuple2(aggregator, fuzzByteArray(t, nil))}))},
+		{"tx/logMaxTopics", setAt(t, tx, txLogsPath, inbox.ListToStackValue([]value.Value{fuzzTuple(t,
+			aggregator, fuzzByteArray(t, nil), maxInt, value.NewInt64Value(1), value.NewInt64Value(2), value.NewInt64Value(3), value.NewInt64Value(4), value.NewInt64Value(5),
+		)}))},
+		{"tx/requestDataPadded", setAt(t, tx, append(txRequestPath, 6), value.NewTuple2(value.NewInt64Value(10), value.NewBuffer([]byte{1, 2})))},
+		{"block", block},
+		{"block/oldGasSummary", setAt(t, block, blockGasSummaryPath, fuzzTuple(t, append([]value.Value{value.NewInt64Value(8)}, fuzzGasSummaryValue(t).(*value.TupleValue).Contents()...)...))},
+		{"block/negativeGasPool", setAt(t, block, append(blockGasSummaryPath, 5), value.NewIntValue(new(big.Int).Sub(math.MaxBig256, big.NewInt(4))))},
+		{"block/intGasSummary", setAt(t, block, blockGasSummaryPath, value.NewInt64Value(0))},
+		{"send", send},
+		{"send/maxSize", setAt(t, send, sendResultSizePath, maxInt)},
+		{"send/empty", setAt(t, setAt(t, send, sendResultSizePath, value.NewInt64Value(0)), sendResultBufferPath, value.NewBuffer(nil))},
+		{"send/kindOverflow", setAt(t, send, []int{0}, value.NewIntValue(new(big.Int).Add(overflowInt.BigInt(), big.NewInt(2))))},
+		{"merkle", merkle},
+		{"merkle/leaf", setAt(t, merkle, merkleTreePath, fuzzTuple(t, value.NewInt64Value(2), value.NewBuffer([]byte{1, 2}), value.NewEmptyTuple()))},
+		{"merkle/kindOverflow", setAt(t, merkle, []int{0}, value.NewIntValue(new(big.Int).Add(overflowInt.BigInt(), big.NewInt(3))))},
+		{"empty", value.NewEmptyTuple()},
+		{"int", value.NewInt64Value(0)},
+		{"unknownKind", fuzzTuple(t, value.NewInt64Value(4))},
+	}
+
+	// Break each part of the main results in turn
+	mutated := map[string]bool{
+		"tx":                  true,
+		"tx/gasEstimation3":   true,
+		"block":               true,
+		"block/oldGasSummary": true,
+		"send":                true,
+		"merkle":              true,
+	}
+	for _, base := range cases {
+		if mutated[base.name] {
+			cases = append(cases, mutateValue(t, base.name, base.val, base.val, nil)...)
+		}
+	}
+	return cases
+}
+
+// mutateValue returns a copy of root for each way of replacing or resizing
+// the value val found at path
+func mutateValue(t testing.TB, name string, root value.Value, val value.Value, path []int) []goldenCase {
+	var cases []goldenCase
+	replacements := []struct {
+		name string
+		val  value.Value
+	}{
+		{"int", value.NewInt64Value(2)},
+		{"tuple", value.NewEmptyTuple()},
+		{"buffer", value.NewBuffer([]byte{1})},
+	}
+	for _, replacement := range replacements {
+		if value.Eq(val, replacement.val) {
+			continue
+		}
+		cases = append(cases, goldenCase{
+			name: fmt.Sprintf("%v/%v/%v", name, path, replacement.name),
+			val:  setAt(t, root, path, replacement.val),
+		})
+	}
+	tup, ok := val.(*value.TupleValue)
+	if !ok {
+		return cases
+	}
+	contents := tup.Contents()
+	if len(contents) > 0 {
+		cases = append(cases, goldenCase{
+			name: fmt.Sprintf("%v/%v/short", name, path),
+			val:  setAt(t, root, path, fuzzTuple(t, contents[:len(contents)-1]...)),
+		})
+	}
+	if len(contents) < value.MaxTupleSize {
+		cases = append(cases, goldenCase{
+			name: fmt.Sprintf("%v/%v/long", name, path),
+			val:  appendAt(t, root, path, value.NewInt64Value(0)),
+		})
+	}
+	for i, item := range contents {
+		cases = append(cases, mutateValue(t, name, root, item, append(append([]int{}, path...), i))...)
+	}
+	return cases
+}
+
+func merkleTreeIndexes(node MerkleNode) string {
+	switch node := node.(type) {
+	case *MerkleInteriorNode:
+		return fmt.Sprintf("(%v %v)", merkleTreeIndexes(node.Left), merkleTreeIndexes(node.Right))
+	default:
+		return fmt.Sprintf("%v-%v", node.Lowest(), node.Highest())
+	}
+}
+
+func describeResult(t *testing.T, res Result, err error) string {
+	if err != nil {
+		return "error"
+	}
+	data, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := fmt.Sprintf("%T %s", res, data)
+	if merkle, ok := res.(*MerkleRootResult); ok {
+		desc += " indexes " + merkleTreeIndexes(merkle.Tree)
+	}
+	return desc
+}
+
+// checkResultReencodes checks that encoding res gives a value which is parsed
+// as the same result
+func checkResultReencodes(t *testing.T, res Result) {
+	t.Helper()
+	encoded, err := avmcodec.Marshal(res)
+	if err != nil {
+		t.Fatalf("couldn't encode %v: %v", res, err)
+	}
+	decoded, err := NewResultFromValue(encoded)
+	if err != nil {
+		t.Fatalf("couldn't decode encoded %v: %v", res, err)
+	}
+	if !reflect.DeepEqual(res, decoded) {
+		t.Fatalf("result %v was reencoded as %v", res, decoded)
+	}
+}
+
+// TestResultGolden checks that results are parsed exactly as they were when
+// the golden file was written, including which malformed values are rejected
+func TestResultGolden(t *testing.T) {
+	results := make(map[string]string)
+	for _, c := range goldenResultValues(t) {
+		if _, ok := results[c.name]; ok {
+			t.Fatalf("duplicate case %v", c.name)
+		}
+		res, err := NewResultFromValue(c.val)
+		results[c.name] = describeResult(t, res, err)
+		if err == nil {
+			checkResultReencodes(t, res)
+		}
+	}
+
+	path := filepath.Join("testdata", resultsGoldenFile)
+	if *updateGolden {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string]string
+	if err := json.Unmarshal(data, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != len(results) {
+		t.Errorf("expected %v cases but got %v", len(expected), len(results))
+	}
+	for name, desc := range results {
+		if expected[name] != desc {
+			t.Errorf("case %v\nexpected: %v\ngot:      %v", name, expected[name], desc)
+		}
+	}
+}
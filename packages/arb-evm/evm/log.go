@@ -20,10 +20,9 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
-	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
-	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"strings"
 )
@@ -31,9 +30,9 @@ import (
 var logger = log.With().Caller().Stack().Str("component", "evm").Logger()
 
 type Log struct {
-	Address common.Address
-	Topics  []common.Hash
-	Data    []byte
+	Address common.Address `avm:"0"`
+	Topics  []common.Hash  `avm:"2,rest"`
+	Data    []byte         `avm:"1"`
 }
 
 func CompareLogs(log1 Log, log2 Log) []string {
@@ -136,52 +135,17 @@ func (l Log) String() string {
 }
 
 func NewLogFromValue(val value.Value) (Log, error) {
-	tupVal, ok := val.(*value.TupleValue)
-	if !ok {
-		return Log{}, errors.New("log must be a tuple")
-	}
-	if tupVal.Len() < 2 {
-		return Log{}, errors.Errorf("log tuple must be at least size 2, but is %v", tupVal)
-	}
-
-	// Tuple size already verified above, so error can be ignored
-	contractIDVal, _ := tupVal.GetByInt64(0)
-	contractIDInt, ok := contractIDVal.(value.IntValue)
-	if !ok {
-		return Log{}, errors.New("log contract id must be an int")
-	}
-	contractIDBytes := contractIDInt.ToBytes()
-	var address common.Address
-	copy(address[:], contractIDBytes[12:])
-	logDataByteVal, _ := tupVal.GetByInt64(1)
-	logData, err := inbox.ByteArrayToBytes(logDataByteVal)
-	if err != nil {
+	var l Log
+	if err := avmcodec.Unmarshal(val, &l); err != nil {
 		return Log{}, err
 	}
-	topics := make([]common.Hash, 0, tupVal.Len()-2)
-	for _, topicVal := range tupVal.Contents()[2:] {
-		topicValInt, ok := topicVal.(value.IntValue)
-		if !ok {
-			return Log{}, errors.New("log topic must be an int")
-		}
-		topics = append(topics, topicValInt.ToBytes())
-	}
-
-	return Log{address, topics, logData}, nil
+	return l, nil
 }
 
 func LogStackToLogs(val value.Value) ([]Log, error) {
-	logValues, err := inbox.StackValueToList(val)
-	if err != nil {
-		return nil, errors.Wrap(err, "log stack was not a stack")
-	}
-	logs := make([]Log, 0, len(logValues))
-	for _, logVal := range logValues {
-		evmLog, err := NewLogFromValue(logVal)
-		if err != nil {
-			return nil, err
-		}
-		logs = append(logs, evmLog)
+	var logs []Log
+	if err := avmcodec.Unmarshal(val, &logs); err != nil {
+		return nil, err
 	}
 	return logs, nil
 }
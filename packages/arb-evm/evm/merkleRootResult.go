@@ -19,9 +19,9 @@ package evm
 import (
 	"fmt"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
-	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 	"github.com/pkg/errors"
 	"math/big"
@@ -112,41 +112,52 @@ type MerkleRootResult struct {
 	Tree        MerkleNode
 }
 
-func NewMerkleRootLogResultFromValue(tup *value.TupleValue) (*MerkleRootResult, error) {
-	if tup.Len() != 4 {
-		return nil, errors.New("expected merkle root info tuple of length 4")
-	}
+type merkleRootResultValue struct {
+	_ struct{} `avm:"0,const=3"`
 
-	resultKindVal, _ := tup.GetByInt64(0)
-	batchNumberVal, _ := tup.GetByInt64(1)
-	numInBatchVal, _ := tup.GetByInt64(2)
-	treeVal, _ := tup.GetByInt64(3)
+	BatchNumber *big.Int    `avm:"1"`
+	NumInBatch  *big.Int    `avm:"2"`
+	Tree        value.Value `avm:"3"`
+}
 
-	resultKindInt, ok := resultKindVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("resultKind must be an int")
-	}
-	if resultKindInt.BigInt().Uint64() != 3 {
-		return nil, errors.New("incorrect result kind for merkle root log result")
-	}
+type merkleLeafValue struct {
+	Data []byte   `avm:"0,sized"`
+	_    struct{} `avm:"2"`
+}
 
-	batchNumber, ok := batchNumberVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("batchNumber must be an int")
+func (m *MerkleRootResult) UnmarshalAVM(val value.Value) error {
+	var raw merkleRootResultValue
+	if err := avmcodec.Unmarshal(val, &raw); err != nil {
+		return err
 	}
-	numInBatch, ok := numInBatchVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("numInBatch must be an int")
+	tree, err := newMerkleTreeFromValue(raw.Tree, 0)
+	if err != nil {
+		return err
 	}
-	tree, err := newMerkleTreeFromValue(treeVal, 0)
+	m.BatchNumber = raw.BatchNumber
+	m.NumInBatch = raw.NumInBatch
+	m.Tree = tree
+	return nil
+}
+
+func (m *MerkleRootResult) MarshalAVM() (value.Value, error) {
+	tree, err := merkleTreeAsValue(m.Tree)
 	if err != nil {
 		return nil, err
 	}
-	return &MerkleRootResult{
-		BatchNumber: batchNumber.BigInt(),
-		NumInBatch:  numInBatch.BigInt(),
+	return avmcodec.Marshal(&merkleRootResultValue{
+		BatchNumber: m.BatchNumber,
+		NumInBatch:  m.NumInBatch,
 		Tree:        tree,
-	}, nil
+	})
+}
+
+func NewMerkleRootLogResultFromValue(tup *value.TupleValue) (*MerkleRootResult, error) {
+	res := &MerkleRootResult{}
+	if err := avmcodec.Unmarshal(tup, res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func newMerkleTreeFromValue(val value.Value, minIndex uint64) (MerkleNode, error) {
@@ -167,22 +178,12 @@ func newMerkleTreeFromValue(val value.Value, minIndex uint64) (MerkleNode, error
 		}
 		return NewMerkleInteriorNode(node1, node2), nil
 	} else if treeTup.Len() == 3 {
-		dataSizeVal, _ := treeTup.GetByInt64(0)
-		dataContentsVal, _ := treeTup.GetByInt64(1)
-		dataSizeInt, ok := dataSizeVal.(value.IntValue)
-		if !ok {
-			return nil, errors.New("dataSize must be an int")
-		}
-		dataContentsBuf, ok := dataContentsVal.(*value.Buffer)
-		if !ok {
-			return nil, errors.New("dataContents must be a buffer")
-		}
-		data, err := inbox.BufAndLengthToBytes(dataSizeInt.BigInt(), dataContentsBuf)
-		if err != nil {
-			return nil, err
+		var leaf merkleLeafValue
+		if err := avmcodec.Unmarshal(treeTup, &leaf); err != nil {
+			return nil, errors.Wrapf(err, "merkle leaf %v", minIndex)
 		}
 		return &MerkleLeaf{
-			Data:  data,
+			Data:  leaf.Data,
 			index: minIndex,
 		}, nil
 	} else {
@@ -190,6 +191,25 @@ func newMerkleTreeFromValue(val value.Value, minIndex uint64) (MerkleNode, error
 	}
 }
 
+func merkleTreeAsValue(node MerkleNode) (value.Value, error) {
+	switch node := node.(type) {
+	case *MerkleInteriorNode:
+		left, err := merkleTreeAsValue(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := merkleTreeAsValue(node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewTuple2(left, right), nil
+	case *MerkleLeaf:
+		return avmcodec.Marshal(&merkleLeafValue{Data: node.Data})
+	default:
+		return nil, errors.Errorf("unknown merkle node %T", node)
+	}
+}
+
 type MerkleRootProof struct {
 	Nodes []common.Hash
 	Path  []bool
@@ -26,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/pkg/errors"
 
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
@@ -79,52 +80,42 @@ type AggregatorInfo struct {
 	CalldataBytes *big.Int
 }
 
-func NewAggregatorInfoFromOptionalValue(val value.Value) (*AggregatorInfo, error) {
-	nestedVal, err := NewValueFromOptional(val)
-	if err != nil {
-		return nil, err
-	}
-	if nestedVal == nil {
-		return nil, nil
-	}
-	nestedTup, ok := nestedVal.(*value.TupleValue)
-	if !ok || nestedTup.Len() != 2 {
-		return nil, errors.Errorf("expected tuple of length 2, but recieved %v", nestedVal)
-	}
-
-	aggregatorVal, _ := nestedTup.GetByInt64(0)
-	calldataBytes, _ := nestedTup.GetByInt64(1)
+type aggregatorInfoValue struct {
+	Aggregator    *common.Address `avm:"0,nilzero"`
+	CalldataBytes *big.Int        `avm:"1"`
+}
 
-	var aggAddress *common.Address
+type optionalAggregatorInfoValue struct {
+	Aggregator    *common.Address `avm:"0,optional,nilzero"`
+	CalldataBytes *big.Int        `avm:"1"`
+}
 
+func (a *AggregatorInfo) UnmarshalAVM(val value.Value) error {
 	// ArbOS version upgrade from https://github.com/OffchainLabs/arb-os/pull/429
-	// Support aggregator field either as an address or and optional address
-	if _, ok := aggregatorVal.(value.IntValue); !ok {
-		aggregatorVal, err = NewValueFromOptional(aggregatorVal)
-		if err != nil {
-			return nil, err
+	// Support aggregator field either as an address or an optional address
+	if tup, ok := val.(*value.TupleValue); ok && tup.Len() == 2 {
+		aggregatorVal, _ := tup.GetByInt64(0)
+		if _, ok := aggregatorVal.(value.IntValue); !ok {
+			return avmcodec.Unmarshal(val, (*optionalAggregatorInfoValue)(a))
 		}
 	}
+	return avmcodec.Unmarshal(val, (*aggregatorInfoValue)(a))
+}
 
-	if aggregatorVal != nil {
-		aggregatorInt, ok := aggregatorVal.(value.IntValue)
-		if !ok {
-			return nil, errors.New("aggregator must be an int")
-		}
-		rawAggregatorAddress := inbox.NewAddressFromInt(aggregatorInt)
-		blankAddress := common.Address{}
-		if rawAggregatorAddress != blankAddress {
-			aggAddress = &rawAggregatorAddress
-		}
+func (a *AggregatorInfo) MarshalAVM() (value.Value, error) {
+	return avmcodec.Marshal((*optionalAggregatorInfoValue)(a))
+}
+
+func NewAggregatorInfoFromOptionalValue(val value.Value) (*AggregatorInfo, error) {
+	nestedVal, err := NewValueFromOptional(val)
+	if err != nil || nestedVal == nil {
+		return nil, err
 	}
-	calldataBytesInt, ok := calldataBytes.(value.IntValue)
-	if !ok {
-		return nil, errors.New("calldataBytes must be an int")
+	info := &AggregatorInfo{}
+	if err := avmcodec.Unmarshal(nestedVal, info); err != nil {
+		return nil, err
 	}
-	return &AggregatorInfo{
-		Aggregator:    aggAddress,
-		CalldataBytes: calldataBytesInt.BigInt(),
-	}, nil
+	return info, nil
 }
 
 func newEmptyOptional() value.Value {
@@ -160,9 +151,31 @@ func (a *AggregatorInfo) AsOptionalValue() value.Value {
 }
 
 type Provenance struct {
-	L1SeqNum        *big.Int
-	ParentRequestId common.Hash
-	IndexInParent   *big.Int
+	L1SeqNum        *big.Int    `avm:"0"`
+	ParentRequestId common.Hash `avm:"1"`
+	IndexInParent   *big.Int    `avm:"2"`
+}
+
+type provenanceValue Provenance
+
+// A request that wasn't created by another request has an IndexInParent of
+// MaxBig256, which is decoded as nil
+func (p *Provenance) UnmarshalAVM(val value.Value) error {
+	if err := avmcodec.Unmarshal(val, (*provenanceValue)(p)); err != nil {
+		return err
+	}
+	if p.IndexInParent.Cmp(math.MaxBig256) == 0 {
+		p.IndexInParent = nil
+	}
+	return nil
+}
+
+func (p *Provenance) MarshalAVM() (value.Value, error) {
+	raw := provenanceValue(*p)
+	if raw.IndexInParent == nil {
+		raw.IndexInParent = math.MaxBig256
+	}
+	return avmcodec.Marshal(&raw)
 }
 
 func CompareProvenances(prov1 Provenance, prov2 Provenance) []string {
@@ -180,114 +193,52 @@ func CompareProvenances(prov1 Provenance, prov2 Provenance) []string {
 }
 
 func NewProvenanceFromValue(val value.Value) (Provenance, error) {
-	failRet := Provenance{}
-	tup, ok := val.(*value.TupleValue)
-	if !ok {
-		return failRet, errors.New("provenance must be a tuple")
-	}
-	if tup.Len() != 3 {
-		return failRet, errors.Errorf("expected tuple of length 3, but recieved tuple of length %v", tup.Len())
-	}
-
-	// Tuple size already verified above, so error can be ignored
-	l1SeqNumVal, _ := tup.GetByInt64(0)
-	parentRequestIdVal, _ := tup.GetByInt64(1)
-	indexInParentVal, _ := tup.GetByInt64(2)
-
-	l1SeqNumInt, ok := l1SeqNumVal.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("provenance l1SeqNum must be an int")
-	}
-
-	parentRequestIdInt, ok := parentRequestIdVal.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("provenance parentRequestId must be an int")
+	var provenance Provenance
+	if err := avmcodec.Unmarshal(val, &provenance); err != nil {
+		return Provenance{}, err
 	}
-
-	indexInParentInt, ok := indexInParentVal.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("provenance indexInParent must be an int")
-	}
-
-	indexInParent := indexInParentInt.BigInt()
-	if indexInParent.Cmp(math.MaxBig256) == 0 {
-		indexInParent = nil
-	}
-
-	var parentRequestId common.Hash
-	copy(parentRequestId[:], math.U256Bytes(parentRequestIdInt.BigInt()))
-
-	return Provenance{
-		L1SeqNum:        l1SeqNumInt.BigInt(),
-		ParentRequestId: parentRequestId,
-		IndexInParent:   indexInParent,
-	}, nil
+	return provenance, nil
 }
 
 type GasEstimationParams struct {
-	ComputeGasLimit *big.Int
-	IgnoreGasPrice  bool
-	IgnoreMaxGas    bool
+	ComputeGasLimit *big.Int `avm:"0"`
+	IgnoreGasPrice  bool     `avm:"1"`
+	IgnoreMaxGas    bool     `avm:"2,trailing"`
 }
 
-func NewGasEstimationParamsFromValue(val value.Value) (*GasEstimationParams, error) {
-	tup, ok := val.(*value.TupleValue)
-	if !ok {
-		return nil, errors.New("gas estimation params must be a tuple")
+type gasEstimationParamsValue GasEstimationParams
+
+func (p *GasEstimationParams) UnmarshalAVM(val value.Value) error {
+	if err := avmcodec.Unmarshal(val, (*gasEstimationParamsValue)(p)); err != nil {
+		return err
 	}
-	if tup.Len() != 2 && tup.Len() != 3 {
-		return nil, errors.Errorf("expected tuple of length 2 or 3, but recieved tuple of length %v", tup.Len())
+	// Older ArbOS versions have a single flag to ignore both
+	if val.(*value.TupleValue).Len() == 2 {
+		p.IgnoreMaxGas = p.IgnoreGasPrice
 	}
-	computeGasLimitVal, _ := tup.GetByInt64(0)
-	computeGasLimitInt, ok := computeGasLimitVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("gas estimation params computeGasLimit must be an int")
-	}
-
-	if tup.Len() == 2 {
-		ignoreInsufficientGasFundsVal, _ := tup.GetByInt64(1)
-		ignoreInsufficientGasFunds, err := NewBoolFromValue(ignoreInsufficientGasFundsVal)
-		if err != nil {
-			return nil, err
-		}
-		return &GasEstimationParams{
-			ComputeGasLimit: computeGasLimitInt.BigInt(),
-			IgnoreGasPrice:  ignoreInsufficientGasFunds,
-			IgnoreMaxGas:    ignoreInsufficientGasFunds,
-		}, nil
-	} else {
-		// tup.Len() == 3
-		ignoreGasPriceVal, _ := tup.GetByInt64(1)
-		ignoreMaxGasVal, _ := tup.GetByInt64(2)
+	return nil
+}
 
-		ignoreGasPrice, err := NewBoolFromValue(ignoreGasPriceVal)
-		if err != nil {
-			return nil, err
-		}
-		ignoreMaxGas, err := NewBoolFromValue(ignoreMaxGasVal)
-		if err != nil {
-			return nil, err
-		}
-		return &GasEstimationParams{
-			ComputeGasLimit: computeGasLimitInt.BigInt(),
-			IgnoreGasPrice:  ignoreGasPrice,
-			IgnoreMaxGas:    ignoreMaxGas,
-		}, nil
+func NewGasEstimationParamsFromValue(val value.Value) (*GasEstimationParams, error) {
+	params := &GasEstimationParams{}
+	if err := avmcodec.Unmarshal(val, params); err != nil {
+		return nil, err
 	}
+	return params, nil
 }
 
 type IncomingRequest struct {
-	Kind           inbox.Type
-	Sender         common.Address
-	MessageID      common.Hash
-	Data           []byte
-	L1BlockNumber  *big.Int
-	L2BlockNumber  *big.Int
-	L2Timestamp    *big.Int
-	Provenance     Provenance
-	AggregatorInfo *AggregatorInfo
-	AdminMode      bool
-	GasEstimation  *GasEstimationParams
+	Kind           inbox.Type           `avm:"0"`
+	Sender         common.Address       `avm:"4"`
+	MessageID      common.Hash          `avm:"5"`
+	Data           []byte               `avm:"6"`
+	L1BlockNumber  *big.Int             `avm:"2"`
+	L2BlockNumber  *big.Int             `avm:"1"`
+	L2Timestamp    *big.Int             `avm:"3"`
+	Provenance     Provenance           `avm:"7.0"`
+	AggregatorInfo *AggregatorInfo      `avm:"7.1,optional"`
+	AdminMode      bool                 `avm:"7.2"`
+	GasEstimation  *GasEstimationParams `avm:"7.3,trailing,optional"`
 }
 
 func (r IncomingRequest) String() string {
@@ -333,116 +284,11 @@ func CompareIncomingRequests(req1 IncomingRequest, req2 IncomingRequest) []strin
 }
 
 func NewIncomingRequestFromValue(val value.Value) (IncomingRequest, error) {
-	failRet := IncomingRequest{}
-	tup, ok := val.(*value.TupleValue)
-	if !ok {
-		return failRet, errors.New("incoming request must be a tuple")
-	}
-	if tup.Len() != 8 {
-		return failRet, errors.Errorf("expected incoming request to be tuple of length 8, but recieved tuple of length %v", tup.Len())
+	var request IncomingRequest
+	if err := avmcodec.Unmarshal(val, &request); err != nil {
+		return IncomingRequest{}, err
 	}
-
-	// Tuple size already verified above, so error can be ignored
-	kind, _ := tup.GetByInt64(0)
-	l2BlockNumber, _ := tup.GetByInt64(1)
-	l1BlockNumber, _ := tup.GetByInt64(2)
-	l2Timestamp, _ := tup.GetByInt64(3)
-	sender, _ := tup.GetByInt64(4)
-	inboxSeqNum, _ := tup.GetByInt64(5)
-	messageData, _ := tup.GetByInt64(6)
-	remVal, _ := tup.GetByInt64(7)
-
-	remTup, ok := remVal.(*value.TupleValue)
-	if !ok {
-		return failRet, errors.New("remaining incoming request values must be a tuple")
-	}
-	if remTup.Len() < 3 || remTup.Len() > 4 {
-		return failRet, errors.Errorf("expected incoming request remaining values to be tuple of at least length 3 and at most 4, but received tuple of length %v", remTup.Len())
-	}
-	provenanceVal, _ := remTup.GetByInt64(0)
-	aggregatorInfoVal, _ := remTup.GetByInt64(1)
-	adminModeVal, _ := remTup.GetByInt64(2)
-
-	var gasEstimationParams *GasEstimationParams
-	if remTup.Len() == 4 {
-		gasEstimationParamsRaw, _ := remTup.GetByInt64(3)
-		gasEstimationParamsVal, err := NewValueFromOptional(gasEstimationParamsRaw)
-		if err != nil {
-			return failRet, err
-		}
-		if gasEstimationParamsVal != nil {
-			gasEstimationParams, err = NewGasEstimationParamsFromValue(gasEstimationParamsVal)
-			if err != nil {
-				return failRet, err
-			}
-		}
-	}
-
-	kindInt, ok := kind.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("inbox message kind must be an int")
-	}
-
-	l1BlockNumberInt, ok := l1BlockNumber.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("l1BlockNumber must be an int")
-	}
-
-	l2BlockNumberInt, ok := l2BlockNumber.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("l2BlockNumber must be an int")
-	}
-
-	l2TimestampInt, ok := l2Timestamp.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("l2Timestamp must be an int")
-	}
-
-	senderInt, ok := sender.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("sender must be an int")
-	}
-
-	messageIDInt, ok := inboxSeqNum.(value.IntValue)
-	if !ok {
-		return failRet, errors.New("inboxSeqNum must be an int")
-	}
-	var messageID common.Hash
-	copy(messageID[:], math.U256Bytes(messageIDInt.BigInt()))
-
-	data, err := inbox.ByteArrayToBytes(messageData)
-	if err != nil {
-		return failRet, errors.Wrap(err, "unmarshalling input data")
-	}
-
-	provenance, err := NewProvenanceFromValue(provenanceVal)
-	if err != nil {
-		return failRet, err
-	}
-
-	aggregatorInfo, err := NewAggregatorInfoFromOptionalValue(aggregatorInfoVal)
-	if err != nil {
-		return failRet, err
-	}
-
-	adminMode, err := NewBoolFromValue(adminModeVal)
-	if err != nil {
-		return failRet, err
-	}
-
-	return IncomingRequest{
-		Kind:           inbox.Type(kindInt.BigInt().Uint64()),
-		Sender:         inbox.NewAddressFromInt(senderInt),
-		MessageID:      messageID,
-		Data:           data,
-		L1BlockNumber:  l1BlockNumberInt.BigInt(),
-		L2BlockNumber:  l2BlockNumberInt.BigInt(),
-		L2Timestamp:    l2TimestampInt.BigInt(),
-		Provenance:     provenance,
-		AggregatorInfo: aggregatorInfo,
-		AdminMode:      adminMode,
-		GasEstimation:  gasEstimationParams,
-	}, nil
+	return request, nil
 }
 
 func NewRandomIncomingRequest() IncomingRequest {
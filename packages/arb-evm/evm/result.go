@@ -29,8 +29,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
-	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 )
 
@@ -99,16 +99,20 @@ type Result interface {
 }
 
 type TxResult struct {
-	IncomingRequest IncomingRequest
-	ResultCode      ResultType
-	ReturnData      []byte
-	EVMLogs         []Log
-	GasUsed         *big.Int
-	GasPrice        *big.Int
-	CumulativeGas   *big.Int
-	TxIndex         *big.Int
-	StartLogIndex   *big.Int
-	FeeStats        *FeeStats
+	_ struct{} `avm:"0,const=0"`
+	// Some ArbOS versions add a final field which isn't used
+	_ struct{} `avm:"6,trailing"`
+
+	IncomingRequest IncomingRequest `avm:"1"`
+	ResultCode      ResultType      `avm:"2.0"`
+	ReturnData      []byte          `avm:"2.1"`
+	EVMLogs         []Log           `avm:"2.2"`
+	GasUsed         *big.Int        `avm:"3.0"`
+	GasPrice        *big.Int        `avm:"3.1"`
+	CumulativeGas   *big.Int        `avm:"4.0"`
+	TxIndex         *big.Int        `avm:"4.1"`
+	StartLogIndex   *big.Int        `avm:"4.2"`
+	FeeStats        *FeeStats       `avm:"5"`
 }
 
 type revertError struct {
@@ -312,10 +316,10 @@ func (r *TxResult) ToEthReceipt(blockHash common.Hash) *types.Receipt {
 }
 
 type FeeSet struct {
-	L1Transaction *big.Int
-	L1Calldata    *big.Int
-	L2Storage     *big.Int
-	L2Computation *big.Int
+	L1Transaction *big.Int `avm:"0"`
+	L1Calldata    *big.Int `avm:"1"`
+	L2Storage     *big.Int `avm:"2"`
+	L2Computation *big.Int `avm:"3"`
 }
 
 func (fs *FeeSet) Total() *big.Int {
@@ -326,46 +330,19 @@ func (fs *FeeSet) Total() *big.Int {
 }
 
 func NewFeeSetFromValue(val value.Value) (*FeeSet, error) {
-	tup, ok := val.(*value.TupleValue)
-	if !ok || tup.Len() != 4 {
-		return nil, errors.Errorf("expected fee set tuple of length 4, but recieved %v", val)
-	}
-	l1Transaction, _ := tup.GetByInt64(0)
-	l1Calldata, _ := tup.GetByInt64(1)
-	l2Storage, _ := tup.GetByInt64(2)
-	l2Computation, _ := tup.GetByInt64(3)
-
-	l1TransactionInt, ok := l1Transaction.(value.IntValue)
-	if !ok {
-		return nil, errors.New("l1Transaction must be an int")
-	}
-	l1CalldataInt, ok := l1Calldata.(value.IntValue)
-	if !ok {
-		return nil, errors.New("l1Calldata must be an int")
-	}
-	l2StorageInt, ok := l2Storage.(value.IntValue)
-	if !ok {
-		return nil, errors.New("l2Storage must be an int")
-	}
-	l2ComputationInt, ok := l2Computation.(value.IntValue)
-	if !ok {
-		return nil, errors.New("l2Computation must be an int")
+	fs := &FeeSet{}
+	if err := avmcodec.Unmarshal(val, fs); err != nil {
+		return nil, err
 	}
-
-	return &FeeSet{
-		L1Transaction: l1TransactionInt.BigInt(),
-		L1Calldata:    l1CalldataInt.BigInt(),
-		L2Storage:     l2StorageInt.BigInt(),
-		L2Computation: l2ComputationInt.BigInt(),
-	}, nil
+	return fs, nil
 }
 
 type FeeStats struct {
-	Price                  *FeeSet
-	UnitsUsed              *FeeSet
-	Paid                   *FeeSet
-	Aggregator             *common.Address
-	NoFeeGasEstimationMode bool
+	Price                  *FeeSet         `avm:"0"`
+	UnitsUsed              *FeeSet         `avm:"1"`
+	Paid                   *FeeSet         `avm:"2"`
+	Aggregator             *common.Address `avm:"3,nilzero"`
+	NoFeeGasEstimationMode bool            `avm:"4,trailing"`
 }
 
 func (fs *FeeStats) String() string {
@@ -390,138 +367,11 @@ func (fs *FeeStats) TargetGasUsed() *big.Int {
 }
 
 func NewFeeStatsFromValue(val value.Value) (*FeeStats, error) {
-	tup, ok := val.(*value.TupleValue)
-	if !ok || tup.Len() < 4 || tup.Len() > 5 {
-		return nil, errors.Errorf("expected gas fee tuple of length 4 or 5, but recieved %v", val)
-	}
-	pricesVal, _ := tup.GetByInt64(0)
-	unitsVal, _ := tup.GetByInt64(1)
-	paidVal, _ := tup.GetByInt64(2)
-	aggregator, _ := tup.GetByInt64(3)
-	noFeeGasEstimationMode := false
-	if tup.Len() == 5 {
-		noFeeGasEstimationModeVal, _ := tup.GetByInt64(4)
-		var err error
-		noFeeGasEstimationMode, err = NewBoolFromValue(noFeeGasEstimationModeVal)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	prices, err := NewFeeSetFromValue(pricesVal)
-	if err != nil {
+	fs := &FeeStats{}
+	if err := avmcodec.Unmarshal(val, fs); err != nil {
 		return nil, err
 	}
-	units, err := NewFeeSetFromValue(unitsVal)
-	if err != nil {
-		return nil, err
-	}
-	paid, err := NewFeeSetFromValue(paidVal)
-	if err != nil {
-		return nil, err
-	}
-	aggregatorInt, ok := aggregator.(value.IntValue)
-	if !ok {
-		return nil, errors.New("aggregator must be an int")
-	}
-	rawAggregatorAddress := inbox.NewAddressFromInt(aggregatorInt)
-	blankAddress := common.Address{}
-	var aggAddress *common.Address
-	if rawAggregatorAddress != blankAddress {
-		aggAddress = &rawAggregatorAddress
-	}
-	return &FeeStats{
-		Price:                  prices,
-		UnitsUsed:              units,
-		Paid:                   paid,
-		Aggregator:             aggAddress,
-		NoFeeGasEstimationMode: noFeeGasEstimationMode,
-	}, nil
-}
-
-func parseTxResult(l1MsgVal value.Value, resultInfo value.Value, gasInfo value.Value, chainInfo value.Value, feeStatsVal value.Value) (*TxResult, error) {
-	resultTup, ok := resultInfo.(*value.TupleValue)
-	if !ok || resultTup.Len() != 3 {
-		return nil, errors.Errorf("expected result info tuple of length 3, but recieved %v", resultTup)
-	}
-
-	// Tuple size already verified above, so error can be ignored
-	resultCode, _ := resultTup.GetByInt64(0)
-	returnData, _ := resultTup.GetByInt64(1)
-	evmLogs, _ := resultTup.GetByInt64(2)
-
-	gasInfoTup, ok := gasInfo.(*value.TupleValue)
-	if !ok || gasInfoTup.Len() != 2 {
-		return nil, errors.Errorf("advise expected gas info tuple of length 2, but recieved %v", gasInfoTup)
-	}
-
-	// Tuple size already verified above, so error can be ignored
-	gasUsed, _ := gasInfoTup.GetByInt64(0)
-	gasPrice, _ := gasInfoTup.GetByInt64(1)
-
-	chainInfoTup, ok := chainInfo.(*value.TupleValue)
-	if !ok || chainInfoTup.Len() != 3 {
-		return nil, errors.Errorf("advise expected tx block data tuple of length 3, but recieved %v", resultTup)
-	}
-
-	// Tuple size already verified above, so error can be ignored
-	cumulativeGas, _ := chainInfoTup.GetByInt64(0)
-	txIndex, _ := chainInfoTup.GetByInt64(1)
-	startLogIndex, _ := chainInfoTup.GetByInt64(2)
-
-	l1Msg, err := NewIncomingRequestFromValue(l1MsgVal)
-	if err != nil {
-		return nil, err
-	}
-	returnBytes, err := inbox.ByteArrayToBytes(returnData)
-	if err != nil {
-		return nil, errors.Wrap(err, "umarshalling return data")
-	}
-	logs, err := LogStackToLogs(evmLogs)
-	if err != nil {
-		return nil, errors.Wrap(err, "unmarshaling logs")
-	}
-	resultCodeInt, ok := resultCode.(value.IntValue)
-	if !ok {
-		return nil, errors.New("resultCode must be an int")
-	}
-	gasUsedInt, ok := gasUsed.(value.IntValue)
-	if !ok {
-		return nil, errors.New("gasUsed must be an int")
-	}
-	gasPriceInt, ok := gasPrice.(value.IntValue)
-	if !ok {
-		return nil, errors.New("gasPrice must be an int")
-	}
-	cumulativeGasInt, ok := cumulativeGas.(value.IntValue)
-	if !ok {
-		return nil, errors.New("cumulativeGas must be an int")
-	}
-	txIndexInt, ok := txIndex.(value.IntValue)
-	if !ok {
-		return nil, errors.New("txIndex must be an int")
-	}
-	startLogIndexInt, ok := startLogIndex.(value.IntValue)
-	if !ok {
-		return nil, errors.New("startLogIndex must be an int")
-	}
-
-	feeStats, err := NewFeeStatsFromValue(feeStatsVal)
-	if err != nil {
-		return nil, err
-	}
-	return &TxResult{
-		IncomingRequest: l1Msg,
-		ResultCode:      ResultType(resultCodeInt.BigInt().Uint64()),
-		ReturnData:      returnBytes,
-		EVMLogs:         logs,
-		GasUsed:         gasUsedInt.BigInt(),
-		GasPrice:        gasPriceInt.BigInt(),
-		CumulativeGas:   cumulativeGasInt.BigInt(),
-		TxIndex:         txIndexInt.BigInt(),
-		StartLogIndex:   startLogIndexInt.BigInt(),
-		FeeStats:        feeStats,
-	}, nil
+	return fs, nil
 }
 
 func NewResultFromValue(val value.Value) (Result, error) {
@@ -537,40 +387,23 @@ func NewResultFromValue(val value.Value) (Result, error) {
 		return nil, errors.New(" result kind must be an int")
 	}
 
-	if kindInt.BigInt().Uint64() == 0 {
-		if tup.Len() != 6 && tup.Len() != 7 {
-			return nil, errors.Errorf("tx result expected tuple of length 6 or 7, but recieved len %v: %v", tup.Len(), tup)
-		}
-
-		// Tuple size already verified above, so error can be ignored
-		l1MsgVal, _ := tup.GetByInt64(1)
-		resultInfo, _ := tup.GetByInt64(2)
-		gasInfo, _ := tup.GetByInt64(3)
-		chainInfo, _ := tup.GetByInt64(4)
-		feeStats, _ := tup.GetByInt64(5)
-		return parseTxResult(l1MsgVal, resultInfo, gasInfo, chainInfo, feeStats)
-	} else if kindInt.BigInt().Uint64() == 1 {
-		if tup.Len() != 8 {
-			return nil, errors.Errorf("block result expected tuple of length 8, but received len %v: %v", tup.Len(), tup)
-		}
-
-		// Tuple size already verified above, so error can be ignored
-		blockNum, _ := tup.GetByInt64(1)
-		timestamp, _ := tup.GetByInt64(2)
-		blockStatsRaw, _ := tup.GetByInt64(3)
-		chainStatsRaw, _ := tup.GetByInt64(4)
-		gasStats, _ := tup.GetByInt64(5)
-		previousHeight, _ := tup.GetByInt64(6)
-		l1BlockNum, _ := tup.GetByInt64(7)
-
-		return parseBlockResult(blockNum, timestamp, blockStatsRaw, chainStatsRaw, gasStats, previousHeight, l1BlockNum)
-	} else if kindInt.BigInt().Uint64() == 2 {
-		return NewSendResultFromValue(tup)
-	} else if kindInt.BigInt().Uint64() == 3 {
-		return NewMerkleRootLogResultFromValue(tup)
-	} else {
+	var res Result
+	switch kindInt.BigInt().Uint64() {
+	case 0:
+		res = &TxResult{}
+	case 1:
+		res = &BlockInfo{}
+	case 2:
+		res = &SendResult{}
+	case 3:
+		res = &MerkleRootResult{}
+	default:
 		return nil, errors.New("unknown result kind")
 	}
+	if err := avmcodec.Unmarshal(val, res); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func NewTxResultFromValue(val value.Value) (*TxResult, error) {
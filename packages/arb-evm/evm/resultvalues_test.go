@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package evm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+func fuzzTuple(t testing.TB, vals ...value.Value) *value.TupleValue {
+	tup, err := value.NewTupleFromSlice(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tup
+}
+
+func fuzzByteArray(t testing.TB, data []byte) value.Value {
+	return fuzzTuple(t, value.NewInt64Value(int64(len(data))), value.NewBuffer(data))
+}
+
+func fuzzFeeSet(t testing.TB, base int64) value.Value {
+	return fuzzTuple(t, value.NewInt64Value(base), value.NewInt64Value(base+1), value.NewInt64Value(base+2), value.NewInt64Value(base+3))
+}
+
+// fuzzBytes returns deterministic data so that values built from it can be
+// used as golden test inputs
+func fuzzBytes(length int, seed byte) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = seed + byte(i)
+	}
+	return data
+}
+
+func fuzzAddress(seed byte) common.Address {
+	var address common.Address
+	copy(address[:], fuzzBytes(len(address), seed))
+	return address
+}
+
+func fuzzRequestValue(t testing.TB, rem value.Value) value.Value {
+	return fuzzTuple(t,
+		value.NewInt64Value(3),
+		value.NewInt64Value(10),
+		value.NewInt64Value(9),
+		value.NewInt64Value(1000),
+		inbox.NewIntFromAddress(fuzzAddress(0x10)),
+		value.NewIntValue(new(big.Int).SetBytes(fuzzBytes(32, 0x80))),
+		fuzzByteArray(t, fuzzBytes(100, 0)),
+		rem,
+	)
+}
+
+func fuzzTxResultValue(t testing.TB) value.Value {
+	aggregator := fuzzAddress(0x30)
+	request := fuzzRequestValue(t, fuzzTuple(t,
+		fuzzTuple(t, value.NewInt64Value(5), value.NewInt64Value(0), value.NewInt64Value(0)),
+		newOptional(value.NewTuple2(newOptional(inbox.NewIntFromAddress(aggregator)), value.NewInt64Value(120))),
+		value.NewInt64Value(0),
+		newEmptyOptional(),
+	))
+	evmLog := fuzzTuple(t,
+		inbox.NewIntFromAddress(fuzzAddress(0x50)),
+		fuzzByteArray(t, fuzzBytes(40, 0x60)),
+		value.NewIntValue(new(big.Int).SetBytes(fuzzBytes(32, 0x70))),
+	)
+	resultInfo := fuzzTuple(t,
+		value.NewInt64Value(int64(ReturnCode)),
+		fuzzByteArray(t, fuzzBytes(32, 0x90)),
+		inbox.ListToStackValue([]value.Value{evmLog, evmLog}),
+	)
+	gasInfo := fuzzTuple(t, value.NewInt64Value(21000), value.NewInt64Value(1))
+	chainInfo := fuzzTuple(t, value.NewInt64Value(50000), value.NewInt64Value(2), value.NewInt64Value(7))
+	feeStats := fuzzTuple(t, fuzzFeeSet(t, 1), fuzzFeeSet(t, 10), fuzzFeeSet(t, 100), inbox.NewIntFromAddress(aggregator))
+	return fuzzTuple(t, value.NewInt64Value(0), request, resultInfo, gasInfo, chainInfo, feeStats)
+}
+
+func fuzzGasSummaryValue(t testing.TB) value.Value {
+	return fuzzTuple(t,
+		value.NewInt64Value(1),
+		value.NewInt64Value(2),
+		value.NewInt64Value(3),
+		value.NewInt64Value(4),
+		value.NewInt64Value(5),
+		value.NewInt64Value(6),
+	)
+}
+
+func fuzzBlockResultValue(t testing.TB, gasSummary value.Value) value.Value {
+	stats := func(base int64) value.Value {
+		return fuzzTuple(t, value.NewInt64Value(base), value.NewInt64Value(base+1), value.NewInt64Value(base+2), value.NewInt64Value(base+3), value.NewInt64Value(base+4))
+	}
+	return fuzzTuple(t,
+		value.NewInt64Value(1),
+		value.NewInt64Value(10),
+		value.NewInt64Value(1000),
+		stats(10),
+		stats(100),
+		gasSummary,
+		value.NewInt64Value(9),
+		value.NewInt64Value(50),
+	)
+}
+
+func fuzzMerkleRootResultValue(t testing.TB) value.Value {
+	leaf := func(data []byte) value.Value {
+		return fuzzTuple(t, value.NewInt64Value(int64(len(data))), value.NewBuffer(data), value.NewInt64Value(0))
+	}
+	tree := fuzzTuple(t,
+		fuzzTuple(t, leaf(fuzzBytes(10, 0)), leaf(fuzzBytes(20, 0x40))),
+		leaf(fuzzBytes(30, 0x80)),
+	)
+	return fuzzTuple(t, value.NewInt64Value(3), value.NewInt64Value(4), value.NewInt64Value(3), tree)
+}
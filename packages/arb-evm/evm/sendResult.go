@@ -17,63 +17,27 @@
 package evm
 
 import (
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
-	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 	"github.com/pkg/errors"
 	"math/big"
 )
 
 type SendResult struct {
-	BatchNumber *big.Int
-	BatchIndex  *big.Int
-	Data        []byte
+	_ struct{} `avm:"0,const=2"`
+
+	BatchNumber *big.Int `avm:"1"`
+	BatchIndex  *big.Int `avm:"2"`
+	Data        []byte   `avm:"3,sized"`
 }
 
 func NewSendResultFromValue(tup *value.TupleValue) (*SendResult, error) {
-	if tup.Len() != 5 {
-		return nil, errors.Errorf("send result expected tuple of length 5, but recieved len %v", tup.Len())
-	}
-
-	resultKindVal, _ := tup.GetByInt64(0)
-	batchNumberVal, _ := tup.GetByInt64(1)
-	batchIndexVal, _ := tup.GetByInt64(2)
-	dataSizeVal, _ := tup.GetByInt64(3)
-	dataContentsVal, _ := tup.GetByInt64(4)
-
-	resultKindInt, ok := resultKindVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("resultKind must be an int")
-	}
-	if resultKindInt.BigInt().Uint64() != 2 {
-		return nil, errors.New("incorrect result kind for send")
-	}
-	batchNumberInt, ok := batchNumberVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("batchNumber must be an int")
-	}
-	batchIndexInt, ok := batchIndexVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("batchIndex must be an int")
-	}
-	dataSizeInt, ok := dataSizeVal.(value.IntValue)
-	if !ok {
-		return nil, errors.New("dataSize must be an int")
-	}
-	dataContentsBuf, ok := dataContentsVal.(*value.Buffer)
-	if !ok {
-		return nil, errors.New("dataContents must be a buffer")
-	}
-
-	data, err := inbox.BufAndLengthToBytes(dataSizeInt.BigInt(), dataContentsBuf)
-	if err != nil {
+	res := &SendResult{}
+	if err := avmcodec.Unmarshal(tup, res); err != nil {
 		return nil, err
 	}
-	return &SendResult{
-		BatchNumber: batchNumberInt.BigInt(),
-		BatchIndex:  batchIndexInt.BigInt(),
-		Data:        data,
-	}, nil
+	return res, nil
 }
 
 type SendResultMessage interface {
@@ -76,7 +76,9 @@ func encodeAmount(amount *big.Int) ([]byte, error) {
 	mod := big.NewInt(10)
 	zero := big.NewInt(0)
 	exp := byte(0)
-	for amount.Cmp(zero) > 0 && new(big.Int).Mod(amount, mod).Cmp(zero) == 0 {
+	amount = new(big.Int).Set(amount)
+	// The exponent must fit in a byte
+	for amount.Cmp(zero) > 0 && exp < 255 && new(big.Int).Mod(amount, mod).Cmp(zero) == 0 {
 		amount = amount.Div(amount, mod)
 		exp++
 	}
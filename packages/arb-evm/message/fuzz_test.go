@@ -0,0 +1,223 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package message
+
+import (
+	"bytes"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// l2MessageSeeds returns an encoded message of each l2 type
+func l2MessageSeeds(t testing.TB) [][]byte {
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainId := big.NewInt(42161)
+	signedTx, err := types.SignTx(
+		types.NewTransaction(rand.Uint64(), common.RandAddress().ToEthAddress(), common.RandBigInt(), rand.Uint64(), common.RandBigInt(), common.RandBytes(100)),
+		types.NewEIP155Signer(chainId),
+		pk,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := NewRandomTransactionBatch(3, pk, 0, chainId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []AbstractL2Message{
+		NewRandomTransaction(),
+		NewRandomContractTransaction(),
+		NewRandomCall(),
+		batch,
+		SignedTransaction{Tx: signedTx},
+		testCompressedECDSATx(t),
+		NewCompressedECDSAFromEth(signedTx),
+	}
+
+	seeds := make([][]byte, 0, len(messages))
+	for _, msg := range messages {
+		l2, err := NewL2Message(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds = append(seeds, l2.AsData())
+	}
+	return seeds
+}
+
+// reencodeL2Message decodes data as an l2 message, along with any messages
+// batched inside of it, and encodes it again
+func reencodeL2Message(t *testing.T, data []byte) ([]byte, bool) {
+	msg, err := L2Message{Data: data}.AbstractMessage()
+	if err != nil {
+		return nil, false
+	}
+	if batch, ok := msg.(TransactionBatch); ok {
+		for _, tx := range batch.Transactions {
+			reencodeL2Message(t, tx)
+		}
+	}
+	l2, err := NewL2Message(msg)
+	if err != nil {
+		t.Fatalf("couldn't encode decoded message %v: %v", msg, err)
+	}
+	return l2.AsData(), true
+}
+
+func FuzzL2MessageAbstractMessage(f *testing.F) {
+	for _, seed := range l2MessageSeeds(f) {
+		f.Add(seed)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{byte(TransactionType)})
+	f.Add([]byte{byte(CompressedECDSA), 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		encoded, ok := reencodeL2Message(t, data)
+		if !ok {
+			return
+		}
+		reencoded, ok := reencodeL2Message(t, encoded)
+		if !ok {
+			t.Fatalf("couldn't decode encoded message %x", encoded)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("message encoded as %x but was reencoded as %x", encoded, reencoded)
+		}
+	})
+}
+
+func FuzzDecodeCompressedTx(f *testing.F) {
+	pk, err := crypto.GenerateKey()
+	if err != nil {
+		f.Fatal(err)
+	}
+	signedTx, err := NewRandomSignedTx(pk, 0, big.NewInt(42161))
+	if err != nil {
+		f.Fatal(err)
+	}
+	indexedTx := testCompressedECDSATx(f).CompressedTx
+	indexedTx.To = CompressedAddressIndex{big.NewInt(1000)}
+	for _, tx := range []CompressedTx{
+		testCompressedECDSATx(f).CompressedTx,
+		NewCompressedECDSAFromEth(signedTx.Tx).CompressedTx,
+		indexedTx,
+	} {
+		seed, err := encodeUnsignedTx(tx)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(seed)
+	}
+	// Contract creation paying 10 * 10^255, which has more trailing zeros
+	// than the exponent byte can hold
+	f.Add([]byte{0x80, 0x80, 0x80, 0x80, 0x0a, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := decodeCompressedTx(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		payment := new(big.Int).Set(tx.Payment)
+		encoded, err := encodeUnsignedTx(tx)
+		if err != nil {
+			t.Fatalf("couldn't encode decoded tx %v: %v", tx, err)
+		}
+		if tx.Payment.Cmp(payment) != 0 {
+			t.Fatalf("encoding changed payment from %v to %v", payment, tx.Payment)
+		}
+		decoded, err := decodeCompressedTx(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("couldn't decode encoded tx %x: %v", encoded, err)
+		}
+		if decoded.SequenceNum.Cmp(tx.SequenceNum) != 0 ||
+			decoded.GasPrice.Cmp(tx.GasPrice) != 0 ||
+			decoded.GasLimit.Cmp(tx.GasLimit) != 0 ||
+			decoded.Payment.Cmp(tx.Payment) != 0 ||
+			!bytes.Equal(decoded.Calldata, tx.Calldata) {
+			t.Fatalf("tx %v was decoded as %v", tx, decoded)
+		}
+		reencoded, err := encodeUnsignedTx(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, reencoded) {
+			t.Fatalf("tx encoded as %x but was reencoded as %x", encoded, reencoded)
+		}
+	})
+}
+
+func FuzzTransactionBatch(f *testing.F) {
+	seeds := l2MessageSeeds(f)
+	for _, seed := range seeds {
+		f.Add(TransactionBatch{Transactions: [][]byte{seed}}.AsDataSafe())
+	}
+	f.Add(TransactionBatch{Transactions: seeds}.AsDataSafe())
+	f.Add(TransactionBatch{Transactions: [][]byte{{}, {}}}.AsDataSafe())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		batch := newTransactionBatchFromData(data)
+		encoded := batch.AsDataSafe()
+		decoded := newTransactionBatchFromData(encoded)
+		if len(decoded.Transactions) != len(batch.Transactions) {
+			t.Fatalf("batch of %v txes was decoded with %v", len(batch.Transactions), len(decoded.Transactions))
+		}
+		for i, tx := range batch.Transactions {
+			if !bytes.Equal(tx, decoded.Transactions[i]) {
+				t.Fatalf("tx %v was %x but decoded as %x", i, tx, decoded.Transactions[i])
+			}
+		}
+		if !bytes.Equal(encoded, decoded.AsDataSafe()) {
+			t.Fatal("batch reencoded differently")
+		}
+
+		// Rebuilding the batch from its valid messages keeps their encoding
+		var messages []AbstractL2Message
+		var txes [][]byte
+		for _, tx := range batch.Transactions {
+			msg, err := L2Message{Data: tx}.AbstractMessage()
+			if err != nil {
+				continue
+			}
+			l2, err := NewL2Message(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, msg)
+			txes = append(txes, l2.AsData())
+		}
+		rebuilt, err := NewTransactionBatchFromMessages(messages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(rebuilt.AsDataSafe(), TransactionBatch{Transactions: txes}.AsDataSafe()) {
+			t.Fatal("rebuilt batch encoded differently")
+		}
+	})
+}
@@ -104,16 +104,34 @@ func NewSafeL2Message(msg SafeAbstractL2Message) L2Message {
 	return L2Message{Data: data}
 }
 
+// Sizes of the fixed length headers of transaction types
+const (
+	transactionHeaderSize = 32 * 5
+	basicTxHeaderSize     = 32 * 4
+)
+
 func (l L2Message) AbstractMessage() (AbstractL2Message, error) {
 	data := l.Data
+	if len(data) == 0 {
+		return nil, errors.New("l2 message is empty")
+	}
 	l2Type := L2SubType(data[0])
 	data = data[1:]
 	switch l2Type {
 	case TransactionType:
+		if len(data) < transactionHeaderSize {
+			return nil, errors.New("not enough data for transaction")
+		}
 		return newTransactionFromData(data), nil
 	case ContractTransactionType:
+		if len(data) < basicTxHeaderSize {
+			return nil, errors.New("not enough data for contract transaction")
+		}
 		return NewContractTransactionFromData(data), nil
 	case CallType:
+		if len(data) < basicTxHeaderSize {
+			return nil, errors.New("not enough data for call")
+		}
 		return NewCallFromData(data), nil
 	case TransactionBatchType:
 		return newTransactionBatchFromData(data), nil
@@ -77,7 +77,7 @@ func TestL2MessageSerialization(t *testing.T) {
 	}
 }
 
-func TestCompressedECDSAEncoding(t *testing.T) {
+func testCompressedECDSATx(t testing.TB) CompressedECDSATransaction {
 	calldata := []byte{119, 22, 2, 247, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
 	gasLimit, correct := new(big.Int).SetString("e8d4a51000", 16)
 	if !correct {
@@ -97,13 +97,16 @@ func TestCompressedECDSAEncoding(t *testing.T) {
 	s, _ := new(big.Int).SetString("11879572248721183921017568834333234971060281339844537723742821302023917743080", 10)
 	v := byte(0)
 
-	tx := CompressedECDSATransaction{
+	return CompressedECDSATransaction{
 		CompressedTx: compressedTx,
 		V:            v,
 		R:            r,
 		S:            s,
 	}
+}
 
+func TestCompressedECDSAEncoding(t *testing.T) {
+	tx := testCompressedECDSATx(t)
 	encoded, err := tx.AsData()
 	if err != nil {
 		t.Fatal(err)
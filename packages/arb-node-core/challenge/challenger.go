@@ -3,6 +3,7 @@ package challenge
 import (
 	"context"
 	"math/big"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -10,6 +11,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
 )
 
 var logger = log.With().Caller().Stack().Str("component", "challenge").Logger()
@@ -20,6 +22,10 @@ type Challenger struct {
 	lookup              core.ArbCoreLookup
 	challengedAssertion *core.Assertion
 	stakerAddress       common.Address
+
+	// store is nil if challenge progress is only kept in memory
+	store machine.ValidatorStateStore
+	state *ChallengeState
 }
 
 func (c *Challenger) ChallengeAddress() common.Address {
@@ -27,12 +33,64 @@ func (c *Challenger) ChallengeAddress() common.Address {
 }
 
 func NewChallenger(challenge *ethbridge.Challenge, sequencerInbox *ethbridge.SequencerInboxWatcher, lookup core.ArbCoreLookup, challengedAssertion *core.Assertion, stakerAddress common.Address) *Challenger {
+	return NewPersistentChallenger(challenge, sequencerInbox, lookup, challengedAssertion, stakerAddress, nil)
+}
+
+// NewPersistentChallenger creates a challenger which saves its progress to
+// store before every move so that it can be resumed with LoadChallenger
+func NewPersistentChallenger(challenge *ethbridge.Challenge, sequencerInbox *ethbridge.SequencerInboxWatcher, lookup core.ArbCoreLookup, challengedAssertion *core.Assertion, stakerAddress common.Address, store machine.ValidatorStateStore) *Challenger {
 	return &Challenger{
 		challenge:           challenge,
 		sequencerInbox:      sequencerInbox,
 		lookup:              lookup,
 		challengedAssertion: challengedAssertion,
 		stakerAddress:       stakerAddress,
+		store:               store,
+		state: &ChallengeState{
+			ChallengeAddress:    challenge.Address(),
+			ChallengedAssertion: challengedAssertion,
+		},
+	}
+}
+
+// LoadChallenger resumes the saved challenge of stakerAddress if it was for
+// the given challenge contract. It returns nil if there's nothing to resume.
+func LoadChallenger(challenge *ethbridge.Challenge, sequencerInbox *ethbridge.SequencerInboxWatcher, lookup core.ArbCoreLookup, stakerAddress common.Address, store machine.ValidatorStateStore) (*Challenger, error) {
+	state, err := loadChallengeState(store, stakerAddress)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, nil
+	}
+	if state.ChallengeAddress != challenge.Address() || state.ChallengedAssertion == nil {
+		// Left over from a challenge that ended while we weren't running
+		return nil, ForgetChallenge(store, stakerAddress)
+	}
+	resumedCounter.Inc(1)
+	logger.Info().
+		Str("challenge", state.ChallengeAddress.Hex()).
+		Int("bisections", len(state.Bisections)).
+		Int("cuts", len(state.Cuts)).
+		Msg("Resuming challenge from saved state")
+	return &Challenger{
+		challenge:           challenge,
+		sequencerInbox:      sequencerInbox,
+		lookup:              lookup,
+		challengedAssertion: state.ChallengedAssertion,
+		stakerAddress:       stakerAddress,
+		store:               store,
+		state:               state,
+	}, nil
+}
+
+func (c *Challenger) save() {
+	if c.store == nil {
+		return
+	}
+	if err := saveChallengeState(c.store, c.stakerAddress, c.state); err != nil {
+		stateSaveErrorCounter.Inc(1)
+		logger.Warn().Err(err).Str("challenge", c.challenge.Address().Hex()).Msg("failed to save challenge progress")
 	}
 }
 
@@ -66,19 +124,41 @@ func (c *Challenger) HandleConflict(ctx context.Context) (Move, error) {
 		return nil, nil
 	}
 
-	prevBisection, err := c.challenge.LookupBisection(ctx, challengeState)
-	if err != nil {
-		return nil, err
+	if c.state.TurnState != challengeState {
+		c.state.TurnState = challengeState
+		c.state.TurnStarted = time.Now()
+	}
+
+	prevBisection := c.state.lookupBisection(challengeState)
+	if prevBisection == nil {
+		prevBisection, err = c.challenge.LookupBisection(ctx, challengeState)
+		if err != nil {
+			return nil, err
+		}
+		if prevBisection != nil {
+			c.state.Bisections = append(c.state.Bisections, &KnownBisection{
+				ChallengeState: challengeState,
+				Bisection:      prevBisection,
+			})
+		}
 	}
 
 	if prevBisection == nil {
 		prevBisection = c.challengedAssertion.InitialExecutionBisection()
 	}
-	move, err := handleChallenge(ctx, c.challengedAssertion, c.lookup, c.sequencerInbox, prevBisection)
+	cuts := c.state.cutMap()
+	move, err := handleChallenge(ctx, c.challengedAssertion, c.lookup, c.sequencerInbox, prevBisection, cuts)
 	if err != nil {
 		return nil, err
 	}
-	return move, move.execute(ctx, c.challenge)
+	c.state.setCuts(cuts, prevBisection.ChallengedSegment)
+	c.save()
+	if err := move.execute(ctx, c.challenge); err != nil {
+		return move, err
+	}
+	movesCounter.Inc(1)
+	moveResponseTimer.UpdateSince(c.state.TurnStarted)
+	return move, nil
 }
 
 func handleChallenge(
@@ -87,10 +167,11 @@ func handleChallenge(
 	lookup core.ArbCoreLookup,
 	sequencerInbox *ethbridge.SequencerInboxWatcher,
 	prevBisection *core.Bisection,
+	cuts map[string]*CachedCut,
 ) (Move, error) {
 	logger.Debug().Str("start", prevBisection.ChallengedSegment.Start.String()).Str("end", prevBisection.ChallengedSegment.GetEnd().String()).Msg("Examining opponent's bisection")
 	prevCutOffsets := generateBisectionCutOffsets(prevBisection.ChallengedSegment, len(prevBisection.Cuts)-1)
-	divergence, err := FindFirstDivergence(lookup, assertion, prevCutOffsets, prevBisection.Cuts)
+	divergence, err := findFirstDivergence(newCutCache(lookup, assertion, prevCutOffsets, cuts), prevCutOffsets, prevBisection.Cuts)
 	if err != nil {
 		return nil, err
 	}
@@ -112,7 +193,7 @@ func handleChallenge(
 			segmentCount = int(inconsistentSegment.Length.Int64())
 		}
 		subCutOffsets := generateBisectionCutOffsets(inconsistentSegment, segmentCount)
-		startState, subCuts, err := GetCuts(lookup, assertion, subCutOffsets)
+		startState, subCuts, err := getCuts(newCutCache(lookup, assertion, subCutOffsets, cuts), subCutOffsets)
 		if err != nil {
 			return nil, err
 		}
@@ -19,6 +19,7 @@ func distortHash(hash common.Hash) common.Hash {
 
 type FaultConfig struct {
 	DistortMachineAtGas *big.Int
+	DistortSendAccAtGas *big.Int
 	MessagesReadCap     *big.Int
 	PhantomMessageAtGas *big.Int
 	StallMachineAt      *big.Int
@@ -46,6 +47,14 @@ func (e FaultyExecutionCursor) MachineHash() common.Hash {
 	return hash
 }
 
+func (e FaultyExecutionCursor) SendAcc() common.Hash {
+	acc := e.ExecutionCursor.SendAcc()
+	if e.config.DistortSendAccAtGas != nil && e.ExecutionCursor.TotalGasConsumed().Cmp(e.config.DistortSendAccAtGas) >= 0 {
+		acc = distortHash(acc)
+	}
+	return acc
+}
+
 func (e FaultyExecutionCursor) TotalMessagesRead() *big.Int {
 	messages := e.ExecutionCursor.TotalMessagesRead()
 	if e.config.PhantomMessageAtGas != nil && e.ExecutionCursor.TotalGasConsumed().Cmp(e.config.PhantomMessageAtGas) > 0 {
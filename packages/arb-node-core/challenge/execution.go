@@ -40,30 +40,25 @@ func cutHash(state *core.ExecutionState, reachable bool) common.Hash {
 	return state.CutHash()
 }
 
-func getCut(execTracker *core.ExecutionTracker, maxTotalMessagesRead *big.Int, gasTarget *big.Int) (common.Hash, *big.Int, error) {
-	state, reachable, steps, err := getCutRaw(execTracker, maxTotalMessagesRead, gasTarget)
-	if err != nil {
-		return common.Hash{}, nil, err
-	}
-	return cutHash(state, reachable), steps, nil
+func GetCuts(lookup core.ArbCoreLookup, assertion *core.Assertion, offsets []*big.Int) (*core.ExecutionState, []common.Hash, error) {
+	return getCuts(newCutCache(lookup, assertion, offsets, nil), offsets)
 }
 
-func GetCuts(lookup core.ArbCoreLookup, assertion *core.Assertion, offsets []*big.Int) (*core.ExecutionState, []common.Hash, error) {
-	execTracker := core.NewExecutionTracker(lookup, true, offsets, true)
+func getCuts(cache *cutCache, offsets []*big.Int) (*core.ExecutionState, []common.Hash, error) {
 	cuts := make([]common.Hash, 0, len(offsets))
 	var startState *core.ExecutionState
 	for i, offset := range offsets {
-		cut, reachable, _, err := getCutRaw(execTracker, assertion.After.TotalMessagesRead, offset)
+		cut, err := cache.get(offset)
 		if err != nil {
 			return nil, nil, err
 		}
 		if i == 0 {
-			if !reachable {
+			if cut.State == nil {
 				return nil, nil, errors.New("first cut is unreachable")
 			}
-			startState = cut
+			startState = cut.State
 		}
-		cuts = append(cuts, cutHash(cut, reachable))
+		cuts = append(cuts, cut.hash())
 	}
 	return startState, cuts, nil
 }
@@ -75,26 +70,30 @@ type DivergenceInfo struct {
 }
 
 func FindFirstDivergence(lookup core.ArbCoreLookup, assertion *core.Assertion, offsets []*big.Int, cuts []common.Hash) (DivergenceInfo, error) {
+	return findFirstDivergence(newCutCache(lookup, assertion, offsets, nil), offsets, cuts)
+}
+
+func findFirstDivergence(cache *cutCache, offsets []*big.Int, cuts []common.Hash) (DivergenceInfo, error) {
 	errRes := DivergenceInfo{
 		DifferentIndex:   0,
 		SegmentSteps:     big.NewInt(0),
 		EndIsUnreachable: false,
 	}
-	execTracker := core.NewExecutionTracker(lookup, true, offsets, true)
 	lastSteps := big.NewInt(0)
 	for i, offset := range offsets {
-		localCut, newSteps, err := getCut(execTracker, assertion.After.TotalMessagesRead, offset)
+		cut, err := cache.get(offset)
 		if err != nil {
 			return errRes, err
 		}
+		localCut := cut.hash()
 		if localCut != cuts[i] {
 			return DivergenceInfo{
 				DifferentIndex:   i,
-				SegmentSteps:     new(big.Int).Sub(newSteps, lastSteps),
+				SegmentSteps:     new(big.Int).Sub(cut.Steps, lastSteps),
 				EndIsUnreachable: localCut == unreachableCut,
 			}, nil
 		}
-		lastSteps = newSteps
+		lastSteps = cut.Steps
 	}
 	return errRes, errors.New("no divergence found in cuts")
 }
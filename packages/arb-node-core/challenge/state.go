@@ -0,0 +1,175 @@
+package challenge
+
+import (
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+var (
+	moveResponseTimer     = metrics.NewRegisteredTimer("arbitrum/challenge/move/time_to_respond", nil)
+	movesCounter          = metrics.NewRegisteredCounter("arbitrum/challenge/moves", nil)
+	resumedCounter        = metrics.NewRegisteredCounter("arbitrum/challenge/resumed", nil)
+	cutsExecutedCounter   = metrics.NewRegisteredCounter("arbitrum/challenge/cuts/executed", nil)
+	cutsReusedCounter     = metrics.NewRegisteredCounter("arbitrum/challenge/cuts/reused", nil)
+	stateSaveErrorCounter = metrics.NewRegisteredCounter("arbitrum/challenge/state/save_errors", nil)
+	stateSizeGauge        = metrics.NewRegisteredGauge("arbitrum/challenge/state/size_bytes", nil)
+	knownBisectionsGauge  = metrics.NewRegisteredGauge("arbitrum/challenge/state/bisections", nil)
+)
+
+// KnownBisection is an opponent's bisection along with the challenge state
+// hash it was committed to, so it doesn't need to be looked up in L1 logs again
+type KnownBisection struct {
+	ChallengeState common.Hash
+	Bisection      *core.Bisection
+}
+
+// CachedCut is the result of executing the challenged assertion up to Gas.
+// State is nil if that point isn't reachable by the assertion.
+type CachedCut struct {
+	Gas   *big.Int
+	Steps *big.Int
+	State *core.ExecutionState
+}
+
+func (c *CachedCut) hash() common.Hash {
+	return cutHash(c.State, c.State != nil)
+}
+
+// ChallengeState is the progress of a challenge that's saved after every move
+// so that a restarted validator can respond without re-executing everything
+type ChallengeState struct {
+	ChallengeAddress    common.Address
+	ChallengedAssertion *core.Assertion
+	Bisections          []*KnownBisection
+	Cuts                []*CachedCut
+
+	// The challenge state we were asked to respond to and when we first saw it
+	TurnState   common.Hash
+	TurnStarted time.Time
+}
+
+func challengeStateKey(stakerAddress common.Address) []byte {
+	return append([]byte("challenge:"), stakerAddress.Bytes()...)
+}
+
+func loadChallengeState(store machine.ValidatorStateStore, stakerAddress common.Address) (*ChallengeState, error) {
+	data, found := store.GetValidatorState(challengeStateKey(stakerAddress))
+	if !found {
+		return nil, nil
+	}
+	state := &ChallengeState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.Wrap(err, "error parsing saved challenge state")
+	}
+	return state, nil
+}
+
+func saveChallengeState(store machine.ValidatorStateStore, stakerAddress common.Address, state *ChallengeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	stateSizeGauge.Update(int64(len(data)))
+	knownBisectionsGauge.Update(int64(len(state.Bisections)))
+	return store.PutValidatorState(challengeStateKey(stakerAddress), data)
+}
+
+// ForgetChallenge removes any saved challenge progress for the given staker
+func ForgetChallenge(store machine.ValidatorStateStore, stakerAddress common.Address) error {
+	stateSizeGauge.Update(0)
+	knownBisectionsGauge.Update(0)
+	return store.DeleteValidatorState(challengeStateKey(stakerAddress))
+}
+
+func (s *ChallengeState) lookupBisection(challengeState common.Hash) *core.Bisection {
+	for _, known := range s.Bisections {
+		if known.ChallengeState == challengeState {
+			return known.Bisection
+		}
+	}
+	return nil
+}
+
+func (s *ChallengeState) cutMap() map[string]*CachedCut {
+	cuts := make(map[string]*CachedCut, len(s.Cuts))
+	for _, cut := range s.Cuts {
+		cuts[string(cut.Gas.Bytes())] = cut
+	}
+	return cuts
+}
+
+// setCuts records the given cuts, dropping any outside of segment since
+// the challenge can never return to them
+func (s *ChallengeState) setCuts(cuts map[string]*CachedCut, segment *core.ChallengeSegment) {
+	end := segment.GetEnd()
+	kept := make([]*CachedCut, 0, len(cuts))
+	for _, cut := range cuts {
+		if cut.Gas.Cmp(segment.Start) >= 0 && cut.Gas.Cmp(end) <= 0 {
+			kept = append(kept, cut)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].Gas.Cmp(kept[j].Gas) < 0
+	})
+	s.Cuts = kept
+}
+
+// cutCache answers cut queries from previously computed results where
+// possible, only creating execution cursors for the gas positions it hasn't
+// seen before
+type cutCache struct {
+	lookup    core.ArbCoreLookup
+	assertion *core.Assertion
+	offsets   []*big.Int
+	known     map[string]*CachedCut
+	tracker   *core.ExecutionTracker
+}
+
+func newCutCache(lookup core.ArbCoreLookup, assertion *core.Assertion, offsets []*big.Int, known map[string]*CachedCut) *cutCache {
+	if known == nil {
+		known = make(map[string]*CachedCut)
+	}
+	return &cutCache{
+		lookup:    lookup,
+		assertion: assertion,
+		offsets:   offsets,
+		known:     known,
+	}
+}
+
+func (c *cutCache) get(gas *big.Int) (*CachedCut, error) {
+	key := string(gas.Bytes())
+	if cut, ok := c.known[key]; ok {
+		cutsReusedCounter.Inc(1)
+		return cut, nil
+	}
+	if c.tracker == nil {
+		missing := make([]*big.Int, 0, len(c.offsets))
+		for _, offset := range c.offsets {
+			if _, ok := c.known[string(offset.Bytes())]; !ok {
+				missing = append(missing, offset)
+			}
+		}
+		c.tracker = core.NewExecutionTracker(c.lookup, true, missing, true)
+	}
+	state, reachable, steps, err := getCutRaw(c.tracker, c.assertion.After.TotalMessagesRead, gas)
+	if err != nil {
+		return nil, err
+	}
+	cutsExecutedCounter.Inc(1)
+	cut := &CachedCut{Gas: gas, Steps: steps}
+	if reachable {
+		cut.State = state
+	}
+	c.known[key] = cut
+	return cut, nil
+}
@@ -0,0 +1,113 @@
+package challenge
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+func testExecutionState(gas int64) *core.ExecutionState {
+	return &core.ExecutionState{
+		MachineHash:       common.RandHash(),
+		InboxAcc:          common.RandHash(),
+		TotalMessagesRead: big.NewInt(1),
+		TotalGasConsumed:  big.NewInt(gas),
+		TotalSendCount:    big.NewInt(0),
+		TotalLogCount:     big.NewInt(0),
+		SendAcc:           common.RandHash(),
+		LogAcc:            common.RandHash(),
+	}
+}
+
+func TestChallengeStateRoundTrip(t *testing.T) {
+	store := machine.NewInMemoryValidatorStateStore()
+	staker := common.RandAddress()
+	assertion := &core.Assertion{
+		Before: testExecutionState(0),
+		After:  testExecutionState(1000),
+	}
+	bisection := assertion.InitialExecutionBisection()
+	state := &ChallengeState{
+		ChallengeAddress:    common.RandAddress(),
+		ChallengedAssertion: assertion,
+		Bisections:          []*KnownBisection{{ChallengeState: common.RandHash(), Bisection: bisection}},
+		Cuts: []*CachedCut{
+			{Gas: big.NewInt(0), Steps: big.NewInt(0), State: assertion.Before},
+			{Gas: big.NewInt(1000), Steps: big.NewInt(50)},
+		},
+		TurnState:   common.RandHash(),
+		TurnStarted: time.Now().Truncate(time.Second),
+	}
+	if err := saveChallengeState(store, staker, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadChallengeState(store, staker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ChallengeAddress != state.ChallengeAddress || loaded.TurnState != state.TurnState || !loaded.TurnStarted.Equal(state.TurnStarted) {
+		t.Error("challenge metadata changed after reload")
+	}
+	if loaded.ChallengedAssertion.After.CutHash() != assertion.After.CutHash() {
+		t.Error("challenged assertion changed after reload")
+	}
+	if loaded.lookupBisection(state.Bisections[0].ChallengeState) == nil {
+		t.Error("known bisection missing after reload")
+	}
+	for i, cut := range loaded.Cuts {
+		if cut.hash() != state.Cuts[i].hash() || cut.Steps.Cmp(state.Cuts[i].Steps) != 0 {
+			t.Error("cut", i, "changed after reload")
+		}
+	}
+
+	if err := ForgetChallenge(store, staker); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadChallengeState(store, staker); err != nil || loaded != nil {
+		t.Error("challenge state still present after forgetting it")
+	}
+}
+
+func TestCutCacheReusesKnownCuts(t *testing.T) {
+	assertion := &core.Assertion{
+		Before: testExecutionState(0),
+		After:  testExecutionState(200),
+	}
+	offsets := []*big.Int{big.NewInt(0), big.NewInt(100), big.NewInt(200)}
+	known := map[string]*CachedCut{}
+	for i, offset := range offsets {
+		known[string(offset.Bytes())] = &CachedCut{
+			Gas:   offset,
+			Steps: big.NewInt(int64(i * 10)),
+			State: testExecutionState(offset.Int64()),
+		}
+	}
+	// Nothing needs executing, so the cache must not touch the nil lookup
+	startState, cuts, err := getCuts(newCutCache(nil, assertion, offsets, known), offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if startState != known[string(offsets[0].Bytes())].State || len(cuts) != len(offsets) {
+		t.Fatal("unexpected cuts from cache")
+	}
+
+	opponentCuts := append([]common.Hash{}, cuts...)
+	opponentCuts[2] = common.RandHash()
+	divergence, err := findFirstDivergence(newCutCache(nil, assertion, offsets, known), offsets, opponentCuts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if divergence.DifferentIndex != 2 || divergence.SegmentSteps.Int64() != 10 {
+		t.Error("unexpected divergence", divergence.DifferentIndex, divergence.SegmentSteps)
+	}
+
+	state := &ChallengeState{}
+	state.setCuts(known, &core.ChallengeSegment{Start: big.NewInt(100), Length: big.NewInt(100)})
+	if len(state.Cuts) != 2 || state.Cuts[0].Gas.Int64() != 100 || state.Cuts[1].Gas.Int64() != 200 {
+		t.Error("cuts outside the challenged segment weren't pruned")
+	}
+}
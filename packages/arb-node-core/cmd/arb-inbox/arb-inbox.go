@@ -0,0 +1,134 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	golog "log"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/inboxfile"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var logger zerolog.Logger
+
+func init() {
+	// Enable line numbers in logging
+	golog.SetFlags(golog.LstdFlags | golog.Lshortfile)
+
+	// Print stack trace when `.Error().Stack().Err(err).` is added to zerolog call
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	// Print line number that log was created on
+	logger = log.With().Caller().Stack().Str("component", "arb-inbox").Logger()
+}
+
+func main() {
+	if err := startup(); err != nil {
+		logger.Error().Err(err).Msg("Error moving inbox")
+		os.Exit(1)
+	}
+}
+
+func printUsage() {
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage: arb-inbox export --dbdir=<node db> --arbos=<arbos.mexe> --dir=<export dir> [--from=<message count>] [--items-per-chunk=<count>]\n")
+	fmt.Printf("              arb-inbox import --dbdir=<node db> --arbos=<arbos.mexe> --dir=<export dir>\n\n")
+}
+
+// The database must not be in use by a running node
+func startup() error {
+	if len(os.Args) < 2 {
+		printUsage()
+		return nil
+	}
+	command := os.Args[1]
+	if command != "export" && command != "import" {
+		printUsage()
+		return nil
+	}
+
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	dbDir := fs.String("dbdir", "", "node database directory")
+	arbosPath := fs.String("arbos", "", "ArbOS machine the database was created with")
+	dir := fs.String("dir", "", "directory holding the inbox export")
+	from := fs.String("from", "0", "message count to start exporting at")
+	itemsPerChunk := fs.Int("items-per-chunk", inboxfile.DefaultItemsPerChunk, "maximum sequencer batch items in each exported chunk")
+	gethLogLevel, arbLogLevel := cmdhelp.AddLogFlags(fs)
+
+	err := fs.Parse(os.Args[2:])
+	if err != nil {
+		return errors.Wrap(err, "error parsing arguments")
+	}
+
+	if *dbDir == "" || *arbosPath == "" || *dir == "" {
+		printUsage()
+		return nil
+	}
+
+	if err := cmdhelp.ParseLogFlags(gethLogLevel, arbLogLevel); err != nil {
+		return err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	mon, err := monitor.NewMonitor(*dbDir, *arbosPath, configuration.DefaultCoreSettings())
+	if err != nil {
+		return errors.Wrap(err, "error opening monitor")
+	}
+	defer mon.Close()
+
+	if command == "export" {
+		fromMessage, ok := new(big.Int).SetString(*from, 10)
+		if !ok || fromMessage.Sign() < 0 {
+			return errors.Errorf("invalid message count %v", *from)
+		}
+		manifest, err := inboxfile.Export(mon.Core, *dir, fromMessage, *itemsPerChunk)
+		if err != nil {
+			return err
+		}
+		logger.Info().
+			Int("chunks", len(manifest.Chunks)).
+			Str("messageCount", manifest.MessageCount().String()).
+			Msg("exported inbox")
+		return nil
+	}
+
+	manifest, err := inboxfile.Import(ctx, mon.Core, *dir)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Int("chunks", len(manifest.Chunks)).
+		Str("messageCount", manifest.MessageCount().String()).
+		Msg("imported inbox")
+	return nil
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/rs/zerolog/pkgerrors"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/nodehealth"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcastclient"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
@@ -105,6 +106,17 @@ func startup() error {
 	}
 	defer arbRelay.Stop()
 
+	if config.Healthcheck.Addr != "" {
+		components := nodehealth.NewComponents()
+		arbRelay.AddComponentChecks(components)
+		go func() {
+			err := nodehealth.StartComponentHealthCheck(ctx, config.Healthcheck.Addr+":"+config.Healthcheck.Port, components)
+			if err != nil {
+				log.Error().Err(err).Msg("healthcheck server failed")
+			}
+		}()
+	}
+
 	select {
 	case <-cancelChan:
 		return nil
@@ -187,6 +199,14 @@ func (ar *ArbRelay) Start(ctx context.Context) (chan bool, error) {
 	return done, nil
 }
 
+// AddComponentChecks reports the state of the feed clients and the broadcaster
+func (ar *ArbRelay) AddComponentChecks(components *nodehealth.Components) {
+	components.AddReadinessCheck("feed", nodehealth.FeedClientsCheck(ar.broadcastClients))
+	components.AddLivenessCheck("broadcaster", func() (string, error) {
+		return fmt.Sprintf("%v clients connected", ar.broadcaster.ClientCount()), nil
+	})
+}
+
 func (ar *ArbRelay) Stop() {
 	for _, client := range ar.broadcastClients {
 		client.Close()
@@ -17,6 +17,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -35,6 +36,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	gethmetrics "github.com/ethereum/go-ethereum/metrics"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
@@ -45,6 +47,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
 )
 
@@ -56,6 +59,9 @@ func init() {
 	http.DefaultServeMux = http.NewServeMux()
 }
 
+// watchOnlyStrategy checks assertions without a wallet instead of staking
+const watchOnlyStrategy = "WatchOnly"
+
 type ChainState struct {
 	ValidatorWallet string `json:"validatorWallet"`
 }
@@ -82,10 +88,11 @@ func startup() error {
 	defer cancelFunc()
 
 	config, walletConfig, l1Client, l1ChainId, err := configuration.ParseValidator(ctx)
-	if err != nil || len(config.Persistent.GlobalConfig) == 0 || len(config.L1.URL) == 0 ||
-		len(config.Rollup.Address) == 0 || len(config.BridgeUtilsAddress) == 0 ||
-		len(config.Validator.UtilsAddress) == 0 || len(config.Validator.WalletFactoryAddress) == 0 ||
-		len(config.Validator.Strategy) == 0 {
+	var rollupConfigs []*configuration.Config
+	if err == nil {
+		rollupConfigs = config.ValidatorRollups()
+	}
+	if err != nil || len(config.Persistent.GlobalConfig) == 0 || len(config.L1.URL) == 0 || !rollupsConfigured(rollupConfigs) {
 		fmt.Printf("\n")
 		fmt.Printf("Sample usage: arb-validator --conf=<filename> \n")
 		fmt.Printf("          or: arb-validator --persistent.storage.path=<path> --l1.url=<L1 RPC> --feed.input.url=<feed websocket>\n\n")
@@ -113,8 +120,12 @@ func startup() error {
 	const largeChannelBuffer = 200
 	healthChan := make(chan nodehealth.Log, largeChannelBuffer)
 
+	components := nodehealth.NewComponents()
+	components.AddReadinessCheck("startup", func() (string, error) {
+		return "", errors.New("starting rollups")
+	})
 	go func() {
-		err := nodehealth.StartNodeHealthCheck(ctx, healthChan, metricsConfig.Registry)
+		err := nodehealth.StartNodeHealthCheckWithComponents(ctx, healthChan, metricsConfig.Registry, components)
 		if err != nil {
 			log.Error().Err(err).Msg("healthcheck server failed")
 		}
@@ -124,29 +135,157 @@ func startup() error {
 	healthChan <- nodehealth.Log{Config: true, Var: "disablePrimaryCheck", ValBool: !config.Healthcheck.Sequencer}
 	healthChan <- nodehealth.Log{Config: true, Var: "disableOpenEthereumCheck", ValBool: !config.Healthcheck.L1Node}
 	healthChan <- nodehealth.Log{Config: true, Var: "healthcheckRPC", ValStr: config.Healthcheck.Addr + ":" + config.Healthcheck.Port}
-	healthChan <- nodehealth.Log{Config: true, Var: "openethereumHealthcheckRPC", ValStr: config.L1.URL}
+	for _, endpoint := range append([]string{config.L1.URL}, config.Healthcheck.L1Endpoints...) {
+		healthChan <- nodehealth.Log{Config: true, Var: "l1Endpoint", ValStr: endpoint}
+	}
+	healthChan <- nodehealth.Log{Config: true, Var: "l1ChainID", ValBigInt: l1ChainId}
+	healthChan <- nodehealth.Log{Config: true, Var: "l1MaxBlockAge", ValTime: config.Healthcheck.L1MaxBlockAge}
 	nodehealth.Init(healthChan)
 
+	// Each staking rollup gets the auth for its own wallet, or the top level
+	// one if it doesn't have one. Rollups staking from the same account share
+	// its transaction manager so that nonces stay consistent between them.
+	valAuths := make([]transactauth.TransactAuth, len(rollupConfigs))
+	accountAuths := make(map[ethcommon.Address]transactauth.TransactAuth)
+	var defaultAuth *bind.TransactOpts
+	for i, rollupConfig := range rollupConfigs {
+		if rollupConfig.Validator.Strategy == watchOnlyStrategy {
+			continue
+		}
+		rollupWallet := walletConfig
+		txManagerDir := config.Persistent.Chain
+		auth := defaultAuth
+		if rollupConfig.Wallet.IsSet() {
+			rollupWallet = &rollupConfig.Wallet
+			txManagerDir = rollupConfig.Persistent.Chain
+			auth, _, err = cmdhelp.GetKeystore(ctx, rollupConfig, rollupWallet, l1ChainId, false)
+		} else if defaultAuth == nil {
+			auth, _, err = cmdhelp.GetKeystore(ctx, config, walletConfig, l1ChainId, false)
+			defaultAuth = auth
+		}
+		if err != nil {
+			return errors.Wrapf(err, "error loading wallet keystore for rollup %v", rollupConfig.Rollup.Address)
+		}
+		if valAuth, ok := accountAuths[auth.From]; ok {
+			valAuths[i] = valAuth
+			continue
+		}
+		logger.Info().Str("address", auth.From.String()).Str("rollup", rollupConfig.Rollup.Address).Msg("Loaded wallet")
+
+		var valAuth transactauth.TransactAuth
+		if len(rollupWallet.Fireblocks.SSLKey) > 0 {
+			valAuth, _, err = transactauth.NewFireblocksTransactAuthAdvanced(ctx, l1Client, auth, rollupWallet, false)
+		} else {
+			valAuth, err = transactauth.NewTransactAuthAdvanced(ctx, l1Client, auth, false)
+		}
+		if err != nil {
+			return errors.Wrap(err, "error creating connecting to chain")
+		}
+		valAuth, err = transactauth.WithTxManager(ctx, l1Client, valAuth, config.L1.TxManager, txManagerDir)
+		if err != nil {
+			return errors.Wrap(err, "error creating transaction manager")
+		}
+		accountAuths[auth.From] = valAuth
+		valAuths[i] = valAuth
+	}
+
+	inboxClient, err := ethutils.WithFallbacks(l1Client, config.L1.URL, config.L1.FallbackURLs)
+	if err != nil {
+		return err
+	}
+
+	doneChans := make([]chan bool, 0, len(rollupConfigs))
+	var watchers []*staker.WatchOnlyValidator
+	for i, rollupConfig := range rollupConfigs {
+		registry := metricsConfig.Registry
+		componentPrefix := ""
+		if len(rollupConfigs) > 1 {
+			componentPrefix = "rollup/" + path.Base(rollupConfig.Persistent.Chain) + "/"
+			registry = gethmetrics.NewPrefixedChildRegistry(registry, componentPrefix)
+		}
+
+		mon, err := monitor.NewMonitor(rollupConfig.GetValidatorDatabasePath(), rollupConfig.Rollup.Machine.Filename, &rollupConfig.Core)
+		if err != nil {
+			return errors.Wrapf(err, "error opening monitor for rollup %v", rollupConfig.Rollup.Address)
+		}
+		defer mon.Close()
+
+		if rollupConfig.Validator.Strategy == watchOnlyStrategy {
+			watcher, err := startWatchOnly(ctx, rollupConfig, mon, l1Client, inboxClient, healthChan, registry, dummySequencerFeed)
+			if err != nil {
+				return err
+			}
+			watchers = append(watchers, watcher)
+			doneChans = append(doneChans, watcher.RunInBackground(ctx))
+		} else {
+			stakerManager, err := startStaker(ctx, rollupConfig, mon, l1Client, inboxClient, valAuths[i], healthChan, dummySequencerFeed)
+			if err != nil {
+				return err
+			}
+			doneChans = append(doneChans, stakerManager.RunInBackground(ctx, rollupConfig.Validator.StakerDelay))
+		}
+		mon.AddComponentChecks(components, componentPrefix)
+	}
+	components.AddReadinessCheck("startup", func() (string, error) {
+		return "started", nil
+	})
+
+	if len(watchers) > 0 {
+		go func() {
+			if err := staker.StartWatchOnlyServer(ctx, config.Validator.WatchOnly, watchers); err != nil {
+				logger.Error().Err(err).Msg("watch-only status server failed")
+			}
+		}()
+		logger.Info().Str("addr", config.Validator.WatchOnly.Addr+":"+config.Validator.WatchOnly.Port).Msg("Serving watch-only status")
+	}
+
+	anyDone := make(chan bool, len(doneChans))
+	for _, done := range doneChans {
+		go func(done chan bool) {
+			<-done
+			anyDone <- true
+		}(done)
+	}
+	select {
+	case <-cancelChan:
+		return nil
+	case <-anyDone:
+		return nil
+	}
+}
+
+func rollupsConfigured(rollupConfigs []*configuration.Config) bool {
+	if len(rollupConfigs) == 0 {
+		return false
+	}
+	for _, rollupConfig := range rollupConfigs {
+		if len(rollupConfig.Rollup.Address) == 0 || len(rollupConfig.BridgeUtilsAddress) == 0 ||
+			len(rollupConfig.Validator.UtilsAddress) == 0 || len(rollupConfig.Validator.Strategy) == 0 ||
+			(len(rollupConfig.Validator.WalletFactoryAddress) == 0 && rollupConfig.Validator.Strategy != watchOnlyStrategy) {
+			return false
+		}
+	}
+	return true
+}
+
+func startStaker(
+	ctx context.Context,
+	config *configuration.Config,
+	mon *monitor.Monitor,
+	l1Client ethutils.EthClient,
+	inboxClient ethutils.EthClient,
+	valAuth transactauth.TransactAuth,
+	healthChan chan nodehealth.Log,
+	sequencerFeed chan broadcaster.BroadcastFeedMessage,
+) (*staker.Staker, error) {
 	rollupAddr := ethcommon.HexToAddress(config.Rollup.Address)
 	bridgeUtilsAddr := ethcommon.HexToAddress(config.BridgeUtilsAddress)
 	validatorUtilsAddr := ethcommon.HexToAddress(config.Validator.UtilsAddress)
 	validatorWalletFactoryAddr := ethcommon.HexToAddress(config.Validator.WalletFactoryAddress)
-	auth, _, err := cmdhelp.GetKeystore(config, walletConfig, l1ChainId, false)
+
+	strategy, err := staker.NewStrategy(config.Validator.Strategy, config.Validator)
 	if err != nil {
-		return errors.Wrap(err, "error loading wallet keystore")
-	}
-	logger.Info().Str("address", auth.From.String()).Msg("Loaded wallet")
-
-	strategyString := config.Validator.Strategy
-	var strategy staker.Strategy
-	if strategyString == "MakeNodes" {
-		strategy = staker.MakeNodesStrategy
-	} else if strategyString == "StakeLatest" {
-		strategy = staker.StakeLatestStrategy
-	} else if strategyString == "Defensive" {
-		strategy = staker.DefensiveStrategy
-	} else {
-		return errors.New("unsupported strategy specified. Currently supported: MakeNodes, StakeLatest")
+		return nil, errors.Wrapf(err, "error creating strategy for rollup %v", config.Rollup.Address)
 	}
 
 	chainState := ChainState{}
@@ -154,29 +293,19 @@ func startup() error {
 	chainStateFile, err := os.Open(chainStatePath)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return errors.Wrap(err, "failed to open chainState.json")
+			return nil, errors.Wrap(err, "failed to open chainState.json")
 		}
 	} else {
 		chainStateData, err := ioutil.ReadAll(chainStateFile)
 		if err != nil {
-			return errors.Wrap(err, "failed to read chain state")
+			return nil, errors.Wrap(err, "failed to read chain state")
 		}
 		err = json.Unmarshal(chainStateData, &chainState)
 		if err != nil {
-			return errors.Wrap(err, "failed to unmarshal chain state")
+			return nil, errors.Wrap(err, "failed to unmarshal chain state")
 		}
 	}
 
-	var valAuth transactauth.TransactAuth
-	if len(walletConfig.Fireblocks.SSLKey) > 0 {
-		valAuth, _, err = transactauth.NewFireblocksTransactAuthAdvanced(ctx, l1Client, auth, walletConfig, false)
-	} else {
-		valAuth, err = transactauth.NewTransactAuthAdvanced(ctx, l1Client, auth, false)
-
-	}
-	if err != nil {
-		return errors.Wrap(err, "error creating connecting to chain")
-	}
 	validatorAddress := ethcommon.Address{}
 	if chainState.ValidatorWallet == "" {
 		for {
@@ -185,12 +314,13 @@ func startup() error {
 				break
 			}
 			logger.Warn().Err(err).
-				Str("sender", auth.From.Hex()).
+				Str("sender", valAuth.From().Hex()).
+				Str("rollup", config.Rollup.Address).
 				Msg("Failed to deploy validator wallet")
 
 			select {
 			case <-ctx.Done():
-				return nil
+				return nil, ctx.Err()
 			case <-time.After(time.Second * 5):
 			}
 		}
@@ -198,41 +328,58 @@ func startup() error {
 
 		newChainStateData, err := json.Marshal(chainState)
 		if err != nil {
-			return errors.Wrap(err, "failed to marshal chain state")
+			return nil, errors.Wrap(err, "failed to marshal chain state")
 		}
 		if err := ioutil.WriteFile(chainStatePath, newChainStateData, 0644); err != nil {
-			return errors.Wrap(err, "failed to write chain state config")
+			return nil, errors.Wrap(err, "failed to write chain state config")
 		}
 	} else {
 		validatorAddress = ethcommon.HexToAddress(chainState.ValidatorWallet)
 	}
 
-	mon, err := monitor.NewMonitor(config.GetValidatorDatabasePath(), config.Rollup.Machine.Filename, &config.Core)
+	val, err := ethbridge.NewValidator(validatorAddress, rollupAddr, l1Client, valAuth)
 	if err != nil {
-		return errors.Wrap(err, "error opening monitor")
+		return nil, errors.Wrap(err, "error creating validator wallet")
 	}
-	defer mon.Close()
 
-	val, err := ethbridge.NewValidator(validatorAddress, rollupAddr, l1Client, valAuth)
+	stakerManager, _, err := staker.NewStaker(ctx, mon.Core, l1Client, val, config.Rollup.FromBlock, common.NewAddressFromEth(validatorUtilsAddr), strategy, bind.CallOpts{}, valAuth, config.Validator, mon.Storage)
 	if err != nil {
-		return errors.Wrap(err, "error creating validator wallet")
+		return nil, errors.Wrap(err, "error setting up staker")
 	}
 
-	stakerManager, _, err := staker.NewStaker(ctx, mon.Core, l1Client, val, config.Rollup.FromBlock, common.NewAddressFromEth(validatorUtilsAddr), strategy, bind.CallOpts{}, valAuth, config.Validator)
+	_, err = mon.StartInboxReader(ctx, inboxClient, config.L1.LogFetch, common.NewAddressFromEth(rollupAddr), config.Rollup.FromBlock, common.NewAddressFromEth(bridgeUtilsAddr), healthChan, sequencerFeed)
 	if err != nil {
-		return errors.Wrap(err, "error setting up staker")
+		return nil, errors.Wrap(err, "failed to create inbox reader")
 	}
 
-	_, err = mon.StartInboxReader(ctx, l1Client, common.NewAddressFromEth(rollupAddr), config.Rollup.FromBlock, common.NewAddressFromEth(bridgeUtilsAddr), healthChan, dummySequencerFeed)
+	logger.Info().Str("rollup", config.Rollup.Address).Str("strategy", strategy.Name()).Msg("Initialized validator")
+	return stakerManager, nil
+}
+
+func startWatchOnly(
+	ctx context.Context,
+	config *configuration.Config,
+	mon *monitor.Monitor,
+	l1Client ethutils.EthClient,
+	inboxClient ethutils.EthClient,
+	healthChan chan nodehealth.Log,
+	registry gethmetrics.Registry,
+	sequencerFeed chan broadcaster.BroadcastFeedMessage,
+) (*staker.WatchOnlyValidator, error) {
+	rollupAddr := common.HexToAddress(config.Rollup.Address)
+	bridgeUtilsAddr := common.HexToAddress(config.BridgeUtilsAddress)
+	validatorUtilsAddr := common.HexToAddress(config.Validator.UtilsAddress)
+
+	watcher, err := staker.NewWatchOnlyValidator(rollupAddr, config.Rollup.FromBlock, validatorUtilsAddr, mon.Core, l1Client, bind.CallOpts{}, config.Validator.WatchOnly, registry)
 	if err != nil {
-		return errors.Wrap(err, "failed to create inbox reader")
+		return nil, errors.Wrap(err, "error setting up watch-only validator")
 	}
 
-	logger.Info().Int("strategy", int(strategy)).Msg("Initialized validator")
-	select {
-	case <-cancelChan:
-		return nil
-	case <-stakerManager.RunInBackground(ctx, config.Validator.StakerDelay):
-		return nil
+	_, err = mon.StartInboxReader(ctx, inboxClient, config.L1.LogFetch, rollupAddr, config.Rollup.FromBlock, bridgeUtilsAddr, healthChan, sequencerFeed)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create inbox reader")
 	}
+
+	logger.Info().Str("rollup", config.Rollup.Address).Msg("Initialized watch-only validator")
+	return watcher, nil
 }
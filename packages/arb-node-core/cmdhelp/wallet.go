@@ -17,6 +17,7 @@
 package cmdhelp
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"fmt"
 	"math"
@@ -34,6 +35,7 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/remotesigner"
 	"github.com/pkg/errors"
 )
 
@@ -53,8 +55,10 @@ func readPass() (string, error) {
 // keystore located in validatorFolder/wallets or creates one if it does not
 // exist. It accepts a password using the "password" command line argument or
 // via an interactive prompt. It also sets the gas price of the auth via an
-// optional "gasprice" arguement.
+// optional "gasprice" arguement. The returned data signer signs its input as
+// an Ethereum signed message so that it can be backed by a remote signer.
 func GetKeystore(
+	ctx context.Context,
 	config *configuration.Config,
 	walletConfig *configuration.Wallet,
 	chainId *big.Int,
@@ -93,7 +97,7 @@ func GetKeystore(
 				Hex("signer", crypto.PubkeyToAddress(*publicKeyECDSA).Bytes()).
 				Msg("feed private key used as signer")
 			signer = func(data []byte) ([]byte, error) {
-				return crypto.Sign(data, privateKey)
+				return crypto.Sign(accounts.TextHash(data), privateKey)
 			}
 		} else if signerRequired {
 			if len(walletConfig.Fireblocks.FeedSigner.Pathname) == 0 {
@@ -109,11 +113,31 @@ func GetKeystore(
 				Hex("signer", account.Address.Bytes()).
 				Msg("feed signer wallet used as signer")
 			signer = func(data []byte) ([]byte, error) {
-				return ks.SignHash(*account, data)
+				return ks.SignHash(*account, accounts.TextHash(data))
 			}
 		}
-	} else if len(config.Wallet.Local.PrivateKey) != 0 {
-		privateKey, err := crypto.HexToECDSA(config.Wallet.Local.PrivateKey)
+	} else if len(walletConfig.Remote.URL) != 0 {
+		remoteSigner, err := remotesigner.New(walletConfig.Remote)
+		if err != nil {
+			return nil, nil, err
+		}
+		fromAddress := ethcommon.HexToAddress(walletConfig.Remote.Address)
+		auth = remoteSigner.TransactOpts(ctx, fromAddress)
+		logger.Info().Hex("address", fromAddress.Bytes()).Str("url", walletConfig.Remote.URL).Msg("remote signer enabled")
+
+		feedSignerAddress := fromAddress
+		if len(walletConfig.Remote.FeedSignerAddress) != 0 {
+			feedSignerAddress = ethcommon.HexToAddress(walletConfig.Remote.FeedSignerAddress)
+		}
+		if signerRequired {
+			logger.
+				Info().
+				Hex("signer", feedSignerAddress.Bytes()).
+				Msg("remote signer used as feed signer")
+		}
+		signer = remoteSigner.DataSigner(ctx, feedSignerAddress)
+	} else if len(walletConfig.Local.PrivateKey) != 0 {
+		privateKey, err := crypto.HexToECDSA(walletConfig.Local.PrivateKey)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -127,7 +151,7 @@ func GetKeystore(
 			Hex("signer", auth.From.Bytes()).
 			Msg("private key used as signer")
 		signer = func(data []byte) ([]byte, error) {
-			return crypto.Sign(data, privateKey)
+			return crypto.Sign(accounts.TextHash(data), privateKey)
 		}
 	} else {
 		ks, account, err := openKeystore("account", walletConfig.Local.Pathname, walletConfig.Local.Password())
@@ -145,7 +169,7 @@ func GetKeystore(
 			Hex("signer", account.Address.Bytes()).
 			Msg("wallet used as signer")
 		signer = func(data []byte) ([]byte, error) {
-			return ks.SignHash(*account, data)
+			return ks.SignHash(*account, accounts.TextHash(data))
 		}
 	}
 
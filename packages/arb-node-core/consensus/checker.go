@@ -0,0 +1,325 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package consensus double checks the execution of the core. Ranges of
+// messages the core has already processed are re-executed on a separate
+// machine loaded from a checkpoint, and the resulting execution state is
+// compared with the core's own, so that nondeterminism or database corruption
+// stops the node instead of producing incorrect blocks.
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "consensus").Logger()
+
+var (
+	CheckedMessagesGauge = metrics.NewRegisteredGauge("arbitrum/consensus/checked_messages", nil)
+	CheckTimer           = metrics.NewRegisteredTimer("arbitrum/consensus/check", nil)
+	MismatchCounter      = metrics.NewRegisteredCounter("arbitrum/consensus/mismatches", nil)
+)
+
+// Core is the part of the ArbCore used by the checker
+type Core interface {
+	GetMessages(startIndex *big.Int, count *big.Int) ([]inbox.InboxMessage, error)
+	GetInboxAcc(index *big.Int) (common.Hash, error)
+	MachineMessagesRead() *big.Int
+	GetLastMachineTotalGas() (*big.Int, error)
+	GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error)
+	TakeMachine(executionCursor core.ExecutionCursor) (machine.Machine, error)
+	StopThread()
+}
+
+// MismatchError describes a difference between the core's execution and
+// the re-execution of the same messages
+type MismatchError struct {
+	Start    *core.ExecutionState
+	Core     *core.ExecutionState
+	Replayed *core.ExecutionState
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf(
+		"execution mismatch after gas %v: core has machine %v with %v messages, %v sends and %v logs, replay has machine %v with %v messages, %v sends and %v logs",
+		e.Start.TotalGasConsumed,
+		e.Core.MachineHash,
+		e.Core.TotalMessagesRead,
+		e.Core.TotalSendCount,
+		e.Core.TotalLogCount,
+		e.Replayed.MachineHash,
+		e.Replayed.TotalMessagesRead,
+		e.Replayed.TotalSendCount,
+		e.Replayed.TotalLogCount,
+	)
+}
+
+func sameExecutionState(a, b *core.ExecutionState) bool {
+	return a.MachineHash == b.MachineHash &&
+		a.InboxAcc == b.InboxAcc &&
+		a.TotalMessagesRead.Cmp(b.TotalMessagesRead) == 0 &&
+		a.TotalGasConsumed.Cmp(b.TotalGasConsumed) == 0 &&
+		a.TotalSendCount.Cmp(b.TotalSendCount) == 0 &&
+		a.TotalLogCount.Cmp(b.TotalLogCount) == 0 &&
+		a.SendAcc == b.SendAcc &&
+		a.LogAcc == b.LogAcc
+}
+
+// Checker re-executes each range of MessageInterval messages once the core
+// has processed it. On a mismatch it stops the core thread, which halts block
+// production, and reports the failure through Failure.
+type Checker struct {
+	core   Core
+	config configuration.CoreConsensusCheck
+
+	mutex    sync.Mutex
+	verified *core.ExecutionState
+	failure  *MismatchError
+}
+
+func NewChecker(core Core, config configuration.CoreConsensusCheck) (*Checker, error) {
+	if config.MessageInterval == 0 {
+		return nil, errors.New("consensus check message interval must be positive")
+	}
+	if config.MaxGas == 0 {
+		return nil, errors.New("consensus check max gas must be positive")
+	}
+	return &Checker{core: core, config: config}, nil
+}
+
+// Failure returns the mismatch that halted the node, if any
+func (c *Checker) Failure() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.failure == nil {
+		return nil
+	}
+	return c.failure
+}
+
+// Verified returns the latest execution state that was checked
+func (c *Checker) Verified() *core.ExecutionState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.verified
+}
+
+// Start checks the core's execution from its current position onwards until
+// ctx is cancelled or a mismatch is found
+func (c *Checker) Start(ctx context.Context) {
+	go func() {
+		for {
+			checked, err := c.CheckNext()
+			var mismatch *MismatchError
+			if errors.As(err, &mismatch) {
+				return
+			}
+			if err != nil {
+				logger.Warn().Err(err).Msg("error checking core execution")
+			}
+			if checked {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.config.PollInterval):
+			}
+		}
+	}()
+}
+
+// CheckNext re-executes the next range of messages if the core has
+// processed it, returning whether it did
+func (c *Checker) CheckNext() (bool, error) {
+	c.mutex.Lock()
+	start := c.verified
+	failed := c.failure != nil
+	c.mutex.Unlock()
+	if failed {
+		return false, c.Failure()
+	}
+
+	if start == nil {
+		// Begin checking from wherever the core currently is
+		gas, err := c.core.GetLastMachineTotalGas()
+		if err != nil {
+			return false, err
+		}
+		cursor, err := c.core.GetExecutionCursor(gas)
+		if err != nil {
+			return false, err
+		}
+		start, err = core.NewExecutionState(cursor)
+		if err != nil {
+			return false, err
+		}
+		c.mutex.Lock()
+		c.verified = start
+		c.mutex.Unlock()
+		logger.Info().
+			Str("gas", start.TotalGasConsumed.String()).
+			Str("messages", start.TotalMessagesRead.String()).
+			Msg("starting consensus check")
+	}
+
+	target := new(big.Int).Add(start.TotalMessagesRead, new(big.Int).SetUint64(c.config.MessageInterval))
+	if c.core.MachineMessagesRead().Cmp(target) < 0 {
+		return false, nil
+	}
+
+	checkStart := time.Now()
+	var coreState, replayed *core.ExecutionState
+	// A reorg of the inbox while replaying can make the results differ, so
+	// a mismatch is only reported if it happens twice in a row
+	for attempt := 0; attempt < 2; attempt++ {
+		reorged, err := c.inboxReorged(start)
+		if err != nil {
+			return false, err
+		}
+		if reorged {
+			logger.Info().
+				Str("messages", start.TotalMessagesRead.String()).
+				Msg("inbox reorganized before last checked position, restarting consensus check")
+			c.mutex.Lock()
+			c.verified = nil
+			c.mutex.Unlock()
+			return false, nil
+		}
+		coreState, replayed, err = c.replay(start)
+		if err != nil {
+			return false, err
+		}
+		if sameExecutionState(coreState, replayed) {
+			break
+		}
+	}
+	CheckTimer.UpdateSince(checkStart)
+
+	if !sameExecutionState(coreState, replayed) {
+		mismatch := &MismatchError{Start: start, Core: coreState, Replayed: replayed}
+		c.mutex.Lock()
+		c.failure = mismatch
+		c.mutex.Unlock()
+		MismatchCounter.Inc(1)
+		logger.Error().Err(mismatch).Msg("core execution differs from replay, halting block production")
+		c.core.StopThread()
+		return true, mismatch
+	}
+
+	c.mutex.Lock()
+	c.verified = coreState
+	c.mutex.Unlock()
+	CheckedMessagesGauge.Update(coreState.TotalMessagesRead.Int64())
+	logger.Debug().
+		Str("gas", coreState.TotalGasConsumed.String()).
+		Str("messages", coreState.TotalMessagesRead.String()).
+		Msg("core execution matched replay")
+	return true, nil
+}
+
+func (c *Checker) inboxReorged(state *core.ExecutionState) (bool, error) {
+	if state.TotalMessagesRead.Sign() == 0 {
+		return false, nil
+	}
+	acc, err := c.core.GetInboxAcc(new(big.Int).Sub(state.TotalMessagesRead, big.NewInt(1)))
+	if err != nil {
+		return false, err
+	}
+	return acc != state.InboxAcc, nil
+}
+
+// replay executes up to MessageInterval messages after start on a machine
+// taken from a cursor, and looks up the core's state after the same amount
+// of gas
+func (c *Checker) replay(start *core.ExecutionState) (*core.ExecutionState, *core.ExecutionState, error) {
+	cursor, err := c.core.GetExecutionCursor(start.TotalGasConsumed)
+	if err != nil {
+		return nil, nil, err
+	}
+	cursorState, err := core.NewExecutionState(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sameExecutionState(cursorState, start) {
+		// Loading the same position from a checkpoint gave a different result
+		return cursorState, start, nil
+	}
+	mach, err := c.core.TakeMachine(cursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, err := c.core.GetMessages(start.TotalMessagesRead, new(big.Int).SetUint64(c.config.MessageInterval))
+	if err != nil {
+		return nil, nil, err
+	}
+	assertion, _, _, err := mach.ExecuteAssertion(c.config.MaxGas, false, messages)
+	if err != nil {
+		return nil, nil, err
+	}
+	if assertion.NumGas == 0 {
+		return nil, nil, errors.New("replay machine made no progress")
+	}
+
+	replayed := &core.ExecutionState{
+		MachineHash:       mach.Hash(),
+		InboxAcc:          start.InboxAcc,
+		TotalMessagesRead: new(big.Int).Add(start.TotalMessagesRead, new(big.Int).SetUint64(assertion.InboxMessagesConsumed)),
+		TotalGasConsumed:  new(big.Int).Add(start.TotalGasConsumed, new(big.Int).SetUint64(assertion.NumGas)),
+		TotalSendCount:    new(big.Int).Add(start.TotalSendCount, big.NewInt(int64(len(assertion.Sends)))),
+		TotalLogCount:     new(big.Int).Add(start.TotalLogCount, big.NewInt(int64(len(assertion.Logs)))),
+		SendAcc:           start.SendAcc,
+		LogAcc:            start.LogAcc,
+	}
+	if assertion.InboxMessagesConsumed > 0 {
+		replayed.InboxAcc, err = c.core.GetInboxAcc(new(big.Int).Sub(replayed.TotalMessagesRead, big.NewInt(1)))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, send := range assertion.Sends {
+		replayed.SendAcc = hashing.SoliditySHA3(hashing.Bytes32(replayed.SendAcc), crypto.Keccak256(send))
+	}
+	for _, l := range assertion.Logs {
+		replayed.LogAcc = hashing.SoliditySHA3(hashing.Bytes32(replayed.LogAcc), hashing.Bytes32(l.Hash()))
+	}
+
+	coreCursor, err := c.core.GetExecutionCursor(replayed.TotalGasConsumed)
+	if err != nil {
+		return nil, nil, err
+	}
+	coreState, err := core.NewExecutionState(coreCursor)
+	if err != nil {
+		return nil, nil, err
+	}
+	return coreState, replayed, nil
+}
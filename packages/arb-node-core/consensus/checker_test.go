@@ -0,0 +1,275 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package consensus
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// Each test message costs this much gas and produces one send and one log
+const testMessageGas = 100
+
+func testMachineHash(read uint64) common.Hash {
+	return hashing.SoliditySHA3(hashing.Uint256(new(big.Int).SetUint64(read)))
+}
+
+func testSend(msg inbox.InboxMessage) []byte {
+	return msg.InboxSeqNum.Bytes()
+}
+
+func testLog(msg inbox.InboxMessage) value.Value {
+	return value.NewIntValue(msg.InboxSeqNum)
+}
+
+type testMachine struct {
+	machine.Machine
+	read uint64
+}
+
+func (m *testMachine) Hash() common.Hash {
+	return testMachineHash(m.read)
+}
+
+func (m *testMachine) ExecuteAssertion(maxGas uint64, _ bool, messages []inbox.InboxMessage) (*protocol.ExecutionAssertion, []value.Value, uint64, error) {
+	count := uint64(len(messages))
+	if count > maxGas/testMessageGas {
+		count = maxGas / testMessageGas
+	}
+	assertion := &protocol.ExecutionAssertion{
+		NumGas:                count * testMessageGas,
+		InboxMessagesConsumed: count,
+	}
+	for _, msg := range messages[:count] {
+		assertion.Sends = append(assertion.Sends, testSend(msg))
+		assertion.Logs = append(assertion.Logs, testLog(msg))
+	}
+	m.read += count
+	return assertion, nil, count, nil
+}
+
+type testCursor struct {
+	state core.ExecutionState
+}
+
+func (c *testCursor) Clone() core.ExecutionCursor { return &testCursor{state: c.state} }
+func (c *testCursor) MachineHash() common.Hash    { return c.state.MachineHash }
+func (c *testCursor) TotalMessagesRead() *big.Int { return c.state.TotalMessagesRead }
+func (c *testCursor) InboxAcc() common.Hash       { return c.state.InboxAcc }
+func (c *testCursor) SendAcc() common.Hash        { return c.state.SendAcc }
+func (c *testCursor) LogAcc() common.Hash         { return c.state.LogAcc }
+func (c *testCursor) TotalGasConsumed() *big.Int  { return c.state.TotalGasConsumed }
+func (c *testCursor) TotalSteps() *big.Int        { return c.state.TotalMessagesRead }
+func (c *testCursor) TotalSendCount() *big.Int    { return c.state.TotalSendCount }
+func (c *testCursor) TotalLogCount() *big.Int     { return c.state.TotalLogCount }
+
+// testCore executes test messages with simple accumulators, optionally
+// producing a wrong machine hash once corruptAfter messages were read
+type testCore struct {
+	messages     []inbox.InboxMessage
+	accs         []common.Hash
+	machineRead  uint64
+	corruptAfter uint64
+	stopped      bool
+}
+
+func newTestCore(count int) *testCore {
+	c := &testCore{}
+	c.setMessages(count, 0)
+	return c
+}
+
+func (c *testCore) setMessages(count int, chain byte) {
+	c.messages = nil
+	c.accs = nil
+	var acc common.Hash
+	for i := 0; i < count; i++ {
+		c.messages = append(c.messages, inbox.InboxMessage{InboxSeqNum: big.NewInt(int64(i) + 1)})
+		acc = hashing.SoliditySHA3(hashing.Bytes32(acc), hashing.Uint256(big.NewInt(int64(i))), []byte{chain})
+		c.accs = append(c.accs, acc)
+	}
+}
+
+func (c *testCore) GetMessages(startIndex *big.Int, count *big.Int) ([]inbox.InboxMessage, error) {
+	end := startIndex.Int64() + count.Int64()
+	if end > int64(len(c.messages)) {
+		return nil, errors.New("not enough messages")
+	}
+	return c.messages[startIndex.Int64():end], nil
+}
+
+func (c *testCore) GetInboxAcc(index *big.Int) (common.Hash, error) {
+	if index.Int64() >= int64(len(c.accs)) {
+		return common.Hash{}, errors.New("no inbox acc")
+	}
+	return c.accs[index.Int64()], nil
+}
+
+func (c *testCore) MachineMessagesRead() *big.Int {
+	return new(big.Int).SetUint64(c.machineRead)
+}
+
+func (c *testCore) GetLastMachineTotalGas() (*big.Int, error) {
+	return new(big.Int).SetUint64(c.machineRead * testMessageGas), nil
+}
+
+func (c *testCore) GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error) {
+	read := totalGasUsed.Uint64() / testMessageGas
+	if read > uint64(len(c.messages)) {
+		read = uint64(len(c.messages))
+	}
+	state := core.ExecutionState{
+		MachineHash:       testMachineHash(read),
+		TotalMessagesRead: new(big.Int).SetUint64(read),
+		TotalGasConsumed:  new(big.Int).SetUint64(read * testMessageGas),
+		TotalSendCount:    new(big.Int).SetUint64(read),
+		TotalLogCount:     new(big.Int).SetUint64(read),
+	}
+	if c.corruptAfter > 0 && read > c.corruptAfter {
+		state.MachineHash[0] ^= 1
+	}
+	if read > 0 {
+		state.InboxAcc = c.accs[read-1]
+	}
+	for _, msg := range c.messages[:read] {
+		state.SendAcc = common.Hash(crypto.Keccak256Hash(state.SendAcc.Bytes(), crypto.Keccak256(testSend(msg))))
+		state.LogAcc = common.Hash(crypto.Keccak256Hash(state.LogAcc.Bytes(), testLog(msg).Hash().Bytes()))
+	}
+	return &testCursor{state: state}, nil
+}
+
+func (c *testCore) TakeMachine(executionCursor core.ExecutionCursor) (machine.Machine, error) {
+	return &testMachine{read: executionCursor.TotalMessagesRead().Uint64()}, nil
+}
+
+func (c *testCore) StopThread() {
+	c.stopped = true
+}
+
+func newTestChecker(t *testing.T, c *testCore, maxGas uint64) *Checker {
+	checker, err := NewChecker(c, configuration.CoreConsensusCheck{
+		MaxGas:          maxGas,
+		MessageInterval: 10,
+		PollInterval:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return checker
+}
+
+func checkNext(t *testing.T, checker *Checker, expectChecked bool, expectVerified int64) {
+	t.Helper()
+	checked, err := checker.CheckNext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != expectChecked {
+		t.Fatalf("expected checked to be %v", expectChecked)
+	}
+	if verified := checker.Verified().TotalMessagesRead.Int64(); verified != expectVerified {
+		t.Fatalf("expected %v messages verified but got %v", expectVerified, verified)
+	}
+}
+
+func TestCheckerMatches(t *testing.T) {
+	c := newTestCore(25)
+	checker := newTestChecker(t, c, 1_000_000)
+
+	// Nothing to check until the core has processed a full interval
+	checkNext(t, checker, false, 0)
+	c.machineRead = 9
+	checkNext(t, checker, false, 0)
+	c.machineRead = 25
+	checkNext(t, checker, true, 10)
+	checkNext(t, checker, true, 20)
+	checkNext(t, checker, false, 20)
+	if c.stopped || checker.Failure() != nil {
+		t.Fatal("checker reported mismatch")
+	}
+
+	// Checks are limited by gas as well as messages
+	c = newTestCore(25)
+	checker = newTestChecker(t, c, testMessageGas*4)
+	checkNext(t, checker, false, 0)
+	c.machineRead = 25
+	checkNext(t, checker, true, 4)
+	checkNext(t, checker, true, 8)
+}
+
+func TestCheckerDetectsMismatch(t *testing.T) {
+	c := newTestCore(30)
+	c.corruptAfter = 15
+	checker := newTestChecker(t, c, 1_000_000)
+	checkNext(t, checker, false, 0)
+	c.machineRead = 30
+
+	checkNext(t, checker, true, 10)
+	_, err := checker.CheckNext()
+	var mismatch *MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected mismatch but got %v", err)
+	}
+	if mismatch.Start.TotalMessagesRead.Int64() != 10 || mismatch.Replayed.TotalMessagesRead.Int64() != 20 {
+		t.Fatal("mismatch has wrong range")
+	}
+	if !c.stopped {
+		t.Fatal("core thread wasn't stopped")
+	}
+	if checker.Failure() == nil {
+		t.Fatal("failure not recorded")
+	}
+	if _, err := checker.CheckNext(); err == nil {
+		t.Fatal("checking continued after mismatch")
+	}
+}
+
+func TestCheckerRestartsAfterReorg(t *testing.T) {
+	c := newTestCore(30)
+	checker := newTestChecker(t, c, 1_000_000)
+	checkNext(t, checker, false, 0)
+	c.machineRead = 12
+	checkNext(t, checker, true, 10)
+
+	// Replace the messages that were already checked
+	c.setMessages(30, 1)
+	c.machineRead = 30
+	checked, err := checker.CheckNext()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked || checker.Verified() != nil {
+		t.Fatal("checker didn't restart after reorg")
+	}
+	checkNext(t, checker, false, 30)
+	if c.stopped {
+		t.Fatal("reorg treated as mismatch")
+	}
+}
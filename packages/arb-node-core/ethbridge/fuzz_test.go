@@ -0,0 +1,128 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethbridge
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// Fuzzed integers are encoded as a length byte followed by that many bytes so
+// that both small and full 256 bit values are easy to reach
+func encodeFuzzInts(vals ...int64) []byte {
+	var data []byte
+	for _, val := range vals {
+		valData := big.NewInt(val).Bytes()
+		data = append(data, byte(len(valData)))
+		data = append(data, valData...)
+	}
+	return data
+}
+
+func decodeFuzzInts(data []byte) []*big.Int {
+	var vals []*big.Int
+	for len(data) > 0 {
+		length := int(data[0]) % 33
+		data = data[1:]
+		if length > len(data) {
+			length = len(data)
+		}
+		vals = append(vals, new(big.Int).SetBytes(data[:length]))
+		data = data[length:]
+	}
+	return vals
+}
+
+func FuzzSequencerBatchGetItems(f *testing.F) {
+	// One section of two transactions
+	f.Add([]byte{1, 2, 3}, encodeFuzzInts(3, 0), encodeFuzzInts(2, 10, 100, 0, 0), uint64(5), uint64(7))
+	// One transaction followed by three delayed messages
+	f.Add([]byte{1, 2, 3}, encodeFuzzInts(3), encodeFuzzInts(1, 10, 100, 3, 7), uint64(5), uint64(10))
+	// Two sections, the second reading two delayed messages
+	f.Add([]byte{1, 2, 3}, encodeFuzzInts(1, 2), encodeFuzzInts(1, 10, 100, 0, 0, 1, 11, 101, 2, 7), uint64(0), uint64(5))
+	// Lengths past the end of the transaction data
+	f.Add([]byte{1}, encodeFuzzInts(5), encodeFuzzInts(1, 10, 100, 0, 0), uint64(0), uint64(1))
+	// More items than lengths
+	f.Add([]byte{1}, encodeFuzzInts(1), encodeFuzzInts(2, 10, 100, 0, 0), uint64(0), uint64(2))
+
+	sequencer := common.HexToAddress("0x81183C9C61bdf79DB7330BBcda47Be30c0a85064")
+	f.Fuzz(func(t *testing.T, transactions []byte, lengths []byte, metadata []byte, beforeCount uint64, afterCount uint64) {
+		batch := SequencerBatch{
+			transactionsData:   transactions,
+			transactionLengths: decodeFuzzInts(lengths),
+			sectionsMetadata:   decodeFuzzInts(metadata),
+			BatchIndex:         big.NewInt(0),
+			BeforeCount:        new(big.Int).SetUint64(beforeCount),
+			BeforeAcc:          common.HexToHash("0x01"),
+			AfterCount:         new(big.Int).SetUint64(afterCount),
+			Sequencer:          sequencer,
+		}
+		items, afterAcc, err := batch.getItems()
+		if err != nil {
+			return
+		}
+		batch.AfterAcc = afterAcc
+		checked, err := batch.GetItems()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(items, checked) {
+			t.Fatal("got different items when checking accumulator")
+		}
+		if len(items) == 0 {
+			return
+		}
+
+		// Sequencer messages decode back into the data they were cut from
+		prevSeqNum := new(big.Int).Sub(batch.BeforeCount, big.NewInt(1))
+		var data []byte
+		for _, item := range items {
+			if item.LastSeqNum.Cmp(prevSeqNum) <= 0 {
+				t.Fatalf("item ending at %v follows item ending at %v", item.LastSeqNum, prevSeqNum)
+			}
+			prevSeqNum = item.LastSeqNum
+			if len(item.SequencerMessage) == 0 {
+				continue
+			}
+			msg, err := inbox.NewInboxMessageFromData(item.SequencerMessage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg.ToBytes(), item.SequencerMessage) {
+				t.Fatal("sequencer message reencoded differently")
+			}
+			if msg.InboxSeqNum.Cmp(item.LastSeqNum) != 0 {
+				t.Fatalf("message %v in item ending at %v", msg.InboxSeqNum, item.LastSeqNum)
+			}
+			data = append(data, msg.Data...)
+		}
+		if prevSeqNum.Cmp(new(big.Int).Sub(batch.AfterCount, big.NewInt(1))) != 0 {
+			t.Fatalf("items end at %v but batch ends at %v", prevSeqNum, batch.AfterCount)
+		}
+		if !bytes.HasPrefix(transactions, data) {
+			t.Fatalf("items contain data %x not from batch %x", data, transactions)
+		}
+	})
+}
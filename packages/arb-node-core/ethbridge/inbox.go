@@ -187,6 +187,7 @@ func AddSequencerL2BatchFromOriginCustomNonce(
 	gasRefunderExtraGas uint64,
 ) (*arbtransaction.ArbTransaction, error) {
 	rawAuth := auth.GetAuth(ctx)
+	transactauth.ReleaseNonce(auth, rawAuth)
 	arbTx, err := transactauth.MakeTxCustomNonce(ctx, auth, func(auth *bind.TransactOpts) (*types.Transaction, error) {
 		if gasRefunder != (ethcommon.Address{}) {
 			tx, err := inbox.AddSequencerL2BatchFromOriginWithGasRefunder(auth, transactions, lengths, sectionsMetadata, afterAcc, gasRefunder)
@@ -91,6 +91,8 @@ type SequencerBatchRef interface {
 	GetBeforeAcc() common.Hash
 	GetAfterCount() *big.Int
 	GetAfterAcc() common.Hash
+	// GetBlock returns the L1 block the batch was delivered in
+	GetBlock() *common.BlockId
 }
 
 func (r *SequencerInboxWatcher) LookupBatchesInRange(ctx context.Context, from, to *big.Int) ([]SequencerBatchRef, error) {
@@ -122,6 +124,7 @@ type SequencerBatch struct {
 	AfterAcc           common.Hash
 	DelayedAcc         common.Hash
 	Sequencer          common.Address
+	Block              *common.BlockId
 }
 
 func (b SequencerBatch) GetBatchIndex() *big.Int {
@@ -144,6 +147,10 @@ func (b SequencerBatch) GetAfterAcc() common.Hash {
 	return b.AfterAcc
 }
 
+func (b SequencerBatch) GetBlock() *common.BlockId {
+	return b.Block
+}
+
 type sectionMetadata struct {
 	numItems                *big.Int
 	chainTime               inbox.ChainTime
@@ -152,6 +159,19 @@ type sectionMetadata struct {
 }
 
 func (b SequencerBatch) GetItems() ([]inbox.SequencerBatchItem, error) {
+	items, afterAcc, err := b.getItems()
+	if err != nil {
+		return nil, err
+	}
+	if !afterAcc.Equals(b.AfterAcc) {
+		return nil, errors.New("computed unexpected batch end accumulator")
+	}
+	return items, nil
+}
+
+// getItems splits the batch into items, returning them along with the
+// accumulator after the last one
+func (b SequencerBatch) getItems() ([]inbox.SequencerBatchItem, common.Hash, error) {
 	sectionsMetadata := make([]sectionMetadata, 0, len(b.sectionsMetadata)/5)
 	for i := 0; i+5 <= len(b.sectionsMetadata); i += 5 {
 		chainTime := inbox.ChainTime{
@@ -169,7 +189,8 @@ func (b SequencerBatch) GetItems() ([]inbox.SequencerBatchItem, error) {
 	}
 	if len(sectionsMetadata) == 0 {
 		logger.Warn().Msg("encountered sequencer batch with no batch items")
-		return []inbox.SequencerBatchItem{}, nil
+		// There's nothing to check the end accumulator against
+		return []inbox.SequencerBatchItem{}, b.AfterAcc, nil
 	}
 	unaccountedTransactions := new(big.Int).Sub(b.AfterCount, b.BeforeCount)
 	// Iterate backwards through all but the first section metadata
@@ -192,7 +213,7 @@ func (b SequencerBatch) GetItems() ([]inbox.SequencerBatchItem, error) {
 		// Account for the end-of-block message
 		unaccountedTransactions.Sub(unaccountedTransactions, big.NewInt(1))
 	} else if unaccountedTransactions.Sign() < 0 {
-		return nil, errors.New("found a negative amount of unaccounted transactions")
+		return nil, common.Hash{}, errors.New("found a negative amount of unaccounted transactions")
 	}
 	// Any remaining unaccounted transactions are delayed messages in the first batch
 	runningTotalDelayedMessages := new(big.Int).Sub(firstSectionMeta.newTotalDelayedMessages, unaccountedTransactions)
@@ -203,9 +224,16 @@ func (b SequencerBatch) GetItems() ([]inbox.SequencerBatchItem, error) {
 	dataOffset := 0
 	lengthsOffset := 0
 	for _, meta := range sectionsMetadata {
-		for j := 0; int64(j) < meta.numItems.Int64(); j++ {
+		if !meta.numItems.IsUint64() || meta.numItems.Uint64() > uint64(len(b.transactionLengths)-lengthsOffset) {
+			return nil, common.Hash{}, errors.New("batch section has more items than transaction lengths")
+		}
+		for j := uint64(0); j < meta.numItems.Uint64(); j++ {
 			// Sequencer batch items
-			length := int(b.transactionLengths[lengthsOffset].Int64())
+			rawLength := b.transactionLengths[lengthsOffset]
+			if !rawLength.IsUint64() || rawLength.Uint64() > uint64(len(b.transactionsData)-dataOffset) {
+				return nil, common.Hash{}, errors.New("batch item is longer than remaining transaction data")
+			}
+			length := int(rawLength.Uint64())
 			lengthsOffset += 1
 			messageKind := message.L2Type
 			if length == 0 {
@@ -253,18 +281,15 @@ func (b SequencerBatch) GetItems() ([]inbox.SequencerBatchItem, error) {
 	}
 
 	if nextSeqNum.Cmp(b.AfterCount) != 0 {
-		return nil, errors.New("computed unexpected batch end count")
+		return nil, common.Hash{}, errors.New("computed unexpected batch end count")
 	}
 
-	if !lastAcc.Equals(b.AfterAcc) {
-		return nil, errors.New("computed unexpected batch end accumulator")
-	}
-
-	return ret, nil
+	return ret, lastAcc, nil
 }
 
 type sequencerBatchOriginRef struct {
 	blockHash   ethcommon.Hash
+	blockNumber uint64
 	txIndex     uint
 	batchIndex  *big.Int
 	beforeCount *big.Int
@@ -294,6 +319,20 @@ func (b sequencerBatchOriginRef) GetAfterAcc() common.Hash {
 	return b.afterAcc
 }
 
+func (b sequencerBatchOriginRef) GetBlock() *common.BlockId {
+	return &common.BlockId{
+		Height:     common.NewTimeBlocksInt(int64(b.blockNumber)),
+		HeaderHash: common.NewHashFromEth(b.blockHash),
+	}
+}
+
+func logBlock(log types.Log) *common.BlockId {
+	return &common.BlockId{
+		Height:     common.NewTimeBlocksInt(int64(log.BlockNumber)),
+		HeaderHash: common.NewHashFromEth(log.BlockHash),
+	}
+}
+
 func (r *SequencerInboxWatcher) logsToBatchRefs(ctx context.Context, logs []types.Log) ([]SequencerBatchRef, error) {
 	if len(logs) == 0 {
 		return nil, nil
@@ -316,6 +355,7 @@ func (r *SequencerInboxWatcher) logsToBatchRefs(ctx context.Context, logs []type
 				AfterCount:         parsed.NewMessageCount,
 				AfterAcc:           parsed.AfterAcc,
 				Sequencer:          common.NewAddressFromEth(parsed.Sequencer),
+				Block:              logBlock(log),
 			})
 		} else if log.Topics[0] == sequencerBatchDeliveredFromOriginID {
 			parsed, err := r.con.ParseSequencerBatchDeliveredFromOrigin(log)
@@ -324,6 +364,7 @@ func (r *SequencerInboxWatcher) logsToBatchRefs(ctx context.Context, logs []type
 			}
 			refs = append(refs, sequencerBatchOriginRef{
 				blockHash:   log.BlockHash,
+				blockNumber: log.BlockNumber,
 				txIndex:     log.TxIndex,
 				batchIndex:  parsed.SeqBatchIndex,
 				beforeCount: parsed.FirstMessageNum,
@@ -351,6 +392,7 @@ func (r *SequencerInboxWatcher) logsToBatchRefs(ctx context.Context, logs []type
 				BeforeAcc:        parsed.BeforeAcc,
 				AfterCount:       parsed.NewMessageCount,
 				AfterAcc:         parsed.AfterAccAndDelayed[0],
+				Block:            logBlock(log),
 			})
 		} else {
 			return nil, errors.Errorf("Unexpected log topic %v", log.Topics[0].String())
@@ -390,9 +432,22 @@ func (r *SequencerInboxWatcher) ResolveBatchRef(ctx context.Context, genericRef
 		AfterAcc:           ref.afterAcc,
 		DelayedAcc:         ref.delayedAcc,
 		Sequencer:          common.NewAddressFromEth(sender),
+		Block:              ref.GetBlock(),
 	}, nil
 }
 
 func (r *SequencerInboxWatcher) GetMaxDelayBlocks(ctx context.Context) (*big.Int, error) {
 	return r.con.MaxDelayBlocks(&bind.CallOpts{Context: ctx})
 }
+
+// GetBatchCount returns the number of batches posted to the sequencer inbox
+func (r *SequencerInboxWatcher) GetBatchCount(ctx context.Context) (*big.Int, error) {
+	count, err := r.con.GetInboxAccsLength(&bind.CallOpts{Context: ctx})
+	return count, errors.WithStack(err)
+}
+
+// GetBatchAccumulator returns the inbox accumulator after the given batch
+func (r *SequencerInboxWatcher) GetBatchAccumulator(ctx context.Context, batchIndex *big.Int) (common.Hash, error) {
+	acc, err := r.con.InboxAccs(&bind.CallOpts{Context: ctx}, batchIndex)
+	return acc, errors.WithStack(err)
+}
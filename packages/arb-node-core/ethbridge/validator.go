@@ -199,7 +199,7 @@ func CreateValidatorWallet(
 		return ethcommon.Address{}, err
 	}
 
-	simulatedBackend, ok := client.(*ethutils.SimulatedEthClient)
+	simulatedBackend, ok := client.(ethutils.SimulatedClient)
 	if ok {
 		simulatedBackend.Commit()
 	}
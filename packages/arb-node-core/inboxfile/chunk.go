@@ -0,0 +1,255 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inboxfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// A chunk file starts with chunkMagic followed by a sequence of records. Each
+// record is a type byte, a big endian uint32 length and the record data, which
+// is the ToBytesWithSeqNum encoding of the delayed message or batch item.
+// Delayed messages come before the batch items that sequence them.
+const chunkMagic = "ARBINBOX\x01"
+
+const (
+	recordDelayedMessage byte = iota
+	recordBatchItem
+)
+
+func chunkName(index int) string {
+	return fmt.Sprintf("inbox-%08d.chunk", index)
+}
+
+func encodeChunk(delayed []inbox.DelayedMessage, items []inbox.SequencerBatchItem) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(chunkMagic)
+	writeRecord := func(kind byte, data []byte) {
+		var header [5]byte
+		header[0] = kind
+		binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+		buf.Write(header[:])
+		buf.Write(data)
+	}
+	for _, msg := range delayed {
+		writeRecord(recordDelayedMessage, msg.ToBytesWithSeqNum())
+	}
+	for _, item := range items {
+		writeRecord(recordBatchItem, item.ToBytesWithSeqNum())
+	}
+	return buf.Bytes()
+}
+
+func decodeChunk(data []byte) ([]inbox.DelayedMessage, []inbox.SequencerBatchItem, error) {
+	if !bytes.HasPrefix(data, []byte(chunkMagic)) {
+		return nil, nil, errors.New("not an inbox chunk")
+	}
+	data = data[len(chunkMagic):]
+	var delayed []inbox.DelayedMessage
+	var items []inbox.SequencerBatchItem
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, nil, errors.New("truncated chunk record")
+		}
+		kind := data[0]
+		length := binary.BigEndian.Uint32(data[1:5])
+		data = data[5:]
+		if uint64(len(data)) < uint64(length) {
+			return nil, nil, errors.New("truncated chunk record")
+		}
+		record := data[:length]
+		data = data[length:]
+		switch kind {
+		case recordDelayedMessage:
+			if len(items) > 0 {
+				return nil, nil, errors.New("delayed message after batch items in chunk")
+			}
+			msg, err := newDelayedMessageFromData(record)
+			if err != nil {
+				return nil, nil, err
+			}
+			delayed = append(delayed, msg)
+		case recordBatchItem:
+			item, err := inbox.NewSequencerBatchItemFromData(record)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		default:
+			return nil, nil, errors.Errorf("unknown chunk record type %v", kind)
+		}
+	}
+	return delayed, items, nil
+}
+
+func newDelayedMessageFromData(data []byte) (inbox.DelayedMessage, error) {
+	if len(data) < 32*2 {
+		return inbox.DelayedMessage{}, errors.New("Not enough data for delayed message")
+	}
+	msg := inbox.DelayedMessage{}
+	msg.DelayedSequenceNumber = new(big.Int).SetBytes(data[:32])
+	copy(msg.DelayedAccumulator[:], data[32:64])
+	msg.Message = data[64:]
+	return msg, nil
+}
+
+func writeChunk(dir string, c *Chunk, delayed []inbox.DelayedMessage, items []inbox.SequencerBatchItem) error {
+	data := encodeChunk(delayed, items)
+	if err := ioutil.WriteFile(filepath.Join(dir, c.Name), data, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	c.Size = int64(len(data))
+	c.SHA256 = common.Hash(sha256.Sum256(data))
+	c.ItemCount = len(items)
+	c.DelayedCount = len(delayed)
+	return nil
+}
+
+func readChunk(dir string, c Chunk) ([]inbox.DelayedMessage, []inbox.SequencerBatchItem, error) {
+	if filepath.Base(c.Name) != c.Name {
+		return nil, nil, errors.Errorf("invalid chunk name %v", c.Name)
+	}
+	f, err := os.Open(filepath.Join(dir, c.Name))
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer f.Close()
+	// Read one byte past the expected size so that a longer file is caught
+	data, err := ioutil.ReadAll(io.LimitReader(f, c.Size+1))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading %v", c.Name)
+	}
+	if int64(len(data)) != c.Size {
+		return nil, nil, errors.Errorf("%v has size %v but manifest has %v", c.Name, len(data), c.Size)
+	}
+	if common.Hash(sha256.Sum256(data)) != c.SHA256 {
+		return nil, nil, errors.Errorf("%v doesn't match its checksum", c.Name)
+	}
+	delayed, items, err := decodeChunk(data)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error decoding %v", c.Name)
+	}
+	if len(delayed) != c.DelayedCount || len(items) != c.ItemCount {
+		return nil, nil, errors.Errorf("%v doesn't have the number of entries listed in the manifest", c.Name)
+	}
+	return delayed, items, nil
+}
+
+// verifyChunk recomputes the accumulators of the chunk's delayed messages and
+// batch items starting from the state the manifest says it builds on.
+// delayedAcc looks up delayed accumulators from before the chunk.
+func verifyChunk(c Chunk, delayed []inbox.DelayedMessage, items []inbox.SequencerBatchItem, delayedAcc func(*big.Int) (common.Hash, error)) error {
+	if len(items) == 0 {
+		return errors.New("chunk has no batch items")
+	}
+
+	// Delayed accumulators computed from this chunk, keyed by index
+	chunkDelayedAccs := make(map[string]common.Hash)
+	lookupDelayedAcc := func(index *big.Int) (common.Hash, error) {
+		if acc, ok := chunkDelayedAccs[index.String()]; ok {
+			return acc, nil
+		}
+		if index.Sign() < 0 {
+			return common.Hash{}, nil
+		}
+		return delayedAcc(index)
+	}
+
+	expectedDelayed := new(big.Int).Sub(c.TotalDelayedCount, c.PrevTotalDelayedCount)
+	if expectedDelayed.Cmp(big.NewInt(int64(len(delayed)))) != 0 {
+		return errors.Errorf("chunk sequences %v delayed messages but contains %v", expectedDelayed, len(delayed))
+	}
+	nextIndex := c.PrevTotalDelayedCount
+	for _, msg := range delayed {
+		if msg.DelayedSequenceNumber.Cmp(nextIndex) != 0 {
+			return errors.Errorf("expected delayed message %v but got %v", nextIndex, msg.DelayedSequenceNumber)
+		}
+		prevAcc, err := lookupDelayedAcc(new(big.Int).Sub(nextIndex, big.NewInt(1)))
+		if err != nil {
+			return errors.Wrapf(err, "error looking up delayed accumulator before %v", nextIndex)
+		}
+		inboxMsg, err := inbox.NewInboxMessageFromData(msg.Message)
+		if err != nil {
+			return errors.Wrapf(err, "error decoding delayed message %v", nextIndex)
+		}
+		expected := inbox.NewDelayedMessage(prevAcc, inboxMsg)
+		if expected.DelayedSequenceNumber.Cmp(nextIndex) != 0 || expected.DelayedAccumulator != msg.DelayedAccumulator ||
+			!bytes.Equal(expected.Message, msg.Message) {
+			return errors.Errorf("delayed message %v doesn't match its accumulator", nextIndex)
+		}
+		chunkDelayedAccs[nextIndex.String()] = msg.DelayedAccumulator
+		nextIndex = new(big.Int).Add(nextIndex, big.NewInt(1))
+	}
+
+	prevCount := c.PrevMessageCount
+	prevAcc := c.PrevAcc
+	prevDelayedCount := c.PrevTotalDelayedCount
+	for _, item := range items {
+		var expected inbox.SequencerBatchItem
+		if len(item.SequencerMessage) > 0 {
+			msg, err := inbox.NewInboxMessageFromData(item.SequencerMessage)
+			if err != nil {
+				return errors.Wrapf(err, "error decoding sequencer message %v", item.LastSeqNum)
+			}
+			if msg.InboxSeqNum.Cmp(prevCount) != 0 {
+				return errors.Errorf("expected sequencer message %v but got %v", prevCount, msg.InboxSeqNum)
+			}
+			expected = inbox.NewSequencerItem(item.TotalDelayedCount, msg, prevAcc)
+			if item.TotalDelayedCount.Cmp(prevDelayedCount) != 0 {
+				return errors.Errorf("sequencer message %v also sequences delayed messages", item.LastSeqNum)
+			}
+		} else {
+			delayedCount := new(big.Int).Sub(item.TotalDelayedCount, prevDelayedCount)
+			if delayedCount.Sign() <= 0 {
+				return errors.Errorf("batch item %v has no messages", item.LastSeqNum)
+			}
+			expectedLast := new(big.Int).Add(prevCount, delayedCount)
+			expectedLast = expectedLast.Sub(expectedLast, big.NewInt(1))
+			if item.LastSeqNum.Cmp(expectedLast) != 0 {
+				return errors.Errorf("expected delayed batch item to end at %v but got %v", expectedLast, item.LastSeqNum)
+			}
+			acc, err := lookupDelayedAcc(new(big.Int).Sub(item.TotalDelayedCount, big.NewInt(1)))
+			if err != nil {
+				return errors.Wrapf(err, "error looking up delayed accumulator for batch item %v", item.LastSeqNum)
+			}
+			expected = inbox.NewDelayedItem(item.LastSeqNum, item.TotalDelayedCount, prevAcc, prevDelayedCount, acc)
+		}
+		if expected.Accumulator != item.Accumulator {
+			return errors.Errorf("batch item %v doesn't match its accumulator", item.LastSeqNum)
+		}
+		prevCount = new(big.Int).Add(item.LastSeqNum, big.NewInt(1))
+		prevAcc = item.Accumulator
+		prevDelayedCount = item.TotalDelayedCount
+	}
+	if prevCount.Cmp(c.MessageCount) != 0 || prevAcc != c.Acc || prevDelayedCount.Cmp(c.TotalDelayedCount) != 0 {
+		return errors.New("chunk doesn't end at the state listed in the manifest")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inboxfile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+const DefaultItemsPerChunk = 10000
+
+// Export writes the inbox messages in db starting at fromMessage to dir,
+// splitting them into chunks of at most itemsPerChunk batch items.
+// fromMessage must be zero or the end of a batch item. Delayed messages that
+// haven't been sequenced yet aren't included.
+func Export(db ExportDatabase, dir string, fromMessage *big.Int, itemsPerChunk int) (*Manifest, error) {
+	if itemsPerChunk <= 0 {
+		return nil, errors.New("items per chunk must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestName)); err == nil {
+		return nil, errors.Errorf("%v already contains an inbox export", dir)
+	}
+
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return nil, err
+	}
+	if fromMessage.Cmp(messageCount) >= 0 {
+		return nil, errors.Errorf("database only has %v messages", messageCount)
+	}
+
+	prevCount := big.NewInt(0)
+	var prevAcc common.Hash
+	prevDelayedCount := big.NewInt(0)
+	var items []inbox.SequencerBatchItem
+	if fromMessage.Sign() == 0 {
+		items, err = db.GetSequencerBatchItems(fromMessage)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Load the item before the export to find the state it builds on
+		items, err = db.GetSequencerBatchItems(new(big.Int).Sub(fromMessage, big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 || new(big.Int).Add(items[0].LastSeqNum, big.NewInt(1)).Cmp(fromMessage) != 0 {
+			return nil, errors.Errorf("message %v isn't the start of a batch item", fromMessage)
+		}
+		prevCount = fromMessage
+		prevAcc = items[0].Accumulator
+		prevDelayedCount = items[0].TotalDelayedCount
+		items = items[1:]
+	}
+	// Ignore anything added since the message count was read
+	for i, item := range items {
+		if item.LastSeqNum.Cmp(messageCount) >= 0 {
+			items = items[:i]
+			break
+		}
+	}
+
+	m := &Manifest{Version: ManifestVersion}
+	for len(items) > 0 {
+		chunkItems := items
+		if len(chunkItems) > itemsPerChunk {
+			chunkItems = chunkItems[:itemsPerChunk]
+		}
+		items = items[len(chunkItems):]
+
+		last := chunkItems[len(chunkItems)-1]
+		c := Chunk{
+			Name:                  chunkName(len(m.Chunks)),
+			PrevMessageCount:      prevCount,
+			PrevAcc:               prevAcc,
+			MessageCount:          new(big.Int).Add(last.LastSeqNum, big.NewInt(1)),
+			Acc:                   last.Accumulator,
+			PrevTotalDelayedCount: prevDelayedCount,
+			TotalDelayedCount:     last.TotalDelayedCount,
+		}
+		delayed, err := exportDelayedMessages(db, prevDelayedCount, chunkItems)
+		if err != nil {
+			return nil, err
+		}
+		// Check the export against the database before writing it out
+		if err := verifyChunk(c, delayed, chunkItems, db.GetDelayedInboxAcc); err != nil {
+			return nil, errors.Wrapf(err, "error verifying %v", c.Name)
+		}
+		if err := writeChunk(dir, &c, delayed, chunkItems); err != nil {
+			return nil, err
+		}
+		logger.Info().
+			Str("chunk", c.Name).
+			Str("messageCount", c.MessageCount.String()).
+			Int("delayed", c.DelayedCount).
+			Msg("exported inbox chunk")
+		m.Chunks = append(m.Chunks, c)
+
+		prevCount = c.MessageCount
+		prevAcc = c.Acc
+		prevDelayedCount = c.TotalDelayedCount
+	}
+
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestName), manifestData, 0644); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+// exportDelayedMessages loads the delayed messages sequenced by items, which
+// the core returns as inbox messages at the position they were sequenced in
+func exportDelayedMessages(db ExportDatabase, prevDelayedCount *big.Int, items []inbox.SequencerBatchItem) ([]inbox.DelayedMessage, error) {
+	var delayedAcc common.Hash
+	if prevDelayedCount.Sign() > 0 {
+		var err error
+		delayedAcc, err = db.GetDelayedInboxAcc(new(big.Int).Sub(prevDelayedCount, big.NewInt(1)))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var delayed []inbox.DelayedMessage
+	for _, item := range items {
+		count := new(big.Int).Sub(item.TotalDelayedCount, prevDelayedCount)
+		if len(item.SequencerMessage) == 0 && count.Sign() > 0 {
+			firstSeqNum := new(big.Int).Add(item.LastSeqNum, big.NewInt(1))
+			firstSeqNum = firstSeqNum.Sub(firstSeqNum, count)
+			msgs, err := db.GetMessages(firstSeqNum, count)
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(msgs)) != count.Int64() {
+				return nil, errors.Errorf("expected %v delayed messages at %v but got %v", count, firstSeqNum, len(msgs))
+			}
+			for _, msg := range msgs {
+				delayedMsg := inbox.NewDelayedMessage(delayedAcc, msg)
+				delayed = append(delayed, delayedMsg)
+				delayedAcc = delayedMsg.DelayedAccumulator
+			}
+		}
+		prevDelayedCount = item.TotalDelayedCount
+	}
+	return delayed, nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inboxfile
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+)
+
+// LoadManifest reads the manifest of the export in dir and checks that its
+// chunks form a contiguous inbox
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading inbox manifest")
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "error reading inbox manifest")
+	}
+	if m.Version != ManifestVersion {
+		return nil, errors.Errorf("unsupported inbox export version %v", m.Version)
+	}
+	for i := 1; i < len(m.Chunks); i++ {
+		prev := m.Chunks[i-1]
+		c := m.Chunks[i]
+		if c.PrevMessageCount.Cmp(prev.MessageCount) != 0 || c.PrevAcc != prev.Acc ||
+			c.PrevTotalDelayedCount.Cmp(prev.TotalDelayedCount) != 0 {
+			return nil, errors.Errorf("%v doesn't continue from %v", c.Name, prev.Name)
+		}
+	}
+	return &m, nil
+}
+
+// Import delivers the export in dir to db one chunk at a time, checking every
+// accumulator along the way. Chunks already in the database are skipped so
+// that an interrupted import can be resumed. The export must start at or
+// before the end of the database's inbox.
+func Import(ctx context.Context, db ImportDatabase, dir string) (*Manifest, error) {
+	m, err := LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range m.Chunks {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		imported, err := importChunk(db, dir, c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error importing %v", c.Name)
+		}
+		if imported {
+			logger.Info().
+				Str("chunk", c.Name).
+				Str("messageCount", c.MessageCount.String()).
+				Int("delayed", c.DelayedCount).
+				Msg("imported inbox chunk")
+		}
+	}
+	return m, nil
+}
+
+func importChunk(db ImportDatabase, dir string, c Chunk) (bool, error) {
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return false, err
+	}
+	if c.MessageCount.Cmp(messageCount) <= 0 {
+		if err := checkInboxAcc(db, c.MessageCount, c.Acc); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	if c.PrevMessageCount.Cmp(messageCount) > 0 {
+		return false, errors.Errorf("chunk starts at message %v but database only has %v", c.PrevMessageCount, messageCount)
+	}
+	if err := checkInboxAcc(db, c.PrevMessageCount, c.PrevAcc); err != nil {
+		return false, err
+	}
+
+	delayed, items, err := readChunk(dir, c)
+	if err != nil {
+		return false, err
+	}
+	if err := verifyChunk(c, delayed, items, db.GetDelayedInboxAcc); err != nil {
+		return false, err
+	}
+	err = core.DeliverMessagesAndWait(db, c.PrevMessageCount, c.PrevAcc, items, delayed, nil)
+	if err != nil {
+		return false, err
+	}
+	return true, checkInboxAcc(db, c.MessageCount, c.Acc)
+}
+
+// checkInboxAcc makes sure that the database's accumulator after count
+// messages is acc
+func checkInboxAcc(db ImportDatabase, count *big.Int, acc common.Hash) error {
+	if count.Sign() == 0 {
+		return nil
+	}
+	dbAcc, err := db.GetInboxAcc(new(big.Int).Sub(count, big.NewInt(1)))
+	if err != nil {
+		return err
+	}
+	if dbAcc != acc {
+		return errors.Errorf("database accumulator %v after %v messages doesn't match export %v", dbAcc, count, acc)
+	}
+	return nil
+}
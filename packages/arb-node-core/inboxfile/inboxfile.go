@@ -0,0 +1,158 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package inboxfile moves raw inbox data between nodes without going through
+// L1. An export is a directory holding a manifest and a series of checksummed
+// chunk files, each containing sequencer batch items along with the delayed
+// messages they sequence. Importing recomputes every accumulator before
+// delivering the chunk to the core.
+package inboxfile
+
+import (
+	"encoding/json"
+	"math/big"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "inboxfile").Logger()
+
+const ManifestVersion = 1
+
+const ManifestName = "manifest.json"
+
+// ExportDatabase is the subset of ArbCore needed to export the inbox
+type ExportDatabase interface {
+	GetMessageCount() (*big.Int, error)
+	GetMessages(startIndex, count *big.Int) ([]inbox.InboxMessage, error)
+	GetSequencerBatchItems(startIndex *big.Int) ([]inbox.SequencerBatchItem, error)
+	GetDelayedInboxAcc(index *big.Int) (common.Hash, error)
+}
+
+// ImportDatabase is the subset of ArbCore needed to import the inbox
+type ImportDatabase interface {
+	core.ArbCoreInbox
+	GetMessageCount() (*big.Int, error)
+	GetInboxAcc(index *big.Int) (common.Hash, error)
+	GetDelayedMessageCount() (*big.Int, error)
+	GetDelayedInboxAcc(index *big.Int) (common.Hash, error)
+}
+
+// Chunk describes one chunk file. The Prev fields give the inbox state the
+// chunk builds on and the others the state after it's delivered.
+type Chunk struct {
+	Name   string
+	Size   int64
+	SHA256 common.Hash
+
+	ItemCount    int
+	DelayedCount int
+
+	PrevMessageCount *big.Int
+	PrevAcc          common.Hash
+	MessageCount     *big.Int
+	Acc              common.Hash
+
+	PrevTotalDelayedCount *big.Int
+	TotalDelayedCount     *big.Int
+}
+
+type Manifest struct {
+	Version int
+	Chunks  []Chunk
+}
+
+type chunkJSON struct {
+	Name                  string         `json:"name"`
+	Size                  int64          `json:"size"`
+	SHA256                ethcommon.Hash `json:"sha256"`
+	ItemCount             int            `json:"itemCount"`
+	DelayedCount          int            `json:"delayedCount"`
+	PrevMessageCount      *big.Int       `json:"prevMessageCount"`
+	PrevAcc               ethcommon.Hash `json:"prevAcc"`
+	MessageCount          *big.Int       `json:"messageCount"`
+	Acc                   ethcommon.Hash `json:"acc"`
+	PrevTotalDelayedCount *big.Int       `json:"prevTotalDelayedCount"`
+	TotalDelayedCount     *big.Int       `json:"totalDelayedCount"`
+}
+
+type manifestJSON struct {
+	Version int         `json:"version"`
+	Chunks  []chunkJSON `json:"chunks"`
+}
+
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	chunks := make([]chunkJSON, 0, len(m.Chunks))
+	for _, c := range m.Chunks {
+		chunks = append(chunks, chunkJSON{
+			Name:                  c.Name,
+			Size:                  c.Size,
+			SHA256:                c.SHA256.ToEthHash(),
+			ItemCount:             c.ItemCount,
+			DelayedCount:          c.DelayedCount,
+			PrevMessageCount:      c.PrevMessageCount,
+			PrevAcc:               c.PrevAcc.ToEthHash(),
+			MessageCount:          c.MessageCount,
+			Acc:                   c.Acc.ToEthHash(),
+			PrevTotalDelayedCount: c.PrevTotalDelayedCount,
+			TotalDelayedCount:     c.TotalDelayedCount,
+		})
+	}
+	return json.Marshal(manifestJSON{Version: m.Version, Chunks: chunks})
+}
+
+func (m *Manifest) UnmarshalJSON(data []byte) error {
+	var raw manifestJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	chunks := make([]Chunk, 0, len(raw.Chunks))
+	for _, c := range raw.Chunks {
+		if c.PrevMessageCount == nil || c.MessageCount == nil ||
+			c.PrevTotalDelayedCount == nil || c.TotalDelayedCount == nil {
+			return errors.Errorf("inbox manifest entry %v is missing fields", c.Name)
+		}
+		chunks = append(chunks, Chunk{
+			Name:                  c.Name,
+			Size:                  c.Size,
+			SHA256:                common.NewHashFromEth(c.SHA256),
+			ItemCount:             c.ItemCount,
+			DelayedCount:          c.DelayedCount,
+			PrevMessageCount:      c.PrevMessageCount,
+			PrevAcc:               common.NewHashFromEth(c.PrevAcc),
+			MessageCount:          c.MessageCount,
+			Acc:                   common.NewHashFromEth(c.Acc),
+			PrevTotalDelayedCount: c.PrevTotalDelayedCount,
+			TotalDelayedCount:     c.TotalDelayedCount,
+		})
+	}
+	*m = Manifest{Version: raw.Version, Chunks: chunks}
+	return nil
+}
+
+// MessageCount is the inbox message count after importing every chunk
+func (m *Manifest) MessageCount() *big.Int {
+	if len(m.Chunks) == 0 {
+		return big.NewInt(0)
+	}
+	return m.Chunks[len(m.Chunks)-1].MessageCount
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inboxfile
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+// testCore keeps an inbox in memory, returning delayed messages from
+// GetMessages with their delayed sequence numbers like ArbCore does
+type testCore struct {
+	items    []inbox.SequencerBatchItem
+	messages []inbox.InboxMessage
+	delayed  []inbox.DelayedMessage
+}
+
+func randomMessage(seqNum int) inbox.InboxMessage {
+	msg := inbox.NewRandomInboxMessage()
+	msg.Kind = 3
+	msg.InboxSeqNum = big.NewInt(int64(seqNum))
+	return msg
+}
+
+// newTestCore creates an inbox of itemCount batch items, some of which
+// sequence delayed messages, followed by a couple of unsequenced delayed
+// messages
+func newTestCore(itemCount int) *testCore {
+	c := &testCore{}
+	addDelayed := func() {
+		var prevAcc common.Hash
+		if len(c.delayed) > 0 {
+			prevAcc = c.delayed[len(c.delayed)-1].DelayedAccumulator
+		}
+		c.delayed = append(c.delayed, inbox.NewDelayedMessage(prevAcc, randomMessage(len(c.delayed))))
+	}
+	totalDelayed := 0
+	for i := 0; i < itemCount; i++ {
+		var prevAcc common.Hash
+		if len(c.items) > 0 {
+			prevAcc = c.items[len(c.items)-1].Accumulator
+		}
+		if i%4 == 3 {
+			prevDelayed := totalDelayed
+			for j := 0; j < i%3+1; j++ {
+				addDelayed()
+				msg, _ := inbox.NewInboxMessageFromData(c.delayed[totalDelayed].Message)
+				c.messages = append(c.messages, msg)
+				totalDelayed++
+			}
+			c.items = append(c.items, inbox.NewDelayedItem(
+				big.NewInt(int64(len(c.messages)-1)),
+				big.NewInt(int64(totalDelayed)),
+				prevAcc,
+				big.NewInt(int64(prevDelayed)),
+				c.delayed[totalDelayed-1].DelayedAccumulator,
+			))
+		} else {
+			msg := randomMessage(len(c.messages))
+			c.messages = append(c.messages, msg)
+			c.items = append(c.items, inbox.NewSequencerItem(big.NewInt(int64(totalDelayed)), msg, prevAcc))
+		}
+	}
+	addDelayed()
+	addDelayed()
+	return c
+}
+
+func (c *testCore) GetMessageCount() (*big.Int, error) {
+	return big.NewInt(int64(len(c.messages))), nil
+}
+
+func (c *testCore) GetMessages(startIndex, count *big.Int) ([]inbox.InboxMessage, error) {
+	end := startIndex.Int64() + count.Int64()
+	if end > int64(len(c.messages)) {
+		return nil, errors.New("failed to get messages")
+	}
+	return c.messages[startIndex.Int64():end], nil
+}
+
+func (c *testCore) GetSequencerBatchItems(startIndex *big.Int) ([]inbox.SequencerBatchItem, error) {
+	for i, item := range c.items {
+		if item.LastSeqNum.Cmp(startIndex) >= 0 {
+			return c.items[i:], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *testCore) GetInboxAcc(index *big.Int) (common.Hash, error) {
+	items, _ := c.GetSequencerBatchItems(index)
+	if len(items) == 0 {
+		return common.Hash{}, errors.New("failed to get inbox acc")
+	}
+	return items[0].Accumulator, nil
+}
+
+func (c *testCore) GetDelayedMessageCount() (*big.Int, error) {
+	return big.NewInt(int64(len(c.delayed))), nil
+}
+
+func (c *testCore) GetDelayedInboxAcc(index *big.Int) (common.Hash, error) {
+	if index.Int64() >= int64(len(c.delayed)) {
+		return common.Hash{}, errors.New("failed to get delayed inbox acc")
+	}
+	return c.delayed[index.Int64()].DelayedAccumulator, nil
+}
+
+func (c *testCore) DeliverMessages(previousMessageCount *big.Int, previousSeqBatchAcc common.Hash, seqBatchItems []inbox.SequencerBatchItem, delayedMessages []inbox.DelayedMessage, _ *big.Int) bool {
+	for _, msg := range delayedMessages {
+		index := msg.DelayedSequenceNumber.Int64()
+		if index < int64(len(c.delayed)) {
+			if c.delayed[index].DelayedAccumulator != msg.DelayedAccumulator {
+				return false
+			}
+			continue
+		}
+		if index != int64(len(c.delayed)) {
+			return false
+		}
+		c.delayed = append(c.delayed, msg)
+	}
+	if previousMessageCount.Sign() > 0 {
+		acc, err := c.GetInboxAcc(new(big.Int).Sub(previousMessageCount, big.NewInt(1)))
+		if err != nil || acc != previousSeqBatchAcc {
+			return false
+		}
+	}
+	for i, item := range c.items {
+		if item.LastSeqNum.Cmp(previousMessageCount) >= 0 {
+			c.items = c.items[:i]
+			break
+		}
+	}
+	c.messages = c.messages[:previousMessageCount.Int64()]
+	prevDelayed := big.NewInt(0)
+	if len(c.items) > 0 {
+		prevDelayed = c.items[len(c.items)-1].TotalDelayedCount
+	}
+	for _, item := range seqBatchItems {
+		if len(item.SequencerMessage) > 0 {
+			msg, err := inbox.NewInboxMessageFromData(item.SequencerMessage)
+			if err != nil {
+				return false
+			}
+			c.messages = append(c.messages, msg)
+		} else {
+			for i := prevDelayed.Int64(); i < item.TotalDelayedCount.Int64(); i++ {
+				msg, err := inbox.NewInboxMessageFromData(c.delayed[i].Message)
+				if err != nil {
+					return false
+				}
+				c.messages = append(c.messages, msg)
+			}
+		}
+		c.items = append(c.items, item)
+		prevDelayed = item.TotalDelayedCount
+	}
+	return true
+}
+
+func (c *testCore) MessagesStatus() (core.MessageStatus, error) {
+	return core.MessagesSuccess, nil
+}
+
+func checkSameInbox(t *testing.T, expected, actual *testCore) {
+	t.Helper()
+	if len(expected.items) != len(actual.items) || len(expected.messages) != len(actual.messages) {
+		t.Fatalf("expected %v items and %v messages but got %v and %v",
+			len(expected.items), len(expected.messages), len(actual.items), len(actual.messages))
+	}
+	for i := range expected.items {
+		if expected.items[i].Accumulator != actual.items[i].Accumulator {
+			t.Fatalf("wrong accumulator for batch item %v", i)
+		}
+	}
+	for i := range expected.messages {
+		if !expected.messages[i].Equals(actual.messages[i]) {
+			t.Fatalf("wrong message %v", i)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := newTestCore(50)
+	dir := t.TempDir()
+	m, err := Export(src, dir, big.NewInt(0), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Chunks) != 8 {
+		t.Fatalf("expected 8 chunks but got %v", len(m.Chunks))
+	}
+	if m.MessageCount().Cmp(big.NewInt(int64(len(src.messages)))) != 0 {
+		t.Fatalf("export has %v messages but core has %v", m.MessageCount(), len(src.messages))
+	}
+
+	dest := &testCore{}
+	if _, err := Import(context.Background(), dest, dir); err != nil {
+		t.Fatal(err)
+	}
+	checkSameInbox(t, src, dest)
+	// Unsequenced delayed messages aren't exported
+	if len(dest.delayed) != len(src.delayed)-2 {
+		t.Fatalf("expected %v delayed messages but got %v", len(src.delayed)-2, len(dest.delayed))
+	}
+
+	// Importing again leaves the database alone
+	if _, err := Import(context.Background(), dest, dir); err != nil {
+		t.Fatal(err)
+	}
+	checkSameInbox(t, src, dest)
+}
+
+func TestIncrementalExport(t *testing.T) {
+	src := newTestCore(30)
+	dest := &testCore{}
+
+	firstDir := t.TempDir()
+	first, err := Export(src, firstDir, big.NewInt(0), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Import only part of the first export
+	if _, err := importChunk(dest, firstDir, first.Chunks[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importChunk(dest, firstDir, first.Chunks[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delayed batch items can't be split
+	if _, err := Export(src, t.TempDir(), big.NewInt(8), 4); err == nil {
+		t.Fatal("export started in the middle of a batch item")
+	}
+
+	secondDir := t.TempDir()
+	if _, err := Export(src, secondDir, first.Chunks[3].MessageCount, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(context.Background(), dest, secondDir); err == nil {
+		t.Fatal("imported export past the end of the database")
+	}
+	if _, err := Import(context.Background(), dest, firstDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(context.Background(), dest, secondDir); err != nil {
+		t.Fatal(err)
+	}
+	checkSameInbox(t, src, dest)
+}
+
+func TestImportRejectsBadChunks(t *testing.T) {
+	src := newTestCore(20)
+	dir := t.TempDir()
+	m, err := Export(src, dir, big.NewInt(0), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunkPath := filepath.Join(dir, m.Chunks[1].Name)
+	original, err := ioutil.ReadFile(chunkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := append([]byte{}, original...)
+	corrupted[len(corrupted)-1] ^= 1
+	if err := ioutil.WriteFile(chunkPath, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(context.Background(), &testCore{}, dir); err == nil {
+		t.Fatal("imported chunk with bad checksum")
+	}
+
+	// Replace a delayed message and update the checksum so that only the
+	// accumulators catch it
+	delayed, items, err := decodeChunk(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(delayed) == 0 {
+		t.Fatal("expected chunk to contain delayed messages")
+	}
+	msg, err := inbox.NewInboxMessageFromData(delayed[0].Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg.Data = append(msg.Data, 1)
+	delayed[0].Message = msg.ToBytes()
+	c := m.Chunks[1]
+	if err := writeChunk(dir, &c, delayed, items); err != nil {
+		t.Fatal(err)
+	}
+	m.Chunks[1] = c
+	manifestData, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestName), manifestData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := &testCore{}
+	if _, err := Import(context.Background(), dest, dir); err == nil {
+		t.Fatal("imported chunk with bad delayed message")
+	}
+	if len(dest.messages) != int(m.Chunks[0].MessageCount.Int64()) {
+		t.Fatalf("expected import to stop after the first chunk but got %v messages", len(dest.messages))
+	}
+}
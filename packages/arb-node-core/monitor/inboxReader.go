@@ -29,7 +29,9 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/nodehealth"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
 )
 
@@ -52,6 +54,7 @@ type InboxReader struct {
 	lastAcc            common.Hash
 	sequencerFeedQueue []broadcaster.SequencerFeedItem
 	recentFeedItems    map[common.Hash]time.Time
+	rangeSizer         *blockRangeSizer
 
 	// Only in main thread
 	running    bool
@@ -62,6 +65,8 @@ type InboxReader struct {
 	delayedBridge        *ethbridge.DelayedBridgeWatcher
 	sequencerInbox       *ethbridge.SequencerInboxWatcher
 	bridgeUtils          *ethbridge.BridgeUtils
+	blockVerifier        ethutils.BlockHashVerifier
+	logFetchConfig       configuration.L1LogFetch
 	caughtUpChan         chan bool
 	MessageDeliveryMutex sync.Mutex
 	BroadcastFeed        chan broadcaster.BroadcastFeedMessage
@@ -72,10 +77,15 @@ func NewInboxReader(
 	bridge *ethbridge.DelayedBridgeWatcher,
 	sequencerInbox *ethbridge.SequencerInboxWatcher,
 	bridgeUtils *ethbridge.BridgeUtils,
+	ethClient ethutils.EthClient,
+	logFetchConfig configuration.L1LogFetch,
 	db core.ArbCore,
 	healthChan chan nodehealth.Log,
 	broadcastFeed chan broadcaster.BroadcastFeedMessage,
 ) (*InboxReader, error) {
+	if logFetchConfig.MinBlocks == 0 || logFetchConfig.MaxBlocks < logFetchConfig.MinBlocks {
+		return nil, errors.New("invalid L1 log fetch block range limits")
+	}
 	firstMessageBlock := bridge.FromBlock()
 	if firstMessageBlock <= 1 {
 		start, err := bridge.LookupMessageBlock(ctx, big.NewInt(0))
@@ -84,10 +94,15 @@ func NewInboxReader(
 		}
 		firstMessageBlock = start.Height.AsInt().Int64()
 	}
+	// Only clients backed by several providers can cross-check block hashes
+	blockVerifier, _ := ethClient.(ethutils.BlockHashVerifier)
 	return &InboxReader{
 		delayedBridge:     bridge,
 		sequencerInbox:    sequencerInbox,
 		bridgeUtils:       bridgeUtils,
+		blockVerifier:     blockVerifier,
+		logFetchConfig:    logFetchConfig,
+		rangeSizer:        newBlockRangeSizer(logFetchConfig),
 		db:                db,
 		firstMessageBlock: big.NewInt(firstMessageBlock),
 		recentFeedItems:   make(map[common.Hash]time.Time),
@@ -148,7 +163,8 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 	if ir.healthChan != nil && from != nil {
 		ir.healthChan <- nodehealth.Log{Comp: "InboxReader", Var: "getNextBlockToRead", ValBigInt: new(big.Int).Set(from)}
 	}
-	blocksToFetch := uint64(100)
+	fetcher := newLogFetcher(ir.delayedBridge, ir.sequencerInbox, ir.blockVerifier, ir.logFetchConfig)
+	defer fetcher.reset()
 	for {
 		select {
 		case <-ctx.Done():
@@ -160,6 +176,7 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
+		fetcher.setTip(currentHeight)
 
 		reorgingDelayed := false
 		reorgingSequencer := false
@@ -216,18 +233,37 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 			if from.Cmp(currentHeight) >= 0 {
 				break
 			}
-			to := new(big.Int).Add(from, new(big.Int).SetUint64(blocksToFetch))
-			if to.Cmp(currentHeight) > 0 {
-				to = currentHeight
-			}
-			delayedMessages, err := ir.delayedBridge.LookupMessagesInRange(ctx, from, to)
-			if err != nil {
-				return err
-			}
-			sequencerBatches, err := ir.sequencerInbox.LookupBatchesInRange(ctx, from, to)
-			if err != nil {
-				return err
+			fetched := fetcher.next(ctx, from, ir.rangeSizer.blocks(), currentHeight)
+			if fetched.err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if errors.Is(fetched.err, ethutils.ErrBlockHashMismatch) {
+					// The provider that disagreed has been benched if there
+					// was a majority, so the retry uses another one
+					logger.Warn().
+						Err(fetched.err).
+						Str("from", fetched.from.String()).
+						Str("to", fetched.to.String()).
+						Msg("L1 providers disagree on block hash, retrying")
+					waitForRangeRetry(ctx)
+					continue
+				}
+				if !ethutils.IsLogRangeError(fetched.err) || !ir.rangeSizer.failed() {
+					return fetched.err
+				}
+				logger.Warn().
+					Err(fetched.err).
+					Str("from", fetched.from.String()).
+					Str("to", fetched.to.String()).
+					Uint64("blocks", ir.rangeSizer.blocks()).
+					Msg("L1 log request failed, retrying with smaller block range")
+				waitForRangeRetry(ctx)
+				continue
 			}
+			to := fetched.to
+			delayedMessages := fetched.delayedMessages
+			sequencerBatches := fetched.sequencerBatches
 			if ir.caughtUpTarget == nil && to.Cmp(currentHeight) == 0 {
 				if len(sequencerBatches) > 0 {
 					ir.caughtUpTarget = sequencerBatches[len(sequencerBatches)-1].GetAfterCount()
@@ -287,14 +323,7 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 			if ir.healthChan != nil && ir.caughtUpTarget != nil {
 				ir.healthChan <- nodehealth.Log{Comp: "InboxReader", Var: "caughtUpTarget", ValBigInt: new(big.Int).Set(ir.caughtUpTarget)}
 			}
-			if len(sequencerBatches) < 5 {
-				blocksToFetch += 20
-			} else if len(sequencerBatches) > 10 {
-				blocksToFetch /= 2
-			}
-			if blocksToFetch < 2 {
-				blocksToFetch = 2
-			}
+			ir.rangeSizer.succeeded(len(sequencerBatches))
 
 			logMsg := logger.Debug().
 				Str("from", from.String()).
@@ -322,7 +351,7 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 					return err
 				}
 			} else {
-				delta := new(big.Int).SetUint64(blocksToFetch)
+				delta := new(big.Int).SetUint64(ir.rangeSizer.blocks())
 				if new(big.Int).Add(to, delta).Cmp(currentHeight) >= 0 {
 					delta = delta.Div(delta, big.NewInt(2))
 					from = from.Add(from, delta)
@@ -331,6 +360,7 @@ func (ir *InboxReader) getMessages(ctx context.Context) error {
 					}
 				} else {
 					from = from.Add(to, big.NewInt(1))
+					fetcher.prefetch(ctx, from, ir.rangeSizer.blocks(), currentHeight)
 				}
 			}
 			DelayedCounter.Inc(int64(len(delayedMessages)))
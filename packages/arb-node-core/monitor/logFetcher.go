@@ -0,0 +1,327 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+)
+
+var (
+	LogFetchBlocksGauge   = metrics.NewRegisteredGauge("arbitrum/inbox/fetch_blocks", nil)
+	LogFetchFailedCounter = metrics.NewRegisteredCounter("arbitrum/inbox/fetch_range_errors", nil)
+)
+
+// blockRangeSizer picks how many L1 blocks to request logs for at once. The
+// range grows while requests succeed with few batches and shrinks when a
+// provider rejects or times out on a request.
+type blockRangeSizer struct {
+	size   uint64
+	config configuration.L1LogFetch
+}
+
+func newBlockRangeSizer(config configuration.L1LogFetch) *blockRangeSizer {
+	s := &blockRangeSizer{size: config.InitialBlocks, config: config}
+	s.clamp()
+	return s
+}
+
+func (s *blockRangeSizer) clamp() {
+	if s.size > s.config.MaxBlocks {
+		s.size = s.config.MaxBlocks
+	}
+	if s.size < s.config.MinBlocks {
+		s.size = s.config.MinBlocks
+	}
+	LogFetchBlocksGauge.Update(int64(s.size))
+}
+
+func (s *blockRangeSizer) blocks() uint64 {
+	return s.size
+}
+
+// succeeded adjusts the range after a request that returned batchCount
+// sequencer batches, keeping the number of batches delivered at once modest
+func (s *blockRangeSizer) succeeded(batchCount int) {
+	if batchCount < 5 {
+		growth := s.size / 2
+		if growth < 20 {
+			growth = 20
+		}
+		s.size += growth
+	} else if batchCount > 10 {
+		s.size /= 2
+	}
+	s.clamp()
+}
+
+// failed shrinks the range after the provider rejected it, returning false
+// if the range is already as small as allowed
+func (s *blockRangeSizer) failed() bool {
+	LogFetchFailedCounter.Inc(1)
+	if s.size <= s.config.MinBlocks {
+		return false
+	}
+	s.size /= 2
+	s.clamp()
+	return true
+}
+
+type fetchedLogs struct {
+	from             *big.Int
+	to               *big.Int
+	delayedMessages  []*ethbridge.DeliveredInboxMessage
+	sequencerBatches []ethbridge.SequencerBatchRef
+	err              error
+}
+
+type pendingFetch struct {
+	from      *big.Int
+	to        *big.Int
+	confirmed *big.Int
+	cancel    context.CancelFunc
+	done      chan *fetchedLogs
+}
+
+type delayedMessageLookup interface {
+	LookupMessagesInRange(ctx context.Context, from, to *big.Int) ([]*ethbridge.DeliveredInboxMessage, error)
+}
+
+type sequencerBatchLookup interface {
+	LookupBatchesInRange(ctx context.Context, from, to *big.Int) ([]ethbridge.SequencerBatchRef, error)
+}
+
+// logFetcher looks up the inbox events in block ranges, fetching upcoming
+// ranges in the background so that syncing far behind the tip isn't bound by
+// request latency
+type logFetcher struct {
+	delayedBridge  delayedMessageLookup
+	sequencerInbox sequencerBatchLookup
+	verifier       ethutils.BlockHashVerifier
+	config         configuration.L1LogFetch
+
+	// Latest L1 block, which determines the blocks that are old enough to
+	// cross-check with the verifier
+	tip *big.Int
+
+	// In order of block range
+	pending []*pendingFetch
+}
+
+func newLogFetcher(
+	delayedBridge delayedMessageLookup,
+	sequencerInbox sequencerBatchLookup,
+	verifier ethutils.BlockHashVerifier,
+	config configuration.L1LogFetch,
+) *logFetcher {
+	return &logFetcher{
+		delayedBridge:  delayedBridge,
+		sequencerInbox: sequencerInbox,
+		verifier:       verifier,
+		config:         config,
+	}
+}
+
+// setTip records the latest L1 block, which applies to ranges fetched from
+// then on
+func (f *logFetcher) setTip(tip *big.Int) {
+	f.tip = new(big.Int).Set(tip)
+}
+
+// confirmedHeight returns the newest block that's far enough behind the tip
+// for providers to agree on, or nil if there isn't one
+func (f *logFetcher) confirmedHeight() *big.Int {
+	if f.tip == nil {
+		return nil
+	}
+	confirmed := new(big.Int).Sub(f.tip, new(big.Int).SetUint64(f.config.VerifyConfirmations))
+	if confirmed.Sign() < 0 {
+		return nil
+	}
+	return confirmed
+}
+
+func (f *logFetcher) lookup(ctx context.Context, from, to, confirmed *big.Int) *fetchedLogs {
+	if f.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.config.Timeout)
+		defer cancel()
+	}
+	result := &fetchedLogs{from: from, to: to}
+	result.delayedMessages, result.err = f.delayedBridge.LookupMessagesInRange(ctx, from, to)
+	if result.err != nil {
+		return result
+	}
+	result.sequencerBatches, result.err = f.sequencerInbox.LookupBatchesInRange(ctx, from, to)
+	if result.err != nil {
+		return result
+	}
+	if f.verifier != nil && confirmed != nil {
+		result.err = f.verify(ctx, result, confirmed)
+	}
+	return result
+}
+
+// verify checks that the other L1 providers agree with the hashes of the
+// blocks the events were found in and of the end of the range. Providers can
+// legitimately disagree about recent blocks, so blocks after confirmed aren't
+// checked. Events in those blocks are caught by the inbox accumulator checks
+// if they're reorged out.
+func (f *logFetcher) verify(ctx context.Context, result *fetchedLogs, confirmed *big.Int) error {
+	verified := make(map[string]common.Hash)
+	verifyBlock := func(height *big.Int) (common.Hash, error) {
+		if hash, ok := verified[height.String()]; ok {
+			return hash, nil
+		}
+		ethHash, err := f.verifier.VerifyBlockHash(ctx, height)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		hash := common.NewHashFromEth(ethHash)
+		verified[height.String()] = hash
+		return hash, nil
+	}
+	checkBlock := func(block *common.BlockId) error {
+		height := block.Height.AsInt()
+		if height.Cmp(confirmed) > 0 {
+			return nil
+		}
+		hash, err := verifyBlock(height)
+		if err != nil {
+			return err
+		}
+		if block.HeaderHash != hash {
+			return errors.Wrapf(
+				ethutils.ErrBlockHashMismatch,
+				"event in block %v has hash %v but providers agree on %v",
+				height,
+				block.HeaderHash,
+				hash,
+			)
+		}
+		return nil
+	}
+	for _, msg := range result.delayedMessages {
+		if err := checkBlock(msg.Block()); err != nil {
+			return err
+		}
+	}
+	for _, batch := range result.sequencerBatches {
+		if err := checkBlock(batch.GetBlock()); err != nil {
+			return err
+		}
+	}
+
+	// Catch the active provider being on a different chain even if the range
+	// has no events
+	end := result.to
+	if end.Cmp(confirmed) > 0 {
+		end = confirmed
+	}
+	if end.Cmp(result.from) < 0 {
+		return nil
+	}
+	_, err := verifyBlock(end)
+	return err
+}
+
+func (f *logFetcher) start(ctx context.Context, from, to *big.Int) {
+	ctx, cancel := context.WithCancel(ctx)
+	fetch := &pendingFetch{
+		from:      new(big.Int).Set(from),
+		to:        new(big.Int).Set(to),
+		confirmed: f.confirmedHeight(),
+		cancel:    cancel,
+		done:      make(chan *fetchedLogs, 1),
+	}
+	f.pending = append(f.pending, fetch)
+	go func() {
+		fetch.done <- f.lookup(ctx, fetch.from, fetch.to, fetch.confirmed)
+	}()
+}
+
+// next returns the events in the range starting at from, using a prefetched
+// range if there is one and otherwise fetching up to blocks blocks, capped at
+// limit
+func (f *logFetcher) next(ctx context.Context, from *big.Int, blocks uint64, limit *big.Int) *fetchedLogs {
+	if len(f.pending) == 0 || f.pending[0].from.Cmp(from) != 0 || f.pending[0].to.Cmp(limit) > 0 {
+		f.reset()
+		to := new(big.Int).Add(from, new(big.Int).SetUint64(blocks))
+		if to.Cmp(limit) > 0 {
+			to = new(big.Int).Set(limit)
+		}
+		f.start(ctx, from, to)
+	}
+	fetch := f.pending[0]
+	f.pending = f.pending[1:]
+	var result *fetchedLogs
+	select {
+	case result = <-fetch.done:
+	case <-ctx.Done():
+		result = &fetchedLogs{from: fetch.from, to: fetch.to, err: ctx.Err()}
+	}
+	fetch.cancel()
+	if result.err != nil {
+		// Later ranges were likely rejected for the same reason
+		f.reset()
+	}
+	return result
+}
+
+// prefetch starts fetching ranges of blocks blocks after the last one
+// requested, as long as they end well before limit
+func (f *logFetcher) prefetch(ctx context.Context, from *big.Int, blocks uint64, limit *big.Int) {
+	start := new(big.Int).Set(from)
+	if len(f.pending) > 0 {
+		start.Add(f.pending[len(f.pending)-1].to, big.NewInt(1))
+	}
+	delta := new(big.Int).SetUint64(blocks)
+	for len(f.pending) < f.config.Prefetch {
+		to := new(big.Int).Add(start, delta)
+		if new(big.Int).Add(to, delta).Cmp(limit) >= 0 {
+			break
+		}
+		f.start(ctx, start, to)
+		start = new(big.Int).Add(to, big.NewInt(1))
+	}
+}
+
+// reset abandons any prefetched ranges
+func (f *logFetcher) reset() {
+	for _, fetch := range f.pending {
+		fetch.cancel()
+	}
+	f.pending = nil
+}
+
+// waitForRangeRetry pauses briefly before retrying a rejected range so that
+// rate limited providers get a chance to recover
+func waitForRangeRetry(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,375 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+)
+
+func testBlockHash(height int64) common.Hash {
+	return common.NewHashFromEth(ethcommon.BigToHash(big.NewInt(height + 1000)))
+}
+
+func testBlockId(height int64) *common.BlockId {
+	return &common.BlockId{
+		Height:     common.NewTimeBlocksInt(height),
+		HeaderHash: testBlockHash(height),
+	}
+}
+
+type testBatchRef struct {
+	ethbridge.SequencerBatchRef
+	block *common.BlockId
+}
+
+func (b testBatchRef) GetBlock() *common.BlockId {
+	return b.block
+}
+
+// testL1Logs serves delayed messages and sequencer batches that were
+// delivered in the given blocks
+type testL1Logs struct {
+	mutex         sync.Mutex
+	delayedBlocks []*common.BlockId
+	batchBlocks   []*common.BlockId
+	err           error
+}
+
+func (l *testL1Logs) LookupMessagesInRange(_ context.Context, from, to *big.Int) ([]*ethbridge.DeliveredInboxMessage, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	var messages []*ethbridge.DeliveredInboxMessage
+	for _, block := range l.delayedBlocks {
+		height := block.Height.AsInt()
+		if height.Cmp(from) >= 0 && height.Cmp(to) <= 0 {
+			messages = append(messages, &ethbridge.DeliveredInboxMessage{
+				BlockHash: block.HeaderHash,
+				Message: inbox.InboxMessage{
+					ChainTime: inbox.ChainTime{BlockNum: block.Height},
+				},
+			})
+		}
+	}
+	return messages, nil
+}
+
+func (l *testL1Logs) LookupBatchesInRange(_ context.Context, from, to *big.Int) ([]ethbridge.SequencerBatchRef, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var batches []ethbridge.SequencerBatchRef
+	for _, block := range l.batchBlocks {
+		height := block.Height.AsInt()
+		if height.Cmp(from) >= 0 && height.Cmp(to) <= 0 {
+			batches = append(batches, testBatchRef{block: block})
+		}
+	}
+	return batches, nil
+}
+
+// testVerifier agrees with the blocks from testBlockId unless it's set to
+// fail
+type testVerifier struct {
+	mutex    sync.Mutex
+	err      error
+	verified []int64
+}
+
+func (v *testVerifier) VerifyBlockHash(_ context.Context, number *big.Int) (ethcommon.Hash, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.verified = append(v.verified, number.Int64())
+	if v.err != nil {
+		return ethcommon.Hash{}, v.err
+	}
+	return testBlockHash(number.Int64()).ToEthHash(), nil
+}
+
+func newTestLogFetcher(logs *testL1Logs, verifier *testVerifier) *logFetcher {
+	config := configuration.DefaultL1LogFetchSettings()
+	config.VerifyConfirmations = 10
+	return newLogFetcher(logs, logs, verifier, config)
+}
+
+func fetchRange(t *testing.T, fetcher *logFetcher, from, to int64) *fetchedLogs {
+	t.Helper()
+	fetched := fetcher.next(context.Background(), big.NewInt(from), uint64(to-from), big.NewInt(to))
+	if fetched.from.Int64() != from || fetched.to.Int64() != to {
+		t.Fatal("fetched blocks", fetched.from, "to", fetched.to, "instead of", from, "to", to)
+	}
+	return fetched
+}
+
+func requireVerified(t *testing.T, verifier *testVerifier, heights ...int64) {
+	t.Helper()
+	verifier.mutex.Lock()
+	defer verifier.mutex.Unlock()
+	if len(verifier.verified) != len(heights) {
+		t.Fatal("verified blocks", verifier.verified, "but expected", heights)
+	}
+	for i, height := range heights {
+		if verifier.verified[i] != height {
+			t.Fatal("verified blocks", verifier.verified, "but expected", heights)
+		}
+	}
+	verifier.verified = nil
+}
+
+func TestLogFetcherVerifiesConfirmedBlocks(t *testing.T) {
+	logs := &testL1Logs{
+		delayedBlocks: []*common.BlockId{testBlockId(20), testBlockId(20), testBlockId(95)},
+		batchBlocks:   []*common.BlockId{testBlockId(30)},
+	}
+	verifier := &testVerifier{}
+	fetcher := newTestLogFetcher(logs, verifier)
+	fetcher.setTip(big.NewInt(100))
+
+	// Blocks with events are checked once each, along with the last confirmed
+	// block in the range, but block 95 is too recent to check
+	fetched := fetchRange(t, fetcher, 10, 99)
+	if fetched.err != nil {
+		t.Fatal(fetched.err)
+	}
+	if len(fetched.delayedMessages) != 3 || len(fetched.sequencerBatches) != 1 {
+		t.Fatal("wrong events returned")
+	}
+	requireVerified(t, verifier, 20, 30, 90)
+
+	// Nothing is checked for ranges after the confirmed height
+	fetched = fetchRange(t, fetcher, 91, 99)
+	if fetched.err != nil {
+		t.Fatal(fetched.err)
+	}
+	requireVerified(t, verifier)
+
+	// Once the tip has moved on, later ranges check the recent events
+	fetcher.setTip(big.NewInt(200))
+	fetched = fetchRange(t, fetcher, 91, 99)
+	if fetched.err != nil {
+		t.Fatal(fetched.err)
+	}
+	requireVerified(t, verifier, 95, 99)
+}
+
+func TestLogFetcherRejectsMismatchedEvents(t *testing.T) {
+	forked := testBlockId(30)
+	forked.HeaderHash = common.Hash{1}
+	logs := &testL1Logs{batchBlocks: []*common.BlockId{forked}}
+	verifier := &testVerifier{}
+	fetcher := newTestLogFetcher(logs, verifier)
+	fetcher.setTip(big.NewInt(100))
+
+	fetched := fetchRange(t, fetcher, 10, 50)
+	if !errors.Is(fetched.err, ethutils.ErrBlockHashMismatch) {
+		t.Fatal("expected block hash mismatch but got", fetched.err)
+	}
+
+	// No majority is reported as a mismatch so that the range is retried
+	logs.batchBlocks = []*common.BlockId{testBlockId(30)}
+	verifier.err = ethutils.ErrBlockHashMismatch
+	fetched = fetchRange(t, fetcher, 10, 50)
+	if !errors.Is(fetched.err, ethutils.ErrBlockHashMismatch) {
+		t.Fatal("expected block hash mismatch but got", fetched.err)
+	}
+	if ethutils.IsLogRangeError(fetched.err) {
+		t.Fatal("mismatch treated as a range error")
+	}
+
+	verifier.err = nil
+	fetched = fetchRange(t, fetcher, 10, 50)
+	if fetched.err != nil {
+		t.Fatal(fetched.err)
+	}
+}
+
+func TestLogFetcherWithoutVerifier(t *testing.T) {
+	logs := &testL1Logs{delayedBlocks: []*common.BlockId{testBlockId(20)}}
+	fetcher := newLogFetcher(logs, logs, nil, configuration.DefaultL1LogFetchSettings())
+	fetcher.setTip(big.NewInt(100))
+	fetched := fetchRange(t, fetcher, 10, 50)
+	if fetched.err != nil {
+		t.Fatal(fetched.err)
+	}
+	if len(fetched.delayedMessages) != 1 {
+		t.Fatal("wrong events returned")
+	}
+}
+
+func TestLogFetcherPrefetch(t *testing.T) {
+	ctx := context.Background()
+	logs := &testL1Logs{}
+	fetcher := newTestLogFetcher(logs, &testVerifier{})
+	fetcher.setTip(big.NewInt(1000))
+	limit := big.NewInt(1000)
+
+	fetched := fetcher.next(ctx, big.NewInt(0), 10, limit)
+	if fetched.err != nil || fetched.to.Int64() != 10 {
+		t.Fatal("unexpected first range", fetched.to, fetched.err)
+	}
+	fetcher.prefetch(ctx, big.NewInt(11), 10, limit)
+	if len(fetcher.pending) != 2 {
+		t.Fatal("prefetched", len(fetcher.pending), "ranges")
+	}
+
+	// Prefetched ranges are used in order
+	fetched = fetcher.next(ctx, big.NewInt(11), 10, limit)
+	if fetched.err != nil || fetched.from.Int64() != 11 || fetched.to.Int64() != 21 {
+		t.Fatal("unexpected prefetched range", fetched.from, fetched.to, fetched.err)
+	}
+	fetched = fetcher.next(ctx, big.NewInt(22), 10, limit)
+	if fetched.err != nil || fetched.from.Int64() != 22 || fetched.to.Int64() != 32 {
+		t.Fatal("unexpected prefetched range", fetched.from, fetched.to, fetched.err)
+	}
+
+	// Ranges close to the limit aren't prefetched
+	fetcher.prefetch(ctx, big.NewInt(975), 10, limit)
+	if len(fetcher.pending) != 1 {
+		t.Fatal("prefetched", len(fetcher.pending), "ranges near the limit")
+	}
+
+	// Asking for a different range abandons the prefetched ones
+	fetched = fetcher.next(ctx, big.NewInt(500), 10, limit)
+	if fetched.err != nil || fetched.from.Int64() != 500 || fetched.to.Int64() != 510 {
+		t.Fatal("unexpected range", fetched.from, fetched.to, fetched.err)
+	}
+	if len(fetcher.pending) != 0 {
+		t.Fatal("prefetched ranges weren't abandoned")
+	}
+
+	// Errors abandon later ranges since they'd likely fail too
+	fetcher.prefetch(ctx, big.NewInt(511), 10, limit)
+	logs.mutex.Lock()
+	logs.err = errors.New("query returned more than 10000 results")
+	logs.mutex.Unlock()
+	fetched = fetcher.next(ctx, big.NewInt(600), 10, limit)
+	if fetched.err == nil {
+		t.Fatal("expected error")
+	}
+	if len(fetcher.pending) != 0 {
+		t.Fatal("prefetched ranges weren't abandoned after error")
+	}
+}
+
+func TestLogFetcherTimeout(t *testing.T) {
+	logs := &blockingL1Logs{}
+	config := configuration.DefaultL1LogFetchSettings()
+	config.Timeout = 10 * time.Millisecond
+	fetcher := newLogFetcher(logs, logs, nil, config)
+	fetched := fetcher.next(context.Background(), big.NewInt(0), 10, big.NewInt(100))
+	if !ethutils.IsLogRangeError(fetched.err) {
+		t.Fatal("expected timeout to be a range error but got", fetched.err)
+	}
+}
+
+// blockingL1Logs doesn't respond until the request is cancelled
+type blockingL1Logs struct{}
+
+func (blockingL1Logs) LookupMessagesInRange(ctx context.Context, _, _ *big.Int) ([]*ethbridge.DeliveredInboxMessage, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingL1Logs) LookupBatchesInRange(ctx context.Context, _, _ *big.Int) ([]ethbridge.SequencerBatchRef, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestBlockRangeSizer(t *testing.T) {
+	sizer := newBlockRangeSizer(configuration.L1LogFetch{
+		InitialBlocks: 100,
+		MaxBlocks:     400,
+		MinBlocks:     10,
+	})
+	if sizer.blocks() != 100 {
+		t.Fatal("initial size is", sizer.blocks())
+	}
+
+	// Grows by half while few batches are returned, up to the maximum
+	sizer.succeeded(0)
+	if sizer.blocks() != 150 {
+		t.Fatal("size after growing is", sizer.blocks())
+	}
+	for i := 0; i < 10; i++ {
+		sizer.succeeded(4)
+	}
+	if sizer.blocks() != 400 {
+		t.Fatal("size isn't capped at maximum", sizer.blocks())
+	}
+
+	// Stays the same with a moderate number of batches and halves with many
+	sizer.succeeded(7)
+	if sizer.blocks() != 400 {
+		t.Fatal("size changed with moderate batches", sizer.blocks())
+	}
+	sizer.succeeded(11)
+	if sizer.blocks() != 200 {
+		t.Fatal("size after many batches is", sizer.blocks())
+	}
+
+	// Failures halve the range until the minimum is reached
+	for sizer.blocks() > 10 {
+		if !sizer.failed() {
+			t.Fatal("failed above minimum size", sizer.blocks())
+		}
+	}
+	if sizer.failed() {
+		t.Fatal("shrank below minimum size")
+	}
+	if sizer.blocks() != 10 {
+		t.Fatal("size isn't capped at minimum", sizer.blocks())
+	}
+
+	// Small ranges grow by at least 20 blocks
+	sizer.succeeded(0)
+	if sizer.blocks() != 30 {
+		t.Fatal("size after growing from minimum is", sizer.blocks())
+	}
+}
+
+func TestBlockRangeSizerClampsInitial(t *testing.T) {
+	sizer := newBlockRangeSizer(configuration.L1LogFetch{
+		InitialBlocks: 1000,
+		MaxBlocks:     400,
+		MinBlocks:     10,
+	})
+	if sizer.blocks() != 400 {
+		t.Fatal("initial size isn't capped at maximum", sizer.blocks())
+	}
+	sizer = newBlockRangeSizer(configuration.L1LogFetch{
+		InitialBlocks: 1,
+		MaxBlocks:     400,
+		MinBlocks:     10,
+	})
+	if sizer.blocks() != 10 {
+		t.Fatal("initial size isn't capped at minimum", sizer.blocks())
+	}
+}
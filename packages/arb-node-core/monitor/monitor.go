@@ -76,9 +76,25 @@ func (m *Monitor) Close() {
 	logger.Info().Msg("Database closed")
 }
 
+// AddComponentChecks reports the state of the core thread and the inbox reader
+// with the given name prefix. It must be called after StartInboxReader.
+func (m *Monitor) AddComponentChecks(components *nodehealth.Components, prefix string) {
+	components.AddLivenessCheck(prefix+"arbcore", func() (string, error) {
+		if !m.Core.ThreadRunning() {
+			return "", errors.New("core thread stopped")
+		}
+		if m.Core.MachineIdle() {
+			return "machine idle", nil
+		}
+		return "machine executing messages", nil
+	})
+	components.AddReadinessCheck(prefix+"inbox_reader", nodehealth.RunningCheck(m.Reader.IsRunning))
+}
+
 func (m *Monitor) StartInboxReader(
 	ctx context.Context,
 	ethClient ethutils.EthClient,
+	logFetchConfig configuration.L1LogFetch,
 	rollupAddress common.Address,
 	fromBlock int64,
 	bridgeUtilsAddress common.Address,
@@ -122,7 +138,7 @@ func (m *Monitor) StartInboxReader(
 	if err != nil {
 		return nil, err
 	}
-	reader, err := NewInboxReader(ctx, delayedBridgeWatcher, sequencerInboxWatcher, bridgeUtils, m.Core, healthChan, sequencerFeed)
+	reader, err := NewInboxReader(ctx, delayedBridgeWatcher, sequencerInboxWatcher, bridgeUtils, ethClient, logFetchConfig, m.Core, healthChan, sequencerFeed)
 	if err != nil {
 		return nil, err
 	}
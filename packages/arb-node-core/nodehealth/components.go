@@ -0,0 +1,252 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nodehealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heptiolabs/healthcheck"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcastclient"
+)
+
+//Status values reported by the component endpoints
+const (
+	componentStatusOK          = "ok"
+	componentStatusUnavailable = "unavailable"
+)
+
+//ComponentCheck reports the state of one component of a binary. The returned
+//detail is shown to operators and a non-nil error marks the component unhealthy.
+type ComponentCheck func() (string, error)
+
+//ComponentStatus is the state of a single component as served by /livez and /readyz
+type ComponentStatus struct {
+	Healthy bool   `json:"healthy"`
+	Detail  string `json:"detail,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+//HealthReport is the JSON body served by /livez and /readyz
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+//Components holds the liveness and readiness checks for the components of a
+//binary. Liveness checks should only fail if the process needs restarting,
+//while readiness checks fail whenever it shouldn't be sent traffic.
+type Components struct {
+	mu    sync.Mutex
+	live  map[string]ComponentCheck
+	ready map[string]ComponentCheck
+}
+
+func NewComponents() *Components {
+	return &Components{
+		live:  make(map[string]ComponentCheck),
+		ready: make(map[string]ComponentCheck),
+	}
+}
+
+//AddLivenessCheck adds a check to /livez. Liveness checks are also included in /readyz.
+func (c *Components) AddLivenessCheck(name string, check ComponentCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live[name] = check
+}
+
+//AddReadinessCheck adds a check to /readyz
+func (c *Components) AddReadinessCheck(name string, check ComponentCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ready[name] = check
+}
+
+//Liveness runs the liveness checks
+func (c *Components) Liveness() HealthReport {
+	c.mu.Lock()
+	checks := make(map[string]ComponentCheck, len(c.live))
+	for name, check := range c.live {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+	return runComponentChecks(checks)
+}
+
+//Readiness runs both the liveness and readiness checks
+func (c *Components) Readiness() HealthReport {
+	c.mu.Lock()
+	checks := make(map[string]ComponentCheck, len(c.live)+len(c.ready))
+	for name, check := range c.live {
+		checks[name] = check
+	}
+	for name, check := range c.ready {
+		checks[name] = check
+	}
+	c.mu.Unlock()
+	return runComponentChecks(checks)
+}
+
+func runComponentChecks(checks map[string]ComponentCheck) HealthReport {
+	report := HealthReport{
+		Status:     componentStatusOK,
+		Components: make(map[string]ComponentStatus, len(checks)),
+	}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		detail, err := checks[name]()
+		status := ComponentStatus{Healthy: err == nil, Detail: detail}
+		if err != nil {
+			status.Error = err.Error()
+			report.Status = componentStatusUnavailable
+		}
+		report.Components[name] = status
+	}
+	return report
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if report.Status == componentStatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(report)
+}
+
+//LiveEndpoint serves the liveness report, returning 503 if any check fails
+func (c *Components) LiveEndpoint(w http.ResponseWriter, _ *http.Request) {
+	writeHealthReport(w, c.Liveness())
+}
+
+//ReadyEndpoint serves the readiness report, returning 503 if any check fails
+func (c *Components) ReadyEndpoint(w http.ResponseWriter, _ *http.Request) {
+	writeHealthReport(w, c.Readiness())
+}
+
+//Register serves /livez and /readyz on the given mux
+func (c *Components) Register(httpMux *http.ServeMux) {
+	httpMux.HandleFunc("/livez", c.LiveEndpoint)
+	httpMux.HandleFunc("/readyz", c.ReadyEndpoint)
+}
+
+//RunningCheck fails if the background component isn't running
+func RunningCheck(isRunning func() bool) ComponentCheck {
+	return func() (string, error) {
+		if !isRunning() {
+			return "", errors.New("not running")
+		}
+		return "running", nil
+	}
+}
+
+//LagCheck fails if the position of a consumer is more than maxLag behind the
+//position of the source it's reading from
+func LagCheck(source func() (*big.Int, error), consumer func() (*big.Int, error), maxLag int64) ComponentCheck {
+	return func() (string, error) {
+		sourcePos, err := source()
+		if err != nil {
+			return "", err
+		}
+		consumerPos, err := consumer()
+		if err != nil {
+			return "", err
+		}
+		lag := new(big.Int).Sub(sourcePos, consumerPos)
+		detail := fmt.Sprintf("at %v of %v", consumerPos, sourcePos)
+		if lag.Cmp(big.NewInt(maxLag)) > 0 {
+			return detail, fmt.Errorf("%v behind", lag)
+		}
+		return detail, nil
+	}
+}
+
+//FeedClientsCheck fails if none of the feed clients are connected
+func FeedClientsCheck(clients []*broadcastclient.BroadcastClient) ComponentCheck {
+	return func() (string, error) {
+		connected := 0
+		for _, client := range clients {
+			if client.IsConnected() {
+				connected++
+			}
+		}
+		detail := fmt.Sprintf("%v of %v feeds connected", connected, len(clients))
+		if connected == 0 && len(clients) > 0 {
+			return detail, errors.New("no feeds connected")
+		}
+		return detail, nil
+	}
+}
+
+//Handler that also reports its readiness checks as components
+type componentHandler struct {
+	healthcheck.Handler
+	components *Components
+}
+
+func (h componentHandler) AddReadinessCheck(name string, check healthcheck.Check) {
+	h.Handler.AddReadinessCheck(name, check)
+	h.components.AddReadinessCheck(name, func() (string, error) {
+		return "", check()
+	})
+}
+
+//StartComponentHealthCheck serves /livez and /readyz on addr until ctx is done,
+//for binaries that don't run the full node healthcheck
+func StartComponentHealthCheck(ctx context.Context, addr string, components *Components) error {
+	httpMux := http.NewServeMux()
+	components.Register(httpMux)
+	httpServer := &http.Server{
+		Addr:        addr,
+		Handler:     httpMux,
+		BaseContext: func(_ net.Listener) context.Context { return ctx },
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			errChan <- err
+		}
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	gracefulCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	return httpServer.Shutdown(gracefulCtx)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nodehealth
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getHealthReport(t *testing.T, server *httptest.Server, path string) (int, HealthReport) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var report HealthReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, report
+}
+
+func TestComponentEndpoints(t *testing.T) {
+	components := NewComponents()
+	running := true
+	components.AddLivenessCheck("core", RunningCheck(func() bool { return running }))
+
+	source := big.NewInt(100)
+	consumer := big.NewInt(95)
+	components.AddReadinessCheck("txdb", LagCheck(
+		func() (*big.Int, error) { return source, nil },
+		func() (*big.Int, error) { return consumer, nil },
+		10,
+	))
+
+	httpMux := http.NewServeMux()
+	components.Register(httpMux)
+	server := httptest.NewServer(httpMux)
+	defer server.Close()
+
+	code, report := getHealthReport(t, server, "/readyz")
+	if code != http.StatusOK || report.Status != componentStatusOK {
+		t.Fatal("healthy components returned", code, report.Status)
+	}
+	if len(report.Components) != 2 {
+		t.Error("readiness should include liveness checks, got", report.Components)
+	}
+	if detail := report.Components["txdb"].Detail; detail != "at 95 of 100" {
+		t.Error("unexpected lag detail", detail)
+	}
+
+	//Lagging components only affect readiness
+	source.SetInt64(200)
+	code, report = getHealthReport(t, server, "/readyz")
+	if code != http.StatusServiceUnavailable || report.Components["txdb"].Healthy {
+		t.Error("lagging component reported ready")
+	}
+	if code, _ := getHealthReport(t, server, "/livez"); code != http.StatusOK {
+		t.Error("lagging component failed liveness")
+	}
+
+	running = false
+	code, report = getHealthReport(t, server, "/livez")
+	if code != http.StatusServiceUnavailable || report.Components["core"].Error != "not running" {
+		t.Error("stopped component reported live")
+	}
+}
+
+func TestFeedClientsCheck(t *testing.T) {
+	if _, err := FeedClientsCheck(nil)(); err != nil {
+		t.Error("check failed without feed clients:", err)
+	}
+}
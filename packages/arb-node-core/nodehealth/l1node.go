@@ -0,0 +1,346 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nodehealth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/heptiolabs/healthcheck"
+)
+
+//L1 client implementations recognised from web3_clientVersion
+const (
+	l1ClientUnknown      = "unknown"
+	l1ClientGeth         = "geth"
+	l1ClientErigon       = "erigon"
+	l1ClientNethermind   = "nethermind"
+	l1ClientOpenEthereum = "openethereum"
+	l1ClientBesu         = "besu"
+)
+
+//JSON-RPC error code returned by clients for methods they don't implement
+const methodNotFoundCode = -32601
+
+//State of a single L1 endpoint as of its last poll
+type l1NodeStatus struct {
+	mu sync.Mutex
+
+	//RPC URL of the L1 node
+	url string
+	//Error from the last poll, or nil if every required call succeeded
+	pollErr error
+
+	//Client implementation detected from clientVersion
+	client        string
+	clientVersion string
+
+	//eth_chainId result
+	chainID *big.Int
+
+	//eth_syncing result
+	syncing      bool
+	currentBlock uint64
+	highestBlock uint64
+
+	//Peer count, if the endpoint exposes it
+	peersSupported bool
+	peers          uint64
+
+	//Number and timestamp of the latest block
+	headNumber uint64
+	headTime   time.Time
+}
+
+//JSON-RPC request sent to the L1 nodes
+type rpcRequest struct {
+	Jsonrpc string        `json:"jsonrpc"`
+	Id      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+//JSON-RPC response from the L1 nodes
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+//JSON-RPC error returned by the L1 nodes
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+//Check whether the error means the endpoint doesn't provide the method, which
+//is common for managed providers and clients with a reduced API
+func isMethodUnsupported(err error) bool {
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.Code == methodNotFoundCode {
+		return true
+	}
+	message := strings.ToLower(rpcErr.Message)
+	return strings.Contains(message, "not supported") ||
+		strings.Contains(message, "unsupported") ||
+		strings.Contains(message, "does not exist") ||
+		strings.Contains(message, "not found")
+}
+
+//Determine the client implementation from its web3_clientVersion string
+func detectL1Client(clientVersion string) string {
+	name := strings.ToLower(strings.SplitN(clientVersion, "/", 2)[0])
+	switch {
+	case name == "geth":
+		return l1ClientGeth
+	case name == "erigon" || name == "turbo-geth":
+		return l1ClientErigon
+	case name == "nethermind":
+		return l1ClientNethermind
+	case name == "openethereum" || name == "parity-ethereum" || name == "parity":
+		return l1ClientOpenEthereum
+	case name == "besu":
+		return l1ClientBesu
+	default:
+		return l1ClientUnknown
+	}
+}
+
+//Send a JSON-RPC call to the L1 node and decode its result into result
+func l1NodeCall(config *configStruct, url string, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	jsonRequest, err := json.Marshal(rpcRequest{Jsonrpc: "2.0", Id: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonRequest))
+	if err != nil {
+		return err
+	}
+
+	//Set request headers to identify the healthcheck
+	req.Header.Set("X-Custom-Header", "l1-node-healthcheck-client")
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: config.requestTimeout}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := resp.Body.Close(); err != nil {
+		return err
+	}
+	var response rpcResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("%v returned status %v: %w", method, resp.StatusCode, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+//Progress reported by eth_syncing when the node is syncing. Nethermind may
+//report a progress object with isSyncing set to false once it's caught up.
+type l1SyncProgress struct {
+	CurrentBlock hexutil.Uint64 `json:"currentBlock"`
+	HighestBlock hexutil.Uint64 `json:"highestBlock"`
+	IsSyncing    *bool          `json:"isSyncing"`
+}
+
+//Header fields of the latest block
+type l1BlockHeader struct {
+	Number    hexutil.Uint64 `json:"number"`
+	Timestamp hexutil.Uint64 `json:"timestamp"`
+}
+
+//Query the L1 node's status with standard RPCs and record it in node
+func pollL1Node(config *configStruct, node *l1NodeStatus) error {
+	//Managed providers may not expose the client version, so a failure here
+	//only prevents client specific handling
+	var clientVersion string
+	if err := l1NodeCall(config, node.url, "web3_clientVersion", &clientVersion); err != nil {
+		clientVersion = ""
+	}
+	client := detectL1Client(clientVersion)
+
+	var chainID hexutil.Big
+	if err := l1NodeCall(config, node.url, "eth_chainId", &chainID); err != nil {
+		return node.setPollError(err)
+	}
+
+	var syncResult json.RawMessage
+	if err := l1NodeCall(config, node.url, "eth_syncing", &syncResult); err != nil {
+		return node.setPollError(err)
+	}
+	syncing := false
+	var progress l1SyncProgress
+	if !bytes.Equal(bytes.TrimSpace(syncResult), []byte("false")) {
+		if err := json.Unmarshal(syncResult, &progress); err != nil {
+			return node.setPollError(err)
+		}
+		syncing = progress.IsSyncing == nil || *progress.IsSyncing
+	}
+
+	var peersSupported bool
+	var peers uint64
+	if client == l1ClientOpenEthereum {
+		//OpenEthereum's net_peerCount includes peers that are still handshaking
+		var netPeers struct {
+			Connected uint64 `json:"connected"`
+		}
+		err := l1NodeCall(config, node.url, "parity_netPeers", &netPeers)
+		if err != nil && !isMethodUnsupported(err) {
+			return node.setPollError(err)
+		}
+		peersSupported = err == nil
+		peers = netPeers.Connected
+	} else {
+		var peerCount hexutil.Uint64
+		err := l1NodeCall(config, node.url, "net_peerCount", &peerCount)
+		if err != nil && !isMethodUnsupported(err) {
+			return node.setPollError(err)
+		}
+		peersSupported = err == nil
+		peers = uint64(peerCount)
+	}
+
+	var head l1BlockHeader
+	if err := l1NodeCall(config, node.url, "eth_getBlockByNumber", &head, "latest", false); err != nil {
+		return node.setPollError(err)
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.pollErr = nil
+	node.client = client
+	node.clientVersion = clientVersion
+	node.chainID = chainID.ToInt()
+	node.syncing = syncing
+	node.currentBlock = uint64(progress.CurrentBlock)
+	node.highestBlock = uint64(progress.HighestBlock)
+	node.peersSupported = peersSupported
+	node.peers = peers
+	node.headNumber = uint64(head.Number)
+	node.headTime = time.Unix(int64(head.Timestamp), 0)
+	return nil
+}
+
+func (node *l1NodeStatus) setPollError(err error) error {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	node.pollErr = err
+	return err
+}
+
+//Run a check against the result of the last successful poll of the node
+func (node *l1NodeStatus) check(evaluate func() error) healthcheck.Check {
+	return func() error {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		if node.pollErr != nil {
+			return fmt.Errorf("L1 node unreachable: %w", node.pollErr)
+		}
+		if node.chainID == nil {
+			return errors.New("L1 node not polled yet")
+		}
+		return evaluate()
+	}
+}
+
+//Periodically poll the L1 node, failing if it can't be reached
+func l1NodeAPICheck(config *configStruct, node *l1NodeStatus) healthcheck.Check {
+	return healthcheck.Async(func() error {
+		return pollL1Node(config, node)
+	}, config.pollingRate)
+}
+
+//Check the L1 node isn't more than blockSyncDifference blocks behind the chain head
+func l1NodeSyncCheck(config *configStruct, node *l1NodeStatus) healthcheck.Check {
+	return node.check(func() error {
+		if !node.syncing || node.highestBlock <= node.currentBlock {
+			return nil
+		}
+		blockDifference := node.highestBlock - node.currentBlock
+		if blockDifference > uint64(config.blockSyncDifference) {
+			return fmt.Errorf("%v node syncing, blockDifference :%d", node.client, blockDifference)
+		}
+		return nil
+	})
+}
+
+//Check the L1 node has at least peerMinimum peers if it reports them
+func l1NodePeerCheck(config *configStruct, node *l1NodeStatus) healthcheck.Check {
+	return node.check(func() error {
+		if !node.peersSupported {
+			return nil
+		}
+		if node.peers < uint64(config.peerMinimum) {
+			return fmt.Errorf("minimumPeers :%d", node.peers)
+		}
+		return nil
+	})
+}
+
+//Check the L1 node's latest block was produced within maxBlockAge
+func l1NodeBlockAgeCheck(config *configStruct, node *l1NodeStatus) healthcheck.Check {
+	return node.check(func() error {
+		age := time.Since(node.headTime)
+		if age > config.maxBlockAge {
+			return fmt.Errorf("latest block %d is %v old", node.headNumber, age.Round(time.Second))
+		}
+		return nil
+	})
+}
+
+//Check the L1 node is on the chain we expect
+func l1NodeChainIDCheck(config *configStruct, node *l1NodeStatus) healthcheck.Check {
+	return node.check(func() error {
+		config.mu.Lock()
+		expected := config.l1ChainID
+		config.mu.Unlock()
+		if expected == nil || expected.Sign() == 0 {
+			return nil
+		}
+		if node.chainID.Cmp(expected) != 0 {
+			return fmt.Errorf("chain id %v doesn't match expected chain id %v", node.chainID, expected)
+		}
+		return nil
+	})
+}
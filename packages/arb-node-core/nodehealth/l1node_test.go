@@ -0,0 +1,172 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package nodehealth
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+//Fake L1 node answering the RPCs used by the L1 node healthchecks
+type fakeL1Node struct {
+	mu sync.Mutex
+	//Result to return for each method, methods missing from it are unsupported
+	results map[string]interface{}
+}
+
+func newFakeL1Node(clientVersion string) *fakeL1Node {
+	return &fakeL1Node{
+		results: map[string]interface{}{
+			"web3_clientVersion": clientVersion,
+			"eth_chainId":        "0x1",
+			"eth_syncing":        false,
+			"net_peerCount":      "0x19",
+			"eth_getBlockByNumber": map[string]string{
+				"number":    "0x100",
+				"timestamp": hexutil.EncodeUint64(uint64(time.Now().Unix())),
+			},
+		},
+	}
+}
+
+func (f *fakeL1Node) set(method string, result interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[method] = result
+}
+
+func (f *fakeL1Node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.Id}
+	if result, ok := f.results[req.Method]; ok {
+		resp["result"] = result
+	} else {
+		resp["error"] = &rpcError{Code: methodNotFoundCode, Message: "the method " + req.Method + " does not exist/is not available"}
+	}
+	f.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func runL1NodeChecks(t *testing.T, config *configStruct, node *l1NodeStatus) map[string]error {
+	t.Helper()
+	if err := pollL1Node(config, node); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]error{
+		"sync":      l1NodeSyncCheck(config, node)(),
+		"peer":      l1NodePeerCheck(config, node)(),
+		"block_age": l1NodeBlockAgeCheck(config, node)(),
+		"chain_id":  l1NodeChainIDCheck(config, node)(),
+	}
+}
+
+func TestDetectL1Client(t *testing.T) {
+	versions := map[string]string{
+		"Geth/v1.10.8-stable-26675454/linux-amd64/go1.16.4":        l1ClientGeth,
+		"erigon/2021.09.4/linux-amd64/go1.16.5":                    l1ClientErigon,
+		"Nethermind/v1.11.2+5d8d0a3a/linux-x64/dotnet5.0.10":       l1ClientNethermind,
+		"OpenEthereum//v3.3.0-rc.4-stable-6a5a8c6-20210714/x86_64": l1ClientOpenEthereum,
+		"besu/v21.7.4/linux-x86_64/openjdk-java-11":                l1ClientBesu,
+		"": l1ClientUnknown,
+	}
+	for version, expected := range versions {
+		if client := detectL1Client(version); client != expected {
+			t.Error("detected", client, "from", version, "instead of", expected)
+		}
+	}
+}
+
+func TestL1NodeChecks(t *testing.T) {
+	fake := newFakeL1Node("Geth/v1.10.8-stable/linux-amd64/go1.16.4")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	config := newConfig(nil)
+	config.l1ChainID = big.NewInt(1)
+	node := &l1NodeStatus{url: server.URL}
+
+	if err := l1NodeSyncCheck(config, node)(); err == nil {
+		t.Error("check passed before the L1 node was polled")
+	}
+	for name, err := range runL1NodeChecks(t, config, node) {
+		if err != nil {
+			t.Error(name, "check failed on healthy node:", err)
+		}
+	}
+	if node.client != l1ClientGeth {
+		t.Error("detected client", node.client)
+	}
+
+	//Each check fails independently of the others
+	fake.set("eth_syncing", map[string]string{"currentBlock": "0x10", "highestBlock": "0x100"})
+	fake.set("net_peerCount", "0x0")
+	fake.set("eth_chainId", "0x4")
+	fake.set("eth_getBlockByNumber", map[string]string{"number": "0x100", "timestamp": "0x1"})
+	for name, err := range runL1NodeChecks(t, config, node) {
+		if err == nil {
+			t.Error(name, "check passed on unhealthy node")
+		}
+	}
+
+	//Nethermind reports progress with isSyncing false once caught up, and
+	//managed providers often don't expose the peer count
+	fake = newFakeL1Node("Nethermind/v1.11.2/linux-x64/dotnet5.0.10")
+	fake.set("eth_syncing", map[string]interface{}{"currentBlock": "0x10", "highestBlock": "0x100", "isSyncing": false})
+	delete(fake.results, "net_peerCount")
+	server2 := httptest.NewServer(fake)
+	defer server2.Close()
+	node = &l1NodeStatus{url: server2.URL}
+	for name, err := range runL1NodeChecks(t, config, node) {
+		if err != nil {
+			t.Error(name, "check failed on caught up Nethermind node:", err)
+		}
+	}
+	if node.peersSupported {
+		t.Error("peer count supported on node without net_peerCount")
+	}
+
+	//OpenEthereum peers are read from parity_netPeers
+	fake = newFakeL1Node("OpenEthereum//v3.3.0-stable/x86_64-linux-gnu/rustc1.52.1")
+	fake.set("parity_netPeers", map[string]int{"active": 3, "connected": 0, "max": 50})
+	server3 := httptest.NewServer(fake)
+	defer server3.Close()
+	node = &l1NodeStatus{url: server3.URL}
+	if err := runL1NodeChecks(t, config, node)["peer"]; err == nil {
+		t.Error("OpenEthereum peer check used net_peerCount")
+	}
+
+	//Unreachable nodes fail every check
+	server3.Close()
+	if err := pollL1Node(config, node); err == nil {
+		t.Error("polled closed L1 node")
+	}
+	if err := l1NodeChainIDCheck(config, node)(); err == nil {
+		t.Error("check passed on unreachable node")
+	}
+}
@@ -17,18 +17,13 @@
 package nodehealth
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
 	"math/big"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -49,7 +44,7 @@ type configStruct struct {
 	healthcheckMetrics bool
 	//Disable checking the primary aggregator
 	disablePrimaryCheck bool
-	//Disable checking the OpenEthereum node
+	//Disable checking the L1 nodes
 	disableOpenEthereumCheck bool
 
 	// Store of metrics produced from healthcheck
@@ -73,22 +68,22 @@ type configStruct struct {
 	//Blocks between arbCorePosition and caughtUpTarget to consider acceptable
 	blockDifferenceTolerance int64
 
-	//OpenEthereum Healthcheck Config
-	//Address to the OpenEthereum API
-	openethereumAPI string
+	//L1 Node Healthcheck Config
+	//RPC URLs of the L1 nodes, each of which is checked independently
+	l1Endpoints []string
+	//Chain ID the L1 nodes must report, or nil to skip the check
+	l1ChainID *big.Int
 	//Maximum time to wait for http requests
 	requestTimeout time.Duration
-	//Number of blocks OpenEthereum's current block can be away from the
-	//estimated current block before a healthcheck error is triggered
+	//Number of blocks an L1 node's current block can be away from the
+	//highest known block before a healthcheck error is triggered
 	blockSyncDifference int64
-	//Minimum number of peers that can be connected to OpenEthereum
+	//Minimum number of peers that can be connected to an L1 node
 	//without a healthcheck error being triggered
 	peerMinimum int
-	//Maximum time OpenEthereum can take to change its current block
-	//before a healthcheck error is triggered
-	blockUpdateTimeout time.Duration
-	//Debug variable to print the responses from the OpenEthereum API
-	printRequests bool
+	//Maximum age of an L1 node's latest block before a healthcheck
+	//error is triggered
+	maxBlockAge time.Duration
 	//Debug variable to print the status of the configuration load
 	printConfigMsg bool
 }
@@ -119,51 +114,8 @@ type asyncDataStruct struct {
 	//Map to dynamically allocate new healthchecks
 	healthchecks map[string]healthcheck.Check
 
-	//Response structs to process the OpenEthereum responses
-	ethSyncResp        OpenEthereumResponse
-	parityNetPeersResp OpenEthereumResponse
-}
-
-//OpenEthereum response struct for json parsing
-type OpenEthereumResponse struct {
-	//Raw json response from the OpenEthereum API
-	respBody string
-	//Request ID
-	Id int `json:"id"`
-	//JSON RPC version
-	Jsonrpc string `json:"jsonrpc"`
-	//Result struct to process the json
-	Result OpenEthereumResult `json:"result"`
-}
-
-//OpenEthereum result field struct for json parsing
-type OpenEthereumResult struct {
-	//Result field for parityNetPeers
-	Active    int                `json:"active"`
-	Connected int                `json:"connected"`
-	Max       int                `json:"max"`
-	Peers     []OpenEthereumPeer `json:"peers"`
-
-	//Result field for ethSyncing
-	StartingBlock       string `json:"startingBlock"`
-	CurrentBlock        string `json:"currentBlock"`
-	HighestBlock        string `json:"highestBlock"`
-	WarpChunksAmount    string `json:"warpChunksAmount"`
-	WarpChunksProcessed string `json:"warpChunksProcessed"`
-}
-
-//OpenEthereum result peer field struct for json parsing
-type OpenEthereumPeer struct {
-	//Peer client ID
-	Id string `json:"id"`
-}
-
-//OpenEthereum result peer network field struct for json parsing
-type OpenEthereumPeerNetwork struct {
-	//Peer local IP address
-	localAddress string
-	//Peer remote IP address
-	remoteAddress string
+	//Status of each configured L1 node
+	l1Nodes []*l1NodeStatus
 }
 
 //Log structure for passing messages on healthChan to logger
@@ -202,12 +154,11 @@ func newConfig(registry metrics.Registry) *configStruct {
 	const loopDelayTimer = 1 * time.Second
 	const defaultHealthCheckPort = "8080"
 
-	//OpenEthereum health configuration
+	//L1 node health configuration
 	const requestTimeout = 10 * time.Second
 	const blockSyncDifference = 10
 	const peerMinimum = 1
-	const blockUpdateTimeout = 45 * time.Second
-	const printRequests = false
+	const maxBlockAge = 2 * time.Minute
 	const printConfigMsg = false
 
 	//Load configuration into struct
@@ -228,12 +179,12 @@ func newConfig(registry metrics.Registry) *configStruct {
 	config.successCode = defaultSuccessCode
 	config.blockDifferenceTolerance = defaultBlockDifferenceTolerance
 
-	config.openethereumAPI = ""
+	config.l1Endpoints = nil
+	config.l1ChainID = nil
 	config.requestTimeout = requestTimeout
 	config.blockSyncDifference = blockSyncDifference
 	config.peerMinimum = peerMinimum
-	config.blockUpdateTimeout = blockUpdateTimeout
-	config.printRequests = printRequests
+	config.maxBlockAge = maxBlockAge
 	config.printConfigMsg = printConfigMsg
 
 	return &config
@@ -244,25 +195,27 @@ func newAsyncUpstream(state *healthState, config *configStruct) *asyncDataStruct
 	asyncData := asyncDataStruct{}
 	//Allocate memory for healthcheck map
 	asyncData.healthchecks = make(map[string]healthcheck.Check)
-	if config.openethereumAPI != "" {
-		//Request eth_syncing status from OpenEthereum
-		asyncData.healthchecks["ethSyncCheck"] = ethSyncCheck(config, &asyncData)
-
-		//Request eth_syncing status from OpenEthereum
-		asyncData.healthchecks["parityNetPeersCheck"] = netPeersCheck(config, &asyncData)
+	if len(config.l1Endpoints) > 0 {
+		for i, endpoint := range config.l1Endpoints {
+			node := &l1NodeStatus{url: endpoint}
+			asyncData.l1Nodes = append(asyncData.l1Nodes, node)
+			prefix := l1NodeCheckPrefix(i)
 
-		//Check OpenEthereum has more than peerMinimum peers currently connected to it
-		asyncData.healthchecks["minimumPeersCheck"] = openEthereumPeerCount(config, &asyncData)
+			//Poll the L1 node with standard RPCs, detecting its client from web3_clientVersion
+			asyncData.healthchecks[prefix+"api"] = l1NodeAPICheck(config, node)
 
-		//Check OpenEthereum is refreshing its currentBlock quicker than the blockUpdateTimeout
-		asyncData.healthchecks["blockRefreshCheck"] = openEthereumBlockUpdateCheck(config, &asyncData)
+			//Check if the L1 node is within blockSyncDifference from the highest block
+			asyncData.healthchecks[prefix+"sync"] = l1NodeSyncCheck(config, node)
 
-		//Check if OpenEthereum is within blockSyncDifference from the estimated block
-		asyncData.healthchecks["blockSyncCheck"] = openEthereumBlockSyncCheck(config, &asyncData)
+			//Check the L1 node has at least peerMinimum peers currently connected to it
+			asyncData.healthchecks[prefix+"peer"] = l1NodePeerCheck(config, node)
 
-		//Check if the OpenEthereum API is accepting pings
-		asyncData.healthchecks["tcpDialCheck"] = openEthereumTCPDialCheck(config, &asyncData)
+			//Check the L1 node's latest block is younger than maxBlockAge
+			asyncData.healthchecks[prefix+"block_age"] = l1NodeBlockAgeCheck(config, node)
 
+			//Check the L1 node is on the expected chain
+			asyncData.healthchecks[prefix+"chain_id"] = l1NodeChainIDCheck(config, node)
+		}
 	} else {
 		//Check the healthcheck endpoint for OpenEthereum
 		asyncData.healthchecks["checkOpenethereum"] = checkEndpoint(config, &config.openethereumHealthcheckRPC, &config.openethereumHealthcheckRPCPort)
@@ -277,6 +230,11 @@ func newAsyncUpstream(state *healthState, config *configStruct) *asyncDataStruct
 	return &asyncData
 }
 
+//Prefix of the names of the checks for the L1 node at index i
+func l1NodeCheckPrefix(i int) string {
+	return "l1_node_" + strconv.Itoa(i) + "_"
+}
+
 //Initialize health state storage
 func newHealthState() *healthState {
 	state := healthState{}
@@ -378,17 +336,23 @@ func updateConfig(config *configStruct, logMessage Log) {
 	if logMessage.Var == "peerMinimum" {
 		config.peerMinimum = int(logMessage.ValInt)
 	}
-	if logMessage.Var == "blockUpdateTimeout" {
-		config.blockUpdateTimeout = logMessage.ValTime
-	}
-	if logMessage.Var == "printRequests" {
-		config.printRequests = logMessage.ValBool
+	if logMessage.Var == "l1MaxBlockAge" {
+		config.maxBlockAge = logMessage.ValTime
 	}
 	if logMessage.Var == "printConfigMsg" {
 		config.printConfigMsg = logMessage.ValBool
 	}
-	if logMessage.Var == "openEthereumAPI" {
-		config.openethereumAPI = logMessage.ValStr
+	//openEthereumAPI is kept as an alias for l1Endpoint
+	if logMessage.Var == "l1Endpoint" || logMessage.Var == "openEthereumAPI" {
+		for _, endpoint := range config.l1Endpoints {
+			if endpoint == logMessage.ValStr {
+				return
+			}
+		}
+		config.l1Endpoints = append(config.l1Endpoints, logMessage.ValStr)
+	}
+	if logMessage.Var == "l1ChainID" {
+		config.l1ChainID = logMessage.ValBigInt
 	}
 	if logMessage.Var == "healthcheckMetrics" {
 		config.healthcheckMetrics = logMessage.ValBool
@@ -401,291 +365,6 @@ func updateConfig(config *configStruct, logMessage Log) {
 	}
 }
 
-//Resolve the IP of the OpenEthereum node and check if it can be dialed
-func openEthereumTCPDialCheck(config *configStruct, asyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		//Parse the URL to extract the hostname and port
-		u, err := url.Parse(config.openethereumAPI)
-		if err != nil {
-			return err
-		}
-
-		//Lookup the IP address of the hostname
-		ipAddr, err := net.LookupIP(u.Hostname())
-		if err != nil {
-			return err
-		}
-
-		//Extract the port from the URL
-		port := u.Port()
-
-		//Default to port 80 if no port is provided
-		if port == "" {
-			port = "80"
-		}
-
-		//Set a timeout on the TCP dialer
-		d := net.Dialer{Timeout: config.requestTimeout}
-
-		//Dial the IP address
-		conn, err := d.Dial("tcp", ipAddr[0].String()+":"+port)
-		if err != nil {
-			return err
-		}
-
-		//Close the connection before returning
-		return conn.Close()
-	}, config.pollingRate)
-	return check
-}
-
-//Send the call defined in jsonRequest to the OpenEthereum server
-func openEthereumCall(config *configStruct, jsonRequest []byte) ([]byte, error) {
-	//Generate POST request to OpenEthereum
-	req, err := http.NewRequest("POST", config.openethereumAPI,
-		bytes.NewBuffer(jsonRequest))
-	if err != nil {
-		return nil, err
-	}
-
-	//Set request headers to identify the healthcheck
-	req.Header.Set("X-Custom-Header", "openethereum-healthcheck-client")
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-
-	//Perform POST request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	//Decode reponse into a string for ease of use
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	//Close the connection after the response
-	if err := resp.Body.Close(); err != nil {
-		return nil, err
-	}
-	return body, err
-}
-
-//Request the eth_syncing status from the OpenEthereum server and parse it into a state array
-func ethSyncCheck(config *configStruct, aSyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		//OpenEthereum API call to send
-		var jsonRequest = []byte(`{"method":"eth_syncing","params":[],"id":1,"jsonrpc":"2.0"}`)
-
-		//Send the call to OpenEthereum
-		respBody, err := openEthereumCall(config, jsonRequest)
-
-		aSyncData.mu.Lock()
-		defer aSyncData.mu.Unlock()
-
-		if err != nil {
-			aSyncData.ethSyncResp.respBody = "failed"
-			return err
-		}
-
-		//Convert the response from a byte slice to a string
-		aSyncData.ethSyncResp.respBody = string(respBody)
-
-		//Check if OpenEthereum is not currently syncing
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `"result": false`) {
-			return nil
-		}
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `failed`) {
-			err := fmt.Errorf("GET request failed")
-			return err
-		}
-
-		//If OpenEthereum is currently syncing, parse the response
-		err = json.Unmarshal(respBody, &aSyncData.ethSyncResp)
-		if err != nil {
-			return err
-		}
-
-		return err
-	}, config.pollingRate)
-	return check
-}
-
-//Request the netPeers status from the OpenEthereum server and parse it into a state array
-func netPeersCheck(config *configStruct, aSyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		//OpenEthereum API call to send
-		var jsonRequest = []byte(`{"method":"parity_netPeers","params":[],"id":1,"jsonrpc":"2.0"}`)
-
-		//Send the call to OpenEthereum
-		respBody, err := openEthereumCall(config, jsonRequest)
-
-		aSyncData.mu.Lock()
-		defer aSyncData.mu.Unlock()
-
-		if err != nil {
-			aSyncData.ethSyncResp.respBody = "failed"
-			return err
-		}
-
-		//Convert the response from a byte slice to a string
-		aSyncData.parityNetPeersResp.respBody = string(respBody)
-
-		//Check if the netPeers response is unsupported by the OpenEthereum node
-		if strings.Contains(aSyncData.parityNetPeersResp.respBody, "Unsupported method") {
-			aSyncData.ethSyncResp.respBody = "failed"
-			return nil
-		}
-
-		//Parse the response into a struct
-		err = json.Unmarshal(respBody, &aSyncData.parityNetPeersResp)
-		if err != nil {
-			return err
-		}
-
-		return err
-	}, config.pollingRate)
-	return check
-}
-
-//Check that OpenEthereum has more than minimumPeers currently connected to it
-func openEthereumPeerCount(config *configStruct, aSyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		aSyncData.mu.Lock()
-		defer aSyncData.mu.Unlock()
-		//Check if the netPeers response is unsupported by the OpenEthereum node
-		if strings.Contains(aSyncData.parityNetPeersResp.respBody, "Unsupported method") {
-			return nil
-		}
-
-		//Check if GET request to OpenEthereum failed
-		if strings.Contains(aSyncData.parityNetPeersResp.respBody, `failed`) {
-			err := fmt.Errorf("GET request failed")
-			return err
-		}
-
-		//Compare currently connected peers to config struct
-		if aSyncData.parityNetPeersResp.Result.Connected < config.peerMinimum {
-			err := fmt.Errorf("minimumPeers :%d",
-				aSyncData.parityNetPeersResp.Result.Connected)
-			return err
-		}
-
-		return nil
-	}, config.pollingRate)
-	return check
-}
-
-//Check that the block OpenEthereum is on is updating at a rate faster then config.blockUpdateTimeout
-func openEthereumBlockUpdateCheck(config *configStruct, aSyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		aSyncData.mu.Lock()
-		defer aSyncData.mu.Unlock()
-		//Pause to allow request to be captured
-		time.Sleep(2 * time.Second)
-
-		//Check if OpenEthereum is not currently syncing
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `"result": false`) {
-			return nil
-		}
-
-		//Check if the call to OpenEthereum failed
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `failed`) {
-			err := fmt.Errorf("GET request failed")
-			return err
-		}
-
-		//Retrieve current block from response struct
-		currentBlock := aSyncData.ethSyncResp.Result.CurrentBlock
-
-		//Retrieve snapshot status
-		warpBlock := aSyncData.ethSyncResp.Result.WarpChunksProcessed
-
-		//Wait the blockUpdateTimeout
-		time.Sleep(config.blockUpdateTimeout)
-
-		//Check if the new block is equal to the old block
-		if currentBlock == aSyncData.ethSyncResp.Result.CurrentBlock {
-			if warpBlock == aSyncData.ethSyncResp.Result.WarpChunksProcessed {
-				err := fmt.Errorf("currentBlock/warpBlock have not refreshed within timeout")
-				return err
-			}
-		}
-
-		return nil
-	}, 2*config.blockUpdateTimeout)
-	return check
-}
-
-//Helper function for openEthereumBlockUpdateCheck to calculate the block difference in OpenEthereum's response
-func openEthereumBlockDifference(aSyncData *asyncDataStruct) (int64, error) {
-	aSyncData.mu.Lock()
-	defer aSyncData.mu.Unlock()
-	//Check if OpenEthereum is not currently syncing
-	if strings.Contains(aSyncData.ethSyncResp.respBody, `"result":false`) {
-		return 0, nil
-	}
-
-	//Check if the GET request to OpenEthereum failed
-	if strings.Contains(aSyncData.ethSyncResp.respBody, `failed`) {
-		err := fmt.Errorf("GET request failed")
-		return 0, err
-	}
-
-	//Convert the hex string to an integer
-	currentBlockInt, err := strconv.ParseInt(strings.Replace(
-		aSyncData.ethSyncResp.Result.CurrentBlock, "0x", "", -1), 16, 64)
-	if err != nil {
-		return -1, err
-	}
-
-	//Convert the hex string to an integer
-	highestBlockInt, err := strconv.ParseInt(strings.Replace(
-		aSyncData.ethSyncResp.Result.HighestBlock, "0x", "", -1), 16, 64)
-	if err != nil {
-		return -1, err
-	}
-
-	//Calculate how many blocks behind OpenEthereum is
-	blockDifference := highestBlockInt - currentBlockInt
-
-	return blockDifference, nil
-}
-
-//Check the current OpenEthereum block versus the expected block it should be at
-func openEthereumBlockSyncCheck(config *configStruct, aSyncData *asyncDataStruct) healthcheck.Check {
-	check := healthcheck.Async(func() error {
-		aSyncData.mu.Lock()
-		defer aSyncData.mu.Unlock()
-		//Check if OpenEthereum is not currently syncing
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `"result": false`) {
-			return nil
-		}
-
-		//Check if the GET request failed
-		if strings.Contains(aSyncData.ethSyncResp.respBody, `failed`) {
-			err := fmt.Errorf("GET request failed")
-			return err
-		}
-
-		//Retrieve the current block difference between the estimated block and the current block
-		currentBlockDifference, err := openEthereumBlockDifference(aSyncData)
-		if err != nil {
-			return err
-		}
-
-		//Compare to blockSyncDifference
-		if currentBlockDifference > config.blockSyncDifference {
-			err := fmt.Errorf("blockDifference :%d",
-				currentBlockDifference)
-			return err
-		}
-
-		return nil
-	}, config.pollingRate)
-	return check
-}
-
 //Asynchronously check a healthcheck endpoint to determine its status
 func checkEndpoint(config *configStruct, endpoint *string, port *string) healthcheck.Check {
 	check := healthcheck.Async(func() error {
@@ -768,32 +447,18 @@ func nodeReadinessChecks(health healthcheck.Handler, config *configStruct, httpM
 		"inbox_reader_status",
 		asyncData.healthchecks["inboxReaderStatus"])
 
-	//OpenEthereum healthchecks
+	//L1 node healthchecks
 	//Add healthchecks to the readiness check if they are not disabled
 	if !config.disableOpenEthereumCheck {
-		if config.openethereumAPI != "" {
-			health.AddReadinessCheck(
-				"openethereum_api_status",
-				asyncData.healthchecks["tcpDialCheck"])
-			health.AddReadinessCheck(
-				"openethereum_sync_response_status",
-				asyncData.healthchecks["ethSyncCheck"])
-
-			health.AddReadinessCheck(
-				"openethereum_netpeers_response_status",
-				asyncData.healthchecks["parityNetPeersCheck"])
-
-			health.AddReadinessCheck(
-				"openethereum_sync_status",
-				asyncData.healthchecks["blockSyncCheck"])
-
-			health.AddReadinessCheck(
-				"openethereum_peer_status",
-				asyncData.healthchecks["minimumPeersCheck"])
-
-			health.AddReadinessCheck(
-				"openethereum_block_refresh_status",
-				asyncData.healthchecks["blockRefreshCheck"])
+		if len(config.l1Endpoints) > 0 {
+			for i := range config.l1Endpoints {
+				prefix := l1NodeCheckPrefix(i)
+				for _, check := range []string{"api", "sync", "peer", "block_age", "chain_id"} {
+					health.AddReadinessCheck(
+						prefix+check+"_status",
+						asyncData.healthchecks[prefix+check])
+				}
+			}
 		} else {
 			health.AddReadinessCheck(
 				"openethereum_status",
@@ -814,7 +479,7 @@ func waitConfig(config *configStruct) {
 	for {
 		if config.init {
 			if config.disableOpenEthereumCheck || config.healthcheckRPC == "" ||
-				config.openethereumAPI != "" || config.openethereumHealthcheckRPC != "" {
+				len(config.l1Endpoints) > 0 || config.openethereumHealthcheckRPC != "" {
 				return
 			}
 		}
@@ -830,7 +495,7 @@ func waitConfig(config *configStruct) {
 }
 
 //Start the healthcheck
-func startHealthCheck(ctx context.Context, config *configStruct, state *healthState) error {
+func startHealthCheck(ctx context.Context, config *configStruct, state *healthState, components *Components) error {
 	//Create the main healthcheck handler
 	health := NewMetricsHandler(metrics.DefaultRegistry, "arbitrum")
 
@@ -852,6 +517,12 @@ func startHealthCheck(ctx context.Context, config *configStruct, state *healthSt
 	//Create an endpoint to serve the liveness check
 	httpMux.HandleFunc("/live", health.LiveEndpoint)
 
+	//Report the node healthchecks as components on /readyz alongside the binary's own checks
+	if components != nil {
+		health = componentHandler{Handler: health, components: components}
+		components.Register(httpMux)
+	}
+
 	//Define which healthchecks to use for the readiness API and expose the readiness API
 	nodeReadinessChecks(health, config, httpMux, asyncUpstream)
 
@@ -884,6 +555,12 @@ func startHealthCheck(ctx context.Context, config *configStruct, state *healthSt
 
 // NodeHealthCheck Create a node healthcheck that listens on the given channel
 func StartNodeHealthCheck(ctx context.Context, logMsgChan <-chan Log, registry metrics.Registry) error {
+	return StartNodeHealthCheckWithComponents(ctx, logMsgChan, registry, nil)
+}
+
+// StartNodeHealthCheckWithComponents Create a node healthcheck that listens on the given
+// channel and also serves /livez and /readyz for the given components
+func StartNodeHealthCheckWithComponents(ctx context.Context, logMsgChan <-chan Log, registry metrics.Registry, components *Components) error {
 	//Create the configuration struct
 	state := newHealthState()
 
@@ -894,7 +571,7 @@ func StartNodeHealthCheck(ctx context.Context, logMsgChan <-chan Log, registry m
 	go logger(ctx, config, state, logMsgChan)
 
 	//Start the node healthcheck
-	err := startHealthCheck(ctx, config, state)
+	err := startHealthCheck(ctx, config, state, components)
 
 	return err
 }
@@ -44,6 +44,7 @@ type testConfigStruct struct {
 	inboxReaderName   string
 	failServerPort    string
 	passServerPort    string
+	l1NodePort        string
 }
 
 func newTestConfig() *testConfigStruct {
@@ -62,6 +63,7 @@ func newTestConfig() *testConfigStruct {
 	const inboxReaderName = "InboxReader"
 	const failServerPort = "8088"
 	const passServerPort = "8089"
+	const l1NodePort = "8090"
 
 	testConfig.successfulStatus = successfulStatus
 	testConfig.verbose = verbose
@@ -75,6 +77,7 @@ func newTestConfig() *testConfigStruct {
 	testConfig.inboxReaderName = inboxReaderName
 	testConfig.failServerPort = failServerPort
 	testConfig.passServerPort = passServerPort
+	testConfig.l1NodePort = l1NodePort
 
 	return &testConfig
 }
@@ -109,8 +112,12 @@ func startTestingServerPass(testConfig *testConfigStruct) {
 	http.ListenAndServe("127.0.0.1:"+testConfig.passServerPort, httpMux)
 }
 
-func setOpenEthereumEndpoint(healthChan chan Log) {
-	healthChan <- Log{Config: true, Var: "openEthereumAPI", ValStr: "https://eth-kovan.alchemyapi.io/v2/yvzMZUhX0jmdpRfqrUEGwh--U59mJNhf"}
+func startTestingL1Node(testConfig *testConfigStruct) {
+	http.ListenAndServe("127.0.0.1:"+testConfig.l1NodePort, newFakeL1Node("Geth/v1.10.8-stable/linux-amd64/go1.16.4"))
+}
+
+func setL1Endpoint(testConfig *testConfigStruct, healthChan chan Log) {
+	healthChan <- Log{Config: true, Var: "l1Endpoint", ValStr: "http://127.0.0.1:" + testConfig.l1NodePort}
 }
 
 func setNodeHealthBaseConfig(healthChan chan Log) {
@@ -184,7 +191,7 @@ func startUpDelayTest(testConfig *testConfigStruct, healthChan chan Log) error {
 	if testConfig.verbose {
 		fmt.Println("The healthcheck should be running after the OE endpoint is set")
 	}
-	setOpenEthereumEndpoint(healthChan)
+	setL1Endpoint(testConfig, healthChan)
 	err = healthEndpointStatus(testConfig, "available", healthChan)
 	if err != nil {
 		return err
@@ -329,7 +336,7 @@ func disablePrimaryCheckTest(testConfig *testConfigStruct, healthChan chan Log)
 	healthChan <- Log{Config: true, Var: "disableOpenEthereumCheck", ValBool: false}
 	healthChan <- Log{Config: true, Var: "healthcheckMetrics", ValBool: false}
 	healthChan <- Log{Config: true, Var: "healthcheckRPC", ValStr: "127.0.0.1:8087"}
-	setOpenEthereumEndpoint(healthChan)
+	setL1Endpoint(testConfig, healthChan)
 	Init(healthChan)
 
 	if testConfig.verbose {
@@ -347,7 +354,7 @@ func disablePrimaryCheckTest(testConfig *testConfigStruct, healthChan chan Log)
 	if ok {
 		return errors.New("Primary healthcheck still present after being disabled")
 	}
-	_, ok = respMap["openethereum_api_status"]
+	_, ok = respMap["l1_node_0_api_status"]
 	if !ok {
 		return errors.New("OpenEthereum healthcheck improperly disabled")
 	}
@@ -368,7 +375,7 @@ func retrieveVerifyOpenEthereumDisabled(testConfig *testConfigStruct, healthChan
 	if testConfig.verbose {
 		fmt.Println("Check if the response contains the OpenEthereum healthcheck")
 	}
-	_, ok := respMap["openethereum_api_status"]
+	_, ok := respMap["l1_node_0_api_status"]
 	if ok {
 		return errors.New("OpenEthereum healthcheck still present after being disabled")
 	}
@@ -401,7 +408,7 @@ func disableOpenEthereumCheckTest(testConfig *testConfigStruct, healthChan chan
 	if testConfig.verbose {
 		fmt.Println("Verify setting the OpenEthereum endpoint does not affect the check being disabled")
 	}
-	setOpenEthereumEndpoint(healthChan)
+	setL1Endpoint(testConfig, healthChan)
 
 	err = retrieveVerifyOpenEthereumDisabled(testConfig, healthChan)
 	if err != nil {
@@ -437,7 +444,7 @@ func disableOpenEthereumPrimaryCheckTest(testConfig *testConfigStruct, healthCha
 	if ok {
 		return errors.New("Primary healthcheck still present after being disabled")
 	}
-	_, ok = respMap["openethereum_api_status"]
+	_, ok = respMap["l1_node_0_api_status"]
 	if ok {
 		return errors.New("OpenEthereum healthcheck improperly disabled")
 	}
@@ -665,6 +672,7 @@ func TestNodeHealth(t *testing.T) {
 	//Generate sample servers for testing
 	go startTestingServerFail(testConfig)
 	go startTestingServerPass(testConfig)
+	go startTestingL1Node(testConfig)
 
 	//Start the healthcheck server with a background context for testing
 	ctx, cancel := context.WithCancel(context.Background())
@@ -0,0 +1,344 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const (
+	manifestName = "manifest.json"
+	dbPrefix     = "db/"
+
+	// Suffix of the file recording an imported snapshot until it's verified
+	pendingSuffix = ".snapshot.json"
+)
+
+func hashFile(filename string) (common.Hash, int64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return common.Hash{}, 0, errors.WithStack(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return common.Hash{}, 0, errors.WithStack(err)
+	}
+	return sum(h), size, nil
+}
+
+func sum(h hash.Hash) common.Hash {
+	var ret common.Hash
+	copy(ret[:], h.Sum(nil))
+	return ret
+}
+
+// WriteArchive writes a gzipped tar archive of the database at dbPath to w,
+// recording the files in the manifest. The database must not be open.
+func WriteArchive(w io.Writer, dbPath string, m *Manifest) error {
+	m.Files = nil
+	err := filepath.Walk(dbPath, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dbPath, filename)
+		if err != nil {
+			return err
+		}
+		hash, size, err := hashFile(filename)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, File{Path: filepath.ToSlash(rel), Size: size, SHA256: hash})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error reading database")
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+
+	manifestData, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err = tw.WriteHeader(&tar.Header{
+		Name: manifestName,
+		Mode: 0600,
+		Size: int64(len(manifestData)),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := tw.Write(manifestData); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, file := range m.Files {
+		if err := writeArchiveFile(tw, dbPath, file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(gz.Close())
+}
+
+func writeArchiveFile(tw *tar.Writer, dbPath string, file File) error {
+	f, err := os.Open(filepath.Join(dbPath, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	err = tw.WriteHeader(&tar.Header{
+		Name: dbPrefix + file.Path,
+		Mode: 0600,
+		Size: file.Size,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Hash again while copying in case the file changed since the manifest
+	// was written
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, file.Size); err != nil {
+		return errors.Wrapf(err, "error archiving %v", file.Path)
+	}
+	if sum(h) != file.SHA256 {
+		return errors.Errorf("%v changed while writing snapshot", file.Path)
+	}
+	return nil
+}
+
+// ReadArchive extracts the archive in r into the directory dir, checking each
+// file against the manifest at the start of the archive
+func ReadArchive(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading snapshot")
+	}
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading snapshot")
+	}
+	if header.Name != manifestName {
+		return nil, errors.New("snapshot doesn't start with manifest")
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, errors.Wrap(err, "error reading snapshot manifest")
+	}
+	if m.Version != ManifestVersion {
+		return nil, errors.Errorf("unsupported snapshot version %v", m.Version)
+	}
+
+	expected := make(map[string]File)
+	for _, file := range m.Files {
+		expected[file.Path] = file
+	}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading snapshot")
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, errors.Errorf("unexpected entry %v in snapshot", header.Name)
+		}
+		name := strings.TrimPrefix(header.Name, dbPrefix)
+		file, ok := expected[name]
+		if !ok || name == header.Name || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return nil, errors.Errorf("unexpected file %v in snapshot", header.Name)
+		}
+		delete(expected, name)
+		if err := extractFile(tr, dir, file); err != nil {
+			return nil, err
+		}
+	}
+	for name := range expected {
+		return nil, errors.Errorf("snapshot is missing %v", name)
+	}
+	return &m, nil
+}
+
+func extractFile(r io.Reader, dir string, file File) error {
+	filename := filepath.Join(dir, filepath.FromSlash(file.Path))
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	// Read one byte past the expected size to detect oversized entries
+	size, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, file.Size+1))
+	if err != nil {
+		return errors.Wrapf(err, "error extracting %v", file.Path)
+	}
+	if size != file.Size {
+		return errors.Errorf("%v has size %v but manifest has %v", file.Path, size, file.Size)
+	}
+	if sum(h) != file.SHA256 {
+		return errors.Errorf("%v doesn't match checksum in manifest", file.Path)
+	}
+	return nil
+}
+
+func openSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, err := os.Open(source)
+		return f, errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("error downloading snapshot: %v", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func dbExists(dbPath string) (bool, error) {
+	entries, err := ioutil.ReadDir(dbPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return len(entries) > 0, nil
+}
+
+func readPending(dbPath string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(dbPath + pendingSuffix)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, errors.Wrap(err, "error reading pending snapshot manifest")
+	}
+	return &m, nil
+}
+
+// Import creates the database at dbPath from the snapshot at source, which is
+// either a file or an http(s) URL. The returned manifest must be checked with
+// Verify once the database is open, and the import then confirmed with
+// MarkVerified. If a database already exists, nothing is imported and Import
+// returns the manifest of a previous import that hasn't been verified, or nil.
+// A database that fails verification is left in place and never marked
+// verified, so the node refuses to run on it until it's removed.
+func Import(ctx context.Context, source string, dbPath string) (*Manifest, error) {
+	exists, err := dbExists(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		m, err := readPending(dbPath)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			logger.Info().Str("path", dbPath).Msg("database already exists, skipping snapshot import")
+		}
+		return m, nil
+	}
+
+	logger.Info().Str("source", source).Msg("importing database snapshot")
+	r, err := openSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dbPath), filepath.Base(dbPath)+".import")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	m, err := ReadArchive(r, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	manifestData, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := ioutil.WriteFile(dbPath+pendingSuffix, manifestData, 0600); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Remove the empty directory if there is one
+	_ = os.Remove(dbPath)
+	if err := os.Rename(tmpDir, dbPath); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	logger.Info().
+		Str("messageCount", m.MessageCount.String()).
+		Str("machineHash", m.MachineHash.String()).
+		Msg("imported database snapshot")
+	return m, nil
+}
+
+// MarkVerified records that the snapshot imported at dbPath has been verified
+func MarkVerified(dbPath string) error {
+	err := os.Remove(dbPath + pendingSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
@@ -0,0 +1,227 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+)
+
+// Number of blocks to search at a time when looking for the last batch
+// contained in a database
+const batchSearchBlocks = 5000
+
+// L1Inbox is the view of the rollup's inboxes on L1 used to check snapshots
+type L1Inbox interface {
+	GetCountsAndAccumulators(ctx context.Context) (delayed, seq ethbridge.CountAndAccumulator, err error)
+	GetBatchCount(ctx context.Context) (*big.Int, error)
+	GetBatchAccumulator(ctx context.Context, batchIndex *big.Int) (common.Hash, error)
+	GetDelayedAccumulator(ctx context.Context, index *big.Int) (common.Hash, error)
+	CurrentBlockHeight(ctx context.Context) (*big.Int, error)
+	LookupBatchesInRange(ctx context.Context, from, to *big.Int) ([]ethbridge.SequencerBatchRef, error)
+	FromBlock() int64
+}
+
+type l1Inbox struct {
+	*ethbridge.BridgeUtils
+	*ethbridge.SequencerInboxWatcher
+	delayedBridge *ethbridge.DelayedBridgeWatcher
+}
+
+// NewL1Inbox looks up the inbox contracts of the given rollup
+func NewL1Inbox(
+	ctx context.Context,
+	client ethutils.EthClient,
+	rollupAddress common.Address,
+	fromBlock int64,
+	bridgeUtilsAddress common.Address,
+) (L1Inbox, error) {
+	rollup, err := ethbridge.NewRollupWatcher(rollupAddress.ToEthAddress(), fromBlock, client, bind.CallOpts{})
+	if err != nil {
+		return nil, err
+	}
+	delayedBridgeAddress, err := rollup.DelayedBridge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	delayedBridge, err := ethbridge.NewDelayedBridgeWatcher(delayedBridgeAddress.ToEthAddress(), fromBlock, client)
+	if err != nil {
+		return nil, err
+	}
+	sequencerAddress, err := rollup.SequencerBridge(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sequencerInbox, err := ethbridge.NewSequencerInboxWatcher(sequencerAddress.ToEthAddress(), client)
+	if err != nil {
+		return nil, err
+	}
+	bridgeUtils, err := ethbridge.NewBridgeUtils(bridgeUtilsAddress.ToEthAddress(), client, delayedBridge, sequencerInbox)
+	if err != nil {
+		return nil, err
+	}
+	return &l1Inbox{
+		BridgeUtils:           bridgeUtils,
+		SequencerInboxWatcher: sequencerInbox,
+		delayedBridge:         delayedBridge,
+	}, nil
+}
+
+func (l *l1Inbox) GetDelayedAccumulator(ctx context.Context, index *big.Int) (common.Hash, error) {
+	acc, err := l.delayedBridge.GetAccumulator(ctx, index, nil)
+	return acc, errors.WithStack(err)
+}
+
+func (l *l1Inbox) FromBlock() int64 {
+	return l.delayedBridge.FromBlock()
+}
+
+// FindVerifiedBatch returns the last sequencer batch on L1 whose messages are
+// all in db and whose accumulator matches it
+func FindVerifiedBatch(ctx context.Context, db Database, l1 L1Inbox) (BatchCheckpoint, error) {
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return BatchCheckpoint{}, err
+	}
+	if messageCount.Sign() == 0 {
+		return BatchCheckpoint{Index: big.NewInt(0), MessageCount: big.NewInt(0)}, nil
+	}
+
+	// The database is usually at or past the latest batch, so check that first
+	_, seq, err := l1.GetCountsAndAccumulators(ctx)
+	if err != nil {
+		return BatchCheckpoint{}, err
+	}
+	if seq.Count.Sign() > 0 && seq.Count.Cmp(messageCount) <= 0 {
+		dbAcc, err := lastAcc(seq.Count, db.GetInboxAcc)
+		if err != nil {
+			return BatchCheckpoint{}, err
+		}
+		batchCount, err := l1.GetBatchCount(ctx)
+		if err != nil {
+			return BatchCheckpoint{}, err
+		}
+		if dbAcc == seq.Accumulator && batchCount.Sign() > 0 {
+			lastBatch := new(big.Int).Sub(batchCount, big.NewInt(1))
+			batchAcc, err := l1.GetBatchAccumulator(ctx, lastBatch)
+			if err != nil {
+				return BatchCheckpoint{}, err
+			}
+			// Otherwise a batch was posted in between the two lookups
+			if batchAcc == seq.Accumulator {
+				return BatchCheckpoint{Index: lastBatch, MessageCount: seq.Count, Acc: seq.Accumulator}, nil
+			}
+		}
+	}
+
+	fromBlock := big.NewInt(l1.FromBlock())
+	to, err := l1.CurrentBlockHeight(ctx)
+	if err != nil {
+		return BatchCheckpoint{}, err
+	}
+	for to.Cmp(fromBlock) >= 0 {
+		from := new(big.Int).Sub(to, big.NewInt(batchSearchBlocks-1))
+		if from.Cmp(fromBlock) < 0 {
+			from = fromBlock
+		}
+		batches, err := l1.LookupBatchesInRange(ctx, from, to)
+		if err != nil {
+			return BatchCheckpoint{}, err
+		}
+		for i := len(batches) - 1; i >= 0; i-- {
+			batch := batches[i]
+			if batch.GetAfterCount().Sign() == 0 || batch.GetAfterCount().Cmp(messageCount) > 0 {
+				continue
+			}
+			dbAcc, err := lastAcc(batch.GetAfterCount(), db.GetInboxAcc)
+			if err != nil {
+				return BatchCheckpoint{}, err
+			}
+			if dbAcc != batch.GetAfterAcc() {
+				logger.Warn().
+					Str("batch", batch.GetBatchIndex().String()).
+					Msg("database doesn't match sequencer batch on L1")
+				continue
+			}
+			return BatchCheckpoint{
+				Index:        batch.GetBatchIndex(),
+				MessageCount: batch.GetAfterCount(),
+				Acc:          batch.GetAfterAcc(),
+			}, nil
+		}
+		to = new(big.Int).Sub(from, big.NewInt(1))
+	}
+	return BatchCheckpoint{}, errors.New("no sequencer batch on L1 matches the database")
+}
+
+// VerifyL1 checks that the verified batch and delayed messages in the
+// manifest match the inboxes on L1
+func VerifyL1(ctx context.Context, l1 L1Inbox, m *Manifest) error {
+	delayed, seq, err := l1.GetCountsAndAccumulators(ctx)
+	if err != nil {
+		return err
+	}
+	if m.VerifiedBatch.MessageCount.Sign() > 0 {
+		if seq.Count.Cmp(m.VerifiedBatch.MessageCount) < 0 {
+			return errors.Errorf(
+				"L1 sequencer inbox has %v messages but snapshot requires %v",
+				seq.Count,
+				m.VerifiedBatch.MessageCount,
+			)
+		}
+		batchAcc, err := l1.GetBatchAccumulator(ctx, m.VerifiedBatch.Index)
+		if err != nil {
+			return err
+		}
+		if batchAcc != m.VerifiedBatch.Acc {
+			return errors.Errorf(
+				"snapshot inbox accumulator %v doesn't match L1 batch %v accumulator %v",
+				m.VerifiedBatch.Acc,
+				m.VerifiedBatch.Index,
+				batchAcc,
+			)
+		}
+	}
+	if m.DelayedMessageCount.Sign() > 0 {
+		if delayed.Count.Cmp(m.DelayedMessageCount) < 0 {
+			return errors.Errorf(
+				"L1 delayed inbox has %v messages but snapshot has %v",
+				delayed.Count,
+				m.DelayedMessageCount,
+			)
+		}
+		delayedAcc, err := l1.GetDelayedAccumulator(ctx, new(big.Int).Sub(m.DelayedMessageCount, big.NewInt(1)))
+		if err != nil {
+			return err
+		}
+		if delayedAcc != m.DelayedInboxAcc {
+			return errors.Errorf(
+				"snapshot delayed inbox accumulator %v doesn't match L1 accumulator %v",
+				m.DelayedInboxAcc,
+				delayedAcc,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package snapshot exports node databases as archives and bootstraps new
+// nodes from them. Each archive carries a manifest describing the inbox and
+// machine state it holds, which is checked against both the imported database
+// and L1 before the node resumes reading the inbox.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "snapshot").Logger()
+
+const ManifestVersion = 1
+
+// Database is the subset of ArbCore needed to describe and verify a snapshot
+type Database interface {
+	GetMessageCount() (*big.Int, error)
+	GetInboxAcc(index *big.Int) (common.Hash, error)
+	GetDelayedMessageCount() (*big.Int, error)
+	GetDelayedInboxAcc(index *big.Int) (common.Hash, error)
+	GetLastMachineTotalGas() (*big.Int, error)
+	GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error)
+}
+
+// BatchCheckpoint identifies the last sequencer batch on L1 that the snapshot
+// contains in full
+type BatchCheckpoint struct {
+	Index        *big.Int
+	MessageCount *big.Int
+	Acc          common.Hash
+}
+
+type File struct {
+	Path   string
+	Size   int64
+	SHA256 common.Hash
+}
+
+type Manifest struct {
+	Version            int
+	InitialMachineHash common.Hash
+
+	MessageCount        *big.Int
+	InboxAcc            common.Hash
+	DelayedMessageCount *big.Int
+	DelayedInboxAcc     common.Hash
+
+	// State of the last machine saved in the database
+	MachineGasUsed *big.Int
+	MachineHash    common.Hash
+	LogCount       *big.Int
+	SendCount      *big.Int
+
+	VerifiedBatch BatchCheckpoint
+
+	Files []File
+}
+
+type batchCheckpointJSON struct {
+	Index        *big.Int       `json:"index"`
+	MessageCount *big.Int       `json:"messageCount"`
+	Acc          ethcommon.Hash `json:"acc"`
+}
+
+type fileJSON struct {
+	Path   string         `json:"path"`
+	Size   int64          `json:"size"`
+	SHA256 ethcommon.Hash `json:"sha256"`
+}
+
+type manifestJSON struct {
+	Version             int                 `json:"version"`
+	InitialMachineHash  ethcommon.Hash      `json:"initialMachineHash"`
+	MessageCount        *big.Int            `json:"messageCount"`
+	InboxAcc            ethcommon.Hash      `json:"inboxAcc"`
+	DelayedMessageCount *big.Int            `json:"delayedMessageCount"`
+	DelayedInboxAcc     ethcommon.Hash      `json:"delayedInboxAcc"`
+	MachineGasUsed      *big.Int            `json:"machineGasUsed"`
+	MachineHash         ethcommon.Hash      `json:"machineHash"`
+	LogCount            *big.Int            `json:"logCount"`
+	SendCount           *big.Int            `json:"sendCount"`
+	VerifiedBatch       batchCheckpointJSON `json:"verifiedBatch"`
+	Files               []fileJSON          `json:"files"`
+}
+
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	files := make([]fileJSON, 0, len(m.Files))
+	for _, f := range m.Files {
+		files = append(files, fileJSON{Path: f.Path, Size: f.Size, SHA256: f.SHA256.ToEthHash()})
+	}
+	return json.Marshal(manifestJSON{
+		Version:             m.Version,
+		InitialMachineHash:  m.InitialMachineHash.ToEthHash(),
+		MessageCount:        m.MessageCount,
+		InboxAcc:            m.InboxAcc.ToEthHash(),
+		DelayedMessageCount: m.DelayedMessageCount,
+		DelayedInboxAcc:     m.DelayedInboxAcc.ToEthHash(),
+		MachineGasUsed:      m.MachineGasUsed,
+		MachineHash:         m.MachineHash.ToEthHash(),
+		LogCount:            m.LogCount,
+		SendCount:           m.SendCount,
+		VerifiedBatch: batchCheckpointJSON{
+			Index:        m.VerifiedBatch.Index,
+			MessageCount: m.VerifiedBatch.MessageCount,
+			Acc:          m.VerifiedBatch.Acc.ToEthHash(),
+		},
+		Files: files,
+	})
+}
+
+func (m *Manifest) UnmarshalJSON(data []byte) error {
+	var raw manifestJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.MessageCount == nil || raw.DelayedMessageCount == nil || raw.MachineGasUsed == nil ||
+		raw.LogCount == nil || raw.SendCount == nil || raw.VerifiedBatch.Index == nil ||
+		raw.VerifiedBatch.MessageCount == nil {
+		return errors.New("snapshot manifest is missing fields")
+	}
+	files := make([]File, 0, len(raw.Files))
+	for _, f := range raw.Files {
+		files = append(files, File{Path: f.Path, Size: f.Size, SHA256: common.NewHashFromEth(f.SHA256)})
+	}
+	*m = Manifest{
+		Version:             raw.Version,
+		InitialMachineHash:  common.NewHashFromEth(raw.InitialMachineHash),
+		MessageCount:        raw.MessageCount,
+		InboxAcc:            common.NewHashFromEth(raw.InboxAcc),
+		DelayedMessageCount: raw.DelayedMessageCount,
+		DelayedInboxAcc:     common.NewHashFromEth(raw.DelayedInboxAcc),
+		MachineGasUsed:      raw.MachineGasUsed,
+		MachineHash:         common.NewHashFromEth(raw.MachineHash),
+		LogCount:            raw.LogCount,
+		SendCount:           raw.SendCount,
+		VerifiedBatch: BatchCheckpoint{
+			Index:        raw.VerifiedBatch.Index,
+			MessageCount: raw.VerifiedBatch.MessageCount,
+			Acc:          common.NewHashFromEth(raw.VerifiedBatch.Acc),
+		},
+		Files: files,
+	}
+	return nil
+}
+
+func lastAcc(count *big.Int, lookup func(*big.Int) (common.Hash, error)) (common.Hash, error) {
+	if count.Sign() == 0 {
+		return common.Hash{}, nil
+	}
+	return lookup(new(big.Int).Sub(count, big.NewInt(1)))
+}
+
+// NewManifest describes the current state of db. The database files and
+// VerifiedBatch are filled in separately.
+func NewManifest(db Database) (*Manifest, error) {
+	initialCursor, err := db.GetExecutionCursor(big.NewInt(0))
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading initial machine")
+	}
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return nil, err
+	}
+	inboxAcc, err := lastAcc(messageCount, db.GetInboxAcc)
+	if err != nil {
+		return nil, err
+	}
+	delayedCount, err := db.GetDelayedMessageCount()
+	if err != nil {
+		return nil, err
+	}
+	delayedAcc, err := lastAcc(delayedCount, db.GetDelayedInboxAcc)
+	if err != nil {
+		return nil, err
+	}
+	gasUsed, err := db.GetLastMachineTotalGas()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := db.GetExecutionCursor(gasUsed)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading last machine")
+	}
+	return &Manifest{
+		Version:             ManifestVersion,
+		InitialMachineHash:  initialCursor.MachineHash(),
+		MessageCount:        messageCount,
+		InboxAcc:            inboxAcc,
+		DelayedMessageCount: delayedCount,
+		DelayedInboxAcc:     delayedAcc,
+		MachineGasUsed:      cursor.TotalGasConsumed(),
+		MachineHash:         cursor.MachineHash(),
+		LogCount:            cursor.TotalLogCount(),
+		SendCount:           cursor.TotalSendCount(),
+	}, nil
+}
+
+// VerifyDatabase checks that db holds the state described by the manifest
+func VerifyDatabase(db Database, m *Manifest) error {
+	if m.Version != ManifestVersion {
+		return errors.Errorf("unsupported snapshot version %v", m.Version)
+	}
+	initialCursor, err := db.GetExecutionCursor(big.NewInt(0))
+	if err != nil {
+		return errors.Wrap(err, "error loading initial machine")
+	}
+	if initialCursor.MachineHash() != m.InitialMachineHash {
+		return errors.Errorf(
+			"snapshot was created with a different initial machine: snapshot %v, node %v",
+			m.InitialMachineHash,
+			initialCursor.MachineHash(),
+		)
+	}
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return err
+	}
+	if messageCount.Cmp(m.MessageCount) != 0 {
+		return errors.Errorf("database has %v messages but manifest has %v", messageCount, m.MessageCount)
+	}
+	inboxAcc, err := lastAcc(messageCount, db.GetInboxAcc)
+	if err != nil {
+		return err
+	}
+	if inboxAcc != m.InboxAcc {
+		return errors.Errorf("database inbox accumulator %v doesn't match manifest %v", inboxAcc, m.InboxAcc)
+	}
+	delayedCount, err := db.GetDelayedMessageCount()
+	if err != nil {
+		return err
+	}
+	if delayedCount.Cmp(m.DelayedMessageCount) != 0 {
+		return errors.Errorf("database has %v delayed messages but manifest has %v", delayedCount, m.DelayedMessageCount)
+	}
+	delayedAcc, err := lastAcc(delayedCount, db.GetDelayedInboxAcc)
+	if err != nil {
+		return err
+	}
+	if delayedAcc != m.DelayedInboxAcc {
+		return errors.Errorf("database delayed inbox accumulator %v doesn't match manifest %v", delayedAcc, m.DelayedInboxAcc)
+	}
+	if m.VerifiedBatch.MessageCount.Cmp(m.MessageCount) > 0 {
+		return errors.New("verified batch is past the end of the snapshot")
+	}
+	if m.VerifiedBatch.MessageCount.Sign() > 0 {
+		batchAcc, err := lastAcc(m.VerifiedBatch.MessageCount, db.GetInboxAcc)
+		if err != nil {
+			return err
+		}
+		if batchAcc != m.VerifiedBatch.Acc {
+			return errors.Errorf("database accumulator %v doesn't match verified batch %v", batchAcc, m.VerifiedBatch.Acc)
+		}
+	}
+
+	cursor, err := db.GetExecutionCursor(m.MachineGasUsed)
+	if err != nil {
+		return errors.Wrap(err, "error loading snapshot machine")
+	}
+	if cursor.TotalGasConsumed().Cmp(m.MachineGasUsed) != 0 {
+		return errors.Errorf("database machine only reached %v gas of %v", cursor.TotalGasConsumed(), m.MachineGasUsed)
+	}
+	if cursor.MachineHash() != m.MachineHash {
+		return errors.Errorf("database machine hash %v doesn't match manifest %v", cursor.MachineHash(), m.MachineHash)
+	}
+	if cursor.TotalLogCount().Cmp(m.LogCount) != 0 {
+		return errors.Errorf("database machine produced %v logs but manifest has %v", cursor.TotalLogCount(), m.LogCount)
+	}
+	if cursor.TotalSendCount().Cmp(m.SendCount) != 0 {
+		return errors.Errorf("database machine produced %v sends but manifest has %v", cursor.TotalSendCount(), m.SendCount)
+	}
+	return nil
+}
+
+// Verify checks that db holds the state described by the manifest and that
+// the manifest's inbox state is part of the chain on L1
+func Verify(ctx context.Context, db Database, l1 L1Inbox, m *Manifest) error {
+	if err := VerifyDatabase(db, m); err != nil {
+		return err
+	}
+	return VerifyL1(ctx, l1, m)
+}
+
+// TrimToVerified removes any messages past the verified batch, such as ones
+// received from the sequencer feed, so that the inbox reader picks up from
+// L1 state that's been checked
+func TrimToVerified(ctx context.Context, db core.ArbCore, m *Manifest) error {
+	messageCount, err := db.GetMessageCount()
+	if err != nil {
+		return err
+	}
+	if messageCount.Cmp(m.VerifiedBatch.MessageCount) <= 0 {
+		return nil
+	}
+	logger.Info().
+		Str("messageCount", messageCount.String()).
+		Str("verifiedCount", m.VerifiedBatch.MessageCount.String()).
+		Msg("discarding snapshot messages that aren't yet posted to L1")
+	return core.ReorgAndWait(db, m.VerifiedBatch.MessageCount)
+}
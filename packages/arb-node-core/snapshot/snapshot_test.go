@@ -0,0 +1,462 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+)
+
+type testCursor struct {
+	hash     common.Hash
+	gas      *big.Int
+	logCount *big.Int
+}
+
+func (c testCursor) Clone() core.ExecutionCursor       { return c }
+func (c testCursor) MachineHash() common.Hash          { return c.hash }
+func (c testCursor) TotalMessagesRead() *big.Int       { return big.NewInt(0) }
+func (c testCursor) InboxAcc() common.Hash             { return common.Hash{} }
+func (c testCursor) SendAcc() common.Hash              { return common.Hash{} }
+func (c testCursor) LogAcc() common.Hash               { return common.Hash{} }
+func (c testCursor) TotalGasConsumed() *big.Int        { return c.gas }
+func (c testCursor) TotalSteps() *big.Int              { return big.NewInt(0) }
+func (c testCursor) TotalSendCount() *big.Int          { return big.NewInt(0) }
+func (c testCursor) TotalLogCount() *big.Int           { return c.logCount }
+func (c testCursor) String() string                    { return c.hash.String() }
+func (c testCursor) withHash(h common.Hash) testCursor { c.hash = h; return c }
+
+type testDatabase struct {
+	accs        []common.Hash
+	delayedAccs []common.Hash
+	initial     testCursor
+	last        testCursor
+}
+
+func newTestDatabase(messages, delayed int) *testDatabase {
+	db := &testDatabase{
+		initial: testCursor{hash: common.RandHash(), gas: big.NewInt(0), logCount: big.NewInt(0)},
+		last:    testCursor{hash: common.RandHash(), gas: big.NewInt(1000), logCount: big.NewInt(5)},
+	}
+	acc := common.RandHash()
+	for i := 0; i < messages; i++ {
+		acc = hashing.SoliditySHA3(hashing.Bytes32(acc), hashing.Uint256(big.NewInt(int64(i))))
+		db.accs = append(db.accs, acc)
+	}
+	for i := 0; i < delayed; i++ {
+		db.delayedAccs = append(db.delayedAccs, common.RandHash())
+	}
+	return db
+}
+
+func (db *testDatabase) GetMessageCount() (*big.Int, error) {
+	return big.NewInt(int64(len(db.accs))), nil
+}
+
+func (db *testDatabase) GetInboxAcc(index *big.Int) (common.Hash, error) {
+	return db.accs[index.Int64()], nil
+}
+
+func (db *testDatabase) GetDelayedMessageCount() (*big.Int, error) {
+	return big.NewInt(int64(len(db.delayedAccs))), nil
+}
+
+func (db *testDatabase) GetDelayedInboxAcc(index *big.Int) (common.Hash, error) {
+	return db.delayedAccs[index.Int64()], nil
+}
+
+func (db *testDatabase) GetLastMachineTotalGas() (*big.Int, error) {
+	return db.last.gas, nil
+}
+
+func (db *testDatabase) GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error) {
+	if totalGasUsed.Sign() == 0 {
+		return db.initial, nil
+	}
+	return db.last, nil
+}
+
+type testBatch struct {
+	index      *big.Int
+	afterCount *big.Int
+	afterAcc   common.Hash
+}
+
+func (b testBatch) GetBatchIndex() *big.Int   { return b.index }
+func (b testBatch) GetBeforeCount() *big.Int  { return nil }
+func (b testBatch) GetBeforeAcc() common.Hash { return common.Hash{} }
+func (b testBatch) GetAfterCount() *big.Int   { return b.afterCount }
+func (b testBatch) GetAfterAcc() common.Hash  { return b.afterAcc }
+func (b testBatch) GetBlock() *common.BlockId { return nil }
+
+// testL1 posts batches of the given sizes from db's messages, one per block
+type testL1 struct {
+	batches     []testBatch
+	delayedAccs []common.Hash
+}
+
+func newTestL1(db *testDatabase, batchSizes ...int) *testL1 {
+	l1 := &testL1{delayedAccs: db.delayedAccs}
+	count := 0
+	for i, size := range batchSizes {
+		count += size
+		l1.batches = append(l1.batches, testBatch{
+			index:      big.NewInt(int64(i)),
+			afterCount: big.NewInt(int64(count)),
+			afterAcc:   db.accs[count-1],
+		})
+	}
+	return l1
+}
+
+func (l *testL1) GetCountsAndAccumulators(context.Context) (delayed, seq ethbridge.CountAndAccumulator, err error) {
+	delayed.Count = big.NewInt(int64(len(l.delayedAccs)))
+	if len(l.delayedAccs) > 0 {
+		delayed.Accumulator = l.delayedAccs[len(l.delayedAccs)-1]
+	}
+	seq.Count = big.NewInt(0)
+	if len(l.batches) > 0 {
+		last := l.batches[len(l.batches)-1]
+		seq.Count = last.afterCount
+		seq.Accumulator = last.afterAcc
+	}
+	return
+}
+
+func (l *testL1) GetBatchCount(context.Context) (*big.Int, error) {
+	return big.NewInt(int64(len(l.batches))), nil
+}
+
+func (l *testL1) GetBatchAccumulator(_ context.Context, batchIndex *big.Int) (common.Hash, error) {
+	return l.batches[batchIndex.Int64()].afterAcc, nil
+}
+
+func (l *testL1) GetDelayedAccumulator(_ context.Context, index *big.Int) (common.Hash, error) {
+	return l.delayedAccs[index.Int64()], nil
+}
+
+func (l *testL1) CurrentBlockHeight(context.Context) (*big.Int, error) {
+	return big.NewInt(int64(len(l.batches)) * 2), nil
+}
+
+func (l *testL1) LookupBatchesInRange(_ context.Context, from, to *big.Int) ([]ethbridge.SequencerBatchRef, error) {
+	var ret []ethbridge.SequencerBatchRef
+	for i, batch := range l.batches {
+		block := int64(i) * 2
+		if block >= from.Int64() && block <= to.Int64() {
+			ret = append(ret, batch)
+		}
+	}
+	return ret, nil
+}
+
+func (l *testL1) FromBlock() int64 {
+	return 0
+}
+
+func createTestManifest(t *testing.T, db *testDatabase, l1 L1Inbox) *Manifest {
+	t.Helper()
+	m, err := NewManifest(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.VerifiedBatch, err = FindVerifiedBatch(context.Background(), db, l1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(10, 3)
+	l1 := newTestL1(db, 4, 5)
+	m := createTestManifest(t, db, l1)
+	if m.VerifiedBatch.Index.Int64() != 1 || m.VerifiedBatch.MessageCount.Int64() != 9 {
+		t.Fatal("unexpected verified batch", m.VerifiedBatch.Index, m.VerifiedBatch.MessageCount)
+	}
+	if err := Verify(ctx, db, l1, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round trip through JSON
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Manifest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(ctx, db, l1, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	otherDB := newTestDatabase(10, 3)
+	otherDB.initial = db.initial
+	otherDB.last = db.last
+	if err := VerifyDatabase(otherDB, m); err == nil {
+		t.Error("verified database with different messages")
+	}
+
+	modified := *db
+	modified.last = db.last.withHash(common.RandHash())
+	if err := VerifyDatabase(&modified, m); err == nil {
+		t.Error("verified database with different machine")
+	}
+
+	modified = *db
+	modified.initial = db.initial.withHash(common.RandHash())
+	if err := VerifyDatabase(&modified, m); err == nil {
+		t.Error("verified database from different chain")
+	}
+
+	if err := VerifyL1(ctx, newTestL1(db, 4), m); err == nil {
+		t.Error("verified snapshot ahead of L1")
+	}
+	if err := VerifyL1(ctx, newTestL1(otherDB, 4, 5), m); err == nil {
+		t.Error("verified snapshot against different L1 inbox")
+	}
+	otherL1 := newTestL1(db, 4, 5)
+	otherL1.delayedAccs = otherDB.delayedAccs
+	if err := VerifyL1(ctx, otherL1, m); err == nil {
+		t.Error("verified snapshot against different delayed inbox")
+	}
+}
+
+func TestFindVerifiedBatch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDatabase(100, 0)
+
+	// Database is behind L1
+	sizes := make([]int, 0)
+	for i := 0; i < 20; i++ {
+		sizes = append(sizes, 5)
+	}
+	l1 := newTestL1(db, sizes...)
+	shortDB := *db
+	shortDB.accs = db.accs[:53]
+	batch, err := FindVerifiedBatch(ctx, &shortDB, l1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Index.Int64() != 9 || batch.MessageCount.Int64() != 50 || batch.Acc != db.accs[49] {
+		t.Error("unexpected batch", batch.Index, batch.MessageCount)
+	}
+
+	// Database diverged from L1 after message 30
+	divergedDB := *db
+	divergedDB.accs = append([]common.Hash{}, db.accs...)
+	for i := 30; i < len(divergedDB.accs); i++ {
+		divergedDB.accs[i] = common.RandHash()
+	}
+	batch, err = FindVerifiedBatch(ctx, &divergedDB, l1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.MessageCount.Int64() != 30 {
+		t.Error("unexpected batch", batch.Index, batch.MessageCount)
+	}
+
+	if _, err := FindVerifiedBatch(ctx, newTestDatabase(100, 0), l1); err == nil {
+		t.Error("found batch in unrelated database")
+	}
+}
+
+func writeTestDatabase(t *testing.T, dir string) {
+	t.Helper()
+	files := map[string]string{
+		"CURRENT":         "MANIFEST-000001\n",
+		"000001.sst":      "table data",
+		"nested/file.log": "log data",
+	}
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDB := filepath.Join(dir, "src")
+	writeTestDatabase(t, srcDB)
+	db := newTestDatabase(10, 2)
+	m := createTestManifest(t, db, newTestL1(db, 10))
+	var archive bytes.Buffer
+	if err := WriteArchive(&archive, srcDB, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 3 {
+		t.Fatal("unexpected file count", len(m.Files))
+	}
+	archivePath := filepath.Join(dir, "snapshot.tar.gz")
+	if err := ioutil.WriteFile(archivePath, archive.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "chain", "db")
+	imported, err := Import(ctx, archivePath, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported == nil || imported.MachineHash != m.MachineHash {
+		t.Fatal("unexpected manifest", imported)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dbPath, "nested", "file.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "log data" {
+		t.Error("unexpected file contents", string(data))
+	}
+
+	// Importing again resumes verification of the pending snapshot
+	pending, err := Import(ctx, archivePath, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending == nil || pending.MachineHash != m.MachineHash {
+		t.Fatal("pending snapshot not returned")
+	}
+	if err := MarkVerified(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = Import(ctx, archivePath, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != nil {
+		t.Error("imported over existing database")
+	}
+}
+
+func rewriteArchive(t *testing.T, archive []byte, modify func(header *tar.Header, data []byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gzOut := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gzOut)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = modify(header, data)
+		header.Size = int64(len(data))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzOut.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestReadArchiveRejectsBadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcDB := filepath.Join(dir, "src")
+	writeTestDatabase(t, srcDB)
+	db := newTestDatabase(1, 0)
+	m := createTestManifest(t, db, newTestL1(db, 1))
+	var archive bytes.Buffer
+	if err := WriteArchive(&archive, srcDB, m); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func(header *tar.Header, data []byte) []byte{
+		"corrupted": func(header *tar.Header, data []byte) []byte {
+			if header.Name == "db/000001.sst" {
+				data[0] ^= 1
+			}
+			return data
+		},
+		"truncated": func(header *tar.Header, data []byte) []byte {
+			if header.Name == "db/000001.sst" {
+				return data[:1]
+			}
+			return data
+		},
+		"traversal": func(header *tar.Header, data []byte) []byte {
+			if header.Name == "db/CURRENT" {
+				header.Name = "db/../CURRENT"
+			}
+			return data
+		},
+		"unlisted": func(header *tar.Header, data []byte) []byte {
+			if header.Name == "db/CURRENT" {
+				header.Name = "db/OTHER"
+			}
+			return data
+		},
+	}
+	for name, modify := range cases {
+		t.Run(name, func(t *testing.T) {
+			outDir, err := ioutil.TempDir(dir, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			modified := rewriteArchive(t, archive.Bytes(), modify)
+			if _, err := ReadArchive(bytes.NewReader(modified), outDir); err == nil {
+				t.Error("accepted bad archive")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+)
+
+// Internals used by the tests in package staker_test, which can't be in
+// package staker since they import stakertest
+
+func (s *Staker) SetStrategy(strategy Strategy) {
+	s.strategy = strategy
+}
+
+func (s *CostAwareStrategy) SpendCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.spends)
+}
+
+func (s *CostAwareStrategy) SpentInPeriod(ctx context.Context, view StakerView) (*big.Int, *big.Int, error) {
+	return s.spentInPeriod(ctx, view)
+}
+
+func (w *WatchOnlyValidator) Update(ctx context.Context) error {
+	return w.update(ctx)
+}
+
+func (w *WatchOnlyValidator) HandleStatus(rw http.ResponseWriter, req *http.Request) {
+	w.handleStatus(rw, req)
+}
@@ -33,30 +33,24 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
 )
 
 var logger = log.With().Caller().Stack().Str("component", "staker").Logger()
 
-type Strategy uint8
-
-const (
-	WatchtowerStrategy Strategy = iota
-	DefensiveStrategy
-	StakeLatestStrategy
-	MakeNodesStrategy
-)
-
 type Staker struct {
 	*Validator
-	activeChallenge     *challenge.Challenger
-	strategy            Strategy
-	fromBlock           int64
-	baseCallOpts        bind.CallOpts
-	auth                transactauth.TransactAuth
-	config              configuration.Validator
-	highGasBlocksBuffer *big.Int
-	lastActCalledBlock  *big.Int
+	activeChallenge       *challenge.Challenger
+	challengeStore        machine.ValidatorStateStore
+	savedChallengeCleared bool
+	strategy              Strategy
+	fromBlock             int64
+	baseCallOpts          bind.CallOpts
+	auth                  transactauth.TransactAuth
+	config                configuration.Validator
+	highGasBlocksBuffer   *big.Int
+	lastActCalledBlock    *big.Int
 }
 
 func NewStaker(
@@ -70,6 +64,7 @@ func NewStaker(
 	callOpts bind.CallOpts,
 	auth transactauth.TransactAuth,
 	config configuration.Validator,
+	challengeStore machine.ValidatorStateStore,
 ) (*Staker, *ethbridge.DelayedBridgeWatcher, error) {
 	val, err := NewValidator(ctx, lookup, client, wallet, fromBlock, validatorUtilsAddress, callOpts)
 	if err != nil {
@@ -82,6 +77,7 @@ func NewStaker(
 		baseCallOpts:        callOpts,
 		auth:                auth,
 		config:              config,
+		challengeStore:      challengeStore,
 		highGasBlocksBuffer: big.NewInt(config.L1PostingStrategy.HighGasDelayBlocks),
 		lastActCalledBlock:  nil,
 	}, val.delayedBridge, nil
@@ -211,30 +207,22 @@ func (s *Staker) Act(ctx context.Context) (*arbtransaction.ArbTransaction, error
 	}
 	if !nodesLinear {
 		logger.Warn().Msg("Fork detected")
-		if effectiveStrategy == DefensiveStrategy {
-			effectiveStrategy = StakeLatestStrategy
-		}
+		effectiveStrategy = effectiveStrategy.OnFork()
 	}
 
-	// Resolve nodes if either we're on the make nodes strategy,
-	// or we're on the stake latest strategy but don't have a stake
-	// (attempt to reduce the current required stake).
-	shouldResolveNodes := effectiveStrategy >= MakeNodesStrategy
-	if !shouldResolveNodes && effectiveStrategy >= StakeLatestStrategy && rawInfo == nil {
-		shouldResolveNodes, err = s.isRequiredStakeElevated(ctx)
-		if err != nil {
-			return nil, err
-		}
+	shouldResolveNodes, err := effectiveStrategy.ShouldResolveNodes(ctx, s, rawInfo != nil)
+	if err != nil {
+		return nil, err
 	}
 	if shouldResolveNodes {
 		// Keep the stake of this validator placed if we plan on staking further
-		arbTx, err := s.removeOldStakers(ctx, effectiveStrategy >= StakeLatestStrategy)
+		arbTx, err := s.removeOldStakers(ctx, effectiveStrategy.KeepStake())
 		if err != nil || arbTx != nil {
-			return arbTx, err
+			return s.recordSpend(ctx, effectiveStrategy, arbTx, err)
 		}
 		arbTx, err = s.resolveTimedOutChallenges(ctx)
 		if err != nil || arbTx != nil {
-			return arbTx, err
+			return s.recordSpend(ctx, effectiveStrategy, arbTx, err)
 		}
 		if err := s.resolveNextNode(ctx, rawInfo, s.fromBlock); err != nil {
 			return nil, err
@@ -279,12 +267,53 @@ func (s *Staker) Act(ctx context.Context) (*arbtransaction.ArbTransaction, error
 	if creatingNewStake {
 		logger.Info().Msg("Staking to execute transactions")
 	}
-	return s.wallet.ExecuteTransactions(ctx, s.builder)
+	arbTx, err := s.wallet.ExecuteTransactions(ctx, s.builder)
+	return s.recordSpend(ctx, effectiveStrategy, arbTx, err)
+}
+
+// recordSpend tells strategies that budget for L1 costs about a transaction
+// that was sent, passing through the result of sending it
+func (s *Staker) recordSpend(ctx context.Context, strategy Strategy, arbTx *arbtransaction.ArbTransaction, err error) (*arbtransaction.ArbTransaction, error) {
+	if err != nil || arbTx == nil {
+		return arbTx, err
+	}
+	if recorder, ok := strategy.(SpendRecorder); ok {
+		if err := recorder.RecordSpend(ctx, s, arbTx.Gas(), arbTx.GasPrice()); err != nil {
+			logger.Warn().Err(err).Msg("failed to record the cost of a transaction")
+		}
+	}
+	return arbTx, nil
+}
+
+func (s *Staker) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return s.client.SuggestGasPrice(ctx)
+}
+
+func (s *Staker) CurrentBlock(ctx context.Context) (*big.Int, error) {
+	blockInfo, err := s.client.BlockInfoByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return blockInfo.Number.ToInt(), nil
+}
+
+func (s *Staker) ConfirmPeriodBlocks(ctx context.Context) (*big.Int, error) {
+	return s.rollup.ConfirmPeriodBlocks(ctx)
+}
+
+func (s *Staker) IsRequiredStakeElevated(ctx context.Context) (bool, error) {
+	return s.isRequiredStakeElevated(ctx)
 }
 
 func (s *Staker) handleConflict(ctx context.Context, info *ethbridge.StakerInfo) error {
 	if info.CurrentChallenge == nil {
 		s.activeChallenge = nil
+		if s.challengeStore != nil && !s.savedChallengeCleared {
+			if err := challenge.ForgetChallenge(s.challengeStore, s.wallet.Address()); err != nil {
+				return err
+			}
+			s.savedChallengeCleared = true
+		}
 		return nil
 	}
 
@@ -296,17 +325,29 @@ func (s *Staker) handleConflict(ctx context.Context, info *ethbridge.StakerInfo)
 			return err
 		}
 
-		challengedNode, err := s.rollup.LookupChallengedNode(ctx, *info.CurrentChallenge)
-		if err != nil {
-			return err
+		var resumed *challenge.Challenger
+		if s.challengeStore != nil {
+			s.savedChallengeCleared = false
+			resumed, err = challenge.LoadChallenger(challengeCon, s.sequencerInbox, s.lookup, s.wallet.Address(), s.challengeStore)
+			if err != nil {
+				logger.Warn().Err(err).Msg("failed to load saved challenge progress, starting over")
+			}
 		}
+		if resumed != nil {
+			s.activeChallenge = resumed
+		} else {
+			challengedNode, err := s.rollup.LookupChallengedNode(ctx, *info.CurrentChallenge)
+			if err != nil {
+				return err
+			}
 
-		nodeInfo, err := s.rollup.RollupWatcher.LookupNode(ctx, challengedNode)
-		if err != nil {
-			return err
-		}
+			nodeInfo, err := s.rollup.RollupWatcher.LookupNode(ctx, challengedNode)
+			if err != nil {
+				return err
+			}
 
-		s.activeChallenge = challenge.NewChallenger(challengeCon, s.sequencerInbox, s.lookup, nodeInfo.Assertion, s.wallet.Address())
+			s.activeChallenge = challenge.NewPersistentChallenger(challengeCon, s.sequencerInbox, s.lookup, nodeInfo.Assertion, s.wallet.Address(), s.challengeStore)
+		}
 	}
 
 	_, err := s.activeChallenge.HandleConflict(ctx)
@@ -329,8 +370,8 @@ func (s *Staker) newStake(ctx context.Context) error {
 }
 
 func (s *Staker) advanceStake(ctx context.Context, info *OurStakerInfo, effectiveStrategy Strategy) error {
-	active := effectiveStrategy > WatchtowerStrategy
-	action, wrongNodesExist, err := s.generateNodeAction(ctx, info, effectiveStrategy, s.fromBlock)
+	active := effectiveStrategy.Active()
+	action, wrongNodesExist, err := s.generateNodeAction(ctx, info, effectiveStrategy, s, s.fromBlock)
 	if err != nil {
 		return err
 	}
@@ -352,6 +393,14 @@ func (s *Staker) advanceStake(ctx context.Context, info *OurStakerInfo, effectiv
 		info.LatestStakedNodeHash = action.hash
 		return s.rollup.StakeOnNewNode(ctx, action.hash, action.assertion, action.prevProposedBlock, action.prevInboxMaxCount, action.sequencerBatchProof)
 	case existingNodeAction:
+		advance, err := effectiveStrategy.ShouldAdvanceStake(ctx, s, wrongNodesExist)
+		if err != nil {
+			return err
+		}
+		if !advance {
+			info.CanProgress = false
+			return nil
+		}
 		logger.Info().Int("node", int((*big.Int)(action.number).Int64())).Msg("Staking on existing node")
 		info.LatestStakedNode = action.number
 		info.LatestStakedNodeHash = action.hash
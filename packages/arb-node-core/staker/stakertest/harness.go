@@ -0,0 +1,577 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package stakertest drives validators against each other on a simulated L1
+// for testing challenges
+package stakertest
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/challenge"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/nodehealth"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/staker"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethbridgecontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethbridgetestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
+)
+
+type ExpectedChallengeEnd uint8
+
+const (
+	NoChallenge ExpectedChallengeEnd = iota
+	OneStepProof
+	Timeout
+)
+
+// Lie is the way the faulty staker in a ChallengeHarness misrepresents
+// execution
+type Lie uint8
+
+const (
+	NoLie Lie = iota
+	// WrongCutLie reports the wrong machine hash from LieAtGas onwards
+	WrongCutLie
+	// UnreachableEndLie claims execution continued past LieAtGas when the
+	// machine actually stopped there
+	UnreachableEndLie
+	// WrongSendAccLie reports the wrong send accumulator from LieAtGas onwards
+	WrongSendAccLie
+)
+
+func (l Lie) FaultConfig(atGas *big.Int) challenge.FaultConfig {
+	switch l {
+	case WrongCutLie:
+		return challenge.FaultConfig{DistortMachineAtGas: atGas}
+	case UnreachableEndLie:
+		return challenge.FaultConfig{StallMachineAt: atGas}
+	case WrongSendAccLie:
+		return challenge.FaultConfig{DistortSendAccAtGas: atGas}
+	default:
+		return challenge.FaultConfig{}
+	}
+}
+
+type ChallengeHarnessConfig struct {
+	// Fault overrides Lie if set
+	Fault         challenge.FaultConfig
+	Lie           Lie
+	LieAtGas      *big.Int
+	MaxGasPerNode *big.Int
+	ExpectedEnd   ExpectedChallengeEnd
+	// MaxRounds bounds the number of turns before the game is considered stuck
+	MaxRounds int
+}
+
+// ChallengeHarness deploys the rollup contracts to a simulated L1 and runs an
+// honest staker against a faulty one, driving any challenge between them
+// through bisection and one step proof to completion
+type ChallengeHarness struct {
+	t      *testing.T
+	config ChallengeHarnessConfig
+	fault  challenge.FaultConfig
+
+	Client         *ethutils.SimulatedEthClient
+	RollupAddress  ethcommon.Address
+	RollupBlock    *big.Int
+	ValidatorUtils ethcommon.Address
+	Rollup         *ethbridge.RollupWatcher
+	Monitor        *monitor.Monitor
+	Honest         *staker.Staker
+	Faulty         *staker.Staker
+	HonestWallet   ethcommon.Address
+	FaultyWallet   ethcommon.Address
+
+	shutdown func()
+}
+
+// ChallengeResult summarizes a completed run
+type ChallengeResult struct {
+	Challenge *common.Address
+	Rounds    int
+}
+
+func deployRollup(
+	t *testing.T,
+	auth *bind.TransactOpts,
+	client *ethutils.SimulatedEthClient,
+	machineHash [32]byte,
+	confirmPeriodBlocks *big.Int,
+	extraChallengeTimeBlocks *big.Int,
+	arbGasSpeedLimitPerBlock *big.Int,
+	baseStake *big.Int,
+	stakeToken common.Address,
+	owner common.Address,
+	sequencer common.Address,
+	sequencerDelayBlocks *big.Int,
+	sequencerDelaySeconds *big.Int,
+	extraConfig []byte,
+) (ethcommon.Address, *big.Int) {
+	osp1Addr, _, _, err := ethbridgetestcontracts.DeployOneStepProof(auth, client)
+	test.FailIfError(t, err)
+	osp2Addr, _, _, err := ethbridgetestcontracts.DeployOneStepProof2(auth, client)
+	test.FailIfError(t, err)
+	osp3Addr, _, _, err := ethbridgetestcontracts.DeployOneStepProofHash(auth, client)
+	test.FailIfError(t, err)
+	challengeFactoryAddr, _, _, err := ethbridgetestcontracts.DeployChallengeFactory(auth, client, []ethcommon.Address{osp1Addr, osp2Addr, osp3Addr})
+	test.FailIfError(t, err)
+
+	_, tx, rollupCreator, err := ethbridgetestcontracts.DeployRollupCreatorNoProxy(
+		auth,
+		client,
+		challengeFactoryAddr,
+		machineHash,
+		confirmPeriodBlocks,
+		extraChallengeTimeBlocks,
+		arbGasSpeedLimitPerBlock,
+		baseStake,
+		stakeToken.ToEthAddress(),
+		owner.ToEthAddress(),
+		sequencer.ToEthAddress(),
+		sequencerDelayBlocks,
+		sequencerDelaySeconds,
+		extraConfig,
+	)
+	test.FailIfError(t, err)
+	client.Commit()
+
+	receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+	test.FailIfError(t, err)
+	createEv, err := rollupCreator.ParseRollupCreated(*receipt.Logs[len(receipt.Logs)-1])
+	test.FailIfError(t, err)
+
+	return createEv.RollupAddress, receipt.BlockNumber
+}
+
+func NewChallengeHarness(t *testing.T, config ChallengeHarnessConfig) *ChallengeHarness {
+	ctx := context.Background()
+
+	fault := config.Fault
+	if fault == (challenge.FaultConfig{}) && config.Lie != NoLie {
+		lieAtGas := config.LieAtGas
+		if lieAtGas == nil {
+			lieAtGas = big.NewInt(1)
+		}
+		fault = config.Lie.FaultConfig(lieAtGas)
+	}
+	if config.MaxRounds == 0 {
+		config.MaxRounds = 1000
+	}
+
+	arbosPath, err := arbos.Path(false)
+	test.FailIfError(t, err)
+
+	mach, err := cmachine.New(arbosPath)
+	test.FailIfError(t, err)
+
+	hash := mach.Hash()
+	confirmPeriodBlocks := big.NewInt(100)
+	extraChallengeTimeBlocks := big.NewInt(0)
+	arbGasSpeedLimitPerBlock := config.MaxGasPerNode
+	baseStake := big.NewInt(100)
+	var stakeToken common.Address
+	sequencerDelayBlocks := big.NewInt(60)
+	sequencerDelaySeconds := big.NewInt(900)
+	var extraConfig []byte
+
+	clnt, auths := test.SimulatedBackend(t)
+	auth := auths[0]
+	auth2 := auths[1]
+	seqAuth := auths[2]
+	ownerAuth := auths[3]
+	sequencer := common.NewAddressFromEth(seqAuth.From)
+	client := &ethutils.SimulatedEthClient{SimulatedBackend: clnt}
+
+	rollupAddr, rollupBlock := deployRollup(
+		t,
+		auth,
+		client,
+		hash,
+		confirmPeriodBlocks,
+		extraChallengeTimeBlocks,
+		arbGasSpeedLimitPerBlock,
+		baseStake,
+		stakeToken,
+		common.NewAddressFromEth(ownerAuth.From),
+		sequencer,
+		sequencerDelayBlocks,
+		sequencerDelaySeconds,
+		extraConfig,
+	)
+
+	bridgeUtilsAddr, _, _, err := ethbridgecontracts.DeployBridgeUtils(auth, client)
+	test.FailIfError(t, err)
+
+	validatorUtilsAddr, _, _, err := ethbridgecontracts.DeployValidatorUtils(auth, client)
+	test.FailIfError(t, err)
+
+	validatorWalletFactory, _, _, err := ethbridgecontracts.DeployValidatorWalletCreator(auth, client)
+	test.FailIfError(t, err)
+
+	valAuth, err := transactauth.NewTransactAuth(ctx, client, auth)
+	test.FailIfError(t, err)
+	val2Auth, err := transactauth.NewTransactAuth(ctx, client, auth2)
+	test.FailIfError(t, err)
+
+	validatorAddress, err := ethbridge.CreateValidatorWallet(ctx, validatorWalletFactory, rollupBlock.Int64(), valAuth, client)
+	test.FailIfError(t, err)
+
+	// Should lookup WalletCreated event
+	checkValidatorAddress, err := ethbridge.CreateValidatorWallet(ctx, validatorWalletFactory, rollupBlock.Int64(), valAuth, client)
+	test.FailIfError(t, err)
+	if validatorAddress != checkValidatorAddress {
+		t.Error("CreateValidatorWallet didn't reuse existing wallet")
+	}
+
+	validatorAddress2, err := ethbridge.CreateValidatorWallet(ctx, validatorWalletFactory, rollupBlock.Int64(), val2Auth, client)
+	test.FailIfError(t, err)
+	if validatorAddress == validatorAddress2 {
+		t.Error("CreateValidatorWallet reused existing wallet for different address")
+	}
+
+	client.Commit()
+
+	rollupAdmin, err := ethbridgecontracts.NewRollupAdminFacet(rollupAddr, client)
+	test.FailIfError(t, err)
+	_, err = rollupAdmin.SetValidator(ownerAuth, []ethcommon.Address{validatorAddress, validatorAddress2}, []bool{true, true})
+	test.FailIfError(t, err)
+	client.Commit()
+
+	mon, shutdown := monitor.PrepareArbCore(t)
+
+	val, err := ethbridge.NewValidator(validatorAddress, rollupAddr, client, valAuth)
+	test.FailIfError(t, err)
+	val2, err := ethbridge.NewValidator(validatorAddress2, rollupAddr, client, val2Auth)
+	test.FailIfError(t, err)
+
+	honestStaker, _, err := staker.NewStaker(ctx, mon.Core, client, val, rollupBlock.Int64(), common.NewAddressFromEth(validatorUtilsAddr), staker.MakeNodesStrategy, bind.CallOpts{}, valAuth, configuration.Validator{}, mon.Storage)
+	test.FailIfError(t, err)
+
+	honestStaker.Validator.GasThreshold = big.NewInt(0)
+
+	rollup, err := ethbridge.NewRollupWatcher(rollupAddr, rollupBlock.Int64(), client, bind.CallOpts{})
+	test.FailIfError(t, err)
+
+	seqInboxAddr, err := rollup.SequencerBridge(ctx)
+	test.FailIfError(t, err)
+
+	seqInbox, err := ethbridgecontracts.NewSequencerInbox(seqInboxAddr.ToEthAddress(), client)
+	test.FailIfError(t, err)
+
+	delayedBridgeAddr, err := rollup.DelayedBridge(ctx)
+	test.FailIfError(t, err)
+
+	delayedBridge, err := ethbridgecontracts.NewBridge(delayedBridgeAddr.ToEthAddress(), client)
+	test.FailIfError(t, err)
+
+	delayedAcc, err := delayedBridge.InboxAccs(&bind.CallOpts{Context: ctx}, big.NewInt(0))
+	test.FailIfError(t, err)
+	batchItem := inbox.NewDelayedItem(big.NewInt(0), big.NewInt(1), common.Hash{}, big.NewInt(0), delayedAcc)
+
+	latestHeader, err := client.HeaderByNumber(ctx, nil)
+	test.FailIfError(t, err)
+	currentBlockNumber := latestHeader.Number
+	currentTimestamp := big.NewInt(int64(latestHeader.Time))
+
+	endOfBlockMessage := message.NewInboxMessage(
+		message.EndBlockMessage{},
+		common.Address{},
+		big.NewInt(1),
+		big.NewInt(0),
+		inbox.ChainTime{
+			BlockNum:  common.NewTimeBlocks(currentBlockNumber),
+			Timestamp: currentTimestamp,
+		},
+	)
+
+	endBlockBatchItem := inbox.NewSequencerItem(big.NewInt(1), endOfBlockMessage, batchItem.Accumulator)
+	delayedAccInt := new(big.Int).SetBytes(delayedAcc[:])
+	metadata := []*big.Int{big.NewInt(0), currentBlockNumber, currentTimestamp, big.NewInt(1), delayedAccInt}
+	_, err = seqInbox.AddSequencerL2BatchFromOrigin(seqAuth, []byte{}, []*big.Int{}, metadata, endBlockBatchItem.Accumulator)
+	test.FailIfError(t, err)
+	for i := 0; i < 5; i++ {
+		client.Commit()
+	}
+
+	faultyCore := challenge.NewFaultyCore(mon.Core, fault)
+
+	faultyStaker, _, err := staker.NewStaker(ctx, faultyCore, client, val2, rollupBlock.Int64(), common.NewAddressFromEth(validatorUtilsAddr), staker.MakeNodesStrategy, bind.CallOpts{}, val2Auth, configuration.Validator{}, nil)
+	test.FailIfError(t, err)
+
+	faultyStaker.Validator.GasThreshold = big.NewInt(0)
+
+	registry := metrics.NewRegistry()
+	const largeChannelBuffer = 200
+	healthChan := make(chan nodehealth.Log, largeChannelBuffer)
+	healthChan <- nodehealth.Log{Config: true, Var: "disablePrimaryCheck", ValBool: false}
+	healthChan <- nodehealth.Log{Config: true, Var: "disableOpenEthereumCheck", ValBool: true}
+	healthChan <- nodehealth.Log{Config: true, Var: "healthcheckMetrics", ValBool: false}
+	healthChan <- nodehealth.Log{Config: true, Var: "healthcheckRPC", ValStr: "0.0.0.0:8080"}
+	nodehealth.Init(healthChan)
+
+	go func() {
+		err := nodehealth.StartNodeHealthCheck(ctx, healthChan, registry)
+		test.FailIfError(t, err)
+	}()
+
+	// Make a dummy feed for now
+	var sequencerFeed chan broadcaster.BroadcastFeedMessage
+
+	_, err = mon.StartInboxReader(ctx, client, configuration.DefaultL1LogFetchSettings(), common.NewAddressFromEth(rollupAddr), rollupBlock.Int64(), common.NewAddressFromEth(bridgeUtilsAddr), healthChan, sequencerFeed)
+	test.FailIfError(t, err)
+
+	for i := 1; i <= 10; i++ {
+		msgCount, err := mon.Core.GetMessageCount()
+		test.FailIfError(t, err)
+		logCount, err := mon.Core.GetLogCount()
+		test.FailIfError(t, err)
+		if msgCount.Cmp(big.NewInt(1)) >= 0 && logCount.Cmp(big.NewInt(1)) >= 0 {
+			// We've found the inbox message
+			break
+		}
+		if i == 10 {
+			t.Fatal("Failed to load initializing message")
+		}
+		<-time.After(time.Second * 1)
+	}
+
+	return &ChallengeHarness{
+		t:              t,
+		config:         config,
+		fault:          fault,
+		Client:         client,
+		RollupAddress:  rollupAddr,
+		RollupBlock:    rollupBlock,
+		ValidatorUtils: validatorUtilsAddr,
+		Rollup:         rollup,
+		Monitor:        mon,
+		Honest:         honestStaker,
+		Faulty:         faultyStaker,
+		HonestWallet:   validatorAddress,
+		FaultyWallet:   validatorAddress2,
+		shutdown:       shutdown,
+	}
+}
+
+func (h *ChallengeHarness) Close() {
+	h.shutdown()
+}
+
+func (h *ChallengeHarness) faultsExist() bool {
+	return h.fault != challenge.FaultConfig{}
+}
+
+// Run alternates turns between the stakers, mining blocks in between, until
+// the target node is confirmed and the honest staker is out of any challenge
+func (h *ChallengeHarness) Run(ctx context.Context) ChallengeResult {
+	t := h.t
+	faultsExist := h.faultsExist()
+	t.Log("faultsExist:", faultsExist)
+
+	var targetNode *big.Int
+	if faultsExist {
+		targetNode = big.NewInt(1)
+	} else {
+		targetNode = big.NewInt(3)
+	}
+
+	var lastChallenge *common.Address
+	faultyStakerAlive := false
+	faultyStakerDead := false
+
+	stakerMadeFirstMove := false
+	rounds := 0
+	for i := h.config.MaxRounds; i >= 0; i-- {
+		rounds++
+		if (i % 2) == 0 {
+			t.Log("Honest staker acting")
+			arbTx, err := h.Honest.Act(ctx)
+			test.FailIfError(t, err)
+			if arbTx != nil {
+				stakerMadeFirstMove = true
+			}
+		} else if (!faultyStakerAlive || !faultyStakerDead) && stakerMadeFirstMove {
+			t.Log("Malicious staker acting")
+			_, err := h.Faulty.Act(ctx)
+			if err != nil {
+				if !h.faultyErrorExpected(err) {
+					test.FailIfError(t, err)
+				}
+				t.Log("Malicious staker failed to act:", err)
+				faultyStakerAlive = true
+				faultyStakerDead = true
+			}
+		}
+		h.Client.Commit()
+		h.Client.Commit()
+
+		faultyStakerInfo, err := h.Rollup.StakerInfo(ctx, common.NewAddressFromEth(h.FaultyWallet))
+		test.FailIfError(t, err)
+		if faultyStakerInfo == nil {
+			faultyStakerDead = true
+		} else {
+			faultyStakerAlive = true
+			faultyStakerDead = false
+			if faultyStakerInfo.CurrentChallenge != nil {
+				lastChallenge = faultyStakerInfo.CurrentChallenge
+			}
+		}
+
+		latestConfirmed, err := h.Rollup.LatestConfirmedNode(ctx)
+		test.FailIfError(t, err)
+		stakerInfo, err := h.Rollup.StakerInfo(ctx, common.NewAddressFromEth(h.HonestWallet))
+		test.FailIfError(t, err)
+
+		if latestConfirmed.Cmp(targetNode) >= 0 && stakerInfo.CurrentChallenge == nil {
+			break
+		} else if i == 0 {
+			t.Fatal("Node not confirmed and/or challenge not ended")
+		}
+	}
+	return ChallengeResult{
+		Challenge: lastChallenge,
+		Rounds:    rounds,
+	}
+}
+
+// faultyErrorExpected returns true for errors from the faulty staker when its
+// lies are rejected by the contracts rather than by losing the challenge
+func (h *ChallengeHarness) faultyErrorExpected(err error) bool {
+	if !h.faultsExist() {
+		return false
+	}
+	if h.config.ExpectedEnd != Timeout {
+		return false
+	}
+	errString := err.Error()
+	return strings.Contains(errString, "WRONG_END") || strings.Contains(errString, "BIS_DEADLINE")
+}
+
+// RequireHonestWin checks that the challenge ended in the expected manner with
+// the honest staker still staked and winning part of the faulty staker's stake
+func (h *ChallengeHarness) RequireHonestWin(ctx context.Context, result ChallengeResult) {
+	t := h.t
+	var challengeEndLogs []types.Log
+	switch h.config.ExpectedEnd {
+	case NoChallenge:
+		if result.Challenge != nil {
+			t.Fatal("Unexpected challenge")
+		}
+	case Timeout:
+		challengeEndLogs = requireChallengeLogs(ctx, t, h.Client, result.Challenge, 0, []string{"AsserterTimedOut()", "ChallengerTimedOut()"})
+	case OneStepProof:
+		challengeEndLogs = requireChallengeLogs(ctx, t, h.Client, result.Challenge, 0, []string{"OneStepProofCompleted()"})
+	}
+
+	stakerInfo, err := h.Rollup.StakerInfo(ctx, common.NewAddressFromEth(h.HonestWallet))
+	test.FailIfError(t, err)
+
+	if stakerInfo == nil {
+		t.Fatal("Staker isn't staked")
+	}
+
+	if stakerInfo.CurrentChallenge != nil {
+		t.Fatal("Staker remained in challenge")
+	}
+
+	if stakerInfo.LatestStakedNode.Cmp(big.NewInt(0)) == 0 {
+		t.Fatal("Staker didn't stake on node")
+	}
+
+	faultyStakerInfo, err := h.Rollup.StakerInfo(ctx, common.NewAddressFromEth(h.FaultyWallet))
+	test.FailIfError(t, err)
+
+	if h.faultsExist() {
+		if faultyStakerInfo != nil {
+			t.Fatal("Faulty staker is still staked")
+		}
+		if result.Challenge != nil {
+			h.requireHonestWonChallenge(ctx, challengeEndLogs)
+		}
+	} else {
+		if faultyStakerInfo == nil {
+			t.Fatal("Other staker lost stake")
+		}
+	}
+}
+
+// requireHonestWonChallenge checks that the transaction which ended the
+// challenge awarded part of the faulty staker's stake to the honest staker
+func (h *ChallengeHarness) requireHonestWonChallenge(ctx context.Context, challengeEndLogs []types.Log) {
+	t := h.t
+	endTxs := make(map[ethcommon.Hash]bool)
+	for _, log := range challengeEndLogs {
+		endTxs[log.TxHash] = true
+	}
+	rollup, err := ethbridgecontracts.NewRollupUserFacet(h.RollupAddress, h.Client)
+	test.FailIfError(t, err)
+	it, err := rollup.FilterUserStakeUpdated(&bind.FilterOpts{Context: ctx, Start: h.RollupBlock.Uint64()}, []ethcommon.Address{h.HonestWallet})
+	test.FailIfError(t, err)
+	defer it.Close()
+	for it.Next() {
+		if endTxs[it.Event.Raw.TxHash] && it.Event.FinalBalance.Cmp(it.Event.InitialBalance) > 0 {
+			return
+		}
+	}
+	test.FailIfError(t, it.Error())
+	t.Fatal("Honest staker didn't win the challenge")
+}
+
+func requireChallengeLogs(ctx context.Context, t *testing.T, client ethutils.EthClient, challenge *common.Address, fromBlock int64, topics []string) []types.Log {
+	if challenge == nil {
+		t.Fatal("Expected challenge but found none")
+	}
+	topicHashes := make([]ethcommon.Hash, 0, len(topics))
+	for _, topic := range topics {
+		hash := hashing.SoliditySHA3([]byte(topic))
+		topicHashes = append(topicHashes, hash.ToEthHash())
+	}
+	query := ethereum.FilterQuery{
+		BlockHash: nil,
+		FromBlock: big.NewInt(fromBlock),
+		ToBlock:   nil,
+		Addresses: []ethcommon.Address{challenge.ToEthAddress()},
+		Topics:    [][]ethcommon.Hash{topicHashes},
+	}
+	logs, err := client.FilterLogs(ctx, query)
+	test.FailIfError(t, err)
+	if len(logs) == 0 {
+		t.Fatal("Challenge ended in unexpected manner")
+	}
+	return logs
+}
@@ -0,0 +1,318 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// StakerView gives a Strategy read access to the chain while it decides
+type StakerView interface {
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	CurrentBlock(ctx context.Context) (*big.Int, error)
+	ConfirmPeriodBlocks(ctx context.Context) (*big.Int, error)
+	IsRequiredStakeElevated(ctx context.Context) (bool, error)
+}
+
+// Strategy decides how actively a staker takes part in the rollup.
+// Incorrect nodes are always detected, but only active strategies act on them.
+type Strategy interface {
+	Name() string
+
+	// Active returns whether the strategy ever stakes or creates nodes
+	Active() bool
+
+	// OnFork returns the strategy to use while unresolved nodes aren't linear
+	OnFork() Strategy
+
+	// KeepStake returns whether our stake should stay placed when removing
+	// stakers from resolved nodes
+	KeepStake() bool
+
+	// ShouldResolveNodes returns whether to confirm or reject the next
+	// unresolved node
+	ShouldResolveNodes(ctx context.Context, view StakerView, staked bool) (bool, error)
+
+	// ShouldCreateNode returns whether to create a new node since there's no
+	// correct existing node to stake on
+	ShouldCreateNode(ctx context.Context, view StakerView, wrongNodesExist bool) (bool, error)
+
+	// ShouldAdvanceStake returns whether to move our stake onto a correct
+	// existing node
+	ShouldAdvanceStake(ctx context.Context, view StakerView, wrongNodesExist bool) (bool, error)
+}
+
+// SpendRecorder is implemented by strategies that budget for the L1 cost of
+// the transactions the staker sends
+type SpendRecorder interface {
+	RecordSpend(ctx context.Context, view StakerView, gas uint64, gasPrice *big.Int) error
+}
+
+// StrategyFactory creates a strategy from the validator config
+type StrategyFactory func(config configuration.Validator) (Strategy, error)
+
+var (
+	strategyFactoriesMutex sync.Mutex
+	strategyFactories      = map[string]StrategyFactory{}
+)
+
+func init() {
+	for _, strategy := range []BuiltinStrategy{WatchtowerStrategy, DefensiveStrategy, StakeLatestStrategy, MakeNodesStrategy} {
+		strategy := strategy
+		RegisterStrategy(strategy.Name(), func(configuration.Validator) (Strategy, error) {
+			return strategy, nil
+		})
+	}
+	RegisterStrategy(CostAwareStrategyName, func(config configuration.Validator) (Strategy, error) {
+		return NewCostAwareStrategy(config), nil
+	})
+}
+
+// RegisterStrategy makes a strategy available to NewStrategy under name,
+// replacing any existing strategy with the same name
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategyFactoriesMutex.Lock()
+	defer strategyFactoriesMutex.Unlock()
+	strategyFactories[name] = factory
+}
+
+// NewStrategy creates the registered strategy with the given name
+func NewStrategy(name string, config configuration.Validator) (Strategy, error) {
+	strategyFactoriesMutex.Lock()
+	factory, ok := strategyFactories[name]
+	names := make([]string, 0, len(strategyFactories))
+	for registered := range strategyFactories {
+		names = append(names, registered)
+	}
+	strategyFactoriesMutex.Unlock()
+	if !ok {
+		sort.Strings(names)
+		return nil, errors.Errorf("unsupported strategy %v specified. Currently supported: %v", name, strings.Join(names, ", "))
+	}
+	return factory(config)
+}
+
+type BuiltinStrategy uint8
+
+const (
+	WatchtowerStrategy BuiltinStrategy = iota
+	DefensiveStrategy
+	StakeLatestStrategy
+	MakeNodesStrategy
+)
+
+func (s BuiltinStrategy) Name() string {
+	switch s {
+	case WatchtowerStrategy:
+		return "Watchtower"
+	case DefensiveStrategy:
+		return "Defensive"
+	case StakeLatestStrategy:
+		return "StakeLatest"
+	case MakeNodesStrategy:
+		return "MakeNodes"
+	default:
+		return "Unknown"
+	}
+}
+
+func (s BuiltinStrategy) Active() bool {
+	return s > WatchtowerStrategy
+}
+
+func (s BuiltinStrategy) OnFork() Strategy {
+	if s == DefensiveStrategy {
+		return StakeLatestStrategy
+	}
+	return s
+}
+
+func (s BuiltinStrategy) KeepStake() bool {
+	return s >= StakeLatestStrategy
+}
+
+func (s BuiltinStrategy) ShouldResolveNodes(ctx context.Context, view StakerView, staked bool) (bool, error) {
+	if s >= MakeNodesStrategy {
+		return true, nil
+	}
+	// Resolve nodes without a stake on the stake latest strategy to attempt
+	// to reduce the current required stake
+	if s >= StakeLatestStrategy && !staked {
+		return view.IsRequiredStakeElevated(ctx)
+	}
+	return false, nil
+}
+
+func (s BuiltinStrategy) ShouldCreateNode(_ context.Context, _ StakerView, wrongNodesExist bool) (bool, error) {
+	return s == MakeNodesStrategy || (s.Active() && wrongNodesExist), nil
+}
+
+func (s BuiltinStrategy) ShouldAdvanceStake(context.Context, StakerView, bool) (bool, error) {
+	return s.Active(), nil
+}
+
+const CostAwareStrategyName = "CostAware"
+
+var (
+	costAwareSpentGauge   = metrics.NewRegisteredGauge("arbitrum/validator/cost_aware/spent_gwei", nil)
+	costAwareSkipsCounter = metrics.NewRegisteredCounter("arbitrum/validator/cost_aware/skipped_actions", nil)
+)
+
+type costAwareSpend struct {
+	block *big.Int
+	cost  *big.Int
+}
+
+// CostAwareStrategy makes nodes like MakeNodesStrategy while the expected L1
+// cost of doing so fits in its budget for the current confirm period. It
+// always creates nodes and stakes when that's needed to defend against an
+// incorrect node, whatever the cost. Approving an action doesn't use the
+// budget, only the transactions the staker records with RecordSpend do.
+type CostAwareStrategy struct {
+	config           configuration.ValidatorCostAware
+	highGasThreshold float64
+	budget           *big.Int
+
+	mutex  sync.Mutex
+	spends []costAwareSpend
+}
+
+func NewCostAwareStrategy(config configuration.Validator) *CostAwareStrategy {
+	budget, _ := new(big.Float).Mul(big.NewFloat(config.CostAware.Budget), big.NewFloat(1e18)).Int(nil)
+	return &CostAwareStrategy{
+		config:           config.CostAware,
+		highGasThreshold: config.L1PostingStrategy.HighGasThreshold,
+		budget:           budget,
+	}
+}
+
+func (s *CostAwareStrategy) Name() string {
+	return CostAwareStrategyName
+}
+
+func (s *CostAwareStrategy) Active() bool {
+	return true
+}
+
+func (s *CostAwareStrategy) OnFork() Strategy {
+	return s
+}
+
+func (s *CostAwareStrategy) KeepStake() bool {
+	return true
+}
+
+func (s *CostAwareStrategy) ShouldResolveNodes(ctx context.Context, view StakerView, _ bool) (bool, error) {
+	return s.canAfford(ctx, view, s.config.ResolveGas, "resolve node")
+}
+
+func (s *CostAwareStrategy) ShouldCreateNode(ctx context.Context, view StakerView, wrongNodesExist bool) (bool, error) {
+	if wrongNodesExist {
+		return true, nil
+	}
+	return s.canAfford(ctx, view, s.config.CreateNodeGas, "create node")
+}
+
+func (s *CostAwareStrategy) ShouldAdvanceStake(ctx context.Context, view StakerView, wrongNodesExist bool) (bool, error) {
+	if wrongNodesExist {
+		return true, nil
+	}
+	return s.canAfford(ctx, view, s.config.StakeGas, "advance stake")
+}
+
+// canAfford returns whether the expected cost of an action fits in what's
+// left of the budget for the confirm period ending at the current block
+func (s *CostAwareStrategy) canAfford(ctx context.Context, view StakerView, gas uint64, action string) (bool, error) {
+	gasPrice, err := view.SuggestGasPrice(ctx)
+	if err != nil {
+		return false, err
+	}
+	gasPriceGwei, _ := new(big.Float).Quo(new(big.Float).SetInt(gasPrice), big.NewFloat(1e9)).Float64()
+	if s.highGasThreshold > 0 && gasPriceGwei >= s.highGasThreshold {
+		costAwareSkipsCounter.Inc(1)
+		logger.Info().Float64("gasPrice", gasPriceGwei).Str("action", action).Msg("not taking optional action as gas price is high")
+		return false, nil
+	}
+	_, spent, err := s.spentInPeriod(ctx, view)
+	if err != nil {
+		return false, err
+	}
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	if new(big.Int).Add(spent, cost).Cmp(s.budget) > 0 {
+		costAwareSkipsCounter.Inc(1)
+		logger.Info().
+			Str("spent", spent.String()).
+			Str("cost", cost.String()).
+			Str("budget", s.budget.String()).
+			Str("action", action).
+			Msg("not taking optional action as it would exceed the L1 budget")
+		return false, nil
+	}
+	return true, nil
+}
+
+// RecordSpend counts the cost of a transaction the staker sent against the
+// budget of the current confirm period
+func (s *CostAwareStrategy) RecordSpend(ctx context.Context, view StakerView, gas uint64, gasPrice *big.Int) error {
+	currentBlock, spent, err := s.spentInPeriod(ctx, view)
+	if err != nil {
+		return err
+	}
+	cost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(gas))
+	s.mutex.Lock()
+	s.spends = append(s.spends, costAwareSpend{block: currentBlock, cost: cost})
+	s.mutex.Unlock()
+	spent.Add(spent, cost)
+	costAwareSpentGauge.Update(new(big.Int).Div(spent, big.NewInt(1e9)).Int64())
+	return nil
+}
+
+// spentInPeriod returns the current block and the total recorded spending in
+// the confirm period ending at it, forgetting older spending
+func (s *CostAwareStrategy) spentInPeriod(ctx context.Context, view StakerView) (*big.Int, *big.Int, error) {
+	currentBlock, err := view.CurrentBlock(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	confirmPeriod, err := view.ConfirmPeriodBlocks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	periodStart := new(big.Int).Sub(currentBlock, confirmPeriod)
+	spent := big.NewInt(0)
+	kept := s.spends[:0]
+	for _, spend := range s.spends {
+		if spend.block.Cmp(periodStart) > 0 {
+			kept = append(kept, spend)
+			spent.Add(spent, spend.cost)
+		}
+	}
+	s.spends = kept
+	return currentBlock, spent, nil
+}
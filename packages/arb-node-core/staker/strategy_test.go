@@ -0,0 +1,153 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+type testStakerView struct {
+	gasPrice       *big.Int
+	block          *big.Int
+	confirmPeriod  *big.Int
+	stakeElevated  bool
+	elevatedChecks int
+}
+
+func (v *testStakerView) SuggestGasPrice(context.Context) (*big.Int, error) {
+	return v.gasPrice, nil
+}
+
+func (v *testStakerView) CurrentBlock(context.Context) (*big.Int, error) {
+	return v.block, nil
+}
+
+func (v *testStakerView) ConfirmPeriodBlocks(context.Context) (*big.Int, error) {
+	return v.confirmPeriod, nil
+}
+
+func (v *testStakerView) IsRequiredStakeElevated(context.Context) (bool, error) {
+	v.elevatedChecks++
+	return v.stakeElevated, nil
+}
+
+func TestBuiltinStrategies(t *testing.T) {
+	ctx := context.Background()
+	view := &testStakerView{stakeElevated: true}
+	for _, name := range []string{"Watchtower", "Defensive", "StakeLatest", "MakeNodes"} {
+		strategy, err := NewStrategy(name, configuration.Validator{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strategy.Name() != name {
+			t.Error("strategy", name, "has name", strategy.Name())
+		}
+	}
+	if _, err := NewStrategy("Unknown", configuration.Validator{}); err == nil {
+		t.Error("created unknown strategy")
+	}
+
+	if DefensiveStrategy.OnFork() != StakeLatestStrategy || MakeNodesStrategy.OnFork() != MakeNodesStrategy {
+		t.Error("unexpected strategy on fork")
+	}
+
+	for _, strategy := range []BuiltinStrategy{WatchtowerStrategy, DefensiveStrategy, StakeLatestStrategy, MakeNodesStrategy} {
+		createHonest, _ := strategy.ShouldCreateNode(ctx, view, false)
+		createDefensive, _ := strategy.ShouldCreateNode(ctx, view, true)
+		if createHonest != (strategy == MakeNodesStrategy) {
+			t.Error(strategy.Name(), "creating nodes without wrong nodes:", createHonest)
+		}
+		if createDefensive != (strategy != WatchtowerStrategy) {
+			t.Error(strategy.Name(), "creating nodes against wrong nodes:", createDefensive)
+		}
+		resolveStaked, _ := strategy.ShouldResolveNodes(ctx, view, true)
+		resolveUnstaked, _ := strategy.ShouldResolveNodes(ctx, view, false)
+		if resolveStaked != (strategy == MakeNodesStrategy) {
+			t.Error(strategy.Name(), "resolving nodes while staked:", resolveStaked)
+		}
+		if resolveUnstaked != (strategy >= StakeLatestStrategy) {
+			t.Error(strategy.Name(), "resolving nodes while unstaked:", resolveUnstaked)
+		}
+	}
+	if view.elevatedChecks != 1 {
+		t.Error("required stake checked", view.elevatedChecks, "times")
+	}
+}
+
+func TestCostAwareStrategy(t *testing.T) {
+	ctx := context.Background()
+	config := configuration.Validator{
+		L1PostingStrategy: configuration.L1PostingStrategy{HighGasThreshold: 150},
+		CostAware: configuration.ValidatorCostAware{
+			// Enough for two node creations at 100 gwei
+			Budget:        0.12,
+			CreateNodeGas: 600_000,
+			ResolveGas:    150_000,
+			StakeGas:      150_000,
+		},
+	}
+	strategy, err := NewStrategy(CostAwareStrategyName, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view := &testStakerView{
+		gasPrice:      big.NewInt(100e9),
+		block:         big.NewInt(1000),
+		confirmPeriod: big.NewInt(100),
+	}
+
+	// Approving actions doesn't use the budget
+	for i := 0; i < 10; i++ {
+		if create, err := strategy.ShouldCreateNode(ctx, view, false); err != nil || !create {
+			t.Fatal("couldn't create node", i, "within budget", err)
+		}
+		if resolve, err := strategy.ShouldResolveNodes(ctx, view, true); err != nil || !resolve {
+			t.Fatal("couldn't resolve node", i, "within budget", err)
+		}
+	}
+	recorder := strategy.(SpendRecorder)
+	for i := 0; i < 2; i++ {
+		if err := recorder.RecordSpend(ctx, view, 600_000, view.gasPrice); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if create, _ := strategy.ShouldCreateNode(ctx, view, false); create {
+		t.Error("created node beyond budget")
+	}
+	if create, _ := strategy.ShouldCreateNode(ctx, view, true); !create {
+		t.Error("didn't defend against wrong node while over budget")
+	}
+	if advance, _ := strategy.ShouldAdvanceStake(ctx, view, true); !advance {
+		t.Error("didn't stake against wrong node while over budget")
+	}
+
+	// The budget is replenished once the spending leaves the confirm period
+	view.block = big.NewInt(1100)
+	if create, _ := strategy.ShouldCreateNode(ctx, view, false); !create {
+		t.Error("budget not replenished after confirm period")
+	}
+
+	view.block = big.NewInt(1300)
+	view.gasPrice = big.NewInt(200e9)
+	if resolve, _ := strategy.ShouldResolveNodes(ctx, view, true); resolve {
+		t.Error("resolved node with high gas price")
+	}
+}
@@ -195,7 +195,7 @@ type OurStakerInfo struct {
 	*ethbridge.StakerInfo
 }
 
-func (v *Validator) generateNodeAction(ctx context.Context, stakerInfo *OurStakerInfo, strategy Strategy, fromBlock int64) (nodeAction, bool, error) {
+func (v *Validator) generateNodeAction(ctx context.Context, stakerInfo *OurStakerInfo, strategy Strategy, view StakerView, fromBlock int64) (nodeAction, bool, error) {
 	startState, err := lookupNodeStartState(ctx, v.rollup.RollupWatcher, stakerInfo.LatestStakedNode, stakerInfo.LatestStakedNodeHash)
 	if err != nil {
 		return nil, false, err
@@ -285,7 +285,7 @@ func (v *Validator) generateNodeAction(ctx context.Context, stakerInfo *OurStake
 	maximumGasTarget := new(big.Int).Mul(minimumGasToConsume, big.NewInt(4))
 	maximumGasTarget = maximumGasTarget.Add(maximumGasTarget, startState.TotalGasConsumed)
 
-	if strategy > WatchtowerStrategy {
+	if strategy.Active() {
 		gasesUsed = append(gasesUsed, maximumGasTarget)
 	}
 
@@ -302,20 +302,9 @@ func (v *Validator) generateNodeAction(ctx context.Context, stakerInfo *OurStake
 			break
 		}
 		if correctNode == nil {
-			var batchItemEndAcc common.Hash
-			if nd.Assertion.After.TotalMessagesRead.Cmp(nd.AfterInboxBatchEndCount) == 0 {
-				batchItemEndAcc = nd.AfterInboxBatchAcc
-			} else if nd.Assertion.After.TotalMessagesRead.Cmp(big.NewInt(0)) > 0 {
-				var haveBatchEndAcc common.Hash
-				index1 := new(big.Int).Sub(nd.Assertion.After.TotalMessagesRead, big.NewInt(1))
-				index2 := new(big.Int).Sub(nd.AfterInboxBatchEndCount, big.NewInt(1))
-				batchItemEndAcc, haveBatchEndAcc, err = v.lookup.GetInboxAccPair(index1, index2)
-				if err != nil {
-					return nil, false, err
-				}
-				if haveBatchEndAcc != nd.AfterInboxBatchAcc {
-					return nil, false, errors.New("inbox reorg detected by batch end acc mismatch")
-				}
+			batchItemEndAcc, err := assertionInboxAcc(v.lookup, nd)
+			if err != nil {
+				return nil, false, err
 			}
 			valid, err := core.IsAssertionValid(nd.Assertion, execTracker, batchItemEndAcc)
 			if err != nil {
@@ -346,9 +335,16 @@ func (v *Validator) generateNodeAction(ctx context.Context, stakerInfo *OurStake
 		wrongNodesExist = true
 	}
 
-	if strategy == WatchtowerStrategy || correctNode != nil || (strategy < MakeNodesStrategy && !wrongNodesExist) {
+	if !strategy.Active() || correctNode != nil {
 		return correctNode, wrongNodesExist, nil
 	}
+	createNode, err := strategy.ShouldCreateNode(ctx, view, wrongNodesExist)
+	if err != nil {
+		return nil, false, err
+	}
+	if !createNode {
+		return nil, wrongNodesExist, nil
+	}
 
 	execState, _, err := execTracker.GetExecutionState(maximumGasTarget)
 	if err != nil {
@@ -456,6 +452,28 @@ func getBlockID(ctx context.Context, client ethutils.EthClient, number *big.Int)
 	}, nil
 }
 
+// assertionInboxAcc returns the inbox accumulator after the last message read
+// by the node's assertion, checking that the local inbox agrees with the batch
+// the node was created against
+func assertionInboxAcc(lookup core.ArbCoreLookup, nd *core.NodeInfo) (common.Hash, error) {
+	if nd.Assertion.After.TotalMessagesRead.Cmp(nd.AfterInboxBatchEndCount) == 0 {
+		return nd.AfterInboxBatchAcc, nil
+	}
+	if nd.Assertion.After.TotalMessagesRead.Cmp(big.NewInt(0)) == 0 {
+		return common.Hash{}, nil
+	}
+	index1 := new(big.Int).Sub(nd.Assertion.After.TotalMessagesRead, big.NewInt(1))
+	index2 := new(big.Int).Sub(nd.AfterInboxBatchEndCount, big.NewInt(1))
+	batchItemEndAcc, haveBatchEndAcc, err := lookup.GetInboxAccPair(index1, index2)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if haveBatchEndAcc != nd.AfterInboxBatchAcc {
+		return common.Hash{}, errors.New("inbox reorg detected by batch end acc mismatch")
+	}
+	return batchItemEndAcc, nil
+}
+
 func lookupNodeStartState(ctx context.Context, rollup *ethbridge.RollupWatcher, nodeNum *big.Int, nodeHash [32]byte) (*core.NodeState, error) {
 	if nodeNum.Cmp(big.NewInt(0)) == 0 {
 		creationEvent, err := rollup.LookupCreation(ctx)
@@ -0,0 +1,454 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+)
+
+const (
+	AlertInvalidAssertion = "invalid_assertion"
+	AlertFork             = "fork"
+)
+
+// NodeStatus is the result of checking a single rollup node against local
+// execution
+type NodeStatus struct {
+	Node          uint64         `json:"node"`
+	Hash          ethcommon.Hash `json:"hash"`
+	ProposedBlock uint64         `json:"proposedBlock"`
+	CheckedBlock  uint64         `json:"checkedBlock"`
+	LagBlocks     uint64         `json:"lagBlocks"`
+	Valid         bool           `json:"valid"`
+}
+
+type WatchOnlyStatus struct {
+	Rollup                common.Address `json:"rollup"`
+	LatestConfirmedNode   uint64         `json:"latestConfirmedNode"`
+	LatestNode            uint64         `json:"latestNode"`
+	LastCheckedNode       uint64         `json:"lastCheckedNode"`
+	NodesBehind           uint64         `json:"nodesBehind"`
+	UnresolvedNodesLinear bool           `json:"unresolvedNodesLinear"`
+	InvalidNodes          []uint64       `json:"invalidNodes"`
+	Nodes                 []*NodeStatus  `json:"nodes"`
+	LastError             string         `json:"lastError,omitempty"`
+	UpdatedAt             time.Time      `json:"updatedAt"`
+}
+
+// Alert is the body POSTed to the configured webhook
+type Alert struct {
+	Type    string          `json:"type"`
+	Rollup  common.Address  `json:"rollup"`
+	Node    uint64          `json:"node,omitempty"`
+	Hash    *ethcommon.Hash `json:"hash,omitempty"`
+	Message string          `json:"message"`
+	Time    time.Time       `json:"time"`
+}
+
+// WatchOnlyValidator checks every rollup node's assertion against local
+// execution without a wallet, reporting the results rather than acting on
+// them
+type WatchOnlyValidator struct {
+	rollup         *ethbridge.RollupWatcher
+	validatorUtils *ethbridge.ValidatorUtils
+	lookup         core.ArbCoreLookup
+	client         ethutils.EthClient
+	config         configuration.ValidatorWatchOnly
+	rollupAddress  common.Address
+	httpClient     *http.Client
+
+	// Only accessed from the update loop
+	nextNode *big.Int
+	cursor   core.ExecutionCursor
+
+	mutex  sync.Mutex
+	status WatchOnlyStatus
+	nodes  map[uint64]*NodeStatus
+
+	latestNodeGauge     metrics.Gauge
+	checkedNodeGauge    metrics.Gauge
+	nodesBehindGauge    metrics.Gauge
+	lagBlocksGauge      metrics.Gauge
+	forkGauge           metrics.Gauge
+	validNodesCounter   metrics.Counter
+	invalidNodesCounter metrics.Counter
+	alertErrorsCounter  metrics.Counter
+}
+
+func NewWatchOnlyValidator(
+	rollupAddress common.Address,
+	fromBlock int64,
+	validatorUtilsAddress common.Address,
+	lookup core.ArbCoreLookup,
+	client ethutils.EthClient,
+	callOpts bind.CallOpts,
+	config configuration.ValidatorWatchOnly,
+	registry metrics.Registry,
+) (*WatchOnlyValidator, error) {
+	rollup, err := ethbridge.NewRollupWatcher(rollupAddress.ToEthAddress(), fromBlock, client, callOpts)
+	if err != nil {
+		return nil, err
+	}
+	validatorUtils, err := ethbridge.NewValidatorUtils(
+		validatorUtilsAddress.ToEthAddress(),
+		rollupAddress.ToEthAddress(),
+		client,
+		callOpts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return newWatchOnlyValidator(rollupAddress, rollup, validatorUtils, lookup, client, config, registry), nil
+}
+
+func newWatchOnlyValidator(
+	rollupAddress common.Address,
+	rollup *ethbridge.RollupWatcher,
+	validatorUtils *ethbridge.ValidatorUtils,
+	lookup core.ArbCoreLookup,
+	client ethutils.EthClient,
+	config configuration.ValidatorWatchOnly,
+	registry metrics.Registry,
+) *WatchOnlyValidator {
+	return &WatchOnlyValidator{
+		rollup:              rollup,
+		validatorUtils:      validatorUtils,
+		lookup:              lookup,
+		client:              client,
+		config:              config,
+		rollupAddress:       rollupAddress,
+		httpClient:          &http.Client{Timeout: config.WebhookTimeout},
+		status:              WatchOnlyStatus{Rollup: rollupAddress, UnresolvedNodesLinear: true},
+		nodes:               make(map[uint64]*NodeStatus),
+		latestNodeGauge:     metrics.NewRegisteredGauge("arbitrum/validator/watch/latest_node", registry),
+		checkedNodeGauge:    metrics.NewRegisteredGauge("arbitrum/validator/watch/checked_node", registry),
+		nodesBehindGauge:    metrics.NewRegisteredGauge("arbitrum/validator/watch/nodes_behind", registry),
+		lagBlocksGauge:      metrics.NewRegisteredGauge("arbitrum/validator/watch/lag_blocks", registry),
+		forkGauge:           metrics.NewRegisteredGauge("arbitrum/validator/watch/fork", registry),
+		validNodesCounter:   metrics.NewRegisteredCounter("arbitrum/validator/watch/valid_nodes", registry),
+		invalidNodesCounter: metrics.NewRegisteredCounter("arbitrum/validator/watch/invalid_nodes", registry),
+		alertErrorsCounter:  metrics.NewRegisteredCounter("arbitrum/validator/watch/alert_errors", registry),
+	}
+}
+
+func (w *WatchOnlyValidator) RunInBackground(ctx context.Context) chan bool {
+	done := make(chan bool)
+	go func() {
+		defer func() {
+			done <- true
+		}()
+		for {
+			err := w.update(ctx)
+			w.mutex.Lock()
+			if err != nil {
+				logger.Warn().Err(err).Msg("error checking rollup nodes")
+				w.status.LastError = err.Error()
+			} else {
+				w.status.LastError = ""
+			}
+			w.status.UpdatedAt = time.Now()
+			w.mutex.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(w.config.PollInterval):
+			}
+		}
+	}()
+	return done
+}
+
+// StartServer serves the current status as JSON until ctx is done
+func (w *WatchOnlyValidator) StartServer(ctx context.Context) error {
+	return StartWatchOnlyServer(ctx, w.config, []*WatchOnlyValidator{w})
+}
+
+// StartWatchOnlyServer serves the status of several watch-only validators on
+// one port. The root path reports every rollup, or just the rollup itself if
+// there's only one, and /rollup/<address> reports a single rollup.
+func StartWatchOnlyServer(ctx context.Context, config configuration.ValidatorWatchOnly, validators []*WatchOnlyValidator) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, _ *http.Request) {
+		if len(validators) == 1 {
+			validators[0].handleStatus(rw, nil)
+			return
+		}
+		statuses := make([]WatchOnlyStatus, 0, len(validators))
+		healthy := true
+		for _, w := range validators {
+			status := w.Status()
+			healthy = healthy && status.healthy()
+			statuses = append(statuses, status)
+		}
+		writeStatus(rw, healthy, statuses)
+	})
+	for _, w := range validators {
+		mux.HandleFunc("/rollup/"+strings.ToLower(w.rollupAddress.Hex()), w.handleStatus)
+	}
+	server := &http.Server{
+		Addr:    config.Addr + ":" + config.Port,
+		Handler: mux,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (w *WatchOnlyValidator) handleStatus(rw http.ResponseWriter, _ *http.Request) {
+	status := w.Status()
+	writeStatus(rw, status.healthy(), status)
+}
+
+func writeStatus(rw http.ResponseWriter, healthy bool, status interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(rw).Encode(status); err != nil {
+		logger.Warn().Err(err).Msg("error writing status")
+	}
+}
+
+func (s WatchOnlyStatus) healthy() bool {
+	return len(s.InvalidNodes) == 0 && s.UnresolvedNodesLinear
+}
+
+// Status returns a copy of the latest status including every unresolved node
+// that has been checked
+func (w *WatchOnlyValidator) Status() WatchOnlyStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	status := w.status
+	status.InvalidNodes = make([]uint64, 0)
+	status.Nodes = make([]*NodeStatus, 0, len(w.nodes))
+	for _, node := range w.nodes {
+		nodeCopy := *node
+		status.Nodes = append(status.Nodes, &nodeCopy)
+		if !node.Valid {
+			status.InvalidNodes = append(status.InvalidNodes, node.Node)
+		}
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool {
+		return status.Nodes[i].Node < status.Nodes[j].Node
+	})
+	sort.Slice(status.InvalidNodes, func(i, j int) bool {
+		return status.InvalidNodes[i] < status.InvalidNodes[j]
+	})
+	return status
+}
+
+func (w *WatchOnlyValidator) update(ctx context.Context) error {
+	latestConfirmed, err := w.rollup.LatestConfirmedNode(ctx)
+	if err != nil {
+		return err
+	}
+	latestNode, err := w.rollup.LatestNodeCreated(ctx)
+	if err != nil {
+		return err
+	}
+	linear, err := w.validatorUtils.AreUnresolvedNodesLinear(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	wasLinear := w.status.UnresolvedNodesLinear
+	w.status.LatestConfirmedNode = latestConfirmed.Uint64()
+	w.status.LatestNode = latestNode.Uint64()
+	w.status.UnresolvedNodesLinear = linear
+	for num := range w.nodes {
+		if num <= latestConfirmed.Uint64() {
+			delete(w.nodes, num)
+		}
+	}
+	w.mutex.Unlock()
+	w.latestNodeGauge.Update(latestNode.Int64())
+	if linear {
+		w.forkGauge.Update(0)
+	} else {
+		w.forkGauge.Update(1)
+		if wasLinear {
+			logger.Error().Str("latestConfirmed", latestConfirmed.String()).Msg("unresolved rollup nodes have forked")
+			w.sendAlert(ctx, Alert{
+				Type:    AlertFork,
+				Message: "unresolved rollup nodes are not linear",
+			})
+		}
+	}
+
+	if w.nextNode == nil || w.nextNode.Cmp(latestConfirmed) <= 0 {
+		// Confirmed nodes are already settled so start after them
+		w.nextNode = new(big.Int).Add(latestConfirmed, big.NewInt(1))
+		w.cursor = nil
+	}
+	defer w.updateLag(latestNode)
+	for w.nextNode.Cmp(latestNode) <= 0 {
+		checked, err := w.checkNode(ctx, w.nextNode)
+		if err != nil {
+			return err
+		}
+		if !checked {
+			// Waiting for local execution to catch up
+			return nil
+		}
+		w.nextNode = new(big.Int).Add(w.nextNode, big.NewInt(1))
+	}
+	return nil
+}
+
+func (w *WatchOnlyValidator) updateLag(latestNode *big.Int) {
+	checked := new(big.Int).Sub(w.nextNode, big.NewInt(1))
+	behind := new(big.Int).Sub(latestNode, checked)
+	if behind.Sign() < 0 {
+		behind.SetInt64(0)
+	}
+	w.checkedNodeGauge.Update(checked.Int64())
+	w.nodesBehindGauge.Update(behind.Int64())
+	w.mutex.Lock()
+	w.status.LastCheckedNode = checked.Uint64()
+	w.status.NodesBehind = behind.Uint64()
+	w.mutex.Unlock()
+}
+
+// checkNode returns false if the node can't be checked until more messages
+// have been executed locally
+func (w *WatchOnlyValidator) checkNode(ctx context.Context, nodeNum *big.Int) (bool, error) {
+	nd, err := w.rollup.LookupNode(ctx, nodeNum)
+	if err != nil {
+		return false, err
+	}
+	if w.lookup.MachineMessagesRead().Cmp(nd.Assertion.After.TotalMessagesRead) < 0 {
+		return false, nil
+	}
+	batchItemEndAcc, err := assertionInboxAcc(w.lookup, nd)
+	if err != nil {
+		return false, err
+	}
+
+	afterGas := nd.Assertion.After.TotalGasConsumed
+	var execTracker *core.ExecutionTracker
+	if w.cursor != nil && w.cursor.TotalGasConsumed().Cmp(nd.Assertion.Before.TotalGasConsumed) == 0 {
+		// Continue from the previous node when the chain is linear
+		execTracker = core.NewExecutionTrackerWithInitialCursor(w.lookup, false, []*big.Int{afterGas}, w.cursor.Clone(), false)
+	} else {
+		execTracker = core.NewExecutionTracker(w.lookup, false, []*big.Int{afterGas}, false)
+	}
+	valid, err := core.IsAssertionValid(nd.Assertion, execTracker, batchItemEndAcc)
+	if err != nil {
+		return false, err
+	}
+	if valid {
+		w.cursor, err = execTracker.GetExecutionCursor(afterGas)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	currentBlock, err := w.client.BlockInfoByNumber(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	status := &NodeStatus{
+		Node:          nodeNum.Uint64(),
+		Hash:          nd.NodeHash.ToEthHash(),
+		ProposedBlock: nd.BlockProposed.Height.AsInt().Uint64(),
+		CheckedBlock:  (*big.Int)(currentBlock.Number).Uint64(),
+		Valid:         valid,
+	}
+	if status.CheckedBlock > status.ProposedBlock {
+		status.LagBlocks = status.CheckedBlock - status.ProposedBlock
+	}
+	w.lagBlocksGauge.Update(int64(status.LagBlocks))
+	w.mutex.Lock()
+	w.nodes[status.Node] = status
+	w.mutex.Unlock()
+
+	if valid {
+		w.validNodesCounter.Inc(1)
+		logger.Info().Uint64("node", status.Node).Msg("rollup node is valid")
+	} else {
+		w.invalidNodesCounter.Inc(1)
+		logger.Error().Uint64("node", status.Node).Str("hash", nd.NodeHash.String()).Msg("rollup node has invalid assertion")
+		hash := nd.NodeHash.ToEthHash()
+		w.sendAlert(ctx, Alert{
+			Type:    AlertInvalidAssertion,
+			Node:    status.Node,
+			Hash:    &hash,
+			Message: "rollup node assertion doesn't match local execution",
+		})
+	}
+	return true, nil
+}
+
+func (w *WatchOnlyValidator) sendAlert(ctx context.Context, alert Alert) {
+	if len(w.config.WebhookURL) == 0 {
+		return
+	}
+	alert.Rollup = w.rollupAddress
+	alert.Time = time.Now()
+	if err := w.postAlert(ctx, alert); err != nil {
+		w.alertErrorsCounter.Inc(1)
+		logger.Error().Err(err).Str("type", alert.Type).Msg("failed to send alert")
+	}
+}
+
+func (w *WatchOnlyValidator) postAlert(ctx context.Context, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.WebhookURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook returned status %v", resp.Status)
+	}
+	return nil
+}
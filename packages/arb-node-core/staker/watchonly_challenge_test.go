@@ -0,0 +1,135 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/challenge"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/staker"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/staker/stakertest"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func TestWatchOnlyDetectsInvalidNode(t *testing.T) {
+	ctx := context.Background()
+	harness := stakertest.NewChallengeHarness(t, stakertest.ChallengeHarnessConfig{
+		Fault:         challenge.FaultConfig{DistortMachineAtGas: big.NewInt(1)},
+		MaxGasPerNode: big.NewInt(390),
+		ExpectedEnd:   stakertest.OneStepProof,
+	})
+	defer harness.Close()
+
+	// The faulty staker proposes the first node, and the honest staker then
+	// creates a conflicting one
+	actUntilNode := func(s *staker.Staker, node int64) {
+		for i := 0; i < 20; i++ {
+			latest, err := harness.Rollup.LatestNodeCreated(ctx)
+			test.FailIfError(t, err)
+			if latest.Cmp(big.NewInt(node)) >= 0 {
+				return
+			}
+			_, err = s.Act(ctx)
+			test.FailIfError(t, err)
+			harness.Client.Commit()
+		}
+		t.Fatal("node", node, "not created")
+	}
+	actUntilNode(harness.Faulty, 1)
+	actUntilNode(harness.Honest, 2)
+
+	receiver := staker.NewAlertReceiver(t, http.StatusOK)
+	defer receiver.Close()
+	watcher, err := staker.NewWatchOnlyValidator(
+		common.NewAddressFromEth(harness.RollupAddress),
+		harness.RollupBlock.Int64(),
+		common.NewAddressFromEth(harness.ValidatorUtils),
+		harness.Monitor.Core,
+		harness.Client,
+		bind.CallOpts{},
+		receiver.Config(),
+		metrics.NewRegistry(),
+	)
+	test.FailIfError(t, err)
+
+	for i := 0; ; i++ {
+		test.FailIfError(t, watcher.Update(ctx))
+		if watcher.Status().LastCheckedNode >= 2 {
+			break
+		}
+		if i == 20 {
+			t.Fatal("watcher didn't check both nodes")
+		}
+		harness.Client.Commit()
+		<-time.After(time.Millisecond * 500)
+	}
+
+	status := watcher.Status()
+	if len(status.InvalidNodes) != 1 || status.InvalidNodes[0] != 1 {
+		t.Fatal("expected node 1 to be invalid but got", status.InvalidNodes)
+	}
+	if len(status.Nodes) != 2 || !status.Nodes[1].Valid {
+		t.Error("expected honest node 2 to be valid")
+	}
+	if status.UnresolvedNodesLinear {
+		t.Error("conflicting nodes not reported as a fork")
+	}
+
+	var invalidAlert, forkAlert *staker.Alert
+	for _, alert := range receiver.Received() {
+		alert := alert
+		switch alert.Type {
+		case staker.AlertInvalidAssertion:
+			invalidAlert = &alert
+		case staker.AlertFork:
+			forkAlert = &alert
+		}
+	}
+	if invalidAlert == nil {
+		t.Fatal("no alert for invalid node")
+	}
+	if invalidAlert.Node != 1 || invalidAlert.Hash == nil || *invalidAlert.Hash != status.Nodes[0].Hash {
+		t.Error("alert for wrong node", invalidAlert.Node, invalidAlert.Hash)
+	}
+	if invalidAlert.Rollup != common.NewAddressFromEth(harness.RollupAddress) {
+		t.Error("alert for wrong rollup", invalidAlert.Rollup)
+	}
+	if forkAlert == nil {
+		t.Error("no alert for fork")
+	}
+
+	recorder := httptest.NewRecorder()
+	watcher.HandleStatus(recorder, nil)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Error("status served with code", recorder.Code, "despite invalid node")
+	}
+	var served staker.WatchOnlyStatus
+	test.FailIfError(t, json.NewDecoder(recorder.Body).Decode(&served))
+	if len(served.InvalidNodes) != 1 || served.InvalidNodes[0] != 1 {
+		t.Error("served status reports invalid nodes", served.InvalidNodes)
+	}
+}
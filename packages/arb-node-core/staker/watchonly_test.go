@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package staker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+// AlertReceiver is a webhook that records the alerts posted to it. It's
+// exported for the tests in package staker_test.
+type AlertReceiver struct {
+	server *httptest.Server
+	alerts chan Alert
+	status int
+}
+
+func NewAlertReceiver(t *testing.T, status int) *AlertReceiver {
+	r := &AlertReceiver{
+		alerts: make(chan Alert, 10),
+		status: status,
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(req.Body).Decode(&alert); err != nil {
+			t.Error("webhook received invalid alert", err)
+		}
+		r.alerts <- alert
+		rw.WriteHeader(r.status)
+	}))
+	return r
+}
+
+func (r *AlertReceiver) Config() configuration.ValidatorWatchOnly {
+	return configuration.ValidatorWatchOnly{
+		PollInterval:   time.Second,
+		WebhookTimeout: time.Second,
+		WebhookURL:     r.server.URL,
+	}
+}
+
+func (r *AlertReceiver) Close() {
+	r.server.Close()
+}
+
+func (r *AlertReceiver) Received() []Alert {
+	var alerts []Alert
+	for {
+		select {
+		case alert := <-r.alerts:
+			alerts = append(alerts, alert)
+		default:
+			return alerts
+		}
+	}
+}
+
+func TestWatchOnlyAlerts(t *testing.T) {
+	ctx := context.Background()
+	rollup := common.RandAddress()
+	alert := Alert{Type: AlertFork, Message: "test alert"}
+
+	receiver := NewAlertReceiver(t, http.StatusOK)
+	defer receiver.Close()
+	watcher := newWatchOnlyValidator(rollup, nil, nil, nil, nil, receiver.Config(), metrics.NewRegistry())
+	watcher.sendAlert(ctx, alert)
+	alerts := receiver.Received()
+	if len(alerts) != 1 {
+		t.Fatal("expected 1 alert but got", len(alerts))
+	}
+	if alerts[0].Type != AlertFork || alerts[0].Message != alert.Message || alerts[0].Rollup != rollup || alerts[0].Time.IsZero() {
+		t.Error("wrong alert received", alerts[0])
+	}
+	if watcher.alertErrorsCounter.Count() != 0 {
+		t.Error("successful alert counted as error")
+	}
+
+	failing := NewAlertReceiver(t, http.StatusInternalServerError)
+	defer failing.Close()
+	watcher = newWatchOnlyValidator(rollup, nil, nil, nil, nil, failing.Config(), metrics.NewRegistry())
+	watcher.sendAlert(ctx, alert)
+	if len(failing.Received()) != 1 {
+		t.Error("alert not sent")
+	}
+	if watcher.alertErrorsCounter.Count() != 1 {
+		t.Error("rejected alert not counted as error")
+	}
+
+	// Without a webhook nothing is sent
+	config := receiver.Config()
+	config.WebhookURL = ""
+	watcher = newWatchOnlyValidator(rollup, nil, nil, nil, nil, config, metrics.NewRegistry())
+	watcher.sendAlert(ctx, alert)
+	if len(receiver.Received()) != 0 {
+		t.Error("alert sent without webhook")
+	}
+}
+
+func TestWatchOnlyStatus(t *testing.T) {
+	watcher := newWatchOnlyValidator(common.RandAddress(), nil, nil, nil, nil, configuration.ValidatorWatchOnly{}, metrics.NewRegistry())
+	recorder := httptest.NewRecorder()
+	watcher.handleStatus(recorder, nil)
+	if recorder.Code != http.StatusOK {
+		t.Error("healthy status served with code", recorder.Code)
+	}
+
+	for _, node := range []uint64{5, 3, 4} {
+		watcher.nodes[node] = &NodeStatus{Node: node, Valid: node != 4}
+	}
+	status := watcher.Status()
+	for i, node := range status.Nodes {
+		if node.Node != uint64(i+3) {
+			t.Fatal("nodes not sorted", status.Nodes)
+		}
+	}
+	if len(status.InvalidNodes) != 1 || status.InvalidNodes[0] != 4 {
+		t.Error("wrong invalid nodes", status.InvalidNodes)
+	}
+
+	// The status is a copy
+	status.Nodes[0].Valid = false
+	if !watcher.nodes[3].Valid {
+		t.Error("status shares node with validator")
+	}
+
+	recorder = httptest.NewRecorder()
+	watcher.handleStatus(recorder, nil)
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Error("unhealthy status served with code", recorder.Code)
+	}
+}
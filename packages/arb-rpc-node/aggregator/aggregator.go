@@ -160,8 +160,8 @@ func (m *Server) GetTxInBlockAtIndexResults(res *machine.BlockInfo, index uint64
 	return evmRes, nil
 }
 
-func (m *Server) GetSnapshot(blockHeight uint64) (*snapshot.Snapshot, error) {
-	return m.db.GetSnapshot(blockHeight)
+func (m *Server) GetSnapshot(ctx context.Context, blockHeight uint64) (*snapshot.Snapshot, error) {
+	return m.db.GetSnapshot(ctx, blockHeight)
 }
 
 func (m *Server) LatestSnapshot() (*snapshot.Snapshot, error) {
@@ -36,11 +36,14 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/arbtransaction"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/tracing"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
 )
 
 var logger = log.With().Caller().Stack().Str("component", "batcher").Logger()
 
+var tracer = tracing.Tracer("batcher")
+
 const maxBatchSize ethcommon.StorageSize = 120000
 
 type txResponse int
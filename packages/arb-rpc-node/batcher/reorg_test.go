@@ -0,0 +1,535 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethbridgecontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
+)
+
+// reorgTestNode is an inbox reader feeding a core and TxDB
+type reorgTestNode struct {
+	mon *monitor.Monitor
+	db  *txdb.TxDB
+}
+
+// reorgTestChain is a rollup on a simulated L1 that can be reorganized while
+// a sequencer and other nodes are following it
+type reorgTestChain struct {
+	t      *testing.T
+	ctx    context.Context
+	client *ethutils.ReorgEthClient
+
+	rollupAddr      ethcommon.Address
+	rollupBlock     *big.Int
+	bridgeUtilsAddr ethcommon.Address
+	seqInbox        *ethbridgecontracts.SequencerInbox
+	delayedBridge   *ethbridgecontracts.Bridge
+
+	// Delayed messages are sent by an account other than the sequencer so
+	// that they can be dropped without affecting batch posting
+	delayedAuth      *bind.TransactOpts
+	delayedInbox     *ethbridge.StandardInbox
+	delayedInboxAddr ethcommon.Address
+
+	batcher *SequencerBatcher
+	seqNode *reorgTestNode
+	nodes   []*reorgTestNode
+
+	// Index into the random transactions sent to the sequencer
+	txes    []*types.Transaction
+	txIndex int
+}
+
+func startReorgTestNode(t *testing.T, chain *reorgTestChain) (*reorgTestNode, func()) {
+	mon, shutdown := monitor.PrepareArbCore(t)
+	_, err := mon.StartInboxReader(
+		chain.ctx,
+		chain.client,
+		configuration.DefaultL1LogFetchSettings(),
+		common.NewAddressFromEth(chain.rollupAddr),
+		chain.rollupBlock.Int64(),
+		common.NewAddressFromEth(chain.bridgeUtilsAddr),
+		nil,
+		make(chan broadcaster.BroadcastFeedMessage),
+	)
+	if err != nil {
+		shutdown()
+		t.Fatal(err)
+	}
+	cacheConfig := configuration.NodeCache{
+		AllowSlowLookup: true,
+		LRUSize:         1000,
+		TimedExpire:     20 * time.Minute,
+	}
+	db, _, err := txdb.New(chain.ctx, mon.Core, mon.Storage.GetNodeStore(), 10*time.Millisecond, &cacheConfig)
+	if err != nil {
+		shutdown()
+		t.Fatal(err)
+	}
+	return &reorgTestNode{mon: mon, db: db}, func() {
+		db.Close()
+		shutdown()
+	}
+}
+
+func newReorgTestChain(t *testing.T, delayedMessagesTargetDelay int64) (*reorgTestChain, func()) {
+	arbosPath, err := arbos.Path(false)
+	test.FailIfError(t, err)
+	mach, err := cmachine.New(arbosPath)
+	test.FailIfError(t, err)
+
+	l2ChainId := common.RandBigInt()
+	var owner common.Address
+	init, err := message.NewInitMessage(protocol.ChainParams{}, owner, []message.ChainConfigOption{message.ChainIDConfig{ChainId: l2ChainId}})
+	test.FailIfError(t, err)
+
+	backend, auths := test.SimulatedBackend(t)
+	auth := auths[0]
+	client := ethutils.NewReorgEthClient(backend)
+
+	rollupAddr, delayedInboxAddr, rollupBlock := deployRollup(
+		t,
+		auth,
+		client.SimulatedEthClient,
+		mach.Hash(),
+		big.NewInt(100),
+		big.NewInt(0),
+		big.NewInt(100000),
+		big.NewInt(100),
+		common.Address{},
+		owner,
+		common.NewAddressFromEth(auth.From),
+		big.NewInt(200),
+		big.NewInt(3000),
+		init.ExtraConfig,
+	)
+	gasRefunderAddr, _, _, err := ethbridgecontracts.DeployGasRefunder(auth, client)
+	test.FailIfError(t, err)
+	bridgeUtilsAddr, _, _, err := ethbridgecontracts.DeployBridgeUtils(auth, client)
+	test.FailIfError(t, err)
+	client.Commit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chain := &reorgTestChain{
+		t:                t,
+		ctx:              ctx,
+		client:           client,
+		rollupAddr:       rollupAddr,
+		rollupBlock:      rollupBlock,
+		bridgeUtilsAddr:  bridgeUtilsAddr,
+		delayedAuth:      auths[1],
+		delayedInboxAddr: delayedInboxAddr,
+		txes:             generateTxs(t, 200, 10, l2ChainId),
+	}
+	var shutdowns []func()
+	shutdown := func() {
+		cancel()
+		for i := len(shutdowns) - 1; i >= 0; i-- {
+			shutdowns[i]()
+		}
+	}
+	returning := false
+	defer (func() {
+		if !returning {
+			shutdown()
+		}
+	})()
+
+	rollup, err := ethbridge.NewRollupWatcher(rollupAddr, rollupBlock.Int64(), client, bind.CallOpts{})
+	test.FailIfError(t, err)
+	seqInboxAddr, err := rollup.SequencerBridge(ctx)
+	test.FailIfError(t, err)
+	chain.seqInbox, err = ethbridgecontracts.NewSequencerInbox(seqInboxAddr.ToEthAddress(), client)
+	test.FailIfError(t, err)
+	delayedBridgeAddr, err := rollup.DelayedBridge(ctx)
+	test.FailIfError(t, err)
+	chain.delayedBridge, err = ethbridgecontracts.NewBridge(delayedBridgeAddr.ToEthAddress(), client)
+	test.FailIfError(t, err)
+	chain.resetDelayedSender()
+
+	for i := 0; i < 5; i++ {
+		client.Commit()
+	}
+
+	var nodeShutdown func()
+	chain.seqNode, nodeShutdown = startReorgTestNode(t, chain)
+	shutdowns = append(shutdowns, nodeShutdown)
+	otherNode, nodeShutdown := startReorgTestNode(t, chain)
+	shutdowns = append(shutdowns, nodeShutdown)
+	chain.nodes = []*reorgTestNode{chain.seqNode, otherNode}
+
+	config := configuration.Config{
+		Node: configuration.Node{
+			Sequencer: configuration.Sequencer{
+				CreateBatchBlockInterval:   5,
+				DelayedMessagesTargetDelay: delayedMessagesTargetDelay,
+				MaxBatchGasCost:            2_000_000,
+				GasRefunderAddress:         gasRefunderAddr.String(),
+			},
+		},
+	}
+	dummyDataSigner := func([]byte) ([]byte, error) { return make([]byte, 0), nil }
+	chain.batcher, err = NewSequencerBatcher(
+		ctx,
+		chain.seqNode.mon.Core,
+		chain.seqNode.db,
+		l2ChainId,
+		chain.seqNode.mon.Reader,
+		client,
+		chain.seqInbox,
+		auth,
+		dummyDataSigner,
+		nil,
+		&config,
+		&config.Wallet,
+	)
+	test.FailIfError(t, err)
+	chain.batcher.chainTimeCheckInterval = time.Millisecond * 10
+	chain.batcher.updateTimestampInterval = big.NewInt(1)
+	chain.batcher.sequenceDelayedMessagesInterval = big.NewInt(1)
+	go chain.batcher.Start(ctx)
+
+	// Wait for the initial message to be sequenced and posted
+	chain.waitFor("initial batch", func() (bool, error) {
+		msgCount, err := chain.seqInbox.MessageCount(&bind.CallOpts{Context: ctx})
+		return err == nil && msgCount.Sign() > 0, err
+	})
+
+	returning = true
+	return chain, shutdown
+}
+
+// resetDelayedSender picks up the delayed message sender's nonce from the
+// current chain, which is needed after its transactions were dropped
+func (c *reorgTestChain) resetDelayedSender() {
+	c.delayedAuth.Nonce = nil
+	transactAuth, err := transactauth.NewTransactAuth(c.ctx, c.client, c.delayedAuth)
+	test.FailIfError(c.t, err)
+	c.delayedInbox, err = ethbridge.NewStandardInbox(c.delayedInboxAddr, c.client, transactAuth)
+	test.FailIfError(c.t, err)
+}
+
+// waitFor produces blocks until check passes
+func (c *reorgTestChain) waitFor(description string, check func() (bool, error)) {
+	c.t.Helper()
+	timeout := time.Now().Add(time.Minute)
+	for {
+		done, err := check()
+		if done {
+			return
+		}
+		if time.Now().After(timeout) {
+			c.t.Fatalf("timed out waiting for %v: %v", description, err)
+		}
+		c.client.Commit()
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// sendTransactions sends count L2 transactions to the sequencer, producing
+// an L1 block after each one
+func (c *reorgTestChain) sendTransactions(count int) {
+	c.t.Helper()
+	for i := 0; i < count; i++ {
+		if c.txIndex >= len(c.txes) {
+			c.t.Fatal("out of test transactions")
+		}
+		test.FailIfError(c.t, c.batcher.SendTransaction(c.ctx, c.txes[c.txIndex]))
+		c.txIndex++
+		c.client.Commit()
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// sendDelayedMessages sends count delayed messages in a single L1 block and
+// returns their transaction hashes
+func (c *reorgTestChain) sendDelayedMessages(count int) []ethcommon.Hash {
+	c.t.Helper()
+	hashes := make([]ethcommon.Hash, 0, count)
+	for i := 0; i < count; i++ {
+		arbTx, err := c.delayedInbox.SendL2MessageFromOrigin(c.ctx, []byte{byte(i)})
+		test.FailIfError(c.t, err)
+		hashes = append(hashes, arbTx.Hash())
+	}
+	c.client.Commit()
+	return hashes
+}
+
+// depthIncluding returns the reorg depth needed to replace the block
+// containing the given transaction
+func (c *reorgTestChain) depthIncluding(txHash ethcommon.Hash) uint64 {
+	c.t.Helper()
+	receipt, err := c.client.TransactionReceipt(c.ctx, txHash)
+	test.FailIfError(c.t, err)
+	head, err := c.client.HeaderByNumber(c.ctx, nil)
+	test.FailIfError(c.t, err)
+	return head.Number.Uint64() - receipt.BlockNumber.Uint64() + 1
+}
+
+// reorg replaces the last depth L1 blocks, replaying all transactions other
+// than those listed in drop
+func (c *reorgTestChain) reorg(depth uint64, drop []ethcommon.Hash) []*types.Transaction {
+	c.t.Helper()
+	dropHashes := make(map[ethcommon.Hash]bool)
+	for _, hash := range drop {
+		dropHashes[hash] = true
+	}
+	dropped, err := c.client.Reorg(c.ctx, depth, func(tx *types.Transaction) bool {
+		return !dropHashes[tx.Hash()]
+	})
+	test.FailIfError(c.t, err)
+	return dropped
+}
+
+// checkNodeMatchesL1 returns an error unless the node's inbox matches the
+// canonical chain. A sequencer may hold messages not yet posted, so only its
+// prefix is compared.
+func (c *reorgTestChain) checkNodeMatchesL1(node *reorgTestNode, isSequencer bool) error {
+	opts := &bind.CallOpts{Context: c.ctx}
+	l1MessageCount, err := c.seqInbox.MessageCount(opts)
+	if err != nil {
+		return err
+	}
+	batchCount, err := c.seqInbox.GetInboxAccsLength(opts)
+	if err != nil {
+		return err
+	}
+	l1Acc, err := c.seqInbox.InboxAccs(opts, new(big.Int).Sub(batchCount, big.NewInt(1)))
+	if err != nil {
+		return err
+	}
+	msgCount, err := node.mon.Core.GetMessageCount()
+	if err != nil {
+		return err
+	}
+	if msgCount.Cmp(l1MessageCount) < 0 || (!isSequencer && msgCount.Cmp(l1MessageCount) != 0) {
+		return errors.Errorf("node has %v messages but L1 has %v", msgCount, l1MessageCount)
+	}
+	acc, err := node.mon.Core.GetInboxAcc(new(big.Int).Sub(l1MessageCount, big.NewInt(1)))
+	if err != nil {
+		return err
+	}
+	if acc != l1Acc {
+		return errors.Errorf("node inbox accumulator %v differs from L1 %v", acc, ethcommon.Hash(l1Acc))
+	}
+
+	l1DelayedCount, err := c.delayedBridge.MessageCount(opts)
+	if err != nil {
+		return err
+	}
+	delayedCount, err := node.mon.Core.GetDelayedMessageCount()
+	if err != nil {
+		return err
+	}
+	if delayedCount.Cmp(l1DelayedCount) != 0 {
+		return errors.Errorf("node has %v delayed messages but L1 has %v", delayedCount, l1DelayedCount)
+	}
+	if l1DelayedCount.Sign() > 0 {
+		lastDelayed := new(big.Int).Sub(l1DelayedCount, big.NewInt(1))
+		l1DelayedAcc, err := c.delayedBridge.InboxAccs(opts, lastDelayed)
+		if err != nil {
+			return err
+		}
+		delayedAcc, err := node.mon.Core.GetDelayedInboxAcc(lastDelayed)
+		if err != nil {
+			return err
+		}
+		if delayedAcc != l1DelayedAcc {
+			return errors.Errorf("node delayed accumulator %v differs from L1 %v", delayedAcc, ethcommon.Hash(l1DelayedAcc))
+		}
+	}
+	return nil
+}
+
+// checkSameBlocks returns an error unless the TxDB of node has the same
+// blocks as expected, up to the height of the shorter of the two
+func checkSameBlocks(expected, node *reorgTestNode) error {
+	expectedCount, err := expected.db.BlockCount()
+	if err != nil {
+		return err
+	}
+	count, err := node.db.BlockCount()
+	if err != nil {
+		return err
+	}
+	if count < expectedCount {
+		expectedCount = count
+	}
+	for height := uint64(0); height < expectedCount; height++ {
+		expectedBlock, err := expected.db.GetBlock(height)
+		if err != nil {
+			return err
+		}
+		block, err := node.db.GetBlock(height)
+		if err != nil {
+			return err
+		}
+		if expectedBlock == nil || block == nil {
+			return errors.Errorf("missing block %v", height)
+		}
+		if expectedBlock.Header.Hash() != block.Header.Hash() {
+			return errors.Errorf("block %v has hash %v but expected %v", height, block.Header.Hash(), expectedBlock.Header.Hash())
+		}
+	}
+	return nil
+}
+
+// checkConvergence starts a node that has only ever seen the canonical chain
+// and waits for it and the existing nodes to agree with L1 and each other
+func (c *reorgTestChain) checkConvergence() {
+	c.t.Helper()
+	canonical, shutdown := startReorgTestNode(c.t, c)
+	defer shutdown()
+
+	c.waitFor("nodes to match L1", func() (bool, error) {
+		if err := c.checkNodeMatchesL1(canonical, false); err != nil {
+			return false, errors.Wrap(err, "canonical node")
+		}
+		for i, node := range c.nodes {
+			if err := c.checkNodeMatchesL1(node, node == c.seqNode); err != nil {
+				return false, errors.Wrapf(err, "node %v", i)
+			}
+		}
+		return true, nil
+	})
+	c.waitFor("TxDB blocks to match", func() (bool, error) {
+		canonicalCount, err := canonical.db.BlockCount()
+		if err != nil {
+			return false, err
+		}
+		for i, node := range c.nodes {
+			count, err := node.db.BlockCount()
+			if err != nil {
+				return false, err
+			}
+			if count < canonicalCount || (node != c.seqNode && count != canonicalCount) {
+				return false, errors.Errorf("node %v has %v blocks but canonical node has %v", i, count, canonicalCount)
+			}
+			if err := checkSameBlocks(canonical, node); err != nil {
+				return false, errors.Wrapf(err, "node %v", i)
+			}
+		}
+		return true, nil
+	})
+}
+
+func TestSequencerBatchReorgs(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	// Deeper than maxL1BackwardsReorg and the default L1 log fetch range
+	for _, depth := range []uint64{1, 4, 15, 120} {
+		t.Run(fmt.Sprintf("depth%v", depth), func(t *testing.T) {
+			chain, shutdown := newReorgTestChain(t, 1)
+			defer shutdown()
+
+			// Make sure there's enough L1 history for the reorg
+			for i := uint64(0); i < depth; i++ {
+				chain.client.Commit()
+			}
+			chain.sendTransactions(10)
+			chain.checkConvergence()
+
+			// Batches posted in the replaced blocks are included again in
+			// the first block of the new chain
+			chain.reorg(depth, nil)
+			chain.sendTransactions(10)
+			chain.checkConvergence()
+		})
+	}
+}
+
+func TestRepeatedReorgsDuringSequencing(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	chain, shutdown := newReorgTestChain(t, 1)
+	defer shutdown()
+
+	for i := 0; i < 20; i++ {
+		chain.client.Commit()
+	}
+	for _, depth := range []uint64{3, 1, 7, 2, 5} {
+		chain.sendTransactions(4)
+		chain.reorg(depth, nil)
+	}
+	chain.checkConvergence()
+}
+
+func TestDelayedMessageReorg(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	// Hold off sequencing delayed messages for long enough that the reorg
+	// removes them before they're sequenced
+	chain, shutdown := newReorgTestChain(t, 30)
+	defer shutdown()
+
+	chain.sendTransactions(5)
+	delayed := chain.sendDelayedMessages(3)
+	chain.sendTransactions(5)
+	chain.waitFor("delayed messages to be read", func() (bool, error) {
+		count, err := chain.seqNode.mon.Core.GetDelayedMessageCount()
+		return err == nil && count.Cmp(big.NewInt(4)) >= 0, err
+	})
+
+	// Drop the second delayed message, which also drops the third
+	dropped := chain.reorg(chain.depthIncluding(delayed[0]), delayed[1:2])
+	if len(dropped) != 2 {
+		t.Fatalf("expected 2 dropped transactions but got %v", len(dropped))
+	}
+	chain.resetDelayedSender()
+	chain.checkConvergence()
+
+	// Replacement messages are sequenced once they're old enough
+	chain.sendDelayedMessages(2)
+	chain.sendTransactions(5)
+	for i := 0; i < 40; i++ {
+		chain.client.Commit()
+	}
+	chain.waitFor("delayed messages to be sequenced", func() (bool, error) {
+		count, err := chain.seqInbox.TotalDelayedMessagesRead(&bind.CallOpts{Context: chain.ctx})
+		return err == nil && count.Cmp(big.NewInt(4)) >= 0, err
+	})
+	chain.checkConvergence()
+}
@@ -30,12 +30,15 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -44,6 +47,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/fireblocks"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/tracing"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/transactauth"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
 )
@@ -83,6 +87,7 @@ type SequencerBatcher struct {
 
 	signer  types.Signer
 	txQueue chan txQueueItem
+	pending *sequencerPendingState
 
 	latestChainTime        inbox.ChainTime
 	lastCreatedBatchAt     *big.Int
@@ -93,6 +98,10 @@ type SequencerBatcher struct {
 	// The total estimate of unpublished transactions' gas usage.
 	// Added to every time something is sequenced, zeroed when batch posted.
 	pendingBatchGasEstimateAtomic int64
+	// Copies of the latest L1 block seen and lastCreatedBatchAt for
+	// reporting batch posting lag outside of the batch submission thread
+	latestBlockAtomic        int64
+	lastCreatedBatchAtAtomic int64
 }
 
 var refundGasCostsDeniedEventID ethcommon.Hash
@@ -120,6 +129,7 @@ func getChainTime(ctx context.Context, client ethutils.EthClient) (inbox.ChainTi
 func NewSequencerBatcher(
 	ctx context.Context,
 	db core.ArbCore,
+	txDB *txdb.TxDB,
 	chainId *big.Int,
 	inboxReader *monitor.InboxReader,
 	client ethutils.EthClient,
@@ -159,6 +169,10 @@ func NewSequencerBatcher(
 	if err != nil {
 		return nil, err
 	}
+	transactAuth, err = transactauth.WithTxManager(ctx, client, transactAuth, config.L1.TxManager, config.Persistent.Chain)
+	if err != nil {
+		return nil, err
+	}
 
 	maxDelayBlocks, err := sequencerInbox.MaxDelayBlocks(callOpts)
 	if err != nil {
@@ -193,6 +207,7 @@ func NewSequencerBatcher(
 		}
 	}
 
+	signer := types.NewEIP155Signer(chainId)
 	batcher := &SequencerBatcher{
 		db:                         db,
 		inboxReader:                inboxReader,
@@ -215,21 +230,24 @@ func NewSequencerBatcher(
 		sequenceDelayedMessagesInterval: big.NewInt(20),
 		createBatchBlockInterval:        big.NewInt(config.Node.Sequencer.CreateBatchBlockInterval),
 
-		signer:                        types.NewEIP155Signer(chainId),
+		signer:                        signer,
 		txQueue:                       make(chan txQueueItem, 10),
+		pending:                       newSequencerPendingState(txDB, signer),
 		latestChainTime:               chainTime,
 		lastSequencedDelayedAt:        chainTime.BlockNum.AsInt(),
 		lastCreatedBatchAt:            chainTime.BlockNum.AsInt(),
 		publishingBatchAtomic:         0,
 		pendingBatchGasEstimateAtomic: int64(gasCostBase),
+		latestBlockAtomic:             chainTime.BlockNum.AsInt().Int64(),
+		lastCreatedBatchAtAtomic:      chainTime.BlockNum.AsInt().Int64(),
 		fb:                            fb,
 	}
 
 	return batcher, nil
 }
 
-func (b *SequencerBatcher) PendingTransactionCount(_ context.Context, _ common.Address) (*uint64, error) {
-	return nil, nil
+func (b *SequencerBatcher) PendingTransactionCount(_ context.Context, account common.Address) (*uint64, error) {
+	return b.pending.transactionCount(account)
 }
 
 const maxExcludeComputation int64 = 10_000
@@ -265,6 +283,14 @@ func txLogsToResults(logs []value.Value) (map[common.Hash]*evm.TxResult, error)
 const maxTxDataSize int = 100_000
 
 func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.Transaction) error {
+	ctx, span := tracer.Start(ctx, "SequencerBatcher.SendTransaction", trace.WithAttributes(
+		attribute.String("tx.hash", startTx.Hash().String()),
+	))
+	defer span.End()
+	return tracing.RecordError(span, b.sendTransaction(ctx, span, startTx))
+}
+
+func (b *SequencerBatcher) sendTransaction(ctx context.Context, span trace.Span, startTx *types.Transaction) error {
 	_, err := types.Sender(b.signer, startTx)
 	if err != nil {
 		logger.Warn().Err(err).Msg("error processing user transaction")
@@ -276,8 +302,12 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 	logger.Info().Str("hash", startTx.Hash().String()).Msg("got user tx")
 
 	startResultChan := make(chan error, 1)
+	_, queueSpan := tracer.Start(ctx, "enqueue")
 	b.txQueue <- txQueueItem{tx: startTx, resultChan: startResultChan}
+	queueSpan.End()
+	_, lockSpan := tracer.Start(ctx, "MessageDeliveryMutex.Lock")
 	b.inboxReader.MessageDeliveryMutex.Lock()
+	lockSpan.End()
 	defer b.inboxReader.MessageDeliveryMutex.Unlock()
 
 	if b.LockoutManager != nil && !b.LockoutManager.ShouldSequence() {
@@ -286,9 +316,10 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 
 	if len(startResultChan) > 0 {
 		// startTx was already picked up by another thread
+		span.AddEvent("sequenced by another request")
 		err = <-startResultChan
 		if err != nil {
-			core.WaitForMachineIdle(b.db)
+			b.waitForMachineIdle(ctx)
 		}
 		return err
 	}
@@ -335,6 +366,7 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 			seenOwnTx = true
 		}
 		logger.Info().Int("count", len(l2BatchContents)).Msg("gather user txes")
+		span.AddEvent("gathered batch", trace.WithAttributes(attribute.Int("tx.count", len(l2BatchContents))))
 
 		msgCount, err := b.db.GetMessageCount()
 		if err != nil {
@@ -369,13 +401,14 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 		}
 
 		txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
-		err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
+		err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
 		if err != nil {
 			return err
 		}
-		core.WaitForMachineIdle(b.db)
+		b.waitForMachineIdle(ctx)
 
 		var sequencedTxs []*types.Transaction
+		var sequencedResults []*evm.TxResult
 		var sequencedBatchItems []inbox.SequencerBatchItem
 
 		newLogCount, err := b.db.GetLogCount()
@@ -404,6 +437,9 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 		}
 		if successCount == len(batchTxs) {
 			sequencedTxs = batchTxs
+			for _, hash := range txHashes {
+				sequencedResults = append(sequencedResults, txResults[hash])
+			}
 			msgCount = new(big.Int).Add(msgCount, big.NewInt(1))
 			prevAcc = txBatchItem.Accumulator
 			sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
@@ -414,11 +450,11 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 			}
 		} else {
 			// Reorg to before we processed the batch and re-process the messages individually
-			err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, nil, nil, msgCount)
+			err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, nil, nil, msgCount)
 			if err != nil {
 				return err
 			}
-			core.WaitForMachineIdle(b.db)
+			b.waitForMachineIdle(ctx)
 			if successCount == 0 {
 				// All of the transactions failed
 				for i, c := range resultChans {
@@ -441,11 +477,11 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 				l2Message := message.NewSafeL2Message(batch)
 				seqMsg := message.NewInboxMessage(l2Message, b.fromAddress, new(big.Int).Set(msgCount), big.NewInt(0), b.latestChainTime.Clone())
 				txBatchItem := inbox.NewSequencerItem(totalDelayedCount, seqMsg, prevAcc)
-				err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
+				err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, []inbox.SequencerBatchItem{txBatchItem}, []inbox.DelayedMessage{}, nil)
 				if err != nil {
 					return err
 				}
-				core.WaitForMachineIdle(b.db)
+				b.waitForMachineIdle(ctx)
 				newLogCount, err = b.db.GetLogCount()
 				if err != nil {
 					return err
@@ -460,7 +496,7 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 				}
 				txResult := newTxResults[txHash]
 				if !shouldIncludeTxResult(txResult) {
-					err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, nil, nil, msgCount)
+					err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, nil, nil, msgCount)
 					if err != nil {
 						return err
 					}
@@ -471,6 +507,7 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 				prevAcc = txBatchItem.Accumulator
 				sequencedBatchItems = append(sequencedBatchItems, txBatchItem)
 				sequencedTxs = append(sequencedTxs, tx)
+				sequencedResults = append(sequencedResults, txResult)
 				postingCostEstimate := gasCostPerMessage + gasCostPerMessageByte*len(seqMsg.Data)
 				atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
 				logCount = newLogCount
@@ -488,20 +525,21 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 
 		newBlockBatchItem := inbox.NewSequencerItem(totalDelayedCount, newBlockMessage, prevAcc)
 		sequencedBatchItems = append(sequencedBatchItems, newBlockBatchItem)
-		err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, []inbox.SequencerBatchItem{newBlockBatchItem}, []inbox.DelayedMessage{}, nil)
+		err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, []inbox.SequencerBatchItem{newBlockBatchItem}, []inbox.DelayedMessage{}, nil)
 		if err != nil {
 			return err
 		}
 		atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(gasCostPerMessage))
 
 		if b.feedBroadcaster != nil {
-			err = b.feedBroadcaster.Broadcast(originalAcc, sequencedBatchItems, b.dataSigner)
+			err = b.broadcast(ctx, originalAcc, sequencedBatchItems)
 			if err != nil {
 				return err
 			}
 		}
 
-		core.WaitForMachineIdle(b.db)
+		b.waitForMachineIdle(ctx)
+		b.pending.add(sequencedTxs, sequencedResults)
 
 		if seenOwnTx {
 			break
@@ -511,9 +549,31 @@ func (b *SequencerBatcher) SendTransaction(ctx context.Context, startTx *types.T
 	return <-startResultChan
 }
 
+func (b *SequencerBatcher) deliverMessagesAndWait(ctx context.Context, previousMessageCount *big.Int, previousSeqBatchAcc common.Hash, seqBatchItems []inbox.SequencerBatchItem, delayedMessages []inbox.DelayedMessage, reorgSeqBatchItemCount *big.Int) error {
+	_, span := tracer.Start(ctx, "DeliverMessagesAndWait", trace.WithAttributes(
+		attribute.Int("items", len(seqBatchItems)),
+		attribute.Bool("reorg", reorgSeqBatchItemCount != nil),
+	))
+	defer span.End()
+	return tracing.RecordError(span, core.DeliverMessagesAndWait(b.db, previousMessageCount, previousSeqBatchAcc, seqBatchItems, delayedMessages, reorgSeqBatchItemCount))
+}
+
+func (b *SequencerBatcher) waitForMachineIdle(ctx context.Context) {
+	_, span := tracer.Start(ctx, "WaitForMachineIdle")
+	defer span.End()
+	core.WaitForMachineIdle(b.db)
+}
+
+func (b *SequencerBatcher) broadcast(ctx context.Context, prevAcc common.Hash, batchItems []inbox.SequencerBatchItem) error {
+	_, span := tracer.Start(ctx, "feed broadcast", trace.WithAttributes(attribute.Int("items", len(batchItems))))
+	defer span.End()
+	return tracing.RecordError(span, b.feedBroadcaster.Broadcast(prevAcc, batchItems, b.dataSigner))
+}
+
+// PendingSnapshot returns the latest snapshot with any transactions that have
+// been sequenced but not yet processed into a block applied on top of it
 func (b *SequencerBatcher) PendingSnapshot() (*snapshot.Snapshot, error) {
-	// TODO: return latest machine state?
-	return nil, nil
+	return b.pending.snapshot()
 }
 
 func (b *SequencerBatcher) Aggregator() *common.Address {
@@ -565,7 +625,7 @@ func (b *SequencerBatcher) deliverDelayedMessages(ctx context.Context, chainTime
 	if err != nil {
 		return false, err
 	}
-	_, isSimulatedBackend := b.client.(*ethutils.SimulatedEthClient)
+	_, isSimulatedBackend := b.client.(ethutils.SimulatedClient)
 	var getDelayedAccTarget *big.Int
 	if isSimulatedBackend {
 		// The simulated backend doesn't support querying against old blocks
@@ -597,17 +657,17 @@ func (b *SequencerBatcher) deliverDelayedMessages(ctx context.Context, chainTime
 	)
 	endBlockBatchItem := inbox.NewSequencerItem(newDelayedCount, endOfBlockMessage, batchItem.Accumulator)
 	seqBatchItems := []inbox.SequencerBatchItem{batchItem, endBlockBatchItem}
-	err = core.DeliverMessagesAndWait(b.db, msgCount, prevAcc, seqBatchItems, []inbox.DelayedMessage{}, nil)
+	err = b.deliverMessagesAndWait(ctx, msgCount, prevAcc, seqBatchItems, []inbox.DelayedMessage{}, nil)
 	if err != nil {
 		return false, err
 	}
 	postingCostEstimate := gasCostPerMessage + gasCostDelayedMessages
 	atomic.AddInt64(&b.pendingBatchGasEstimateAtomic, int64(postingCostEstimate))
 
-	core.WaitForMachineIdle(b.db)
+	b.waitForMachineIdle(ctx)
 
 	if b.feedBroadcaster != nil {
-		err = b.feedBroadcaster.Broadcast(prevAcc, seqBatchItems, b.dataSigner)
+		err = b.broadcast(ctx, prevAcc, seqBatchItems)
 		if err != nil {
 			return false, err
 		}
@@ -968,7 +1028,7 @@ func (b *SequencerBatcher) reorgAndModifySequencerMessages(ctx context.Context,
 			item.Accumulator = common.Hash{}
 		}
 	}
-	err = core.DeliverMessagesAndWait(b.db, prevMsgCount, previousSeqBatchAcc, batchItems, []inbox.DelayedMessage{}, nil)
+	err = b.deliverMessagesAndWait(ctx, prevMsgCount, previousSeqBatchAcc, batchItems, []inbox.DelayedMessage{}, nil)
 	if err != nil {
 		return err
 	}
@@ -1012,7 +1072,7 @@ func (b *SequencerBatcher) reorgOutHugeMsg(ctx context.Context, prevMsgCount *bi
 		item.LastSeqNum.Sub(item.LastSeqNum, big.NewInt(1))
 		item.Accumulator = common.Hash{}
 	}
-	err = core.DeliverMessagesAndWait(b.db, prevMsgCount, previousSeqBatchAcc, batchItems, []inbox.DelayedMessage{}, nil)
+	err = b.deliverMessagesAndWait(ctx, prevMsgCount, previousSeqBatchAcc, batchItems, []inbox.DelayedMessage{}, nil)
 	if err != nil {
 		return err
 	}
@@ -1047,6 +1107,23 @@ func (b *SequencerBatcher) getLastSequencedChainTime() (inbox.ChainTime, error)
 	return inbox.ChainTime{}, nil
 }
 
+// BatchPostingLag returns how many L1 blocks have passed since a batch was
+// last created, along with how many blocks batches are normally created within
+func (b *SequencerBatcher) BatchPostingLag() (int64, int64) {
+	lag := atomic.LoadInt64(&b.latestBlockAtomic) - atomic.LoadInt64(&b.lastCreatedBatchAtAtomic)
+	if lag < 0 {
+		lag = 0
+	}
+	expected := b.createBatchBlockInterval.Int64() + b.config.Node.Sequencer.L1PostingStrategy.HighGasDelayBlocks
+	return lag, expected
+}
+
+// ShouldSequence returns whether this sequencer currently holds the lockout,
+// or doesn't use one
+func (b *SequencerBatcher) ShouldSequence() bool {
+	return b.LockoutManager == nil || b.LockoutManager.ShouldSequence()
+}
+
 func (b *SequencerBatcher) Start(ctx context.Context) {
 	logger.Log().Msg("Starting sequencer batch submission thread")
 	firstBatchCreation := true
@@ -1104,6 +1181,7 @@ func (b *SequencerBatcher) Start(ctx context.Context) {
 		}
 		chainTime = newChainTime
 		blockNum := chainTime.BlockNum.AsInt()
+		atomic.StoreInt64(&b.latestBlockAtomic, blockNum.Int64())
 
 		// Determine if we should create a batch
 		shouldSequence := b.LockoutManager == nil || b.LockoutManager.ShouldSequence()
@@ -1182,6 +1260,7 @@ func (b *SequencerBatcher) Start(ctx context.Context) {
 				logger.Error().Err(err).Msg("error creating batch")
 			} else if complete {
 				b.lastCreatedBatchAt = blockNum
+				atomic.StoreInt64(&b.lastCreatedBatchAtAtomic, blockNum.Int64())
 				firstBatchCreation = false
 			}
 		}
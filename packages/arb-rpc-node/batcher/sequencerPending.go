@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// Transactions that are reorged out by the sequencer never show up in the
+// TxDB, so stop treating them as pending after a while
+const maxSequencedTxAge = 5 * time.Minute
+
+type sequencedTx struct {
+	tx          *types.Transaction
+	sender      common.Address
+	sequencedAt time.Time
+	// executed is set if the transaction ran and so used up its nonce
+	executed bool
+}
+
+// sequencerPendingState tracks transactions that the sequencer has delivered
+// to the core but that the TxDB hasn't yet processed into a block, so that
+// the pending block reflects them
+type sequencerPendingState struct {
+	sync.Mutex
+	db     *txdb.TxDB
+	signer types.Signer
+	// txs is ordered by sequencedAt
+	txs []sequencedTx
+
+	// checkedBlocks is the number of TxDB blocks whose transactions have
+	// been removed from txs, so only blocks after it need to be read
+	checkedBlocks uint64
+
+	// generation is incremented whenever transactions are removed from txs,
+	// since a snapshot built from the old list can't be extended
+	generation uint64
+
+	// snap is a TxDB snapshot at snapHeight with the first snapCount
+	// transactions of txs applied on top
+	snap           *snapshot.Snapshot
+	snapHeight     *common.TimeBlocks
+	snapGeneration uint64
+	snapCount      int
+}
+
+func newSequencerPendingState(db *txdb.TxDB, signer types.Signer) *sequencerPendingState {
+	return &sequencerPendingState{
+		db:     db,
+		signer: signer,
+	}
+}
+
+func executedTxResult(res *evm.TxResult) bool {
+	return res != nil && (res.ResultCode == evm.ReturnCode || res.ResultCode == evm.RevertCode)
+}
+
+// add records newly sequenced transactions along with their results and
+// notifies pending log subscribers of the logs they emitted
+func (p *sequencerPendingState) add(txs []*types.Transaction, results []*evm.TxResult) {
+	if p.db == nil || len(txs) == 0 {
+		return
+	}
+	// The TxDB may already have processed the transactions into a block
+	// before it's checked here, so look them up individually. Any that
+	// haven't been processed yet will be in a block from blockCount on.
+	blockCount, err := p.db.BlockCount()
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to get block count for pending transactions")
+		return
+	}
+	now := time.Now()
+	newTxs := make([]sequencedTx, 0, len(txs))
+	var logs []*types.Log
+	for i, tx := range txs {
+		var res *evm.TxResult
+		if i < len(results) {
+			res = results[i]
+		}
+		if res != nil {
+			logs = append(logs, res.EthLogs(common.Hash{})...)
+		}
+		sender, err := types.Sender(p.signer, tx)
+		if err != nil {
+			// Transactions are validated before being sequenced
+			logger.Error().Err(err).Str("hash", tx.Hash().String()).Msg("sequenced transaction with invalid signature")
+			continue
+		}
+		processed, err := p.db.GetRequest(common.NewHashFromEth(tx.Hash()))
+		if err != nil {
+			logger.Warn().Err(err).Str("hash", tx.Hash().String()).Msg("failed to look up sequenced transaction")
+		} else if processed != nil {
+			continue
+		}
+		newTxs = append(newTxs, sequencedTx{
+			tx:          tx,
+			sender:      common.NewAddressFromEth(sender),
+			sequencedAt: now,
+			executed:    executedTxResult(res),
+		})
+	}
+
+	p.Lock()
+	expired := 0
+	for expired < len(p.txs) && now.Sub(p.txs[expired].sequencedAt) > maxSequencedTxAge {
+		expired++
+	}
+	if expired > 0 {
+		p.txs = append([]sequencedTx{}, p.txs[expired:]...)
+		p.generation++
+	}
+	if len(p.txs) == 0 || blockCount < p.checkedBlocks {
+		p.checkedBlocks = blockCount
+	}
+	p.txs = append(p.txs, newTxs...)
+	p.Unlock()
+
+	p.db.SendPendingLogs(logs)
+}
+
+// prune drops transactions that the TxDB has processed into blocks since it
+// was last called, along with expired ones, and returns the remaining ones.
+// The TxDB is read without holding the lock.
+func (p *sequencerPendingState) prune() ([]sequencedTx, error) {
+	blockCount, err := p.db.BlockCount()
+	if err != nil {
+		return nil, err
+	}
+	p.Lock()
+	pendingCount := len(p.txs)
+	checkedBlocks := p.checkedBlocks
+	p.Unlock()
+
+	startBlock := checkedBlocks
+	if blockCount < startBlock {
+		// The TxDB was reorged
+		startBlock = blockCount
+	}
+	processed := make(map[common.Hash]bool)
+	if pendingCount > 0 {
+		for height := startBlock; height < blockCount; height++ {
+			info, err := p.db.GetBlock(height)
+			if err != nil {
+				return nil, err
+			}
+			if info == nil {
+				break
+			}
+			_, results, err := p.db.GetBlockResults(info)
+			if err != nil {
+				return nil, err
+			}
+			for _, res := range results {
+				processed[res.IncomingRequest.MessageID] = true
+			}
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if pendingCount == 0 && len(p.txs) > 0 {
+		// Transactions were added without the new blocks being read
+		return p.txs, nil
+	}
+	remaining := make([]sequencedTx, 0, len(p.txs))
+	for _, pending := range p.txs {
+		if time.Since(pending.sequencedAt) > maxSequencedTxAge || processed[common.NewHashFromEth(pending.tx.Hash())] {
+			continue
+		}
+		remaining = append(remaining, pending)
+	}
+	if len(remaining) != len(p.txs) {
+		p.txs = remaining
+		p.generation++
+	}
+	// Transactions added in the meantime set their own starting point
+	if p.checkedBlocks == checkedBlocks {
+		p.checkedBlocks = blockCount
+	}
+	return p.txs, nil
+}
+
+func (p *sequencerPendingState) transactionCount(account common.Address) (*uint64, error) {
+	if p.db == nil {
+		return nil, nil
+	}
+	txs, err := p.prune()
+	if err != nil {
+		return nil, err
+	}
+	var count *uint64
+	for _, pending := range txs {
+		if pending.sender != account || !pending.executed {
+			continue
+		}
+		next := pending.tx.Nonce() + 1
+		if count == nil || next > *count {
+			count = &next
+		}
+	}
+	return count, nil
+}
+
+func (p *sequencerPendingState) snapshot() (*snapshot.Snapshot, error) {
+	if p.db == nil {
+		return nil, nil
+	}
+	txs, err := p.prune()
+	if err != nil {
+		return nil, err
+	}
+	if len(txs) == 0 {
+		p.Lock()
+		p.snap = nil
+		p.Unlock()
+		return nil, nil
+	}
+	latest, err := p.db.LatestSnapshot()
+	if err != nil || latest == nil {
+		return nil, err
+	}
+
+	p.Lock()
+	txs = p.txs
+	generation := p.generation
+	var snap *snapshot.Snapshot
+	applied := 0
+	if p.snap != nil && p.snapGeneration == generation && p.snapHeight.Cmp(latest.Height()) == 0 {
+		snap = p.snap.Clone()
+		applied = p.snapCount
+	}
+	p.Unlock()
+
+	if snap == nil {
+		snap = latest.Clone()
+	}
+	// Only the transactions sequenced since the cached snapshot was built
+	// need to be applied
+	for _, pending := range txs[applied:] {
+		if !pending.executed {
+			continue
+		}
+		if _, err := snapWithTx(snap, pending.tx, p.signer); err != nil {
+			// Leave the transaction out of the pending state rather than
+			// failing since the TxDB will include it soon regardless
+			logger.Warn().Err(err).Str("hash", pending.tx.Hash().String()).Msg("failed to apply sequenced transaction to pending snapshot")
+		}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.generation == generation && (p.snap == nil || p.snapGeneration != generation || p.snapHeight.Cmp(latest.Height()) != 0 || p.snapCount < len(txs)) {
+		p.snap = snap
+		p.snapHeight = latest.Height().Clone()
+		p.snapGeneration = generation
+		p.snapCount = len(txs)
+	}
+	return snap.Clone(), nil
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package batcher
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func pendingTestTxs(t *testing.T, signer types.Signer, count int) (common.Address, []*types.Transaction) {
+	pk, err := crypto.GenerateKey()
+	test.FailIfError(t, err)
+	txs := make([]*types.Transaction, 0, count)
+	for i := 0; i < count; i++ {
+		tx := types.NewTransaction(uint64(i), ethcommon.Address{6}, big.NewInt(0), 1000, big.NewInt(10), []byte{byte(i)})
+		signedTx, err := types.SignTx(tx, signer, pk)
+		test.FailIfError(t, err)
+		txs = append(txs, signedTx)
+	}
+	return common.NewAddressFromEth(crypto.PubkeyToAddress(pk.PublicKey)), txs
+}
+
+func pendingTestResults(codes ...evm.ResultType) []*evm.TxResult {
+	results := make([]*evm.TxResult, 0, len(codes))
+	for _, code := range codes {
+		results = append(results, &evm.TxResult{ResultCode: code})
+	}
+	return results
+}
+
+func checkPendingCount(t *testing.T, pending *sequencerPendingState, account common.Address, expected *uint64) {
+	t.Helper()
+	count, err := pending.transactionCount(account)
+	test.FailIfError(t, err)
+	if (count == nil) != (expected == nil) || (count != nil && *count != *expected) {
+		t.Errorf("expected pending transaction count %v but got %v", expected, count)
+	}
+}
+
+func checkSnapshotNonce(t *testing.T, pending *sequencerPendingState, account common.Address, expected uint64) {
+	t.Helper()
+	snap, err := pending.snapshot()
+	test.FailIfError(t, err)
+	if snap == nil {
+		t.Fatal("no pending snapshot")
+	}
+	nonce, err := snap.GetTransactionCount(account)
+	test.FailIfError(t, err)
+	if nonce.Uint64() != expected {
+		t.Error("expected pending snapshot nonce", expected, "but got", nonce)
+	}
+}
+
+func TestSequencerPendingState(t *testing.T) {
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+	defer zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	chain, shutdown := newReorgTestChain(t, 1)
+	defer shutdown()
+	db := chain.seqNode.db
+	signer := chain.batcher.signer
+
+	// These transactions are never delivered to the core, so they stay
+	// pending until they expire
+	pending := newSequencerPendingState(db, signer)
+	account, txs := pendingTestTxs(t, signer, 5)
+	checkPendingCount(t, pending, account, nil)
+
+	// A transaction that failed to execute doesn't use up its nonce
+	pending.add(txs[:1], pendingTestResults(evm.ReturnCode))
+	pending.add(txs[1:2], pendingTestResults(evm.BadSequenceCode))
+	one := uint64(1)
+	checkPendingCount(t, pending, account, &one)
+	checkSnapshotNonce(t, pending, account, 1)
+
+	// Newly sequenced transactions are applied on top of the cached snapshot
+	pending.add(txs[1:4], pendingTestResults(evm.ReturnCode, evm.RevertCode, evm.ReturnCode))
+	four := uint64(4)
+	checkPendingCount(t, pending, account, &four)
+	checkSnapshotNonce(t, pending, account, 4)
+	if pending.snapCount != len(pending.txs) {
+		t.Error("pending snapshot not extended", pending.snapCount, len(pending.txs))
+	}
+	blockCount, err := db.BlockCount()
+	test.FailIfError(t, err)
+	if pending.checkedBlocks != blockCount {
+		t.Error("pruning read blocks up to", pending.checkedBlocks, "instead of", blockCount)
+	}
+
+	// Expired transactions are dropped when new ones are added, even if the
+	// pending state is never queried
+	pending.Lock()
+	for i := range pending.txs[:3] {
+		pending.txs[i].sequencedAt = pending.txs[i].sequencedAt.Add(-maxSequencedTxAge - time.Minute)
+	}
+	generation := pending.generation
+	pending.Unlock()
+	pending.add(txs[4:], pendingTestResults(evm.ReturnCode))
+	if len(pending.txs) != 3 || pending.txs[0].tx != txs[2] {
+		t.Error("expired transactions not dropped", len(pending.txs))
+	}
+	if pending.generation == generation {
+		t.Error("dropping expired transactions didn't invalidate the pending snapshot")
+	}
+
+	// Transactions that the TxDB has processed are no longer pending
+	tx := chain.txes[chain.txIndex]
+	sender, err := types.Sender(signer, tx)
+	test.FailIfError(t, err)
+	processed := newSequencerPendingState(db, signer)
+	processed.add([]*types.Transaction{tx}, pendingTestResults(evm.ReturnCode))
+	next := tx.Nonce() + 1
+	checkPendingCount(t, processed, common.NewAddressFromEth(sender), &next)
+	chain.sendTransactions(1)
+	chain.waitFor("transaction in TxDB", func() (bool, error) {
+		res, err := db.GetRequest(common.NewHashFromEth(tx.Hash()))
+		return res != nil, err
+	})
+	checkPendingCount(t, processed, common.NewAddressFromEth(sender), nil)
+	if processed.generation == 0 {
+		t.Error("pruning processed transaction didn't invalidate the pending snapshot")
+	}
+}
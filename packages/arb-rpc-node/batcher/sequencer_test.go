@@ -36,6 +36,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -203,6 +204,15 @@ func TestSequencerBatcher(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	cacheConfig := configuration.NodeCache{
+		AllowSlowLookup: true,
+		LRUSize:         1000,
+		TimedExpire:     20 * time.Minute,
+	}
+	txDB, _, err := txdb.New(ctx, seqMon.Core, seqMon.Storage.GetNodeStore(), 10*time.Millisecond, &cacheConfig)
+	test.FailIfError(t, err)
+	defer txDB.Close()
+
 	rollup, err := ethbridge.NewRollupWatcher(rollupAddr, rollupBlock.Int64(), client, bind.CallOpts{})
 	test.FailIfError(t, err)
 
@@ -229,6 +239,7 @@ func TestSequencerBatcher(t *testing.T) {
 	_, err = seqMon.StartInboxReader(
 		ctx,
 		client,
+		configuration.DefaultL1LogFetchSettings(),
 		common.NewAddressFromEth(rollupAddr),
 		rollupBlock.Int64(),
 		common.NewAddressFromEth(bridgeUtilsAddr),
@@ -240,6 +251,7 @@ func TestSequencerBatcher(t *testing.T) {
 	_, err = otherMon.StartInboxReader(
 		ctx,
 		client,
+		configuration.DefaultL1LogFetchSettings(),
 		common.NewAddressFromEth(rollupAddr),
 		rollupBlock.Int64(),
 		common.NewAddressFromEth(bridgeUtilsAddr),
@@ -251,6 +263,7 @@ func TestSequencerBatcher(t *testing.T) {
 	batcher, err := NewSequencerBatcher(
 		ctx,
 		seqMon.Core,
+		txDB,
 		l2ChainId,
 		seqMon.Reader,
 		client,
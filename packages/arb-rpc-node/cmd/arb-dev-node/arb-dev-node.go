@@ -355,6 +355,8 @@ func startup() error {
 
 	plugins := make(map[string]interface{})
 	plugins["evm"] = dev.NewEVM(backend)
+	plugins["debug"] = web3.NewDebug(db)
+	plugins["trace"] = web3.NewTrace(db)
 
 	web3Server, err := web3.GenerateWeb3Server(srv, privateKeys, web3.GanacheMode, plugins)
 	if err != nil {
@@ -27,6 +27,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -238,7 +239,7 @@ func startup() error {
 	dummySequencerFeed := make(chan broadcaster.BroadcastFeedMessage)
 	var inboxReader *monitor.InboxReader
 	for {
-		inboxReader, err = mon.StartInboxReader(ctx, ethclint, rollupAddress, 0, bridgeUtilsAddress, nil, dummySequencerFeed)
+		inboxReader, err = mon.StartInboxReader(ctx, ethclint, configuration.DefaultL1LogFetchSettings(), rollupAddress, 0, bridgeUtilsAddress, nil, dummySequencerFeed)
 		if err == nil {
 			break
 		}
@@ -316,8 +317,8 @@ func startup() error {
 	}
 	defer db.Close()
 
-	signer := func(hash []byte) ([]byte, error) {
-		return crypto.Sign(hash, seqPrivKey)
+	signer := func(data []byte) ([]byte, error) {
+		return crypto.Sign(accounts.TextHash(data), seqPrivKey)
 	}
 
 	batch, err := rpc.SetupBatcher(
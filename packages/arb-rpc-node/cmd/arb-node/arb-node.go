@@ -17,11 +17,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	golog "log"
 	"math/big"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"strings"
 	"time"
 
@@ -33,10 +35,12 @@ import (
 	"github.com/rs/zerolog/pkgerrors"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/consensus"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/ethbridge"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/metrics"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
 	"github.com/offchainlabs/arbitrum/packages/arb-node-core/nodehealth"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/aggregator"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/batcher"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/rpc"
@@ -46,6 +50,9 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-util/broadcaster"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/tracing"
 )
 
 var logger zerolog.Logger
@@ -71,6 +78,14 @@ func main() {
 	// Print line number that log was created on
 	logger = log.With().Caller().Stack().Str("component", "arb-node").Logger()
 
+	if len(os.Args) > 1 && os.Args[1] == "db" {
+		if err := dbCommand(os.Args[2:]); err != nil {
+			logger.Error().Err(err).Msg("Error checking node database")
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := startup(); err != nil {
 		logger.Error().Err(err).Msg("Error running node")
 	}
@@ -82,6 +97,7 @@ func printSampleUsage() {
 	fmt.Printf("          or:  forwarder node: arb-node --l1.url=<L1 RPC> [optional arguments]\n\n")
 	fmt.Printf("          or: aggregator node: arb-node --l1.url=<L1 RPC> --node.type=aggregator [optional arguments] %s\n", cmdhelp.WalletArgsString)
 	fmt.Printf("          or:       sequencer: arb-node --l1.url=<L1 RPC> --node.type=sequencer [optional arguments] %s\n", cmdhelp.WalletArgsString)
+	fmt.Printf("          or:  check database: arb-node db verify|repair --dbdir=<node db> --arbos=<arbos.mexe>\n")
 }
 
 func startup() error {
@@ -170,6 +186,16 @@ func startup() error {
 		return err
 	}
 
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, "arb-node")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Warn().Err(err).Msg("error flushing traces")
+		}
+	}()
+
 	if config.PProfEnable {
 		go func() {
 			err := http.ListenAndServe("localhost:8081", pprofMux)
@@ -186,12 +212,26 @@ func startup() error {
 		Int64("fromBlock", config.Rollup.FromBlock).
 		Msg("Launching arbitrum node")
 
+	var snapshotManifest *snapshot.Manifest
+	if config.Init.Snapshot != "" {
+		snapshotManifest, err = snapshot.Import(ctx, config.Init.Snapshot, config.GetNodeDatabasePath())
+		if err != nil {
+			return errors.Wrap(err, "error importing database snapshot")
+		}
+	}
+
 	mon, err := monitor.NewMonitor(config.GetNodeDatabasePath(), config.Rollup.Machine.Filename, &config.Core)
 	if err != nil {
 		return errors.Wrap(err, "error opening monitor")
 	}
 	defer mon.Close()
 
+	if snapshotManifest != nil {
+		if err := verifySnapshot(ctx, mon.Core, l1Client, config, snapshotManifest); err != nil {
+			return errors.Wrapf(err, "error verifying database snapshot, remove %v to import again", config.GetNodeDatabasePath())
+		}
+	}
+
 	metricsConfig := metrics.NewMetricsConfig(config.MetricsServer, &config.Healthcheck.MetricsPrefix)
 	healthChan := make(chan nodehealth.Log, largeChannelBuffer)
 	healthChan <- nodehealth.Log{Config: true, Var: "healthcheckMetrics", ValBool: config.Healthcheck.Metrics}
@@ -202,11 +242,19 @@ func startup() error {
 	if config.Node.Type == "forwarder" {
 		healthChan <- nodehealth.Log{Config: true, Var: "primaryHealthcheckRPC", ValStr: config.Node.Forwarder.Target}
 	}
-	healthChan <- nodehealth.Log{Config: true, Var: "openethereumHealthcheckRPC", ValStr: config.L1.URL}
+	for _, endpoint := range append([]string{config.L1.URL}, config.Healthcheck.L1Endpoints...) {
+		healthChan <- nodehealth.Log{Config: true, Var: "l1Endpoint", ValStr: endpoint}
+	}
+	healthChan <- nodehealth.Log{Config: true, Var: "l1ChainID", ValBigInt: l1ChainId}
+	healthChan <- nodehealth.Log{Config: true, Var: "l1MaxBlockAge", ValTime: config.Healthcheck.L1MaxBlockAge}
 	nodehealth.Init(healthChan)
 
+	components := nodehealth.NewComponents()
+	components.AddReadinessCheck("inbox_reader", func() (string, error) {
+		return "", errors.New("starting")
+	})
 	go func() {
-		err := nodehealth.StartNodeHealthCheck(ctx, healthChan, metricsConfig.Registry)
+		err := nodehealth.StartNodeHealthCheckWithComponents(ctx, healthChan, metricsConfig.Registry, components)
 		if err != nil {
 			log.Error().Err(err).Msg("healthcheck server failed")
 		}
@@ -217,14 +265,21 @@ func startup() error {
 		logger.Warn().Msg("Missing --feed.url so not subscribing to feed")
 	} else {
 		sequencerFeed = make(chan broadcaster.BroadcastFeedMessage, 1)
+		var broadcastClients []*broadcastclient.BroadcastClient
 		for _, url := range config.Feed.Input.URLs {
 			broadcastClient := broadcastclient.NewBroadcastClient(url, nil, config.Feed.Input.Timeout)
 			broadcastClient.ConnectInBackground(ctx, sequencerFeed)
+			broadcastClients = append(broadcastClients, broadcastClient)
 		}
+		components.AddReadinessCheck("feed", nodehealth.FeedClientsCheck(broadcastClients))
+	}
+	inboxClient, err := ethutils.WithFallbacks(l1Client, config.L1.URL, config.L1.FallbackURLs)
+	if err != nil {
+		return err
 	}
 	var inboxReader *monitor.InboxReader
 	for {
-		inboxReader, err = mon.StartInboxReader(ctx, l1Client, common.HexToAddress(config.Rollup.Address), config.Rollup.FromBlock, common.HexToAddress(config.BridgeUtilsAddress), healthChan, sequencerFeed)
+		inboxReader, err = mon.StartInboxReader(ctx, inboxClient, config.L1.LogFetch, common.HexToAddress(config.Rollup.Address), config.Rollup.FromBlock, common.HexToAddress(config.BridgeUtilsAddress), healthChan, sequencerFeed)
 		if err == nil {
 			break
 		}
@@ -241,6 +296,21 @@ func startup() error {
 		case <-time.After(5 * time.Second):
 		}
 	}
+	mon.AddComponentChecks(components, "")
+
+	if config.Core.ConsensusCheck.Enable {
+		checker, err := consensus.NewChecker(mon.Core, config.Core.ConsensusCheck)
+		if err != nil {
+			return err
+		}
+		checker.Start(ctx)
+		components.AddReadinessCheck("consensus_check", func() (string, error) {
+			if err := checker.Failure(); err != nil {
+				return "", err
+			}
+			return "core execution matches replay", nil
+		})
+	}
 
 	var dataSigner func([]byte) ([]byte, error)
 	var batcherMode rpc.BatcherMode
@@ -249,7 +319,7 @@ func startup() error {
 		batcherMode = rpc.ForwarderBatcherMode{Config: config.Node.Forwarder}
 	} else {
 		var auth *bind.TransactOpts
-		auth, dataSigner, err = cmdhelp.GetKeystore(config, walletConfig, l1ChainId, true)
+		auth, dataSigner, err = cmdhelp.GetKeystore(ctx, config, walletConfig, l1ChainId, true)
 		if err != nil {
 			return errors.Wrap(err, "error running GetKeystore")
 		}
@@ -289,12 +359,25 @@ func startup() error {
 		return errors.Wrap(err, "error opening txdb")
 	}
 	defer db.Close()
+	components.AddLivenessCheck("log_reader", nodehealth.RunningCheck(db.LogReader().IsRunning))
+	components.AddReadinessCheck("txdb", nodehealth.LagCheck(mon.Core.GetLogCount, db.LogReader().Position, config.Healthcheck.MaxTxDBLag))
+
+	checkpointPruner, ok := mon.Core.(core.CheckpointPruner)
+	if !ok {
+		return errors.New("core doesn't support pruning checkpoints")
+	}
+	pruner, err := txdb.NewPruner(db, checkpointPruner, config.Node.StateHistory, config.GetNodeDatabasePath())
+	if err != nil {
+		return errors.Wrap(err, "error creating state pruner")
+	}
+	pruner.Start(ctx)
 
 	if config.WaitToCatchUp {
 		inboxReader.WaitToCatchUp(ctx)
 	}
 
 	var batch batcher.TransactionBatcher
+	var sequencer *batcher.SequencerBatcher
 	errChan := make(chan error, 1)
 	for {
 		batch, err = rpc.SetupBatcher(
@@ -312,6 +395,9 @@ func startup() error {
 		lockoutConf := config.Node.Sequencer.Lockout
 		if err == nil {
 			seqBatcher, ok := batch.(*batcher.SequencerBatcher)
+			if ok {
+				sequencer = seqBatcher
+			}
 			if lockoutConf.Redis != "" {
 				// Setup the lockout. This will take care of the initial delayed sequence.
 				batch, err = rpc.SetupLockout(ctx, seqBatcher, mon.Core, inboxReader, lockoutConf, errChan)
@@ -333,8 +419,19 @@ func startup() error {
 		}
 	}
 
+	if sequencer != nil {
+		addSequencerComponentChecks(components, sequencer, config.Node.Sequencer.Lockout.Redis != "")
+	}
+
 	srv := aggregator.NewServer(batch, rollupAddress, l2ChainId, db)
-	web3Server, err := web3.GenerateWeb3Server(srv, nil, rpcMode, nil)
+	plugins := make(map[string]interface{})
+	if config.Node.RPC.EnableDebug {
+		plugins["debug"] = web3.NewDebug(db)
+	}
+	if config.Node.RPC.EnableTrace {
+		plugins["trace"] = web3.NewTrace(db)
+	}
+	web3Server, err := web3.GenerateWeb3Server(srv, nil, rpcMode, plugins)
 	if err != nil {
 		return err
 	}
@@ -354,3 +451,56 @@ func startup() error {
 		return nil
 	}
 }
+
+// addSequencerComponentChecks reports whether the sequencer holds the lockout
+// and fails readiness if it holds it but isn't posting batches
+func addSequencerComponentChecks(components *nodehealth.Components, sequencer *batcher.SequencerBatcher, lockout bool) {
+	if lockout {
+		components.AddReadinessCheck("sequencer_lockout", func() (string, error) {
+			if sequencer.ShouldSequence() {
+				return "held", nil
+			}
+			return "not held", nil
+		})
+	}
+	components.AddReadinessCheck("batch_posting", func() (string, error) {
+		lag, expected := sequencer.BatchPostingLag()
+		detail := fmt.Sprintf("%v blocks since last batch", lag)
+		if sequencer.ShouldSequence() && lag > 2*expected {
+			return detail, errors.Errorf("no batch posted within %v blocks", 2*expected)
+		}
+		return detail, nil
+	})
+}
+
+// verifySnapshot checks an imported database against L1 and discards any
+// messages that aren't yet part of a batch on L1
+func verifySnapshot(
+	ctx context.Context,
+	db core.ArbCore,
+	l1Client ethutils.EthClient,
+	config *configuration.Config,
+	m *snapshot.Manifest,
+) error {
+	l1, err := snapshot.NewL1Inbox(
+		ctx,
+		l1Client,
+		common.HexToAddress(config.Rollup.Address),
+		config.Rollup.FromBlock,
+		common.HexToAddress(config.BridgeUtilsAddress),
+	)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Verify(ctx, db, l1, m); err != nil {
+		return err
+	}
+	if err := snapshot.TrimToVerified(ctx, db, m); err != nil {
+		return err
+	}
+	logger.Info().
+		Str("messageCount", m.VerifiedBatch.MessageCount.String()).
+		Str("batch", m.VerifiedBatch.Index.String()).
+		Msg("verified database snapshot against L1")
+	return snapshot.MarkVerified(config.GetNodeDatabasePath())
+}
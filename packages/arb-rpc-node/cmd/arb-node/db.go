@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-avm-cpp/cmachine"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func printDBUsage() {
+	fmt.Printf("\n")
+	fmt.Printf("Sample usage: arb-node db verify --dbdir=<node db> --arbos=<arbos.mexe>\n")
+	fmt.Printf("              arb-node db repair --dbdir=<node db> --arbos=<arbos.mexe>\n\n")
+}
+
+// dbCommand checks the node database of a stopped node, optionally repairing
+// it so that blocks after the last consistent one are rebuilt on startup
+func dbCommand(args []string) error {
+	if len(args) < 1 || (args[0] != "verify" && args[0] != "repair") {
+		printDBUsage()
+		return nil
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	dbDir := fs.String("dbdir", "", "node database directory")
+	arbosPath := fs.String("arbos", "", "ArbOS machine the database was created with")
+	gethLogLevel, arbLogLevel := cmdhelp.AddLogFlags(fs)
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return errors.Wrap(err, "error parsing arguments")
+	}
+	if *dbDir == "" || *arbosPath == "" {
+		printDBUsage()
+		return nil
+	}
+	if err := cmdhelp.ParseLogFlags(gethLogLevel, arbLogLevel); err != nil {
+		return err
+	}
+
+	ctx, cancelFunc, _ := cmdhelp.CreateLaunchContext()
+	defer cancelFunc()
+
+	// Open the database without starting the core thread so nothing is
+	// updated while it's checked
+	storage, err := cmachine.NewArbStorage(*dbDir, configuration.DefaultCoreSettings())
+	if err != nil {
+		return errors.Wrap(err, "error opening database")
+	}
+	defer storage.CloseArbStorage()
+	if err := storage.Initialize(*arbosPath); err != nil {
+		return errors.Wrap(err, "error initializing database")
+	}
+
+	nodeStore := storage.GetNodeStore()
+	arbCore := storage.GetArbCore()
+	var result *txdb.VerifyResult
+	if command == "verify" {
+		result, err = txdb.Verify(ctx, nodeStore, arbCore)
+	} else {
+		result, err = txdb.Repair(ctx, nodeStore, arbCore)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range result.Problems {
+		logger.Warn().Str("problem", problem).Msg("database inconsistency")
+	}
+	logger.Info().
+		Uint64("blockCount", result.BlockCount).
+		Uint64("consistentBlocks", result.ConsistentBlocks).
+		Uint64("checkedRequests", result.CheckedRequests).
+		Uint64("checkedBatches", result.CheckedBatches).
+		Int("problems", len(result.Problems)).
+		Msg("verified node database")
+
+	if result.Consistent() {
+		return nil
+	}
+	if command == "repair" {
+		logger.Info().
+			Uint64("blockCount", result.ConsistentBlocks).
+			Uint64("logCount", result.ConsistentLogCount).
+			Msg("reset node database, remaining blocks will be rebuilt when the node starts")
+		return nil
+	}
+	return errors.Errorf("found %v problems in node database, run arb-node db repair to fix", len(result.Problems))
+}
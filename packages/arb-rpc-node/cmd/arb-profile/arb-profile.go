@@ -0,0 +1,145 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	golog "log"
+	"os"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/profiler"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/txdb"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var logger zerolog.Logger
+
+func init() {
+	// Enable line numbers in logging
+	golog.SetFlags(golog.LstdFlags | golog.Lshortfile)
+
+	// Print stack trace when `.Error().Stack().Err(err).` is added to zerolog call
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	// Print line number that log was created on
+	logger = log.With().Caller().Stack().Str("component", "arb-profile").Logger()
+}
+
+func main() {
+	if err := startup(); err != nil {
+		logger.Error().Err(err).Msg("Error profiling transaction")
+		os.Exit(1)
+	}
+}
+
+func startup() error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+
+	dbDir := fs.String("dbdir", "", "node database directory to load state from")
+	arbosPath := fs.String("arbos", "", "ArbOS machine the database was created with")
+	txHash := fs.String("tx", "", "hash of the transaction to profile")
+	sampleGas := fs.Uint64("sample-gas", profiler.DefaultConfig().SampleGas, "ArbGas executed between samples")
+	foldedOut := fs.String("folded", "", "file to write folded stacks to for flamegraph generation")
+	jsonOut := fs.String("json", "", "file to write the full profile to, defaults to stdout")
+	gethLogLevel, arbLogLevel := cmdhelp.AddLogFlags(fs)
+
+	err := fs.Parse(os.Args[1:])
+	if err != nil {
+		return errors.Wrap(err, "error parsing arguments")
+	}
+
+	if *dbDir == "" || *arbosPath == "" || *txHash == "" {
+		fmt.Printf("\n")
+		fmt.Printf("Sample usage: arb-profile --dbdir=<node db> --arbos=<arbos.mexe> --tx=<hash> [--folded=<file>] [--json=<file>]\n\n")
+		return nil
+	}
+
+	if err := cmdhelp.ParseLogFlags(gethLogLevel, arbLogLevel); err != nil {
+		return err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	mon, err := monitor.NewMonitor(*dbDir, *arbosPath, configuration.DefaultCoreSettings())
+	if err != nil {
+		return errors.Wrap(err, "error opening monitor")
+	}
+	defer mon.Close()
+
+	cacheConfig := configuration.NodeCache{
+		AllowSlowLookup: true,
+	}
+	db, _, err := txdb.New(ctx, mon.Core, mon.Storage.GetNodeStore(), 100*time.Millisecond, &cacheConfig)
+	if err != nil {
+		return errors.Wrap(err, "error opening txdb")
+	}
+	defer db.Close()
+
+	config := profiler.DefaultConfig()
+	config.SampleGas = *sampleGas
+	hash := ethcommon.HexToHash(*txHash)
+	prof, err := web3.ProfileTransaction(ctx, db, common.NewHashFromEth(hash), config)
+	if err != nil {
+		return err
+	}
+
+	if *foldedOut != "" {
+		f, err := os.Create(*foldedOut)
+		if err != nil {
+			return err
+		}
+		if err := prof.WriteFolded(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	result, err := web3.NewProfileResult(hash, prof, false)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if *jsonOut == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return ioutil.WriteFile(*jsonOut, data, 0644)
+}
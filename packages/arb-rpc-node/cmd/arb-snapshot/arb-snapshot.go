@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	golog "log"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/cmdhelp"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/monitor"
+	"github.com/offchainlabs/arbitrum/packages/arb-node-core/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+)
+
+var logger zerolog.Logger
+
+func init() {
+	// Enable line numbers in logging
+	golog.SetFlags(golog.LstdFlags | golog.Lshortfile)
+
+	// Print stack trace when `.Error().Stack().Err(err).` is added to zerolog call
+	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	// Print line number that log was created on
+	logger = log.With().Caller().Stack().Str("component", "arb-snapshot").Logger()
+}
+
+func main() {
+	if err := startup(); err != nil {
+		logger.Error().Err(err).Msg("Error exporting snapshot")
+		os.Exit(1)
+	}
+}
+
+// The database must not be in use by a running node. Either stop the node
+// first or export one of the checkpoints it writes with --core.save-rocksdb-path.
+func startup() error {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+
+	dbDir := fs.String("dbdir", "", "node database directory to export")
+	arbosPath := fs.String("arbos", "", "ArbOS machine the database was created with")
+	l1URL := fs.String("l1.url", "", "layer 1 ethereum node RPC URL")
+	rollupAddress := fs.String("rollup.address", "", "address of the rollup contract")
+	fromBlock := fs.Int64("rollup.from-block", 0, "L1 block the rollup was created at")
+	bridgeUtilsAddress := fs.String("bridge-utils-address", "", "bridgeutils contract address")
+	out := fs.String("out", "", "file to write the snapshot to")
+	gethLogLevel, arbLogLevel := cmdhelp.AddLogFlags(fs)
+
+	err := fs.Parse(os.Args[1:])
+	if err != nil {
+		return errors.Wrap(err, "error parsing arguments")
+	}
+
+	if *dbDir == "" || *arbosPath == "" || *l1URL == "" || *rollupAddress == "" || *bridgeUtilsAddress == "" || *out == "" {
+		fmt.Printf("\n")
+		fmt.Printf("Sample usage: arb-snapshot --dbdir=<node db> --arbos=<arbos.mexe> --l1.url=<url> --rollup.address=<address> --rollup.from-block=<block> --bridge-utils-address=<address> --out=<file>\n\n")
+		return nil
+	}
+
+	if err := cmdhelp.ParseLogFlags(gethLogLevel, arbLogLevel); err != nil {
+		return err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	l1Client, err := ethutils.NewRPCEthClient(*l1URL)
+	if err != nil {
+		return errors.Wrap(err, "error connecting to L1 node")
+	}
+	l1, err := snapshot.NewL1Inbox(
+		ctx,
+		l1Client,
+		common.HexToAddress(*rollupAddress),
+		*fromBlock,
+		common.HexToAddress(*bridgeUtilsAddress),
+	)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := createManifest(ctx, *dbDir, *arbosPath, l1)
+	if err != nil {
+		return err
+	}
+	logger.Info().
+		Str("messageCount", manifest.MessageCount.String()).
+		Str("verifiedCount", manifest.VerifiedBatch.MessageCount.String()).
+		Str("machineHash", manifest.MachineHash.String()).
+		Msg("writing snapshot")
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := snapshot.WriteArchive(f, *dbDir, manifest); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return errors.WithStack(f.Close())
+}
+
+// createManifest describes the database, which is closed again before
+// returning so that its files can be archived
+func createManifest(ctx context.Context, dbDir string, arbosPath string, l1 snapshot.L1Inbox) (*snapshot.Manifest, error) {
+	mon, err := monitor.NewMonitor(dbDir, arbosPath, configuration.DefaultCoreSettings())
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening monitor")
+	}
+	defer mon.Close()
+
+	// Let the machine catch up on messages in the database so that the
+	// snapshot includes its latest state
+	core.WaitForMachineIdle(mon.Core)
+
+	manifest, err := snapshot.NewManifest(mon.Core)
+	if err != nil {
+		return nil, err
+	}
+	manifest.VerifiedBatch, err = snapshot.FindVerifiedBatch(ctx, mon.Core, l1)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
@@ -308,12 +308,12 @@ func TestNonAggregatorFee(t *testing.T) {
 	data := simpleABI.Methods["exists"].ID
 	emptyAgg := ethcommon.Address{}
 
-	estimatedGas, err := web3SServer.EstimateGas(web3.CallTxArgs{
+	estimatedGas, err := web3SServer.EstimateGas(context.Background(), web3.CallTxArgs{
 		From:       &auth.From,
 		To:         &simpleAddr,
 		Data:       (*hexutil.Bytes)(&data),
 		Aggregator: &emptyAgg,
-	})
+	}, nil, nil)
 	test.FailIfError(t, err)
 	auth.GasLimit = uint64(estimatedGas)
 	tx, err := simple.Exists(auth)
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+// Large enough to pay for any call at the maximum gas price
+var overrideBalance = new(big.Int).Exp(big.NewInt(10), big.NewInt(36), nil)
+
+type simulateTester struct {
+	t          *testing.T
+	client     *web3.EthClient
+	eth        *web3.Server
+	arb        *web3.Arb
+	simpleAddr ethcommon.Address
+	simpleABI  abi.ABI
+}
+
+func newSimulateTester(t *testing.T) (*simulateTester, func()) {
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey, err := crypto.GenerateKey()
+	test.FailIfError(t, err)
+	_, owner := OwnerAuthPair(t, nil)
+
+	backend, _, srv, cancelDevNode := NewTestDevNode(t, *arbosfile, config, owner, nil)
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	deposit := message.EthDepositTx{
+		L2Message: message.NewSafeL2Message(message.ContractTransaction{
+			BasicTx: message.BasicTx{
+				MaxGas:      big.NewInt(1000000),
+				GasPriceBid: big.NewInt(0),
+				DestAddress: common.NewAddressFromEth(senderAuth.From),
+				Payment:     new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil),
+				Data:        nil,
+			},
+		}),
+	}
+	_, err = backend.AddInboxMessage(deposit, common.RandAddress())
+	test.FailIfError(t, err)
+
+	client := web3.NewEthClient(srv, true)
+	simpleAddr, _, _, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	simpleABI, err := abi.JSON(strings.NewReader(arbostestcontracts.SimpleABI))
+	test.FailIfError(t, err)
+
+	eth := web3.NewServer(srv, true)
+	return &simulateTester{
+		t:          t,
+		client:     client,
+		eth:        eth,
+		arb:        web3.NewArb(srv, eth),
+		simpleAddr: simpleAddr,
+		simpleABI:  simpleABI,
+	}, cancelDevNode
+}
+
+func (s *simulateTester) pack(method string, args ...interface{}) *hexutil.Bytes {
+	data, err := s.simpleABI.Pack(method, args...)
+	test.FailIfError(s.t, err)
+	return (*hexutil.Bytes)(&data)
+}
+
+func (s *simulateTester) callY(to ethcommon.Address, overrides *web3.StateOverride) int64 {
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	ret, err := s.eth.Call(context.Background(), web3.CallTxArgs{
+		To:   &to,
+		Data: s.pack("y"),
+	}, latest, overrides)
+	test.FailIfError(s.t, err)
+	vals, err := s.simpleABI.Unpack("y", ret)
+	test.FailIfError(s.t, err)
+	return vals[0].(*big.Int).Int64()
+}
+
+func (s *simulateTester) signedTx(key *ecdsa.PrivateKey, nonce uint64, to *ethcommon.Address, value *big.Int, data []byte) *hexutil.Bytes {
+	gasPrice, err := s.client.SuggestGasPrice(context.Background())
+	test.FailIfError(s.t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(key, new(big.Int).SetUint64(uint64(s.eth.ChainId())))
+	test.FailIfError(s.t, err)
+	var tx *types.Transaction
+	if to == nil {
+		tx = types.NewContractCreation(nonce, value, 5000000, gasPrice, data)
+	} else {
+		tx = types.NewTransaction(nonce, *to, value, 5000000, gasPrice, data)
+	}
+	signed, err := auth.Signer(auth.From, tx)
+	test.FailIfError(s.t, err)
+	raw, err := rlp.EncodeToBytes(signed)
+	test.FailIfError(s.t, err)
+	return (*hexutil.Bytes)(&raw)
+}
+
+func (s *simulateTester) simulate(calls []web3.BundleCall, overrides *web3.StateOverride) []*web3.BundleCallResult {
+	latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	results, err := s.arb.SimulateBundle(context.Background(), calls, &latest, overrides)
+	test.FailIfError(s.t, err)
+	if len(results) != len(calls) {
+		s.t.Fatal("expected", len(calls), "results but got", len(results))
+	}
+	return results
+}
+
+func requireStatus(t *testing.T, res *web3.BundleCallResult, success bool) {
+	t.Helper()
+	if success && res.Status != 1 {
+		t.Error("call failed", *res.Error)
+	}
+	if !success && res.Status != 0 {
+		t.Error("call succeeded unexpectedly")
+	}
+}
+
+func TestCodeAndStorageOverride(t *testing.T) {
+	s, cancel := newSimulateTester(t)
+	defer cancel()
+
+	code, err := s.client.CodeAt(context.Background(), s.simpleAddr, nil)
+	test.FailIfError(t, err)
+	// y is in the second storage slot
+	ySlot := ethcommon.BigToHash(big.NewInt(1))
+
+	if s.callY(s.simpleAddr, nil) != 0 {
+		t.Fatal("contract deployed with non-zero y")
+	}
+	diff := map[ethcommon.Hash]ethcommon.Hash{ySlot: ethcommon.BigToHash(big.NewInt(7))}
+	overrides := web3.StateOverride{s.simpleAddr: {StateDiff: &diff}}
+	if y := s.callY(s.simpleAddr, &overrides); y != 7 {
+		t.Error("state diff override not applied, got", y)
+	}
+
+	// Install the contract at a new address with its own storage
+	dest := common.RandAddress().ToEthAddress()
+	state := map[ethcommon.Hash]ethcommon.Hash{ySlot: ethcommon.BigToHash(big.NewInt(42))}
+	codeBytes := hexutil.Bytes(code)
+	overrides = web3.StateOverride{dest: {Code: &codeBytes, State: &state}}
+	if y := s.callY(dest, &overrides); y != 42 {
+		t.Error("code and state override not applied, got", y)
+	}
+	if y := s.callY(s.simpleAddr, &overrides); y != 0 {
+		t.Error("override changed another account, got", y)
+	}
+}
+
+func TestBalanceAndNonceOverride(t *testing.T) {
+	s, cancel := newSimulateTester(t)
+	defer cancel()
+
+	key, err := crypto.GenerateKey()
+	test.FailIfError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	value := (*hexutil.Big)(big.NewInt(1000))
+	payment := web3.BundleCall{CallTxArgs: web3.CallTxArgs{
+		From:  &from,
+		To:    &s.simpleAddr,
+		Value: value,
+		Data:  s.pack("acceptPayment"),
+	}}
+	signed := web3.BundleCall{RawTransaction: s.signedTx(key, 7, &s.simpleAddr, value.ToInt(), *s.pack("acceptPayment"))}
+
+	results := s.simulate([]web3.BundleCall{payment}, nil)
+	requireStatus(t, results[0], false)
+
+	balance := (*hexutil.Big)(overrideBalance)
+	balancePtr := &balance
+	nonce := hexutil.Uint64(7)
+	overrides := web3.StateOverride{from: {Balance: balancePtr, Nonce: &nonce}}
+	results = s.simulate([]web3.BundleCall{signed, payment}, &overrides)
+	requireStatus(t, results[0], true)
+	requireStatus(t, results[1], true)
+	if results[0].TransactionHash == nil {
+		t.Error("signed transaction has no hash")
+	}
+}
+
+func TestSimulateBundleSharesState(t *testing.T) {
+	s, cancel := newSimulateTester(t)
+	defer cancel()
+
+	key, err := crypto.GenerateKey()
+	test.FailIfError(t, err)
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	balance := (*hexutil.Big)(overrideBalance)
+	balancePtr := &balance
+	overrides := web3.StateOverride{from: {Balance: balancePtr}}
+
+	// Deploy a contract whose y is the value paid to its constructor, then
+	// read it back and make another transaction with the next nonce
+	created := crypto.CreateAddress(from, 0)
+	calls := []web3.BundleCall{
+		{RawTransaction: s.signedTx(key, 0, nil, big.NewInt(77), ethcommon.FromHex(arbostestcontracts.SimpleBin))},
+		{CallTxArgs: web3.CallTxArgs{To: &created, Data: s.pack("y")}},
+		{RawTransaction: s.signedTx(key, 1, &created, big.NewInt(0), *s.pack("exists"))},
+	}
+	results := s.simulate(calls, &overrides)
+	for _, res := range results {
+		requireStatus(t, res, true)
+	}
+	if y := new(big.Int).SetBytes(results[1].ReturnData); y.Cmp(big.NewInt(77)) != 0 {
+		t.Error("call didn't see contract deployed earlier in bundle, got y", y)
+	}
+	if len(results[2].Logs) != 1 {
+		t.Error("expected event from transaction to contract created in bundle")
+	}
+
+	// The bundle doesn't change the chain
+	code, err := s.client.CodeAt(context.Background(), created, nil)
+	test.FailIfError(t, err)
+	if len(code) != 0 {
+		t.Error("bundle modified chain state")
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dev
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/arbostestcontracts"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/web3"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func requireModified(t *testing.T, field interface{}, from, to int64) {
+	t.Helper()
+	diff, ok := field.(map[string]interface{})
+	if !ok {
+		t.Fatal("expected modified field, got", field)
+	}
+	fromTo, ok := diff["*"].(web3.FromToResult)
+	if !ok {
+		t.Fatal("expected modified field, got", diff)
+	}
+	if fromTo.From.(*hexutil.Big).ToInt().Int64() != from || fromTo.To.(*hexutil.Big).ToInt().Int64() != to {
+		t.Errorf("expected change from %v to %v, got %v to %v", from, to, fromTo.From, fromTo.To)
+	}
+}
+
+func TestTraceReplayTransactionInBatch(t *testing.T) {
+	ctx := context.Background()
+	config := protocol.ChainParams{
+		GracePeriod:               common.NewTimeBlocksInt(3),
+		ArbGasSpeedLimitPerSecond: 2000000000000,
+	}
+	senderKey, err := crypto.GenerateKey()
+	test.FailIfError(t, err)
+	_, owner := OwnerAuthPair(t, nil)
+
+	backend, db, srv, cancelDevNode := NewTestDevNode(t, *arbosfile, config, owner, nil)
+	defer cancelDevNode()
+
+	senderAuth, err := bind.NewKeyedTransactorWithChainID(senderKey, backend.chainID)
+	test.FailIfError(t, err)
+
+	deposit := message.EthDepositTx{
+		L2Message: message.NewSafeL2Message(message.ContractTransaction{
+			BasicTx: message.BasicTx{
+				MaxGas:      big.NewInt(1000000),
+				GasPriceBid: big.NewInt(0),
+				DestAddress: common.NewAddressFromEth(senderAuth.From),
+				Payment:     big.NewInt(1000),
+				Data:        nil,
+			},
+		}),
+	}
+	_, err = backend.AddInboxMessage(deposit, common.RandAddress())
+	test.FailIfError(t, err)
+
+	client := web3.NewEthClient(srv, true)
+	simpleAddr, _, _, err := arbostestcontracts.DeploySimple(senderAuth, client)
+	test.FailIfError(t, err)
+	simpleABI, err := abi.JSON(strings.NewReader(arbostestcontracts.SimpleABI))
+	test.FailIfError(t, err)
+	existsData, err := simpleABI.Pack("exists")
+	test.FailIfError(t, err)
+
+	nonce, err := client.PendingNonceAt(ctx, senderAuth.From)
+	test.FailIfError(t, err)
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	test.FailIfError(t, err)
+	dest := common.RandAddress().ToEthAddress()
+	transfer, err := senderAuth.Signer(senderAuth.From, types.NewTransaction(nonce, dest, big.NewInt(100), 100000, gasPrice, nil))
+	test.FailIfError(t, err)
+	exists, err := senderAuth.Signer(senderAuth.From, types.NewTransaction(nonce+1, simpleAddr, big.NewInt(0), 1000000, gasPrice, existsData))
+	test.FailIfError(t, err)
+
+	// Include both transactions in the same block so that replaying the
+	// second one depends on the first
+	batch, err := message.NewTransactionBatchFromMessages([]message.AbstractL2Message{
+		message.SignedTransaction{Tx: transfer},
+		message.SignedTransaction{Tx: exists},
+	})
+	test.FailIfError(t, err)
+	_, err = backend.AddInboxMessage(message.NewSafeL2Message(batch), common.RandAddress())
+	test.FailIfError(t, err)
+
+	transferReceipt, err := client.TransactionReceipt(ctx, transfer.Hash())
+	test.FailIfError(t, err)
+	existsReceipt, err := client.TransactionReceipt(ctx, exists.Hash())
+	test.FailIfError(t, err)
+	if transferReceipt.BlockNumber.Cmp(existsReceipt.BlockNumber) != 0 {
+		t.Fatal("transactions weren't included in the same block")
+	}
+
+	tracer := web3.NewTrace(db)
+	res, err := tracer.ReplayTransaction(ctx, exists.Hash(), []string{"stateDiff"}, nil)
+	test.FailIfError(t, err)
+	if len(res.Output) != 32 || new(big.Int).SetBytes(res.Output).Int64() != 10 {
+		t.Error("wrong output", res.Output)
+	}
+
+	senderDiff, ok := res.StateDiff[senderAuth.From]
+	if !ok {
+		t.Fatal("sender not included in state diff")
+	}
+	requireModified(t, senderDiff.Nonce, int64(nonce+1), int64(nonce+2))
+	if senderDiff.Balance != "=" && gasPrice.Sign() == 0 {
+		t.Error("sender balance changed without fees", senderDiff.Balance)
+	}
+	if _, ok := res.StateDiff[dest]; ok {
+		t.Error("earlier transfer included in state diff")
+	}
+
+	simpleDiff, ok := res.StateDiff[simpleAddr]
+	if !ok {
+		t.Fatal("contract not included in state diff")
+	}
+	slot, ok := simpleDiff.Storage[ethcommon.Hash{}]
+	if !ok {
+		t.Fatal("storage write not included in state diff", simpleDiff.Storage)
+	}
+	requireModified(t, slot, 0, 5)
+}
@@ -17,6 +17,8 @@ require (
 	github.com/offchainlabs/arbitrum/packages/arb-util v0.8.0
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.24.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 )
 
 replace github.com/offchainlabs/arbitrum/packages/arb-util => ../arb-util
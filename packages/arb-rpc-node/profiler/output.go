@@ -0,0 +1,123 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+type ContractUsage struct {
+	Contract common.Address
+	Usage
+	SelfGas *big.Int
+}
+
+type OpcodeUsage struct {
+	Op vm.OpCode
+	Usage
+}
+
+// Contracts aggregates the call frames of the profile by the contract whose
+// code was executing, sorted by descending ArbGas
+func (p *Profile) Contracts() []ContractUsage {
+	byContract := make(map[common.Address]*ContractUsage)
+	var visit func(f *Frame)
+	visit = func(f *Frame) {
+		usage, ok := byContract[f.Contract]
+		if !ok {
+			usage = &ContractUsage{Contract: f.Contract, SelfGas: big.NewInt(0)}
+			byContract[f.Contract] = usage
+		}
+		usage.add(f.ArbGas, f.Steps)
+		usage.Count++
+		usage.SelfGas.Add(usage.SelfGas, f.SelfGas)
+		for _, child := range f.Children {
+			visit(child)
+		}
+	}
+	if p.Root != nil {
+		visit(p.Root)
+	}
+
+	contracts := make([]ContractUsage, 0, len(byContract))
+	for _, usage := range byContract {
+		contracts = append(contracts, *usage)
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		if contracts[i].ArbGas != contracts[j].ArbGas {
+			return contracts[i].ArbGas > contracts[j].ArbGas
+		}
+		return contracts[i].Contract.Hex() < contracts[j].Contract.Hex()
+	})
+	return contracts
+}
+
+// OpcodesByGas returns the per opcode usage sorted by descending ArbGas
+func (p *Profile) OpcodesByGas() []OpcodeUsage {
+	ops := make([]OpcodeUsage, 0, len(p.Opcodes))
+	for op, usage := range p.Opcodes {
+		ops = append(ops, OpcodeUsage{Op: op, Usage: *usage})
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].ArbGas != ops[j].ArbGas {
+			return ops[i].ArbGas > ops[j].ArbGas
+		}
+		return ops[i].Op < ops[j].Op
+	})
+	return ops
+}
+
+func frameName(f *Frame) string {
+	return fmt.Sprintf("%v:%v", f.Type, f.Contract.Hex())
+}
+
+// WriteFolded writes the ArbGas used by each call stack in the folded format
+// consumed by flamegraph.pl, inferno and speedscope
+func (p *Profile) WriteFolded(w io.Writer) error {
+	if p.ArbOS.ArbGas > 0 {
+		if _, err := fmt.Fprintf(w, "%v %v\n", ArbOSFrame, p.ArbOS.ArbGas); err != nil {
+			return err
+		}
+	}
+	if p.Root == nil {
+		return nil
+	}
+	var visit func(f *Frame, path []string) error
+	visit = func(f *Frame, path []string) error {
+		path = append(path, frameName(f))
+		if f.ArbGas > 0 {
+			if _, err := fmt.Fprintf(w, "%v %v\n", strings.Join(path, ";"), f.ArbGas); err != nil {
+				return err
+			}
+		}
+		for _, child := range f.Children {
+			if err := visit(child, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(p.Root, nil)
+}
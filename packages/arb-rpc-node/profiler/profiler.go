@@ -0,0 +1,302 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiler
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "profiler").Logger()
+
+// ArbOSFrame is the name used for ArbGas spent before the first EVM opcode
+// executed, such as message parsing and fee handling inside ArbOS
+const ArbOSFrame = "arbos"
+
+type Config struct {
+	// SampleGas is the amount of ArbGas executed between samples
+	SampleGas uint64
+
+	// MaxGas is the maximum amount of ArbGas the profiled execution may use
+	MaxGas uint64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		SampleGas: 10000,
+		MaxGas:    100000000000,
+	}
+}
+
+type Usage struct {
+	ArbGas uint64 `json:"arbGas"`
+	Steps  uint64 `json:"steps"`
+	Count  uint64 `json:"count"`
+}
+
+func (u *Usage) add(arbGas, steps uint64) {
+	u.ArbGas += arbGas
+	u.Steps += steps
+}
+
+// Frame is a single EVM call frame reconstructed from the trace emitted by
+// ArbOS. GasUsed is EVM gas as reported by the trace, while ArbGas and Steps
+// are the frame's share of the AVM execution apportioned by its self gas.
+type Frame struct {
+	Type     string
+	Contract common.Address
+	GasUsed  *big.Int
+	SelfGas  *big.Int
+	ArbGas   uint64
+	Steps    uint64
+	Children []*Frame
+}
+
+type Profile struct {
+	ArbGas uint64
+	Steps  uint64
+
+	// Opcodes holds sampled ArbGas and steps by EVM opcode along with the
+	// exact number of times each opcode was executed
+	Opcodes map[vm.OpCode]*Usage
+
+	// ArbOS holds sampled usage that happened before any EVM opcode ran
+	ArbOS Usage
+
+	// Root is the top level call frame, or nil if no trace was emitted
+	Root *Frame
+
+	Result      *evm.TxResult
+	DebugPrints []value.Value
+}
+
+func newProfile() *Profile {
+	return &Profile{
+		Opcodes: make(map[vm.OpCode]*Usage),
+	}
+}
+
+func (p *Profile) opcodeUsage(op vm.OpCode) *Usage {
+	usage, ok := p.Opcodes[op]
+	if !ok {
+		usage = &Usage{}
+		p.Opcodes[op] = usage
+	}
+	return usage
+}
+
+// Run executes msg on mach in small increments of ArbGas, attributing each
+// increment to the EVM opcodes executed during it. msg is sideloaded in the
+// same way as snapshot calls so mach must be waiting on a sideload. mach is
+// modified and should be a clone owned by the caller.
+func Run(mach machine.Machine, msg inbox.InboxMessage, config Config) (*Profile, error) {
+	if config.SampleGas == 0 {
+		return nil, errors.New("sample gas must be greater than zero")
+	}
+	prof := newProfile()
+	var lastOp *vm.OpCode
+	var logs []value.Value
+	sideloads := []inbox.InboxMessage{msg}
+	for prof.ArbGas < config.MaxGas {
+		assertion, debugPrints, steps, err := mach.ExecuteAssertionAdvanced(
+			config.SampleGas,
+			true,
+			nil,
+			sideloads,
+			true,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// The sideload is consumed by the first chunk, after which the
+		// machine stops when it asks for the next one
+		sideloads = nil
+		logs = append(logs, assertion.Logs...)
+		prof.DebugPrints = append(prof.DebugPrints, debugPrints...)
+		prof.ArbGas += assertion.NumGas
+		prof.Steps += steps
+
+		var ops []vm.OpCode
+		for _, d := range debugPrints {
+			parsed, err := evm.NewLogLineFromValue(d)
+			if err != nil {
+				logger.Debug().Str("raw", d.String()).Msg("debugprint")
+				continue
+			}
+			switch parsed := parsed.(type) {
+			case *evm.EVMOpcodeLog:
+				ops = append(ops, vm.OpCode(parsed.Op()))
+			case *evm.EVMTrace:
+				root, err := buildFrames(parsed.Items)
+				if err != nil {
+					return nil, err
+				}
+				prof.Root = root
+			}
+		}
+		prof.attributeSample(lastOp, ops, assertion.NumGas, steps)
+		if len(ops) > 0 {
+			lastOp = &ops[len(ops)-1]
+		}
+
+		if steps == 0 || assertion.NumGas < config.SampleGas {
+			// The machine stopped before using its full allotment so it
+			// must have finished the message or become blocked
+			break
+		}
+	}
+
+	if len(logs) == 0 {
+		return nil, errors.New("no logs produced by tx")
+	}
+	res, err := evm.NewTxResultFromValue(logs[len(logs)-1])
+	if err != nil {
+		return nil, err
+	}
+	prof.Result = res
+	if prof.Root != nil {
+		arbGas := prof.ArbGas - prof.ArbOS.ArbGas
+		steps := prof.Steps - prof.ArbOS.Steps
+		prof.Root.apportion(arbGas, steps, totalSelfGas(prof.Root))
+	}
+	return prof, nil
+}
+
+// attributeSample splits the usage of a sample evenly between the opcodes
+// that were logged during it. Samples where no opcode was logged belong to
+// the last opcode seen, or to ArbOS if the EVM hasn't started yet.
+func (p *Profile) attributeSample(lastOp *vm.OpCode, ops []vm.OpCode, arbGas, steps uint64) {
+	for _, op := range ops {
+		p.opcodeUsage(op).Count++
+	}
+	if len(ops) == 0 {
+		if lastOp == nil {
+			p.ArbOS.add(arbGas, steps)
+		} else {
+			p.opcodeUsage(*lastOp).add(arbGas, steps)
+		}
+		return
+	}
+	count := uint64(len(ops))
+	for i, op := range ops {
+		gasShare := arbGas / count
+		stepShare := steps / count
+		if i == 0 {
+			// Give the remainder to the first opcode so totals stay exact
+			gasShare += arbGas % count
+			stepShare += steps % count
+		}
+		p.opcodeUsage(op).add(gasShare, stepShare)
+	}
+}
+
+// buildFrames reconstructs the call tree from an ArbOS trace. Every call is
+// bracketed by a CallTrace and a ReturnTrace, and contract creation emits a
+// CreateTrace or Create2Trace immediately before the constructor call.
+func buildFrames(items []evm.TraceItem) (*Frame, error) {
+	var root *Frame
+	var stack []*Frame
+	var pendingCreate *Frame
+	for _, item := range items {
+		switch item := item.(type) {
+		case *evm.CreateTrace:
+			pendingCreate = &Frame{Type: "Create", Contract: item.ContractAddress}
+		case *evm.Create2Trace:
+			pendingCreate = &Frame{Type: "Create2", Contract: item.ContractAddress}
+		case *evm.CallTrace:
+			frame := pendingCreate
+			pendingCreate = nil
+			if frame == nil {
+				frame = &Frame{Type: item.Type.String()}
+				if item.To != nil {
+					frame.Contract = *item.To
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, frame)
+			} else if root == nil {
+				root = frame
+			} else {
+				return nil, errors.New("trace contained multiple top level calls")
+			}
+			stack = append(stack, frame)
+		case *evm.ReturnTrace:
+			if len(stack) == 0 {
+				return nil, errors.New("trace returned without matching call")
+			}
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			frame.GasUsed = big.NewInt(0)
+			if item.GasUsed != nil {
+				frame.GasUsed.Set(item.GasUsed)
+			}
+		}
+	}
+	if len(stack) != 0 {
+		return nil, errors.New("trace ended inside call")
+	}
+	if root != nil {
+		root.computeSelfGas()
+	}
+	return root, nil
+}
+
+func (f *Frame) computeSelfGas() {
+	f.SelfGas = new(big.Int).Set(f.GasUsed)
+	for _, child := range f.Children {
+		child.computeSelfGas()
+		f.SelfGas.Sub(f.SelfGas, child.GasUsed)
+	}
+	if f.SelfGas.Sign() < 0 {
+		f.SelfGas.SetInt64(0)
+	}
+}
+
+func totalSelfGas(f *Frame) *big.Int {
+	total := new(big.Int).Set(f.SelfGas)
+	for _, child := range f.Children {
+		total.Add(total, totalSelfGas(child))
+	}
+	return total
+}
+
+func (f *Frame) apportion(arbGas, steps uint64, total *big.Int) {
+	if total.Sign() > 0 {
+		f.ArbGas = shareOf(arbGas, f.SelfGas, total)
+		f.Steps = shareOf(steps, f.SelfGas, total)
+	}
+	for _, child := range f.Children {
+		child.apportion(arbGas, steps, total)
+	}
+}
+
+func shareOf(amount uint64, part *big.Int, total *big.Int) uint64 {
+	share := new(big.Int).SetUint64(amount)
+	share.Mul(share, part)
+	share.Div(share, total)
+	return share.Uint64()
+}
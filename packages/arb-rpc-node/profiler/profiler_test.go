@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profiler
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func TestBuildFrames(t *testing.T) {
+	outer := common.Address{1}
+	inner := common.Address{2}
+	created := common.Address{3}
+	items := []evm.TraceItem{
+		&evm.CallTrace{Type: evm.Call, To: &outer},
+		&evm.CallTrace{Type: evm.StaticCall, To: &inner},
+		&evm.ReturnTrace{GasUsed: big.NewInt(300)},
+		&evm.CreateTrace{ContractAddress: created},
+		&evm.CallTrace{Type: evm.Call},
+		&evm.ReturnTrace{GasUsed: big.NewInt(200)},
+		&evm.ReturnTrace{GasUsed: big.NewInt(1000)},
+	}
+	root, err := buildFrames(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Contract != outer || len(root.Children) != 2 {
+		t.Fatal("unexpected root frame", root.Contract, len(root.Children))
+	}
+	if root.SelfGas.Cmp(big.NewInt(500)) != 0 {
+		t.Error("wrong root self gas", root.SelfGas)
+	}
+	if root.Children[0].Type != "StaticCall" || root.Children[0].Contract != inner {
+		t.Error("wrong first child", root.Children[0].Type, root.Children[0].Contract)
+	}
+	if root.Children[1].Type != "Create" || root.Children[1].Contract != created {
+		t.Error("wrong second child", root.Children[1].Type, root.Children[1].Contract)
+	}
+
+	root.apportion(1000, 100, totalSelfGas(root))
+	if root.ArbGas != 500 || root.Children[0].ArbGas != 300 || root.Children[1].ArbGas != 200 {
+		t.Error("wrong apportioned arbgas", root.ArbGas, root.Children[0].ArbGas, root.Children[1].ArbGas)
+	}
+	if root.Steps != 50 {
+		t.Error("wrong apportioned steps", root.Steps)
+	}
+}
+
+func TestBuildFramesUnbalanced(t *testing.T) {
+	to := common.Address{1}
+	if _, err := buildFrames([]evm.TraceItem{&evm.CallTrace{To: &to}}); err == nil {
+		t.Error("expected error for unterminated call")
+	}
+	if _, err := buildFrames([]evm.TraceItem{&evm.ReturnTrace{GasUsed: big.NewInt(0)}}); err == nil {
+		t.Error("expected error for unmatched return")
+	}
+}
+
+func TestAttributeSample(t *testing.T) {
+	prof := newProfile()
+	prof.attributeSample(nil, nil, 100, 10)
+	if prof.ArbOS.ArbGas != 100 || prof.ArbOS.Steps != 10 {
+		t.Error("expected sample before first opcode to go to arbos")
+	}
+
+	prof.attributeSample(nil, []vm.OpCode{vm.PUSH1, vm.SSTORE}, 101, 11)
+	push := prof.Opcodes[vm.PUSH1]
+	sstore := prof.Opcodes[vm.SSTORE]
+	if push.ArbGas != 51 || sstore.ArbGas != 50 || push.Steps+sstore.Steps != 11 {
+		t.Error("wrong split", push.ArbGas, sstore.ArbGas, push.Steps, sstore.Steps)
+	}
+
+	last := vm.SSTORE
+	prof.attributeSample(&last, nil, 1000, 0)
+	if sstore.ArbGas != 1050 || sstore.Count != 1 {
+		t.Error("expected sample without opcodes to go to last opcode", sstore.ArbGas, sstore.Count)
+	}
+
+	ops := prof.OpcodesByGas()
+	if len(ops) != 2 || ops[0].Op != vm.SSTORE {
+		t.Error("wrong opcode order", ops)
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	outer := common.Address{1}
+	inner := common.Address{2}
+	root, err := buildFrames([]evm.TraceItem{
+		&evm.CallTrace{Type: evm.Call, To: &outer},
+		&evm.CallTrace{Type: evm.DelegateCall, To: &inner},
+		&evm.ReturnTrace{GasUsed: big.NewInt(25)},
+		&evm.ReturnTrace{GasUsed: big.NewInt(100)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root.apportion(400, 40, totalSelfGas(root))
+	prof := newProfile()
+	prof.Root = root
+	prof.ArbOS.ArbGas = 7
+
+	var builder strings.Builder
+	if err := prof.WriteFolded(&builder); err != nil {
+		t.Fatal(err)
+	}
+	expected := "arbos 7\n" +
+		"Call:" + outer.Hex() + " 300\n" +
+		"Call:" + outer.Hex() + ";DelegateCall:" + inner.Hex() + " 100\n"
+	if builder.String() != expected {
+		t.Errorf("unexpected folded output:\n%v", builder.String())
+	}
+
+	contracts := prof.Contracts()
+	if len(contracts) != 2 || contracts[0].Contract != outer || contracts[0].ArbGas != 300 {
+		t.Error("wrong contract usage", contracts)
+	}
+}
@@ -0,0 +1,438 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replay reconstructs the state of historical L2 blocks by running
+// execution cursors up to each block's sideload position. Requests are
+// served by a pool of workers, requests for nearby blocks share a cursor, and
+// idle cursors are kept so later requests can continue from them.
+package replay
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "replay").Logger()
+
+var (
+	QueueTimer          = metrics.NewRegisteredTimer("arbitrum/replay/queue", nil)
+	ReplayTimer         = metrics.NewRegisteredTimer("arbitrum/replay/run", nil)
+	ReplayStepsCounter  = metrics.NewRegisteredCounter("arbitrum/replay/steps", nil)
+	ReplayGasCounter    = metrics.NewRegisteredCounter("arbitrum/replay/gas", nil)
+	CursorReuseCounter  = metrics.NewRegisteredCounter("arbitrum/replay/cursors/reused", nil)
+	CursorCreateCounter = metrics.NewRegisteredCounter("arbitrum/replay/cursors/created", nil)
+	IdleCursorsGauge    = metrics.NewRegisteredGauge("arbitrum/replay/cursors/idle", nil)
+	QueuedGauge         = metrics.NewRegisteredGauge("arbitrum/replay/queued", nil)
+	CacheHitCounter     = metrics.NewRegisteredCounter("arbitrum/replay/cache/hits", nil)
+	CacheMissCounter    = metrics.NewRegisteredCounter("arbitrum/replay/cache/misses", nil)
+)
+
+// ErrQueueFull is returned when too many block states are already waiting to
+// be reconstructed
+var ErrQueueFull = errors.New("too many historical states waiting to be reconstructed")
+
+// ErrReorged is returned for requests whose block was removed by a reorg
+// before its state was reconstructed
+var ErrReorged = errors.New("block was reorged while reconstructing its state")
+
+// Core is the part of the ArbCore used to reconstruct machine states
+type Core interface {
+	GetSideloadPosition(blockNumber uint64) (*big.Int, error)
+	GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error)
+	AdvanceExecutionCursor(executionCursor core.ExecutionCursor, maxGas *big.Int, goOverGas bool) error
+	TakeMachine(executionCursor core.ExecutionCursor) (machine.Machine, error)
+}
+
+type request struct {
+	block      uint64
+	gas        *big.Int
+	time       inbox.ChainTime
+	queued     time.Time
+	generation uint64
+	// reorged is set when the block is removed by a reorg so that a worker
+	// running the request fails it instead of returning the old state
+	reorged bool
+
+	done chan struct{}
+	snap *snapshot.Snapshot
+	err  error
+}
+
+// Scheduler reconstructs the state of historical blocks in parallel.
+// Memory use is bounded by the number of workers, idle cursors, queued
+// requests and cached snapshots, each of which is configured separately.
+type Scheduler struct {
+	core        Core
+	config      configuration.NodeCacheReplay
+	cache       *lru.Cache
+	newSnapshot func(machine.Machine, inbox.ChainTime) (*snapshot.Snapshot, error)
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+	// queue is sorted by gas position
+	queue    []*request
+	inFlight map[uint64]*request
+	// cursors holds idle cursors, least recently used first
+	cursors []core.ExecutionCursor
+	// generation is incremented on every reorg so that results computed
+	// before it aren't reused
+	generation uint64
+	closed     bool
+}
+
+func NewScheduler(core Core, config configuration.NodeCacheReplay) (*Scheduler, error) {
+	if config.Workers <= 0 {
+		return nil, errors.New("replay scheduler needs at least one worker")
+	}
+	var cache *lru.Cache
+	if config.SnapshotCacheSize > 0 {
+		var err error
+		cache, err = lru.New(config.SnapshotCacheSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s := &Scheduler{
+		core:     core,
+		config:   config,
+		cache:    cache,
+		inFlight: make(map[uint64]*request),
+		newSnapshot: func(mach machine.Machine, time inbox.ChainTime) (*snapshot.Snapshot, error) {
+			return snapshot.NewSnapshot(mach, time, big.NewInt(1<<60))
+		},
+	}
+	s.cond = sync.NewCond(&s.mutex)
+	return s, nil
+}
+
+// Start launches the workers, which run until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work()
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		s.mutex.Lock()
+		s.closed = true
+		queue := s.queue
+		s.queue = nil
+		s.cond.Broadcast()
+		s.mutex.Unlock()
+		for _, req := range queue {
+			s.finish(req, nil, errors.New("replay scheduler stopped"))
+		}
+		wg.Wait()
+	}()
+}
+
+// Snapshot returns the state after the given block, reconstructing it from
+// the closest cursor or checkpoint if it isn't cached
+func (s *Scheduler) Snapshot(ctx context.Context, info *machine.BlockInfo) (*snapshot.Snapshot, error) {
+	block := info.Header.Number.Uint64()
+	if s.cache != nil {
+		if snap, ok := s.cache.Get(block); ok {
+			CacheHitCounter.Inc(1)
+			return snap.(*snapshot.Snapshot), nil
+		}
+	}
+	CacheMissCounter.Inc(1)
+
+	// The core is queried without holding the lock, so look the position up
+	// again if a reorg happens in the meantime since it may have moved
+	var gas *big.Int
+	s.mutex.Lock()
+	for {
+		generation := s.generation
+		s.mutex.Unlock()
+		var err error
+		gas, err = s.core.GetSideloadPosition(block)
+		if err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		if s.generation == generation {
+			break
+		}
+	}
+	req, ok := s.inFlight[block]
+	if !ok {
+		if s.closed {
+			s.mutex.Unlock()
+			return nil, errors.New("replay scheduler stopped")
+		}
+		if len(s.queue) >= s.config.MaxQueued {
+			s.mutex.Unlock()
+			return nil, ErrQueueFull
+		}
+		req = &request{
+			block: block,
+			gas:   gas,
+			time: inbox.ChainTime{
+				BlockNum:  common.NewTimeBlocks(new(big.Int).Set(info.Header.Number)),
+				Timestamp: new(big.Int).SetUint64(info.Header.Time),
+			},
+			queued:     time.Now(),
+			generation: s.generation,
+			done:       make(chan struct{}),
+		}
+		s.inFlight[block] = req
+		i := sort.Search(len(s.queue), func(i int) bool {
+			return s.queue[i].gas.Cmp(gas) > 0
+		})
+		s.queue = append(s.queue, nil)
+		copy(s.queue[i+1:], s.queue[i:])
+		s.queue[i] = req
+		QueuedGauge.Update(int64(len(s.queue)))
+		s.cond.Signal()
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-req.done:
+		return req.snap, req.err
+	}
+}
+
+// Reorg discards cached state for blocks from height onwards along with every
+// idle cursor, since they may have run through messages that were removed.
+// Queued and running requests for those blocks fail with ErrReorged.
+func (s *Scheduler) Reorg(height uint64) {
+	s.mutex.Lock()
+	s.generation++
+	s.cursors = nil
+	for block, req := range s.inFlight {
+		if block >= height {
+			// Requests after this get a fresh replay
+			req.reorged = true
+			delete(s.inFlight, block)
+		}
+	}
+	var removed []*request
+	queue := s.queue[:0]
+	for _, req := range s.queue {
+		if req.reorged {
+			removed = append(removed, req)
+		} else {
+			queue = append(queue, req)
+		}
+	}
+	s.queue = queue
+	QueuedGauge.Update(int64(len(s.queue)))
+	IdleCursorsGauge.Update(0)
+	if s.cache != nil {
+		for _, key := range s.cache.Keys() {
+			if key.(uint64) >= height {
+				s.cache.Remove(key)
+			}
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, req := range removed {
+		s.finish(req, nil, ErrReorged)
+	}
+}
+
+func (s *Scheduler) work() {
+	for {
+		s.mutex.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mutex.Unlock()
+			return
+		}
+		batch := s.takeBatch()
+		cursor := s.takeCursor(batch[0].gas)
+		generation := s.generation
+		s.mutex.Unlock()
+
+		cursor = s.run(batch, cursor)
+		if cursor != nil {
+			s.returnCursor(cursor, generation)
+		}
+	}
+}
+
+// takeBatch removes the first queued request along with the ones following
+// it that are close enough to run on the same cursor. It must be called with
+// the mutex held.
+func (s *Scheduler) takeBatch() []*request {
+	shareGas := new(big.Int).SetUint64(s.config.ShareGas)
+	count := 1
+	for count < len(s.queue) {
+		gap := new(big.Int).Sub(s.queue[count].gas, s.queue[count-1].gas)
+		if gap.Cmp(shareGas) > 0 {
+			break
+		}
+		count++
+	}
+	batch := make([]*request, count)
+	copy(batch, s.queue[:count])
+	s.queue = s.queue[count:]
+	QueuedGauge.Update(int64(len(s.queue)))
+	now := time.Now()
+	for _, req := range batch {
+		QueueTimer.Update(now.Sub(req.queued))
+	}
+	return batch
+}
+
+// takeCursor removes and returns the idle cursor closest before gas, if
+// any. It must be called with the mutex held.
+func (s *Scheduler) takeCursor(gas *big.Int) core.ExecutionCursor {
+	best := -1
+	for i, cursor := range s.cursors {
+		if cursor.TotalGasConsumed().Cmp(gas) > 0 {
+			continue
+		}
+		if best < 0 || cursor.TotalGasConsumed().Cmp(s.cursors[best].TotalGasConsumed()) > 0 {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	cursor := s.cursors[best]
+	s.cursors = append(s.cursors[:best], s.cursors[best+1:]...)
+	IdleCursorsGauge.Update(int64(len(s.cursors)))
+	return cursor
+}
+
+func (s *Scheduler) returnCursor(cursor core.ExecutionCursor, generation uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if generation != s.generation || s.config.MaxCursors <= 0 {
+		return
+	}
+	s.cursors = append(s.cursors, cursor)
+	if len(s.cursors) > s.config.MaxCursors {
+		s.cursors = s.cursors[len(s.cursors)-s.config.MaxCursors:]
+	}
+	IdleCursorsGauge.Update(int64(len(s.cursors)))
+}
+
+// run serves each request in the batch, in order of gas, by advancing a
+// single cursor, and returns the cursor if it's still usable
+func (s *Scheduler) run(batch []*request, cursor core.ExecutionCursor) core.ExecutionCursor {
+	start := time.Now()
+	defer ReplayTimer.UpdateSince(start)
+
+	if cursor == nil {
+		var err error
+		cursor, err = s.core.GetExecutionCursor(batch[0].gas)
+		if err != nil {
+			for _, req := range batch {
+				s.finish(req, nil, err)
+			}
+			return nil
+		}
+		CursorCreateCounter.Inc(1)
+	} else {
+		CursorReuseCounter.Inc(1)
+	}
+
+	for i, req := range batch {
+		s.mutex.Lock()
+		reorged := req.reorged
+		s.mutex.Unlock()
+		if reorged {
+			// Later requests in the batch are at or after this block
+			// so they were removed too
+			for _, failed := range batch[i:] {
+				s.finish(failed, nil, ErrReorged)
+			}
+			return nil
+		}
+		snap, err := s.advanceTo(cursor, req)
+		if err != nil {
+			logger.Warn().Err(err).Uint64("block", req.block).Msg("failed to reconstruct block state")
+			for _, failed := range batch[i:] {
+				s.finish(failed, nil, err)
+			}
+			return nil
+		}
+		s.finish(req, snap, nil)
+	}
+	return cursor
+}
+
+func (s *Scheduler) advanceTo(cursor core.ExecutionCursor, req *request) (*snapshot.Snapshot, error) {
+	gas := new(big.Int).Sub(req.gas, cursor.TotalGasConsumed())
+	if gas.Sign() < 0 {
+		return nil, errors.Errorf("cursor at gas %v is past block %v at gas %v", cursor.TotalGasConsumed(), req.block, req.gas)
+	}
+	if gas.Sign() > 0 {
+		startSteps := new(big.Int).Set(cursor.TotalSteps())
+		startGas := new(big.Int).Set(cursor.TotalGasConsumed())
+		if err := s.core.AdvanceExecutionCursor(cursor, gas, false); err != nil {
+			return nil, err
+		}
+		if cursor.TotalGasConsumed().Cmp(req.gas) != 0 {
+			return nil, errors.Errorf("cursor stopped at gas %v instead of block %v at gas %v", cursor.TotalGasConsumed(), req.block, req.gas)
+		}
+		ReplayStepsCounter.Inc(new(big.Int).Sub(cursor.TotalSteps(), startSteps).Int64())
+		ReplayGasCounter.Inc(new(big.Int).Sub(cursor.TotalGasConsumed(), startGas).Int64())
+	}
+	// Taking the machine prevents the cursor from advancing further, so take
+	// it from a copy
+	mach, err := s.core.TakeMachine(cursor.Clone())
+	if err != nil {
+		return nil, err
+	}
+	return s.newSnapshot(mach, req.time)
+}
+
+func (s *Scheduler) finish(req *request, snap *snapshot.Snapshot, err error) {
+	s.mutex.Lock()
+	if s.inFlight[req.block] == req {
+		delete(s.inFlight, req.block)
+	}
+	if req.reorged {
+		snap = nil
+		err = ErrReorged
+	}
+	if err == nil && s.cache != nil && req.generation == s.generation {
+		s.cache.Add(req.block, snap)
+	}
+	s.mutex.Unlock()
+	req.snap = snap
+	req.err = err
+	close(req.done)
+}
@@ -0,0 +1,388 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// Each block uses this much gas
+const testBlockGas = 100
+
+type testCursor struct {
+	gas int64
+}
+
+func (c *testCursor) Clone() core.ExecutionCursor { return &testCursor{gas: c.gas} }
+func (c *testCursor) MachineHash() common.Hash    { return common.Hash{} }
+func (c *testCursor) TotalMessagesRead() *big.Int { return big.NewInt(0) }
+func (c *testCursor) InboxAcc() common.Hash       { return common.Hash{} }
+func (c *testCursor) SendAcc() common.Hash        { return common.Hash{} }
+func (c *testCursor) LogAcc() common.Hash         { return common.Hash{} }
+func (c *testCursor) TotalGasConsumed() *big.Int  { return big.NewInt(c.gas) }
+func (c *testCursor) TotalSteps() *big.Int        { return big.NewInt(c.gas) }
+func (c *testCursor) TotalSendCount() *big.Int    { return big.NewInt(0) }
+func (c *testCursor) TotalLogCount() *big.Int     { return big.NewInt(0) }
+
+type testMachine struct {
+	machine.Machine
+	gas int64
+}
+
+type testCore struct {
+	mutex    sync.Mutex
+	created  int
+	advanced int64
+	// If set, advancing a cursor signals started and then waits for release
+	started chan struct{}
+	release chan struct{}
+	// If set, called with the position before it's returned, and may
+	// replace it
+	onSideloadPosition func(gas *big.Int) *big.Int
+}
+
+func (c *testCore) GetSideloadPosition(blockNumber uint64) (*big.Int, error) {
+	gas := big.NewInt(int64(blockNumber) * testBlockGas)
+	if c.onSideloadPosition != nil {
+		gas = c.onSideloadPosition(gas)
+	}
+	return gas, nil
+}
+
+func (c *testCore) GetExecutionCursor(totalGasUsed *big.Int) (core.ExecutionCursor, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.created++
+	return &testCursor{gas: totalGasUsed.Int64()}, nil
+}
+
+func (c *testCore) AdvanceExecutionCursor(executionCursor core.ExecutionCursor, maxGas *big.Int, goOverGas bool) error {
+	if c.started != nil {
+		c.started <- struct{}{}
+		<-c.release
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advanced += maxGas.Int64()
+	executionCursor.(*testCursor).gas += maxGas.Int64()
+	return nil
+}
+
+func (c *testCore) TakeMachine(executionCursor core.ExecutionCursor) (machine.Machine, error) {
+	return &testMachine{gas: executionCursor.(*testCursor).gas}, nil
+}
+
+func (c *testCore) counts() (int, int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.created, c.advanced
+}
+
+// testSnapshots records which machine each snapshot was made from
+type testSnapshots struct {
+	mutex sync.Mutex
+	gas   map[*snapshot.Snapshot]int64
+}
+
+func newTestScheduler(t *testing.T, c *testCore, config configuration.NodeCacheReplay) (*Scheduler, *testSnapshots) {
+	scheduler, err := NewScheduler(c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snaps := &testSnapshots{gas: make(map[*snapshot.Snapshot]int64)}
+	scheduler.newSnapshot = func(mach machine.Machine, _ inbox.ChainTime) (*snapshot.Snapshot, error) {
+		snap := &snapshot.Snapshot{}
+		snaps.mutex.Lock()
+		snaps.gas[snap] = mach.(*testMachine).gas
+		snaps.mutex.Unlock()
+		return snap, nil
+	}
+	return scheduler, snaps
+}
+
+func testBlock(number uint64) *machine.BlockInfo {
+	return &machine.BlockInfo{Header: &types.Header{Number: new(big.Int).SetUint64(number)}}
+}
+
+func getSnapshot(t *testing.T, scheduler *Scheduler, snaps *testSnapshots, block uint64) *snapshot.Snapshot {
+	t.Helper()
+	snap, err := scheduler.Snapshot(context.Background(), testBlock(block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSnapshot(t, snaps, snap, block)
+	return snap
+}
+
+func checkSnapshot(t *testing.T, snaps *testSnapshots, snap *snapshot.Snapshot, block uint64) {
+	t.Helper()
+	snaps.mutex.Lock()
+	gas := snaps.gas[snap]
+	snaps.mutex.Unlock()
+	if gas != int64(block)*testBlockGas {
+		t.Fatalf("snapshot for block %v made at gas %v", block, gas)
+	}
+}
+
+func waitForQueued(t *testing.T, scheduler *Scheduler, count int) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		scheduler.mutex.Lock()
+		queued := len(scheduler.queue)
+		scheduler.mutex.Unlock()
+		if queued == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %v queued requests", count)
+}
+
+func TestSchedulerSharesCursors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &testCore{}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.Workers = 1
+	config.ShareGas = testBlockGas * 2
+	scheduler, snaps := newTestScheduler(t, c, config)
+
+	// Queue up requests before any worker runs so they're batched together
+	blocks := []uint64{12, 10, 11, 10, 50}
+	var wg sync.WaitGroup
+	results := make([]*snapshot.Snapshot, len(blocks))
+	errs := make([]error, len(blocks))
+	for i, block := range blocks {
+		wg.Add(1)
+		go func(i int, block uint64) {
+			defer wg.Done()
+			results[i], errs[i] = scheduler.Snapshot(ctx, testBlock(block))
+		}(i, block)
+	}
+	// The duplicate request for block 10 joins the first one
+	waitForQueued(t, scheduler, 4)
+	scheduler.Start(ctx)
+	wg.Wait()
+	for i, block := range blocks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		checkSnapshot(t, snaps, results[i], block)
+	}
+
+	if results[1] != results[3] {
+		t.Error("duplicate requests got different snapshots")
+	}
+	created, advanced := c.counts()
+	if created != 1 {
+		t.Errorf("expected one cursor to be created but got %v", created)
+	}
+	// Blocks 11 and 12 continue from block 10, and block 50 from block 12
+	if advanced != 40*testBlockGas {
+		t.Errorf("expected cursors to advance %v gas but got %v", 40*testBlockGas, advanced)
+	}
+
+	// Cached snapshots are reused
+	if getSnapshot(t, scheduler, snaps, 11) != results[2] {
+		t.Error("snapshot wasn't cached")
+	}
+	// An earlier block needs a new cursor
+	getSnapshot(t, scheduler, snaps, 5)
+	if created, _ := c.counts(); created != 2 {
+		t.Errorf("expected a new cursor for an earlier block but got %v created", created)
+	}
+}
+
+func TestSchedulerReorg(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &testCore{}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.Workers = 2
+	scheduler, snaps := newTestScheduler(t, c, config)
+	scheduler.Start(ctx)
+
+	before := getSnapshot(t, scheduler, snaps, 10)
+	kept := getSnapshot(t, scheduler, snaps, 5)
+	scheduler.Reorg(8)
+
+	if getSnapshot(t, scheduler, snaps, 5) != kept {
+		t.Error("snapshot before reorg was discarded")
+	}
+	if getSnapshot(t, scheduler, snaps, 10) == before {
+		t.Error("snapshot after reorg was reused")
+	}
+	// Idle cursors may have run through removed messages, so blocks 10, 5 and
+	// 10 again each need a new one
+	if created, _ := c.counts(); created != 3 {
+		t.Errorf("expected a new cursor after reorg but got %v created", created)
+	}
+}
+
+func TestSchedulerReorgQueued(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &testCore{}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.Workers = 1
+	scheduler, snaps := newTestScheduler(t, c, config)
+
+	blocks := []uint64{5, 10}
+	var wg sync.WaitGroup
+	results := make([]*snapshot.Snapshot, len(blocks))
+	errs := make([]error, len(blocks))
+	for i, block := range blocks {
+		wg.Add(1)
+		go func(i int, block uint64) {
+			defer wg.Done()
+			results[i], errs[i] = scheduler.Snapshot(ctx, testBlock(block))
+		}(i, block)
+	}
+	waitForQueued(t, scheduler, 2)
+	scheduler.Reorg(8)
+	waitForQueued(t, scheduler, 1)
+	scheduler.Start(ctx)
+	wg.Wait()
+
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	checkSnapshot(t, snaps, results[0], 5)
+	if !errors.Is(errs[1], ErrReorged) {
+		t.Fatal("expected queued request for reorged block to fail but got", errs[1])
+	}
+	if _, advanced := c.counts(); advanced != 0 {
+		t.Error("reorged request was run")
+	}
+}
+
+func TestSchedulerReorgRunning(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &testCore{started: make(chan struct{}), release: make(chan struct{})}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.Workers = 1
+	config.ShareGas = testBlockGas * 10
+	scheduler, _ := newTestScheduler(t, c, config)
+
+	// Blocks 10 and 12 run on the same cursor, which starts at block 10, so
+	// the reorg happens while block 12 is being reconstructed
+	blocks := []uint64{10, 12}
+	var wg sync.WaitGroup
+	errs := make([]error, len(blocks))
+	for i, block := range blocks {
+		wg.Add(1)
+		go func(i int, block uint64) {
+			defer wg.Done()
+			_, errs[i] = scheduler.Snapshot(ctx, testBlock(block))
+		}(i, block)
+	}
+	waitForQueued(t, scheduler, 2)
+	scheduler.Start(ctx)
+	<-c.started
+	scheduler.Reorg(8)
+	close(c.release)
+	wg.Wait()
+
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+	if !errors.Is(errs[1], ErrReorged) {
+		t.Fatal("expected running request for reorged block to fail but got", errs[1])
+	}
+	if scheduler.cache.Contains(uint64(12)) {
+		t.Error("state from before reorg was cached")
+	}
+
+	// The block can be requested again after the reorg
+	c.started = nil
+	snap, err := scheduler.Snapshot(ctx, testBlock(10))
+	if err != nil || snap == nil {
+		t.Fatal("failed to reconstruct block after reorg", err)
+	}
+}
+
+func TestSchedulerReorgDuringLookup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &testCore{}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.Workers = 1
+	scheduler, snaps := newTestScheduler(t, c, config)
+	scheduler.Start(ctx)
+
+	// The first lookup returns the position from before a reorg that happens
+	// before the request is queued
+	lookups := 0
+	c.onSideloadPosition = func(gas *big.Int) *big.Int {
+		lookups++
+		if lookups == 1 {
+			scheduler.Reorg(8)
+			return new(big.Int).Add(gas, big.NewInt(1))
+		}
+		return gas
+	}
+	snap := getSnapshot(t, scheduler, snaps, 10)
+	if lookups != 2 {
+		t.Error("expected position to be looked up again after reorg but got", lookups, "lookups")
+	}
+	c.onSideloadPosition = nil
+	if cached := getSnapshot(t, scheduler, snaps, 10); cached != snap {
+		t.Error("snapshot wasn't cached")
+	}
+}
+
+func TestSchedulerQueueLimit(t *testing.T) {
+	c := &testCore{}
+	config := configuration.DefaultNodeCacheReplaySettings()
+	config.MaxQueued = 1
+	scheduler, _ := newTestScheduler(t, c, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = scheduler.Snapshot(ctx, testBlock(1))
+	}()
+	waitForQueued(t, scheduler, 1)
+	if _, err := scheduler.Snapshot(ctx, testBlock(2)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected full queue but got %v", err)
+	}
+
+	// Stopping the scheduler fails requests that were waiting
+	scheduler.mutex.Lock()
+	req := scheduler.queue[0]
+	scheduler.mutex.Unlock()
+	scheduler.Start(ctx)
+	cancel()
+	<-req.done
+	if req.err == nil && req.snap == nil {
+		t.Fatal("request neither failed nor completed")
+	}
+}
@@ -97,6 +97,10 @@ func SetupBatcher(
 		if err != nil {
 			return nil, err
 		}
+		auth, err = transactauth.WithTxManager(ctx, client, auth, config.L1.TxManager, config.Persistent.Chain)
+		if err != nil {
+			return nil, err
+		}
 		inbox, err := ethbridge.NewStandardInbox(batcherMode.InboxAddress.ToEthAddress(), client, auth)
 		if err != nil {
 			return nil, err
@@ -113,6 +117,10 @@ func SetupBatcher(
 		if err != nil {
 			return nil, err
 		}
+		auth, err = transactauth.WithTxManager(ctx, client, auth, config.L1.TxManager, config.Persistent.Chain)
+		if err != nil {
+			return nil, err
+		}
 		inbox, err := ethbridge.NewStandardInbox(batcherMode.InboxAddress.ToEthAddress(), client, auth)
 		if err != nil {
 			return nil, err
@@ -136,6 +144,7 @@ func SetupBatcher(
 		seqBatcher, err := batcher.NewSequencerBatcher(
 			ctx,
 			batcherMode.Core,
+			db,
 			l2ChainId,
 			batcherMode.InboxReader,
 			client,
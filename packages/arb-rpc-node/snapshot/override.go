@@ -0,0 +1,138 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/arbos"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+// AccountOverride replaces parts of an account's state before executing a
+// call. Nil fields are left unchanged. State replaces all of the account's
+// storage while StateDiff only replaces the given slots.
+type AccountOverride struct {
+	Balance   *big.Int
+	Nonce     *big.Int
+	Code      *[]byte
+	State     map[common.Hash]common.Hash
+	StateDiff map[common.Hash]common.Hash
+}
+
+// WithOverrides returns a copy of the snapshot with the given accounts
+// replaced. Accounts are installed through ArbosTest, which replaces the whole
+// account, so any fields that aren't overridden are first read from the
+// existing state.
+func (s *Snapshot) WithOverrides(overrides map[common.Address]AccountOverride) (*Snapshot, error) {
+	accounts := make([]common.Address, 0, len(overrides))
+	for account := range overrides {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Bytes(), accounts[j].Bytes()) < 0
+	})
+
+	snap := s
+	for _, account := range accounts {
+		override := overrides[account]
+		if override.State != nil && override.StateDiff != nil {
+			return nil, errors.Errorf("account %v has both state and stateDiff overrides", account)
+		}
+		data, err := snap.installAccountData(account, override)
+		if err != nil {
+			return nil, err
+		}
+		msg := message.ContractTransaction{
+			BasicTx: message.BasicTx{
+				MaxGas:      big.NewInt(1000000000),
+				GasPriceBid: snap.MaxGasPriceBid(),
+				DestAddress: common.NewAddressFromEth(arbos.ARB_TEST_ADDRESS),
+				Payment:     big.NewInt(0),
+				Data:        data,
+			},
+		}
+		next, res, _, err := snap.Apply(msg, common.Address{})
+		if err != nil {
+			return nil, err
+		}
+		if res.ResultCode != evm.ReturnCode {
+			return nil, errors.Errorf("failed to override account %v with result %v", account, res.ResultCode)
+		}
+		snap = next
+	}
+	return snap, nil
+}
+
+func (s *Snapshot) installAccountData(account common.Address, override AccountOverride) ([]byte, error) {
+	balance := override.Balance
+	if balance == nil {
+		var err error
+		balance, err = s.GetBalance(account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nonce := override.Nonce
+	if nonce == nil {
+		var err error
+		nonce, err = s.GetTransactionCount(account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var code []byte
+	if override.Code != nil {
+		code = *override.Code
+	} else {
+		var err error
+		code, err = s.GetCode(account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	storage := override.State
+	if storage == nil {
+		var err error
+		storage, err = s.GetStorage(account)
+		if err != nil {
+			return nil, err
+		}
+		for key, val := range override.StateDiff {
+			storage[key] = val
+		}
+	}
+	return arbos.InstallAccountData(account, balance, nonce, code, storage), nil
+}
+
+// GetStorage returns every storage slot that is set for account
+func (s *Snapshot) GetStorage(account common.Address) (map[common.Hash]common.Hash, error) {
+	res, err := s.basicCall(arbos.GetMarshalledStorageData(account), common.NewAddressFromEth(arbos.ARB_TEST_ADDRESS))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValidResult(res); err != nil {
+		return nil, err
+	}
+	return arbos.UnmarshalStorage(res.ReturnData)
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/arbos"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/profiler"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
@@ -137,8 +138,10 @@ func (s *Snapshot) Clone() *Snapshot {
 			BlockNum:  s.time.BlockNum.Clone(),
 			Timestamp: new(big.Int).Set(s.time.Timestamp),
 		},
-		nextInboxSeqNum: new(big.Int).Set(s.nextInboxSeqNum),
-		chainId:         chainId,
+		nextInboxSeqNum:       new(big.Int).Set(s.nextInboxSeqNum),
+		chainId:               chainId,
+		arbosVersion:          s.arbosVersion,
+		arbosRemappingEnabled: s.arbosRemappingEnabled,
 	}
 }
 
@@ -279,6 +282,98 @@ func (s *Snapshot) Call(msg message.ContractTransaction, sender common.Address)
 	return s.tryTx(message.NewSafeL2Message(msg), sender, targetHash, 100000000000)
 }
 
+// Profile executes msg in the same way as Call while sampling AVM execution
+// with the profiler
+func (s *Snapshot) Profile(msg message.ContractTransaction, sender common.Address, config profiler.Config) (*profiler.Profile, error) {
+	var targetHash common.Hash
+	if s.chainId != nil {
+		targetHash = hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(s.nextInboxSeqNum))
+	}
+	if s.arbosRemappingEnabled {
+		sender = message.L1RemapAccount(sender)
+	}
+	inboxMsg := message.NewInboxMessage(message.NewSafeL2Message(msg), sender, s.nextInboxSeqNum, big.NewInt(0), s.time)
+	prof, err := profiler.Run(s.mach.Clone(), inboxMsg, config)
+	if err != nil {
+		return nil, err
+	}
+	var emptyHash common.Hash
+	if targetHash != emptyHash && prof.Result.IncomingRequest.MessageID != targetHash {
+		return nil, errors.Errorf("profile got unexpected result %v instead of %v", prof.Result.IncomingRequest.MessageID, targetHash)
+	}
+	return prof, nil
+}
+
+// Apply executes msg in the same way as Call, but instead of discarding the
+// resulting state it returns a new snapshot containing it
+func (s *Snapshot) Apply(msg message.ContractTransaction, sender common.Address) (*Snapshot, *evm.TxResult, []value.Value, error) {
+	var targetHash common.Hash
+	if s.chainId != nil {
+		targetHash = hashing.SoliditySHA3(hashing.Uint256(s.chainId), hashing.Uint256(s.nextInboxSeqNum))
+	}
+	if s.arbosRemappingEnabled {
+		sender = message.L1RemapAccount(sender)
+	}
+	next := s.Clone()
+	next.mach = s.mach.Clone()
+	inboxMsg := message.NewInboxMessage(message.NewSafeL2Message(msg), sender, s.nextInboxSeqNum, big.NewInt(0), s.time)
+	res, debugPrints, err := runTx(next.mach, inboxMsg, 100000000000)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var emptyHash common.Hash
+	if targetHash != emptyHash && res.IncomingRequest.MessageID != targetHash {
+		return nil, nil, debugPrints, errors.Errorf("apply got unexpected result %v instead of %v", res.IncomingRequest.MessageID, targetHash)
+	}
+	next.nextInboxSeqNum.Add(next.nextInboxSeqNum, big.NewInt(1))
+	return next, res, debugPrints, nil
+}
+
+// ReplayRequest executes the message that produced req on top of the snapshot
+// and returns a new snapshot containing the resulting state. The message is
+// run with its original kind, data and time, so a signed transaction is
+// checked and consumes the nonce of its signer as it did when it was first
+// included.
+func (s *Snapshot) ReplayRequest(req evm.IncomingRequest) (*Snapshot, *evm.TxResult, []value.Value, error) {
+	next := s.Clone()
+	next.mach = s.mach.Clone()
+	res, debugPrints, err := runTx(next.mach, s.replayInboxMessage(req), 100000000000)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	next.nextInboxSeqNum.Add(next.nextInboxSeqNum, big.NewInt(1))
+	return next, res, debugPrints, nil
+}
+
+// ProfileRequest executes the message that produced req in the same way as
+// ReplayRequest while sampling AVM execution with the profiler
+func (s *Snapshot) ProfileRequest(req evm.IncomingRequest, config profiler.Config) (*profiler.Profile, error) {
+	return profiler.Run(s.mach.Clone(), s.replayInboxMessage(req), config)
+}
+
+func (s *Snapshot) replayInboxMessage(req evm.IncomingRequest) inbox.InboxMessage {
+	sender := req.Sender
+	if s.arbosRemappingEnabled {
+		sender = message.L1RemapAccount(sender)
+	}
+	if req.AggregatorInfo != nil && req.AggregatorInfo.Aggregator != nil {
+		// Transactions posted by an aggregator must come from it again so
+		// that it's credited with the same fees
+		sender = *req.AggregatorInfo.Aggregator
+	}
+	return inbox.InboxMessage{
+		Kind:        req.Kind,
+		Sender:      sender,
+		InboxSeqNum: s.nextInboxSeqNum,
+		GasPrice:    big.NewInt(0),
+		Data:        req.Data,
+		ChainTime: inbox.ChainTime{
+			BlockNum:  common.NewTimeBlocks(req.L1BlockNumber),
+			Timestamp: req.L2Timestamp,
+		},
+	}
+}
+
 func (s *Snapshot) tryTx(msg message.Message, sender common.Address, targetHash common.Hash, maxGas uint64) (*evm.TxResult, []value.Value, error) {
 	inboxMsg := message.NewInboxMessage(msg, sender, s.nextInboxSeqNum, big.NewInt(0), s.time)
 	res, debugPrints, err := runTx(s.mach.Clone(), inboxMsg, maxGas)
@@ -0,0 +1,241 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statediff
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// StateReader is the subset of snapshot.Snapshot used to read account state
+type StateReader interface {
+	GetBalance(account common.Address) (*big.Int, error)
+	GetTransactionCount(account common.Address) (*big.Int, error)
+	GetCode(account common.Address) ([]byte, error)
+	GetStorageAt(account common.Address, index *big.Int) (*big.Int, error)
+}
+
+type Account struct {
+	Balance *big.Int
+	Nonce   *big.Int
+	Code    []byte
+	Storage map[common.Hash]*big.Int
+}
+
+// Exists follows the EIP-161 definition of an empty account
+func (a *Account) Exists() bool {
+	return a.Balance.Sign() != 0 || a.Nonce.Sign() != 0 || len(a.Code) > 0
+}
+
+func ReadAccount(reader StateReader, account common.Address, keys []common.Hash) (*Account, error) {
+	balance, err := reader.GetBalance(account)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := reader.GetTransactionCount(account)
+	if err != nil {
+		return nil, err
+	}
+	code, err := reader.GetCode(account)
+	if err != nil {
+		return nil, err
+	}
+	storage := make(map[common.Hash]*big.Int, len(keys))
+	for _, key := range keys {
+		val, err := reader.GetStorageAt(account, new(big.Int).SetBytes(key.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		storage[key] = val
+	}
+	return &Account{
+		Balance: balance,
+		Nonce:   nonce,
+		Code:    code,
+		Storage: storage,
+	}, nil
+}
+
+type BigDelta struct {
+	From *big.Int
+	To   *big.Int
+}
+
+type CodeDelta struct {
+	From []byte
+	To   []byte
+}
+
+// AccountDiff describes how an account changed. If the account was created or
+// removed Born or Died is set and the deltas describe the transition from or
+// to the empty account. Otherwise a nil delta means the field didn't change.
+type AccountDiff struct {
+	Born    bool
+	Died    bool
+	Balance *BigDelta
+	Nonce   *BigDelta
+	Code    *CodeDelta
+	Storage map[common.Hash]*BigDelta
+}
+
+func (d *AccountDiff) Empty() bool {
+	return !d.Born && !d.Died && d.Balance == nil && d.Nonce == nil && d.Code == nil && len(d.Storage) == 0
+}
+
+func diffBig(from, to *big.Int) *BigDelta {
+	if from.Cmp(to) == 0 {
+		return nil
+	}
+	return &BigDelta{From: from, To: to}
+}
+
+func DiffAccount(before, after *Account) *AccountDiff {
+	diff := &AccountDiff{
+		Born:    !before.Exists() && after.Exists(),
+		Died:    before.Exists() && !after.Exists(),
+		Balance: diffBig(before.Balance, after.Balance),
+		Nonce:   diffBig(before.Nonce, after.Nonce),
+		Storage: make(map[common.Hash]*BigDelta),
+	}
+	if !bytes.Equal(before.Code, after.Code) {
+		diff.Code = &CodeDelta{From: before.Code, To: after.Code}
+	}
+	for key, from := range before.Storage {
+		to, ok := after.Storage[key]
+		if !ok {
+			continue
+		}
+		if delta := diffBig(from, to); delta != nil {
+			diff.Storage[key] = delta
+		}
+	}
+	return diff
+}
+
+// Compute compares the state of each of the given accounts and the requested
+// storage slots between before and after. Accounts that didn't change are left
+// out of the result.
+func Compute(
+	before StateReader,
+	after StateReader,
+	accounts []common.Address,
+	storageKeys map[common.Address][]common.Hash,
+) (map[common.Address]*AccountDiff, error) {
+	diffs := make(map[common.Address]*AccountDiff)
+	for _, account := range accounts {
+		keys := storageKeys[account]
+		beforeAccount, err := ReadAccount(before, account, keys)
+		if err != nil {
+			return nil, err
+		}
+		afterAccount, err := ReadAccount(after, account, keys)
+		if err != nil {
+			return nil, err
+		}
+		diff := DiffAccount(beforeAccount, afterAccount)
+		if !diff.Empty() {
+			diffs[account] = diff
+		}
+	}
+	return diffs, nil
+}
+
+// StorageReader is the subset of snapshot.Snapshot used to list the storage
+// of an account
+type StorageReader interface {
+	GetStorage(account common.Address) (map[common.Hash]common.Hash, error)
+}
+
+// StorageKeys returns the slots of each account that are set in either before
+// or after, sorted by key. Slots that are unset in both states can't have
+// changed, so these are the only ones Compute needs to check.
+func StorageKeys(before StorageReader, after StorageReader, accounts []common.Address) (map[common.Address][]common.Hash, error) {
+	storageKeys := make(map[common.Address][]common.Hash)
+	for _, account := range accounts {
+		beforeStorage, err := before.GetStorage(account)
+		if err != nil {
+			return nil, err
+		}
+		afterStorage, err := after.GetStorage(account)
+		if err != nil {
+			return nil, err
+		}
+		keys := make(map[common.Hash]bool, len(beforeStorage)+len(afterStorage))
+		for key := range beforeStorage {
+			keys[key] = true
+		}
+		for key := range afterStorage {
+			keys[key] = true
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		sorted := make([]common.Hash, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return bytes.Compare(sorted[i].Bytes(), sorted[j].Bytes()) < 0
+		})
+		storageKeys[account] = sorted
+	}
+	return storageKeys, nil
+}
+
+// TouchedAccounts returns the sender along with every account that appears
+// in the EVM trace contained in debugPrints, sorted by address. Storage slots
+// aren't included in the trace, use StorageKeys to find the slots to check.
+func TouchedAccounts(sender common.Address, debugPrints []value.Value) ([]common.Address, error) {
+	touched := map[common.Address]bool{sender: true}
+	for _, d := range debugPrints {
+		parsed, err := evm.NewLogLineFromValue(d)
+		if err != nil {
+			return nil, err
+		}
+		trace, ok := parsed.(*evm.EVMTrace)
+		if !ok {
+			continue
+		}
+		for _, item := range trace.Items {
+			switch item := item.(type) {
+			case *evm.CallTrace:
+				touched[item.From] = true
+				if item.To != nil {
+					touched[*item.To] = true
+				}
+			case *evm.CreateTrace:
+				touched[item.ContractAddress] = true
+			case *evm.Create2Trace:
+				touched[item.Creator] = true
+				touched[item.ContractAddress] = true
+			}
+		}
+	}
+	accounts := make([]common.Address, 0, len(touched))
+	for account := range touched {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Bytes(), accounts[j].Bytes()) < 0
+	})
+	return accounts, nil
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statediff
+
+import (
+	"math/big"
+	"testing"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+type mapState map[common.Address]*Account
+
+func (m mapState) get(account common.Address) *Account {
+	acct, ok := m[account]
+	if !ok {
+		return &Account{Balance: big.NewInt(0), Nonce: big.NewInt(0), Storage: map[common.Hash]*big.Int{}}
+	}
+	return acct
+}
+
+func (m mapState) GetBalance(account common.Address) (*big.Int, error) {
+	return m.get(account).Balance, nil
+}
+
+func (m mapState) GetTransactionCount(account common.Address) (*big.Int, error) {
+	return m.get(account).Nonce, nil
+}
+
+func (m mapState) GetCode(account common.Address) ([]byte, error) {
+	return m.get(account).Code, nil
+}
+
+func (m mapState) GetStorageAt(account common.Address, index *big.Int) (*big.Int, error) {
+	var key common.Hash
+	data := index.Bytes()
+	copy(key[32-len(data):], data)
+	val, ok := m.get(account).Storage[key]
+	if !ok {
+		return big.NewInt(0), nil
+	}
+	return val, nil
+}
+
+func (m mapState) GetStorage(account common.Address) (map[common.Hash]common.Hash, error) {
+	storage := make(map[common.Hash]common.Hash)
+	for key, val := range m.get(account).Storage {
+		if val.Sign() != 0 {
+			storage[key] = common.NewHashFromEth(ethcommon.BigToHash(val))
+		}
+	}
+	return storage, nil
+}
+
+func TestCompute(t *testing.T) {
+	sender := common.Address{1}
+	contract := common.Address{2}
+	created := common.Address{3}
+	untouched := common.Address{4}
+	slot := common.Hash{31: 5}
+	otherSlot := common.Hash{31: 6}
+
+	before := mapState{
+		sender: {Balance: big.NewInt(100), Nonce: big.NewInt(1)},
+		contract: {
+			Balance: big.NewInt(0),
+			Nonce:   big.NewInt(1),
+			Code:    []byte{1, 2, 3},
+			Storage: map[common.Hash]*big.Int{slot: big.NewInt(7), otherSlot: big.NewInt(8)},
+		},
+		untouched: {Balance: big.NewInt(5), Nonce: big.NewInt(0)},
+	}
+	after := mapState{
+		sender: {Balance: big.NewInt(90), Nonce: big.NewInt(2)},
+		contract: {
+			Balance: big.NewInt(0),
+			Nonce:   big.NewInt(1),
+			Code:    []byte{1, 2, 3},
+			Storage: map[common.Hash]*big.Int{slot: big.NewInt(9), otherSlot: big.NewInt(8)},
+		},
+		created:   {Balance: big.NewInt(10), Nonce: big.NewInt(1), Code: []byte{4}},
+		untouched: {Balance: big.NewInt(5), Nonce: big.NewInt(0)},
+	}
+
+	diffs, err := Compute(
+		before,
+		after,
+		[]common.Address{sender, contract, created, untouched},
+		map[common.Address][]common.Hash{contract: {slot, otherSlot}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Fatal("expected 3 changed accounts, got", len(diffs))
+	}
+	if _, ok := diffs[untouched]; ok {
+		t.Error("unchanged account included in diff")
+	}
+
+	senderDiff := diffs[sender]
+	if senderDiff.Born || senderDiff.Died || senderDiff.Code != nil {
+		t.Error("unexpected sender diff", senderDiff)
+	}
+	if senderDiff.Balance.From.Int64() != 100 || senderDiff.Balance.To.Int64() != 90 {
+		t.Error("wrong sender balance diff", senderDiff.Balance)
+	}
+	if senderDiff.Nonce.From.Int64() != 1 || senderDiff.Nonce.To.Int64() != 2 {
+		t.Error("wrong sender nonce diff", senderDiff.Nonce)
+	}
+
+	contractDiff := diffs[contract]
+	if contractDiff.Balance != nil || contractDiff.Nonce != nil || contractDiff.Code != nil {
+		t.Error("unexpected contract diff", contractDiff)
+	}
+	if len(contractDiff.Storage) != 1 {
+		t.Fatal("expected one changed slot, got", len(contractDiff.Storage))
+	}
+	if delta := contractDiff.Storage[slot]; delta.From.Int64() != 7 || delta.To.Int64() != 9 {
+		t.Error("wrong storage diff", delta)
+	}
+
+	createdDiff := diffs[created]
+	if !createdDiff.Born || createdDiff.Died {
+		t.Error("expected created account to be born")
+	}
+	if createdDiff.Code == nil || len(createdDiff.Code.From) != 0 || len(createdDiff.Code.To) != 1 {
+		t.Error("wrong code diff", createdDiff.Code)
+	}
+}
+
+func TestStorageKeys(t *testing.T) {
+	contract := common.Address{1}
+	empty := common.Address{2}
+	cleared := common.Hash{31: 1}
+	set := common.Hash{31: 2}
+	unchanged := common.Hash{31: 3}
+
+	before := mapState{
+		contract: {
+			Balance: big.NewInt(0),
+			Nonce:   big.NewInt(1),
+			Storage: map[common.Hash]*big.Int{cleared: big.NewInt(4), unchanged: big.NewInt(5)},
+		},
+	}
+	after := mapState{
+		contract: {
+			Balance: big.NewInt(0),
+			Nonce:   big.NewInt(1),
+			Storage: map[common.Hash]*big.Int{set: big.NewInt(6), unchanged: big.NewInt(5)},
+		},
+	}
+
+	accounts := []common.Address{contract, empty}
+	storageKeys, err := StorageKeys(before, after, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := storageKeys[empty]; ok {
+		t.Error("keys returned for account without storage")
+	}
+	keys := storageKeys[contract]
+	if len(keys) != 3 || keys[0] != cleared || keys[1] != set || keys[2] != unchanged {
+		t.Fatal("wrong storage keys", keys)
+	}
+
+	diffs, err := Compute(before, after, accounts, storageKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := diffs[contract].Storage
+	if len(storage) != 2 {
+		t.Fatal("expected two changed slots, got", len(storage))
+	}
+	if delta := storage[cleared]; delta.From.Int64() != 4 || delta.To.Sign() != 0 {
+		t.Error("wrong cleared slot diff", delta)
+	}
+	if delta := storage[set]; delta.From.Sign() != 0 || delta.To.Int64() != 6 {
+		t.Error("wrong set slot diff", delta)
+	}
+}
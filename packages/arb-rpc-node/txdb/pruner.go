@@ -0,0 +1,193 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+)
+
+// Number of blocks to search backwards from the pruning cutoff for a block
+// containing a transaction, which is needed to find its inbox position
+const maxPruneCutoffSearch = 1000
+
+var (
+	dbSizeGauge          = metrics.NewRegisteredGauge("arbitrum/node/db/size_bytes", nil)
+	oldestBlockGauge     = metrics.NewRegisteredGauge("arbitrum/node/state/oldest_block", nil)
+	pruneCounter         = metrics.NewRegisteredCounter("arbitrum/node/state/prune_runs", nil)
+	pruneCutoffGauge     = metrics.NewRegisteredGauge("arbitrum/node/state/prune_cutoff_message", nil)
+	archiveModeGauge     = metrics.NewRegisteredGauge("arbitrum/node/state/archive", nil)
+	dbSizeUpdateDuration = metrics.NewRegisteredTimer("arbitrum/node/db/size_update", nil)
+)
+
+// Pruner periodically updates disk usage metrics and, for full nodes,
+// discards core checkpoints for blocks older than the configured number of
+// recent blocks. Archive nodes retain state for every block.
+type Pruner struct {
+	db     *TxDB
+	core   core.CheckpointPruner
+	config configuration.NodeStateHistory
+	dbPath string
+}
+
+func NewPruner(db *TxDB, checkpointPruner core.CheckpointPruner, config configuration.NodeStateHistory, dbPath string) (*Pruner, error) {
+	switch config.Mode {
+	case configuration.StateHistoryArchive:
+	case configuration.StateHistoryFull:
+		if config.KeepBlocks == 0 {
+			return nil, errors.New("full node must keep at least one block of state")
+		}
+		if config.SaveCheckpointInterval < 0 {
+			return nil, errors.New("save checkpoint interval can't be negative")
+		}
+	default:
+		return nil, errors.Errorf("unknown state history mode %v", config.Mode)
+	}
+	if config.PruneInterval <= 0 {
+		return nil, errors.New("prune interval must be positive")
+	}
+	return &Pruner{
+		db:     db,
+		core:   checkpointPruner,
+		config: config,
+		dbPath: dbPath,
+	}, nil
+}
+
+func (p *Pruner) Start(ctx context.Context) {
+	if p.config.Mode == configuration.StateHistoryArchive {
+		archiveModeGauge.Update(1)
+	}
+	go func() {
+		ticker := time.NewTicker(p.config.PruneInterval)
+		defer ticker.Stop()
+		for {
+			if p.config.Mode == configuration.StateHistoryFull {
+				if err := p.prune(); err != nil {
+					logger.Warn().Err(err).Msg("error pruning old state")
+				}
+			}
+			p.updateDiskUsage()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Pruner) prune() error {
+	latest, err := p.db.LatestBlock()
+	if err != nil {
+		return err
+	}
+	latestHeight := latest.Header.Number.Uint64()
+	if latestHeight < p.config.KeepBlocks {
+		return nil
+	}
+	oldest := latestHeight - p.config.KeepBlocks + 1
+
+	if p.core.CheckpointPruningPending() {
+		// Don't advance the oldest block until the previous request is done
+		return nil
+	}
+	if oldest <= p.db.OldestAvailableBlock() {
+		return nil
+	}
+
+	cutoff, err := p.findMessageCutoff(oldest)
+	if err != nil || cutoff == nil {
+		return err
+	}
+	// Reject requests for pruned blocks before the core deletes their state
+	if err := p.db.setOldestAvailableBlock(oldest); err != nil {
+		return err
+	}
+	p.core.PruneCheckpoints(cutoff, big.NewInt(p.config.SaveCheckpointInterval))
+
+	oldestBlockGauge.Update(int64(oldest))
+	pruneCutoffGauge.Update(cutoff.Int64())
+	pruneCounter.Inc(1)
+	logger.Info().
+		Uint64("oldestBlock", oldest).
+		Str("messageCutoff", cutoff.String()).
+		Msg("pruning old state")
+	return nil
+}
+
+// findMessageCutoff returns the inbox sequence number of a transaction in the
+// newest block at or before height that has one. Checkpoints before that
+// message don't contain any state needed for blocks at or after height.
+func (p *Pruner) findMessageCutoff(height uint64) (*big.Int, error) {
+	for i := uint64(0); i < maxPruneCutoffSearch && i <= height; i++ {
+		info, err := p.db.GetBlock(height - i)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			continue
+		}
+		_, results, err := p.db.GetBlockResults(info)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			continue
+		}
+		seqNum := results[0].IncomingRequest.Provenance.L1SeqNum
+		if seqNum == nil || seqNum.Sign() <= 0 {
+			return nil, nil
+		}
+		return new(big.Int).Set(seqNum), nil
+	}
+	return nil, nil
+}
+
+func (p *Pruner) updateDiskUsage() {
+	start := time.Now()
+	var size int64
+	err := filepath.Walk(p.dbPath, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files can be removed by compaction while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn().Err(err).Str("path", p.dbPath).Msg("error calculating database size")
+		return
+	}
+	dbSizeGauge.Update(size)
+	dbSizeUpdateDuration.UpdateSince(start)
+}
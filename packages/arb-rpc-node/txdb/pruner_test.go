@@ -0,0 +1,223 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+type pruneRequest struct {
+	deleteBeforeMessage *big.Int
+	saveMessageInterval *big.Int
+}
+
+// testCheckpointPruner records pruning requests, which stay pending until
+// finish is called
+type testCheckpointPruner struct {
+	requests []pruneRequest
+	pending  bool
+}
+
+func (p *testCheckpointPruner) PruneCheckpoints(deleteBeforeMessage *big.Int, saveMessageInterval *big.Int) {
+	p.requests = append(p.requests, pruneRequest{
+		deleteBeforeMessage: deleteBeforeMessage,
+		saveMessageInterval: saveMessageInterval,
+	})
+	p.pending = true
+}
+
+func (p *testCheckpointPruner) CheckpointPruningPending() bool {
+	return p.pending
+}
+
+func (p *testCheckpointPruner) finish() {
+	p.pending = false
+}
+
+func newTestPruner(t *testing.T, db *TxDB, checkpointPruner *testCheckpointPruner) *Pruner {
+	pruner, err := NewPruner(db, checkpointPruner, configuration.NodeStateHistory{
+		Mode:                   configuration.StateHistoryFull,
+		KeepBlocks:             10,
+		SaveCheckpointInterval: 100,
+		PruneInterval:          time.Minute,
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pruner
+}
+
+func requirePruned(t *testing.T, checkpointPruner *testCheckpointPruner, deleteBeforeMessage int64) {
+	t.Helper()
+	if len(checkpointPruner.requests) == 0 {
+		t.Fatal("checkpoints weren't pruned")
+	}
+	req := checkpointPruner.requests[len(checkpointPruner.requests)-1]
+	if req.deleteBeforeMessage.Cmp(big.NewInt(deleteBeforeMessage)) != 0 {
+		t.Error("pruned checkpoints before message", req.deleteBeforeMessage, "but expected", deleteBeforeMessage)
+	}
+	if req.saveMessageInterval.Cmp(big.NewInt(100)) != 0 {
+		t.Error("wrong save interval", req.saveMessageInterval)
+	}
+}
+
+func requireStateNotAvailable(t *testing.T, db *TxDB, height uint64, oldest uint64) {
+	t.Helper()
+	_, err := db.GetSnapshot(context.Background(), height)
+	var notAvailable *StateNotAvailableError
+	if !errors.As(err, &notAvailable) {
+		t.Fatal("expected state of block", height, "to be unavailable but got", err)
+	}
+	if notAvailable.OldestBlock != oldest {
+		t.Error("oldest block is", notAvailable.OldestBlock, "but expected", oldest)
+	}
+}
+
+func TestPrunerHeightGate(t *testing.T) {
+	chain := newTestChain(t)
+	db := chain.newTxDB()
+	checkpointPruner := &testCheckpointPruner{}
+	pruner := newTestPruner(t, db, checkpointPruner)
+
+	// Block 0 has no transactions and block i has the transaction with
+	// sequence number i
+	chain.addBlock()
+	for i := int64(1); i < 10; i++ {
+		chain.addBlock(i)
+	}
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpointPruner.requests) != 0 || db.OldestAvailableBlock() != 0 {
+		t.Fatal("pruned before there were more blocks than need to be kept")
+	}
+
+	for i := int64(10); i < 15; i++ {
+		chain.addBlock(i)
+	}
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	// Blocks 5 to 14 are kept
+	requirePruned(t, checkpointPruner, 5)
+	if db.OldestAvailableBlock() != 5 || chain.store.oldestBlock != 5 {
+		t.Fatal("oldest block is", db.OldestAvailableBlock(), "with", chain.store.oldestBlock, "stored")
+	}
+	requireStateNotAvailable(t, db, 4, 5)
+
+	// The oldest block isn't advanced while the core is still pruning
+	chain.addBlock(15)
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpointPruner.requests) != 1 || db.OldestAvailableBlock() != 5 {
+		t.Fatal("pruned again while previous request was pending")
+	}
+
+	checkpointPruner.finish()
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	requirePruned(t, checkpointPruner, 6)
+	if db.OldestAvailableBlock() != 6 {
+		t.Fatal("oldest block is", db.OldestAvailableBlock())
+	}
+
+	// Nothing to do without new blocks
+	checkpointPruner.finish()
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpointPruner.requests) != 2 {
+		t.Fatal("pruned without new blocks")
+	}
+}
+
+func TestPrunerCutoffSkipsEmptyBlocks(t *testing.T) {
+	chain := newTestChain(t)
+	db := chain.newTxDB()
+	checkpointPruner := &testCheckpointPruner{}
+	pruner := newTestPruner(t, db, checkpointPruner)
+
+	chain.addBlock()
+	chain.addBlock(1, 2)
+	for i := 0; i < 13; i++ {
+		chain.addBlock()
+	}
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	// The oldest kept block is 5, so checkpoints are kept from the first
+	// message in block 1, which is the newest block before it with a
+	// transaction
+	requirePruned(t, checkpointPruner, 1)
+	if db.OldestAvailableBlock() != 5 {
+		t.Fatal("oldest block is", db.OldestAvailableBlock())
+	}
+}
+
+func TestPrunerRestart(t *testing.T) {
+	chain := newTestChain(t)
+	db := chain.newTxDB()
+	checkpointPruner := &testCheckpointPruner{}
+	pruner := newTestPruner(t, db, checkpointPruner)
+
+	chain.addBlock()
+	for i := int64(1); i < 20; i++ {
+		chain.addBlock(i)
+	}
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	requirePruned(t, checkpointPruner, 10)
+
+	// The core deletes the checkpoints, then the node restarts
+	checkpointPruner.finish()
+	db = chain.newTxDB()
+	if db.OldestAvailableBlock() != 10 {
+		t.Fatal("oldest block after restart is", db.OldestAvailableBlock())
+	}
+	requireStateNotAvailable(t, db, 9, 10)
+
+	// Pruning resumes from the stored height without requesting the same
+	// pruning again
+	checkpointPruner = &testCheckpointPruner{}
+	pruner = newTestPruner(t, db, checkpointPruner)
+	updates := chain.store.oldestUpdates
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpointPruner.requests) != 0 || chain.store.oldestUpdates != updates {
+		t.Fatal("pruned again after restart without new blocks")
+	}
+
+	chain.addBlock(20)
+	if err := pruner.prune(); err != nil {
+		t.Fatal(err)
+	}
+	requirePruned(t, checkpointPruner, 11)
+	if db.OldestAvailableBlock() != 11 || chain.store.oldestBlock != 11 {
+		t.Fatal("oldest block is", db.OldestAvailableBlock(), "with", chain.store.oldestBlock, "stored")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"math/big"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
@@ -40,6 +41,7 @@ import (
 	"github.com/ethereum/go-ethereum/trie"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/replay"
 	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
@@ -51,6 +53,11 @@ import (
 var logger = log.With().Caller().Stack().Str("component", "txdb").Logger()
 
 type TxDB struct {
+	// oldestAvailableBlock is accessed atomically and is non-zero when state
+	// for earlier blocks has been pruned. It's persisted in the node store so
+	// that pruned blocks are still rejected after a restart.
+	oldestAvailableBlock uint64
+
 	Lookup          core.ArbOutputLookup
 	allowSlowLookup bool
 	as              machine.NodeStore
@@ -67,6 +74,10 @@ type TxDB struct {
 
 	snapshotLRUCache  *lru.Cache
 	blockInfoLRUCache *lru.Cache
+
+	// replay reconstructs states missing from the core's sideload cache when
+	// slow lookups are allowed
+	replay *replay.Scheduler
 }
 
 func New(
@@ -76,39 +87,64 @@ func New(
 	updateFrequency time.Duration,
 	cacheConfig *configuration.NodeCache,
 ) (*TxDB, <-chan error, error) {
+	db, err := newTxDB(arbCore, as, cacheConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cacheConfig.AllowSlowLookup && cacheConfig.Replay.Workers > 0 {
+		scheduler, err := replay.NewScheduler(arbCore, cacheConfig.Replay)
+		if err != nil {
+			return nil, nil, err
+		}
+		scheduler.Start(ctx)
+		db.replay = scheduler
+	}
+	logReader := core.NewLogReader(db, arbCore, big.NewInt(0), big.NewInt(10), updateFrequency)
+	errChan := logReader.Start(ctx)
+	db.logReader = logReader
+	return db, errChan, nil
+}
+
+func newTxDB(lookup core.ArbOutputLookup, as machine.NodeStore, cacheConfig *configuration.NodeCache) (*TxDB, error) {
 	var snapshotLRUCache *lru.Cache
 	var blockInfoLRUCache *lru.Cache
 	if cacheConfig.LRUSize > 0 {
 		var err error
 		snapshotLRUCache, err = lru.New(cacheConfig.LRUSize)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	}
 	if cacheConfig.BlockInfoLRUSize > 0 {
 		var err error
 		blockInfoLRUCache, err = lru.New(cacheConfig.BlockInfoLRUSize)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	}
-	db := &TxDB{
-		Lookup:            arbCore,
-		as:                as,
-		snapshotLRUCache:  snapshotLRUCache,
-		blockInfoLRUCache: blockInfoLRUCache,
-		allowSlowLookup:   cacheConfig.AllowSlowLookup,
+	oldestAvailableBlock, err := as.OldestAvailableBlock()
+	if err != nil {
+		return nil, err
 	}
-	logReader := core.NewLogReader(db, arbCore, big.NewInt(0), big.NewInt(10), updateFrequency)
-	errChan := logReader.Start(ctx)
-	db.logReader = logReader
-	return db, errChan, nil
+	return &TxDB{
+		oldestAvailableBlock: oldestAvailableBlock,
+		Lookup:               lookup,
+		as:                   as,
+		snapshotLRUCache:     snapshotLRUCache,
+		blockInfoLRUCache:    blockInfoLRUCache,
+		allowSlowLookup:      cacheConfig.AllowSlowLookup,
+	}, nil
 }
 
 func (db *TxDB) Close() {
 	db.logReader.Stop()
 }
 
+// LogReader returns the reader feeding core logs into the database
+func (db *TxDB) LogReader() *core.LogReader {
+	return db.logReader
+}
+
 func (db *TxDB) GetBlockResults(block *machine.BlockInfo) (*evm.BlockInfo, []*evm.TxResult, error) {
 	startLog := new(big.Int).SetUint64(block.InitialLogIndex())
 	logCount := new(big.Int).SetUint64(block.LogCount + 1)
@@ -173,7 +209,7 @@ func (db *TxDB) AddLogs(initialLogIndex *big.Int, avmLogs []value.Value) error {
 		}
 		logIndex++
 	}
-	return nil
+	return db.as.UpdateCurrentLogCount(new(big.Int).SetUint64(logIndex))
 }
 
 func (db *TxDB) DeleteLogs(avmLogs []value.Value) error {
@@ -241,9 +277,20 @@ func (db *TxDB) DeleteLogs(avmLogs []value.Value) error {
 			}
 			db.blockInfoLRUCache.Remove(reorgBlockHeight)
 		}
+		if db.replay != nil {
+			db.replay.Reorg(reorgBlockHeight)
+		}
 	}
 
-	return nil
+	logCount, err := db.as.CurrentLogCount()
+	if err != nil {
+		return err
+	}
+	logCount.Sub(logCount, big.NewInt(int64(len(avmLogs))))
+	if logCount.Sign() < 0 {
+		logCount.SetInt64(0)
+	}
+	return db.as.UpdateCurrentLogCount(logCount)
 }
 
 func (db *TxDB) HandleLog(logIndex uint64, avmLog value.Value) error {
@@ -512,17 +559,29 @@ func (db *TxDB) LatestBlock() (*machine.BlockInfo, error) {
 	return nil, errors.New("can't get latest block because there are no blocks")
 }
 
-func (db *TxDB) getSnapshotForInfo(info *machine.BlockInfo) (*snapshot.Snapshot, error) {
+func (db *TxDB) getSnapshotForInfo(ctx context.Context, info *machine.BlockInfo) (*snapshot.Snapshot, error) {
 	if db.snapshotLRUCache != nil {
 		cachedSnap, found := db.snapshotLRUCache.Get(info.Header.Number.Uint64())
 		if found {
 			return cachedSnap.(*snapshot.Snapshot), nil
 		}
 	}
+	if db.replay != nil {
+		mach, err := db.Lookup.GetMachineForSideload(info.Header.Number.Uint64(), false)
+		if err != nil || mach == nil {
+			// Not in the core's memory cache, so reconstruct it
+			return db.replay.Snapshot(ctx, info)
+		}
+		return db.cacheSnapshot(info, mach)
+	}
 	mach, err := db.Lookup.GetMachineForSideload(info.Header.Number.Uint64(), db.allowSlowLookup)
 	if err != nil || mach == nil {
 		return nil, err
 	}
+	return db.cacheSnapshot(info, mach)
+}
+
+func (db *TxDB) cacheSnapshot(info *machine.BlockInfo, mach machine.Machine) (*snapshot.Snapshot, error) {
 	currentTime := inbox.ChainTime{
 		BlockNum:  common.NewTimeBlocks(new(big.Int).Set(info.Header.Number)),
 		Timestamp: new(big.Int).SetUint64(info.Header.Time),
@@ -537,12 +596,38 @@ func (db *TxDB) getSnapshotForInfo(info *machine.BlockInfo) (*snapshot.Snapshot,
 	return snap, nil
 }
 
-func (db *TxDB) GetSnapshot(blockHeight uint64) (*snapshot.Snapshot, error) {
+// StateNotAvailableError is returned when requesting the state of a block that
+// has been pruned
+type StateNotAvailableError struct {
+	Block       uint64
+	OldestBlock uint64
+}
+
+func (e *StateNotAvailableError) Error() string {
+	return fmt.Sprintf("state for block %v is not available on a full node, oldest available block is %v", e.Block, e.OldestBlock)
+}
+
+func (db *TxDB) OldestAvailableBlock() uint64 {
+	return atomic.LoadUint64(&db.oldestAvailableBlock)
+}
+
+func (db *TxDB) setOldestAvailableBlock(height uint64) error {
+	if err := db.as.UpdateOldestAvailableBlock(height); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&db.oldestAvailableBlock, height)
+	return nil
+}
+
+func (db *TxDB) GetSnapshot(ctx context.Context, blockHeight uint64) (*snapshot.Snapshot, error) {
+	if oldest := db.OldestAvailableBlock(); blockHeight < oldest {
+		return nil, &StateNotAvailableError{Block: blockHeight, OldestBlock: oldest}
+	}
 	info, err := db.GetBlock(blockHeight)
 	if err != nil || info == nil {
 		return nil, err
 	}
-	return db.getSnapshotForInfo(info)
+	return db.getSnapshotForInfo(ctx, info)
 }
 
 func (db *TxDB) LatestSnapshot() (*snapshot.Snapshot, error) {
@@ -550,7 +635,7 @@ func (db *TxDB) LatestSnapshot() (*snapshot.Snapshot, error) {
 	if err != nil {
 		return nil, err
 	}
-	snap, err := db.getSnapshotForInfo(block)
+	snap, err := db.getSnapshotForInfo(context.Background(), block)
 	if err != nil {
 		if strings.Contains(err.Error(), "block not in cache") {
 			logger.Error().Hex("block", block.Header.Number.Bytes()).Msg("latest block is not in cache")
@@ -590,6 +675,14 @@ func (db *TxDB) SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscrip
 	return db.pendingLogsFeed.Subscribe(ch)
 }
 
+// SendPendingLogs notifies pending log subscribers of logs from transactions
+// that have been executed but not yet included in a block
+func (db *TxDB) SendPendingLogs(logs []*types.Log) {
+	if len(logs) > 0 {
+		db.pendingLogsFeed.Send(logs)
+	}
+}
+
 func (db *TxDB) SubscribeBlockProcessingEvent(ch chan<- []*types.Log) event.Subscription {
 	return db.blockProcFeed.Subscribe(ch)
 }
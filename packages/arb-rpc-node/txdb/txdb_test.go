@@ -0,0 +1,311 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/avmcodec"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/core"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// memoryNodeStore is an in memory machine.NodeStore which outlives the TxDBs
+// using it, like the node's database does across restarts
+type memoryNodeStore struct {
+	mutex         sync.Mutex
+	blocks        []*machine.BlockInfo
+	blockHashes   map[common.Hash]uint64
+	requests      map[common.Hash]uint64
+	batches       map[string]uint64
+	logCount      *big.Int
+	oldestBlock   uint64
+	oldestUpdates int
+}
+
+func newMemoryNodeStore() *memoryNodeStore {
+	return &memoryNodeStore{
+		blockHashes: make(map[common.Hash]uint64),
+		requests:    make(map[common.Hash]uint64),
+		batches:     make(map[string]uint64),
+		logCount:    big.NewInt(0),
+	}
+}
+
+func (s *memoryNodeStore) GetPossibleRequestInfo(requestId common.Hash) *uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	logIndex, ok := s.requests[requestId]
+	if !ok {
+		return nil
+	}
+	return &logIndex
+}
+
+func (s *memoryNodeStore) GetPossibleBlock(blockHash common.Hash) *uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	height, ok := s.blockHashes[blockHash]
+	if !ok {
+		return nil
+	}
+	return &height
+}
+
+func (s *memoryNodeStore) GetBlockInfo(height uint64) (*machine.BlockInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if height >= uint64(len(s.blocks)) {
+		return nil, errors.Errorf("invalid index %v with count %v", height, len(s.blocks))
+	}
+	return s.blocks[height], nil
+}
+
+func (s *memoryNodeStore) BlockCount() (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return uint64(len(s.blocks)), nil
+}
+
+func (s *memoryNodeStore) SaveMessageBatch(batchNum *big.Int, logIndex uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batches[batchNum.String()] = logIndex
+	return nil
+}
+
+func (s *memoryNodeStore) GetMessageBatch(batchNum *big.Int) *uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	logIndex, ok := s.batches[batchNum.String()]
+	if !ok {
+		return nil
+	}
+	return &logIndex
+}
+
+func (s *memoryNodeStore) SaveBlock(info *machine.BlockInfo, requests []machine.EVMRequestInfo) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	height := info.Header.Number.Uint64()
+	if height > uint64(len(s.blocks)) {
+		return errors.Errorf("tried to save block with unexpected height: got %v but expected %v", height, len(s.blocks))
+	}
+	s.blockHashes[common.NewHashFromEth(info.Header.Hash())] = height
+	for _, req := range requests {
+		s.requests[req.RequestId] = req.LogIndex
+	}
+	s.blocks = append(s.blocks[:height], info)
+	return nil
+}
+
+func (s *memoryNodeStore) Reorg(height uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if height < uint64(len(s.blocks)) {
+		s.blocks = s.blocks[:height]
+	}
+	return nil
+}
+
+func (s *memoryNodeStore) CurrentLogCount() (*big.Int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.logCount == nil {
+		return nil, nil
+	}
+	return new(big.Int).Set(s.logCount), nil
+}
+
+func (s *memoryNodeStore) UpdateCurrentLogCount(count *big.Int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.logCount = new(big.Int).Set(count)
+	return nil
+}
+
+func (s *memoryNodeStore) OldestAvailableBlock() (uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.oldestBlock, nil
+}
+
+func (s *memoryNodeStore) UpdateOldestAvailableBlock(height uint64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.oldestBlock = height
+	s.oldestUpdates++
+	return nil
+}
+
+// testLookup serves the core logs of a testChain. Other lookups aren't
+// supported.
+type testLookup struct {
+	core.ArbOutputLookup
+
+	mutex sync.Mutex
+	logs  []value.Value
+}
+
+func (l *testLookup) GetLogCount() (*big.Int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return big.NewInt(int64(len(l.logs))), nil
+}
+
+func (l *testLookup) GetLogs(startIndex, count *big.Int) ([]value.Value, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	start := startIndex.Uint64()
+	end := start + count.Uint64()
+	if end > uint64(len(l.logs)) {
+		return nil, errors.New("log index out of range")
+	}
+	return append([]value.Value{}, l.logs[start:end]...), nil
+}
+
+// testChain builds the core logs of an L2 chain along with the node store
+// entries describing its blocks
+type testChain struct {
+	t      *testing.T
+	lookup *testLookup
+	store  *memoryNodeStore
+}
+
+func newTestChain(t *testing.T) *testChain {
+	return &testChain{
+		t:      t,
+		lookup: &testLookup{},
+		store:  newMemoryNodeStore(),
+	}
+}
+
+// newTxDB creates a TxDB using the chain's store like a node starting up would
+func (c *testChain) newTxDB() *TxDB {
+	db, err := newTxDB(c.lookup, c.store, &configuration.NodeCache{})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return db
+}
+
+func (c *testChain) encode(val interface{}) value.Value {
+	encoded, err := avmcodec.Marshal(val)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return encoded
+}
+
+func testFeeSet() *evm.FeeSet {
+	return &evm.FeeSet{
+		L1Transaction: big.NewInt(0),
+		L1Calldata:    big.NewInt(0),
+		L2Storage:     big.NewInt(0),
+		L2Computation: big.NewInt(0),
+	}
+}
+
+// blockResults builds the logs for a block containing a transaction for each
+// of the given inbox sequence numbers, with the block log last
+func (c *testChain) blockResults(height uint64, seqNums []int64) []value.Value {
+	blockNum := new(big.Int).SetUint64(height)
+	chainLogCount := int64(len(c.lookup.logs) + len(seqNums) + 1)
+	logs := make([]value.Value, 0, len(seqNums)+1)
+	for i, seqNum := range seqNums {
+		res := evm.NewRandomResult(0)
+		res.IncomingRequest.L2BlockNumber = blockNum
+		res.IncomingRequest.Provenance = evm.Provenance{
+			L1SeqNum:        big.NewInt(seqNum),
+			ParentRequestId: common.Hash{},
+			IndexInParent:   nil,
+		}
+		res.TxIndex = big.NewInt(int64(i))
+		res.FeeStats = &evm.FeeStats{
+			Price:     testFeeSet(),
+			UnitsUsed: testFeeSet(),
+			Paid:      testFeeSet(),
+		}
+		logs = append(logs, c.encode(res))
+	}
+	stats := func(avmLogCount int64) *evm.OutputStatistics {
+		return &evm.OutputStatistics{
+			GasUsed:      big.NewInt(0),
+			TxCount:      big.NewInt(int64(len(seqNums))),
+			EVMLogCount:  big.NewInt(0),
+			AVMLogCount:  big.NewInt(avmLogCount),
+			AVMSendCount: big.NewInt(0),
+		}
+	}
+	block := &evm.BlockInfo{
+		BlockNum:   blockNum,
+		Timestamp:  big.NewInt(0),
+		BlockStats: stats(int64(len(seqNums))),
+		ChainStats: stats(chainLogCount),
+		GasSummary: &evm.GasAccountingSummary{
+			PricePerL1CalldataByte:   big.NewInt(0),
+			PricePerStorageCell:      big.NewInt(0),
+			PricePerArbGasBase:       big.NewInt(0),
+			PricePerArbGasCongestion: big.NewInt(0),
+			PricePerArbGasTotal:      big.NewInt(0),
+			GasPool:                  big.NewInt(0),
+		},
+		PreviousHeight: big.NewInt(0),
+		L1BlockNum:     big.NewInt(0),
+	}
+	return append(logs, c.encode(block))
+}
+
+// addBlock appends a block containing a transaction for each of the given
+// inbox sequence numbers and records it in the node store
+func (c *testChain) addBlock(seqNums ...int64) *machine.BlockInfo {
+	height, err := c.store.BlockCount()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	logs := c.blockResults(height, seqNums)
+
+	c.lookup.mutex.Lock()
+	blockLog := uint64(len(c.lookup.logs) + len(logs) - 1)
+	c.lookup.logs = append(c.lookup.logs, logs...)
+	c.lookup.mutex.Unlock()
+
+	info := &machine.BlockInfo{
+		BlockLog: blockLog,
+		LogCount: uint64(len(seqNums)),
+		Header: &types.Header{
+			Number:     new(big.Int).SetUint64(height),
+			Difficulty: big.NewInt(0),
+		},
+	}
+	if err := c.store.SaveBlock(info, nil); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.store.UpdateCurrentLogCount(new(big.Int).SetUint64(blockLog + 1)); err != nil {
+		c.t.Fatal(err)
+	}
+	return info
+}
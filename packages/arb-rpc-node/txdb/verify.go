@@ -0,0 +1,321 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// Verification stops walking blocks once this many problems were found
+const maxVerifyProblems = 100
+
+// VerifyCore is the part of the core used to check the node database
+type VerifyCore interface {
+	GetLogs(startIndex *big.Int, count *big.Int) ([]value.Value, error)
+	GetLogCount() (*big.Int, error)
+	LogsCursorPosition(cursorIndex *big.Int) (*big.Int, error)
+	LogsCursorRewind(cursorIndex *big.Int, count *big.Int) error
+}
+
+// VerifyResult summarizes the consistency of the node database
+type VerifyResult struct {
+	BlockCount uint64
+
+	// ConsistentBlocks is the number of blocks at the start of the chain that
+	// passed every check
+	ConsistentBlocks uint64
+
+	// ConsistentLogCount is the number of core logs covered by the
+	// consistent blocks
+	ConsistentLogCount uint64
+
+	CheckedRequests uint64
+	CheckedBatches  uint64
+	Problems        []string
+}
+
+func (r *VerifyResult) Consistent() bool {
+	return len(r.Problems) == 0
+}
+
+type verifier struct {
+	store          machine.NodeStore
+	core           VerifyCore
+	coreLogCount   uint64
+	cursorPosition uint64
+	result         *VerifyResult
+}
+
+// Verify walks every block in the node database checking the header chain,
+// block hash, request and message batch indexes and log counts against the
+// core's logs
+func Verify(ctx context.Context, store machine.NodeStore, arbCore VerifyCore) (*VerifyResult, error) {
+	blockCount, err := store.BlockCount()
+	if err != nil {
+		return nil, err
+	}
+	coreLogCount, err := arbCore.GetLogCount()
+	if err != nil {
+		return nil, err
+	}
+	// The txdb reads logs using cursor 0
+	cursorPosition, err := arbCore.LogsCursorPosition(big.NewInt(0))
+	if err != nil {
+		return nil, err
+	}
+	processedLogCount, err := store.CurrentLogCount()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &verifier{
+		store:          store,
+		core:           arbCore,
+		coreLogCount:   coreLogCount.Uint64(),
+		cursorPosition: cursorPosition.Uint64(),
+		result:         &VerifyResult{BlockCount: blockCount},
+	}
+	if cursorPosition.Cmp(coreLogCount) > 0 {
+		v.problem("logs cursor position %v is past core log count %v", cursorPosition, coreLogCount)
+	}
+	// AddLogs saves the processed count before the cursor confirms the logs,
+	// so the count can be ahead of the cursor. Databases created before the
+	// count was tracked have it stuck at 0, in which case it's unknown.
+	if processedLogCount.Sign() == 0 && blockCount > 0 {
+		logger.Info().Msg("processed log count not recorded, skipping check")
+	} else if processedLogCount.Cmp(cursorPosition) < 0 {
+		v.problem("node processed %v logs but logs cursor is at %v", processedLogCount, cursorPosition)
+	}
+
+	consistent := true
+	var prev, lastConsistent *machine.BlockInfo
+	for height := uint64(0); height < blockCount; height++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		info, problems, err := v.checkBlock(height, prev)
+		if err != nil {
+			return nil, err
+		}
+		if len(problems) > 0 && consistent {
+			consistent = false
+			v.result.ConsistentBlocks = height
+		}
+		if consistent {
+			lastConsistent = info
+		}
+		for _, p := range problems {
+			v.problem("block %v: %v", height, p)
+		}
+		if len(v.result.Problems) >= maxVerifyProblems {
+			break
+		}
+		prev = info
+
+		if height%10000 == 0 {
+			logger.Info().Uint64("block", height).Uint64("count", blockCount).Msg("verifying blocks")
+		}
+	}
+	if consistent {
+		v.result.ConsistentBlocks = blockCount
+	}
+	if lastConsistent != nil {
+		v.result.ConsistentLogCount = lastConsistent.BlockLog + 1
+	}
+	return v.result, nil
+}
+
+func (v *verifier) problem(format string, args ...interface{}) {
+	v.result.Problems = append(v.result.Problems, fmt.Sprintf(format, args...))
+}
+
+// checkBlock returns the block at height along with a description of each
+// inconsistency found in it
+func (v *verifier) checkBlock(height uint64, prev *machine.BlockInfo) (*machine.BlockInfo, []string, error) {
+	info, err := v.store.GetBlockInfo(height)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info == nil || info.Header == nil {
+		return nil, []string{"block missing"}, nil
+	}
+
+	var problems []string
+	if info.Header.Number == nil || info.Header.Number.Uint64() != height {
+		problems = append(problems, fmt.Sprintf("header has number %v", info.Header.Number))
+	}
+	if height == 0 {
+		if info.Header.ParentHash != (ethcommon.Hash{}) {
+			problems = append(problems, "genesis block has parent")
+		}
+	} else if prev == nil {
+		problems = append(problems, "parent block missing")
+	} else if info.Header.ParentHash != prev.Header.Hash() {
+		problems = append(problems, fmt.Sprintf("parent hash %v doesn't match previous block %v", info.Header.ParentHash, prev.Header.Hash()))
+	}
+	blockHash := common.NewHashFromEth(info.Header.Hash())
+	if index := v.store.GetPossibleBlock(blockHash); index == nil || *index != height {
+		problems = append(problems, fmt.Sprintf("block hash %v not indexed to block", blockHash))
+	}
+
+	if info.LogCount > info.BlockLog {
+		return info, append(problems, fmt.Sprintf("log count %v larger than block log %v", info.LogCount, info.BlockLog)), nil
+	}
+	startLog := info.InitialLogIndex()
+	if prev != nil {
+		if startLog <= prev.BlockLog {
+			problems = append(problems, fmt.Sprintf("first log %v overlaps previous block ending at log %v", startLog, prev.BlockLog))
+		} else {
+			// Also check logs emitted between the blocks
+			startLog = prev.BlockLog + 1
+		}
+	}
+	if info.BlockLog >= v.cursorPosition {
+		problems = append(problems, fmt.Sprintf("block log %v not yet delivered by logs cursor at %v", info.BlockLog, v.cursorPosition))
+	}
+	if info.BlockLog >= v.coreLogCount {
+		return info, append(problems, fmt.Sprintf("block log %v missing from core with %v logs", info.BlockLog, v.coreLogCount)), nil
+	}
+
+	logs, err := v.core.GetLogs(new(big.Int).SetUint64(startLog), new(big.Int).SetUint64(info.BlockLog+1-startLog))
+	if err != nil {
+		return nil, nil, err
+	}
+	if uint64(len(logs)) != info.BlockLog+1-startLog {
+		return info, append(problems, fmt.Sprintf("core returned %v logs but expected %v", len(logs), info.BlockLog+1-startLog)), nil
+	}
+
+	l2Block, err := evm.NewBlockResultFromValue(logs[len(logs)-1])
+	if err != nil {
+		return info, append(problems, fmt.Sprintf("block log %v isn't a block result: %v", info.BlockLog, err)), nil
+	}
+	if l2Block.BlockNum.Uint64() != height {
+		problems = append(problems, fmt.Sprintf("block log %v is for block %v", info.BlockLog, l2Block.BlockNum))
+	}
+	if l2Block.BlockStats.AVMLogCount.Uint64() != info.LogCount {
+		problems = append(problems, fmt.Sprintf("saved log count %v but block result has %v", info.LogCount, l2Block.BlockStats.AVMLogCount))
+	}
+	if l2Block.LastAVMLog().Uint64() != info.BlockLog {
+		problems = append(problems, fmt.Sprintf("saved block log %v but block result is log %v", info.BlockLog, l2Block.LastAVMLog()))
+	}
+
+	txCount := l2Block.BlockStats.TxCount.Uint64()
+	for i, avmLog := range logs[:len(logs)-1] {
+		logIndex := startLog + uint64(i)
+		res, err := evm.NewResultFromValue(avmLog)
+		if err != nil {
+			continue
+		}
+		switch res := res.(type) {
+		case *evm.TxResult:
+			if logIndex < info.InitialLogIndex() || logIndex >= info.InitialLogIndex()+txCount {
+				continue
+			}
+			problem, err := v.checkRequest(res, logIndex)
+			if err != nil {
+				return nil, nil, err
+			}
+			if problem != "" {
+				problems = append(problems, problem)
+			}
+		case *evm.MerkleRootResult:
+			v.result.CheckedBatches++
+			if batchLog := v.store.GetMessageBatch(res.BatchNumber); batchLog == nil || *batchLog != logIndex {
+				problems = append(problems, fmt.Sprintf("message batch %v at log %v not indexed", res.BatchNumber, logIndex))
+			}
+		}
+	}
+	return info, problems, nil
+}
+
+// checkRequest verifies that the request index leads back to the result of
+// txRes, found at logIndex
+func (v *verifier) checkRequest(txRes *evm.TxResult, logIndex uint64) (string, error) {
+	v.result.CheckedRequests++
+	requestId := txRes.IncomingRequest.MessageID
+	indexed := v.store.GetPossibleRequestInfo(requestId)
+	if indexed == nil {
+		return fmt.Sprintf("request %v at log %v not indexed", requestId, logIndex), nil
+	}
+	if *indexed == logIndex {
+		return "", nil
+	}
+	if txRes.ResultCode == evm.ReturnCode {
+		// Successful transactions are always indexed to their own result
+		return fmt.Sprintf("request %v at log %v indexed to log %v", requestId, logIndex, *indexed), nil
+	}
+
+	// Failed transactions keep the first result saved for them
+	indexedLogs, err := v.core.GetLogs(new(big.Int).SetUint64(*indexed), big.NewInt(1))
+	if err != nil {
+		return "", err
+	}
+	if len(indexedLogs) == 1 {
+		res, err := evm.NewResultFromValue(indexedLogs[0])
+		if err == nil {
+			if indexedRes, ok := res.(*evm.TxResult); ok && indexedRes.IncomingRequest.MessageID == requestId {
+				return "", nil
+			}
+		}
+	}
+	return fmt.Sprintf("request %v indexed to log %v which doesn't contain it", requestId, *indexed), nil
+}
+
+// Repair verifies the node database and, if it's inconsistent, reorgs it back
+// to the last consistent block and rewinds the logs cursor to match, so that
+// the log reader rebuilds everything after that block the next time the node
+// starts. It must not be run while the database is being updated.
+func Repair(ctx context.Context, store machine.NodeStore, arbCore VerifyCore) (*VerifyResult, error) {
+	result, err := Verify(ctx, store, arbCore)
+	if err != nil {
+		return nil, err
+	}
+	if result.Consistent() {
+		return result, nil
+	}
+
+	logger.Warn().
+		Uint64("blockCount", result.BlockCount).
+		Uint64("consistentBlocks", result.ConsistentBlocks).
+		Uint64("logCount", result.ConsistentLogCount).
+		Msg("repairing node database")
+	if result.ConsistentBlocks < result.BlockCount {
+		if err := store.Reorg(result.ConsistentBlocks); err != nil {
+			return nil, err
+		}
+	}
+	logCount := new(big.Int).SetUint64(result.ConsistentLogCount)
+	if err := arbCore.LogsCursorRewind(big.NewInt(0), logCount); err != nil {
+		return nil, err
+	}
+	if err := store.UpdateCurrentLogCount(logCount); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package txdb
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+// testVerifyCore adds a logs cursor to the core logs of a testChain
+type testVerifyCore struct {
+	*testLookup
+	cursor uint64
+}
+
+func (c *testVerifyCore) LogsCursorPosition(*big.Int) (*big.Int, error) {
+	return new(big.Int).SetUint64(c.cursor), nil
+}
+
+func (c *testVerifyCore) LogsCursorRewind(_ *big.Int, count *big.Int) error {
+	c.cursor = count.Uint64()
+	return nil
+}
+
+// newVerifyChain processes blocks with the given number of transactions each
+// through a TxDB so that the node store is consistent with the core
+func newVerifyChain(t *testing.T, txCounts ...int) (*testChain, *testVerifyCore) {
+	c := newTestChain(t)
+	seqNum := int64(0)
+	for height, txCount := range txCounts {
+		seqNums := make([]int64, 0, txCount)
+		for i := 0; i < txCount; i++ {
+			seqNums = append(seqNums, seqNum)
+			seqNum++
+		}
+		logs := c.blockResults(uint64(height), seqNums)
+		c.lookup.logs = append(c.lookup.logs, logs...)
+	}
+	db := c.newTxDB()
+	if err := db.AddLogs(big.NewInt(0), c.lookup.logs); err != nil {
+		t.Fatal(err)
+	}
+	return c, &testVerifyCore{testLookup: c.lookup, cursor: uint64(len(c.lookup.logs))}
+}
+
+func verify(t *testing.T, c *testChain, arbCore *testVerifyCore) *VerifyResult {
+	t.Helper()
+	result, err := Verify(context.Background(), c.store, arbCore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func requireInconsistent(t *testing.T, result *VerifyResult, consistentBlocks uint64) {
+	t.Helper()
+	if result.Consistent() {
+		t.Fatal("inconsistency not detected")
+	}
+	if result.ConsistentBlocks != consistentBlocks {
+		t.Error("expected", consistentBlocks, "consistent blocks but got", result.ConsistentBlocks, result.Problems)
+	}
+}
+
+func blockRequest(t *testing.T, c *testChain, height uint64) (*evm.TxResult, uint64) {
+	t.Helper()
+	info, err := c.store.GetBlockInfo(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logIndex := info.InitialLogIndex()
+	res, err := evm.NewResultFromValue(c.lookup.logs[logIndex])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.(*evm.TxResult), logIndex
+}
+
+func TestVerifyConsistent(t *testing.T) {
+	c, arbCore := newVerifyChain(t, 1, 2, 0, 1)
+	result := verify(t, c, arbCore)
+	if !result.Consistent() {
+		t.Fatal("unexpected problems", result.Problems)
+	}
+	if result.BlockCount != 4 || result.ConsistentBlocks != 4 {
+		t.Error("wrong block counts", result.BlockCount, result.ConsistentBlocks)
+	}
+	if result.ConsistentLogCount != uint64(len(c.lookup.logs)) {
+		t.Error("wrong consistent log count", result.ConsistentLogCount)
+	}
+	if result.CheckedRequests != 4 {
+		t.Error("checked", result.CheckedRequests, "requests but expected 4")
+	}
+}
+
+func TestVerifyProcessedLogCount(t *testing.T) {
+	c, arbCore := newVerifyChain(t, 1, 1)
+	logCount := uint64(len(c.lookup.logs))
+
+	// The processed count is saved before the cursor confirms the logs
+	arbCore.cursor = logCount - 2
+	if result := verify(t, c, arbCore); len(result.Problems) != 1 {
+		t.Error("expected only the undelivered block to be reported but got", result.Problems)
+	}
+
+	// Databases from before the count was tracked have it set to 0
+	arbCore.cursor = logCount
+	if err := c.store.UpdateCurrentLogCount(big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	if result := verify(t, c, arbCore); !result.Consistent() {
+		t.Error("unset processed log count reported", result.Problems)
+	}
+
+	if err := c.store.UpdateCurrentLogCount(new(big.Int).SetUint64(logCount - 1)); err != nil {
+		t.Fatal(err)
+	}
+	if result := verify(t, c, arbCore); result.Consistent() {
+		t.Error("processed log count behind cursor not reported")
+	}
+}
+
+func TestVerifyBrokenParentHash(t *testing.T) {
+	c, arbCore := newVerifyChain(t, 1, 1, 1)
+	info, err := c.store.GetBlockInfo(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := types.CopyHeader(info.Header)
+	header.ParentHash = common.Hash{1}
+	broken := &machine.BlockInfo{
+		BlockLog: info.BlockLog,
+		LogCount: info.LogCount,
+		Header:   header,
+	}
+	c.store.blocks[1] = broken
+
+	requireInconsistent(t, verify(t, c, arbCore), 1)
+}
+
+func TestVerifyMisindexedRequest(t *testing.T) {
+	c, arbCore := newVerifyChain(t, 1, 1, 1)
+	res, logIndex := blockRequest(t, c, 1)
+	if res.ResultCode != evm.ReturnCode {
+		t.Fatal("expected successful transaction")
+	}
+	c.store.requests[res.IncomingRequest.MessageID] = logIndex + 1
+
+	requireInconsistent(t, verify(t, c, arbCore), 1)
+}
+
+func TestRepair(t *testing.T) {
+	c, arbCore := newVerifyChain(t, 1, 1, 1)
+	res, _ := blockRequest(t, c, 2)
+	delete(c.store.requests, res.IncomingRequest.MessageID)
+	consistentLogCount := func() uint64 {
+		info, err := c.store.GetBlockInfo(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.BlockLog + 1
+	}()
+
+	result, err := Repair(context.Background(), c.store, arbCore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireInconsistent(t, result, 2)
+	if result.ConsistentLogCount != consistentLogCount {
+		t.Error("expected", consistentLogCount, "consistent logs but got", result.ConsistentLogCount)
+	}
+	if blockCount, _ := c.store.BlockCount(); blockCount != 2 {
+		t.Error("expected store to be reorged to 2 blocks but has", blockCount)
+	}
+	if arbCore.cursor != consistentLogCount {
+		t.Error("logs cursor rewound to", arbCore.cursor, "but expected", consistentLogCount)
+	}
+	if processed, _ := c.store.CurrentLogCount(); processed.Uint64() != consistentLogCount {
+		t.Error("processed log count set to", processed, "but expected", consistentLogCount)
+	}
+
+	// The log reader redelivers the rewound logs, which rebuilds the block
+	db := c.newTxDB()
+	if err := db.AddLogs(new(big.Int).SetUint64(arbCore.cursor), c.lookup.logs[arbCore.cursor:]); err != nil {
+		t.Fatal(err)
+	}
+	arbCore.cursor = uint64(len(c.lookup.logs))
+	if result := verify(t, c, arbCore); !result.Consistent() {
+		t.Error("database inconsistent after rebuilding", result.Problems)
+	}
+}
@@ -26,6 +26,8 @@ import (
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/tracing"
 )
 
 var logger = log.With().Caller().Stack().Str("component", "rpc").Logger()
@@ -49,7 +51,7 @@ func LaunchRPC(ctx context.Context, handler http.Handler, addr, port, path strin
 		return err
 	}
 	for _, route := range rpcRoutes {
-		route.Handler(handler).Methods("GET", "POST", "OPTIONS")
+		route.Handler(tracing.NewHTTPHandler(handler)).Methods("GET", "POST", "OPTIONS")
 	}
 	return launchServer(ctx, r, addr, port, "rpc")
 }
@@ -78,7 +80,7 @@ func LaunchRPCAndWS(ctx context.Context, server *rpc.Server, addr, port, rpcPath
 		return err
 	}
 	for _, route := range rpcRoutes {
-		route.Handler(server).Methods("GET", "POST", "OPTIONS")
+		route.Handler(tracing.NewHTTPHandler(server)).Methods("GET", "POST", "OPTIONS")
 	}
 	wsHandler := server.WebsocketHandler([]string{"*"})
 	for _, route := range wsRoutes {
@@ -25,6 +25,11 @@ import (
 
 type Arb struct {
 	srv *aggregator.Server
+	eth *Server
+}
+
+func NewArb(srv *aggregator.Server, eth *Server) *Arb {
+	return &Arb{srv: srv, eth: eth}
 }
 
 func (a *Arb) GetAggregator() *batcher.AggregatorInfo {
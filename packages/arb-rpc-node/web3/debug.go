@@ -0,0 +1,198 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/profiler"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+type TransactionLookup interface {
+	GetRequest(requestId arbcommon.Hash) (*evm.TxResult, error)
+	GetSnapshot(ctx context.Context, blockHeight uint64) (*snapshot.Snapshot, error)
+	GetBlock(height uint64) (*machine.BlockInfo, error)
+	GetBlockResults(block *machine.BlockInfo) (*evm.BlockInfo, []*evm.TxResult, error)
+}
+
+type Debug struct {
+	lookup TransactionLookup
+}
+
+func NewDebug(lookup TransactionLookup) *Debug {
+	return &Debug{lookup: lookup}
+}
+
+func (d *Debug) ProfileTransaction(ctx context.Context, txHash common.Hash, opts *ProfileOptions) (*ProfileResult, error) {
+	config := profiler.DefaultConfig()
+	folded := false
+	if opts != nil {
+		if opts.SampleGas != nil {
+			config.SampleGas = uint64(*opts.SampleGas)
+		}
+		folded = opts.Folded
+	}
+	prof, err := ProfileTransaction(ctx, d.lookup, arbcommon.NewHashFromEth(txHash), config)
+	if err != nil {
+		return nil, err
+	}
+	return NewProfileResult(txHash, prof, folded)
+}
+
+// ProfileTransaction replays a transaction on top of the state it originally
+// executed on and profiles it
+func ProfileTransaction(ctx context.Context, lookup TransactionLookup, txHash arbcommon.Hash, config profiler.Config) (*profiler.Profile, error) {
+	snap, res, err := replaySnapshot(ctx, lookup, txHash)
+	if err != nil {
+		return nil, err
+	}
+	return snap.ProfileRequest(res.IncomingRequest, config)
+}
+
+// replaySnapshot loads the result of a transaction along with the state it
+// executed on, which is the state at the end of the previous block with every
+// earlier transaction in the same block applied
+func replaySnapshot(ctx context.Context, lookup TransactionLookup, txHash arbcommon.Hash) (*snapshot.Snapshot, *evm.TxResult, error) {
+	res, err := lookup.GetRequest(txHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res == nil {
+		return nil, nil, errors.New("transaction not found")
+	}
+	blockNum := res.IncomingRequest.L2BlockNumber.Uint64()
+	if blockNum == 0 {
+		return nil, nil, errors.New("can't replay transaction in genesis block")
+	}
+	snap, err := lookup.GetSnapshot(ctx, blockNum-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snap == nil {
+		return nil, nil, errors.Errorf("state for block %v not available", blockNum-1)
+	}
+	block, err := lookup.GetBlock(blockNum)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block == nil {
+		return nil, nil, errors.Errorf("block %v not found", blockNum)
+	}
+	_, results, err := lookup.GetBlockResults(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Requests created while executing an earlier request in the block, such
+	// as retryable redemptions, are replayed along with it. Transactions from
+	// a batch have the batch as their parent, but it doesn't have a result.
+	requests := make(map[arbcommon.Hash]bool, len(results))
+	for _, earlier := range results {
+		requestId := earlier.IncomingRequest.MessageID
+		createdByRequest := requests[earlier.IncomingRequest.Provenance.ParentRequestId]
+		if requestId == txHash {
+			if createdByRequest {
+				return nil, nil, errors.Errorf(
+					"transaction %v was created by %v and can't be replayed on its own",
+					txHash,
+					earlier.IncomingRequest.Provenance.ParentRequestId,
+				)
+			}
+			return snap, res, nil
+		}
+		requests[requestId] = true
+		if createdByRequest {
+			continue
+		}
+		snap, _, _, err = snap.ReplayRequest(earlier.IncomingRequest)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to replay transaction %v earlier in block %v", requestId, blockNum)
+		}
+	}
+	return nil, nil, errors.Errorf("transaction not found in block %v", blockNum)
+}
+
+func NewProfileResult(txHash common.Hash, prof *profiler.Profile, folded bool) (*ProfileResult, error) {
+	contracts := prof.Contracts()
+	contractResults := make([]*ContractProfileResult, 0, len(contracts))
+	for _, usage := range contracts {
+		contractResults = append(contractResults, &ContractProfileResult{
+			Contract: usage.Contract.ToEthAddress(),
+			Frames:   hexutil.Uint64(usage.Count),
+			SelfGas:  (*hexutil.Big)(usage.SelfGas),
+			ArbGas:   hexutil.Uint64(usage.ArbGas),
+			Steps:    hexutil.Uint64(usage.Steps),
+		})
+	}
+
+	opcodes := prof.OpcodesByGas()
+	opcodeResults := make([]*OpcodeProfileResult, 0, len(opcodes))
+	for _, usage := range opcodes {
+		opcodeResults = append(opcodeResults, &OpcodeProfileResult{
+			Op:     usage.Op.String(),
+			Count:  hexutil.Uint64(usage.Count),
+			ArbGas: hexutil.Uint64(usage.ArbGas),
+			Steps:  hexutil.Uint64(usage.Steps),
+		})
+	}
+
+	result := &ProfileResult{
+		TransactionHash: txHash,
+		ArbGas:          hexutil.Uint64(prof.ArbGas),
+		Steps:           hexutil.Uint64(prof.Steps),
+		ArbOSArbGas:     hexutil.Uint64(prof.ArbOS.ArbGas),
+		ArbOSSteps:      hexutil.Uint64(prof.ArbOS.Steps),
+		Contracts:       contractResults,
+		Opcodes:         opcodeResults,
+	}
+	if prof.Root != nil {
+		result.CallFrame = newCallFrameProfileResult(prof.Root)
+	}
+	if folded {
+		var builder strings.Builder
+		if err := prof.WriteFolded(&builder); err != nil {
+			return nil, err
+		}
+		foldedStr := builder.String()
+		result.Folded = &foldedStr
+	}
+	return result, nil
+}
+
+func newCallFrameProfileResult(frame *profiler.Frame) *CallFrameProfileResult {
+	calls := make([]*CallFrameProfileResult, 0, len(frame.Children))
+	for _, child := range frame.Children {
+		calls = append(calls, newCallFrameProfileResult(child))
+	}
+	return &CallFrameProfileResult{
+		Type:     frame.Type,
+		Contract: frame.Contract.ToEthAddress(),
+		GasUsed:  (*hexutil.Big)(frame.GasUsed),
+		SelfGas:  (*hexutil.Big)(frame.SelfGas),
+		ArbGas:   hexutil.Uint64(frame.ArbGas),
+		Steps:    hexutil.Uint64(frame.Steps),
+		Calls:    calls,
+	}
+}
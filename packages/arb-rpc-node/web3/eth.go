@@ -93,8 +93,8 @@ func (s *Server) BlockNumber() (hexutil.Uint64, error) {
 	return hexutil.Uint64(blockCount - 1), nil
 }
 
-func (s *Server) GetBalance(address *common.Address, blockNum rpc.BlockNumberOrHash) (*hexutil.Big, error) {
-	snap, err := s.getSnapshotForNumberOrHash(blockNum)
+func (s *Server) GetBalance(ctx context.Context, address *common.Address, blockNum rpc.BlockNumberOrHash) (*hexutil.Big, error) {
+	snap, err := s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -105,8 +105,8 @@ func (s *Server) GetBalance(address *common.Address, blockNum rpc.BlockNumberOrH
 	return (*hexutil.Big)(balance), nil
 }
 
-func (s *Server) GetStorageAt(address *common.Address, key string, blockNum rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
-	snap, err := s.getSnapshotForNumberOrHash(blockNum)
+func (s *Server) GetStorageAt(ctx context.Context, address *common.Address, key string, blockNum rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	snap, err := s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +135,7 @@ func (s *Server) getTransactionCountInner(ctx context.Context, address *common.A
 		return 0, errors.New("only pending transaction count supported in forwarder only mode")
 	}
 
-	snap, err := s.getSnapshotForNumberOrHash(blockNum)
+	snap, err := s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
 		return 0, err
 	}
@@ -167,12 +167,12 @@ func (s *Server) GetBlockTransactionCountByNumber(blockNum *rpc.BlockNumber) (*h
 	return s.getBlockTransactionCount(info)
 }
 
-func (s *Server) GetCode(address *common.Address, blockNum rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+func (s *Server) GetCode(ctx context.Context, address *common.Address, blockNum rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
 	if *address == arbos.ARB_NODE_INTERFACE_ADDRESS {
 		// Fake code to make the contract appear real
 		return hexutil.Bytes{1}, nil
 	}
-	snap, err := s.getSnapshotForNumberOrHash(blockNum)
+	snap, err := s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
 		return nil, err
 	}
@@ -183,26 +183,31 @@ func (s *Server) GetCode(address *common.Address, blockNum rpc.BlockNumberOrHash
 	return code, nil
 }
 
-func (s *Server) Call(callArgs CallTxArgs, blockNum rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+func (s *Server) Call(ctx context.Context, callArgs CallTxArgs, blockNum rpc.BlockNumberOrHash, overrides *StateOverride) (hexutil.Bytes, error) {
 	if callArgs.To != nil && *callArgs.To == arbos.ARB_NODE_INTERFACE_ADDRESS {
 		var data []byte
 		if callArgs.Data != nil {
 			data = *callArgs.Data
 		}
-		return HandleNodeInterfaceCall(s, data, blockNum)
+		return HandleNodeInterfaceCall(ctx, s, data, blockNum)
 	}
 
-	snap, err := s.getSnapshotForNumberOrHash(blockNum)
+	snap, err := s.getSnapshotForNumberOrHash(ctx, blockNum)
 	if err != nil {
 		return nil, err
 	}
-	if snap.ArbosVersion() >= 42 && (callArgs.GasPrice == nil || callArgs.GasPrice.ToInt().Sign() <= 0) {
-		callArgs.GasPrice = (*hexutil.Big)(big.NewInt(1 << 60))
+	snap, err = applyStateOverride(snap, overrides)
+	if err != nil {
+		return nil, err
 	}
+	setDefaultCallGasPrice(snap, &callArgs)
 
 	from, msg := buildCallMsg(callArgs, s.maxCallGas)
 
 	res, _, err := snap.Call(msg, from)
+	if err != nil {
+		return nil, err
+	}
 
 	if res.ResultCode != evm.ReturnCode {
 		return nil, evm.HandleCallError(res, s.ganacheMode)
@@ -210,19 +215,24 @@ func (s *Server) Call(callArgs CallTxArgs, blockNum rpc.BlockNumberOrHash) (hexu
 	return res.ReturnData, nil
 }
 
-func (s *Server) EstimateGas(args CallTxArgs) (hexutil.Uint64, error) {
+func (s *Server) EstimateGas(ctx context.Context, args CallTxArgs, blockNum *rpc.BlockNumberOrHash, overrides *StateOverride) (hexutil.Uint64, error) {
 	if args.To != nil && *args.To == arbos.ARB_NODE_INTERFACE_ADDRESS {
 		// Fake gas for call
 		return hexutil.Uint64(21000), nil
 	}
-	blockNum := rpc.PendingBlockNumber
-	snap, err := s.getSnapshot(&blockNum)
+	if blockNum == nil {
+		pending := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+		blockNum = &pending
+	}
+	snap, err := s.getSnapshotForNumberOrHash(ctx, *blockNum)
 	if err != nil {
 		return 0, err
 	}
-	if snap.ArbosVersion() >= 42 && (args.GasPrice == nil || args.GasPrice.ToInt().Sign() <= 0) {
-		args.GasPrice = (*hexutil.Big)(big.NewInt(1 << 60))
+	snap, err = applyStateOverride(snap, overrides)
+	if err != nil {
+		return 0, err
 	}
+	setDefaultCallGasPrice(snap, &args)
 	from, tx := buildTransactionForEstimation(args)
 	var agg arbcommon.Address
 	if args.Aggregator != nil {
@@ -587,7 +597,7 @@ func buildCallMsg(args CallTxArgs, maxGas uint64) (arbcommon.Address, message.Co
 	}
 }
 
-func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, error) {
+func (s *Server) getSnapshot(ctx context.Context, blockNum *rpc.BlockNumber) (*snapshot.Snapshot, error) {
 	if blockNum == nil || *blockNum == rpc.PendingBlockNumber {
 		pending, err := s.srv.PendingSnapshot()
 		if err != nil {
@@ -612,7 +622,7 @@ func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, err
 		return snap, nil
 	}
 
-	snap, err := s.srv.GetSnapshot(uint64(*blockNum))
+	snap, err := s.srv.GetSnapshot(ctx, uint64(*blockNum))
 	if err != nil {
 		return nil, err
 	}
@@ -622,9 +632,9 @@ func (s *Server) getSnapshot(blockNum *rpc.BlockNumber) (*snapshot.Snapshot, err
 	return snap, nil
 }
 
-func (s *Server) getSnapshotForNumberOrHash(blockNum rpc.BlockNumberOrHash) (*snapshot.Snapshot, error) {
+func (s *Server) getSnapshotForNumberOrHash(ctx context.Context, blockNum rpc.BlockNumberOrHash) (*snapshot.Snapshot, error) {
 	if blockNum.BlockNumber != nil {
-		return s.getSnapshot(blockNum.BlockNumber)
+		return s.getSnapshot(ctx, blockNum.BlockNumber)
 	}
 	if blockNum.BlockHash == nil {
 		return nil, errors.New("must specify block number or hash")
@@ -639,7 +649,7 @@ func (s *Server) getSnapshotForNumberOrHash(blockNum rpc.BlockNumberOrHash) (*sn
 		return nil, errors.New("block with hash not found")
 	}
 
-	snap, err := s.srv.GetSnapshot(info.Header.Number.Uint64())
+	snap, err := s.srv.GetSnapshot(ctx, info.Header.Number.Uint64())
 	if err != nil {
 		return nil, err
 	}
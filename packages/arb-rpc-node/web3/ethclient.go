@@ -45,19 +45,19 @@ func blockNum(blockNumber *big.Int) rpc.BlockNumberOrHash {
 	return rpc.BlockNumberOrHash{BlockNumber: blockNum}
 }
 
-func (c *EthClient) BalanceAt(_ context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
-	bal, err := c.srv.GetBalance(&account, blockNum(blockNumber))
+func (c *EthClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	bal, err := c.srv.GetBalance(ctx, &account, blockNum(blockNumber))
 	if err != nil {
 		return nil, err
 	}
 	return bal.ToInt(), nil
 }
 
-func (c *EthClient) CodeAt(_ context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
-	return c.srv.GetCode(&contract, blockNum(blockNumber))
+func (c *EthClient) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return c.srv.GetCode(ctx, &contract, blockNum(blockNumber))
 }
 
-func (c *EthClient) CallContract(_ context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+func (c *EthClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
 	args := CallTxArgs{
 		From:     &call.From,
 		To:       call.To,
@@ -66,13 +66,13 @@ func (c *EthClient) CallContract(_ context.Context, call ethereum.CallMsg, block
 		Value:    (*hexutil.Big)(call.Value),
 		Data:     (*hexutil.Bytes)(&call.Data),
 	}
-	return c.srv.Call(args, blockNum(blockNumber))
+	return c.srv.Call(ctx, args, blockNum(blockNumber), nil)
 }
 
-func (c *EthClient) PendingCodeAt(_ context.Context, account common.Address) ([]byte, error) {
+func (c *EthClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
 	pending := rpc.PendingBlockNumber
 	block := rpc.BlockNumberOrHash{BlockNumber: &pending}
-	return c.srv.GetCode(&account, block)
+	return c.srv.GetCode(ctx, &account, block)
 }
 
 // Treats a null blockNumber as the latest block, not pending
@@ -113,7 +113,7 @@ func (c *EthClient) ChainID(_ context.Context) (*big.Int, error) {
 	return c.srv.srv.ChainId(), nil
 }
 
-func (c *EthClient) EstimateGas(_ context.Context, call ethereum.CallMsg) (uint64, error) {
+func (c *EthClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
 	args := CallTxArgs{
 		From:     &call.From,
 		To:       call.To,
@@ -122,7 +122,7 @@ func (c *EthClient) EstimateGas(_ context.Context, call ethereum.CallMsg) (uint6
 		Value:    (*hexutil.Big)(call.Value),
 		Data:     (*hexutil.Bytes)(&call.Data),
 	}
-	gas, err := c.srv.EstimateGas(args)
+	gas, err := c.srv.EstimateGas(ctx, args, nil, nil)
 	if err != nil {
 		return 0, err
 	}
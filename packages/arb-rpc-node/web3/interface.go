@@ -100,3 +100,100 @@ type TransactionResult struct {
 	ArbSubType      *hexutil.Uint64 `json:"arbSubType"`
 	L1BlockNumber   *hexutil.Big    `json:"l1BlockNumber"`
 }
+
+type ProfileOptions struct {
+	SampleGas *hexutil.Uint64 `json:"sampleGas"`
+	Folded    bool            `json:"folded"`
+}
+
+type ContractProfileResult struct {
+	Contract common.Address `json:"contract"`
+	Frames   hexutil.Uint64 `json:"frames"`
+	SelfGas  *hexutil.Big   `json:"selfGas"`
+	ArbGas   hexutil.Uint64 `json:"arbGas"`
+	Steps    hexutil.Uint64 `json:"steps"`
+}
+
+type OpcodeProfileResult struct {
+	Op     string         `json:"op"`
+	Count  hexutil.Uint64 `json:"count"`
+	ArbGas hexutil.Uint64 `json:"arbGas"`
+	Steps  hexutil.Uint64 `json:"steps"`
+}
+
+type CallFrameProfileResult struct {
+	Type     string                    `json:"type"`
+	Contract common.Address            `json:"contract"`
+	GasUsed  *hexutil.Big              `json:"gasUsed"`
+	SelfGas  *hexutil.Big              `json:"selfGas"`
+	ArbGas   hexutil.Uint64            `json:"arbGas"`
+	Steps    hexutil.Uint64            `json:"steps"`
+	Calls    []*CallFrameProfileResult `json:"calls,omitempty"`
+}
+
+type ProfileResult struct {
+	TransactionHash common.Hash              `json:"transactionHash"`
+	ArbGas          hexutil.Uint64           `json:"arbGas"`
+	Steps           hexutil.Uint64           `json:"steps"`
+	ArbOSArbGas     hexutil.Uint64           `json:"arbosArbGas"`
+	ArbOSSteps      hexutil.Uint64           `json:"arbosSteps"`
+	Contracts       []*ContractProfileResult `json:"contracts"`
+	Opcodes         []*OpcodeProfileResult   `json:"opcodes"`
+	CallFrame       *CallFrameProfileResult  `json:"callFrame"`
+	Folded          *string                  `json:"folded,omitempty"`
+}
+
+type StateDiffOptions struct {
+	// StorageKeys lists extra storage slots to compare for each account in
+	// addition to the slots set before or after the transaction
+	StorageKeys map[common.Address][]common.Hash `json:"storageKeys"`
+}
+
+type FromToResult struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AccountDiffResult uses the Parity/OpenEthereum encoding where each field is
+// "=" if unchanged, {"+": new} if created, {"-": old} if removed and
+// {"*": {"from": old, "to": new}} if modified
+type AccountDiffResult struct {
+	Balance interface{}                 `json:"balance"`
+	Nonce   interface{}                 `json:"nonce"`
+	Code    interface{}                 `json:"code"`
+	Storage map[common.Hash]interface{} `json:"storage"`
+}
+
+type TraceReplayResult struct {
+	Output    hexutil.Bytes                         `json:"output"`
+	StateDiff map[common.Address]*AccountDiffResult `json:"stateDiff"`
+	Trace     []interface{}                         `json:"trace"`
+	VmTrace   interface{}                           `json:"vmTrace"`
+}
+
+// OverrideAccount follows the geth eth_call state override format
+type OverrideAccount struct {
+	Nonce     *hexutil.Uint64              `json:"nonce"`
+	Code      *hexutil.Bytes               `json:"code"`
+	Balance   **hexutil.Big                `json:"balance"`
+	State     *map[common.Hash]common.Hash `json:"state"`
+	StateDiff *map[common.Hash]common.Hash `json:"stateDiff"`
+}
+
+type StateOverride map[common.Address]OverrideAccount
+
+// BundleCall is either an unsigned call, in which case it has the same
+// fields as eth_call, or a signed raw transaction
+type BundleCall struct {
+	CallTxArgs
+	RawTransaction *hexutil.Bytes `json:"rawTransaction"`
+}
+
+type BundleCallResult struct {
+	TransactionHash *common.Hash   `json:"transactionHash,omitempty"`
+	Status          hexutil.Uint64 `json:"status"`
+	ReturnData      hexutil.Bytes  `json:"returnData"`
+	GasUsed         *hexutil.Big   `json:"gasUsed"`
+	Logs            []*types.Log   `json:"logs"`
+	Error           *string        `json:"error,omitempty"`
+}
@@ -58,7 +58,7 @@ func GenerateWeb3Server(server *aggregator.Server, privateKeys []*ecdsa.PrivateK
 			return nil, err
 		}
 
-		if err := s.RegisterName("arb", &Arb{srv: server}); err != nil {
+		if err := s.RegisterName("arb", NewArb(server, ethServer)); err != nil {
 			return nil, err
 		}
 
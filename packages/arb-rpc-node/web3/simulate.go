@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/evm"
+	"github.com/offchainlabs/arbitrum/packages/arb-evm/message"
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/snapshot"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func setDefaultCallGasPrice(snap *snapshot.Snapshot, args *CallTxArgs) {
+	if snap.ArbosVersion() >= 42 && (args.GasPrice == nil || args.GasPrice.ToInt().Sign() <= 0) {
+		args.GasPrice = (*hexutil.Big)(big.NewInt(1 << 60))
+	}
+}
+
+func convertStorage(storage map[common.Hash]common.Hash) map[arbcommon.Hash]arbcommon.Hash {
+	converted := make(map[arbcommon.Hash]arbcommon.Hash, len(storage))
+	for key, val := range storage {
+		converted[arbcommon.NewHashFromEth(key)] = arbcommon.NewHashFromEth(val)
+	}
+	return converted
+}
+
+func applyStateOverride(snap *snapshot.Snapshot, overrides *StateOverride) (*snapshot.Snapshot, error) {
+	if overrides == nil || len(*overrides) == 0 {
+		return snap, nil
+	}
+	accounts := make(map[arbcommon.Address]snapshot.AccountOverride, len(*overrides))
+	for account, override := range *overrides {
+		var converted snapshot.AccountOverride
+		if override.Balance != nil && *override.Balance != nil {
+			converted.Balance = (*override.Balance).ToInt()
+		}
+		if override.Nonce != nil {
+			converted.Nonce = new(big.Int).SetUint64(uint64(*override.Nonce))
+		}
+		if override.Code != nil {
+			code := []byte(*override.Code)
+			converted.Code = &code
+		}
+		if override.State != nil {
+			converted.State = convertStorage(*override.State)
+		}
+		if override.StateDiff != nil {
+			converted.StateDiff = convertStorage(*override.StateDiff)
+		}
+		accounts[arbcommon.NewAddressFromEth(account)] = converted
+	}
+	return snap.WithOverrides(accounts)
+}
+
+// SimulateBundle executes calls in order on top of a single copy of the state
+// at blockNum, so each call sees the effects of the ones before it. Calls
+// that revert still consume their nonce and fees like a real transaction.
+func (a *Arb) SimulateBundle(ctx context.Context, calls []BundleCall, blockNum *rpc.BlockNumberOrHash, overrides *StateOverride) ([]*BundleCallResult, error) {
+	if blockNum == nil {
+		pending := rpc.BlockNumberOrHashWithNumber(rpc.PendingBlockNumber)
+		blockNum = &pending
+	}
+	snap, err := a.eth.getSnapshotForNumberOrHash(ctx, *blockNum)
+	if err != nil {
+		return nil, err
+	}
+	snap, err = applyStateOverride(snap, overrides)
+	if err != nil {
+		return nil, err
+	}
+	// AddMessage updates the snapshot in place so make sure we don't modify
+	// one that is shared with the cache
+	snap = snap.Clone()
+
+	signer := types.NewEIP155Signer(a.srv.ChainId())
+	results := make([]*BundleCallResult, 0, len(calls))
+	for i, call := range calls {
+		var res *evm.TxResult
+		var txHash *common.Hash
+		if call.RawTransaction != nil {
+			tx := new(types.Transaction)
+			if err := rlp.DecodeBytes(*call.RawTransaction, tx); err != nil {
+				return nil, errors.Wrapf(err, "error decoding transaction %v", i)
+			}
+			sender, err := types.Sender(signer, tx)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error recovering sender of transaction %v", i)
+			}
+			msg, err := message.NewL2Message(message.SignedTransaction{Tx: tx})
+			if err != nil {
+				return nil, err
+			}
+			res, err = snap.AddMessage(msg, arbcommon.NewAddressFromEth(sender), arbcommon.NewHashFromEth(tx.Hash()))
+			if err != nil {
+				return nil, errors.Wrapf(err, "error executing transaction %v", i)
+			}
+			hash := tx.Hash()
+			txHash = &hash
+		} else {
+			args := call.CallTxArgs
+			setDefaultCallGasPrice(snap, &args)
+			from, msg := buildCallMsg(args, a.eth.maxCallGas)
+			var next *snapshot.Snapshot
+			next, res, _, err = snap.Apply(msg, from)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error executing call %v", i)
+			}
+			snap = next
+		}
+		results = append(results, newBundleCallResult(res, txHash, a.eth.ganacheMode))
+	}
+	return results, nil
+}
+
+func newBundleCallResult(res *evm.TxResult, txHash *common.Hash, ganacheMode bool) *BundleCallResult {
+	result := &BundleCallResult{
+		TransactionHash: txHash,
+		ReturnData:      res.ReturnData,
+		GasUsed:         (*hexutil.Big)(res.GasUsed),
+		Logs:            res.EthLogs(arbcommon.Hash{}),
+	}
+	if res.ResultCode == evm.ReturnCode {
+		result.Status = 1
+	} else {
+		errMsg := evm.HandleCallError(res, ganacheMode).Error()
+		result.Error = &errMsg
+	}
+	return result
+}
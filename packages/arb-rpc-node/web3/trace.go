@@ -0,0 +1,132 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package web3
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-rpc-node/statediff"
+	arbcommon "github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+const stateDiffTraceType = "stateDiff"
+
+type Trace struct {
+	lookup TransactionLookup
+}
+
+func NewTrace(lookup TransactionLookup) *Trace {
+	return &Trace{lookup: lookup}
+}
+
+// ReplayTransaction replays a transaction in the same way as
+// debug_profileTransaction and reports the requested traces. Only stateDiff
+// is supported.
+func (t *Trace) ReplayTransaction(ctx context.Context, txHash common.Hash, traceTypes []string, opts *StateDiffOptions) (*TraceReplayResult, error) {
+	includeStateDiff := false
+	for _, traceType := range traceTypes {
+		if traceType != stateDiffTraceType {
+			return nil, errors.Errorf("unsupported trace type %v", traceType)
+		}
+		includeStateDiff = true
+	}
+
+	snap, res, err := replaySnapshot(ctx, t.lookup, arbcommon.NewHashFromEth(txHash))
+	if err != nil {
+		return nil, err
+	}
+	after, replayed, debugPrints, err := snap.ReplayRequest(res.IncomingRequest)
+	if err != nil {
+		return nil, err
+	}
+	result := &TraceReplayResult{Output: replayed.ReturnData}
+	if !includeStateDiff {
+		return result, nil
+	}
+
+	accounts, err := statediff.TouchedAccounts(res.IncomingRequest.Sender, debugPrints)
+	if err != nil {
+		return nil, err
+	}
+	storageKeys, err := statediff.StorageKeys(snap, after, accounts)
+	if err != nil {
+		return nil, err
+	}
+	if opts != nil {
+		for account, keys := range opts.StorageKeys {
+			arbAccount := arbcommon.NewAddressFromEth(account)
+			for _, key := range keys {
+				storageKeys[arbAccount] = append(storageKeys[arbAccount], arbcommon.NewHashFromEth(key))
+			}
+		}
+	}
+	diffs, err := statediff.Compute(snap, after, accounts, storageKeys)
+	if err != nil {
+		return nil, err
+	}
+	result.StateDiff = make(map[common.Address]*AccountDiffResult, len(diffs))
+	for account, diff := range diffs {
+		result.StateDiff[account.ToEthAddress()] = newAccountDiffResult(diff)
+	}
+	return result, nil
+}
+
+func newAccountDiffResult(diff *statediff.AccountDiff) *AccountDiffResult {
+	encodeBig := func(delta *statediff.BigDelta) interface{} {
+		if delta == nil {
+			if diff.Born || diff.Died {
+				// Unchanged zero value on a created or removed account
+				delta = &statediff.BigDelta{From: big.NewInt(0), To: big.NewInt(0)}
+			} else {
+				return "="
+			}
+		}
+		return encodeDiff(diff, (*hexutil.Big)(delta.From), (*hexutil.Big)(delta.To))
+	}
+	var codeResult interface{} = "="
+	if diff.Code != nil {
+		codeResult = encodeDiff(diff, hexutil.Bytes(diff.Code.From), hexutil.Bytes(diff.Code.To))
+	} else if diff.Born || diff.Died {
+		codeResult = encodeDiff(diff, hexutil.Bytes{}, hexutil.Bytes{})
+	}
+	storage := make(map[common.Hash]interface{}, len(diff.Storage))
+	for key, delta := range diff.Storage {
+		storage[key.ToEthHash()] = encodeDiff(diff, (*hexutil.Big)(delta.From), (*hexutil.Big)(delta.To))
+	}
+	return &AccountDiffResult{
+		Balance: encodeBig(diff.Balance),
+		Nonce:   encodeBig(diff.Nonce),
+		Code:    codeResult,
+		Storage: storage,
+	}
+}
+
+func encodeDiff(diff *statediff.AccountDiff, from, to interface{}) interface{} {
+	switch {
+	case diff.Born:
+		return map[string]interface{}{"+": to}
+	case diff.Died:
+		return map[string]interface{}{"-": from}
+	default:
+		return map[string]interface{}{"*": FromToResult{From: from, To: to}}
+	}
+}
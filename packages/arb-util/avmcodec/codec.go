@@ -0,0 +1,761 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package avmcodec converts between AVM values and Go structs.
+//
+// Each struct field that is part of the value is tagged with its position in
+// the struct's tuple, for example `avm:"2"`. Dotted positions such as
+// `avm:"2.1"` place a field inside a nested tuple, so a flat struct can
+// describe a tuple of tuples. Every position of every tuple must be filled,
+// and fields named _ fill positions whose contents are ignored.
+//
+// Fields are converted based on their type:
+//   - *big.Int and integer types are ints. Decoding into a fixed size integer
+//     keeps only the low bits of the value, and signed integers are encoded
+//     as their 64 bit two's complement.
+//   - bool is an int that must be 0 or 1
+//   - common.Address and common.Hash are ints
+//   - []byte is a byte array, a 2-tuple of its size and a buffer
+//   - other slices are stacks, nested 2-tuples ending in an empty tuple
+//   - structs are tuples, described by their own tags
+//   - pointers are their element, allocated while decoding
+//   - value.Value holds the raw value
+//
+// Options following the position change how a field is converted:
+//   - optional: the field is an AVM option, decoding to nil when empty
+//   - trailing: the field may be missing from the end of the tuple, in which
+//     case it's left as the zero value
+//   - sized: a []byte stored as its size followed by its buffer in the next
+//     position of the same tuple
+//   - rest: a slice holding every remaining position of the tuple
+//   - nilzero: a pointer that's nil when the value is zero
+//   - const=N: on a _ field, the value must be the int N
+//
+// Types with irregular layouts implement Unmarshaler and Marshaler.
+package avmcodec
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// Unmarshaler is implemented by types that decode themselves from a value
+type Unmarshaler interface {
+	UnmarshalAVM(val value.Value) error
+}
+
+// Marshaler is implemented by types that encode themselves as a value
+type Marshaler interface {
+	MarshalAVM() (value.Value, error)
+}
+
+// DecodeError describes which part of a value couldn't be decoded. Path starts
+// with the name of the type being decoded, followed by .Field for struct
+// fields, [i] for slice elements and {i} for positions in nested tuples.
+type DecodeError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding %v: %v", e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	bigIntType      = reflect.TypeOf((*big.Int)(nil))
+	addressType     = reflect.TypeOf(common.Address{})
+	hashType        = reflect.TypeOf(common.Hash{})
+	bytesType       = reflect.TypeOf([]byte(nil))
+	valueType       = reflect.TypeOf((*value.Value)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+)
+
+// Unmarshal decodes val into the value pointed to by v
+func Unmarshal(val value.Value, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("avmcodec: can't unmarshal into %T", v)
+	}
+	return decodeValue(val, rv.Elem(), typeName(rv.Type().Elem()), fieldOptions{})
+}
+
+// Marshal encodes v as a value
+func Marshal(v interface{}) (value.Value, error) {
+	return encodeValue(reflect.ValueOf(v), typeName(reflect.TypeOf(v)), fieldOptions{})
+}
+
+func typeName(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		return "value"
+	}
+	return t.Name()
+}
+
+func describeValue(val value.Value) string {
+	switch val := val.(type) {
+	case value.IntValue:
+		return "int"
+	case *value.TupleValue:
+		return fmt.Sprintf("tuple of length %v", val.Len())
+	case *value.Buffer:
+		return "buffer"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+func newDecodeError(path string, format string, args ...interface{}) error {
+	return &DecodeError{Path: path, Err: errors.Errorf(format, args...)}
+}
+
+// wrapDecodeError attributes an error from an Unmarshaler to path. Paths
+// inside the error are joined onto path in place of their type name.
+func wrapDecodeError(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if decodeErr, ok := err.(*DecodeError); ok {
+		rootLen := strings.IndexAny(decodeErr.Path, ".[{")
+		if rootLen < 0 {
+			rootLen = len(decodeErr.Path)
+		}
+		return &DecodeError{Path: path + decodeErr.Path[rootLen:], Err: decodeErr.Err}
+	}
+	return &DecodeError{Path: path, Err: err}
+}
+
+func intFromValue(val value.Value, path string) (value.IntValue, error) {
+	intVal, ok := val.(value.IntValue)
+	if !ok {
+		return value.IntValue{}, newDecodeError(path, "expected int but got %v", describeValue(val))
+	}
+	return intVal, nil
+}
+
+// optionalContents returns the value held by an AVM option, or nil if it's
+// empty
+func optionalContents(val value.Value, path string) (value.Value, error) {
+	tup, ok := val.(*value.TupleValue)
+	if !ok || tup.Len() == 0 {
+		return nil, newDecodeError(path, "expected option but got %v", describeValue(val))
+	}
+	contents := tup.Contents()
+	hasValue, err := intFromValue(contents[0], path+"{0}")
+	if err != nil {
+		return nil, err
+	}
+	switch hasValue.BigInt().Uint64() {
+	case 0:
+		if tup.Len() != 1 {
+			return nil, newDecodeError(path, "expected empty option to be tuple of length 1 but got length %v", tup.Len())
+		}
+		return nil, nil
+	case 1:
+		if tup.Len() != 2 {
+			return nil, newDecodeError(path, "expected option with value to be tuple of length 2 but got length %v", tup.Len())
+		}
+		return contents[1], nil
+	default:
+		return nil, newDecodeError(path, "unknown option code %v", hasValue)
+	}
+}
+
+func decodeValue(val value.Value, rv reflect.Value, path string, opts fieldOptions) error {
+	if opts.optional {
+		contents, err := optionalContents(val, path)
+		if err != nil {
+			return err
+		}
+		if contents == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		val = contents
+		opts.optional = false
+	}
+
+	if rv.Kind() == reflect.Ptr && rv.Type() != bigIntType {
+		elem := reflect.New(rv.Type().Elem())
+		nilZero := opts.nilZero
+		opts.nilZero = false
+		if err := decodeValue(val, elem.Elem(), path, opts); err != nil {
+			return err
+		}
+		if nilZero && elem.Elem().IsZero() {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(elem)
+		}
+		return nil
+	}
+
+	if reflect.PtrTo(rv.Type()).Implements(unmarshalerType) {
+		return wrapDecodeError(path, rv.Addr().Interface().(Unmarshaler).UnmarshalAVM(val))
+	}
+
+	switch rv.Type() {
+	case valueType:
+		rv.Set(reflect.ValueOf(&val).Elem())
+		return nil
+	case bigIntType:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(intVal.BigInt()))
+		return nil
+	case addressType:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(inbox.NewAddressFromInt(intVal)))
+		return nil
+	case hashType:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(common.Hash(intVal.ToBytes())))
+		return nil
+	case bytesType:
+		data, err := inbox.ByteArrayToBytes(val)
+		if err != nil {
+			return &DecodeError{Path: path, Err: err}
+		}
+		rv.SetBytes(data)
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		if !intVal.BigInt().IsUint64() || intVal.BigInt().Uint64() > 1 {
+			return newDecodeError(path, "expected bool to be 0 or 1 but got %v", intVal)
+		}
+		rv.SetBool(intVal.BigInt().Uint64() == 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		rv.SetUint(intVal.BigInt().Uint64())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intVal, err := intFromValue(val, path)
+		if err != nil {
+			return err
+		}
+		rv.SetInt(int64(intVal.BigInt().Uint64()))
+	case reflect.Slice:
+		items, err := inbox.StackValueToList(val)
+		if err != nil {
+			return newDecodeError(path, "expected stack but got %v", describeValue(val))
+		}
+		return decodeSlice(items, rv, path)
+	case reflect.Struct:
+		plan, err := planForType(rv.Type())
+		if err != nil {
+			return err
+		}
+		return decodeTuple(val, rv, plan, path, path)
+	default:
+		return errors.Errorf("avmcodec: can't decode %v into %v", path, rv.Type())
+	}
+	return nil
+}
+
+func decodeSlice(items []value.Value, rv reflect.Value, path string) error {
+	slice := reflect.MakeSlice(rv.Type(), len(items), len(items))
+	for i, item := range items {
+		if err := decodeValue(item, slice.Index(i), fmt.Sprintf("%v[%v]", path, i), fieldOptions{}); err != nil {
+			return err
+		}
+	}
+	rv.Set(slice)
+	return nil
+}
+
+// decodeTuple fills the fields of the struct rv found in the tuple described
+// by plan. structPath names the struct and tuplePath the tuple itself.
+func decodeTuple(val value.Value, rv reflect.Value, plan *tuplePlan, structPath string, tuplePath string) error {
+	tup, ok := val.(*value.TupleValue)
+	if !ok {
+		return newDecodeError(tuplePath, "expected tuple but got %v", describeValue(val))
+	}
+	if tup.Len() < int64(plan.minLen) || tup.Len() > int64(plan.maxLen) {
+		if plan.minLen == plan.maxLen {
+			return newDecodeError(tuplePath, "expected tuple of length %v but got length %v", plan.minLen, tup.Len())
+		}
+		return newDecodeError(tuplePath, "expected tuple of length %v to %v but got length %v", plan.minLen, plan.maxLen, tup.Len())
+	}
+	contents := tup.Contents()
+	for i, item := range plan.items {
+		if i >= len(contents) {
+			// Trailing fields missing from the tuple, or an empty rest field
+			if item.field == nil || item.field.blank {
+				continue
+			}
+			field := rv.Field(item.field.index)
+			if item.field.opts.rest {
+				if err := decodeSlice(nil, field, structPath+"."+item.field.name); err != nil {
+					return err
+				}
+			} else {
+				field.Set(reflect.Zero(item.field.typ))
+			}
+			continue
+		}
+		switch {
+		case item.tuple != nil:
+			if err := decodeTuple(contents[i], rv, item.tuple, structPath, fmt.Sprintf("%v{%v}", tuplePath, i)); err != nil {
+				return err
+			}
+		case item.sizedBuffer:
+			continue
+		case item.field.blank:
+			if item.field.opts.constVal == nil {
+				continue
+			}
+			path := fmt.Sprintf("%v{%v}", tuplePath, i)
+			intVal, err := intFromValue(contents[i], path)
+			if err != nil {
+				return err
+			}
+			if intVal.BigInt().Uint64() != item.field.opts.constVal.Uint64() {
+				return newDecodeError(path, "expected %v but got %v", item.field.opts.constVal, intVal)
+			}
+		default:
+			if err := decodeField(contents, i, rv.Field(item.field.index), structPath+"."+item.field.name, item.field.opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decodeField(contents []value.Value, i int, rv reflect.Value, path string, opts fieldOptions) error {
+	switch {
+	case opts.sized:
+		size, err := intFromValue(contents[i], path)
+		if err != nil {
+			return err
+		}
+		buf, ok := contents[i+1].(*value.Buffer)
+		if !ok {
+			return newDecodeError(path, "expected buffer but got %v", describeValue(contents[i+1]))
+		}
+		data, err := inbox.BufAndLengthToBytes(size.BigInt(), buf)
+		if err != nil {
+			return &DecodeError{Path: path, Err: err}
+		}
+		rv.SetBytes(data)
+		return nil
+	case opts.rest:
+		return decodeSlice(contents[i:], rv, path)
+	default:
+		return decodeValue(contents[i], rv, path, opts)
+	}
+}
+
+func encodeValue(rv reflect.Value, path string, opts fieldOptions) (value.Value, error) {
+	if opts.optional {
+		opts.optional = false
+		if rv.IsNil() {
+			return value.NewTupleFromSlice([]value.Value{value.NewInt64Value(0)})
+		}
+		val, err := encodeValue(rv, path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return value.NewTuple2(value.NewInt64Value(1), val), nil
+	}
+
+	if !rv.IsValid() {
+		return nil, errors.Errorf("avmcodec: can't encode nil %v", path)
+	}
+	if rv.Kind() == reflect.Ptr && rv.Type() != bigIntType {
+		if rv.IsNil() {
+			if !opts.nilZero {
+				return nil, errors.Errorf("avmcodec: can't encode nil %v", path)
+			}
+			rv = reflect.New(rv.Type().Elem())
+		}
+		opts.nilZero = false
+		return encodeValue(rv.Elem(), path, opts)
+	}
+
+	if rv.Type().Implements(marshalerType) {
+		return rv.Interface().(Marshaler).MarshalAVM()
+	}
+	if reflect.PtrTo(rv.Type()).Implements(marshalerType) {
+		if !rv.CanAddr() {
+			ptr := reflect.New(rv.Type())
+			ptr.Elem().Set(rv)
+			rv = ptr.Elem()
+		}
+		return rv.Addr().Interface().(Marshaler).MarshalAVM()
+	}
+
+	switch rv.Type() {
+	case valueType:
+		if rv.IsNil() {
+			return nil, errors.Errorf("avmcodec: can't encode nil %v", path)
+		}
+		return rv.Interface().(value.Value), nil
+	case bigIntType:
+		return encodeInt(rv.Interface().(*big.Int), path)
+	case addressType:
+		return inbox.NewIntFromAddress(rv.Interface().(common.Address)), nil
+	case hashType:
+		hash := rv.Interface().(common.Hash)
+		return value.NewIntValue(new(big.Int).SetBytes(hash[:])), nil
+	case bytesType:
+		data := rv.Bytes()
+		return value.NewTuple2(value.NewInt64Value(int64(len(data))), value.NewBuffer(data)), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return value.NewInt64Value(1), nil
+		}
+		return value.NewInt64Value(0), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.NewIntValue(new(big.Int).SetUint64(rv.Uint())), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Encode the low bits the same way they're decoded
+		return value.NewIntValue(new(big.Int).SetUint64(uint64(rv.Int()))), nil
+	case reflect.Slice:
+		items, err := encodeSlice(rv, path)
+		if err != nil {
+			return nil, err
+		}
+		return inbox.ListToStackValue(items), nil
+	case reflect.Struct:
+		plan, err := planForType(rv.Type())
+		if err != nil {
+			return nil, err
+		}
+		return encodeTuple(rv, plan, path)
+	default:
+		return nil, errors.Errorf("avmcodec: can't encode %v of type %v", path, rv.Type())
+	}
+}
+
+func encodeInt(x *big.Int, path string) (value.Value, error) {
+	if x == nil {
+		return nil, errors.Errorf("avmcodec: can't encode nil %v", path)
+	}
+	if x.Sign() < 0 || x.BitLen() > 256 {
+		return nil, errors.Errorf("avmcodec: %v %v doesn't fit in an unsigned 256 bit int", path, x)
+	}
+	return value.NewIntValue(new(big.Int).Set(x)), nil
+}
+
+func encodeSlice(rv reflect.Value, path string) ([]value.Value, error) {
+	items := make([]value.Value, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item, err := encodeValue(rv.Index(i), fmt.Sprintf("%v[%v]", path, i), fieldOptions{})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func encodeTuple(rv reflect.Value, plan *tuplePlan, structPath string) (value.Value, error) {
+	contents := make([]value.Value, 0, len(plan.items))
+	for _, item := range plan.items {
+		switch {
+		case item.tuple != nil:
+			val, err := encodeTuple(rv, item.tuple, structPath)
+			if err != nil {
+				return nil, err
+			}
+			contents = append(contents, val)
+		case item.sizedBuffer:
+			// Added along with the sized field before it
+		case item.field.blank:
+			if item.field.opts.constVal != nil {
+				contents = append(contents, value.NewIntValue(item.field.opts.constVal))
+			} else {
+				contents = append(contents, value.NewInt64Value(0))
+			}
+		default:
+			path := structPath + "." + item.field.name
+			field := rv.Field(item.field.index)
+			switch {
+			case item.field.opts.sized:
+				data := field.Bytes()
+				contents = append(contents, value.NewInt64Value(int64(len(data))), value.NewBuffer(data))
+			case item.field.opts.rest:
+				items, err := encodeSlice(field, path)
+				if err != nil {
+					return nil, err
+				}
+				contents = append(contents, items...)
+			default:
+				val, err := encodeValue(field, path, item.field.opts)
+				if err != nil {
+					return nil, err
+				}
+				contents = append(contents, val)
+			}
+		}
+	}
+	// Ignored trailing positions are left off
+	for len(contents) > plan.minLen && len(contents) <= len(plan.items) {
+		last := plan.items[len(contents)-1].field
+		if last == nil || !last.blank {
+			break
+		}
+		contents = contents[:len(contents)-1]
+	}
+	tup, err := value.NewTupleFromSlice(contents)
+	if err != nil {
+		return nil, errors.Wrapf(err, "avmcodec: encoding %v", structPath)
+	}
+	return tup, nil
+}
+
+type fieldOptions struct {
+	optional bool
+	trailing bool
+	sized    bool
+	rest     bool
+	nilZero  bool
+	constVal *big.Int
+}
+
+type fieldPlan struct {
+	name  string
+	index int
+	typ   reflect.Type
+	blank bool
+	opts  fieldOptions
+}
+
+// tupleItem is the contents of one position in a tuple. A position holds
+// either a field or a nested tuple, or neither if it's the buffer of the sized
+// field before it.
+type tupleItem struct {
+	field       *fieldPlan
+	tuple       *tuplePlan
+	sizedBuffer bool
+}
+
+type tuplePlan struct {
+	items  []tupleItem
+	minLen int
+	maxLen int
+}
+
+type cachedPlan struct {
+	plan *tuplePlan
+	err  error
+}
+
+var plans sync.Map
+
+func planForType(t reflect.Type) (*tuplePlan, error) {
+	if cached, ok := plans.Load(t); ok {
+		return cached.(cachedPlan).plan, cached.(cachedPlan).err
+	}
+	plan, err := buildPlan(t)
+	if err != nil {
+		err = errors.Wrapf(err, "avmcodec: invalid tags on %v", t)
+	}
+	plans.Store(t, cachedPlan{plan: plan, err: err})
+	return plan, err
+}
+
+func parseTag(tag string) ([]int, fieldOptions, error) {
+	var opts fieldOptions
+	parts := strings.Split(tag, ",")
+	var path []int
+	for _, pos := range strings.Split(parts[0], ".") {
+		i, err := strconv.Atoi(pos)
+		if err != nil || i < 0 || i >= value.MaxTupleSize {
+			return nil, opts, errors.Errorf("invalid position %q", parts[0])
+		}
+		path = append(path, i)
+	}
+	for _, opt := range parts[1:] {
+		switch {
+		case opt == "optional":
+			opts.optional = true
+		case opt == "trailing":
+			opts.trailing = true
+		case opt == "sized":
+			opts.sized = true
+		case opt == "rest":
+			opts.rest = true
+		case opt == "nilzero":
+			opts.nilZero = true
+		case strings.HasPrefix(opt, "const="):
+			constVal, ok := new(big.Int).SetString(strings.TrimPrefix(opt, "const="), 0)
+			if !ok || constVal.Sign() < 0 || !constVal.IsUint64() {
+				return nil, opts, errors.Errorf("invalid option %q", opt)
+			}
+			opts.constVal = constVal
+		default:
+			return nil, opts, errors.Errorf("unknown option %q", opt)
+		}
+	}
+	return path, opts, nil
+}
+
+func buildPlan(t reflect.Type) (*tuplePlan, error) {
+	root := &tuplePlan{}
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		tag, ok := structField.Tag.Lookup("avm")
+		if !ok || tag == "-" {
+			continue
+		}
+		path, opts, err := parseTag(tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %v", structField.Name)
+		}
+		field := &fieldPlan{
+			name:  structField.Name,
+			index: i,
+			typ:   structField.Type,
+			blank: structField.Name == "_",
+			opts:  opts,
+		}
+		if opts.constVal != nil && !field.blank {
+			return nil, errors.Errorf("field %v can't have a constant value", field.name)
+		}
+		if !field.blank && structField.PkgPath != "" {
+			return nil, errors.Errorf("field %v is unexported", field.name)
+		}
+		if (opts.sized || opts.rest) && opts.optional {
+			return nil, errors.Errorf("field %v can't be optional", field.name)
+		}
+		if opts.sized && field.typ != bytesType {
+			return nil, errors.Errorf("sized field %v must be []byte", field.name)
+		}
+		if opts.rest && field.typ.Kind() != reflect.Slice {
+			return nil, errors.Errorf("rest field %v must be a slice", field.name)
+		}
+		if err := root.add(path, field); err != nil {
+			return nil, errors.Wrapf(err, "field %v", field.name)
+		}
+	}
+	if err := root.finish(); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (p *tuplePlan) position(i int) *tupleItem {
+	for len(p.items) <= i {
+		p.items = append(p.items, tupleItem{})
+	}
+	return &p.items[i]
+}
+
+func (p *tuplePlan) add(path []int, field *fieldPlan) error {
+	item := p.position(path[0])
+	if len(path) > 1 {
+		if item.field != nil || item.sizedBuffer {
+			return errors.Errorf("position %v is already used", path[0])
+		}
+		if item.tuple == nil {
+			item.tuple = &tuplePlan{}
+		}
+		return item.tuple.add(path[1:], field)
+	}
+	if item.field != nil || item.tuple != nil || item.sizedBuffer {
+		return errors.Errorf("position %v is already used", path[0])
+	}
+	item.field = field
+	if field.opts.sized {
+		if path[0]+1 >= value.MaxTupleSize {
+			return errors.New("sized field needs two positions")
+		}
+		next := p.position(path[0] + 1)
+		if next.field != nil || next.tuple != nil || next.sizedBuffer {
+			return errors.Errorf("position %v is already used", path[0]+1)
+		}
+		next.sizedBuffer = true
+	}
+	return nil
+}
+
+// finish checks that the tuple's positions are all filled and works out
+// which lengths it can have
+func (p *tuplePlan) finish() error {
+	p.minLen = len(p.items)
+	p.maxLen = len(p.items)
+	for i, item := range p.items {
+		switch {
+		case item.tuple != nil:
+			if err := item.tuple.finish(); err != nil {
+				return err
+			}
+		case item.field != nil:
+		case item.sizedBuffer:
+			continue
+		default:
+			return errors.Errorf("position %v has no field", i)
+		}
+
+		trailing := item.field != nil && item.field.opts.trailing
+		if p.minLen < len(p.items) && !trailing {
+			return errors.Errorf("position %v follows a trailing position", i)
+		}
+		if trailing {
+			if item.field.opts.sized || item.field.opts.rest {
+				return errors.Errorf("field %v can't be trailing", item.field.name)
+			}
+			if p.minLen == len(p.items) {
+				p.minLen = i
+			}
+		}
+		if item.field != nil && item.field.opts.rest {
+			if i != len(p.items)-1 {
+				return errors.Errorf("rest field %v must be last", item.field.name)
+			}
+			p.minLen = i
+			p.maxLen = value.MaxTupleSize
+		}
+	}
+	return nil
+}
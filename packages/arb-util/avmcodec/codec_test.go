@@ -0,0 +1,281 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package avmcodec
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+type testInner struct {
+	Count uint64 `avm:"0"`
+	Flag  bool   `avm:"1"`
+}
+
+type testOuter struct {
+	_        struct{}        `avm:"0,const=7"`
+	Amount   *big.Int        `avm:"1"`
+	Sender   common.Address  `avm:"2.0"`
+	ID       common.Hash     `avm:"2.1"`
+	Data     []byte          `avm:"2.2"`
+	Inner    *testInner      `avm:"3,optional"`
+	Items    []testInner     `avm:"4"`
+	Owner    *common.Address `avm:"5,nilzero"`
+	Raw      value.Value     `avm:"6"`
+	Extra    bool            `avm:"7,trailing"`
+	internal int
+}
+
+type testSized struct {
+	Kind   uint8    `avm:"0"`
+	Data   []byte   `avm:"1,sized"`
+	Topics []uint64 `avm:"3,rest"`
+}
+
+// testHooked stores its number doubled
+type testHooked struct {
+	Number *big.Int
+}
+
+func (h *testHooked) UnmarshalAVM(val value.Value) error {
+	var raw struct {
+		Doubled *big.Int `avm:"0"`
+	}
+	if err := Unmarshal(val, &raw); err != nil {
+		return err
+	}
+	h.Number = new(big.Int).Div(raw.Doubled, big.NewInt(2))
+	return nil
+}
+
+func (h *testHooked) MarshalAVM() (value.Value, error) {
+	return value.NewTupleFromSlice([]value.Value{value.NewIntValue(new(big.Int).Mul(h.Number, big.NewInt(2)))})
+}
+
+type testHookedParent struct {
+	Hooked testHooked `avm:"0"`
+}
+
+func testTuple(t *testing.T, vals ...value.Value) *value.TupleValue {
+	tup, err := value.NewTupleFromSlice(vals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tup
+}
+
+func testOuterValue(t *testing.T) value.Value {
+	return testTuple(t,
+		value.NewInt64Value(7),
+		value.NewInt64Value(1000),
+		testTuple(t,
+			inbox.NewIntFromAddress(common.HexToAddress("0x1234")),
+			value.NewInt64Value(5),
+			value.NewTuple2(value.NewInt64Value(4), value.NewBuffer([]byte{1, 2})),
+		),
+		value.NewTuple2(value.NewInt64Value(1), value.NewTuple2(value.NewInt64Value(3), value.NewInt64Value(1))),
+		inbox.ListToStackValue([]value.Value{
+			value.NewTuple2(value.NewInt64Value(1), value.NewInt64Value(0)),
+			value.NewTuple2(value.NewInt64Value(2), value.NewInt64Value(1)),
+		}),
+		value.NewInt64Value(0),
+		value.NewBuffer([]byte{9}),
+	)
+}
+
+func TestUnmarshal(t *testing.T) {
+	var outer testOuter
+	if err := Unmarshal(testOuterValue(t), &outer); err != nil {
+		t.Fatal(err)
+	}
+	expected := testOuter{
+		Amount: big.NewInt(1000),
+		Sender: common.HexToAddress("0x1234"),
+		ID:     common.HexToHash("0x05"),
+		Data:   []byte{1, 2, 0, 0},
+		Inner:  &testInner{Count: 3, Flag: true},
+		Items:  []testInner{{Count: 1}, {Count: 2, Flag: true}},
+		Raw:    value.NewBuffer([]byte{9}),
+	}
+	if !reflect.DeepEqual(outer, expected) {
+		t.Fatalf("decoded %+v but expected %+v", outer, expected)
+	}
+
+	// Encoding includes the trailing field
+	val, err := Marshal(&outer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tup := val.(*value.TupleValue)
+	if tup.Len() != 8 {
+		t.Fatalf("expected tuple of length 8 but got %v", tup.Len())
+	}
+	var decoded testOuter
+	if err := Unmarshal(val, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, outer) {
+		t.Fatalf("reencoded %+v as %+v", outer, decoded)
+	}
+}
+
+func TestUnmarshalSized(t *testing.T) {
+	val := testTuple(t,
+		value.NewInt64Value(0x102),
+		value.NewInt64Value(3),
+		value.NewBuffer([]byte{1}),
+	)
+	var sized testSized
+	if err := Unmarshal(val, &sized); err != nil {
+		t.Fatal(err)
+	}
+	// Small ints keep their low bits, and an empty rest field is still a slice
+	expected := testSized{Kind: 2, Data: []byte{1, 0, 0}, Topics: []uint64{}}
+	if !reflect.DeepEqual(sized, expected) {
+		t.Fatalf("decoded %+v but expected %+v", sized, expected)
+	}
+
+	sized.Topics = []uint64{1, 2, 3}
+	encoded, err := Marshal(sized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded testSized
+	if err := Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, sized) {
+		t.Fatalf("reencoded %+v as %+v", sized, decoded)
+	}
+
+	sized.Topics = make([]uint64, 6)
+	if _, err := Marshal(sized); err == nil {
+		t.Fatal("encoded tuple longer than the maximum size")
+	}
+}
+
+func TestUnmarshalHooks(t *testing.T) {
+	val := testTuple(t, testTuple(t, value.NewInt64Value(10)))
+	var parent testHookedParent
+	if err := Unmarshal(val, &parent); err != nil {
+		t.Fatal(err)
+	}
+	if parent.Hooked.Number.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("decoded %v but expected 5", parent.Hooked.Number)
+	}
+	encoded, err := Marshal(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !value.Eq(encoded, val) {
+		t.Fatalf("encoded %v but expected %v", encoded, val)
+	}
+
+	// Errors inside hooks are reported from the field holding them
+	val = testTuple(t, testTuple(t, value.NewEmptyTuple()))
+	err = Unmarshal(val, &parent)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Path != "testHookedParent.Hooked.Doubled" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	replace := func(path []int, newVal value.Value) value.Value {
+		val := testOuterValue(t)
+		tups := []*value.TupleValue{val.(*value.TupleValue)}
+		for _, i := range path[:len(path)-1] {
+			item, _ := tups[len(tups)-1].GetByInt64(int64(i))
+			tups = append(tups, item.(*value.TupleValue))
+		}
+		for i := len(tups) - 1; i >= 0; i-- {
+			contents := append([]value.Value{}, tups[i].Contents()...)
+			contents[path[i]] = newVal
+			newVal = testTuple(t, contents...)
+		}
+		return newVal
+	}
+
+	cases := []struct {
+		val  value.Value
+		path string
+	}{
+		{value.NewInt64Value(0), "testOuter"},
+		{testTuple(t, value.NewInt64Value(7)), "testOuter"},
+		{replace([]int{0}, value.NewInt64Value(8)), "testOuter{0}"},
+		{replace([]int{1}, value.NewEmptyTuple()), "testOuter.Amount"},
+		{replace([]int{2}, value.NewInt64Value(0)), "testOuter{2}"},
+		{replace([]int{2, 1}, value.NewEmptyTuple()), "testOuter.ID"},
+		{replace([]int{2, 2, 0}, value.NewInt64Value(1)), "testOuter.Data"},
+		{replace([]int{3, 0}, value.NewInt64Value(2)), "testOuter.Inner"},
+		{replace([]int{3, 1, 1}, value.NewInt64Value(2)), "testOuter.Inner.Flag"},
+		{replace([]int{4, 0, 0}, value.NewBuffer(nil)), "testOuter.Items[1].Count"},
+		{replace([]int{4, 1}, value.NewInt64Value(0)), "testOuter.Items"},
+		{replace([]int{5}, value.NewEmptyTuple()), "testOuter.Owner"},
+		{testTuple(t, append(testOuterValue(t).(*value.TupleValue).Contents(), value.NewInt64Value(2))...), "testOuter.Extra"},
+	}
+	for _, c := range cases {
+		var outer testOuter
+		err := Unmarshal(c.val, &outer)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("expected error at %v but got %v", c.path, err)
+			continue
+		}
+		if decodeErr.Path != c.path {
+			t.Errorf("expected error at %v but got %v", c.path, err)
+		}
+	}
+}
+
+func TestInvalidTags(t *testing.T) {
+	var missing struct {
+		A uint64 `avm:"0"`
+		B uint64 `avm:"2"`
+	}
+	var duplicate struct {
+		A uint64 `avm:"0"`
+		B uint64 `avm:"0"`
+	}
+	var notTrailing struct {
+		A uint64 `avm:"0,trailing"`
+		B uint64 `avm:"1"`
+	}
+	var notLast struct {
+		A []uint64 `avm:"0,rest"`
+		B uint64   `avm:"1"`
+	}
+	var overlapping struct {
+		A []byte `avm:"0,sized"`
+		B uint64 `avm:"1"`
+	}
+	for _, v := range []interface{}{&missing, &duplicate, &notTrailing, &notLast, &overlapping} {
+		if err := Unmarshal(value.NewEmptyTuple(), v); err == nil {
+			t.Errorf("decoded into %T", v)
+		}
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("encoded %T", v)
+		}
+	}
+}
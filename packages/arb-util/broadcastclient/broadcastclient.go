@@ -40,6 +40,7 @@ type BroadcastClient struct {
 
 	connMutex *sync.Mutex
 	conn      net.Conn
+	connected bool
 
 	retryMutex *sync.Mutex
 	retryCount int
@@ -124,6 +125,7 @@ func (bc *BroadcastClient) connect(ctx context.Context, messageReceiver chan bro
 
 	bc.connMutex.Lock()
 	bc.conn = conn
+	bc.connected = true
 	bc.connMutex.Unlock()
 
 	logger.Info().Msg("Connected")
@@ -150,6 +152,9 @@ func (bc *BroadcastClient) startBackgroundReader(ctx context.Context, messageRec
 				} else {
 					logger.Error().Err(err).Str("feed", bc.websocketUrl).Int("opcode", int(op)).Msgf("error calling readData")
 				}
+				bc.connMutex.Lock()
+				bc.connected = false
+				bc.connMutex.Unlock()
 				_ = bc.conn.Close()
 				bc.RetryConnect(ctx, messageReceiver)
 				continue
@@ -185,6 +190,13 @@ func (bc *BroadcastClient) startBackgroundReader(ctx context.Context, messageRec
 	}()
 }
 
+// IsConnected returns whether the client currently has an open connection to the feed
+func (bc *BroadcastClient) IsConnected() bool {
+	bc.connMutex.Lock()
+	defer bc.connMutex.Unlock()
+	return bc.connected
+}
+
 func (bc *BroadcastClient) GetRetryCount() int {
 	bc.retryMutex.Lock()
 	defer bc.retryMutex.Unlock()
@@ -226,5 +238,6 @@ func (bc *BroadcastClient) Close() {
 	if bc.conn != nil {
 		_ = bc.conn.Close()
 	}
+	bc.connected = false
 	bc.connMutex.Unlock()
 }
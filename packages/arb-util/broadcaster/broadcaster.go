@@ -228,9 +228,11 @@ func (b *Broadcaster) BroadcastSingle(prevAcc common.Hash, batchItem inbox.Seque
 	return b.clientManager.Broadcast(prevAcc, batchItem, signature)
 }
 
+// Broadcast signs and sends each batch item. dataSigner is given the item's
+// accumulator and must sign it as an Ethereum signed message.
 func (b *Broadcaster) Broadcast(prevAcc common.Hash, batchItems []inbox.SequencerBatchItem, dataSigner func([]byte) ([]byte, error)) error {
 	for _, item := range batchItems {
-		signature, err := dataSigner(hashing.SoliditySHA3WithPrefix(hashing.Bytes32(item.Accumulator)).Bytes())
+		signature, err := dataSigner(hashing.Bytes32(item.Accumulator))
 		if err != nil {
 			return err
 		}
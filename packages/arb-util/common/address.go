@@ -87,6 +87,10 @@ func (a Address) MarshalText() ([]byte, error) {
 	return []byte(a.Hex()), nil
 }
 
+func (a *Address) UnmarshalText(input []byte) error {
+	return (*ethcommon.Address)(a).UnmarshalText(input)
+}
+
 func HexToAddress(hex string) Address {
 	return NewAddressFromEth(ethcommon.HexToAddress(hex))
 }
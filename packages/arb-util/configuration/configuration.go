@@ -41,16 +41,17 @@ type Conf struct {
 }
 
 type Core struct {
-	Cache                  CoreCache     `koanf:"cache"`
-	CheckpointLoadGasCost  int           `koanf:"checkpoint-load-gas-cost"`
-	Profile                CoreProfile   `koanf:"profile"`
-	Debug                  bool          `koanf:"debug"`
-	GasCheckpointFrequency int           `koanf:"gas-checkpoint-frequency"`
-	LazyLoadCoreMachine    bool          `koanf:"lazy-load-core-machine"`
-	LazyLoadArchiveQueries bool          `koanf:"lazy-load-archive-queries"`
-	MessageProcessCount    int           `koanf:"message-process-count"`
-	SaveRocksdbInterval    time.Duration `koanf:"save-rocksdb-interval"`
-	SaveRocksdbPath        string        `koanf:"save-rocksdb-path"`
+	Cache                  CoreCache          `koanf:"cache"`
+	CheckpointLoadGasCost  int                `koanf:"checkpoint-load-gas-cost"`
+	ConsensusCheck         CoreConsensusCheck `koanf:"consensus-check"`
+	Profile                CoreProfile        `koanf:"profile"`
+	Debug                  bool               `koanf:"debug"`
+	GasCheckpointFrequency int                `koanf:"gas-checkpoint-frequency"`
+	LazyLoadCoreMachine    bool               `koanf:"lazy-load-core-machine"`
+	LazyLoadArchiveQueries bool               `koanf:"lazy-load-archive-queries"`
+	MessageProcessCount    int                `koanf:"message-process-count"`
+	SaveRocksdbInterval    time.Duration      `koanf:"save-rocksdb-interval"`
+	SaveRocksdbPath        string             `koanf:"save-rocksdb-path"`
 }
 
 type CoreCache struct {
@@ -58,6 +59,31 @@ type CoreCache struct {
 	TimedExpire time.Duration `koanf:"timed-expire"`
 }
 
+// CoreConsensusCheck configures re-executing ranges of messages on a separate
+// machine to catch nondeterminism or corruption in the core
+type CoreConsensusCheck struct {
+	Enable          bool          `koanf:"enable"`
+	MaxGas          uint64        `koanf:"max-gas"`
+	MessageInterval uint64        `koanf:"message-interval"`
+	PollInterval    time.Duration `koanf:"poll-interval"`
+}
+
+func DefaultCoreConsensusCheckSettings() CoreConsensusCheck {
+	return CoreConsensusCheck{
+		MaxGas:          100_000_000_000,
+		MessageInterval: 1000,
+		PollInterval:    10 * time.Second,
+	}
+}
+
+func AddCoreConsensusCheckOptions(f *flag.FlagSet) {
+	defaults := DefaultCoreConsensusCheckSettings()
+	f.Bool("core.consensus-check.enable", defaults.Enable, "re-execute processed messages on a separate machine and halt if the results differ")
+	f.Uint64("core.consensus-check.max-gas", defaults.MaxGas, "maximum gas to re-execute in a single check")
+	f.Uint64("core.consensus-check.message-interval", defaults.MessageInterval, "number of messages re-executed in each check")
+	f.Duration("core.consensus-check.poll-interval", defaults.PollInterval, "delay between checking whether enough new messages were processed")
+}
+
 type CoreProfile struct {
 	JustMetadata        bool  `koanf:"just-metadata"`
 	LoadCount           int64 `koanf:"load-count"`
@@ -74,6 +100,7 @@ func DefaultCoreSettings() *Core {
 			TimedExpire: 20 * time.Minute,
 		},
 		CheckpointLoadGasCost:  1_000_000,
+		ConsensusCheck:         DefaultCoreConsensusCheckSettings(),
 		GasCheckpointFrequency: 1_000_000,
 		MessageProcessCount:    10,
 	}
@@ -100,13 +127,16 @@ type Feed struct {
 }
 
 type Healthcheck struct {
-	Addr          string `koanf:"addr"`
-	Enable        bool   `koanf:"enable"`
-	L1Node        bool   `koanf:"l1-node"`
-	Metrics       bool   `koanf:"metrics"`
-	MetricsPrefix string `koanf:"metrics-prefix"`
-	Port          string `koanf:"port"`
-	Sequencer     bool   `koanf:"sequencer"`
+	Addr          string        `koanf:"addr"`
+	Enable        bool          `koanf:"enable"`
+	L1Endpoints   []string      `koanf:"l1-endpoints"`
+	L1MaxBlockAge time.Duration `koanf:"l1-max-block-age"`
+	L1Node        bool          `koanf:"l1-node"`
+	MaxTxDBLag    int64         `koanf:"max-txdb-lag"`
+	Metrics       bool          `koanf:"metrics"`
+	MetricsPrefix string        `koanf:"metrics-prefix"`
+	Port          string        `koanf:"port"`
+	Sequencer     bool          `koanf:"sequencer"`
 }
 
 type Lockout struct {
@@ -124,9 +154,11 @@ type Aggregator struct {
 }
 
 type RPC struct {
-	Addr string `koanf:"addr"`
-	Port string `koanf:"port"`
-	Path string `koanf:"path"`
+	Addr        string `koanf:"addr"`
+	Port        string `koanf:"port"`
+	Path        string `koanf:"path"`
+	EnableDebug bool   `koanf:"enable-debug"`
+	EnableTrace bool   `koanf:"enable-trace"`
 }
 
 type S3 struct {
@@ -137,6 +169,78 @@ type S3 struct {
 	SecretKey string `koanf:"secret-key"`
 }
 
+type L1 struct {
+	FallbackURLs []string    `koanf:"fallback-urls"`
+	LogFetch     L1LogFetch  `koanf:"log-fetch"`
+	TxManager    L1TxManager `koanf:"tx-manager"`
+	URL          string      `koanf:"url"`
+}
+
+type L1LogFetch struct {
+	InitialBlocks       uint64        `koanf:"initial-blocks"`
+	MaxBlocks           uint64        `koanf:"max-blocks"`
+	MinBlocks           uint64        `koanf:"min-blocks"`
+	Prefetch            int           `koanf:"prefetch"`
+	Timeout             time.Duration `koanf:"timeout"`
+	VerifyConfirmations uint64        `koanf:"verify-confirmations"`
+}
+
+// DefaultL1LogFetchSettings is useful in unit tests
+func DefaultL1LogFetchSettings() L1LogFetch {
+	return L1LogFetch{
+		InitialBlocks:       100,
+		MaxBlocks:           10_000,
+		MinBlocks:           2,
+		Prefetch:            2,
+		Timeout:             30 * time.Second,
+		VerifyConfirmations: 12,
+	}
+}
+
+func AddL1LogFetchOptions(f *flag.FlagSet) {
+	defaults := DefaultL1LogFetchSettings()
+	f.Uint64("l1.log-fetch.initial-blocks", defaults.InitialBlocks, "number of L1 blocks the inbox reader initially requests logs for at once")
+	f.Uint64("l1.log-fetch.max-blocks", defaults.MaxBlocks, "maximum number of L1 blocks the inbox reader requests logs for at once")
+	f.Uint64("l1.log-fetch.min-blocks", defaults.MinBlocks, "minimum number of L1 blocks the inbox reader requests logs for at once")
+	f.Int("l1.log-fetch.prefetch", defaults.Prefetch, "number of upcoming block ranges to fetch logs for concurrently while syncing")
+	f.Duration("l1.log-fetch.timeout", defaults.Timeout, "time to wait for the logs of a block range before retrying with a smaller range")
+	f.Uint64("l1.log-fetch.verify-confirmations", defaults.VerifyConfirmations, "number of blocks behind the L1 tip a block must be before fallback providers are asked to confirm its hash")
+}
+
+type L1TxManager struct {
+	BaseFeeMultiplier int64         `koanf:"base-fee-multiplier"`
+	Enable            bool          `koanf:"enable"`
+	FeeBumpInterval   time.Duration `koanf:"fee-bump-interval"`
+	FeeBumpPercent    int64         `koanf:"fee-bump-percent"`
+	MaxFeeCap         float64       `koanf:"max-fee-cap"`
+	MaxTipCap         float64       `koanf:"max-tip-cap"`
+	PollInterval      time.Duration `koanf:"poll-interval"`
+}
+
+// DefaultL1TxManagerSettings is useful in unit tests
+func DefaultL1TxManagerSettings() L1TxManager {
+	return L1TxManager{
+		BaseFeeMultiplier: 2,
+		Enable:            false,
+		FeeBumpInterval:   3 * time.Minute,
+		FeeBumpPercent:    20,
+		MaxFeeCap:         1000,
+		MaxTipCap:         50,
+		PollInterval:      5 * time.Second,
+	}
+}
+
+func AddL1TxManagerOptions(f *flag.FlagSet) {
+	defaults := DefaultL1TxManagerSettings()
+	f.Bool("l1.tx-manager.enable", defaults.Enable, "track and replace L1 transactions with the L1 transaction manager")
+	f.Int64("l1.tx-manager.base-fee-multiplier", defaults.BaseFeeMultiplier, "multiple of the current base fee to use as the fee cap of new transactions")
+	f.Duration("l1.tx-manager.fee-bump-interval", defaults.FeeBumpInterval, "time to wait for a transaction to be included before increasing its fees")
+	f.Int64("l1.tx-manager.fee-bump-percent", defaults.FeeBumpPercent, "percentage to increase fees by each time a transaction is replaced, at least 10")
+	f.Float64("l1.tx-manager.max-fee-cap", defaults.MaxFeeCap, "maximum fee cap in gwei for L1 transactions")
+	f.Float64("l1.tx-manager.max-tip-cap", defaults.MaxTipCap, "maximum priority fee in gwei for L1 transactions")
+	f.Duration("l1.tx-manager.poll-interval", defaults.PollInterval, "time between checks on pending L1 transactions")
+}
+
 type L1PostingStrategy struct {
 	HighGasThreshold   float64 `koanf:"high-gas-threshold"`
 	HighGasDelayBlocks int64   `koanf:"high-gas-delay-blocks"`
@@ -175,22 +279,65 @@ type Forwarder struct {
 }
 
 type Node struct {
-	Aggregator Aggregator `koanf:"aggregator"`
-	Cache      NodeCache  `koanf:"cache"`
-	ChainID    uint64     `koanf:"chain-id"`
-	Forwarder  Forwarder  `koanf:"forwarder"`
-	RPC        RPC        `koanf:"rpc"`
-	Sequencer  Sequencer  `koanf:"sequencer"`
-	Type       string     `koanf:"type"`
-	WS         WS         `koanf:"ws"`
+	Aggregator   Aggregator       `koanf:"aggregator"`
+	Cache        NodeCache        `koanf:"cache"`
+	ChainID      uint64           `koanf:"chain-id"`
+	Forwarder    Forwarder        `koanf:"forwarder"`
+	RPC          RPC              `koanf:"rpc"`
+	Sequencer    Sequencer        `koanf:"sequencer"`
+	StateHistory NodeStateHistory `koanf:"state-history"`
+	Type         string           `koanf:"type"`
+	WS           WS               `koanf:"ws"`
 }
 
 type NodeCache struct {
-	AllowSlowLookup  bool          `koanf:"allow-slow-lookup"`
-	LRUSize          int           `koanf:"lru-size"`
-	BlockInfoLRUSize int           `koanf:"block-info-lru-size"`
-	TimedInitialSize int           `koanf:"timed-initial-size"`
-	TimedExpire      time.Duration `koanf:"timed-expire"`
+	AllowSlowLookup  bool            `koanf:"allow-slow-lookup"`
+	LRUSize          int             `koanf:"lru-size"`
+	BlockInfoLRUSize int             `koanf:"block-info-lru-size"`
+	TimedInitialSize int             `koanf:"timed-initial-size"`
+	TimedExpire      time.Duration   `koanf:"timed-expire"`
+	Replay           NodeCacheReplay `koanf:"replay"`
+}
+
+// NodeCacheReplay configures the reconstruction of historical L2 block state
+// when slow lookups are allowed
+type NodeCacheReplay struct {
+	Workers           int    `koanf:"workers"`
+	MaxCursors        int    `koanf:"max-cursors"`
+	MaxQueued         int    `koanf:"max-queued"`
+	ShareGas          uint64 `koanf:"share-gas"`
+	SnapshotCacheSize int    `koanf:"snapshot-cache-size"`
+}
+
+func DefaultNodeCacheReplaySettings() NodeCacheReplay {
+	return NodeCacheReplay{
+		Workers:           4,
+		MaxCursors:        16,
+		MaxQueued:         1000,
+		ShareGas:          10_000_000_000,
+		SnapshotCacheSize: 100,
+	}
+}
+
+func AddNodeCacheReplayOptions(f *flag.FlagSet) {
+	defaults := DefaultNodeCacheReplaySettings()
+	f.Int("node.cache.replay.workers", defaults.Workers, "number of historical L2 block states reconstructed in parallel, zero to replay on the request thread")
+	f.Int("node.cache.replay.max-cursors", defaults.MaxCursors, "maximum number of idle execution cursors kept for reuse by later replays")
+	f.Int("node.cache.replay.max-queued", defaults.MaxQueued, "maximum number of historical L2 block states waiting to be reconstructed")
+	f.Uint64("node.cache.replay.share-gas", defaults.ShareGas, "replays for blocks within this much gas of each other are run on the same execution cursor")
+	f.Int("node.cache.replay.snapshot-cache-size", defaults.SnapshotCacheSize, "number of reconstructed L2 block snapshots to hold in memory")
+}
+
+const (
+	StateHistoryArchive = "archive"
+	StateHistoryFull    = "full"
+)
+
+type NodeStateHistory struct {
+	Mode                   string        `koanf:"mode"`
+	KeepBlocks             uint64        `koanf:"keep-blocks"`
+	PruneInterval          time.Duration `koanf:"prune-interval"`
+	SaveCheckpointInterval int64         `koanf:"save-checkpoint-interval"`
 }
 
 type Persistent struct {
@@ -199,26 +346,94 @@ type Persistent struct {
 }
 
 type Rollup struct {
-	Address   string `koanf:"address"`
-	FromBlock int64  `koanf:"from-block"`
-	Machine   struct {
-		Filename string `koanf:"filename"`
-		URL      string `koanf:"url"`
-	} `koanf:"machine"`
+	Address   string        `koanf:"address"`
+	FromBlock int64         `koanf:"from-block"`
+	Machine   RollupMachine `koanf:"machine"`
+}
+
+type RollupMachine struct {
+	Filename string `koanf:"filename"`
+	URL      string `koanf:"url"`
+}
+
+// ValidatorRollup is an entry in the rollups list, which lets one validator
+// process manage several chains. Empty fields fall back to the top level
+// setting of the same name, and the top level wallet is used unless Wallet
+// sets a key source of its own.
+type ValidatorRollup struct {
+	Address              string        `koanf:"address"`
+	BridgeUtilsAddress   string        `koanf:"bridge-utils-address"`
+	Chain                string        `koanf:"chain"`
+	FromBlock            int64         `koanf:"from-block"`
+	Machine              RollupMachine `koanf:"machine"`
+	Strategy             string        `koanf:"strategy"`
+	UtilsAddress         string        `koanf:"utils-address"`
+	Wallet               Wallet        `koanf:"wallet"`
+	WalletFactoryAddress string        `koanf:"wallet-factory-address"`
 }
 
 type Validator struct {
-	Strategy             string            `koanf:"strategy"`
-	UtilsAddress         string            `koanf:"utils-address"`
-	StakerDelay          time.Duration     `koanf:"staker-delay"`
-	WalletFactoryAddress string            `koanf:"wallet-factory-address"`
-	L1PostingStrategy    L1PostingStrategy `koanf:"l1-posting-strategy"`
-	DontChallenge        bool              `koanf:"dont-challenge"`
+	Strategy             string             `koanf:"strategy"`
+	UtilsAddress         string             `koanf:"utils-address"`
+	StakerDelay          time.Duration      `koanf:"staker-delay"`
+	WalletFactoryAddress string             `koanf:"wallet-factory-address"`
+	L1PostingStrategy    L1PostingStrategy  `koanf:"l1-posting-strategy"`
+	DontChallenge        bool               `koanf:"dont-challenge"`
+	CostAware            ValidatorCostAware `koanf:"cost-aware"`
+	WatchOnly            ValidatorWatchOnly `koanf:"watch-only"`
+}
+
+type ValidatorCostAware struct {
+	Budget        float64 `koanf:"budget"`
+	CreateNodeGas uint64  `koanf:"create-node-gas"`
+	ResolveGas    uint64  `koanf:"resolve-gas"`
+	StakeGas      uint64  `koanf:"stake-gas"`
+}
+
+type ValidatorWatchOnly struct {
+	Addr           string        `koanf:"addr"`
+	PollInterval   time.Duration `koanf:"poll-interval"`
+	Port           string        `koanf:"port"`
+	WebhookTimeout time.Duration `koanf:"webhook-timeout"`
+	WebhookURL     string        `koanf:"webhook-url"`
 }
 
 type Wallet struct {
 	Fireblocks WalletFireblocks `koanf:"fireblocks"`
 	Local      WalletLocal      `koanf:"local"`
+	Remote     WalletRemote     `koanf:"remote"`
+}
+
+// IsSet returns true if any source of keys is configured for the wallet
+func (w *Wallet) IsSet() bool {
+	return len(w.Fireblocks.SSLKey) != 0 || len(w.Local.Pathname) != 0 || len(w.Local.PrivateKey) != 0 || len(w.Remote.URL) != 0
+}
+
+// setListDefaults fills in the flag defaults for a wallet from the rollups
+// list, which flags don't apply to
+func (w *Wallet) setListDefaults() {
+	if len(w.Local.PasswordImpl) == 0 {
+		w.Local.PasswordImpl = PASSWORD_NOT_SET
+	}
+	if len(w.Remote.API) == 0 {
+		w.Remote.API = RemoteSignerEthAPI
+	}
+	if w.Remote.Timeout == 0 {
+		w.Remote.Timeout = 10 * time.Second
+	}
+}
+
+const (
+	RemoteSignerEthAPI     = "eth"
+	RemoteSignerAccountAPI = "account"
+)
+
+type WalletRemote struct {
+	Address           string        `koanf:"address"`
+	API               string        `koanf:"api"`
+	FeedSignerAddress string        `koanf:"feed-signer-address"`
+	Timeout           time.Duration `koanf:"timeout"`
+	URL               string        `koanf:"url"`
 }
 
 type WalletFireblocks struct {
@@ -273,24 +488,37 @@ type Metrics struct {
 	Port string `koanf:"port"`
 }
 
+type Init struct {
+	Snapshot string `koanf:"snapshot"`
+}
+
+type Tracing struct {
+	Exporter     string  `koanf:"exporter"`
+	File         string  `koanf:"file"`
+	OTLPEndpoint string  `koanf:"otlp-endpoint"`
+	OTLPInsecure bool    `koanf:"otlp-insecure"`
+	SampleRatio  float64 `koanf:"sample-ratio"`
+}
+
 type Config struct {
-	BridgeUtilsAddress string      `koanf:"bridge-utils-address"`
-	Conf               Conf        `koanf:"conf"`
-	Core               Core        `koanf:"core"`
-	Feed               Feed        `koanf:"feed"`
-	GasPrice           float64     `koanf:"gas-price"`
-	Healthcheck        Healthcheck `koanf:"healthcheck"`
-	L1                 struct {
-		URL string `koanf:"url"`
-	} `koanf:"l1"`
-	Log           Log        `koanf:"log"`
-	Node          Node       `koanf:"node"`
-	Persistent    Persistent `koanf:"persistent"`
-	PProfEnable   bool       `koanf:"pprof-enable"`
-	Rollup        Rollup     `koanf:"rollup"`
-	Validator     Validator  `koanf:"validator"`
-	WaitToCatchUp bool       `koanf:"wait-to-catch-up"`
-	Wallet        Wallet     `koanf:"wallet"`
+	BridgeUtilsAddress string            `koanf:"bridge-utils-address"`
+	Conf               Conf              `koanf:"conf"`
+	Core               Core              `koanf:"core"`
+	Feed               Feed              `koanf:"feed"`
+	GasPrice           float64           `koanf:"gas-price"`
+	Healthcheck        Healthcheck       `koanf:"healthcheck"`
+	Init               Init              `koanf:"init"`
+	L1                 L1                `koanf:"l1"`
+	Log                Log               `koanf:"log"`
+	Node               Node              `koanf:"node"`
+	Persistent         Persistent        `koanf:"persistent"`
+	PProfEnable        bool              `koanf:"pprof-enable"`
+	Rollup             Rollup            `koanf:"rollup"`
+	Rollups            []ValidatorRollup `koanf:"rollups"`
+	Tracing            Tracing           `koanf:"tracing"`
+	Validator          Validator         `koanf:"validator"`
+	WaitToCatchUp      bool              `koanf:"wait-to-catch-up"`
+	Wallet             Wallet            `koanf:"wallet"`
 
 	// The following field needs to be top level for compatibility with the underlying go-ethereum lib
 	Metrics       bool    `koanf:"metrics"`
@@ -305,6 +533,57 @@ func (c *Config) GetValidatorDatabasePath() string {
 	return path.Join(c.Persistent.Chain, "validator_db")
 }
 
+// ValidatorRollups returns a config for each entry in the rollups list with
+// the rollup specific settings applied, or just c if the list is empty. A
+// rollup configured with the single rollup settings comes first unless the
+// list contains it too. The Wallet of each config is the rollup's own wallet,
+// which is empty if the rollup uses the top level one.
+func (c *Config) ValidatorRollups() []*Config {
+	if len(c.Rollups) == 0 {
+		return []*Config{c}
+	}
+	configs := make([]*Config, 0, len(c.Rollups)+1)
+	if len(c.Rollup.Address) != 0 {
+		listed := false
+		for _, rollup := range c.Rollups {
+			if strings.EqualFold(rollup.Address, c.Rollup.Address) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			rollupConfig := *c
+			rollupConfig.Rollups = nil
+			configs = append(configs, &rollupConfig)
+		}
+	}
+	for _, rollup := range c.Rollups {
+		rollupConfig := *c
+		rollupConfig.Rollups = nil
+		rollupConfig.Wallet = rollup.Wallet
+		rollupConfig.Rollup = Rollup{
+			Address:   rollup.Address,
+			FromBlock: rollup.FromBlock,
+			Machine:   rollup.Machine,
+		}
+		rollupConfig.Persistent.Chain = rollup.Chain
+		if len(rollup.BridgeUtilsAddress) != 0 {
+			rollupConfig.BridgeUtilsAddress = rollup.BridgeUtilsAddress
+		}
+		if len(rollup.Strategy) != 0 {
+			rollupConfig.Validator.Strategy = rollup.Strategy
+		}
+		if len(rollup.UtilsAddress) != 0 {
+			rollupConfig.Validator.UtilsAddress = rollup.UtilsAddress
+		}
+		if len(rollup.WalletFactoryAddress) != 0 {
+			rollupConfig.Validator.WalletFactoryAddress = rollup.WalletFactoryAddress
+		}
+		configs = append(configs, &rollupConfig)
+	}
+	return configs
+}
+
 func ParseCLI(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *big.Int, error) {
 	f := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 
@@ -324,7 +603,9 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	AddFeedOutputOptions(f)
 	AddForwarderTarget(f)
 	AddL1PostingStrategyOptions(f, "node.sequencer.")
+	AddTracingOptions(f)
 
+	f.String("init.snapshot", "", "file or URL of a database snapshot to initialize the node from if it has no database")
 	f.String("node.aggregator.inbox-address", "", "address of the inbox contract")
 	f.Int("node.aggregator.max-batch-time", 10, "max-batch-time=NumSeconds")
 	f.Bool("node.aggregator.stateful", false, "enable pending state tracking")
@@ -333,6 +614,8 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	f.String("node.rpc.addr", "0.0.0.0", "RPC address")
 	f.Int("node.rpc.port", 8547, "RPC port")
 	f.String("node.rpc.path", "/", "RPC path")
+	f.Bool("node.rpc.enable-debug", false, "enable the debug namespace, including expensive transaction profiling")
+	f.Bool("node.rpc.enable-trace", false, "enable the trace namespace for transaction state diffs")
 	f.Int64("node.sequencer.create-batch-block-interval", 270, "block interval at which to create new batches")
 	f.Int64("node.sequencer.continue-batch-posting-block-interval", 2, "block interval to post the next batch after posting a partial one")
 	f.Int64("node.sequencer.delayed-messages-target-delay", 12, "delay before sequencing delayed messages")
@@ -346,6 +629,10 @@ func ParseNode(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClient, *
 	f.Bool("node.sequencer.dangerous.rewrite-sequencer-address", false, "reorganize to rewrite the sequencer address if it's not the loaded wallet (DANGEROUS)")
 	f.Bool("node.sequencer.dangerous.disable-batch-posting", false, "disable posting batches to L1 (DANGEROUS)")
 	f.Bool("node.sequencer.dangerous.disable-delayed-message-sequencing", false, "disable sequencing delayed messages (DANGEROUS)")
+	f.String("node.state-history.mode", StateHistoryArchive, "\"archive\" to retain state for all blocks or \"full\" to prune state older than keep-blocks")
+	f.Uint64("node.state-history.keep-blocks", 128, "number of recent L2 blocks to retain state for in full mode")
+	f.Duration("node.state-history.prune-interval", 10*time.Minute, "time between pruning old state and updating disk usage metrics")
+	f.Int64("node.state-history.save-checkpoint-interval", 100_000, "keep one pruned checkpoint per this many messages in full mode to speed up deep reorgs, 0 to keep none")
 	f.String("node.type", "forwarder", "forwarder, aggregator or sequencer")
 	f.String("node.ws.addr", "0.0.0.0", "websocket address")
 	f.Int("node.ws.port", 8548, "websocket port")
@@ -360,11 +647,20 @@ func ParseValidator(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClie
 	AddFeedOutputOptions(f)
 	AddL1PostingStrategyOptions(f, "validator.")
 
-	f.String("validator.strategy", "StakeLatest", "strategy for validator to use")
+	f.String("validator.strategy", "StakeLatest", "strategy for validator to use: Watchtower, Defensive, StakeLatest, MakeNodes, CostAware, or WatchOnly to report on assertions without a wallet")
 	f.String("validator.utils-address", "", "strategy for validator to use")
 	f.Duration("validator.staker-delay", 60*time.Second, "delay between updating stake")
 	f.String("validator.wallet-factory-address", "", "strategy for validator to use")
 	f.Bool("validator.dont-challenge", false, "don't challenge any other validators' assertions")
+	f.Float64("validator.cost-aware.budget", 0.1, "ETH the CostAware strategy may spend on optional actions per confirm period")
+	f.Uint64("validator.cost-aware.create-node-gas", 600_000, "estimated L1 gas used to create a node")
+	f.Uint64("validator.cost-aware.resolve-gas", 150_000, "estimated L1 gas used to confirm or reject a node")
+	f.Uint64("validator.cost-aware.stake-gas", 150_000, "estimated L1 gas used to move a stake onto an existing node")
+	f.String("validator.watch-only.addr", "0.0.0.0", "address to serve watch-only validation status on")
+	f.String("validator.watch-only.port", "8549", "port to serve watch-only validation status on")
+	f.Duration("validator.watch-only.poll-interval", 30*time.Second, "delay between checking for new rollup nodes in watch-only mode")
+	f.String("validator.watch-only.webhook-url", "", "URL to POST alerts to when an invalid assertion or fork is detected")
+	f.Duration("validator.watch-only.webhook-timeout", 10*time.Second, "timeout for alert webhook requests")
 
 	return ParseNonRelay(ctx, f, "validator-wallet")
 }
@@ -372,6 +668,8 @@ func ParseValidator(ctx context.Context) (*Config, *Wallet, *ethutils.RPCEthClie
 func ParseNonRelay(ctx context.Context, f *flag.FlagSet, defaultWalletPathname string) (*Config, *Wallet, *ethutils.RPCEthClient, *big.Int, error) {
 	f.String("bridge-utils-address", "", "bridgeutils contract address")
 
+	AddCoreConsensusCheckOptions(f)
+
 	f.Bool("core.profile.just-metadata", false, "just print database metadata and exit")
 	f.Int("core.profile.load-count", 0, "number of snapshots to load from database for profile test, zero to disable")
 	f.Int("core.profile.reorg-to", 0, "reorg to snapshot with given gas, zero to disable")
@@ -386,11 +684,15 @@ func ParseNonRelay(ctx context.Context, f *flag.FlagSet, defaultWalletPathname s
 	f.Bool("node.cache.allow-slow-lookup", false, "load L2 block from disk if not in memory cache")
 	f.Int("node.cache.lru-size", 1000, "number of recently used L2 block snapshots to hold in lru memory cache")
 	f.Int("node.cache.block-info-lru-size", 100_000, "number of recently used L2 block info to hold in lru memory cache")
+	AddNodeCacheReplayOptions(f)
 	//f.Duration("node.cache.timed-expire", 20*time.Minute, "length of time to hold L2 blocks in timed memory cache")
 
 	f.Uint64("node.chain-id", 42161, "chain id of the arbitrum chain")
 
 	f.String("l1.url", "", "layer 1 ethereum node RPC URL")
+	f.StringSlice("l1.fallback-urls", []string{}, "additional layer 1 ethereum node RPC URLs the inbox reader fails over to and cross-checks block hashes against")
+	AddL1LogFetchOptions(f)
+	AddL1TxManagerOptions(f)
 
 	f.String("persistent.global-config", ".arbitrum", "location global configuration is located")
 	f.String("persistent.chain", "", "path that chain specific state is located")
@@ -406,6 +708,12 @@ func ParseNonRelay(ctx context.Context, f *flag.FlagSet, defaultWalletPathname s
 	f.String("wallet.fireblocks.feed-signer.password", PASSWORD_NOT_SET, "password for feed-signer wallet")
 	f.String("wallet.fireblocks.feed-signer.private-key", "", "wallet feed-signer private key string")
 
+	f.String("wallet.remote.url", "", "URL of remote JSON-RPC signer to use instead of a local wallet")
+	f.String("wallet.remote.address", "", "address of the remote signer account used for L1 transactions")
+	f.String("wallet.remote.feed-signer-address", "", "address of the remote signer account used to sign the sequencer feed, defaults to wallet.remote.address")
+	f.String("wallet.remote.api", RemoteSignerEthAPI, "remote signer API: \"eth\" for Web3Signer style eth_signTransaction or \"account\" for Clef style account_signTransaction")
+	f.Duration("wallet.remote.timeout", 10*time.Second, "timeout for remote signer requests")
+
 	f.Bool("wait-to-catch-up", false, "wait to catch up to the chain before opening the RPC")
 
 	AddHealthcheckOptions(f)
@@ -444,6 +752,8 @@ func ParseNonRelay(ctx context.Context, f *flag.FlagSet, defaultWalletPathname s
 	rollupAddress := k.String("rollup.address")
 	if len(rollupAddress) != 0 {
 		logger.Info().Str("rollup", rollupAddress).Msg("using custom rollup address")
+	} else if k.Exists("rollups") {
+		logger.Info().Msg("using rollups list")
 	} else {
 		if l1ChainId.Cmp(big.NewInt(1)) == 0 {
 			err := k.Load(confmap.Provider(map[string]interface{}{
@@ -542,37 +852,74 @@ func ParseNonRelay(ctx context.Context, f *flag.FlagSet, defaultWalletPathname s
 		wallet.Fireblocks.FeedSigner.Pathname = path.Join(out.Persistent.Chain, wallet.Fireblocks.FeedSigner.Pathname)
 	}
 
-	_, err = os.Stat(out.Rollup.Machine.Filename)
-	if os.IsNotExist(err) && len(out.Rollup.Machine.URL) != 0 {
-		// Machine does not exist, so load it from provided URL
-		logger.Debug().Str("URL", out.Rollup.Machine.URL).Msg("downloading machine")
+	if err := downloadMachine(out.Rollup.Machine); err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-		resp, err := http.Get(out.Rollup.Machine.URL)
-		if err != nil {
-			return nil, nil, nil, nil, errors.Wrapf(err, "unable to get machine from: %s", out.Rollup.Machine.URL)
+	for i := range out.Rollups {
+		rollup := &out.Rollups[i]
+		if len(rollup.Chain) == 0 {
+			rollup.Chain = strings.ToLower(rollup.Address)
 		}
-		if resp.StatusCode != 200 {
-			return nil, nil, nil, nil, fmt.Errorf("HTTP status '%v' when trying to get machine from: %s", resp.Status, out.Rollup.Machine.URL)
+		if !filepath.IsAbs(rollup.Chain) {
+			rollup.Chain = path.Join(out.Persistent.GlobalConfig, rollup.Chain)
 		}
-
-		fileOut, err := os.Create(out.Rollup.Machine.Filename)
-		if err != nil {
-			return nil, nil, nil, nil, errors.Wrapf(err, "unable to open file '%s' for machine", out.Rollup.Machine.Filename)
+		if err := os.MkdirAll(rollup.Chain, os.ModePerm); err != nil {
+			return nil, nil, nil, nil, errors.Wrapf(err, "Unable to create chain directory for rollup %v", rollup.Address)
 		}
-
-		_, err = io.Copy(fileOut, resp.Body)
-		if err != nil {
-			return nil, nil, nil, nil, errors.Wrapf(err, "unable to output machine to: %s", out.Rollup.Machine.Filename)
+		if len(rollup.Machine.Filename) == 0 {
+			rollup.Machine.Filename = path.Join(rollup.Chain, "arbos.mexe")
+		}
+		if !filepath.IsAbs(rollup.Machine.Filename) {
+			rollup.Machine.Filename = path.Join(out.Persistent.GlobalConfig, rollup.Machine.Filename)
+		}
+		if err := downloadMachine(rollup.Machine); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if len(rollup.Wallet.Local.Pathname) != 0 && !filepath.IsAbs(rollup.Wallet.Local.Pathname) {
+			rollup.Wallet.Local.Pathname = path.Join(rollup.Chain, rollup.Wallet.Local.Pathname)
 		}
 	}
 
 	return out, wallet, l1Client, l1ChainId, nil
 }
 
+// downloadMachine fetches the machine from its URL if it doesn't exist yet
+func downloadMachine(machine RollupMachine) error {
+	_, err := os.Stat(machine.Filename)
+	if !os.IsNotExist(err) || len(machine.URL) == 0 {
+		return nil
+	}
+
+	logger.Debug().Str("URL", machine.URL).Msg("downloading machine")
+
+	resp, err := http.Get(machine.URL)
+	if err != nil {
+		return errors.Wrapf(err, "unable to get machine from: %s", machine.URL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("HTTP status '%v' when trying to get machine from: %s", resp.Status, machine.URL)
+	}
+
+	fileOut, err := os.Create(machine.Filename)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open file '%s' for machine", machine.Filename)
+	}
+	defer fileOut.Close()
+
+	_, err = io.Copy(fileOut, resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "unable to output machine to: %s", machine.Filename)
+	}
+	return nil
+}
+
 func ParseRelay() (*Config, error) {
 	f := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 
 	AddFeedOutputOptions(f)
+	AddHealthcheckOptions(f)
 
 	k, err := beginCommonParse(f)
 	if err != nil {
@@ -604,12 +951,23 @@ func AddHealthcheckOptions(f *flag.FlagSet) {
 	f.Bool("healthcheck.enable", false, "enable healthcheck endpoint")
 	f.Bool("healthcheck.sequencer", false, "enable checking the health of the sequencer")
 	f.Bool("healthcheck.l1-node", false, "enable checking the health of the L1 node")
+	f.StringSlice("healthcheck.l1-endpoints", []string{}, "additional L1 node RPC URLs to check alongside --l1.url")
+	f.Duration("healthcheck.l1-max-block-age", 2*time.Minute, "maximum age of an L1 node's latest block before it's considered unhealthy")
+	f.Int64("healthcheck.max-txdb-lag", 1000, "maximum number of core logs the transaction database can be behind before /readyz fails")
 	f.Bool("healthcheck.metrics", false, "enable prometheus endpoint")
 	f.String("healthcheck.metrics-prefix", "", "prepend the specified prefix to the exported metrics names")
 	f.String("healthcheck.addr", "", "address to bind the healthcheck endpoint to")
 	f.Int("healthcheck.port", 0, "port to bind the healthcheck endpoint to")
 }
 
+func AddTracingOptions(f *flag.FlagSet) {
+	f.String("tracing.exporter", "", "OpenTelemetry trace exporter: \"otlp\", \"file\" or empty to disable tracing")
+	f.String("tracing.file", "traces.json", "file to write traces to when using the file exporter")
+	f.String("tracing.otlp-endpoint", "localhost:4318", "host:port of the OTLP/HTTP trace collector")
+	f.Bool("tracing.otlp-insecure", false, "connect to the OTLP trace collector without TLS")
+	f.Float64("tracing.sample-ratio", 1, "fraction of traces to sample, requests that are already sampled upstream are always traced")
+}
+
 func beginCommonParse(f *flag.FlagSet) (*koanf.Koanf, error) {
 	f.Bool("conf.dump", false, "print out currently active configuration file")
 	f.String("conf.env-prefix", "", "environment variables with given prefix will be loaded as configuration values")
@@ -765,27 +1123,14 @@ func endCommonParse(k *koanf.Koanf) (*Config, *Wallet, error) {
 		return nil, nil, err
 	}
 
-	if len(out.Wallet.Fireblocks.SSLKey) != 0 {
-		if len(out.Wallet.Fireblocks.APIKey) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.api-key")
-		}
-		if len(out.Wallet.Fireblocks.BaseURL) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.base-url")
-		}
-		if len(out.Wallet.Fireblocks.SSLKey) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.ssl-key")
-		}
-		if len(out.Wallet.Fireblocks.SourceAddress) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.source-address")
-		}
-		if len(out.Wallet.Fireblocks.SourceId) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.source-id")
-		}
-		if len(out.Wallet.Fireblocks.SourceType) == 0 {
-			return nil, nil, errors.New("fireblocks configured but missing fireblocks.source-type")
+	if err := validateWallet(&out.Wallet); err != nil {
+		return nil, nil, err
+	}
+	for i := range out.Rollups {
+		out.Rollups[i].Wallet.setListDefaults()
+		if err := validateWallet(&out.Rollups[i].Wallet); err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid wallet for rollup %v", out.Rollups[i].Address)
 		}
-
-		out.Wallet.Fireblocks.SSLKey = strings.Replace(out.Wallet.Fireblocks.SSLKey, "\\n", "\n", -1)
 	}
 
 	if out.Conf.Dump {
@@ -801,6 +1146,14 @@ func endCommonParse(k *koanf.Koanf) (*Config, *Wallet, error) {
 			"wallet.local.password":                     "",
 			"wallet.local.private-key":                  "",
 		}, "."), nil)
+		if rollups, ok := k.Get("rollups").([]interface{}); ok {
+			for _, rollup := range rollups {
+				if rollup, ok := rollup.(map[string]interface{}); ok {
+					clearWalletSecrets(rollup["wallet"])
+				}
+			}
+			err = k.Load(confmap.Provider(map[string]interface{}{"rollups": rollups}, "."), nil)
+		}
 
 		c, err := k.Marshal(json.Parser())
 		if err != nil {
@@ -818,6 +1171,69 @@ func endCommonParse(k *koanf.Koanf) (*Config, *Wallet, error) {
 	return &out, &wallet, nil
 }
 
+// clearWalletSecrets blanks the passwords and keys in a wallet from the
+// rollups list, which can't be cleared by key like the top level wallet
+func clearWalletSecrets(wallet interface{}) {
+	walletMap, ok := wallet.(map[string]interface{})
+	if !ok {
+		return
+	}
+	clearKeys(walletMap["local"], "password", "private-key")
+	fireblocks, _ := walletMap["fireblocks"].(map[string]interface{})
+	clearKeys(fireblocks, "ssl-key", "ssl-key-password")
+	clearKeys(fireblocks["feed-signer"], "password", "private-key")
+}
+
+func clearKeys(section interface{}, keys ...string) {
+	values, ok := section.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			values[key] = ""
+		}
+	}
+}
+
+func validateWallet(w *Wallet) error {
+	if len(w.Fireblocks.SSLKey) != 0 {
+		if len(w.Fireblocks.APIKey) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.api-key")
+		}
+		if len(w.Fireblocks.BaseURL) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.base-url")
+		}
+		if len(w.Fireblocks.SSLKey) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.ssl-key")
+		}
+		if len(w.Fireblocks.SourceAddress) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.source-address")
+		}
+		if len(w.Fireblocks.SourceId) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.source-id")
+		}
+		if len(w.Fireblocks.SourceType) == 0 {
+			return errors.New("fireblocks configured but missing fireblocks.source-type")
+		}
+
+		w.Fireblocks.SSLKey = strings.Replace(w.Fireblocks.SSLKey, "\\n", "\n", -1)
+	}
+
+	if len(w.Remote.URL) != 0 {
+		if len(w.Fireblocks.SSLKey) != 0 {
+			return errors.New("can't configure both fireblocks and remote signer")
+		}
+		if len(w.Remote.Address) == 0 {
+			return errors.New("remote signer configured but missing remote.address")
+		}
+		if w.Remote.API != RemoteSignerEthAPI && w.Remote.API != RemoteSignerAccountAPI {
+			return errors.Errorf("unknown remote signer api %v", w.Remote.API)
+		}
+	}
+	return nil
+}
+
 func UnmarshalMap(marshalled string) map[string]string {
 	unmarshalled := make(map[string]string)
 	if len(marshalled) == 0 {
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configuration
+
+import (
+	"testing"
+)
+
+func testValidatorConfig() *Config {
+	config := &Config{BridgeUtilsAddress: "0xbridge"}
+	config.Persistent.Chain = "/data/mainnet"
+	config.Rollup.Address = "0xAAAA"
+	config.Rollup.Machine.Filename = "/data/mainnet/arbos.mexe"
+	config.Validator.Strategy = "StakeLatest"
+	config.Validator.UtilsAddress = "0xutils"
+	config.Validator.WalletFactoryAddress = "0xfactory"
+	return config
+}
+
+func TestValidatorRollupsWithoutList(t *testing.T) {
+	config := testValidatorConfig()
+	rollups := config.ValidatorRollups()
+	if len(rollups) != 1 || rollups[0] != config {
+		t.Fatal("expected only the single rollup config, got", rollups)
+	}
+}
+
+func TestValidatorRollupsMergesSingleRollup(t *testing.T) {
+	config := testValidatorConfig()
+	config.Rollups = []ValidatorRollup{
+		{
+			Address:  "0xBBBB",
+			Chain:    "/data/bbbb",
+			Strategy: "WatchOnly",
+		},
+		{
+			Address:      "0xCCCC",
+			Chain:        "/data/cccc",
+			UtilsAddress: "0xotherutils",
+			Wallet: Wallet{
+				Local: WalletLocal{Pathname: "/data/cccc/wallet", PasswordImpl: PASSWORD_NOT_SET},
+			},
+		},
+	}
+
+	rollups := config.ValidatorRollups()
+	if len(rollups) != 3 {
+		t.Fatal("expected 3 rollups, got", len(rollups))
+	}
+
+	single := rollups[0]
+	if single.Rollup.Address != "0xAAAA" || single.Persistent.Chain != "/data/mainnet" {
+		t.Error("single rollup settings not used", single.Rollup.Address, single.Persistent.Chain)
+	}
+	if single.Rollup.Machine.Filename != "/data/mainnet/arbos.mexe" {
+		t.Error("wrong machine for single rollup", single.Rollup.Machine.Filename)
+	}
+	if single.Wallet.IsSet() {
+		t.Error("single rollup has its own wallet")
+	}
+
+	for _, rollup := range rollups {
+		if len(rollup.Rollups) != 0 {
+			t.Error("rollup config contains rollups list")
+		}
+	}
+
+	watcher := rollups[1]
+	if watcher.Rollup.Address != "0xBBBB" || watcher.Persistent.Chain != "/data/bbbb" {
+		t.Error("wrong rollup", watcher.Rollup.Address, watcher.Persistent.Chain)
+	}
+	if watcher.Validator.Strategy != "WatchOnly" {
+		t.Error("strategy not overridden", watcher.Validator.Strategy)
+	}
+	if watcher.Validator.UtilsAddress != "0xutils" || watcher.BridgeUtilsAddress != "0xbridge" {
+		t.Error("top level addresses not inherited", watcher.Validator.UtilsAddress, watcher.BridgeUtilsAddress)
+	}
+	if watcher.Wallet.IsSet() {
+		t.Error("rollup without wallet has one set")
+	}
+
+	staker := rollups[2]
+	if staker.Validator.Strategy != "StakeLatest" {
+		t.Error("strategy not inherited", staker.Validator.Strategy)
+	}
+	if staker.Validator.UtilsAddress != "0xotherutils" || staker.Validator.WalletFactoryAddress != "0xfactory" {
+		t.Error("wrong validator addresses", staker.Validator.UtilsAddress, staker.Validator.WalletFactoryAddress)
+	}
+	if !staker.Wallet.IsSet() || staker.Wallet.Local.Pathname != "/data/cccc/wallet" {
+		t.Error("rollup wallet not used", staker.Wallet.Local)
+	}
+
+	if config.Validator.Strategy != "StakeLatest" || config.Rollup.Address != "0xAAAA" {
+		t.Error("top level config modified")
+	}
+}
+
+func TestValidatorRollupsSingleRollupInList(t *testing.T) {
+	config := testValidatorConfig()
+	config.Rollups = []ValidatorRollup{
+		{Address: "0xaaaa", Chain: "/data/aaaa", Strategy: "Defensive"},
+		{Address: "0xBBBB", Chain: "/data/bbbb"},
+	}
+
+	rollups := config.ValidatorRollups()
+	if len(rollups) != 2 {
+		t.Fatal("expected 2 rollups, got", len(rollups))
+	}
+	if rollups[0].Persistent.Chain != "/data/aaaa" || rollups[0].Validator.Strategy != "Defensive" {
+		t.Error("list entry not used for rollup from single rollup settings")
+	}
+	if rollups[1].Rollup.Address != "0xBBBB" {
+		t.Error("wrong second rollup", rollups[1].Rollup.Address)
+	}
+}
+
+func TestRollupWalletDefaults(t *testing.T) {
+	var wallet Wallet
+	if wallet.IsSet() {
+		t.Error("empty wallet is set")
+	}
+	wallet.Remote.URL = "http://localhost:9000"
+	wallet.Remote.Address = "0x1234"
+	wallet.setListDefaults()
+	if !wallet.IsSet() {
+		t.Error("remote wallet isn't set")
+	}
+	if wallet.Local.Password() != nil || wallet.Remote.API != RemoteSignerEthAPI || wallet.Remote.Timeout == 0 {
+		t.Error("flag defaults not applied", wallet)
+	}
+	if err := validateWallet(&wallet); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClearWalletSecrets(t *testing.T) {
+	wallet := map[string]interface{}{
+		"local": map[string]interface{}{
+			"pathname":    "wallet",
+			"password":    "secret",
+			"private-key": "key",
+		},
+		"fireblocks": map[string]interface{}{
+			"ssl-key": "sslkey",
+			"feed-signer": map[string]interface{}{
+				"private-key": "feedkey",
+			},
+		},
+	}
+	clearWalletSecrets(wallet)
+	local := wallet["local"].(map[string]interface{})
+	if local["pathname"] != "wallet" || local["password"] != "" || local["private-key"] != "" {
+		t.Error("local wallet not cleared correctly", local)
+	}
+	fireblocks := wallet["fireblocks"].(map[string]interface{})
+	if fireblocks["ssl-key"] != "" || fireblocks["feed-signer"].(map[string]interface{})["private-key"] != "" {
+		t.Error("fireblocks wallet not cleared", fireblocks)
+	}
+	if _, ok := fireblocks["ssl-key-password"]; ok {
+		t.Error("unset key added")
+	}
+}
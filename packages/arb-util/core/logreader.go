@@ -58,6 +58,11 @@ func (lr *LogReader) IsRunning() bool {
 	return lr.running
 }
 
+// Position returns the number of logs the consumer has received so far
+func (lr *LogReader) Position() (*big.Int, error) {
+	return lr.cursor.LogsCursorPosition(lr.cursorIndex)
+}
+
 func bigIntAsString(val *big.Int) string {
 	if val == nil {
 		return "nil"
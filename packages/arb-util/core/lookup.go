@@ -81,6 +81,10 @@ type ArbCoreLookup interface {
 	// TakeMachine takes ownership of machine such that ExecutionCursor will
 	// no longer be able to advance.
 	TakeMachine(executionCursor ExecutionCursor) (machine.Machine, error)
+
+	// GetSideloadPosition returns the total gas used when the machine
+	// reached the sideload for blockNumber
+	GetSideloadPosition(blockNumber uint64) (*big.Int, error)
 }
 
 type ArbCoreInbox interface {
@@ -159,6 +163,18 @@ type ArbCore interface {
 	StartThread() bool
 	StopThread()
 	MachineIdle() bool
+	ThreadRunning() bool
+}
+
+// CheckpointPruner is implemented by cores that can discard old machine
+// checkpoints to save disk space
+type CheckpointPruner interface {
+	// PruneCheckpoints asynchronously deletes checkpoints that have read
+	// fewer than deleteBeforeMessage messages, other than the newest one
+	// before the cutoff and, if saveMessageInterval is non-zero, the last
+	// checkpoint in each interval of that many messages
+	PruneCheckpoints(deleteBeforeMessage *big.Int, saveMessageInterval *big.Int)
+	CheckpointPruningPending() bool
 }
 
 func GetSingleMessage(lookup ArbOutputLookup, index *big.Int) (inbox.InboxMessage, error) {
@@ -263,4 +279,8 @@ type LogsCursor interface {
 	LogsCursorCheckError(cursorIndex *big.Int) error
 	LogsCursorConfirmReceived(cursorIndex *big.Int) (bool, error)
 	LogsCursorPosition(cursorIndex *big.Int) (*big.Int, error)
+
+	// LogsCursorRewind moves the cursor back so logs from count onwards are
+	// delivered again. It must not be called while the cursor is being read.
+	LogsCursorRewind(cursorIndex *big.Int, count *big.Int) error
 }
@@ -0,0 +1,472 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethutils
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "ethutils").Logger()
+
+var (
+	l1FailoverCounter      = metrics.NewRegisteredCounter("arbitrum/l1client/failovers", nil)
+	l1HashMismatchCounter  = metrics.NewRegisteredCounter("arbitrum/l1client/block_hash_mismatches", nil)
+	l1FaultyProvidersGauge = metrics.NewRegisteredGauge("arbitrum/l1client/faulty_providers", nil)
+)
+
+var (
+	ErrBlockHashMismatch    = errors.New("L1 providers disagree on block hash")
+	errNoProvidersAvailable = errors.New("no L1 providers available")
+)
+
+// How long a provider that disagreed with the others is left unused
+const faultyProviderBenchTime = 10 * time.Minute
+
+// BlockHashVerifier is implemented by clients backed by several providers
+// that can check the providers agree on a block
+type BlockHashVerifier interface {
+	// VerifyBlockHash returns the hash of the block that the providers agree
+	// on. ErrBlockHashMismatch is returned if there's no majority or the
+	// provider serving requests doesn't agree with it.
+	VerifyBlockHash(ctx context.Context, number *big.Int) (common.Hash, error)
+}
+
+// IsLogRangeError returns true if err indicates a log query covered too many
+// blocks or results for the provider, or took too long
+func IsLogRangeError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, pattern := range []string{
+		"query returned more than",
+		"response size exceeded",
+		"response size should not",
+		"log response size",
+		"block range",
+		"range is too large",
+		"limit exceeded",
+		"too many",
+		"timeout",
+		"timed out",
+	} {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldFailover returns true if err is a problem with the provider rather
+// than with the request, so that another provider might succeed
+func shouldFailover(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		// The provider answered, so only fail over if it refused the request
+		return IsLogRangeError(err)
+	}
+	return true
+}
+
+type provider struct {
+	name   string
+	client EthClient
+	// Providers that disagreed with the others aren't used until then
+	faultyUntil time.Time
+}
+
+// MultiEthClient sends requests to one of several L1 providers, failing over
+// to the next when a provider is unreachable or refuses a request. Providers
+// that disagree with the majority on a block hash are benched for a while.
+type MultiEthClient struct {
+	mu        sync.Mutex
+	providers []*provider
+	active    int
+}
+
+func NewMultiEthClient(names []string, clients []EthClient) (*MultiEthClient, error) {
+	if len(clients) == 0 || len(names) != len(clients) {
+		return nil, errors.New("need a name for each of at least one L1 client")
+	}
+	providers := make([]*provider, 0, len(clients))
+	for i, client := range clients {
+		providers = append(providers, &provider{name: names[i], client: client})
+	}
+	return &MultiEthClient{providers: providers}, nil
+}
+
+// DialMultiEthClient connects to each of the urls, the first of which is
+// used until it fails
+func DialMultiEthClient(urls []string) (*MultiEthClient, error) {
+	clients := make([]EthClient, 0, len(urls))
+	for _, url := range urls {
+		client, err := NewRPCEthClient(url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error connecting to ethereum L1 node: %s", url)
+		}
+		clients = append(clients, client)
+	}
+	return NewMultiEthClient(urls, clients)
+}
+
+// WithFallbacks returns primary if there are no fallbackURLs, and otherwise a
+// MultiEthClient that uses primary until it fails
+func WithFallbacks(primary EthClient, primaryURL string, fallbackURLs []string) (EthClient, error) {
+	if len(fallbackURLs) == 0 {
+		return primary, nil
+	}
+	names := []string{primaryURL}
+	clients := []EthClient{primary}
+	for _, url := range fallbackURLs {
+		client, err := NewRPCEthClient(url)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error connecting to ethereum L1 node: %s", url)
+		}
+		names = append(names, url)
+		clients = append(clients, client)
+	}
+	return NewMultiEthClient(names, clients)
+}
+
+// candidates returns the providers to try in order, starting with the active
+// one. Faulty providers are left out unless every provider is faulty.
+func (m *MultiEthClient) candidates() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var healthy, faulty []int
+	for i := range m.providers {
+		index := (m.active + i) % len(m.providers)
+		if now.Before(m.providers[index].faultyUntil) {
+			faulty = append(faulty, index)
+		} else {
+			healthy = append(healthy, index)
+		}
+	}
+	l1FaultyProvidersGauge.Update(int64(len(faulty)))
+	if len(healthy) == 0 {
+		return faulty
+	}
+	return healthy
+}
+
+func (m *MultiEthClient) setActive(index int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != index {
+		logger.Warn().
+			Str("from", m.providers[m.active].name).
+			Str("to", m.providers[index].name).
+			Msg("switching L1 provider")
+		l1FailoverCounter.Inc(1)
+		m.active = index
+	}
+}
+
+func (m *MultiEthClient) try(ctx context.Context, f func(EthClient) error) error {
+	err := errNoProvidersAvailable
+	for _, index := range m.candidates() {
+		err = f(m.providers[index].client)
+		if !shouldFailover(ctx, err) {
+			if err == nil {
+				m.setActive(index)
+			}
+			return err
+		}
+		logger.Warn().Err(err).Str("provider", m.providers[index].name).Msg("L1 provider request failed")
+	}
+	return err
+}
+
+// VerifyBlockHash asks every provider for the block's hash. Providers that
+// don't match the majority are benched, and if that includes the active
+// provider ErrBlockHashMismatch is returned so that data it served can be
+// fetched again. Providers that don't have the block yet are ignored. Recent
+// blocks may legitimately differ between providers, so this should only be
+// used for blocks some confirmations behind the tip.
+func (m *MultiEthClient) VerifyBlockHash(ctx context.Context, number *big.Int) (common.Hash, error) {
+	m.mu.Lock()
+	providers := append([]*provider{}, m.providers...)
+	active := m.providers[m.active]
+	m.mu.Unlock()
+	if len(providers) < 2 {
+		var info *BlockInfo
+		err := m.try(ctx, func(c EthClient) (err error) {
+			info, err = c.BlockInfoByNumber(ctx, number)
+			return
+		})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return info.Hash, nil
+	}
+
+	hashes := make([]*common.Hash, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p *provider) {
+			defer wg.Done()
+			info, err := p.client.BlockInfoByNumber(ctx, number)
+			if err != nil {
+				logger.Debug().Err(err).Str("provider", p.name).Str("block", number.String()).Msg("couldn't cross-check block")
+				errs[i] = err
+				return
+			}
+			hashes[i] = &info.Hash
+		}(i, p)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return common.Hash{}, ctx.Err()
+	}
+
+	votes := make(map[common.Hash]int)
+	responses := 0
+	for _, hash := range hashes {
+		if hash != nil {
+			votes[*hash]++
+			responses++
+		}
+	}
+	if responses == 0 {
+		return common.Hash{}, errors.Wrapf(errs[0], "no L1 provider returned block %v", number)
+	}
+	var majority common.Hash
+	foundMajority := false
+	for hash, count := range votes {
+		if count*2 > responses {
+			majority = hash
+			foundMajority = true
+		}
+	}
+	if len(votes) == 1 {
+		return majority, nil
+	}
+	l1HashMismatchCounter.Inc(1)
+	if !foundMajority {
+		logger.Error().Str("block", number.String()).Msg("L1 providers disagree on block hash with no majority")
+		return common.Hash{}, ErrBlockHashMismatch
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activeFaulty := false
+	for i, hash := range hashes {
+		if hash == nil || *hash == majority {
+			continue
+		}
+		logger.Error().
+			Str("provider", providers[i].name).
+			Str("block", number.String()).
+			Hex("hash", hash.Bytes()).
+			Hex("majority", majority.Bytes()).
+			Msg("L1 provider disagrees with others on block hash")
+		providers[i].faultyUntil = time.Now().Add(faultyProviderBenchTime)
+		if providers[i] == active {
+			activeFaulty = true
+		}
+	}
+	if activeFaulty {
+		return common.Hash{}, ErrBlockHashMismatch
+	}
+	return majority, nil
+}
+
+func (m *MultiEthClient) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) (ret []byte, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.CodeAt(ctx, contract, blockNumber)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (ret []byte, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.CallContract(ctx, call, blockNumber)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) PendingCallContract(ctx context.Context, call ethereum.CallMsg) (ret []byte, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.PendingCallContract(ctx, call)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) HeaderByNumber(ctx context.Context, number *big.Int) (ret *types.Header, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.HeaderByNumber(ctx, number)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) HeaderByHash(ctx context.Context, hash common.Hash) (ret *types.Header, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.HeaderByHash(ctx, hash)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) BlockByHash(ctx context.Context, hash common.Hash) (ret *types.Block, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.BlockByHash(ctx, hash)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) BlockInfoByNumber(ctx context.Context, number *big.Int) (ret *BlockInfo, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.BlockInfoByNumber(ctx, number)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) PendingCodeAt(ctx context.Context, account common.Address) (ret []byte, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.PendingCodeAt(ctx, account)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) PendingNonceAt(ctx context.Context, account common.Address) (ret uint64, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.PendingNonceAt(ctx, account)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (ret uint64, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.NonceAt(ctx, account, blockNumber)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (ret *big.Int, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.BalanceAt(ctx, account, blockNumber)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) SuggestGasPrice(ctx context.Context) (ret *big.Int, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.SuggestGasPrice(ctx)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) SuggestGasTipCap(ctx context.Context) (ret *big.Int, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.SuggestGasTipCap(ctx)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (ret uint64, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.EstimateGas(ctx, call)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return m.try(ctx, func(c EthClient) error {
+		return c.SendTransaction(ctx, tx)
+	})
+}
+
+func (m *MultiEthClient) FilterLogs(ctx context.Context, query ethereum.FilterQuery) (ret []types.Log, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.FilterLogs(ctx, query)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ret ethereum.Subscription, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.SubscribeFilterLogs(ctx, query, ch)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (ret *types.Receipt, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.TransactionReceipt(ctx, txHash)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		tx, isPending, err = c.TransactionByHash(ctx, hash)
+		return
+	})
+	return
+}
+
+func (m *MultiEthClient) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (ret *types.Transaction, err error) {
+	err = m.try(ctx, func(c EthClient) (err error) {
+		ret, err = c.TransactionInBlock(ctx, blockHash, index)
+		return
+	})
+	return
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethutils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+type rpcTestError struct {
+	message string
+}
+
+func (e rpcTestError) Error() string  { return e.message }
+func (e rpcTestError) ErrorCode() int { return -32000 }
+
+type testProvider struct {
+	EthClient
+	err   error
+	hash  common.Hash
+	calls int
+}
+
+func (p *testProvider) FilterLogs(context.Context, ethereum.FilterQuery) ([]types.Log, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return []types.Log{{BlockHash: p.hash}}, nil
+}
+
+func (p *testProvider) BlockInfoByNumber(context.Context, *big.Int) (*BlockInfo, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &BlockInfo{Hash: p.hash}, nil
+}
+
+func newTestMultiClient(t *testing.T, providers ...*testProvider) *MultiEthClient {
+	names := make([]string, 0, len(providers))
+	clients := make([]EthClient, 0, len(providers))
+	for i, p := range providers {
+		names = append(names, string(rune('a'+i)))
+		clients = append(clients, p)
+	}
+	client, err := NewMultiEthClient(names, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	ctx := context.Background()
+	hash := common.HexToHash("0x01")
+	a := &testProvider{err: errors.New("connection refused"), hash: hash}
+	b := &testProvider{hash: hash}
+	client := newTestMultiClient(t, a, b)
+
+	if _, err := client.FilterLogs(ctx, ethereum.FilterQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Fatalf("expected one call to each provider, got %v and %v", a.calls, b.calls)
+	}
+	// The working provider stays active
+	if _, err := client.FilterLogs(ctx, ethereum.FilterQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if a.calls != 1 || b.calls != 2 {
+		t.Fatalf("expected second call to go to the fallback, got %v and %v", a.calls, b.calls)
+	}
+
+	// Errors about the request itself aren't retried elsewhere
+	b.err = rpcTestError{"execution reverted"}
+	if _, err := client.FilterLogs(ctx, ethereum.FilterQuery{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if a.calls != 1 {
+		t.Fatal("failed over on a request error")
+	}
+
+	// But range limits are
+	a.err = nil
+	b.err = rpcTestError{"query returned more than 10000 results"}
+	if _, err := client.FilterLogs(ctx, ethereum.FilterQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if a.calls != 2 {
+		t.Fatal("didn't fail over on a range limit")
+	}
+}
+
+func TestMultiClientVerifyBlockHash(t *testing.T) {
+	ctx := context.Background()
+	hash := common.HexToHash("0x01")
+	liar := &testProvider{hash: common.HexToHash("0x02")}
+	b := &testProvider{hash: hash}
+	c := &testProvider{hash: hash}
+	client := newTestMultiClient(t, liar, b, c)
+
+	if _, err := client.VerifyBlockHash(ctx, big.NewInt(10)); !errors.Is(err, ErrBlockHashMismatch) {
+		t.Fatalf("expected mismatch error but got %v", err)
+	}
+	// The lying provider is skipped until its bench time is up
+	if _, err := client.FilterLogs(ctx, ethereum.FilterQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	if liar.calls != 0 || b.calls != 1 {
+		t.Fatalf("expected request to skip lying provider, got %v and %v", liar.calls, b.calls)
+	}
+	// Now that an honest provider is active, verification passes
+	verified, err := client.VerifyBlockHash(ctx, big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != hash {
+		t.Fatal("verified hash", verified, "isn't the majority hash")
+	}
+
+	// Providers without the block are ignored, and with no majority
+	// verification fails
+	c.err = ethereum.NotFound
+	if _, err := client.VerifyBlockHash(ctx, big.NewInt(10)); !errors.Is(err, ErrBlockHashMismatch) {
+		t.Fatalf("expected mismatch error but got %v", err)
+	}
+	liar.hash = hash
+	if _, err := client.VerifyBlockHash(ctx, big.NewInt(10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verification fails if no provider has the block
+	liar.err = ethereum.NotFound
+	b.err = ethereum.NotFound
+	if _, err := client.VerifyBlockHash(ctx, big.NewInt(10)); !errors.Is(err, ethereum.NotFound) {
+		t.Fatalf("expected not found error but got %v", err)
+	}
+}
+
+func TestMultiClientVerifySingleProvider(t *testing.T) {
+	hash := common.HexToHash("0x01")
+	client := newTestMultiClient(t, &testProvider{hash: hash})
+	verified, err := client.VerifyBlockHash(context.Background(), big.NewInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified != hash {
+		t.Fatal("verified hash", verified, "isn't the provider's hash")
+	}
+}
+
+func TestIsLogRangeError(t *testing.T) {
+	for _, message := range []string{
+		"query returned more than 10000 results",
+		"Log response size exceeded. You can make eth_getLogs requests with up to a 2K block range",
+		"exceed maximum block range: 5000",
+		"limit exceeded",
+	} {
+		if !IsLogRangeError(rpcTestError{message}) {
+			t.Errorf("%v not detected as range error", message)
+		}
+	}
+	if !IsLogRangeError(errors.Wrap(context.DeadlineExceeded, "lookup")) {
+		t.Error("timeout not detected as range error")
+	}
+	if IsLogRangeError(rpcTestError{"execution reverted"}) {
+		t.Error("revert detected as range error")
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethutils
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// SimulatedClient is implemented by clients backed by an in memory chain
+// where blocks are only produced when Commit is called
+type SimulatedClient interface {
+	EthClient
+	Commit()
+}
+
+// ReorgEthClient is a simulated L1 that can replace its most recent blocks
+// with a longer side chain, so that reorg handling can be exercised while
+// other components are using the client.
+//
+// Unlike the underlying simulated backend, transactions with the wrong nonce
+// are rejected with an error rather than a panic, since components that
+// track their own nonces won't know about transactions dropped by a reorg.
+type ReorgEthClient struct {
+	*SimulatedEthClient
+
+	// Serializes transaction submission and block production with reorgs
+	mutex   sync.Mutex
+	signer  types.Signer
+	pending []*types.Transaction
+}
+
+func NewReorgEthClient(backend *backends.SimulatedBackend) *ReorgEthClient {
+	return &ReorgEthClient{
+		SimulatedEthClient: &SimulatedEthClient{SimulatedBackend: backend},
+		signer:             types.LatestSignerForChainID(backend.Blockchain().Config().ChainID),
+	}
+}
+
+func (c *ReorgEthClient) Commit() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commit()
+}
+
+func (c *ReorgEthClient) commit() {
+	c.SimulatedBackend.Commit()
+	c.pending = nil
+}
+
+func (c *ReorgEthClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sendTransaction(ctx, tx)
+}
+
+func (c *ReorgEthClient) sendTransaction(ctx context.Context, tx *types.Transaction) error {
+	sender, err := types.Sender(c.signer, tx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	nonce, err := c.SimulatedBackend.PendingNonceAt(ctx, sender)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if tx.Nonce() < nonce {
+		return errors.Wrapf(core.ErrNonceTooLow, "address %v, tx: %d state: %d", sender, tx.Nonce(), nonce)
+	}
+	if tx.Nonce() > nonce {
+		return errors.Wrapf(core.ErrNonceTooHigh, "address %v, tx: %d state: %d", sender, tx.Nonce(), nonce)
+	}
+	if err := c.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, tx)
+	return nil
+}
+
+// Reorg replaces the last depth blocks with a chain of depth+1 blocks.
+// Transactions from the replaced blocks for which replay returns true are
+// included in the first block of the new chain, in their original order, and
+// the rest are returned. Pending transactions stay pending on the new chain.
+// A transaction is also dropped if an earlier transaction from the same
+// sender was, since its nonce is no longer valid.
+func (c *ReorgEthClient) Reorg(ctx context.Context, depth uint64, replay func(*types.Transaction) bool) ([]*types.Transaction, error) {
+	if depth == 0 {
+		return nil, errors.New("reorg depth must be positive")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pending := c.pending
+	c.SimulatedBackend.Rollback()
+	c.pending = nil
+	head, err := c.SimulatedBackend.BlockByNumber(ctx, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if head.NumberU64() < depth {
+		return nil, errors.Errorf("can't reorg %v blocks from chain of height %v", depth, head.NumberU64())
+	}
+	orphaned := make([]*types.Block, depth)
+	orphaned[depth-1] = head
+	for i := int(depth) - 2; i >= 0; i-- {
+		orphaned[i], err = c.SimulatedBackend.BlockByHash(ctx, orphaned[i+1].ParentHash())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if err := c.SimulatedBackend.Fork(ctx, orphaned[0].ParentHash()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var dropped []*types.Transaction
+	resend := func(tx *types.Transaction) error {
+		err := c.sendTransaction(ctx, tx)
+		if errors.Is(err, core.ErrNonceTooHigh) {
+			dropped = append(dropped, tx)
+			return nil
+		}
+		return err
+	}
+	for _, block := range orphaned {
+		for _, tx := range block.Transactions() {
+			if replay == nil || !replay(tx) {
+				dropped = append(dropped, tx)
+				continue
+			}
+			if err := resend(tx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The side chain becomes canonical once it's longer than the old chain
+	for i := uint64(0); i <= depth; i++ {
+		c.commit()
+	}
+	for _, tx := range pending {
+		if err := resend(tx); err != nil {
+			return nil, err
+		}
+	}
+	return dropped, nil
+}
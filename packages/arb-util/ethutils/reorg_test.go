@@ -0,0 +1,105 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ethutils
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+func sendTransfer(t *testing.T, client *ReorgEthClient, auth *bind.TransactOpts, nonce uint64) (*types.Transaction, error) {
+	t.Helper()
+	ctx := context.Background()
+	head, err := client.HeaderByNumber(ctx, nil)
+	test.FailIfError(t, err)
+	gasPrice := new(big.Int).Mul(head.BaseFee, big.NewInt(2))
+	tx := types.NewTransaction(nonce, common.Address{5}, big.NewInt(1), 21000, gasPrice, nil)
+	signed, err := auth.Signer(auth.From, tx)
+	test.FailIfError(t, err)
+	return signed, client.SendTransaction(ctx, signed)
+}
+
+func TestReorgEthClient(t *testing.T) {
+	ctx := context.Background()
+	backend, auths := test.SimulatedBackend(t)
+	client := NewReorgEthClient(backend)
+	kept, lost := auths[0], auths[1]
+
+	for i := 0; i < 5; i++ {
+		client.Commit()
+	}
+	var keptTxs, lostTxs []*types.Transaction
+	for i := uint64(0); i < 3; i++ {
+		tx, err := sendTransfer(t, client, kept, i)
+		test.FailIfError(t, err)
+		keptTxs = append(keptTxs, tx)
+		tx, err = sendTransfer(t, client, lost, i)
+		test.FailIfError(t, err)
+		lostTxs = append(lostTxs, tx)
+		client.Commit()
+	}
+	oldHead, err := client.HeaderByNumber(ctx, nil)
+	test.FailIfError(t, err)
+
+	if _, err := sendTransfer(t, client, kept, 5); !errors.Is(err, core.ErrNonceTooHigh) {
+		t.Fatalf("expected nonce error but got %v", err)
+	}
+
+	dropped, err := client.Reorg(ctx, 2, func(tx *types.Transaction) bool {
+		return tx.Hash() != lostTxs[1].Hash()
+	})
+	test.FailIfError(t, err)
+	if len(dropped) != 2 || dropped[0].Hash() != lostTxs[1].Hash() || dropped[1].Hash() != lostTxs[2].Hash() {
+		t.Fatalf("wrong transactions dropped by reorg: %v", len(dropped))
+	}
+
+	newHead, err := client.HeaderByNumber(ctx, nil)
+	test.FailIfError(t, err)
+	if newHead.Number.Uint64() != oldHead.Number.Uint64()+1 {
+		t.Fatalf("expected new head at %v but got %v", oldHead.Number.Uint64()+1, newHead.Number)
+	}
+	canonical, err := client.HeaderByNumber(ctx, oldHead.Number)
+	test.FailIfError(t, err)
+	if canonical.Hash() == oldHead.Hash() {
+		t.Fatal("old head still canonical after reorg")
+	}
+
+	for _, tx := range append(keptTxs, lostTxs[0]) {
+		if _, err := client.TransactionReceipt(ctx, tx.Hash()); err != nil {
+			t.Fatalf("missing receipt for replayed transaction: %v", err)
+		}
+	}
+	for _, tx := range dropped {
+		if receipt, err := client.TransactionReceipt(ctx, tx.Hash()); err == nil && receipt != nil {
+			t.Fatal("found receipt for dropped transaction")
+		}
+	}
+	// The dropped sender can continue from its nonce on the new chain
+	if _, err := sendTransfer(t, client, lost, 1); err != nil {
+		t.Fatal(err)
+	}
+	client.Commit()
+}
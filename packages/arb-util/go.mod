@@ -9,6 +9,7 @@ require (
 	github.com/gobwas/ws v1.0.4
 	github.com/gobwas/ws-examples v0.0.0-20190625122829-a9e8908d9484
 	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/holiman/uint256 v1.2.0
 	github.com/knadh/koanf v1.2.2
 	github.com/mailru/easygo v0.0.0-20190618140210-3c14a0dc985f
 	github.com/mitchellh/mapstructure v1.4.1
@@ -17,6 +18,11 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/rs/zerolog v1.24.0
 	github.com/spf13/pflag v1.0.5
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 )
 
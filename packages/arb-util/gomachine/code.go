@@ -0,0 +1,141 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"sync"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var errCodePointHash = value.HashCodePoint(value.BasicOperation{Op: 0}, common.Hash{})
+
+// codeSegment holds operations in reverse execution order. Index 0 is always
+// the error code point, and the code point at index i continues to the one at
+// index i-1.
+type codeSegment struct {
+	id     uint64
+	ops    []value.Operation
+	hashes []common.Hash
+}
+
+func newCodeSegment(id uint64) *codeSegment {
+	seg := &codeSegment{id: id}
+	seg.addOperation(value.BasicOperation{Op: 0})
+	return seg
+}
+
+func (s *codeSegment) addOperation(op value.Operation) value.CodePointStub {
+	var prevHash common.Hash
+	if len(s.hashes) > 0 {
+		prevHash = s.hashes[len(s.hashes)-1]
+	}
+	h := value.HashCodePoint(op, prevHash)
+	s.ops = append(s.ops, op)
+	s.hashes = append(s.hashes, h)
+	return value.NewCodePointStub(s.id, uint64(len(s.ops)-1), h)
+}
+
+func (s *codeSegment) codePoint(pc uint64) value.CodePointValue {
+	var nextHash common.Hash
+	if pc > 0 {
+		nextHash = s.hashes[pc-1]
+	}
+	return value.CodePointValue{Op: s.ops[pc], NextHash: nextHash}
+}
+
+// code is shared between a machine and all of its clones. Segments only ever
+// grow, so references into a segment stay valid as other machines modify it.
+type code struct {
+	sync.RWMutex
+	segments    map[uint64]*codeSegment
+	nextSegment uint64
+}
+
+func newCode() *code {
+	return &code{segments: make(map[uint64]*codeSegment)}
+}
+
+func (c *code) newSegment() *codeSegment {
+	seg := newCodeSegment(c.nextSegment)
+	c.segments[seg.id] = seg
+	c.nextSegment++
+	return seg
+}
+
+type codePointRef struct {
+	segment uint64
+	pc      uint64
+}
+
+func stubRef(stub value.CodePointStub) codePointRef {
+	return codePointRef{segment: stub.Segment, pc: stub.PC}
+}
+
+func (c *code) operation(ref codePointRef) value.Operation {
+	c.RLock()
+	defer c.RUnlock()
+	return c.segments[ref.segment].ops[ref.pc]
+}
+
+func (c *code) codePoint(ref codePointRef) value.CodePointValue {
+	c.RLock()
+	defer c.RUnlock()
+	return c.segments[ref.segment].codePoint(ref.pc)
+}
+
+func (c *code) codePointHash(ref codePointRef) common.Hash {
+	c.RLock()
+	defer c.RUnlock()
+	return c.segments[ref.segment].hashes[ref.pc]
+}
+
+// addSegment creates a new segment containing only the error code point
+func (c *code) addSegment() value.CodePointStub {
+	c.Lock()
+	defer c.Unlock()
+	seg := c.newSegment()
+	return value.NewCodePointStub(seg.id, 0, errCodePointHash)
+}
+
+// addOperation returns a code point which executes op and then continues at
+// ref. If ref is the most recently added code point in its segment, op is
+// appended in place, otherwise the segment is copied up to ref first.
+func (c *code) addOperation(ref codePointRef, op value.Operation) value.CodePointStub {
+	c.Lock()
+	defer c.Unlock()
+	seg := c.segments[ref.segment]
+	if ref.pc == uint64(len(seg.ops)-1) {
+		return seg.addOperation(op)
+	}
+	newSeg := &codeSegment{
+		id:     c.nextSegment,
+		ops:    append([]value.Operation{}, seg.ops[:ref.pc+1]...),
+		hashes: append([]common.Hash{}, seg.hashes[:ref.pc+1]...),
+	}
+	c.segments[newSeg.id] = newSeg
+	c.nextSegment++
+	return newSeg.addOperation(op)
+}
+
+func (c *code) contains(ref codePointRef) bool {
+	c.RLock()
+	defer c.RUnlock()
+	seg, ok := c.segments[ref.segment]
+	return ok && ref.pc < uint64(len(seg.ops))
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+	"github.com/holiman/uint256"
+)
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808A, 0x8000000080008000,
+	0x000000000000808B, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008A, 0x0000000000000088, 0x0000000080008009, 0x000000008000000A,
+	0x000000008000808B, 0x800000000000008B, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800A, 0x800000008000000A,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// keccakF1600 applies the keccak-f[1600] permutation where lane (x, y) is
+// stored at index x + 5y
+func keccakF1600(a *[25]uint64) {
+	var b [25]uint64
+	var c, d [5]uint64
+	for round := 0; round < 24; round++ {
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d[x] = c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+		}
+		for i := 0; i < 25; i++ {
+			a[i] ^= d[i%5]
+		}
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], keccakRotations[x+5*y])
+			}
+		}
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 5; x++ {
+				a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y])
+			}
+		}
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
+
+var sha256K = [64]uint32{
+	0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+	0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+	0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+	0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+	0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+	0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+	0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+	0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+}
+
+// sha256Block runs the sha256 compression function on a single 64 byte block
+func sha256Block(h *[8]uint32, block []byte) {
+	var w [64]uint32
+	for i := 0; i < 16; i++ {
+		w[i] = binary.BigEndian.Uint32(block[i*4:])
+	}
+	for i := 16; i < 64; i++ {
+		s0 := bits.RotateLeft32(w[i-15], -7) ^ bits.RotateLeft32(w[i-15], -18) ^ (w[i-15] >> 3)
+		s1 := bits.RotateLeft32(w[i-2], -17) ^ bits.RotateLeft32(w[i-2], -19) ^ (w[i-2] >> 10)
+		w[i] = w[i-16] + s0 + w[i-7] + s1
+	}
+	a, b, c, d, e, f, g, hh := h[0], h[1], h[2], h[3], h[4], h[5], h[6], h[7]
+	for i := 0; i < 64; i++ {
+		s1 := bits.RotateLeft32(e, -6) ^ bits.RotateLeft32(e, -11) ^ bits.RotateLeft32(e, -25)
+		ch := (e & f) ^ (^e & g)
+		t1 := hh + s1 + ch + sha256K[i] + w[i]
+		s0 := bits.RotateLeft32(a, -2) ^ bits.RotateLeft32(a, -13) ^ bits.RotateLeft32(a, -22)
+		maj := (a & b) ^ (a & c) ^ (b & c)
+		t2 := s0 + maj
+		hh, g, f, e, d, c, b, a = g, f, e, d+t1, c, b, a, t1+t2
+	}
+	h[0] += a
+	h[1] += b
+	h[2] += c
+	h[3] += d
+	h[4] += e
+	h[5] += f
+	h[6] += g
+	h[7] += hh
+}
+
+func sha256Compress(digest, first, second *uint256.Int) *uint256.Int {
+	digestBytes := digest.Bytes32()
+	var h [8]uint32
+	for i := range h {
+		h[i] = binary.BigEndian.Uint32(digestBytes[i*4:])
+	}
+	var block [64]byte
+	firstBytes := first.Bytes32()
+	secondBytes := second.Bytes32()
+	copy(block[:32], firstBytes[:])
+	copy(block[32:], secondBytes[:])
+	sha256Block(&h, block[:])
+	var out [32]byte
+	for i := range h {
+		binary.BigEndian.PutUint32(out[i*4:], h[i])
+	}
+	return new(uint256.Int).SetBytes(out[:])
+}
+
+// ecRecover returns the address that signed the message, or zero if the
+// signature is invalid
+func ecRecover(r, s, recovery, message *uint256.Int) *uint256.Int {
+	if !recovery.IsUint64() || recovery.Uint64() > 1 {
+		return new(uint256.Int)
+	}
+	rBytes := r.Bytes32()
+	sBytes := s.Bytes32()
+	msgBytes := message.Bytes32()
+	sig := make([]byte, 65)
+	copy(sig[:32], rBytes[:])
+	copy(sig[32:64], sBytes[:])
+	sig[64] = byte(recovery.Uint64())
+	pubKey, err := crypto.Ecrecover(msgBytes[:], sig)
+	if err != nil {
+		return new(uint256.Int)
+	}
+	hash := crypto.Keccak256(pubKey[1:])
+	return new(uint256.Int).SetBytes(hash[12:])
+}
+
+func g1Point(x, y *uint256.Int) (*bn256.G1, error) {
+	xBytes := x.Bytes32()
+	yBytes := y.Bytes32()
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(append(xBytes[:], yBytes[:]...)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func g2Point(x0, x1, y0, y1 *uint256.Int) (*bn256.G2, error) {
+	var data []byte
+	// bn256 expects the imaginary component of each coordinate first
+	for _, component := range []*uint256.Int{x1, x0, y1, y0} {
+		b := component.Bytes32()
+		data = append(data, b[:]...)
+	}
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func g1Coordinates(p *bn256.G1) (*uint256.Int, *uint256.Int) {
+	data := p.Marshal()
+	return new(uint256.Int).SetBytes(data[:32]), new(uint256.Int).SetBytes(data[32:64])
+}
+
+func ecAdd(ax, ay, bx, by *uint256.Int) (*uint256.Int, *uint256.Int, error) {
+	a, err := g1Point(ax, ay)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := g1Point(bx, by)
+	if err != nil {
+		return nil, nil, err
+	}
+	x, y := g1Coordinates(new(bn256.G1).Add(a, b))
+	return x, y, nil
+}
+
+func ecMul(ax, ay, factor *uint256.Int) (*uint256.Int, *uint256.Int, error) {
+	a, err := g1Point(ax, ay)
+	if err != nil {
+		return nil, nil, err
+	}
+	x, y := g1Coordinates(new(bn256.G1).ScalarMult(a, factor.ToBig()))
+	return x, y, nil
+}
+
+type ecPairingPoint struct {
+	g1 [2]*uint256.Int
+	g2 [4]*uint256.Int
+}
+
+func ecPairing(points []ecPairingPoint) (bool, error) {
+	g1s := make([]*bn256.G1, 0, len(points))
+	g2s := make([]*bn256.G2, 0, len(points))
+	for _, point := range points {
+		g1, err := g1Point(point.g1[0], point.g1[1])
+		if err != nil {
+			return false, err
+		}
+		g2, err := g2Point(point.g2[0], point.g2[1], point.g2[2], point.g2[3])
+		if err != nil {
+			return false, err
+		}
+		g1s = append(g1s, g1)
+		g2s = append(g2s, g2)
+	}
+	return bn256.PairingCheck(g1s, g2s), nil
+}
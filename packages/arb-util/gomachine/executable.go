@@ -0,0 +1,156 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+type jsonExecutable struct {
+	Code      []jsonOperation `json:"code"`
+	StaticVal json.RawMessage `json:"static_val"`
+}
+
+type jsonOperation struct {
+	Opcode    json.RawMessage `json:"opcode"`
+	Immediate json.RawMessage `json:"immediate"`
+}
+
+type jsonValue struct {
+	Int       *string           `json:"Int"`
+	Tuple     []json.RawMessage `json:"Tuple"`
+	CodePoint *struct {
+		Internal json.Number `json:"Internal"`
+	} `json:"CodePoint"`
+	Buffer *string `json:"Buffer"`
+}
+
+// loadExecutable parses a compiled .mexe file into a code segment and static
+// value, matching the loader in arb-avm-cpp
+func loadExecutable(rd io.Reader, c *code) (value.Value, error) {
+	decoder := json.NewDecoder(rd)
+	decoder.UseNumber()
+	var executable jsonExecutable
+	if err := decoder.Decode(&executable); err != nil {
+		return nil, errors.Wrap(err, "error parsing executable")
+	}
+	if executable.StaticVal == nil {
+		return nil, errors.New("executable missing static value")
+	}
+
+	seg := c.newSegment()
+	opCount := uint64(len(executable.Code))
+	for i := len(executable.Code) - 1; i >= 0; i-- {
+		op, err := parseOperation(executable.Code[i], opCount, seg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing operation %v", i)
+		}
+		seg.addOperation(op)
+	}
+	staticVal, err := parseValue(executable.StaticVal, opCount, seg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing static value")
+	}
+	return staticVal, nil
+}
+
+func parseOperation(jsonOp jsonOperation, opCount uint64, seg *codeSegment) (value.Operation, error) {
+	opcodeData := jsonOp.Opcode
+	var wrapped struct {
+		AVMOpcode json.RawMessage `json:"AVMOpcode"`
+	}
+	if len(opcodeData) > 0 && opcodeData[0] == '{' {
+		if err := json.Unmarshal(opcodeData, &wrapped); err != nil {
+			return nil, err
+		}
+		opcodeData = wrapped.AVMOpcode
+	}
+	opcode, err := strconv.ParseUint(string(opcodeData), 10, 8)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid opcode")
+	}
+	if len(jsonOp.Immediate) == 0 || bytes.Equal(jsonOp.Immediate, []byte("null")) {
+		return value.BasicOperation{Op: value.Opcode(opcode)}, nil
+	}
+	imm, err := parseValue(jsonOp.Immediate, opCount, seg)
+	if err != nil {
+		return nil, err
+	}
+	return value.ImmediateOperation{Op: value.Opcode(opcode), Val: imm}, nil
+}
+
+func parseValue(data json.RawMessage, opCount uint64, seg *codeSegment) (value.Value, error) {
+	var val jsonValue
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&val); err != nil {
+		return nil, err
+	}
+	switch {
+	case val.Int != nil:
+		i, ok := new(big.Int).SetString(*val.Int, 16)
+		if !ok || i.Sign() < 0 || i.BitLen() > 256 {
+			return nil, errors.Errorf("invalid int %v", *val.Int)
+		}
+		return value.NewIntValue(i), nil
+	case val.Tuple != nil:
+		if len(val.Tuple) > value.MaxTupleSize {
+			return nil, errors.New("tuple must contain array of size less than 9")
+		}
+		vals := make([]value.Value, 0, len(val.Tuple))
+		for _, item := range val.Tuple {
+			v, err := parseValue(item, opCount, seg)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return value.NewTupleFromSlice(vals)
+	case val.CodePoint != nil:
+		offset, err := strconv.ParseUint(string(val.CodePoint.Internal), 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "codepoint internal label must fit within a uint64")
+		}
+		pc := uint64(0)
+		// The compiler uses the max value as a marker for the error code point
+		if offset != math.MaxUint64 {
+			pc = opCount - offset
+		}
+		if pc >= uint64(len(seg.ops)) {
+			return nil, errors.Errorf("codepoint %v references code that isn't loaded yet", offset)
+		}
+		return value.NewCodePointStub(seg.id, pc, seg.hashes[pc]), nil
+	case val.Buffer != nil:
+		contents, err := hex.DecodeString(*val.Buffer)
+		if err != nil {
+			return nil, errors.Wrap(err, "buffer must be hex")
+		}
+		return newBuffer(contents), nil
+	default:
+		return nil, errors.New("invalid value type")
+	}
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+)
+
+var testsPath = filepath.Join("..", "..", "arb-avm-cpp", "tests")
+
+func TestMachineHash(t *testing.T) {
+	mach, err := New(filepath.Join(testsPath, "contract.mexe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyHash := "42512909751185556122923115391154208487752310613213055089416300774052282720344"
+	checks := []struct {
+		name     string
+		hash     common.Hash
+		expected string
+	}{
+		{"pc", mach.CodePointHash(), "94370651106686220754648249265079798778273932128194559331492955050019282050496"},
+		{"stack", mach.stack.hash(), emptyHash},
+		{"auxstack", mach.auxstack.hash(), emptyHash},
+		{"register", mach.registerVal.Hash(), emptyHash},
+		{"static", mach.staticVal.Hash(), "113182352889449210665994027227588754290969798016938687372921424809289618385856"},
+		{"errpc", mach.errpc.Hash(), "81755589384323691266272576345129881657705914621008081459572116739688988488432"},
+		{"machine", mach.Hash(), "56208326812724912066026123588383649819390601658448049319166841561743369815863"},
+	}
+	for _, check := range checks {
+		if hash := check.hash.ToEthHash().Big().String(); hash != check.expected {
+			t.Errorf("%v hash was %v but expected %v", check.name, hash, check.expected)
+		}
+	}
+}
+
+func TestMachineTestVectors(t *testing.T) {
+	files := []string{
+		"opcodetestarbgas", "opcodetestdup", "opcodetestecops",
+		"opcodetestethhash2", "opcodetesthash", "opcodetestlogic",
+		"opcodetestmath", "opcodeteststack", "opcodetesttuple",
+		"opcodetestcode", "opcodetestkeccakf", "opcodetestsha256f",
+	}
+	for _, file := range files {
+		t.Run(file, func(t *testing.T) {
+			mach, err := New(filepath.Join(testsPath, "machine-cases", file+".mexe"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for mach.IsBlocked(false) == nil {
+				if _, _, _, err := mach.ExecuteAssertion(0, true, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if mach.CurrentStatus() != machine.Halt {
+				t.Fatal("machine didn't halt", mach)
+			}
+		})
+	}
+}
+
+func TestMarshalForProof(t *testing.T) {
+	mach, err := New(filepath.Join(testsPath, "machine-cases", "buffer_test.mexe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gasUsed := uint64(0)
+	for mach.IsBlocked(false) == nil {
+		proof, _, err := mach.MarshalForProof()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proof[0] != byte(mach.code.operation(mach.pc).GetOp()) {
+			t.Fatal("proof should start with the opcode")
+		}
+		assertion, _, _, err := mach.ExecuteAssertion(gasUsed+1, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gasUsed += assertion.NumGas
+	}
+}
+
+func TestStoppingOnSideload(t *testing.T) {
+	origMach, err := New(filepath.Join(testsPath, "machine-cases", "sideloadtest.mexe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sideload := []inbox.InboxMessage{inbox.NewRandomInboxMessage()}
+
+	run := func(mach machine.Machine, sideloads []inbox.InboxMessage, stopOnSideload bool, status machine.Status, gas uint64) {
+		t.Helper()
+		assertion, _, _, err := mach.ExecuteAssertionAdvanced(0, false, nil, sideloads, stopOnSideload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mach.CurrentStatus() != status {
+			t.Error("unexpected status", mach.CurrentStatus(), "expected", status)
+		}
+		if assertion.NumGas != gas {
+			t.Error("unexpected gas", assertion.NumGas, "expected", gas)
+		}
+	}
+
+	// Run straight past the sideload
+	run(origMach.Clone(), nil, false, machine.ErrorStop, 13)
+
+	// Run past the sideload with a value specified
+	run(origMach.Clone(), sideload, true, machine.Halt, 23)
+
+	// Stop on the sideload and continue without a value
+	mach := origMach.Clone()
+	run(mach, nil, true, machine.Extensive, 1)
+	run(mach, nil, true, machine.ErrorStop, 12)
+
+	// Stop on the sideload and continue with a value
+	mach = origMach.Clone()
+	run(mach, nil, true, machine.Extensive, 1)
+	run(mach, sideload, true, machine.Halt, 22)
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	mach, err := New(filepath.Join(testsPath, "machine-cases", "opcodetestmath.mexe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startHash := mach.Hash()
+	clone := mach.Clone()
+	if _, _, _, err := clone.ExecuteAssertion(100, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if clone.Hash() == startHash {
+		t.Fatal("clone didn't run")
+	}
+	if mach.Hash() != startHash {
+		t.Fatal("running clone modified original")
+	}
+}
+
+func TestGasLimit(t *testing.T) {
+	mach, err := New(filepath.Join(testsPath, "machine-cases", "opcodetestmath.mexe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, _, steps, err := mach.ExecuteAssertion(50, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion.NumGas > 50 {
+		t.Error("used too much gas", assertion.NumGas)
+	}
+	if steps == 0 {
+		t.Error("didn't execute any steps")
+	}
+}
+
+func TestKeccakF(t *testing.T) {
+	// Absorbing a single padded block of the empty message with the keccak256
+	// rate gives its hash in the first four lanes
+	var state [25]uint64
+	state[0] ^= 0x01
+	state[16] ^= 0x80 << 56
+	keccakF1600(&state)
+	var out bytes.Buffer
+	for i := 0; i < 4; i++ {
+		_ = binary.Write(&out, binary.LittleEndian, state[i])
+	}
+	if !bytes.Equal(out.Bytes(), crypto.Keccak256(nil)) {
+		t.Errorf("got %x expected %x", out.Bytes(), crypto.Keccak256(nil))
+	}
+}
+
+func TestBufferProofLength(t *testing.T) {
+	data := make([]byte, 100)
+	data[99] = 1
+	buf := newBuffer(data)
+	if buf.Depth() != 2 {
+		t.Fatal("unexpected depth", buf.Depth())
+	}
+	proof := bufferProof(buf, 99)
+	if len(proof) != 3*32 {
+		t.Fatal("unexpected proof length", len(proof))
+	}
+	if !bytes.Equal(proof[:32], getBufferBytes(buf, 96, 32)) {
+		t.Error("proof should start with the leaf")
+	}
+	// Combining the leaf with the siblings should give the root
+	leaf := crypto.Keccak256(proof[:32])
+	level1 := crypto.Keccak256(proof[32:64], leaf)
+	root := crypto.Keccak256(proof[64:96], level1)
+	if !bytes.Equal(root, buf.MerkleRoot().Bytes()) {
+		t.Error("proof doesn't match root")
+	}
+
+	if buf := newBuffer(nil); !bytes.Equal(bufferProof(buf, 1000), make([]byte, 32)) {
+		t.Error("empty buffer should prove a single empty leaf")
+	}
+}
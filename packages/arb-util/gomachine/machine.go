@@ -0,0 +1,371 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package gomachine is an AVM interpreter written in Go. It follows the
+// semantics of the C++ machine in arb-avm-cpp exactly, including gas, hashing
+// and one step proofs, so the two implementations can be used
+// interchangeably where the C++ core isn't available.
+package gomachine
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/inbox"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/protocol"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+type status int
+
+const (
+	statusExtensive status = iota
+	statusHalted
+	statusError
+)
+
+var maxArbGasRemaining = new(uint256.Int).SetAllOne()
+
+type sideloadBlocked struct {
+	blockNum *uint256.Int
+}
+
+func (b sideloadBlocked) IsBlocked(machine.Machine, bool) bool {
+	return true
+}
+
+func (b sideloadBlocked) Equals(a machine.BlockReason) bool {
+	o, ok := a.(sideloadBlocked)
+	return ok && o.blockNum.Eq(b.blockNum)
+}
+
+type assertionContext struct {
+	inboxMessages    []inbox.InboxMessage
+	sideloads        []inbox.InboxMessage
+	stopOnSideload   bool
+	firstInstruction bool
+	messagesConsumed uint64
+	sends            [][]byte
+	logs             []value.Value
+	debugPrints      []value.Value
+}
+
+type Machine struct {
+	code            *code
+	registerVal     value.Value
+	staticVal       value.Value
+	stack           datastack
+	auxstack        datastack
+	arbGasRemaining uint256.Int
+	state           status
+	pc              codePointRef
+	errpc           value.CodePointStub
+
+	arbGasUsed uint64
+	totalSteps uint64
+
+	context *assertionContext
+}
+
+func New(codeFile string) (*Machine, error) {
+	f, err := os.Open(codeFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating machine from file %s", codeFile)
+	}
+	defer f.Close()
+	c := newCode()
+	staticVal, err := loadExecutable(f, c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating machine from file %s", codeFile)
+	}
+	m := &Machine{
+		code:        c,
+		registerVal: value.NewEmptyTuple(),
+		staticVal:   staticVal,
+		pc:          codePointRef{segment: 0, pc: uint64(len(c.segments[0].ops) - 1)},
+		errpc:       value.NewCodePointStub(0, 0, errCodePointHash),
+	}
+	m.arbGasRemaining.Set(maxArbGasRemaining)
+	return m, nil
+}
+
+func (m *Machine) Hash() common.Hash {
+	switch m.state {
+	case statusHalted:
+		return common.Hash{}
+	case statusError:
+		return common.NewHashFromEth(ethcommon.BigToHash(big.NewInt(1)))
+	}
+	gas := m.arbGasRemaining.Bytes32()
+	return hashing.SoliditySHA3(
+		hashing.Bytes32(m.CodePointHash()),
+		hashing.Bytes32(m.stack.hash()),
+		hashing.Bytes32(m.auxstack.hash()),
+		hashing.Bytes32(m.registerVal.Hash()),
+		hashing.Bytes32(m.staticVal.Hash()),
+		gas[:],
+		hashing.Bytes32(m.errpc.Hash()),
+	)
+}
+
+func (m *Machine) CodePointHash() common.Hash {
+	return m.code.codePointHash(m.pc)
+}
+
+func (m *Machine) Clone() machine.Machine {
+	ret := &Machine{
+		code:        m.code,
+		registerVal: m.registerVal,
+		staticVal:   m.staticVal,
+		stack:       m.stack.clone(),
+		auxstack:    m.auxstack.clone(),
+		state:       m.state,
+		pc:          m.pc,
+		errpc:       m.errpc,
+		arbGasUsed:  m.arbGasUsed,
+		totalSteps:  m.totalSteps,
+	}
+	ret.arbGasRemaining.Set(&m.arbGasRemaining)
+	return ret
+}
+
+func (m *Machine) CurrentStatus() machine.Status {
+	switch m.state {
+	case statusHalted:
+		return machine.Halt
+	case statusError:
+		return machine.ErrorStop
+	default:
+		return machine.Extensive
+	}
+}
+
+func (m *Machine) IsBlocked(newMessages bool) machine.BlockReason {
+	switch m.state {
+	case statusError:
+		return machine.ErrorBlocked{}
+	case statusHalted:
+		return machine.HaltBlocked{}
+	}
+	if m.code.operation(m.pc).GetOp() == opInbox && !newMessages {
+		return machine.InboxBlocked{}
+	}
+	return nil
+}
+
+func (m *Machine) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "hash %v\n", m.Hash())
+	fmt.Fprintf(&buf, "status %v\n", m.state)
+	fmt.Fprintf(&buf, "pc (%v, %v)\n", m.pc.segment, m.pc.pc)
+	fmt.Fprintf(&buf, "data stack: %v\n", m.stack.String())
+	fmt.Fprintf(&buf, "operation %v\n", m.code.operation(m.pc))
+	fmt.Fprintf(&buf, "codePointHash %v\n", m.CodePointHash())
+	fmt.Fprintf(&buf, "stackHash %v\n", m.stack.hash())
+	fmt.Fprintf(&buf, "auxStackHash %v\n", m.auxstack.hash())
+	fmt.Fprintf(&buf, "registerHash %v\n", m.registerVal.Hash())
+	fmt.Fprintf(&buf, "staticHash %v\n", m.staticVal.Hash())
+	fmt.Fprintf(&buf, "arb_gas_remaining %v\n", m.arbGasRemaining.ToBig())
+	fmt.Fprintf(&buf, "err handler %v\n", m.errpc)
+	return buf.String()
+}
+
+func (m *Machine) ExecuteAssertion(
+	maxGas uint64,
+	goOverGas bool,
+	messages []inbox.InboxMessage,
+) (*protocol.ExecutionAssertion, []value.Value, uint64, error) {
+	return m.ExecuteAssertionAdvanced(maxGas, goOverGas, messages, nil, false)
+}
+
+func (m *Machine) ExecuteAssertionAdvanced(
+	maxGas uint64,
+	goOverGas bool,
+	messages []inbox.InboxMessage,
+	sideloads []inbox.InboxMessage,
+	stopOnSideload bool,
+) (*protocol.ExecutionAssertion, []value.Value, uint64, error) {
+	m.context = &assertionContext{
+		inboxMessages:    messages,
+		sideloads:        append([]inbox.InboxMessage{}, sideloads...),
+		stopOnSideload:   stopOnSideload,
+		firstInstruction: true,
+		sends:            make([][]byte, 0),
+		logs:             make([]value.Value, 0),
+		debugPrints:      make([]value.Value, 0),
+	}
+	defer func() {
+		m.context = nil
+	}()
+
+	startSteps := m.totalSteps
+	startGas := m.arbGasUsed
+
+	// Like the C++ machine, the gas limit applies to the total gas used by the
+	// machine rather than the gas used in this assertion
+	hasGasLimit := maxGas != 0
+	for {
+		if hasGasLimit {
+			if !goOverGas {
+				nextGas := new(uint256.Int).Add(uint256.NewInt(m.nextGasCost()), uint256.NewInt(m.arbGasUsed))
+				if nextGas.GtUint64(maxGas) {
+					break
+				}
+			} else if m.arbGasUsed >= maxGas {
+				break
+			}
+		}
+		if blockReason := m.runOne(); blockReason != nil {
+			break
+		}
+	}
+
+	assertion := &protocol.ExecutionAssertion{
+		NumGas:                m.arbGasUsed - startGas,
+		InboxMessagesConsumed: m.context.messagesConsumed,
+		Sends:                 m.context.sends,
+		Logs:                  m.context.logs,
+	}
+	return assertion, m.context.debugPrints, m.totalSteps - startSteps, nil
+}
+
+func (m *Machine) chargeErrorGas() {
+	if m.arbGasRemaining.LtUint64(errorGasCost) {
+		m.arbGasRemaining.Set(maxArbGasRemaining)
+	} else {
+		m.arbGasRemaining.SubUint64(&m.arbGasRemaining, errorGasCost)
+	}
+	m.arbGasUsed += errorGasCost
+}
+
+func (m *Machine) nextGasCost() uint64 {
+	return m.gasCost(m.code.operation(m.pc).GetOp())
+}
+
+func (m *Machine) gasCost(op value.Opcode) uint64 {
+	gas := opTable[op].gas
+	if op == opEcpairing {
+		gas += m.ecPairingVariableGasCost()
+	}
+	return gas
+}
+
+func (m *Machine) runOne() machine.BlockReason {
+	switch m.state {
+	case statusError:
+		return machine.ErrorBlocked{}
+	case statusHalted:
+		return machine.HaltBlocked{}
+	}
+
+	op := m.code.operation(m.pc)
+	immOp, hasImmediate := op.(value.ImmediateOperation)
+	if hasImmediate {
+		m.stack.push(immOp.Val)
+	}
+
+	startStackSize := uint64(m.stack.size())
+	startAuxStackSize := uint64(m.auxstack.size())
+
+	info := opTable[op.GetOp()]
+	var stackArgCount, auxArgCount uint64
+	if info.validEntry {
+		stackArgCount = uint64(len(info.stackPops))
+		auxArgCount = uint64(len(info.auxPops))
+	}
+
+	blockReason := func() machine.BlockReason {
+		if stackArgCount > startStackSize || auxArgCount > startAuxStackSize {
+			m.state = statusError
+			m.chargeErrorGas()
+			return nil
+		}
+
+		gasCost := uint64(errorGasCost)
+		if info.validEntry {
+			gasCost = m.gasCost(op.GetOp())
+		}
+		if m.arbGasRemaining.LtUint64(gasCost) {
+			// With insufficient gas the machine errors and gets its gas reset
+			m.arbGasUsed += errorGasCost
+			m.arbGasRemaining.Set(maxArbGasRemaining)
+			m.state = statusError
+			return nil
+		}
+		m.arbGasRemaining.SubUint64(&m.arbGasRemaining, gasCost)
+		m.arbGasUsed += gasCost
+
+		if !info.validEntry {
+			m.state = statusError
+			return nil
+		}
+
+		blockReason, err := m.runOp(op.GetOp())
+		if err != nil {
+			m.state = statusError
+		}
+		if blockReason != nil {
+			// Blocking undoes everything about the step other than any
+			// change to the pc
+			m.arbGasRemaining.AddUint64(&m.arbGasRemaining, gasCost)
+			m.arbGasUsed -= gasCost
+			if hasImmediate {
+				m.stack.pop()
+			}
+			return blockReason
+		}
+		return nil
+	}()
+
+	if blockReason == nil {
+		m.totalSteps++
+	}
+
+	if m.state == statusError {
+		// Clear the arguments of the failed instruction off the stacks
+		for m.stack.size() > 0 && startStackSize-uint64(m.stack.size()) < stackArgCount {
+			m.stack.pop()
+		}
+		for m.auxstack.size() > 0 && startAuxStackSize-uint64(m.auxstack.size()) < auxArgCount {
+			m.auxstack.pop()
+		}
+		// Jump to the error handler if one is set
+		if m.errpc.Hash() != errCodePointHash {
+			m.pc = stubRef(m.errpc)
+			m.state = statusExtensive
+		}
+	}
+
+	m.context.firstInstruction = false
+	return blockReason
+}
+
+// MarshalState serializes the machine in the format used by the one step
+// proof checker for an instruction's starting state
+func (m *Machine) MarshalState() ([]byte, error) {
+	var buf bytes.Buffer
+	m.marshalState(&buf, m.CodePointHash(), m.stack.preImage(), m.auxstack.preImage())
+	return buf.Bytes(), nil
+}
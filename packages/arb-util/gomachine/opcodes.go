@@ -0,0 +1,225 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import "github.com/offchainlabs/arbitrum/packages/arb-util/value"
+
+const (
+	opAdd        value.Opcode = 0x01
+	opMul        value.Opcode = 0x02
+	opSub        value.Opcode = 0x03
+	opDiv        value.Opcode = 0x04
+	opSdiv       value.Opcode = 0x05
+	opMod        value.Opcode = 0x06
+	opSmod       value.Opcode = 0x07
+	opAddmod     value.Opcode = 0x08
+	opMulmod     value.Opcode = 0x09
+	opExp        value.Opcode = 0x0a
+	opSignextend value.Opcode = 0x0b
+
+	opLt     value.Opcode = 0x10
+	opGt     value.Opcode = 0x11
+	opSlt    value.Opcode = 0x12
+	opSgt    value.Opcode = 0x13
+	opEq     value.Opcode = 0x14
+	opIszero value.Opcode = 0x15
+	opAnd    value.Opcode = 0x16
+	opOr     value.Opcode = 0x17
+	opXor    value.Opcode = 0x18
+	opNot    value.Opcode = 0x19
+	opByte   value.Opcode = 0x1a
+	opShl    value.Opcode = 0x1b
+	opShr    value.Opcode = 0x1c
+	opSar    value.Opcode = 0x1d
+
+	opHash     value.Opcode = 0x20
+	opType     value.Opcode = 0x21
+	opEthhash2 value.Opcode = 0x22
+	opKeccakf  value.Opcode = 0x23
+	opSha256f  value.Opcode = 0x24
+
+	opPop           value.Opcode = 0x30
+	opSpush         value.Opcode = 0x31
+	opRpush         value.Opcode = 0x32
+	opRset          value.Opcode = 0x33
+	opJump          value.Opcode = 0x34
+	opCjump         value.Opcode = 0x35
+	opStackempty    value.Opcode = 0x36
+	opPcpush        value.Opcode = 0x37
+	opAuxpush       value.Opcode = 0x38
+	opAuxpop        value.Opcode = 0x39
+	opAuxstackempty value.Opcode = 0x3a
+	opNop           value.Opcode = 0x3b
+	opErrpush       value.Opcode = 0x3c
+	opErrset        value.Opcode = 0x3d
+
+	opDup0  value.Opcode = 0x40
+	opDup1  value.Opcode = 0x41
+	opDup2  value.Opcode = 0x42
+	opSwap1 value.Opcode = 0x43
+	opSwap2 value.Opcode = 0x44
+
+	opTget value.Opcode = 0x50
+	opTset value.Opcode = 0x51
+	opTlen value.Opcode = 0x52
+	opXget value.Opcode = 0x53
+	opXset value.Opcode = 0x54
+
+	opBreakpoint value.Opcode = 0x60
+	opLog        value.Opcode = 0x61
+
+	opSend         value.Opcode = 0x70
+	opInbox        value.Opcode = 0x72
+	opError        value.Opcode = 0x73
+	opHalt         value.Opcode = 0x74
+	opSetGas       value.Opcode = 0x75
+	opPushGas      value.Opcode = 0x76
+	opErrCodePoint value.Opcode = 0x77
+	opPushInsn     value.Opcode = 0x78
+	opPushInsnImm  value.Opcode = 0x79
+	opSideload     value.Opcode = 0x7b
+
+	opEcrecover value.Opcode = 0x80
+	opEcadd     value.Opcode = 0x81
+	opEcmul     value.Opcode = 0x82
+	opEcpairing value.Opcode = 0x83
+
+	opDebugPrint value.Opcode = 0x90
+
+	opNewBuffer    value.Opcode = 0xa0
+	opGetBuffer8   value.Opcode = 0xa1
+	opGetBuffer64  value.Opcode = 0xa2
+	opGetBuffer256 value.Opcode = 0xa3
+	opSetBuffer8   value.Opcode = 0xa4
+	opSetBuffer64  value.Opcode = 0xa5
+	opSetBuffer256 value.Opcode = 0xa6
+)
+
+// Opcodes have the error op's cost when they're invalid. Execution limits are
+// the same as the ones in arb-avm-cpp.
+const (
+	errorGasCost       = 5
+	sendSizeLimit      = 10000
+	maxEcPairingPoints = 30
+	ecPairingGasCost   = 500000
+)
+
+type opInfo struct {
+	gas        uint64
+	stackPops  []int
+	auxPops    []int
+	validEntry bool
+}
+
+var opTable [256]opInfo
+
+func init() {
+	add := func(op value.Opcode, gas uint64, stackPops []int, auxPops []int) {
+		opTable[op] = opInfo{gas: gas, stackPops: stackPops, auxPops: auxPops, validEntry: true}
+	}
+	binary := []int{1, 1}
+	unary := []int{1}
+
+	add(opAdd, 3, binary, nil)
+	add(opMul, 3, binary, nil)
+	add(opSub, 3, binary, nil)
+	add(opDiv, 4, binary, nil)
+	add(opSdiv, 7, binary, nil)
+	add(opMod, 4, binary, nil)
+	add(opSmod, 7, binary, nil)
+	add(opAddmod, 4, []int{1, 1, 1}, nil)
+	add(opMulmod, 4, []int{1, 1, 1}, nil)
+	add(opExp, 25, binary, nil)
+	add(opSignextend, 7, binary, nil)
+
+	add(opLt, 2, binary, nil)
+	add(opGt, 2, binary, nil)
+	add(opSlt, 2, binary, nil)
+	add(opSgt, 2, binary, nil)
+	add(opEq, 2, []int{0, 0}, nil)
+	add(opIszero, 1, unary, nil)
+	add(opAnd, 2, binary, nil)
+	add(opOr, 2, binary, nil)
+	add(opXor, 2, binary, nil)
+	add(opNot, 1, unary, nil)
+	add(opByte, 4, binary, nil)
+	add(opShl, 4, binary, nil)
+	add(opShr, 4, binary, nil)
+	add(opSar, 4, binary, nil)
+
+	add(opHash, 7, []int{0}, nil)
+	add(opType, 3, unary, nil)
+	add(opEthhash2, 8, binary, nil)
+	add(opKeccakf, 600, unary, nil)
+	add(opSha256f, 250, []int{1, 1, 1}, nil)
+
+	add(opPop, 1, []int{0}, nil)
+	add(opSpush, 1, nil, nil)
+	add(opRpush, 1, nil, nil)
+	add(opRset, 2, []int{0}, nil)
+	add(opJump, 4, []int{0}, nil)
+	add(opCjump, 4, binary, nil)
+	add(opStackempty, 2, nil, nil)
+	add(opPcpush, 1, nil, nil)
+	add(opAuxpush, 1, []int{0}, nil)
+	add(opAuxpop, 1, nil, []int{0})
+	add(opAuxstackempty, 2, nil, nil)
+	add(opNop, 1, nil, nil)
+	add(opErrpush, 1, nil, nil)
+	add(opErrset, 1, unary, nil)
+
+	add(opDup0, 1, []int{0}, nil)
+	add(opDup1, 1, []int{0, 0}, nil)
+	add(opDup2, 1, []int{0, 0, 0}, nil)
+	add(opSwap1, 1, []int{0, 0}, nil)
+	add(opSwap2, 1, []int{0, 0, 0}, nil)
+
+	add(opTget, 2, binary, nil)
+	add(opTset, 40, []int{1, 1, 0}, nil)
+	add(opTlen, 2, unary, nil)
+	add(opXget, 3, unary, []int{1})
+	add(opXset, 41, []int{1, 0}, []int{1})
+
+	add(opBreakpoint, 100, nil, nil)
+	add(opLog, 100, []int{0}, nil)
+
+	add(opSend, 100, binary, nil)
+	add(opInbox, 40, nil, nil)
+	add(opError, errorGasCost, nil, nil)
+	add(opHalt, 10, nil, nil)
+	add(opSetGas, 1, unary, nil)
+	add(opPushGas, 1, nil, nil)
+	add(opErrCodePoint, 25, nil, nil)
+	add(opPushInsn, 25, binary, nil)
+	add(opPushInsnImm, 25, []int{1, 0, 1}, nil)
+	add(opSideload, 10, unary, nil)
+
+	add(opEcrecover, 20000, []int{1, 1, 1, 1}, nil)
+	add(opEcadd, 3500, []int{1, 1, 1, 1}, nil)
+	add(opEcmul, 82000, []int{1, 1, 1}, nil)
+	add(opEcpairing, 1000, []int{32}, nil)
+
+	add(opDebugPrint, 1, []int{0}, nil)
+
+	add(opNewBuffer, 1, nil, nil)
+	add(opGetBuffer8, 10, binary, nil)
+	add(opGetBuffer64, 10, binary, nil)
+	add(opGetBuffer256, 10, binary, nil)
+	add(opSetBuffer8, 100, []int{1, 1, 1}, nil)
+	add(opSetBuffer64, 100, []int{1, 1, 1}, nil)
+	add(opSetBuffer256, 100, []int{1, 1, 1}, nil)
+}
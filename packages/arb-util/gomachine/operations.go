@@ -0,0 +1,805 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/machine"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+// runOp executes a single valid instruction whose arguments are known to be
+// on the stack. A returned error puts the machine into the error state.
+func (m *Machine) runOp(op value.Opcode) (machine.BlockReason, error) {
+	switch op {
+	case opAdd:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Add(a, b) })
+	case opMul:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Mul(a, b) })
+	case opSub:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Sub(a, b) })
+	case opDiv:
+		return nil, m.divOp(func(a, b *uint256.Int) *uint256.Int { return a.Div(a, b) })
+	case opSdiv:
+		return nil, m.divOp(func(a, b *uint256.Int) *uint256.Int { return a.SDiv(a, b) })
+	case opMod:
+		return nil, m.divOp(func(a, b *uint256.Int) *uint256.Int { return a.Mod(a, b) })
+	case opSmod:
+		return nil, m.divOp(func(a, b *uint256.Int) *uint256.Int { return a.SMod(a, b) })
+	case opAddmod:
+		return nil, m.modOp(func(a, b, c *uint256.Int) *uint256.Int { return a.AddMod(a, b, c) })
+	case opMulmod:
+		return nil, m.modOp(func(a, b, c *uint256.Int) *uint256.Int { return a.MulMod(a, b, c) })
+	case opExp:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Exp(a, b) })
+	case opSignextend:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int {
+			if a.LtUint64(31) {
+				return b.ExtendSign(b, a)
+			}
+			return b
+		})
+	case opLt:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return boolInt(a.Lt(b)) })
+	case opGt:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return boolInt(a.Gt(b)) })
+	case opSlt:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return boolInt(a.Slt(b)) })
+	case opSgt:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return boolInt(a.Sgt(b)) })
+	case opEq:
+		equal := valuesEqual(m.stack.peek(0), m.stack.peek(1))
+		m.stack.set(1, intValue(boolInt(equal)))
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opIszero:
+		return nil, m.unaryOp(func(a *uint256.Int) *uint256.Int { return boolInt(a.IsZero()) })
+	case opAnd:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.And(a, b) })
+	case opOr:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Or(a, b) })
+	case opXor:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return a.Xor(a, b) })
+	case opNot:
+		return nil, m.unaryOp(func(a *uint256.Int) *uint256.Int { return a.Not(a) })
+	case opByte:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int { return b.Byte(a) })
+	case opShl:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int {
+			if !a.LtUint64(256) {
+				return b.Clear()
+			}
+			return b.Lsh(b, uint(a.Uint64()))
+		})
+	case opShr:
+		return nil, m.binaryOp(shr)
+	case opSar:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int {
+			if b.Sign() >= 0 {
+				return shr(a, b)
+			}
+			if !a.LtUint64(256) {
+				return b.SetAllOne()
+			}
+			return b.SRsh(b, uint(a.Uint64()))
+		})
+
+	case opHash:
+		m.stack.set(0, value.NewIntValue(m.stack.peek(0).Hash().ToEthHash().Big()))
+		m.incrementPC()
+		return nil, nil
+	case opType:
+		m.stack.set(0, value.NewInt64Value(int64(typeCode(m.stack.peek(0)))))
+		m.incrementPC()
+		return nil, nil
+	case opEthhash2:
+		return nil, m.binaryOp(func(a, b *uint256.Int) *uint256.Int {
+			aBytes := a.Bytes32()
+			bBytes := b.Bytes32()
+			h := hashing.SoliditySHA3(aBytes[:], bBytes[:])
+			return new(uint256.Int).SetBytes(h[:])
+		})
+	case opKeccakf:
+		return nil, m.keccakF()
+	case opSha256f:
+		return nil, m.sha256F()
+
+	case opPop:
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opSpush:
+		m.stack.push(m.staticVal)
+		m.incrementPC()
+		return nil, nil
+	case opRpush:
+		m.stack.push(m.registerVal)
+		m.incrementPC()
+		return nil, nil
+	case opRset:
+		m.registerVal = m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opJump:
+		target, err := assumeCodePoint(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		m.pc = stubRef(target)
+		m.stack.pop()
+		return nil, nil
+	case opCjump:
+		target, err := assumeCodePoint(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		cond, err := assumeInt(m.stack.peek(1))
+		if err != nil {
+			return nil, err
+		}
+		if !cond.IsZero() {
+			m.pc = stubRef(target)
+		} else {
+			m.incrementPC()
+		}
+		m.stack.pop()
+		m.stack.pop()
+		return nil, nil
+	case opStackempty:
+		m.stack.push(intValue(boolInt(m.stack.size() == 0)))
+		m.incrementPC()
+		return nil, nil
+	case opPcpush:
+		m.stack.push(value.NewCodePointStub(m.pc.segment, m.pc.pc, m.CodePointHash()))
+		m.incrementPC()
+		return nil, nil
+	case opAuxpush:
+		m.auxstack.push(m.stack.pop())
+		m.incrementPC()
+		return nil, nil
+	case opAuxpop:
+		m.stack.push(m.auxstack.pop())
+		m.incrementPC()
+		return nil, nil
+	case opAuxstackempty:
+		m.stack.push(intValue(boolInt(m.auxstack.size() == 0)))
+		m.incrementPC()
+		return nil, nil
+	case opNop:
+		m.incrementPC()
+		return nil, nil
+	case opErrpush:
+		m.stack.push(m.errpc)
+		m.incrementPC()
+		return nil, nil
+	case opErrset:
+		if target, ok := m.stack.peek(0).(value.CodePointStub); ok {
+			m.errpc = target
+		} else {
+			m.state = statusError
+		}
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+
+	case opDup0, opDup1, opDup2:
+		m.stack.push(m.stack.peek(int(op - opDup0)))
+		m.incrementPC()
+		return nil, nil
+	case opSwap1, opSwap2:
+		depth := int(op-opSwap1) + 1
+		top := m.stack.peek(0)
+		m.stack.set(0, m.stack.peek(depth))
+		m.stack.set(depth, top)
+		m.incrementPC()
+		return nil, nil
+
+	case opTget:
+		index, err := assumeInt64(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		tup, err := assumeTuple(m.stack.peek(1))
+		if err != nil {
+			return nil, err
+		}
+		if index >= uint64(tup.Len()) {
+			return nil, errTupleOutOfRange
+		}
+		m.stack.set(1, tup.Contents()[index])
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opTset:
+		index, err := assumeInt64(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		tup, err := assumeTuple(m.stack.peek(1))
+		if err != nil {
+			return nil, err
+		}
+		newTup, err := tupleSet(tup, index, m.stack.peek(2))
+		if err != nil {
+			return nil, err
+		}
+		m.stack.set(2, newTup)
+		m.stack.pop()
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opTlen:
+		tup, err := assumeTuple(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		m.stack.set(0, value.NewInt64Value(tup.Len()))
+		m.incrementPC()
+		return nil, nil
+	case opXget:
+		index, err := assumeInt64(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		tup, err := assumeTuple(m.auxstack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		if index >= uint64(tup.Len()) {
+			return nil, errTupleOutOfRange
+		}
+		m.stack.set(0, tup.Contents()[index])
+		m.incrementPC()
+		return nil, nil
+	case opXset:
+		index, err := assumeInt64(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		tup, err := assumeTuple(m.auxstack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		newTup, err := tupleSet(tup, index, m.stack.peek(1))
+		if err != nil {
+			return nil, err
+		}
+		m.auxstack.set(0, newTup)
+		m.stack.pop()
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+
+	case opBreakpoint:
+		m.incrementPC()
+		return machine.BreakpointBlocked{}, nil
+	case opLog:
+		m.context.logs = append(m.context.logs, m.stack.pop())
+		m.incrementPC()
+		return nil, nil
+	case opDebugPrint:
+		m.context.debugPrints = append(m.context.debugPrints, m.stack.pop())
+		m.incrementPC()
+		return nil, nil
+
+	case opSend:
+		return nil, m.send()
+	case opInbox:
+		if len(m.context.inboxMessages) == 0 {
+			return machine.InboxBlocked{}, nil
+		}
+		msg := m.context.inboxMessages[0]
+		m.context.inboxMessages = m.context.inboxMessages[1:]
+		m.context.messagesConsumed++
+		m.stack.push(msg.AsValue())
+		m.incrementPC()
+		return nil, nil
+	case opError:
+		m.state = statusError
+		return nil, nil
+	case opHalt:
+		m.state = statusHalted
+		return nil, nil
+	case opSetGas:
+		gas, err := assumeInt(m.stack.peek(0))
+		if err != nil {
+			return nil, err
+		}
+		m.arbGasRemaining.Set(gas)
+		m.stack.pop()
+		m.incrementPC()
+		return nil, nil
+	case opPushGas:
+		m.stack.push(intValue(&m.arbGasRemaining))
+		m.incrementPC()
+		return nil, nil
+	case opErrCodePoint:
+		m.stack.push(m.code.addSegment())
+		m.incrementPC()
+		return nil, nil
+	case opPushInsn:
+		return nil, m.pushInsn(false)
+	case opPushInsnImm:
+		return nil, m.pushInsn(true)
+	case opSideload:
+		return m.sideload()
+
+	case opNewBuffer:
+		m.stack.push(value.NewBuffer(nil))
+		m.incrementPC()
+		return nil, nil
+	case opGetBuffer8:
+		return nil, m.getBuffer(1)
+	case opGetBuffer64:
+		return nil, m.getBuffer(8)
+	case opGetBuffer256:
+		return nil, m.getBuffer(32)
+	case opSetBuffer8:
+		return nil, m.setBuffer(1)
+	case opSetBuffer64:
+		return nil, m.setBuffer(8)
+	case opSetBuffer256:
+		return nil, m.setBuffer(32)
+
+	case opEcrecover:
+		return nil, m.ecRecover()
+	case opEcadd:
+		return nil, m.ecAdd()
+	case opEcmul:
+		return nil, m.ecMul()
+	case opEcpairing:
+		return nil, m.ecPairing()
+	default:
+		m.state = statusError
+		return nil, nil
+	}
+}
+
+// incrementPC advances to the next instruction, which is stored at the
+// previous index of the segment
+func (m *Machine) incrementPC() {
+	m.pc.pc--
+}
+
+func boolInt(b bool) *uint256.Int {
+	if b {
+		return uint256.NewInt(1)
+	}
+	return new(uint256.Int)
+}
+
+func shr(a, b *uint256.Int) *uint256.Int {
+	if !a.LtUint64(256) {
+		return b.Clear()
+	}
+	return b.Rsh(b, uint(a.Uint64()))
+}
+
+func typeCode(val value.Value) uint8 {
+	switch val.(type) {
+	case value.IntValue:
+		return value.TypeCodeInt
+	case value.CodePointStub:
+		return value.TypeCodeCodePoint
+	case *value.Buffer:
+		return value.TypeCodeBuffer
+	default:
+		return value.TypeCodeTuple
+	}
+}
+
+func tupleSet(tup *value.TupleValue, index uint64, val value.Value) (*value.TupleValue, error) {
+	if index >= uint64(tup.Len()) {
+		return nil, errTupleOutOfRange
+	}
+	contents := append([]value.Value{}, tup.Contents()...)
+	contents[index] = val
+	return value.NewTupleFromSlice(contents)
+}
+
+// unaryOp replaces the top of the stack with f applied to it
+func (m *Machine) unaryOp(f func(a *uint256.Int) *uint256.Int) error {
+	a, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	m.stack.set(0, intValue(f(a)))
+	m.incrementPC()
+	return nil
+}
+
+// binaryOp replaces the top two items of the stack with f applied to them
+func (m *Machine) binaryOp(f func(a, b *uint256.Int) *uint256.Int) error {
+	a, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	b, err := assumeInt(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	m.stack.set(1, intValue(f(a, b)))
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+// divOp is a binaryOp which errors when dividing by zero
+func (m *Machine) divOp(f func(a, b *uint256.Int) *uint256.Int) error {
+	a, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	b, err := assumeInt(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	if b.IsZero() {
+		m.state = statusError
+	} else {
+		m.stack.set(1, intValue(f(a, b)))
+	}
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+// modOp replaces the top three items of the stack with f applied to them,
+// erroring if the modulus is zero
+func (m *Machine) modOp(f func(a, b, c *uint256.Int) *uint256.Int) error {
+	a, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	b, err := assumeInt(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	c, err := assumeInt(m.stack.peek(2))
+	if err != nil {
+		return err
+	}
+	if c.IsZero() {
+		m.state = statusError
+	} else {
+		m.stack.set(2, intValue(f(a, b, c)))
+	}
+	m.stack.pop()
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) keccakF() error {
+	tup, err := assumeTuple(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	if tup.Len() != 7 {
+		return errBadPopType
+	}
+	var state [25]uint64
+	for i, item := range tup.Contents() {
+		val, err := assumeInt(item)
+		if err != nil {
+			return err
+		}
+		if i < 6 {
+			copy(state[i*4:], val[:])
+		} else {
+			state[24] = val[0]
+		}
+	}
+	keccakF1600(&state)
+	vals := make([]value.Value, 0, 7)
+	for i := 0; i < 6; i++ {
+		var val uint256.Int
+		copy(val[:], state[i*4:])
+		vals = append(vals, intValue(&val))
+	}
+	vals = append(vals, uint64Value(state[24]))
+	newTup, err := value.NewTupleFromSlice(vals)
+	if err != nil {
+		return err
+	}
+	m.stack.set(0, newTup)
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) sha256F() error {
+	digest, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	first, err := assumeInt(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	second, err := assumeInt(m.stack.peek(2))
+	if err != nil {
+		return err
+	}
+	m.stack.set(2, intValue(sha256Compress(digest, first, second)))
+	m.stack.pop()
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) send() error {
+	size, err := assumeInt64(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	buf, err := assumeBuffer(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	lastIndex := uint64(0)
+	if packed := buf.PackedLen(); packed > 0 {
+		lastIndex = packed - 1
+	}
+	if size > sendSizeLimit || lastIndex >= size || size == 0 {
+		m.state = statusError
+		return nil
+	}
+	m.context.sends = append(m.context.sends, getBufferBytes(buf, 0, size))
+	m.stack.pop()
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) pushInsn(withImmediate bool) error {
+	targetIndex := 1
+	if withImmediate {
+		targetIndex = 2
+	}
+	target, ok := m.stack.peek(targetIndex).(value.CodePointStub)
+	if !ok {
+		m.state = statusError
+		return nil
+	}
+	opInt, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	ref := stubRef(target)
+	if !m.code.contains(ref) {
+		return errors.New("pushinsn target isn't in the machine's code")
+	}
+	opcode := value.Opcode(opInt.Uint64())
+	var newOp value.Operation = value.BasicOperation{Op: opcode}
+	if withImmediate {
+		newOp = value.ImmediateOperation{Op: opcode, Val: m.stack.peek(1)}
+	}
+	m.stack.set(targetIndex, m.code.addOperation(ref, newOp))
+	for i := 0; i < targetIndex; i++ {
+		m.stack.pop()
+	}
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) sideload() (machine.BlockReason, error) {
+	blockNum, err := assumeInt(m.stack.peek(0))
+	if err != nil {
+		return nil, err
+	}
+	if len(m.context.sideloads) > 0 {
+		last := len(m.context.sideloads) - 1
+		m.stack.set(0, m.context.sideloads[last].AsValue())
+		m.context.sideloads = m.context.sideloads[:last]
+	} else {
+		if m.context.stopOnSideload && !m.context.firstInstruction {
+			return sideloadBlocked{blockNum: blockNum}, nil
+		}
+		m.stack.set(0, value.NewEmptyTuple())
+	}
+	m.incrementPC()
+	return nil, nil
+}
+
+func (m *Machine) getBuffer(wordSize uint64) error {
+	offset, err := assumeInt64(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	buf, err := assumeBuffer(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	if offset+wordSize-1 < offset {
+		return errIntOutOfBounds
+	}
+	res := new(uint256.Int).SetBytes(getBufferBytes(buf, offset, wordSize))
+	m.stack.pop()
+	m.stack.pop()
+	m.stack.push(intValue(res))
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) setBuffer(wordSize uint64) error {
+	offset, err := assumeInt64(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	val, err := assumeInt(m.stack.peek(1))
+	if err != nil {
+		return err
+	}
+	switch wordSize {
+	case 1:
+		if !val.LtUint64(256) {
+			return errIntOutOfBounds
+		}
+	case 8:
+		if !val.IsUint64() {
+			return errIntOutOfBounds
+		}
+	}
+	if offset+wordSize-1 < offset {
+		return errIntOutOfBounds
+	}
+	buf, err := assumeBuffer(m.stack.peek(2))
+	if err != nil {
+		return err
+	}
+	valBytes := val.Bytes32()
+	newBuf, err := setBufferBytes(buf, offset, valBytes[32-wordSize:])
+	if err != nil {
+		return err
+	}
+	m.stack.pop()
+	m.stack.pop()
+	m.stack.pop()
+	m.stack.push(newBuf)
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) intArgs(count int) ([]*uint256.Int, error) {
+	ret := make([]*uint256.Int, 0, count)
+	for i := 0; i < count; i++ {
+		val, err := assumeInt(m.stack.peek(i))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, val)
+	}
+	return ret, nil
+}
+
+func (m *Machine) ecRecover() error {
+	args, err := m.intArgs(4)
+	if err != nil {
+		return err
+	}
+	m.stack.set(3, intValue(ecRecover(args[0], args[1], args[2], args[3])))
+	m.stack.pop()
+	m.stack.pop()
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) ecAdd() error {
+	args, err := m.intArgs(4)
+	if err != nil {
+		return err
+	}
+	x, y, err := ecAdd(args[0], args[1], args[2], args[3])
+	if err != nil {
+		m.state = statusError
+		return nil
+	}
+	m.stack.set(2, intValue(x))
+	m.stack.set(3, intValue(y))
+	m.stack.pop()
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) ecMul() error {
+	args, err := m.intArgs(3)
+	if err != nil {
+		return err
+	}
+	x, y, err := ecMul(args[0], args[1], args[2])
+	if err != nil {
+		m.state = statusError
+		return nil
+	}
+	m.stack.set(1, intValue(x))
+	m.stack.set(2, intValue(y))
+	m.stack.pop()
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) ecPairing() error {
+	val, err := assumeTuple(m.stack.peek(0))
+	if err != nil {
+		return err
+	}
+	var points []ecPairingPoint
+	for i := 0; i < maxEcPairingPoints; i++ {
+		if val.Len() == 0 {
+			break
+		}
+		if val.Len() != 2 {
+			return errBadPopType
+		}
+		next, err := assumeTuple(val.Contents()[0])
+		if err != nil {
+			return err
+		}
+		val, err = assumeTuple(val.Contents()[1])
+		if err != nil {
+			return err
+		}
+		if next.Len() != 6 {
+			return errBadPopType
+		}
+		var coords [6]*uint256.Int
+		for j, item := range next.Contents() {
+			coords[j], err = assumeInt(item)
+			if err != nil {
+				return err
+			}
+		}
+		points = append(points, ecPairingPoint{
+			g1: [2]*uint256.Int{coords[0], coords[1]},
+			g2: [4]*uint256.Int{coords[2], coords[3], coords[4], coords[5]},
+		})
+	}
+	if val.Len() != 0 {
+		return errBadPopType
+	}
+	res, err := ecPairing(points)
+	if err != nil {
+		m.state = statusError
+		return nil
+	}
+	m.stack.set(0, intValue(boolInt(res)))
+	m.incrementPC()
+	return nil
+}
+
+func (m *Machine) ecPairingVariableGasCost() uint64 {
+	gas := uint64(0)
+	if m.stack.size() == 0 {
+		return gas
+	}
+	val := m.stack.peek(0)
+	for i := 0; i < maxEcPairingPoints; i++ {
+		tup, ok := val.(*value.TupleValue)
+		if !ok || tup.Len() != 2 {
+			break
+		}
+		val = tup.Contents()[1]
+		gas += ecPairingGasCost
+	}
+	return gas
+}
@@ -0,0 +1,332 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/holiman/uint256"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+func childNestLevel(level int) int {
+	if level > 0 {
+		return level - 1
+	}
+	return 0
+}
+
+// marshalValueForProof serializes a value for the one step proof checker,
+// expanding tuples down to the given nesting level
+func marshalValueForProof(buf *bytes.Buffer, v value.Value, level int, c *code) {
+	switch v := v.(type) {
+	case value.IntValue:
+		buf.WriteByte(value.TypeCodeInt)
+		_ = v.Marshal(buf)
+	case value.HashPreImage:
+		buf.WriteByte(value.TypeCodeHashPreImage)
+		_ = v.Marshal(buf)
+	case *value.TupleValue:
+		if level == 0 {
+			buf.WriteByte(value.TypeCodeHashPreImage)
+			_ = v.GetPreImage().Marshal(buf)
+			return
+		}
+		buf.WriteByte(value.TypeCodeTuple + byte(v.Len()))
+		for _, item := range v.Contents() {
+			marshalValueForProof(buf, item, childNestLevel(level), c)
+		}
+	case value.CodePointStub:
+		cp := c.codePoint(stubRef(v))
+		buf.WriteByte(value.TypeCodeCodePoint)
+		marshalOperationForProof(buf, cp.Op, childNestLevel(level), c)
+		buf.Write(cp.NextHash[:])
+	case *value.Buffer:
+		root := v.MerkleRoot()
+		buf.WriteByte(value.TypeCodeBuffer)
+		buf.Write(root[:])
+	}
+}
+
+func marshalOperationForProof(buf *bytes.Buffer, op value.Operation, level int, c *code) {
+	if immOp, ok := op.(value.ImmediateOperation); ok {
+		buf.WriteByte(1)
+		buf.WriteByte(byte(op.GetOp()))
+		marshalValueForProof(buf, immOp.Val, level, c)
+		return
+	}
+	buf.WriteByte(0)
+	buf.WriteByte(byte(op.GetOp()))
+}
+
+func (m *Machine) marshalState(
+	buf *bytes.Buffer,
+	nextHash common.Hash,
+	stackPreImage value.HashPreImage,
+	auxStackPreImage value.HashPreImage,
+) {
+	buf.Write(nextHash[:])
+	_ = stackPreImage.Marshal(buf)
+	_ = auxStackPreImage.Marshal(buf)
+	marshalValueForProof(buf, m.registerVal, 0, m.code)
+	marshalValueForProof(buf, m.staticVal, 0, m.code)
+	gas := m.arbGasRemaining.Bytes32()
+	buf.Write(gas[:])
+	errHash := m.errpc.Hash()
+	buf.Write(errHash[:])
+}
+
+// MarshalForProof returns the one step proof of the next instruction along
+// with the auxiliary buffer proof for buffer instructions
+func (m *Machine) MarshalForProof() ([]byte, []byte, error) {
+	cp := m.code.codePoint(m.pc)
+	opcode := cp.Op.GetOp()
+	immOp, hasImmediate := cp.Op.(value.ImmediateOperation)
+
+	info := opTable[opcode]
+	if !info.validEntry {
+		info = opTable[opError]
+	}
+	stackPops := info.stackPops
+	immediateLevel := 0
+	if hasImmediate && len(stackPops) > 0 {
+		immediateLevel = stackPops[0]
+		stackPops = stackPops[1:]
+	}
+
+	stackData, stackBottom, stackCount := m.stack.marshalForProof(stackPops, m.code)
+	auxData, auxBottom, auxCount := m.auxstack.marshalForProof(info.auxPops, m.code)
+	underflowed := stackCount < len(stackPops) || auxCount < len(info.auxPops)
+
+	var buf bytes.Buffer
+	buf.WriteByte(byte(opcode))
+	immCount := 0
+	if hasImmediate {
+		immCount = 1
+	}
+	buf.WriteByte(byte(stackCount + immCount))
+	buf.WriteByte(byte(auxCount))
+	buf.Write(stackData)
+	if hasImmediate {
+		marshalValueForProof(&buf, immOp.Val, immediateLevel, m.code)
+	}
+	buf.Write(auxData)
+	m.marshalState(&buf, cp.NextHash, stackBottom, auxBottom)
+	buf.WriteByte(byte(immCount))
+
+	var bufferProof []byte
+	if !underflowed {
+		bufferProof = m.marshalBufferProof(&buf, immOp.Val)
+	}
+	return buf.Bytes(), bufferProof, nil
+}
+
+// argument returns the ith argument of the current instruction, where an
+// immediate value counts as the first argument
+func (m *Machine) argument(i int, imm value.Value) value.Value {
+	if imm != nil {
+		if i == 0 {
+			return imm
+		}
+		i--
+	}
+	return m.stack.peek(i)
+}
+
+func (m *Machine) marshalBufferProof(standardProof *bytes.Buffer, imm value.Value) []byte {
+	opcode := m.code.operation(m.pc).GetOp()
+	if (opcode < opGetBuffer8 || opcode > opSetBuffer256) && opcode != opSend {
+		return nil
+	}
+	var proof bytes.Buffer
+	if opcode == opSend {
+		buffer, ok := m.argument(1, imm).(*value.Buffer)
+		if !ok {
+			return nil
+		}
+		size, ok := m.argument(0, imm).(value.IntValue)
+		if !ok {
+			return nil
+		}
+		loc := size.BigInt().Uint64()
+		if loc > sendSizeLimit {
+			return nil
+		}
+		if loc < buffer.PackedLen() {
+			// Loc must be at or past the last nonzero index in the buffer
+			p := bufferProof(buffer, loc)
+			insertSizes(&proof, len(p))
+			proof.Write(p)
+			return proof.Bytes()
+		}
+		data := trimBuffer(buffer.Data())
+		standardProof.Write(data)
+		standardProof.Write(make([]byte, loc-uint64(len(data))))
+		return nil
+	}
+
+	bufferIndex := 1
+	if opcode >= opSetBuffer8 {
+		bufferIndex = 2
+	}
+	buffer, ok := m.argument(bufferIndex, imm).(*value.Buffer)
+	if !ok {
+		insertSizes(&proof)
+		return proof.Bytes()
+	}
+	offset, ok := m.argument(0, imm).(value.IntValue)
+	if !ok || !offset.BigInt().IsUint64() {
+		insertSizes(&proof)
+		return proof.Bytes()
+	}
+	loc := offset.BigInt().Uint64()
+
+	switch opcode {
+	case opGetBuffer8:
+		p := bufferProof(buffer, loc)
+		insertSizes(&proof, len(p))
+		proof.Write(p)
+	case opGetBuffer64, opGetBuffer256:
+		wordSize := uint64(8)
+		if opcode == opGetBuffer256 {
+			wordSize = 32
+		}
+		p1 := bufferProof(buffer, loc)
+		p2 := bufferProof(buffer, loc+wordSize-1)
+		insertSizes(&proof, len(p1), 0, len(p2))
+		proof.Write(p1)
+		proof.Write(p2)
+	default:
+		val, ok := m.argument(1, imm).(value.IntValue)
+		if !ok {
+			insertSizes(&proof)
+			return proof.Bytes()
+		}
+		wordSize := uint64(1)
+		switch opcode {
+		case opSetBuffer64:
+			wordSize = 8
+		case opSetBuffer256:
+			wordSize = 32
+		}
+		setBufferProof(&proof, buffer, loc, val.BigInt(), wordSize)
+	}
+	return proof.Bytes()
+}
+
+// insertSizes writes a 32 byte header containing the word offsets of each of
+// the following proofs
+func insertSizes(buf *bytes.Buffer, sizes ...int) {
+	var header [32]byte
+	acc := 1
+	header[0] = byte(acc)
+	for i := 0; i < 4; i++ {
+		if i < len(sizes) {
+			acc += sizes[i] / 32
+		}
+		header[i+1] = byte(acc)
+	}
+	buf.Write(header[:])
+}
+
+// setBufferProof proves a write of the low wordSize bytes of val. A write
+// that crosses into a second leaf is proven in two steps, first up to the
+// leaf boundary and then the remainder.
+func setBufferProof(buf *bytes.Buffer, buffer *value.Buffer, loc uint64, val *big.Int, wordSize uint64) {
+	valInt, _ := uint256.FromBig(val)
+	valBytes := valInt.Bytes32()
+	word := valBytes[32-wordSize:]
+
+	var intermediate *value.Buffer
+	for i := uint64(1); i < wordSize; i++ {
+		if (loc+i)%value.BufferLeafSize == 0 {
+			var err error
+			intermediate, err = setBufferBytes(buffer, loc, word[:i])
+			if err != nil {
+				insertSizes(buf)
+				return
+			}
+		}
+	}
+	newBuffer, err := setBufferBytes(buffer, loc, word)
+	if err != nil {
+		insertSizes(buf)
+		return
+	}
+
+	proof1 := bufferProof(buffer, loc)
+	if intermediate == nil {
+		nproof1 := normalizationProof(newBuffer)
+		insertSizes(buf, len(proof1), len(nproof1))
+		buf.Write(proof1)
+		buf.Write(nproof1)
+		return
+	}
+	nproof1 := normalizationProof(intermediate)
+	proof2 := bufferProof(intermediate, loc+wordSize-1)
+	nproof2 := normalizationProof(newBuffer)
+	insertSizes(buf, len(proof1), len(nproof1), len(proof2), len(nproof2))
+	buf.Write(proof1)
+	buf.Write(nproof1)
+	buf.Write(proof2)
+	buf.Write(nproof2)
+}
+
+// bufferProof returns the merkle proof of the leaf containing loc, starting
+// with the leaf itself followed by sibling hashes from the bottom up. A
+// location past the end of the buffer proves the buffer's size instead.
+func bufferProof(buffer *value.Buffer, loc uint64) []byte {
+	depth := buffer.Depth()
+	size := uint64(value.BufferLeafSize) << uint(depth)
+	if loc >= size {
+		loc %= size
+	}
+	leafOffset := loc - loc%value.BufferLeafSize
+	proof := make([]byte, 0, (depth+1)*32)
+	proof = append(proof, getBufferBytes(buffer, leafOffset, value.BufferLeafSize)...)
+	for level := 0; level < depth; level++ {
+		subtreeSize := uint64(value.BufferLeafSize) << uint(level)
+		siblingOffset := (loc / subtreeSize) * subtreeSize
+		siblingOffset ^= subtreeSize
+		sibling := buffer.SubtreeHash(siblingOffset, level)
+		proof = append(proof, sibling[:]...)
+	}
+	return proof
+}
+
+// normalizationProof returns the depth of the buffer along with the hashes of
+// its two children, or its own hash in the case of a single leaf
+func normalizationProof(buffer *value.Buffer) []byte {
+	depth := buffer.Depth()
+	var left, right common.Hash
+	if depth == 0 {
+		left = buffer.MerkleRoot()
+	} else {
+		half := uint64(value.BufferLeafSize) << uint(depth-1)
+		left = buffer.SubtreeHash(0, depth-1)
+		right = buffer.SubtreeHash(half, depth-1)
+	}
+	proof := make([]byte, 0, 96)
+	proof = append(proof, hashing.Uint256(big.NewInt(int64(depth)))...)
+	proof = append(proof, left[:]...)
+	proof = append(proof, right[:]...)
+	return proof
+}
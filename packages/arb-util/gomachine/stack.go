@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"bytes"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var emptyTuplePreImage = value.NewEmptyTuple().GetPreImage()
+
+// datastack is hashed as a linked list of 2-tuples, (top, rest), ending in the
+// empty tuple. The pre-image of each prefix of the stack is cached and
+// invalidated as the stack is modified.
+type datastack struct {
+	values []value.Value
+	hashes []value.HashPreImage
+}
+
+func (s *datastack) clone() datastack {
+	return datastack{
+		values: append([]value.Value{}, s.values...),
+		hashes: append([]value.HashPreImage{}, s.hashes...),
+	}
+}
+
+func (s *datastack) size() int {
+	return len(s.values)
+}
+
+func (s *datastack) push(val value.Value) {
+	s.values = append(s.values, val)
+}
+
+func (s *datastack) pop() value.Value {
+	last := len(s.values) - 1
+	val := s.values[last]
+	s.values[last] = nil
+	s.values = s.values[:last]
+	if len(s.hashes) > last {
+		s.hashes = s.hashes[:last]
+	}
+	return val
+}
+
+// peek returns the item i places from the top of the stack
+func (s *datastack) peek(i int) value.Value {
+	return s.values[len(s.values)-1-i]
+}
+
+func (s *datastack) set(i int, val value.Value) {
+	index := len(s.values) - 1 - i
+	s.values[index] = val
+	if len(s.hashes) > index {
+		s.hashes = s.hashes[:index]
+	}
+}
+
+func (s *datastack) preImage() value.HashPreImage {
+	if len(s.values) == 0 {
+		return emptyTuplePreImage
+	}
+	for len(s.hashes) < len(s.values) {
+		prev := emptyTuplePreImage
+		if len(s.hashes) > 0 {
+			prev = s.hashes[len(s.hashes)-1]
+		}
+		tup := value.NewTuple2(s.values[len(s.hashes)], prev)
+		s.hashes = append(s.hashes, tup.GetPreImage())
+	}
+	return s.hashes[len(s.hashes)-1]
+}
+
+func (s *datastack) hash() common.Hash {
+	return s.preImage().Hash()
+}
+
+// marshalForProof serializes the top items of the stack at the requested
+// marshal levels along with the pre-image of the remainder. If the stack is
+// smaller than the request, all items are serialized at level 0.
+func (s *datastack) marshalForProof(levels []int, c *code) ([]byte, value.HashPreImage, int) {
+	s.preImage()
+	count := len(levels)
+	underflow := false
+	if s.size() < count {
+		count = s.size()
+		underflow = true
+	}
+	var buf bytes.Buffer
+	for i := count - 1; i >= 0; i-- {
+		level := 0
+		if !underflow {
+			level = levels[i]
+		}
+		marshalValueForProof(&buf, s.peek(i), level, c)
+	}
+	bottom := emptyTuplePreImage
+	if remaining := s.size() - count; remaining > 0 {
+		bottom = s.hashes[remaining-1]
+	}
+	return buf.Bytes(), bottom, count
+}
+
+func (s *datastack) String() string {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < s.size(); i++ {
+		buf.WriteString(s.peek(i).String())
+		if i < s.size()-1 {
+			buf.WriteString(", ")
+		}
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
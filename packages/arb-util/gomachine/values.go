@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gomachine
+
+import (
+	"math/big"
+
+	"github.com/holiman/uint256"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/value"
+)
+
+var (
+	errBadPopType      = errors.New("bad pop type")
+	errIntOutOfBounds  = errors.New("int out of bounds")
+	errTupleOutOfRange = errors.New("tuple index out of range")
+)
+
+func newBuffer(data []byte) *value.Buffer {
+	return value.NewBuffer(trimBuffer(data))
+}
+
+func trimBuffer(data []byte) []byte {
+	length := len(data)
+	for length > 0 && data[length-1] == 0 {
+		length--
+	}
+	return data[:length]
+}
+
+func intValue(x *uint256.Int) value.IntValue {
+	return value.NewIntValue(x.ToBig())
+}
+
+func uint64Value(x uint64) value.IntValue {
+	return value.NewIntValue(new(big.Int).SetUint64(x))
+}
+
+func assumeInt(val value.Value) (*uint256.Int, error) {
+	i, ok := val.(value.IntValue)
+	if !ok {
+		return nil, errBadPopType
+	}
+	ret, overflow := uint256.FromBig(i.BigInt())
+	if overflow {
+		return nil, errIntOutOfBounds
+	}
+	return ret, nil
+}
+
+func assumeInt64(val value.Value) (uint64, error) {
+	i, err := assumeInt(val)
+	if err != nil {
+		return 0, err
+	}
+	if !i.IsUint64() {
+		return 0, errIntOutOfBounds
+	}
+	return i.Uint64(), nil
+}
+
+func assumeTuple(val value.Value) (*value.TupleValue, error) {
+	tup, ok := val.(*value.TupleValue)
+	if !ok {
+		return nil, errBadPopType
+	}
+	return tup, nil
+}
+
+func assumeBuffer(val value.Value) (*value.Buffer, error) {
+	buf, ok := val.(*value.Buffer)
+	if !ok {
+		return nil, errBadPopType
+	}
+	return buf, nil
+}
+
+func assumeCodePoint(val value.Value) (value.CodePointStub, error) {
+	cp, ok := val.(value.CodePointStub)
+	if !ok {
+		return value.CodePointStub{}, errBadPopType
+	}
+	return cp, nil
+}
+
+// valuesEqual compares values the same way arb-avm-cpp does, by type and hash
+func valuesEqual(a, b value.Value) bool {
+	switch a.(type) {
+	case value.IntValue:
+		if _, ok := b.(value.IntValue); !ok {
+			return false
+		}
+	case *value.TupleValue:
+		if _, ok := b.(*value.TupleValue); !ok {
+			return false
+		}
+	case value.HashPreImage:
+		if _, ok := b.(value.HashPreImage); !ok {
+			return false
+		}
+	case *value.Buffer:
+		if _, ok := b.(*value.Buffer); !ok {
+			return false
+		}
+	case value.CodePointStub:
+		if _, ok := b.(value.CodePointStub); !ok {
+			return false
+		}
+	default:
+		return false
+	}
+	return a.Hash() == b.Hash()
+}
+
+func getBufferByte(buf *value.Buffer, offset uint64) byte {
+	return buf.Get(offset, 1)[0]
+}
+
+func getBufferBytes(buf *value.Buffer, offset uint64, length uint64) []byte {
+	return buf.Get(offset, length)
+}
+
+// setBufferBytes returns a copy of buf with the given bytes written at offset
+func setBufferBytes(buf *value.Buffer, offset uint64, vals []byte) (*value.Buffer, error) {
+	if offset+uint64(len(vals)) < offset {
+		return nil, errIntOutOfBounds
+	}
+	return buf.Set(offset, vals).Trimmed(), nil
+}
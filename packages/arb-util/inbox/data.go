@@ -26,6 +26,10 @@ import (
 
 var errTupleSize2 = errors.New("expected 2-tuple value")
 
+// Byte arrays are limited to a size far larger than any ArbOS could produce
+// within a block's gas limit so that a corrupt size can't exhaust memory
+const maxByteArraySize = 1 << 26
+
 func ByteArrayToBytes(val value.Value) ([]byte, error) {
 	tupVal, ok := val.(*value.TupleValue)
 	if !ok || tupVal.Len() != 2 {
@@ -47,6 +51,9 @@ func ByteArrayToBytes(val value.Value) ([]byte, error) {
 }
 
 func BufAndLengthToBytes(sizeInt *big.Int, contents *value.Buffer) ([]byte, error) {
+	if !sizeInt.IsUint64() || sizeInt.Uint64() > maxByteArraySize {
+		return nil, errors.Errorf("byte array size %v too large", sizeInt)
+	}
 	size := sizeInt.Uint64()
 	if uint64(len(contents.Data())) > size {
 		return nil, errors.Errorf("buffer too small, size=%v, length=%v", size, len(contents.Data()))
@@ -0,0 +1,87 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inbox
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+)
+
+func FuzzNewInboxMessageFromData(f *testing.F) {
+	f.Add(NewRandomInboxMessage().ToBytes())
+	emptyMessage := NewRandomInboxMessage()
+	emptyMessage.Data = nil
+	f.Add(emptyMessage.ToBytes())
+	f.Add(make([]byte, inboxMessageHeaderSize-1))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := NewInboxMessageFromData(data)
+		if err != nil {
+			return
+		}
+		encoded := msg.ToBytes()
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("message %x was encoded as %x", data, encoded)
+		}
+		decoded, err := NewInboxMessageFromData(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.ToBytes(), encoded) {
+			t.Fatal("message reencoded differently")
+		}
+	})
+}
+
+func FuzzNewSequencerBatchItemFromData(f *testing.F) {
+	msg := NewRandomInboxMessage()
+	seqItem := NewSequencerItem(common.RandBigInt(), msg, common.RandHash())
+	delayedItem := NewDelayedItem(msg.InboxSeqNum, big.NewInt(5), seqItem.Accumulator, big.NewInt(2), common.RandHash())
+	f.Add(seqItem.ToBytesWithSeqNum())
+	f.Add(delayedItem.ToBytesWithSeqNum())
+	f.Add(make([]byte, 95))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		item, err := NewSequencerBatchItemFromData(data)
+		if err != nil {
+			return
+		}
+		encoded := item.ToBytesWithSeqNum()
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("item %x was encoded as %x", data, encoded)
+		}
+		decoded, err := NewSequencerBatchItemFromData(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.ToBytesWithSeqNum(), encoded) {
+			t.Fatal("item reencoded differently")
+		}
+		if len(item.SequencerMessage) >= inboxMessageHeaderSize {
+			// Sequencer messages must be decodable as inbox messages
+			if _, err := NewInboxMessageFromData(item.SequencerMessage); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
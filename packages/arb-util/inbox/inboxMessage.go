@@ -68,8 +68,12 @@ func GetSequenceNumber(data []byte) *big.Int {
 	return sequenceNum
 }
 
+// Size of the kind, sender, block number, timestamp, sequence number and gas
+// price preceding the message data
+const inboxMessageHeaderSize = 1 + 20 + 32*4
+
 func NewInboxMessageFromData(data []byte) (InboxMessage, error) {
-	if len(data) < 129 {
+	if len(data) < inboxMessageHeaderSize {
 		return InboxMessage{}, errors.New("Not enough data for inbox message")
 	}
 	kind := Type(data[0])
@@ -18,10 +18,14 @@ package machine
 
 import (
 	"fmt"
+	"sync"
+
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 )
 
 type ArbStorage interface {
+	ValidatorStateStore
+
 	Initialize(contractPath string) error
 	Initialized() bool
 	CloseArbStorage() bool
@@ -29,6 +33,47 @@ type ArbStorage interface {
 	GetNodeStore() NodeStore
 }
 
+// ValidatorStateStore holds small records the validator needs to survive a
+// restart, such as the progress of an active challenge
+type ValidatorStateStore interface {
+	PutValidatorState(key []byte, data []byte) error
+	GetValidatorState(key []byte) ([]byte, bool)
+	DeleteValidatorState(key []byte) error
+}
+
+type InMemoryValidatorStateStore struct {
+	sync.Mutex
+	records map[string][]byte
+}
+
+func NewInMemoryValidatorStateStore() *InMemoryValidatorStateStore {
+	return &InMemoryValidatorStateStore{records: make(map[string][]byte)}
+}
+
+func (s *InMemoryValidatorStateStore) PutValidatorState(key []byte, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	s.records[string(key)] = append([]byte{}, data...)
+	return nil
+}
+
+func (s *InMemoryValidatorStateStore) GetValidatorState(key []byte) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+	data, ok := s.records[string(key)]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, data...), true
+}
+
+func (s *InMemoryValidatorStateStore) DeleteValidatorState(key []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.records, string(key))
+	return nil
+}
+
 type ValueNotFoundError struct {
 	HashValue common.Hash
 }
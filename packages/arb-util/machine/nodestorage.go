@@ -48,4 +48,12 @@ type NodeStore interface {
 	GetMessageBatch(batchNum *big.Int) *uint64
 	SaveBlock(info *BlockInfo, requests []EVMRequestInfo) error
 	Reorg(height uint64) error
+
+	// CurrentLogCount is the number of core logs that have been processed
+	CurrentLogCount() (*big.Int, error)
+	UpdateCurrentLogCount(count *big.Int) error
+
+	// OldestAvailableBlock is the first block whose state hasn't been pruned
+	OldestAvailableBlock() (uint64, error)
+	UpdateOldestAvailableBlock(height uint64) error
 }
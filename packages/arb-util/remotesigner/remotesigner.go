@@ -0,0 +1,254 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remotesigner
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "remotesigner").Logger()
+
+// TxArgs is the transaction object accepted by both eth_signTransaction and
+// account_signTransaction
+type TxArgs struct {
+	From                 ethcommon.Address  `json:"from"`
+	To                   *ethcommon.Address `json:"to,omitempty"`
+	Gas                  hexutil.Uint64     `json:"gas"`
+	GasPrice             *hexutil.Big       `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big       `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big       `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big       `json:"value"`
+	Nonce                hexutil.Uint64     `json:"nonce"`
+	Data                 hexutil.Bytes      `json:"data"`
+	ChainID              *hexutil.Big       `json:"chainId,omitempty"`
+}
+
+// SignTransactionResult is the response to account_signTransaction
+type SignTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+// Signer signs transactions and messages using an external JSON-RPC signer
+// such as Web3Signer or Clef so that keys never need to be held locally
+type Signer struct {
+	client  *rpc.Client
+	api     string
+	timeout time.Duration
+}
+
+func New(config configuration.WalletRemote) (*Signer, error) {
+	if config.API != configuration.RemoteSignerEthAPI && config.API != configuration.RemoteSignerAccountAPI {
+		return nil, errors.Errorf("unknown remote signer api %v", config.API)
+	}
+	client, err := rpc.Dial(config.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error connecting to remote signer")
+	}
+	return &Signer{
+		client:  client,
+		api:     config.API,
+		timeout: config.Timeout,
+	}, nil
+}
+
+func (s *Signer) Close() {
+	s.client.Close()
+}
+
+func (s *Signer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// SignTransaction has the remote signer sign tx on behalf of from and checks
+// that the signature covers the requested transaction. Legacy transactions are
+// signed for the chain the remote signer is configured with.
+func (s *Signer) SignTransaction(ctx context.Context, from ethcommon.Address, tx *types.Transaction) (*types.Transaction, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	args := NewTxArgs(from, tx)
+	var raw hexutil.Bytes
+	if s.api == configuration.RemoteSignerAccountAPI {
+		var res SignTransactionResult
+		if err := s.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+			return nil, errors.Wrap(err, "remote signer failed to sign transaction")
+		}
+		raw = res.Raw
+	} else {
+		if err := s.client.CallContext(ctx, &raw, "eth_signTransaction", args); err != nil {
+			return nil, errors.Wrap(err, "remote signer failed to sign transaction")
+		}
+	}
+
+	signedTx := new(types.Transaction)
+	if err := signedTx.UnmarshalBinary(raw); err != nil {
+		return nil, errors.Wrap(err, "remote signer returned invalid transaction")
+	}
+	if !signedTx.Protected() {
+		return nil, errors.New("remote signer returned transaction without replay protection")
+	}
+	signer := types.LatestSignerForChainID(signedTx.ChainId())
+	if signer.Hash(signedTx) != signer.Hash(tx) {
+		return nil, errors.New("remote signer signed a different transaction than requested")
+	}
+	sender, err := types.Sender(signer, signedTx)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote signer returned invalid signature")
+	}
+	if sender != from {
+		return nil, errors.Errorf("remote signer signed transaction with %v instead of %v", sender, from)
+	}
+	return signedTx, nil
+}
+
+// SignData signs data as an Ethereum signed message in the same way as
+// eth_sign. The returned signature has a recovery id of 0 or 1 like
+// crypto.Sign.
+func (s *Signer) SignData(ctx context.Context, address ethcommon.Address, data []byte) ([]byte, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var sig hexutil.Bytes
+	var err error
+	if s.api == configuration.RemoteSignerAccountAPI {
+		err = s.client.CallContext(ctx, &sig, "account_signData", accounts.MimetypeTextPlain, address, hexutil.Bytes(data))
+	} else {
+		err = s.client.CallContext(ctx, &sig, "eth_sign", address, hexutil.Bytes(data))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "remote signer failed to sign data")
+	}
+	if len(sig) != crypto.SignatureLength {
+		return nil, errors.Errorf("remote signer returned signature of length %v", len(sig))
+	}
+	sig = append([]byte{}, sig...)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pubkey, err := crypto.SigToPub(accounts.TextHash(data), sig)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote signer returned invalid signature")
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != address {
+		return nil, errors.Errorf("remote signer signed data with %v instead of %v", signer, address)
+	}
+	return sig, nil
+}
+
+// TransactOpts returns transaction options that sign using the remote signer.
+// Requests to the signer are cancelled once ctx is done.
+func (s *Signer) TransactOpts(ctx context.Context, from ethcommon.Address) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address ethcommon.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				logger.Error().Hex("currentaddress", address.Bytes()).Hex("expectedaddress", from.Bytes()).Msg("incorrect from address provided")
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.SignTransaction(ctx, address, tx)
+		},
+	}
+}
+
+// DataSigner returns a function that signs messages with address in the
+// format expected by the sequencer feed
+func (s *Signer) DataSigner(ctx context.Context, address ethcommon.Address) func([]byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return s.SignData(ctx, address, data)
+	}
+}
+
+func NewTxArgs(from ethcommon.Address, tx *types.Transaction) TxArgs {
+	args := TxArgs{
+		From:  from,
+		To:    tx.To(),
+		Gas:   hexutil.Uint64(tx.Gas()),
+		Value: (*hexutil.Big)(tx.Value()),
+		Nonce: hexutil.Uint64(tx.Nonce()),
+		Data:  tx.Data(),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.ChainID = (*hexutil.Big)(tx.ChainId())
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	return args
+}
+
+// ToTransaction converts the args back into an unsigned transaction
+func (args TxArgs) ToTransaction() *types.Transaction {
+	value := new(big.Int)
+	if args.Value != nil {
+		value = args.Value.ToInt()
+	}
+	data := []byte(args.Data)
+	if len(data) == 0 {
+		data = nil
+	}
+	if args.MaxFeePerGas != nil {
+		var tipCap *big.Int
+		if args.MaxPriorityFeePerGas != nil {
+			tipCap = args.MaxPriorityFeePerGas.ToInt()
+		}
+		var chainId *big.Int
+		if args.ChainID != nil {
+			chainId = args.ChainID.ToInt()
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainId,
+			Nonce:     uint64(args.Nonce),
+			GasTipCap: tipCap,
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(args.Gas),
+			To:        args.To,
+			Value:     value,
+			Data:      data,
+		})
+	}
+	gasPrice := new(big.Int)
+	if args.GasPrice != nil {
+		gasPrice = args.GasPrice.ToInt()
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(args.Nonce),
+		GasPrice: gasPrice,
+		Gas:      uint64(args.Gas),
+		To:       args.To,
+		Value:    value,
+		Data:     data,
+	})
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remotesigner
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	chainId := big.NewInt(1337)
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	stub, err := NewStubServer(chainId, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stub.Close()
+
+	dest := ethcommon.HexToAddress("0x54d3173ef7DA5F1411661981A64cE74d46Fe0247")
+	txs := []*types.Transaction{
+		types.NewTx(&types.LegacyTx{
+			Nonce:    5,
+			GasPrice: big.NewInt(1000),
+			Gas:      21000,
+			To:       &dest,
+			Value:    big.NewInt(7),
+		}),
+		types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainId,
+			Nonce:     6,
+			GasTipCap: big.NewInt(10),
+			GasFeeCap: big.NewInt(2000),
+			Gas:       100000,
+			To:        &dest,
+			Value:     big.NewInt(0),
+			Data:      []byte{1, 2, 3},
+		}),
+	}
+
+	for _, api := range []string{configuration.RemoteSignerEthAPI, configuration.RemoteSignerAccountAPI} {
+		signer, err := New(configuration.WalletRemote{
+			API:     api,
+			Timeout: time.Second * 5,
+			URL:     stub.URL,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tx := range txs {
+			signed, err := signer.SignTransaction(context.Background(), from, tx)
+			if err != nil {
+				t.Fatal(api, err)
+			}
+			if signed.Nonce() != tx.Nonce() || signed.Type() != tx.Type() {
+				t.Error(api, "signed transaction doesn't match")
+			}
+		}
+
+		data := []byte("accumulator")
+		sig, err := signer.SignData(context.Background(), from, data)
+		if err != nil {
+			t.Fatal(api, err)
+		}
+		expected, err := crypto.Sign(accounts.TextHash(data), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(sig) != string(expected) {
+			t.Error(api, "signature doesn't match local signature")
+		}
+
+		if _, err := signer.SignTransaction(context.Background(), dest, txs[0]); err == nil {
+			t.Error(api, "signed with unknown account")
+		}
+
+		// Signing through transact opts uses the context they were created with
+		ctx, cancel := context.WithCancel(context.Background())
+		opts := signer.TransactOpts(ctx, from)
+		if _, err := opts.Signer(from, txs[0]); err != nil {
+			t.Error(api, err)
+		}
+		cancel()
+		if _, err := opts.Signer(from, txs[0]); err == nil {
+			t.Error(api, "signed after context was cancelled")
+		}
+		signer.Close()
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package remotesigner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"net/http/httptest"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+// StubServer is a minimal remote signer holding keys in memory which serves
+// both the eth and account signing APIs. It is intended for tests.
+type StubServer struct {
+	URL string
+
+	server *httptest.Server
+	rpc    *rpc.Server
+}
+
+type stubKeys struct {
+	keys   map[ethcommon.Address]*ecdsa.PrivateKey
+	signer types.Signer
+}
+
+func NewStubServer(chainId *big.Int, keys ...*ecdsa.PrivateKey) (*StubServer, error) {
+	stub := &stubKeys{
+		keys:   make(map[ethcommon.Address]*ecdsa.PrivateKey),
+		signer: types.LatestSignerForChainID(chainId),
+	}
+	for _, key := range keys {
+		stub.keys[crypto.PubkeyToAddress(key.PublicKey)] = key
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &stubEthAPI{stub}); err != nil {
+		return nil, err
+	}
+	if err := server.RegisterName("account", &stubAccountAPI{stub}); err != nil {
+		return nil, err
+	}
+	httpServer := httptest.NewServer(server)
+	return &StubServer{
+		URL:    httpServer.URL,
+		server: httpServer,
+		rpc:    server,
+	}, nil
+}
+
+func (s *StubServer) Close() {
+	s.server.Close()
+	s.rpc.Stop()
+}
+
+func (s *stubKeys) key(address ethcommon.Address) (*ecdsa.PrivateKey, error) {
+	key, ok := s.keys[address]
+	if !ok {
+		return nil, errors.Errorf("unknown account %v", address)
+	}
+	return key, nil
+}
+
+func (s *stubKeys) signTransaction(args TxArgs) (*types.Transaction, error) {
+	key, err := s.key(args.From)
+	if err != nil {
+		return nil, err
+	}
+	return types.SignTx(args.ToTransaction(), s.signer, key)
+}
+
+// signData matches eth_sign by returning a signature with a recovery id of
+// 27 or 28
+func (s *stubKeys) signData(address ethcommon.Address, data []byte) (hexutil.Bytes, error) {
+	key, err := s.key(address)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := crypto.Sign(accounts.TextHash(data), key)
+	if err != nil {
+		return nil, err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return sig, nil
+}
+
+type stubEthAPI struct {
+	keys *stubKeys
+}
+
+func (api *stubEthAPI) SignTransaction(args TxArgs) (hexutil.Bytes, error) {
+	tx, err := api.keys.signTransaction(args)
+	if err != nil {
+		return nil, err
+	}
+	return tx.MarshalBinary()
+}
+
+func (api *stubEthAPI) Sign(address ethcommon.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	return api.keys.signData(address, data)
+}
+
+type stubAccountAPI struct {
+	keys *stubKeys
+}
+
+func (api *stubAccountAPI) SignTransaction(args TxArgs) (*SignTransactionResult, error) {
+	tx, err := api.keys.signTransaction(args)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignTransactionResult{Raw: raw, Tx: tx}, nil
+}
+
+func (api *stubAccountAPI) SignData(contentType string, address ethcommon.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != accounts.MimetypeTextPlain {
+		return nil, errors.Errorf("unsupported content type %v", contentType)
+	}
+	return api.keys.signData(address, data)
+}
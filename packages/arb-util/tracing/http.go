@@ -0,0 +1,103 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Same limit go-ethereum applies to JSON-RPC request bodies, anything larger
+// is rejected before being handled
+const maxRequestContentLength = 1024 * 1024 * 5
+
+var rpcTracer = Tracer("rpc")
+
+type jsonRPCCall struct {
+	Method string `json:"method"`
+}
+
+// Read the method names out of the JSON-RPC request without consuming the body
+func peekRPCMethods(r *http.Request) []string {
+	if r.Body == nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestContentLength))
+	r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+	if err != nil {
+		return nil
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var calls []jsonRPCCall
+		if err := json.Unmarshal(data, &calls); err != nil {
+			return nil
+		}
+		methods := make([]string, 0, len(calls))
+		for _, call := range calls {
+			methods = append(methods, call.Method)
+		}
+		return methods
+	}
+	var call jsonRPCCall
+	if err := json.Unmarshal(data, &call); err != nil {
+		return nil
+	}
+	return []string{call.Method}
+}
+
+// NewHTTPHandler wraps a JSON-RPC handler so each request gets a span named
+// after the method called. Trace context sent by the client in the
+// traceparent header is continued, and the span is passed to the handler
+// through the request context.
+func NewHTTPHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		methods := peekRPCMethods(r)
+		name := "rpc"
+		if len(methods) == 1 {
+			name = methods[0]
+		} else if len(methods) > 1 {
+			name = "rpc batch"
+		}
+		ctx, span := rpcTracer.Start(
+			ctx,
+			name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("rpc.system", "jsonrpc"),
+				attribute.StringSlice("rpc.methods", methods),
+				attribute.String("net.peer.ip", r.RemoteAddr),
+			),
+		)
+		defer span.End()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
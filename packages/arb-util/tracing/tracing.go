@@ -0,0 +1,127 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+var logger = log.With().Caller().Stack().Str("component", "tracing").Logger()
+
+const (
+	ExporterOTLP = "otlp"
+	ExporterFile = "file"
+
+	instrumentationName = "github.com/offchainlabs/arbitrum/packages"
+)
+
+var enabled int32
+
+// Enabled returns true once Setup has installed an exporter
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Tracer returns the tracer used to create spans for the given component.
+// Spans are dropped until Setup is called with an exporter configured.
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer(instrumentationName + "/" + component)
+}
+
+// RecordError marks span as failed if err is non-nil and returns err
+func RecordError(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Setup installs the global tracer provider and W3C trace context propagator
+// for the configured exporter. The returned function flushes any buffered
+// spans and should be called before the process exits.
+func Setup(ctx context.Context, config configuration.Tracing, serviceName string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch config.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OTLPEndpoint)}
+		if config.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		otlpExporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating OTLP trace exporter")
+		}
+		exporter = otlpExporter
+	case ExporterFile:
+		var err error
+		file, err = os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening trace file")
+		}
+		fileExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.Wrap(err, "error creating file trace exporter")
+		}
+		exporter = fileExporter
+	default:
+		return nil, errors.Errorf("unknown trace exporter %v", config.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	atomic.StoreInt32(&enabled, 1)
+	logger.Info().Str("exporter", config.Exporter).Float64("sampleRatio", config.SampleRatio).Msg("tracing enabled")
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
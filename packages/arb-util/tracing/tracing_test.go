@@ -0,0 +1,150 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+)
+
+type exportedSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		TraceID string
+		SpanID  string
+	}
+}
+
+func readExportedSpans(t *testing.T, path string) map[string]exportedSpan {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := make(map[string]exportedSpan)
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	for {
+		var span exportedSpan
+		if err := decoder.Decode(&span); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestHTTPHandlerPropagatesContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	traceFile := filepath.Join(dir, "traces.json")
+
+	shutdown, err := Setup(context.Background(), configuration.Tracing{
+		Exporter:    ExporterFile,
+		File:        traceFile,
+		SampleRatio: 1,
+	}, "tracing-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Tracer("test").Start(r.Context(), "handler")
+		defer span.End()
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write(body)
+	}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentSpanID = "00f067aa0ba902b7"
+	request := `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader(request))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != request {
+		t.Error("handler received modified body", string(body))
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readExportedSpans(t, traceFile)
+	rpcSpan, ok := spans["eth_sendRawTransaction"]
+	if !ok {
+		t.Fatal("rpc span not exported, got", spans)
+	}
+	if rpcSpan.SpanContext.TraceID != traceID || rpcSpan.Parent.SpanID != parentSpanID {
+		t.Error("rpc span didn't continue incoming trace", rpcSpan)
+	}
+	handlerSpan, ok := spans["handler"]
+	if !ok {
+		t.Fatal("handler span not exported")
+	}
+	if handlerSpan.Parent.SpanID != rpcSpan.SpanContext.SpanID {
+		t.Error("handler span isn't a child of the rpc span")
+	}
+}
+
+func TestPeekRPCMethods(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`[{"method":"eth_chainId"},{"method":"eth_blockNumber"}]`))
+	methods := peekRPCMethods(req)
+	if len(methods) != 2 || methods[0] != "eth_chainId" || methods[1] != "eth_blockNumber" {
+		t.Error("unexpected methods", methods)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(body), "[{") {
+		t.Error("body consumed by peek")
+	}
+}
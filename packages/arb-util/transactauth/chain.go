@@ -104,7 +104,7 @@ func waitForReceiptWithResultsSimpleInternal(ctx context.Context, receiptFetcher
 				continue
 			}
 			if err != nil {
-				if err.Error() == ethereum.NotFound.Error() || err.Error() == parityErr {
+				if receiptNotFound(err) {
 					continue
 				}
 
@@ -122,7 +122,14 @@ func waitForReceiptWithResultsSimpleInternal(ctx context.Context, receiptFetcher
 	}
 }
 
+func receiptNotFound(err error) bool {
+	return err.Error() == ethereum.NotFound.Error() || err.Error() == parityErr
+}
+
 func WaitForReceiptWithResultsSimple(ctx context.Context, receiptFetcher ArbReceiptFetcher, tx *arbtransaction.ArbTransaction) (*types.Receipt, error) {
+	if waiter, ok := receiptFetcher.(ReceiptWaiter); ok {
+		return waiter.WaitForReceipt(ctx, tx)
+	}
 	return waitForReceiptWithResultsSimpleInternal(ctx, receiptFetcher, tx, nil)
 }
 
@@ -142,7 +149,8 @@ func WaitForReceiptWithResultsAndReplaceByFee(
 	receiptFetcher ArbReceiptFetcher,
 ) (*types.Receipt, error) {
 	var rbfInfo *attemptRbfInfo
-	if transactAuth != nil {
+	waiter, isWaiter := transactAuth.(ReceiptWaiter)
+	if transactAuth != nil && !isWaiter {
 		attemptRbf := func() (*arbtransaction.ArbTransaction, error) {
 			auth := transactAuth.GetAuth(ctx)
 			if auth.GasPrice != nil && auth.GasPrice.Cmp(arbTx.GasPrice()) <= 0 {
@@ -219,7 +227,14 @@ func WaitForReceiptWithResultsAndReplaceByFee(
 			nonce:   arbTx.Nonce(),
 		}
 	}
-	receipt, err := waitForReceiptWithResultsSimpleInternal(ctx, receiptFetcher, arbTx, rbfInfo)
+	var receipt *types.Receipt
+	var err error
+	if isWaiter {
+		// The transaction manager replaces its own transactions
+		receipt, err = waiter.WaitForReceipt(ctx, arbTx)
+	} else {
+		receipt, err = waitForReceiptWithResultsSimpleInternal(ctx, receiptFetcher, arbTx, rbfInfo)
+	}
 	if err != nil {
 		logger.Warn().Err(err).Hex("tx", arbTx.Hash().Bytes()).Msg("error while waiting for transaction receipt")
 		return nil, errors.WithStack(err)
@@ -42,6 +42,20 @@ type TransactAuth interface {
 	GetAuth(ctx context.Context) *bind.TransactOpts
 }
 
+// NonceReserver is implemented by TransactAuths whose GetAuth reserves the
+// returned nonce until a transaction using it is sent
+type NonceReserver interface {
+	ReleaseNonce(nonce uint64)
+}
+
+// ReleaseNonce gives back the nonce in auth, returned by t.GetAuth, if no
+// transaction will be sent with it
+func ReleaseNonce(t TransactAuth, auth *bind.TransactOpts) {
+	if reserver, ok := t.(NonceReserver); ok && auth.Nonce != nil {
+		reserver.ReleaseNonce(auth.Nonce.Uint64())
+	}
+}
+
 func getNonce(ctx context.Context, client ethutils.EthClient, auth *bind.TransactOpts, usePendingNonce bool) error {
 	if auth.Nonce == nil {
 		var nonce uint64
@@ -70,6 +84,7 @@ func makeContract(
 
 	addr, arbTx, err := makeContractImpl(ctx, t, auth, contractFunc)
 	if err != nil {
+		ReleaseNonce(t, auth)
 		return ethcommon.Address{}, nil, err
 	}
 
@@ -85,6 +100,7 @@ func makeContractCustomNonce(
 	customNonce *big.Int,
 ) (ethcommon.Address, *arbtransaction.ArbTransaction, error) {
 	auth := t.GetAuth(ctx)
+	ReleaseNonce(t, auth)
 	origNonce := auth.Nonce
 	defer func(auth *bind.TransactOpts) {
 		auth.Nonce = origNonce
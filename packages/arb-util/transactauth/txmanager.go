@@ -0,0 +1,789 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transactauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbtransaction"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+)
+
+// Geth won't accept a replacement transaction unless it raises fees by 10%
+const minFeeBumpPercent = 10
+
+var (
+	l1TxPendingGauge       = metrics.NewRegisteredGauge("arbitrum/l1tx/pending", nil)
+	l1TxOldestPendingGauge = metrics.NewRegisteredGauge("arbitrum/l1tx/oldest_pending_seconds", nil)
+	l1TxSentCounter        = metrics.NewRegisteredCounter("arbitrum/l1tx/sent", nil)
+	l1TxFeeBumpCounter     = metrics.NewRegisteredCounter("arbitrum/l1tx/fee_bumps", nil)
+	l1TxRebroadcastCounter = metrics.NewRegisteredCounter("arbitrum/l1tx/rebroadcasts", nil)
+	l1TxReplacedCounter    = metrics.NewRegisteredCounter("arbitrum/l1tx/replaced_externally", nil)
+	l1TxConfirmedCounter   = metrics.NewRegisteredCounter("arbitrum/l1tx/confirmed", nil)
+	l1TxFailedCounter      = metrics.NewRegisteredCounter("arbitrum/l1tx/failed", nil)
+	l1TxFeesSpentCounter   = metrics.NewRegisteredCounter("arbitrum/l1tx/fees_spent_gwei", nil)
+	l1TxConfirmTimer       = metrics.NewRegisteredTimer("arbitrum/l1tx/time_to_confirm", nil)
+)
+
+// ReceiptWaiter is implemented by TransactAuths that replace their own
+// transactions, in which case the receipt may be for a different hash than
+// the transaction originally sent
+type ReceiptWaiter interface {
+	WaitForReceipt(ctx context.Context, tx *arbtransaction.ArbTransaction) (*types.Receipt, error)
+}
+
+type managedTx struct {
+	Nonce      uint64           `json:"nonce"`
+	Tx         hexutil.Bytes    `json:"tx"`
+	Hashes     []ethcommon.Hash `json:"hashes"`
+	FirstSent  time.Time        `json:"firstSent"`
+	LastBumped time.Time        `json:"lastBumped"`
+
+	tx *types.Transaction
+}
+
+type txManagerState struct {
+	From      ethcommon.Address `json:"from"`
+	NextNonce uint64            `json:"nextNonce"`
+	Pending   []*managedTx      `json:"pending"`
+}
+
+// TxManager wraps a TransactAuth to give a single owner of the account's
+// nonce. GetAuth reserves a nonce for each caller, and every transaction is
+// persisted before it's sent and until it's included so that nonces survive
+// restarts. Transactions that aren't included are rebroadcast and replaced
+// with escalating fees.
+type TxManager struct {
+	sync.Mutex
+	auth      TransactAuth
+	client    ethutils.EthClient
+	config    configuration.L1TxManager
+	statePath string
+	maxFeeCap *big.Int
+	maxTipCap *big.Int
+
+	// nextNonce is one past the highest nonce reserved or sent, and sentNonce
+	// is one past the highest nonce sent
+	nextNonce uint64
+	sentNonce uint64
+	reserved  map[uint64]bool
+	released  map[uint64]bool
+	pending   map[uint64]*managedTx
+}
+
+func NewTxManager(
+	ctx context.Context,
+	client ethutils.EthClient,
+	auth TransactAuth,
+	config configuration.L1TxManager,
+	stateDir string,
+) (*TxManager, error) {
+	if config.FeeBumpPercent < minFeeBumpPercent {
+		return nil, errors.Errorf("fee bump percent must be at least %v", minFeeBumpPercent)
+	}
+	if config.PollInterval <= 0 {
+		return nil, errors.New("poll interval must be positive")
+	}
+	from := auth.From()
+	m := &TxManager{
+		auth:      auth,
+		client:    client,
+		config:    config,
+		statePath: filepath.Join(stateDir, "l1_tx_manager_"+from.Hex()+".json"),
+		maxFeeCap: gweiToWei(config.MaxFeeCap),
+		maxTipCap: gweiToWei(config.MaxTipCap),
+		reserved:  make(map[uint64]bool),
+		released:  make(map[uint64]bool),
+		pending:   make(map[uint64]*managedTx),
+	}
+
+	state, err := m.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if state.From != (ethcommon.Address{}) && state.From != from {
+		return nil, errors.Errorf("tx manager state is for %v instead of %v", state.From, from)
+	}
+	latestNonce, err := client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get nonce")
+	}
+
+	// The wrapped auth chose whether to start from the pending or latest nonce
+	m.nextNonce = auth.GetAuth(ctx).Nonce.Uint64()
+	if state.NextNonce > m.nextNonce {
+		m.nextNonce = state.NextNonce
+	}
+	for _, mtx := range state.Pending {
+		if mtx.Nonce < latestNonce {
+			// Included while we weren't running
+			continue
+		}
+		mtx.tx = new(types.Transaction)
+		if err := mtx.tx.UnmarshalBinary(mtx.Tx); err != nil {
+			return nil, errors.Wrapf(err, "error loading pending transaction with nonce %v", mtx.Nonce)
+		}
+		m.pending[mtx.Nonce] = mtx
+		if mtx.Nonce >= m.nextNonce {
+			// Persisted before it was sent
+			m.nextNonce = mtx.Nonce + 1
+		}
+	}
+	m.sentNonce = m.nextNonce
+	if len(m.pending) > 0 {
+		logger.Info().Int("count", len(m.pending)).Hex("from", from.Bytes()).Msg("loaded pending L1 transactions")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if err := m.saveStateLocked(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WithTxManager wraps auth in a TxManager started in the background if one is
+// enabled. Fireblocks manages its own nonces and fees so is left unwrapped.
+func WithTxManager(
+	ctx context.Context,
+	client ethutils.EthClient,
+	auth TransactAuth,
+	config configuration.L1TxManager,
+	stateDir string,
+) (TransactAuth, error) {
+	if _, isFireblocks := auth.(*FireblocksTransactAuth); !config.Enable || isFireblocks {
+		return auth, nil
+	}
+	m, err := NewTxManager(ctx, client, auth, config, stateDir)
+	if err != nil {
+		return nil, err
+	}
+	m.Start(ctx)
+	return m, nil
+}
+
+// Start tracks pending transactions in the background until ctx is done
+func (m *TxManager) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(m.config.PollInterval):
+			}
+			if err := m.update(ctx); err != nil {
+				logger.Warn().Err(err).Msg("error updating pending L1 transactions")
+			}
+		}
+	}()
+}
+
+func (m *TxManager) From() ethcommon.Address {
+	return m.auth.From()
+}
+
+func (m *TxManager) NonceAt(ctx context.Context, account ethcommon.Address, blockNumber *big.Int) (uint64, error) {
+	return m.auth.NonceAt(ctx, account, blockNumber)
+}
+
+func (m *TxManager) TransactionReceipt(ctx context.Context, tx *arbtransaction.ArbTransaction) (*types.Receipt, error) {
+	return m.auth.TransactionReceipt(ctx, tx)
+}
+
+func (m *TxManager) Sign(addr ethcommon.Address, tx *types.Transaction) (*types.Transaction, error) {
+	return m.auth.Sign(addr, tx)
+}
+
+// GetAuth reserves the lowest unused nonce and returns options for it with
+// fees capped at the configured maximums. The nonce stays reserved until a
+// transaction using it is sent or it's given back with ReleaseNonce.
+func (m *TxManager) GetAuth(ctx context.Context) *bind.TransactOpts {
+	auth := m.auth.GetAuth(ctx)
+	m.Lock()
+	auth.Nonce = new(big.Int).SetUint64(m.reserveNonceLocked())
+	m.Unlock()
+	if auth.GasPrice != nil {
+		// A fixed gas price was configured
+		return auth
+	}
+	tipCap, feeCap, err := m.suggestFees(ctx)
+	if err != nil {
+		logger.Warn().Err(err).Msg("error suggesting L1 fees, falling back to defaults")
+		return auth
+	}
+	auth.GasTipCap = tipCap
+	auth.GasFeeCap = feeCap
+	return auth
+}
+
+// ReleaseNonce gives back a nonce reserved by GetAuth that won't be used so
+// that it can be reserved again
+func (m *TxManager) ReleaseNonce(nonce uint64) {
+	m.Lock()
+	defer m.Unlock()
+	if !m.reserved[nonce] {
+		return
+	}
+	delete(m.reserved, nonce)
+	m.releaseNonceLocked(nonce)
+}
+
+func (m *TxManager) reserveNonceLocked() uint64 {
+	var nonce uint64
+	found := false
+	for released := range m.released {
+		if !found || released < nonce {
+			nonce = released
+			found = true
+		}
+	}
+	if found {
+		delete(m.released, nonce)
+	} else {
+		nonce = m.nextNonce
+		m.nextNonce++
+	}
+	m.reserved[nonce] = true
+	return nonce
+}
+
+// releaseNonceLocked makes a nonce that no transaction was sent with
+// available again
+func (m *TxManager) releaseNonceLocked(nonce uint64) {
+	if _, ok := m.pending[nonce]; ok {
+		return
+	}
+	m.released[nonce] = true
+	for m.nextNonce > m.sentNonce && m.released[m.nextNonce-1] {
+		delete(m.released, m.nextNonce-1)
+		m.nextNonce--
+	}
+}
+
+// SendTransaction sends and tracks a signed transaction. A transaction with
+// the same nonce as a pending one is only accepted as its replacement if it
+// has the same destination, value and data, or replaceTxByHash names a
+// version of the pending transaction, in which case fees are raised if needed
+// for the replacement to be accepted.
+func (m *TxManager) SendTransaction(ctx context.Context, tx *types.Transaction, replaceTxByHash string) (*arbtransaction.ArbTransaction, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	nonce := tx.Nonce()
+	wasReserved := m.reserved[nonce]
+	delete(m.reserved, nonce)
+	delete(m.released, nonce)
+	existing := m.pending[nonce]
+	if existing != nil && existing.tx.Hash() == tx.Hash() {
+		// Already tracked so this is just a rebroadcast
+		return m.auth.SendTransaction(ctx, tx, replaceTxByHash)
+	}
+	if existing != nil {
+		if !existing.replacedBy(tx, replaceTxByHash) {
+			return nil, errors.Errorf("nonce %v is already used by pending transaction %v", nonce, existing.tx.Hash())
+		}
+		minFees := m.minReplacementFees(existing.tx)
+		if !paysFees(tx, minFees) {
+			var err error
+			tx, err = m.auth.Sign(m.From(), m.withFees(tx, minFees))
+			if err != nil {
+				return nil, err
+			}
+		}
+		replaceTxByHash = existing.tx.Hash().String()
+	}
+
+	mtx := existing
+	if mtx == nil {
+		now := time.Now()
+		mtx = &managedTx{
+			Nonce:      nonce,
+			FirstSent:  now,
+			LastBumped: now,
+		}
+	}
+	arbTx, err := m.sendLocked(ctx, mtx, tx, replaceTxByHash)
+	if err != nil {
+		if existing == nil && wasReserved {
+			m.releaseNonceLocked(nonce)
+		}
+		return nil, err
+	}
+	if nonce >= m.nextNonce {
+		m.nextNonce = nonce + 1
+	}
+	if nonce >= m.sentNonce {
+		m.sentNonce = nonce + 1
+	}
+	return arbTx, nil
+}
+
+// sendLocked persists tx as the latest version of mtx and then sends it,
+// reverting mtx if sending fails. A crash after the state is saved leaves the
+// transaction to be rebroadcast on restart.
+func (m *TxManager) sendLocked(ctx context.Context, mtx *managedTx, tx *types.Transaction, replaceTxByHash string) (*arbtransaction.ArbTransaction, error) {
+	prevTx := mtx.tx
+	prevHashes := mtx.Hashes
+	prevBumped := mtx.LastBumped
+	mtx.tx = tx
+	mtx.Hashes = append(append([]ethcommon.Hash{}, prevHashes...), tx.Hash())
+	if prevTx != nil {
+		mtx.LastBumped = time.Now()
+	}
+	m.pending[mtx.Nonce] = mtx
+	revert := func() {
+		if prevTx == nil {
+			delete(m.pending, mtx.Nonce)
+		} else {
+			mtx.tx = prevTx
+			mtx.Hashes = prevHashes
+			mtx.LastBumped = prevBumped
+		}
+	}
+	if err := m.saveStateLocked(); err != nil {
+		revert()
+		return nil, errors.Wrap(err, "error saving L1 transaction before sending it")
+	}
+
+	arbTx, err := m.auth.SendTransaction(ctx, tx, replaceTxByHash)
+	if err != nil {
+		revert()
+		if err := m.saveStateLocked(); err != nil {
+			logger.Error().Err(err).Msg("error saving L1 transaction state")
+		}
+		return nil, err
+	}
+	l1TxSentCounter.Inc(1)
+	if arbTx.Hash() != tx.Hash() {
+		mtx.Hashes = append(mtx.Hashes, arbTx.Hash())
+		if err := m.saveStateLocked(); err != nil {
+			logger.Error().Err(err).Msg("error saving L1 transaction state")
+		}
+	}
+	return arbTx, nil
+}
+
+// replacedBy returns whether tx is a new version of the pending transaction
+// rather than a different transaction reusing its nonce
+func (mtx *managedTx) replacedBy(tx *types.Transaction, replaceTxByHash string) bool {
+	if replaceTxByHash != "" {
+		for _, hash := range mtx.Hashes {
+			if hash.String() == replaceTxByHash {
+				return true
+			}
+		}
+		return false
+	}
+	sameTo := (tx.To() == nil && mtx.tx.To() == nil) ||
+		(tx.To() != nil && mtx.tx.To() != nil && *tx.To() == *mtx.tx.To())
+	return sameTo && tx.Value().Cmp(mtx.tx.Value()) == 0 && bytes.Equal(tx.Data(), mtx.tx.Data())
+}
+
+// WaitForReceipt waits until any version of tx is included, returning an
+// error if its nonce is used by a transaction the manager didn't send
+func (m *TxManager) WaitForReceipt(ctx context.Context, tx *arbtransaction.ArbTransaction) (*types.Receipt, error) {
+	nonce := tx.Nonce()
+	hashes := []ethcommon.Hash{tx.Hash()}
+	for {
+		m.Lock()
+		if mtx, ok := m.pending[nonce]; ok {
+			hashes = append([]ethcommon.Hash{}, mtx.Hashes...)
+		}
+		m.Unlock()
+
+		receipt, err := m.findReceipt(ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+		if receipt != nil {
+			return receipt, nil
+		}
+		latestNonce, err := m.client.NonceAt(ctx, m.From(), nil)
+		if err != nil {
+			logger.Warn().Err(err).Msg("error getting nonce while waiting for receipt")
+		} else if latestNonce > nonce {
+			// Check again in case it was included since the last check
+			receipt, err := m.findReceipt(ctx, hashes)
+			if err != nil || receipt != nil {
+				return receipt, err
+			}
+			return nil, errors.Errorf("transaction with nonce %v was replaced by an unknown transaction", nonce)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Errorf("receipt not found")
+		case <-time.After(m.config.PollInterval):
+		}
+	}
+}
+
+func (m *TxManager) findReceipt(ctx context.Context, hashes []ethcommon.Hash) (*types.Receipt, error) {
+	for _, hash := range hashes {
+		receipt, err := m.client.TransactionReceipt(ctx, hash)
+		if err != nil {
+			if receiptNotFound(err) {
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+		if receipt != nil {
+			return receipt, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *TxManager) update(ctx context.Context) error {
+	latestNonce, err := m.client.NonceAt(ctx, m.From(), nil)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	pending := make([]*managedTx, 0, len(m.pending))
+	for _, mtx := range m.pending {
+		pending = append(pending, &managedTx{
+			Nonce:      mtx.Nonce,
+			Hashes:     append([]ethcommon.Hash{}, mtx.Hashes...),
+			FirstSent:  mtx.FirstSent,
+			LastBumped: mtx.LastBumped,
+			tx:         mtx.tx,
+		})
+	}
+	m.Unlock()
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Nonce < pending[j].Nonce
+	})
+
+	var done []uint64
+	for _, mtx := range pending {
+		receipt, err := m.findReceipt(ctx, mtx.Hashes)
+		if err != nil {
+			return err
+		}
+		if receipt != nil {
+			m.recordIncluded(ctx, mtx, receipt)
+			done = append(done, mtx.Nonce)
+			continue
+		}
+		if mtx.Nonce < latestNonce {
+			// Check again in case it was included since the last check
+			receipt, err := m.findReceipt(ctx, mtx.Hashes)
+			if err != nil {
+				return err
+			}
+			if receipt != nil {
+				m.recordIncluded(ctx, mtx, receipt)
+			} else {
+				l1TxReplacedCounter.Inc(1)
+				logger.Warn().Uint64("nonce", mtx.Nonce).Msg("pending L1 transaction was replaced by an unknown transaction")
+			}
+			done = append(done, mtx.Nonce)
+			continue
+		}
+		if time.Since(mtx.LastBumped) >= m.config.FeeBumpInterval {
+			if err := m.bumpFees(ctx, mtx); err != nil {
+				logger.Warn().Err(err).Uint64("nonce", mtx.Nonce).Msg("error replacing L1 transaction")
+			}
+			continue
+		}
+		_, _, err = m.client.TransactionByHash(ctx, mtx.tx.Hash())
+		if err != nil && err.Error() == ethereum.NotFound.Error() {
+			// Dropped from the mempool or never propagated
+			l1TxRebroadcastCounter.Inc(1)
+			logger.Info().Uint64("nonce", mtx.Nonce).Str("hash", mtx.tx.Hash().String()).Msg("rebroadcasting dropped L1 transaction")
+			if err := m.client.SendTransaction(ctx, mtx.tx); err != nil {
+				logger.Warn().Err(err).Uint64("nonce", mtx.Nonce).Msg("error rebroadcasting L1 transaction")
+			}
+		}
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	for _, nonce := range done {
+		delete(m.pending, nonce)
+	}
+	for nonce := range m.released {
+		if nonce < latestNonce {
+			// Used by a transaction sent outside the manager
+			delete(m.released, nonce)
+		}
+	}
+	l1TxPendingGauge.Update(int64(len(m.pending)))
+	var oldest time.Time
+	for _, mtx := range m.pending {
+		if oldest.IsZero() || mtx.FirstSent.Before(oldest) {
+			oldest = mtx.FirstSent
+		}
+	}
+	if oldest.IsZero() {
+		l1TxOldestPendingGauge.Update(0)
+	} else {
+		l1TxOldestPendingGauge.Update(int64(time.Since(oldest).Seconds()))
+	}
+	return m.saveStateLocked()
+}
+
+func (m *TxManager) recordIncluded(ctx context.Context, mtx *managedTx, receipt *types.Receipt) {
+	l1TxConfirmedCounter.Inc(1)
+	l1TxConfirmTimer.UpdateSince(mtx.FirstSent)
+	if receipt.Status != 1 {
+		l1TxFailedCounter.Inc(1)
+	}
+
+	// Find the version of the transaction that was included to get its fees
+	tx, _, err := m.client.TransactionByHash(ctx, receipt.TxHash)
+	if err != nil {
+		logger.Warn().Err(err).Str("hash", receipt.TxHash.String()).Msg("error getting included L1 transaction")
+		return
+	}
+	gasPrice := tx.GasPrice()
+	if tx.Type() == types.DynamicFeeTxType {
+		header, err := m.client.HeaderByHash(ctx, receipt.BlockHash)
+		if err != nil {
+			logger.Warn().Err(err).Str("hash", receipt.TxHash.String()).Msg("error getting L1 block header")
+			return
+		}
+		if header.BaseFee != nil {
+			gasPrice = new(big.Int).Add(header.BaseFee, tx.GasTipCap())
+			if gasPrice.Cmp(tx.GasFeeCap()) > 0 {
+				gasPrice = tx.GasFeeCap()
+			}
+		}
+	}
+	fees := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+	l1TxFeesSpentCounter.Inc(fees.Div(fees, big.NewInt(1e9)).Int64())
+	logger.Info().
+		Uint64("nonce", mtx.Nonce).
+		Str("hash", receipt.TxHash.String()).
+		Int("versions", len(mtx.Hashes)).
+		Dur("elapsed", time.Since(mtx.FirstSent)).
+		Msg("L1 transaction included")
+}
+
+// bumpFees replaces a pending transaction with one paying higher fees
+func (m *TxManager) bumpFees(ctx context.Context, mtx *managedTx) error {
+	tipCap, feeCap, err := m.suggestFees(ctx)
+	if err != nil {
+		return err
+	}
+	minFees := m.minReplacementFees(mtx.tx)
+	fees := txFees{tipCap: tipCap, feeCap: feeCap, gasPrice: feeCap}
+	if fees.tipCap == nil {
+		// Pre-EIP-1559 chain
+		gasPrice, err := m.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return err
+		}
+		fees.gasPrice = gasPrice
+	}
+	fees = maxFees(fees, minFees)
+	if fees.exceeds(m.maxFeeCap, m.maxTipCap) {
+		logger.Warn().Uint64("nonce", mtx.Nonce).Str("hash", mtx.tx.Hash().String()).Msg("L1 transaction is stuck with fees at the configured maximum")
+		m.Lock()
+		if current, ok := m.pending[mtx.Nonce]; ok {
+			current.LastBumped = time.Now()
+		}
+		m.Unlock()
+		return nil
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	current, ok := m.pending[mtx.Nonce]
+	if !ok || current.tx.Hash() != mtx.tx.Hash() {
+		// Included or replaced since the update started
+		return nil
+	}
+	signedTx, err := m.auth.Sign(m.From(), m.withFees(current.tx, fees))
+	if err != nil {
+		return err
+	}
+	oldHash := current.tx.Hash()
+	arbTx, err := m.sendLocked(ctx, current, signedTx, oldHash.String())
+	if err != nil {
+		return err
+	}
+	l1TxFeeBumpCounter.Inc(1)
+	logger.Info().
+		Uint64("nonce", current.Nonce).
+		Str("oldHash", oldHash.String()).
+		Str("newHash", arbTx.Hash().String()).
+		Msg("replaced L1 transaction with higher fees")
+	return nil
+}
+
+// suggestFees returns the tip and fee caps for a new transaction, or nil if
+// the chain doesn't support EIP-1559
+func (m *TxManager) suggestFees(ctx context.Context) (*big.Int, *big.Int, error) {
+	header, err := m.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.BaseFee == nil {
+		return nil, nil, nil
+	}
+	tipCap, err := m.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tipCap.Cmp(m.maxTipCap) > 0 {
+		tipCap = m.maxTipCap
+	}
+	feeCap := new(big.Int).Mul(header.BaseFee, big.NewInt(m.config.BaseFeeMultiplier))
+	feeCap.Add(feeCap, tipCap)
+	if feeCap.Cmp(m.maxFeeCap) > 0 {
+		feeCap = m.maxFeeCap
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = feeCap
+	}
+	return tipCap, feeCap, nil
+}
+
+type txFees struct {
+	tipCap   *big.Int
+	feeCap   *big.Int
+	gasPrice *big.Int
+}
+
+func (m *TxManager) minReplacementFees(tx *types.Transaction) txFees {
+	return txFees{
+		tipCap:   increaseByPercent(tx.GasTipCap(), m.config.FeeBumpPercent),
+		feeCap:   increaseByPercent(tx.GasFeeCap(), m.config.FeeBumpPercent),
+		gasPrice: increaseByPercent(tx.GasPrice(), m.config.FeeBumpPercent),
+	}
+}
+
+func maxBig(a, b *big.Int) *big.Int {
+	if a == nil || (b != nil && b.Cmp(a) > 0) {
+		return b
+	}
+	return a
+}
+
+func maxFees(a, b txFees) txFees {
+	return txFees{
+		tipCap:   maxBig(a.tipCap, b.tipCap),
+		feeCap:   maxBig(a.feeCap, b.feeCap),
+		gasPrice: maxBig(a.gasPrice, b.gasPrice),
+	}
+}
+
+func paysFees(tx *types.Transaction, fees txFees) bool {
+	if tx.Type() == types.DynamicFeeTxType {
+		return tx.GasTipCap().Cmp(fees.tipCap) >= 0 && tx.GasFeeCap().Cmp(fees.feeCap) >= 0
+	}
+	return tx.GasPrice().Cmp(fees.gasPrice) >= 0
+}
+
+func (f txFees) exceeds(maxFeeCap *big.Int, maxTipCap *big.Int) bool {
+	return f.feeCap.Cmp(maxFeeCap) > 0 || f.gasPrice.Cmp(maxFeeCap) > 0 || f.tipCap.Cmp(maxTipCap) > 0
+}
+
+// withFees returns an unsigned copy of tx that pays at least the given fees
+func (m *TxManager) withFees(tx *types.Transaction, fees txFees) *types.Transaction {
+	if tx.Type() == types.DynamicFeeTxType {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    tx.ChainId(),
+			Nonce:      tx.Nonce(),
+			GasTipCap:  maxBig(tx.GasTipCap(), fees.tipCap),
+			GasFeeCap:  maxBig(tx.GasFeeCap(), fees.feeCap),
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    tx.Nonce(),
+		GasPrice: maxBig(tx.GasPrice(), fees.gasPrice),
+		Gas:      tx.Gas(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Data:     tx.Data(),
+	})
+}
+
+func (m *TxManager) loadState() (*txManagerState, error) {
+	data, err := ioutil.ReadFile(m.statePath)
+	if os.IsNotExist(err) {
+		return &txManagerState{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading tx manager state")
+	}
+	var state txManagerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrap(err, "error parsing tx manager state")
+	}
+	return &state, nil
+}
+
+func (m *TxManager) saveStateLocked() error {
+	state := txManagerState{
+		From:      m.From(),
+		NextNonce: m.sentNonce,
+		Pending:   make([]*managedTx, 0, len(m.pending)),
+	}
+	for _, mtx := range m.pending {
+		data, err := mtx.tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		mtx.Tx = data
+		state.Pending = append(state.Pending, mtx)
+	}
+	sort.Slice(state.Pending, func(i, j int) bool {
+		return state.Pending[i].Nonce < state.Pending[j].Nonce
+	})
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash can't leave partial state
+	tmpPath := m.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "error writing tx manager state")
+	}
+	return os.Rename(tmpPath, m.statePath)
+}
+
+func gweiToWei(gwei float64) *big.Int {
+	wei, _ := new(big.Float).Mul(big.NewFloat(gwei), big.NewFloat(1e9)).Int(nil)
+	return wei
+}
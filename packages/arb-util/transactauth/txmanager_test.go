@@ -0,0 +1,291 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transactauth
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/arbtransaction"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/configuration"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/ethutils"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/test"
+)
+
+var transferDest = ethcommon.HexToAddress("0x54d3173ef7DA5F1411661981A64cE74d46Fe0247")
+
+func signTransfer(t *testing.T, opts *bind.TransactOpts, nonce uint64, value int64, feeCap *big.Int) *types.Transaction {
+	t.Helper()
+	tx, err := opts.Signer(opts.From, types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     nonce,
+		GasTipCap: opts.GasTipCap,
+		GasFeeCap: feeCap,
+		Gas:       21000,
+		To:        &transferDest,
+		Value:     big.NewInt(value),
+	}))
+	test.FailIfError(t, err)
+	return tx
+}
+
+func sendTransfer(ctx context.Context, t *testing.T, auth TransactAuth) *arbtransaction.ArbTransaction {
+	t.Helper()
+	arbTx, err := MakeTx(ctx, auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return signTransfer(t, opts, opts.Nonce.Uint64(), 1, opts.GasFeeCap), nil
+	})
+	test.FailIfError(t, err)
+	return arbTx
+}
+
+func newTestTxManager(ctx context.Context, t *testing.T) (*TxManager, string) {
+	t.Helper()
+	backend, auths := test.SimulatedBackend(t)
+	client := &ethutils.SimulatedEthClient{SimulatedBackend: backend}
+	stateDir, err := ioutil.TempDir("", "txmanager")
+	test.FailIfError(t, err)
+	auth, err := NewTransactAuth(ctx, client, auths[0])
+	test.FailIfError(t, err)
+	manager, err := NewTxManager(ctx, client, auth, configuration.DefaultL1TxManagerSettings(), stateDir)
+	test.FailIfError(t, err)
+	return manager, stateDir
+}
+
+func TestTxManager(t *testing.T) {
+	ctx := context.Background()
+	backend, auths := test.SimulatedBackend(t)
+	client := &ethutils.SimulatedEthClient{SimulatedBackend: backend}
+	stateDir, err := ioutil.TempDir("", "txmanager")
+	test.FailIfError(t, err)
+	defer os.RemoveAll(stateDir)
+
+	config := configuration.DefaultL1TxManagerSettings()
+	config.MaxFeeCap = 100
+	auth, err := NewTransactAuth(ctx, client, auths[0])
+	test.FailIfError(t, err)
+	manager, err := NewTxManager(ctx, client, auth, config, stateDir)
+	test.FailIfError(t, err)
+
+	first := sendTransfer(ctx, t, manager)
+	second := sendTransfer(ctx, t, manager)
+	if first.Nonce() != 0 || second.Nonce() != 1 {
+		t.Fatal("unexpected nonces", first.Nonce(), second.Nonce())
+	}
+	if first.GasFeeCap().Cmp(gweiToWei(config.MaxFeeCap)) > 0 {
+		t.Error("fee cap above configured maximum")
+	}
+
+	// A restarted manager continues from the persisted nonce and pending txs
+	// even though its auth starts from the latest nonce
+	restartedAuth, err := NewTransactAuth(ctx, client, &bind.TransactOpts{
+		From:   auths[0].From,
+		Signer: auths[0].Signer,
+		Nonce:  big.NewInt(0),
+	})
+	test.FailIfError(t, err)
+	restarted, err := NewTxManager(ctx, client, restartedAuth, config, stateDir)
+	test.FailIfError(t, err)
+	if nonce := restarted.GetAuth(ctx).Nonce.Uint64(); nonce != 2 {
+		t.Fatal("restarted manager has nonce", nonce)
+	}
+	if len(restarted.pending) != 2 {
+		t.Fatal("restarted manager has", len(restarted.pending), "pending transactions")
+	}
+
+	backend.Commit()
+	for _, tx := range []*arbtransaction.ArbTransaction{first, second} {
+		receipt, err := restarted.WaitForReceipt(ctx, tx)
+		test.FailIfError(t, err)
+		if receipt.TxHash != tx.Hash() {
+			t.Error("wrong receipt")
+		}
+	}
+	test.FailIfError(t, restarted.update(ctx))
+	if len(restarted.pending) != 0 {
+		t.Error("included transactions still pending")
+	}
+}
+
+func TestTxManagerReplacementFees(t *testing.T) {
+	config := configuration.DefaultL1TxManagerSettings()
+	m := &TxManager{config: config}
+	dest := ethcommon.HexToAddress("0x54d3173ef7DA5F1411661981A64cE74d46Fe0247")
+	original := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		GasTipCap: big.NewInt(100),
+		GasFeeCap: big.NewInt(1000),
+		Gas:       21000,
+		To:        &dest,
+		Value:     big.NewInt(1),
+	})
+	minFees := m.minReplacementFees(original)
+	if paysFees(original, minFees) {
+		t.Fatal("original transaction can replace itself")
+	}
+	replacement := m.withFees(original, minFees)
+	if !paysFees(replacement, minFees) {
+		t.Fatal("replacement doesn't pay minimum fees")
+	}
+	if replacement.GasTipCap().Int64() != 120 || replacement.GasFeeCap().Int64() != 1200 {
+		t.Error("unexpected replacement fees", replacement.GasTipCap(), replacement.GasFeeCap())
+	}
+	if replacement.Nonce() != original.Nonce() || replacement.Gas() != original.Gas() || *replacement.To() != dest {
+		t.Error("replacement doesn't match original")
+	}
+}
+
+func TestTxManagerNonceReservation(t *testing.T) {
+	ctx := context.Background()
+	manager, stateDir := newTestTxManager(ctx, t)
+	defer os.RemoveAll(stateDir)
+
+	// Concurrent callers each get their own nonce
+	nonces := make(chan uint64, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(nonces); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonces <- manager.GetAuth(ctx).Nonce.Uint64()
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+	seen := make(map[uint64]bool)
+	for nonce := range nonces {
+		if seen[nonce] || nonce >= 10 {
+			t.Fatal("unexpected nonce", nonce)
+		}
+		seen[nonce] = true
+	}
+
+	// Released nonces are handed out again, lowest first
+	manager.ReleaseNonce(7)
+	manager.ReleaseNonce(3)
+	for _, expected := range []uint64{3, 7, 10} {
+		if nonce := manager.GetAuth(ctx).Nonce.Uint64(); nonce != expected {
+			t.Fatal("expected nonce", expected, "but got", nonce)
+		}
+	}
+	for nonce := uint64(0); nonce <= 10; nonce++ {
+		manager.ReleaseNonce(nonce)
+	}
+	if nonce := manager.GetAuth(ctx).Nonce.Uint64(); nonce != 0 {
+		t.Fatal("expected released nonces to be reused but got", nonce)
+	}
+}
+
+func TestTxManagerReplacement(t *testing.T) {
+	ctx := context.Background()
+	manager, stateDir := newTestTxManager(ctx, t)
+	defer os.RemoveAll(stateDir)
+
+	// The simulated backend can't replace transactions
+	manager.auth = &fakeSendAuth{TransactAuth: manager.auth}
+
+	first := sendTransfer(ctx, t, manager)
+	opts := manager.GetAuth(ctx)
+	manager.ReleaseNonce(opts.Nonce.Uint64())
+
+	// A different transaction can't take the nonce of a pending one
+	other := signTransfer(t, opts, first.Nonce(), 2, first.GasFeeCap())
+	if _, err := manager.SendTransaction(ctx, other, ""); err == nil {
+		t.Fatal("different transaction replaced pending transaction")
+	}
+	if _, err := manager.SendTransaction(ctx, other, ethcommon.Hash{}.String()); err == nil {
+		t.Fatal("replaced pending transaction with unknown hash")
+	}
+
+	// The same transaction is replaced with fees raised enough to be accepted
+	firstTx := manager.pending[first.Nonce()].tx
+	same := signTransfer(t, opts, first.Nonce(), 1, new(big.Int).Add(first.GasFeeCap(), big.NewInt(1)))
+	replacement, err := manager.SendTransaction(ctx, same, "")
+	test.FailIfError(t, err)
+	if !paysFees(manager.pending[first.Nonce()].tx, manager.minReplacementFees(firstTx)) {
+		t.Error("replacement doesn't pay minimum fees")
+	}
+	if hashes := manager.pending[first.Nonce()].Hashes; len(hashes) != 2 || hashes[1] != replacement.Hash() {
+		t.Error("replacement not tracked", hashes)
+	}
+
+	// Naming the pending transaction allows changing its contents
+	_, err = manager.SendTransaction(ctx, other, replacement.Hash().String())
+	test.FailIfError(t, err)
+}
+
+// fakeSendAuth pretends to send transactions, calling check first if set and
+// failing with err if set
+type fakeSendAuth struct {
+	TransactAuth
+	check func(tx *types.Transaction)
+	err   error
+}
+
+func (a *fakeSendAuth) SendTransaction(_ context.Context, tx *types.Transaction, _ string) (*arbtransaction.ArbTransaction, error) {
+	if a.check != nil {
+		a.check(tx)
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return arbtransaction.NewArbTransaction(tx), nil
+}
+
+func TestTxManagerPersistsBeforeSending(t *testing.T) {
+	ctx := context.Background()
+	manager, stateDir := newTestTxManager(ctx, t)
+	defer os.RemoveAll(stateDir)
+
+	checked := false
+	manager.auth = &fakeSendAuth{
+		TransactAuth: manager.auth,
+		err:          errors.New("send failed"),
+		check: func(tx *types.Transaction) {
+			state, err := manager.loadState()
+			test.FailIfError(t, err)
+			if len(state.Pending) != 1 || state.Pending[0].Hashes[0] != tx.Hash() {
+				t.Error("transaction not persisted before sending")
+			}
+			checked = true
+		},
+	}
+	_, err := MakeTx(ctx, manager, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return signTransfer(t, opts, opts.Nonce.Uint64(), 1, opts.GasFeeCap), nil
+	})
+	if err == nil || !checked {
+		t.Fatal("transaction wasn't sent")
+	}
+
+	// A failed transaction is forgotten and its nonce can be used again
+	state, err := manager.loadState()
+	test.FailIfError(t, err)
+	if len(state.Pending) != 0 || len(manager.pending) != 0 {
+		t.Error("failed transaction still pending")
+	}
+	if nonce := manager.GetAuth(ctx).Nonce.Uint64(); nonce != 0 {
+		t.Error("failed transaction's nonce wasn't released, next nonce is", nonce)
+	}
+}
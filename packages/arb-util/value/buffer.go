@@ -5,10 +5,55 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
 )
 
+// BufferLeafSize is the number of bytes in each leaf of a buffer's merkle tree
+const BufferLeafSize = 32
+
+var zeroBufferHashes []common.Hash
+
+func init() {
+	var leaf [BufferLeafSize]byte
+	last := hashing.SoliditySHA3(leaf[:])
+	for i := 0; i < 64; i++ {
+		zeroBufferHashes = append(zeroBufferHashes, last)
+		last = hashing.SoliditySHA3(last[:], last[:])
+	}
+}
+
+// maxBufferDepth is the depth of a tree that covers every uint64 offset
+const maxBufferDepth = 59
+
+// Buffer holds its contents as a merkle tree of BufferLeafSize byte leaves in
+// the same shape as arb-avm-cpp, so a write far past the end of a buffer only
+// allocates the path to the leaf it changes. Subtrees that only contain zeros
+// are left out. Buffers must be treated as immutable once created since
+// their nodes are shared between buffers and their hashes are cached.
 type Buffer struct {
-	data []byte
+	root *bufferNode
+	// depth is the height of root, which is the smallest tree that holds
+	// every non-zero byte
+	depth     int
+	packedLen uint64
+	// length is the size of the data the buffer was created from, or of its
+	// non-zero contents if that's larger, and is only used by Data
+	length uint64
+}
+
+// bufferNode is a leaf if it's at depth 0 and an inner node otherwise. A nil
+// node is a subtree of zeros.
+type bufferNode struct {
+	leaf        [BufferLeafSize]byte
+	left, right *bufferNode
+	hash        atomic.Value
 }
 
 func NewBufferFromReader(rd io.Reader) (*Buffer, error) {
@@ -16,16 +61,21 @@ func NewBufferFromReader(rd io.Reader) (*Buffer, error) {
 	if err := binary.Read(rd, binary.BigEndian, &length); err != nil {
 		return nil, err
 	}
-	data := make([]byte, length)
-	_, err := io.ReadFull(rd, data)
-	if err != nil {
+	if length > math.MaxInt64 {
+		return nil, errors.Errorf("buffer length %v too large", length)
+	}
+	// Read incrementally so a corrupt length can't trigger a huge allocation
+	var data bytes.Buffer
+	if _, err := io.CopyN(&data, rd, int64(length)); err != nil {
 		return nil, err
 	}
-	return &Buffer{data: data}, nil
+	return NewBuffer(data.Bytes()), nil
 }
 
 func NewBuffer(data []byte) *Buffer {
-	return &Buffer{data: data}
+	buf := (&Buffer{}).Set(0, data)
+	buf.length = uint64(len(data))
+	return buf
 }
 
 func (b *Buffer) TypeCode() uint8 {
@@ -37,7 +87,7 @@ func (b *Buffer) Equal(other Value) bool {
 	if !ok {
 		return false
 	}
-	return bytes.Equal(b.data, o.data)
+	return b.length == o.length && b.MerkleRoot() == o.MerkleRoot()
 }
 
 func (b *Buffer) Size() int64 {
@@ -45,9 +95,226 @@ func (b *Buffer) Size() int64 {
 }
 
 func (b *Buffer) String() string {
-	return fmt.Sprintf("Buffer(0x%x)", b.data)
+	if b.packedLen > 1024 {
+		return fmt.Sprintf("Buffer(size=%v, root=%v)", b.packedLen, b.MerkleRoot())
+	}
+	return fmt.Sprintf("Buffer(0x%x)", b.Data())
 }
 
+// Data returns the contents of the buffer as flat bytes. This allocates the
+// whole buffer, so Get should be used to read part of a large buffer.
 func (b *Buffer) Data() []byte {
-	return b.data
+	return b.Get(0, b.length)
+}
+
+func (b *Buffer) Hash() common.Hash {
+	root := b.MerkleRoot()
+	return hashing.SoliditySHA3(hashing.Uint256(big.NewInt(123)), root[:])
+}
+
+// PackedLen returns the length of the buffer ignoring any trailing zeros
+func (b *Buffer) PackedLen() uint64 {
+	return b.packedLen
+}
+
+// Depth returns the height of the smallest merkle tree which holds all
+// non-zero bytes of the buffer. A single leaf has depth 0.
+func (b *Buffer) Depth() int {
+	return b.depth
+}
+
+// BufferDepth returns the height of the smallest buffer merkle tree that can
+// hold length bytes
+func BufferDepth(length uint64) int {
+	depth := 0
+	for depth < maxBufferDepth && BufferLeafSize<<uint(depth) < length {
+		depth++
+	}
+	return depth
+}
+
+// MerkleRoot returns the root of the buffer's merkle tree without the type
+// tag that's included in Hash
+func (b *Buffer) MerkleRoot() common.Hash {
+	return b.root.treeHash(b.depth)
+}
+
+// SubtreeHash returns the hash of the subtree of the given depth covering the
+// bytes starting at offset, which must be a multiple of the subtree's size
+func (b *Buffer) SubtreeHash(offset uint64, depth int) common.Hash {
+	if depth >= b.depth {
+		if offset != 0 {
+			return zeroBufferHashes[depth]
+		}
+		hash := b.MerkleRoot()
+		for d := b.depth; d < depth; d++ {
+			zero := zeroBufferHashes[d]
+			hash = hashing.SoliditySHA3(hash[:], zero[:])
+		}
+		return hash
+	}
+	if offset>>uint(b.depth) >= BufferLeafSize {
+		return zeroBufferHashes[depth]
+	}
+	node := b.root
+	for d := b.depth; d > depth && node != nil; d-- {
+		if offset&(BufferLeafSize<<uint(d-1)) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return node.treeHash(depth)
+}
+
+// Get returns length bytes of the buffer starting at offset, with zeros for
+// bytes past its end
+func (b *Buffer) Get(offset uint64, length uint64) []byte {
+	ret := make([]byte, length)
+	for i := uint64(0); i < length; {
+		loc := offset + i
+		if loc < offset || loc >= b.packedLen {
+			break
+		}
+		leafOffset := loc % BufferLeafSize
+		n := copy(ret[i:], b.leaf(loc - leafOffset)[leafOffset:])
+		i += uint64(n)
+	}
+	return ret
+}
+
+// Set returns a copy of the buffer with vals written at offset. The copy
+// shares every subtree that the write doesn't touch. offset+len(vals) must
+// not overflow.
+func (b *Buffer) Set(offset uint64, vals []byte) *Buffer {
+	ret := &Buffer{root: b.root, depth: b.depth, length: b.length}
+	if len(vals) == 0 {
+		ret.packedLen = b.packedLen
+		return ret
+	}
+	last := offset + uint64(len(vals)) - 1
+	for ret.depth < maxBufferDepth && last>>uint(ret.depth) >= BufferLeafSize {
+		if ret.root != nil {
+			ret.root = &bufferNode{left: ret.root}
+		}
+		ret.depth++
+	}
+	ret.root = ret.root.set(ret.depth, 0, offset, vals)
+	ret.normalize()
+	if ret.packedLen > ret.length {
+		ret.length = ret.packedLen
+	}
+	return ret
+}
+
+// Trimmed returns the buffer without any trailing zeros in Data
+func (b *Buffer) Trimmed() *Buffer {
+	return &Buffer{root: b.root, depth: b.depth, packedLen: b.packedLen, length: b.packedLen}
+}
+
+// normalize shrinks the tree to the smallest one holding its contents and
+// recomputes the packed length
+func (b *Buffer) normalize() {
+	for b.depth > 0 && (b.root == nil || b.root.right == nil) {
+		if b.root != nil {
+			b.root = b.root.left
+		}
+		b.depth--
+	}
+	b.packedLen = 0
+	node := b.root
+	base := uint64(0)
+	for d := b.depth; d > 0 && node != nil; d-- {
+		if node.right != nil {
+			base += BufferLeafSize << uint(d-1)
+			node = node.right
+		} else {
+			node = node.left
+		}
+	}
+	if node == nil {
+		return
+	}
+	last := BufferLeafSize - 1
+	for node.leaf[last] == 0 {
+		last--
+	}
+	b.packedLen = base + uint64(last) + 1
+}
+
+func (b *Buffer) leaf(offset uint64) []byte {
+	var zero [BufferLeafSize]byte
+	if offset>>uint(b.depth) >= BufferLeafSize {
+		return zero[:]
+	}
+	node := b.root
+	for d := b.depth; d > 0 && node != nil; d-- {
+		if offset&(BufferLeafSize<<uint(d-1)) == 0 {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	if node == nil {
+		return zero[:]
+	}
+	return node.leaf[:]
+}
+
+// set returns a copy of the subtree n of the given depth starting at base
+// with the overlapping part of vals written at offset, or nil if the result
+// only contains zeros
+func (n *bufferNode) set(depth int, base uint64, offset uint64, vals []byte) *bufferNode {
+	if depth == 0 {
+		var leaf [BufferLeafSize]byte
+		if n != nil {
+			leaf = n.leaf
+		}
+		if offset >= base {
+			copy(leaf[offset-base:], vals)
+		} else {
+			copy(leaf[:], vals[base-offset:])
+		}
+		if leaf == ([BufferLeafSize]byte{}) {
+			return nil
+		}
+		return &bufferNode{leaf: leaf}
+	}
+	half := uint64(BufferLeafSize) << uint(depth-1)
+	mid := base + half
+	last := offset + uint64(len(vals)) - 1
+	left, right := (*bufferNode)(nil), (*bufferNode)(nil)
+	if n != nil {
+		left, right = n.left, n.right
+	}
+	if offset < mid {
+		left = left.set(depth-1, base, offset, vals)
+	}
+	if last >= mid {
+		right = right.set(depth-1, mid, offset, vals)
+	}
+	if left == nil && right == nil {
+		return nil
+	}
+	return &bufferNode{left: left, right: right}
+}
+
+// treeHash returns the hash of n as a subtree of the given depth
+func (n *bufferNode) treeHash(depth int) common.Hash {
+	if n == nil {
+		return zeroBufferHashes[depth]
+	}
+	if hash, ok := n.hash.Load().(common.Hash); ok {
+		return hash
+	}
+	var hash common.Hash
+	if depth == 0 {
+		hash = hashing.SoliditySHA3(n.leaf[:])
+	} else {
+		left := n.left.treeHash(depth - 1)
+		right := n.right.treeHash(depth - 1)
+		hash = hashing.SoliditySHA3(left[:], right[:])
+	}
+	n.hash.Store(hash)
+	return hash
 }
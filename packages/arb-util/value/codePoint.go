@@ -23,6 +23,7 @@ import (
 	"io"
 
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
 )
 
 type Opcode uint8
@@ -151,6 +152,28 @@ func (cv CodePointValue) Equal(val Value) bool {
 	return cv.NextHash == o.NextHash && cv.Op.Equals(o.Op)
 }
 
+func (cv CodePointValue) Hash() common.Hash {
+	return HashCodePoint(cv.Op, cv.NextHash)
+}
+
+// HashCodePoint returns the hash of the code point executing op and then
+// continuing to the code point with hash nextHash
+func HashCodePoint(op Operation, nextHash common.Hash) common.Hash {
+	if immOp, ok := op.(ImmediateOperation); ok {
+		return hashing.SoliditySHA3(
+			hashing.Uint8(TypeCodeCodePoint),
+			hashing.Uint8(uint8(op.GetOp())),
+			hashing.Bytes32(immOp.Val.Hash()),
+			hashing.Bytes32(nextHash),
+		)
+	}
+	return hashing.SoliditySHA3(
+		hashing.Uint8(TypeCodeCodePoint),
+		hashing.Uint8(uint8(op.GetOp())),
+		hashing.Bytes32(nextHash),
+	)
+}
+
 func (cv CodePointValue) Size() int64 {
 	return 1
 }
@@ -19,7 +19,9 @@ package value
 import (
 	"fmt"
 	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
 	"io"
+	"math/big"
 )
 
 type HashPreImage struct {
@@ -55,6 +57,21 @@ func (hp HashPreImage) GetInnerHash() common.Hash {
 	return hp.hashImage
 }
 
+func (hp HashPreImage) Hash() common.Hash {
+	return hashing.SoliditySHA3(
+		hashing.Uint8(TypeCodeTuple),
+		hashing.Bytes32(hp.hashImage),
+		hashing.Uint256(big.NewInt(hp.size)),
+	)
+}
+
+func (hp HashPreImage) Marshal(w io.Writer) error {
+	if _, err := w.Write(hp.hashImage[:]); err != nil {
+		return err
+	}
+	return NewInt64Value(hp.size).Marshal(w)
+}
+
 func (hp HashPreImage) TypeCode() uint8 {
 	return TypeCodeHashPreImage
 }
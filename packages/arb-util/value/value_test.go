@@ -0,0 +1,120 @@
+/*
+ * Copyright 2021, Offchain Labs, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package value
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
+	"github.com/offchainlabs/arbitrum/packages/arb-util/hashing"
+)
+
+func TestValueHashes(t *testing.T) {
+	data, err := ioutil.ReadFile("test_cases.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []struct {
+		Value string `json:"value"`
+		Hash  string `json:"hash"`
+		Name  string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range cases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			valData, err := hex.DecodeString(testCase.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			val, err := UnmarshalValue(bytes.NewReader(valData))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val.Hash() != common.HexToHash(testCase.Hash) {
+				t.Errorf("wrong hash %v for %v", val.Hash(), val)
+			}
+		})
+	}
+}
+
+func TestBufferHash(t *testing.T) {
+	empty := NewBuffer(nil)
+	if empty.MerkleRoot() != NewInt64Value(0).Hash() {
+		t.Error("empty buffer should hash as a single zero leaf")
+	}
+	if NewBuffer(make([]byte, 100)).Hash() != empty.Hash() {
+		t.Error("trailing zeros changed buffer hash")
+	}
+
+	contents := make([]byte, 33)
+	contents[32] = 1
+	var leaf1 [32]byte
+	leaf1[0] = 1
+	left := hashing.SoliditySHA3(make([]byte, 32))
+	right := hashing.SoliditySHA3(leaf1[:])
+	buf := NewBuffer(contents)
+	if buf.Depth() != 1 {
+		t.Error("wrong depth", buf.Depth())
+	}
+	if buf.MerkleRoot() != hashing.SoliditySHA3(left[:], right[:]) {
+		t.Error("wrong merkle root")
+	}
+}
+
+func TestSparseBuffer(t *testing.T) {
+	offset := uint64(0x7048860f3a38)
+	contents := []byte{1, 2, 3, 4}
+	buf := NewBuffer(nil).Set(offset, contents)
+	if buf.PackedLen() != offset+4 {
+		t.Error("wrong packed length", buf.PackedLen())
+	}
+	if !bytes.Equal(buf.Get(offset-1, 6), []byte{0, 1, 2, 3, 4, 0}) {
+		t.Error("wrong contents", buf.Get(offset-1, 6))
+	}
+
+	// Hash up from the written leaf with zero siblings
+	var leaf [BufferLeafSize]byte
+	copy(leaf[offset%BufferLeafSize:], contents)
+	hash := hashing.SoliditySHA3(leaf[:])
+	index := offset / BufferLeafSize
+	for depth := 0; depth < BufferDepth(offset+4); depth++ {
+		zero := zeroBufferHashes[depth]
+		if index&1 == 0 {
+			hash = hashing.SoliditySHA3(hash[:], zero[:])
+		} else {
+			hash = hashing.SoliditySHA3(zero[:], hash[:])
+		}
+		index >>= 1
+	}
+	if buf.MerkleRoot() != hash {
+		t.Error("wrong merkle root")
+	}
+
+	cleared := buf.Set(offset, make([]byte, 4))
+	if cleared.PackedLen() != 0 || cleared.Depth() != 0 || cleared.Hash() != NewBuffer(nil).Hash() {
+		t.Error("clearing buffer didn't shrink it", cleared.PackedLen(), cleared.Depth())
+	}
+	if buf.Get(offset, 1)[0] != 1 {
+		t.Error("set modified original buffer")
+	}
+}
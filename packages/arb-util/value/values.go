@@ -18,6 +18,8 @@ package value
 
 import (
 	"io"
+
+	"github.com/offchainlabs/arbitrum/packages/arb-util/common"
 )
 
 const (
@@ -34,6 +36,7 @@ type Value interface {
 	Equal(Value) bool
 	Size() int64
 	String() string
+	Hash() common.Hash
 }
 
 func Eq(x, y Value) bool {